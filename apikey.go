@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// apiKey is a static key of the --api-keys file, only the sha256 of the key
+// is stored
+type apiKey struct {
+	name  string
+	write bool
+	hash  []byte
+}
+
+// apiKeyAuth authenticates clients by static API keys sent as bearer token,
+// for setups without an OAuth2 controller. A key with the read role grants
+// mcp:read, one with the write role mcp:write and the mcp-admin role too.
+type apiKeyAuth struct {
+	keys []apiKey
+}
+
+// parseAPIKeys reads lines of "name role sha256:hex", the role is read or
+// write. Empty lines and lines starting with # are skipped.
+func parseAPIKeys(file string) (*apiKeyAuth, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the api keys: %w", err)
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Mode().Perm()&0o002 != 0 {
+		return nil, fmt.Errorf("api key file %s is world writable", file)
+	}
+	keys := &apiKeyAuth{}
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected name, role and sha256:hash", file, lineNr)
+		}
+		name, role, hashed := fields[0], fields[1], fields[2]
+		if role != "read" && role != "write" {
+			return nil, fmt.Errorf("%s:%d: unknown role %q, expected read or write", file, lineNr, role)
+		}
+		hexHash, ok := strings.CutPrefix(hashed, "sha256:")
+		hash, err := hex.DecodeString(hexHash)
+		if !ok || err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: invalid hash, expected sha256: and the hex sha256 of the key", file, lineNr)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("%s:%d: duplicate api key name %s", file, lineNr, name)
+		}
+		names[name] = true
+		keys.keys = append(keys.keys, apiKey{name: name, write: role == "write", hash: hash})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read the api keys: %w", err)
+	}
+	if len(keys.keys) == 0 {
+		return nil, fmt.Errorf("no api keys found in %s", file)
+	}
+	return keys, nil
+}
+
+// lookup compares the hash of the token with all keys in constant time
+func (a *apiKeyAuth) lookup(token string) *apiKey {
+	sum := sha256.Sum256([]byte(token))
+	var found *apiKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], a.keys[i].hash) == 1 {
+			found = &a.keys[i]
+		}
+	}
+	return found
+}
+
+func (k *apiKey) tokenInfo() *auth.TokenInfo {
+	scopes := []string{"mcp:read"}
+	var roles []string
+	if k.write {
+		scopes = append(scopes, "mcp:write")
+		roles = append(roles, "mcp-admin")
+	}
+	return &auth.TokenInfo{
+		Scopes: scopes,
+		// keys don't expire, the grant is only valid for the request
+		Expiration: time.Now().Add(time.Hour),
+		UserID:     k.name,
+		Extra: map[string]any{
+			"roles":   roles,
+			"api_key": k.name,
+		},
+	}
+}
+
+// verifier accepts the api keys and passes the other tokens to next, which
+// may be nil without an OAuth2 controller
+func (a *apiKeyAuth) verifier(next auth.TokenVerifier) auth.TokenVerifier {
+	return func(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+		if key := a.lookup(token); key != nil {
+			return key.tokenInfo(), nil
+		}
+		if next == nil {
+			return nil, fmt.Errorf("unknown api key: %w", auth.ErrInvalidToken)
+		}
+		return next(ctx, token, r)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func writeAPIKeys(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "api-keys")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	return file
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := parseAPIKeys(writeAPIKeys(t, "# homelab\nci read "+hashAPIKey("ci-key")+"\n\nadmin write "+hashAPIKey("admin-key")+"\n"))
+	require.NoError(t, err)
+	require.Len(t, keys.keys, 2)
+	assert.Equal(t, "ci", keys.lookup("ci-key").name)
+	assert.True(t, keys.lookup("admin-key").write)
+	assert.Nil(t, keys.lookup("other-key"))
+
+	for _, content := range []string{
+		"",
+		"ci read",
+		"ci admin " + hashAPIKey("ci-key"),
+		"ci read ci-key",
+		"ci read sha256:abcd",
+		"ci read " + hashAPIKey("a") + "\nci write " + hashAPIKey("b"),
+	} {
+		_, err := parseAPIKeys(writeAPIKeys(t, content))
+		assert.Error(t, err, content)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys, err := parseAPIKeys(writeAPIKeys(t, "ci read "+hashAPIKey("ci-key")+"\nadmin write "+hashAPIKey("admin-key")))
+	require.NoError(t, err)
+	authorization, _ := authkeeper.NewTokenAuth()
+	var granted *auth.TokenInfo
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		granted = auth.TokenInfoFromContext(r.Context())
+	})
+	mux, err := buildMux(&httpConfig{APIKeys: keys}, listenSpec{Network: "tcp", Address: "127.0.0.1:8666"}, handler, authorization, nil)
+	require.NoError(t, err)
+
+	call := func(key string) int {
+		granted = nil
+		req := httptest.NewRequest(http.MethodPost, mcpPath, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, call("ci-key"))
+	require.NotNil(t, granted)
+	assert.Equal(t, "ci", granted.UserID)
+	assert.Equal(t, []string{"mcp:read"}, granted.Scopes)
+
+	assert.Equal(t, http.StatusOK, call("admin-key"))
+	assert.Equal(t, []string{"mcp:read", "mcp:write"}, granted.Scopes)
+	assert.Equal(t, []string{"mcp-admin"}, granted.Extra["roles"])
+
+	assert.Equal(t, http.StatusUnauthorized, call("wrong-key"))
+	assert.Nil(t, granted)
+}
@@ -3,6 +3,7 @@ package authkeeper
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -18,6 +19,9 @@ type AuthKeeper interface {
 	IsReadAuthorized(ctx context.Context) (bool, error)
 	IsWriteAuthorized(ctx context.Context) (bool, error)
 	Deauthorize() *godbus.Error
+	// RevokeGrants drops the authorizations kept for further calls, e.g.
+	// the write grants of polkit
+	RevokeGrants() error
 	Close() error
 }
 
@@ -38,6 +42,10 @@ func (a *noAuth) Deauthorize() *godbus.Error {
 	return nil
 }
 
+func (a *noAuth) RevokeGrants() error {
+	return nil
+}
+
 func (a *noAuth) Close() error {
 	return nil
 }
@@ -58,6 +66,10 @@ func (a *polkitAuth) Deauthorize() *godbus.Error {
 	return a.dbus.Deauthorize()
 }
 
+func (a *polkitAuth) RevokeGrants() error {
+	return a.dbus.RevokeGrants()
+}
+
 func (a *polkitAuth) Close() error {
 	if a.dbus != nil && a.dbus.Conn != nil {
 		return a.dbus.Conn.Close()
@@ -67,7 +79,7 @@ func (a *polkitAuth) Close() error {
 
 type OAuth2Provider interface {
 	AuthKeeper
-	VerifyJWT(ctx context.Context, tokenString string, r *http.Request) (*auth.TokenInfo, error)
+	VerifyToken(ctx context.Context, tokenString string, r *http.Request) (*auth.TokenInfo, error)
 	JwksUri() string
 }
 
@@ -88,32 +100,66 @@ func (a *oauth2Auth) Deauthorize() *godbus.Error {
 	return nil
 }
 
+func (a *oauth2Auth) RevokeGrants() error {
+	return nil
+}
+
 func (a *oauth2Auth) Close() error {
 	return nil
 }
 
-func (a *oauth2Auth) VerifyJWT(ctx context.Context, tokenString string, r *http.Request) (*auth.TokenInfo, error) {
-	return a.oauth.VerifyJWT(ctx, tokenString, r)
+func (a *oauth2Auth) VerifyToken(ctx context.Context, tokenString string, r *http.Request) (*auth.TokenInfo, error) {
+	return a.oauth.VerifyToken(ctx, tokenString, r)
 }
 
 func (a *oauth2Auth) JwksUri() string {
 	return a.oauth.JwksUri
 }
 
-// setup the dbus authorization call back.
-func NewPolkitAuth(dbusName, dbusPath string, timeout uint32) (AuthKeeper, error) {
-	conn, err := godbus.ConnectSystemBus()
-	if err != nil {
-		return nil, err
+// tokenAuth checks the token info which the http server put in the
+// context, e.g. for client certificates, without validating tokens itself
+type tokenAuth struct {
+	oauth *remoteauth.Oauth2Auth
+}
+
+func (a *tokenAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
+	return a.oauth.IsReadAuthorized(ctx)
+}
+
+func (a *tokenAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	return a.oauth.IsWriteAuthorized(ctx)
+}
+
+func (a *tokenAuth) Deauthorize() *godbus.Error {
+	return nil
+}
+
+func (a *tokenAuth) RevokeGrants() error {
+	return nil
+}
+
+func (a *tokenAuth) Close() error {
+	return nil
+}
+
+// setup the dbus authorization call back. A write grant of polkit lasts
+// for grantDuration or grantOps operations, if they aren't zero. With
+// perOperation every write call is prompted on its own. The system bus
+// isn't probed here, every check connects to polkit, so that the server
+// starts at once and the tools which need no authorization work without
+// a bus.
+func NewPolkitAuth(dbusName, dbusPath string, timeout uint32, grantDuration time.Duration, grantOps int, perOperation bool) (AuthKeeper, error) {
+	dbusAuth := &dbus.DbusAuth{
+		DbusName: dbusName,
+		DbusPath: dbusPath,
+		Timeout:  timeout,
 	}
-	return &polkitAuth{
-		dbus: &dbus.DbusAuth{
-			Conn:     conn,
-			DbusName: dbusName,
-			DbusPath: dbusPath,
-			Timeout:  timeout,
-		},
-	}, nil
+	if perOperation {
+		dbusAuth.PromptEachWrite()
+	} else if grantDuration > 0 || grantOps > 0 {
+		dbusAuth.LimitWriteGrants(grantDuration, grantOps)
+	}
+	return &polkitAuth{dbus: dbusAuth}, nil
 }
 
 // no auth at all
@@ -124,36 +170,102 @@ func NewNoAuth(readAllowed, writeAllowed bool) (AuthKeeper, error) {
 	}, nil
 }
 
-// remote auth with oauth2
-func NewOauth(controller string, skipVerify bool) (AuthKeeper, error) {
-	if !strings.HasPrefix(controller, "http") {
-		controller = "http://" + controller
+// auth by the token info granted by the http server
+func NewTokenAuth() (AuthKeeper, error) {
+	return &tokenAuth{oauth: &remoteauth.Oauth2Auth{}}, nil
+}
+
+func issuerURL(issuer string) string {
+	if !strings.HasPrefix(issuer, "http") {
+		return "http://" + issuer
+	}
+	return issuer
+}
+
+// remote auth with oauth2, opaque tokens are introspected if a client for
+// the introspection endpoint is configured. The JWTs of the trusted issuers
+// are accepted too, each one is validated with the keys of its issuer.
+func NewOauth(controller string, trustedIssuers []string, skipVerify bool, introspection remoteauth.IntrospectionConfig, jwks remoteauth.JWKSConfig, requirements *remoteauth.TokenRequirements) (AuthKeeper, error) {
+	controller = issuerURL(controller)
+	switch introspection.Validation {
+	case "", remoteauth.ValidationAuto, remoteauth.ValidationJWT, remoteauth.ValidationIntrospection:
+	default:
+		return nil, fmt.Errorf("unknown token validation %q, expected auto, jwt or introspection", introspection.Validation)
 	}
-	jwksURI, err := remoteauth.GetJwksURI(controller, skipVerify)
+	openIDConfig, err := remoteauth.GetOpenIDConfig(controller, skipVerify)
 	if err != nil {
 		return nil, err
 	}
 	ctx := context.Background()
 
-	override := keyfunc.Override{}
+	client := &http.Client{Timeout: 10 * time.Second}
 	if skipVerify {
-		override.Client = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-			Timeout: 10 * time.Second,
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		}
 	}
 
-	keyf, err := keyfunc.NewDefaultOverrideCtx(ctx, []string{jwksURI}, override)
-	if err != nil {
-		return nil, err
+	oauth := &remoteauth.Oauth2Auth{
+		JwksUri:      openIDConfig.JwksURI,
+		Validation:   introspection.Validation,
+		Issuer:       openIDConfig.Issuer,
+		Requirements: requirements,
+	}
+	if oauth.Issuer == "" {
+		oauth.Issuer = controller
+	}
+	if introspection.Validation != remoteauth.ValidationJWT && introspection.ClientID != "" {
+		endpoint := introspection.Endpoint
+		if endpoint == "" {
+			endpoint = openIDConfig.IntrospectionEndpoint
+		}
+		if endpoint == "" {
+			return nil, fmt.Errorf("controller has no introspection endpoint, set --introspection-endpoint")
+		}
+		oauth.Introspector = remoteauth.NewIntrospector(endpoint, introspection.ClientID, introspection.ClientSecret, introspection.CacheTTL, client)
+		oauth.Introspector.Requirements = requirements
+	} else if introspection.Validation == remoteauth.ValidationIntrospection {
+		return nil, fmt.Errorf("token introspection requires --introspection-client-id")
+	}
+	if introspection.IntrospectJWT {
+		if oauth.Introspector == nil {
+			return nil, fmt.Errorf("--introspect-jwt requires --introspection-client-id and a validation other than jwt")
+		}
+		oauth.IntrospectJWT = true
+	}
+	if introspection.RevocationList != "" {
+		oauth.Revocations, err = remoteauth.NewRevocationList(ctx, introspection.RevocationList, client, introspection.RevocationRefresh)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if introspection.Validation != remoteauth.ValidationIntrospection {
+		keyf, err := remoteauth.NewJWKS(ctx, openIDConfig.JwksURI, client, jwks)
+		if err != nil {
+			return nil, err
+		}
+		oauth.KeyFunc = keyf
+		for _, issuer := range trustedIssuers {
+			issuer = issuerURL(issuer)
+			issuerConfig, err := remoteauth.GetOpenIDConfig(issuer, skipVerify)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't get the configuration of the issuer %s: %w", issuer, err)
+			}
+			issuerKeys, err := remoteauth.NewJWKS(ctx, issuerConfig.JwksURI, client, jwks)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't get the keys of the issuer %s: %w", issuer, err)
+			}
+			if issuerConfig.Issuer == "" {
+				issuerConfig.Issuer = issuer
+			}
+			if oauth.Issuers == nil {
+				oauth.Issuers = make(map[string]keyfunc.Keyfunc)
+			}
+			oauth.Issuers[issuerConfig.Issuer] = issuerKeys
+		}
 	}
 	return &oauth2Auth{
-		oauth: &remoteauth.Oauth2Auth{
-			KeyFunc: keyf,
-			JwksUri: jwksURI,
-		},
+		oauth:   oauth,
 		context: ctx,
 	}, nil
 }
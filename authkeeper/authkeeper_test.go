@@ -29,3 +29,11 @@ func TestDeauthorizeNoAuth(t *testing.T) {
 	errDeauth := auth.Deauthorize()
 	assert.Nil(t, errDeauth)
 }
+
+func TestNewPolkitAuthWithoutBus(t *testing.T) {
+	// the bus is connected by the checks, not at the start
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", "unix:path=/nonexistent/system_bus_socket")
+	auth, err := authkeeper.NewPolkitAuth("org.opensuse.systemdmcp", "/org/opensuse/systemdmcp", 5, 0, 0, false)
+	assert.NoError(t, err)
+	assert.NoError(t, auth.Close())
+}
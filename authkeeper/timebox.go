@@ -0,0 +1,52 @@
+package authkeeper
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// writeDeadline is the end of the time box for write authorization
+type writeDeadline time.Time
+
+func (d writeDeadline) check() error {
+	if time.Now().After(time.Time(d)) {
+		return fmt.Errorf("write authorization expired at %s, server is read-only", time.Time(d).Format(time.RFC3339))
+	}
+	return nil
+}
+
+type timeBoxedAuth struct {
+	AuthKeeper
+	deadline writeDeadline
+}
+
+func (a *timeBoxedAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	if err := a.deadline.check(); err != nil {
+		return false, err
+	}
+	return a.AuthKeeper.IsWriteAuthorized(ctx)
+}
+
+// the oauth2 variant has to stay an OAuth2Provider for the http handlers
+type timeBoxedOAuth2 struct {
+	OAuth2Provider
+	deadline writeDeadline
+}
+
+func (a *timeBoxedOAuth2) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	if err := a.deadline.check(); err != nil {
+		return false, err
+	}
+	return a.OAuth2Provider.IsWriteAuthorized(ctx)
+}
+
+// NewWriteTimeBox allows write only for the given duration, afterwards all
+// write requests are denied. Read authorization is unchanged.
+func NewWriteTimeBox(inner AuthKeeper, d time.Duration) AuthKeeper {
+	deadline := writeDeadline(time.Now().Add(d))
+	if oauth, ok := inner.(OAuth2Provider); ok {
+		return &timeBoxedOAuth2{OAuth2Provider: oauth, deadline: deadline}
+	}
+	return &timeBoxedAuth{AuthKeeper: inner, deadline: deadline}
+}
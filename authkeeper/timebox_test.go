@@ -0,0 +1,29 @@
+package authkeeper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTimeBox(t *testing.T) {
+	inner, err := authkeeper.NewNoAuth(true, true)
+	assert.NoError(t, err)
+	auth := authkeeper.NewWriteTimeBox(inner, 50*time.Millisecond)
+
+	writeAllowed, err := auth.IsWriteAuthorized(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, writeAllowed)
+
+	time.Sleep(60 * time.Millisecond)
+	writeAllowed, err = auth.IsWriteAuthorized(context.Background())
+	assert.ErrorContains(t, err, "expired")
+	assert.False(t, writeAllowed)
+
+	readAllowed, err := auth.IsReadAuthorized(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, readAllowed)
+}
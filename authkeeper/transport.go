@@ -0,0 +1,71 @@
+package authkeeper
+
+import (
+	"context"
+
+	godbus "github.com/godbus/dbus/v5"
+)
+
+type stdioKey struct{}
+
+// WithStdio marks the context of a call which came over stdin/stdout
+func WithStdio(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stdioKey{}, true)
+}
+
+// IsStdio reports whether the call came over stdin/stdout
+func IsStdio(ctx context.Context) bool {
+	stdio, _ := ctx.Value(stdioKey{}).(bool)
+	return stdio
+}
+
+// perTransport authorizes the calls over stdin/stdout and the ones over
+// http each with their own keeper. Calls which aren't marked as stdio are
+// authorized like http calls, which is the stricter mode.
+type perTransport struct {
+	stdio AuthKeeper
+	http  AuthKeeper
+}
+
+func (a *perTransport) keeper(ctx context.Context) AuthKeeper {
+	if IsStdio(ctx) {
+		return a.stdio
+	}
+	return a.http
+}
+
+func (a *perTransport) IsReadAuthorized(ctx context.Context) (bool, error) {
+	return a.keeper(ctx).IsReadAuthorized(ctx)
+}
+
+func (a *perTransport) IsWriteAuthorized(ctx context.Context) (bool, error) {
+	return a.keeper(ctx).IsWriteAuthorized(ctx)
+}
+
+func (a *perTransport) Deauthorize() *godbus.Error {
+	if err := a.stdio.Deauthorize(); err != nil {
+		return err
+	}
+	return a.http.Deauthorize()
+}
+
+func (a *perTransport) RevokeGrants() error {
+	if err := a.stdio.RevokeGrants(); err != nil {
+		return err
+	}
+	return a.http.RevokeGrants()
+}
+
+func (a *perTransport) Close() error {
+	err := a.stdio.Close()
+	if httpErr := a.http.Close(); err == nil {
+		err = httpErr
+	}
+	return err
+}
+
+// NewPerTransport authorizes the calls marked with WithStdio with stdio and
+// all others with http, so that both transports can be served at once
+func NewPerTransport(stdio, http AuthKeeper) AuthKeeper {
+	return &perTransport{stdio: stdio, http: http}
+}
@@ -0,0 +1,29 @@
+package authkeeper_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerTransport(t *testing.T) {
+	stdio, _ := authkeeper.NewNoAuth(true, true)
+	http, _ := authkeeper.NewNoAuth(true, false)
+	auth := authkeeper.NewPerTransport(stdio, http)
+
+	writeAllowed, err := auth.IsWriteAuthorized(authkeeper.WithStdio(context.Background()))
+	assert.NoError(t, err)
+	assert.True(t, writeAllowed)
+
+	// unmarked calls are authorized like http calls
+	writeAllowed, err = auth.IsWriteAuthorized(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, writeAllowed)
+
+	readAllowed, err := auth.IsReadAuthorized(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, readAllowed)
+	assert.False(t, authkeeper.IsStdio(context.Background()))
+}
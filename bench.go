@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/coreos/go-systemd/v22/sdjournal"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/openSUSE/systemd-mcp/remoteauth"
+)
+
+type benchStep struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+	Skipped  bool
+}
+
+// measures the latency of the slow steps of the server initialization, the
+// system bus of --system-bus is set before and the journal is opened in
+// journalDir if it is set, like the server does
+func runBench(ctx context.Context, controller string, skipVerify bool, journalDir string) []benchStep {
+	var steps []benchStep
+	measure := func(name string, fn func() error) {
+		start := time.Now()
+		err := fn()
+		step := benchStep{Name: name, Duration: time.Since(start), Err: err}
+		slog.Info("bench", "step", name, "duration", step.Duration, "error", err)
+		steps = append(steps, step)
+	}
+
+	measure("dbus connect", func() error {
+		conn, err := systemd.NewSystem(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// the bus is only connected by the first call
+		_, err = conn.Version(ctx)
+		return err
+	})
+	measure("journal open", func() error {
+		var j *sdjournal.Journal
+		var err error
+		if journalDir != "" {
+			j, err = sdjournal.NewJournalFromDir(journalDir)
+		} else {
+			j, err = sdjournal.NewJournal()
+		}
+		if err != nil {
+			return err
+		}
+		return j.Close()
+	})
+	if _, err := exec.LookPath("man"); err == nil {
+		measure("man index", func() error {
+			return exec.CommandContext(ctx, "man", "-f", "man").Run()
+		})
+	} else {
+		steps = append(steps, benchStep{Name: "man index", Skipped: true})
+	}
+	if controller != "" {
+		if !strings.HasPrefix(controller, "http") {
+			controller = "http://" + controller
+		}
+		var jwksURI string
+		measure("oidc discovery", func() (err error) {
+			jwksURI, err = remoteauth.GetJwksURI(controller, skipVerify)
+			return err
+		})
+		if jwksURI != "" {
+			measure("jwks fetch", func() error {
+				client := &http.Client{Timeout: 10 * time.Second}
+				if skipVerify {
+					client.Transport = &http.Transport{
+						TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+					}
+				}
+				resp, err := client.Get(jwksURI)
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					return fmt.Errorf("failed to get jwks: %s", resp.Status)
+				}
+				return nil
+			})
+		}
+	} else {
+		steps = append(steps, benchStep{Name: "jwks fetch", Skipped: true})
+	}
+	return steps
+}
+
+func printBench(steps []benchStep) {
+	var total time.Duration
+	tb := tabby.New()
+	tb.AddHeader("STEP", "DURATION", "RESULT")
+	for _, step := range steps {
+		result := "ok"
+		if step.Skipped {
+			result = "skipped"
+		} else if step.Err != nil {
+			result = step.Err.Error()
+		}
+		total += step.Duration
+		tb.AddLine(step.Name, step.Duration.Round(time.Microsecond), result)
+	}
+	tb.AddLine("total", total.Round(time.Microsecond), "")
+	tb.Print()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// certMatch is an attribute of a client certificate given as ATTR=pattern,
+// the pattern is a shell glob
+type certMatch struct {
+	attr    string
+	pattern string
+}
+
+var certAttrs = []string{"CN", "O", "OU", "DNS", "EMAIL", "URI"}
+
+func parseCertMatches(entries []string) ([]certMatch, error) {
+	var matches []certMatch
+	for _, entry := range entries {
+		attr, pattern, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		attr = strings.ToUpper(attr)
+		if !ok || pattern == "" || !slices.Contains(certAttrs, attr) {
+			return nil, fmt.Errorf("invalid client certificate match %q, expected one of %s=pattern", entry, strings.Join(certAttrs, ","))
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern in client certificate match %q: %w", entry, err)
+		}
+		matches = append(matches, certMatch{attr: attr, pattern: pattern})
+	}
+	return matches, nil
+}
+
+func (m certMatch) values(cert *x509.Certificate) []string {
+	switch m.attr {
+	case "CN":
+		return []string{cert.Subject.CommonName}
+	case "O":
+		return cert.Subject.Organization
+	case "OU":
+		return cert.Subject.OrganizationalUnit
+	case "DNS":
+		return cert.DNSNames
+	case "EMAIL":
+		return cert.EmailAddresses
+	case "URI":
+		var uris []string
+		for _, u := range cert.URIs {
+			uris = append(uris, u.String())
+		}
+		return uris
+	}
+	return nil
+}
+
+func (m certMatch) matches(cert *x509.Certificate) bool {
+	return slices.ContainsFunc(m.values(cert), func(v string) bool {
+		ok, _ := path.Match(m.pattern, v)
+		return ok
+	})
+}
+
+// clientCertAuth authenticates clients by a certificate signed by
+// --client-ca, as an alternative to OAuth2 in fleets without an IdP. Every
+// valid certificate grants mcp:read, a certificate matching one of the
+// writers grants mcp:write and the mcp-admin role too.
+type clientCertAuth struct {
+	pool    *x509.CertPool
+	writers []certMatch
+}
+
+func newClientCertAuth(caFile string, writers []string) (*clientCertAuth, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in the client CA %s", caFile)
+	}
+	matches, err := parseCertMatches(writers)
+	if err != nil {
+		return nil, err
+	}
+	return &clientCertAuth{pool: pool, writers: matches}, nil
+}
+
+// configure asks the clients of a TLS listener for a certificate, which is
+// required unless the bearer token is the alternative
+func (c *clientCertAuth) configure(config *tls.Config, required bool) {
+	config.ClientCAs = c.pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if required {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+}
+
+// tokenInfo returns the grant of a verified client certificate
+func (c *clientCertAuth) tokenInfo(cert *x509.Certificate) *auth.TokenInfo {
+	scopes := []string{"mcp:read"}
+	var roles []string
+	if slices.ContainsFunc(c.writers, func(m certMatch) bool { return m.matches(cert) }) {
+		scopes = append(scopes, "mcp:write")
+		roles = append(roles, "mcp-admin")
+	}
+	user := cert.Subject.CommonName
+	if user == "" {
+		user = cert.Subject.String()
+	}
+	return &auth.TokenInfo{
+		Scopes:     scopes,
+		Expiration: cert.NotAfter,
+		UserID:     user,
+		Extra: map[string]any{
+			"roles":       roles,
+			"client_cert": cert.Subject.String(),
+		},
+	}
+}
+
+// middleware grants the requests with a verified client certificate, the
+// others are passed to fallback. Like for the noauth listeners the grant is
+// passed through the bearer token middleware.
+func (c *clientCertAuth) middleware(next, fallback http.Handler) http.Handler {
+	granted := auth.RequireBearerToken(func(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+		return c.tokenInfo(r.TLS.VerifiedChains[0][0]), nil
+	}, nil)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		r.Header.Set("Authorization", "Bearer client-certificate")
+		granted.ServeHTTP(w, r)
+	})
+}
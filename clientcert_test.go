@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCertMatches(t *testing.T) {
+	matches, err := parseCertMatches([]string{"cn=admin-*", "OU=ops"})
+	require.NoError(t, err)
+	assert.Equal(t, []certMatch{{attr: "CN", pattern: "admin-*"}, {attr: "OU", pattern: "ops"}}, matches)
+
+	for _, entry := range []string{"admin", "CN=", "SERIAL=1", "CN=[x"} {
+		_, err := parseCertMatches([]string{entry})
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	writers, err := parseCertMatches([]string{"OU=ops", "URI=spiffe://example.com/admin/*"})
+	require.NoError(t, err)
+	c := &clientCertAuth{writers: writers}
+
+	reader := &x509.Certificate{Subject: pkix.Name{CommonName: "web01", OrganizationalUnit: []string{"web"}}, NotAfter: time.Now().Add(time.Hour)}
+	ti := c.tokenInfo(reader)
+	assert.Equal(t, []string{"mcp:read"}, ti.Scopes)
+	assert.Equal(t, "web01", ti.UserID)
+	assert.Empty(t, ti.Extra["roles"])
+
+	admin, _ := url.Parse("spiffe://example.com/admin/alice")
+	writer := &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{"dev"}}, URIs: []*url.URL{admin}}
+	ti = c.tokenInfo(writer)
+	assert.Equal(t, []string{"mcp:read", "mcp:write"}, ti.Scopes)
+	assert.Equal(t, []string{"mcp-admin"}, ti.Extra["roles"])
+	assert.Equal(t, "OU=dev", ti.UserID)
+
+	var granted *auth.TokenInfo
+	handler := c.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		granted = auth.TokenInfoFromContext(r.Context())
+	}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	call := func(cert *x509.Certificate) int {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, call(reader))
+	require.NotNil(t, granted)
+	assert.Equal(t, "web01", granted.UserID)
+	// requests without a verified certificate get the fallback
+	assert.Equal(t, http.StatusUnauthorized, call(nil))
+}
+
+func TestNewClientCertAuth(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := writeCert(t, dir, "ca")
+	c, err := newClientCertAuth(certFile, []string{"CN=admin"})
+	require.NoError(t, err)
+	config := &tls.Config{}
+	c.configure(config, true)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	c.configure(config, false)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, nil, 0o644))
+	_, err = newClientCertAuth(empty, nil)
+	assert.Error(t, err)
+	_, err = newClientCertAuth(certFile, []string{"bogus"})
+	assert.Error(t, err)
+}
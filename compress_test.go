@@ -0,0 +1,119 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	assert.Equal(t, "gzip", acceptedEncoding("gzip, deflate, br"))
+	assert.Equal(t, "deflate", acceptedEncoding("deflate, gzip;q=0.5"))
+	assert.Equal(t, "gzip", acceptedEncoding("*"))
+	assert.Equal(t, "", acceptedEncoding("gzip;q=0, br"))
+	assert.Equal(t, "", acceptedEncoding(""))
+	assert.Equal(t, "", acceptedEncoding("identity"))
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"message":"Started sshd.service."}`, 100)
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/small" {
+			w.Write([]byte(`{"id":1}`))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, large)
+	})
+	handler := compressMiddleware(true)(inner)
+	request := func(path, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		rec := request("/mcp", "gzip")
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+		assert.Less(t, rec.Body.Len(), len(large))
+		r, err := gzip.NewReader(rec.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, large, string(body))
+	})
+
+	t.Run("deflate", func(t *testing.T) {
+		rec := request("/mcp", "deflate")
+		assert.Equal(t, "deflate", rec.Header().Get("Content-Encoding"))
+		r, err := zlib.NewReader(rec.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, large, string(body))
+	})
+
+	t.Run("small body isn't compressed", func(t *testing.T) {
+		rec := request("/small", "gzip")
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, `{"id":1}`, rec.Body.String())
+	})
+
+	t.Run("client without compression", func(t *testing.T) {
+		rec := request("/mcp", "")
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, large, rec.Body.String())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		handler = compressMiddleware(false)(inner)
+		rec := request("/mcp", "gzip")
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, large, rec.Body.String())
+	})
+}
+
+func TestCompressMiddlewareStream(t *testing.T) {
+	events := make(chan string)
+	handler := compressMiddleware(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		http.NewResponseController(w).Flush()
+		for event := range events {
+			io.WriteString(w, event)
+			http.NewResponseController(w).Flush()
+		}
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	r, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	// every event arrives before the stream ends
+	for _, event := range []string{"data: 1\n\n", "data: 2\n\n"} {
+		events <- event
+		buf := make([]byte, len(event))
+		_, err := io.ReadFull(r, buf)
+		require.NoError(t, err)
+		assert.Equal(t, event, string(buf))
+	}
+	close(events)
+}
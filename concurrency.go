@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sessionid"
+)
+
+const (
+	defaultMaxCalls           = 16
+	defaultMaxCallsPerSession = 4
+)
+
+// callLimiter limits the tool calls running at once in total and per
+// session. Calls above a limit wait in the queue of their session, and a
+// freed slot goes to the sessions in turn, so that a client with a burst
+// of parallel calls can't exhaust the journal handles and dbus or starve
+// the other sessions.
+type callLimiter struct {
+	global     int
+	perSession int
+
+	mu       sync.Mutex
+	running  int
+	sessions map[string]*sessionCalls
+	// the sessions with waiting calls in the order they get a slot
+	turns []string
+}
+
+type sessionCalls struct {
+	running int
+	waiting []chan struct{}
+}
+
+// newCallLimiter returns nil if both limits are zero, which disables the
+// limits. A zero limit disables only this limit.
+func newCallLimiter(global, perSession int) *callLimiter {
+	if global <= 0 && perSession <= 0 {
+		return nil
+	}
+	return &callLimiter{global: global, perSession: perSession, sessions: make(map[string]*sessionCalls)}
+}
+
+// free reports whether a call of s may start, mu must be held
+func (l *callLimiter) free(s *sessionCalls) bool {
+	return (l.global <= 0 || l.running < l.global) && (l.perSession <= 0 || s.running < l.perSession)
+}
+
+// acquire waits until the call of the session may run. The returned
+// function ends the call and has to be called once it returned.
+func (l *callLimiter) acquire(ctx context.Context, session string) (func(), error) {
+	l.mu.Lock()
+	s, ok := l.sessions[session]
+	if !ok {
+		s = &sessionCalls{}
+		l.sessions[session] = s
+	}
+	release := func() { l.release(session) }
+	if len(s.waiting) == 0 && l.free(s) {
+		l.running++
+		s.running++
+		l.mu.Unlock()
+		return release, nil
+	}
+	ready := make(chan struct{})
+	s.waiting = append(s.waiting, ready)
+	if len(s.waiting) == 1 {
+		l.turns = append(l.turns, session)
+	}
+	queued := len(s.waiting)
+	l.mu.Unlock()
+	slog.DebugContext(ctx, "tool call queued", "session", session, "queued", queued)
+
+	select {
+	case <-ready:
+		return release, nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	select {
+	case <-ready:
+		// the slot was given at the same time
+		l.mu.Unlock()
+		l.release(session)
+		return nil, ctx.Err()
+	default:
+	}
+	for i, w := range s.waiting {
+		if w == ready {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			break
+		}
+	}
+	l.cleanup(session, s)
+	l.mu.Unlock()
+	return nil, ctx.Err()
+}
+
+// release ends a call of the session and starts the waiting calls which
+// fit now
+func (l *callLimiter) release(session string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	s := l.sessions[session]
+	s.running--
+	l.cleanup(session, s)
+	l.dispatch()
+}
+
+// cleanup forgets an idle session and removes a session without waiting
+// calls from the turns, mu must be held
+func (l *callLimiter) cleanup(session string, s *sessionCalls) {
+	if len(s.waiting) == 0 {
+		for i, turn := range l.turns {
+			if turn == session {
+				l.turns = append(l.turns[:i], l.turns[i+1:]...)
+				break
+			}
+		}
+		if s.running == 0 {
+			delete(l.sessions, session)
+		}
+	}
+}
+
+// dispatch starts the first waiting call of the sessions in turn while
+// there are free slots, a session which got one moves to the end of the
+// turns. mu must be held.
+func (l *callLimiter) dispatch() {
+	for i := 0; i < len(l.turns); {
+		if l.global > 0 && l.running >= l.global {
+			return
+		}
+		session := l.turns[i]
+		s := l.sessions[session]
+		if !l.free(s) {
+			i++
+			continue
+		}
+		ready := s.waiting[0]
+		s.waiting = s.waiting[1:]
+		l.running++
+		s.running++
+		close(ready)
+		l.turns = append(l.turns[:i], l.turns[i+1:]...)
+		if len(s.waiting) > 0 {
+			l.turns = append(l.turns, session)
+		}
+		// the sessions after i moved up, they are checked next
+	}
+}
+
+// Middleware runs the tool calls within the limits
+func (l *callLimiter) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	if l == nil {
+		return next
+	}
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method != "tools/call" {
+			return next(ctx, method, req)
+		}
+		release, err := l.acquire(ctx, sessionid.FromRequest(req))
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return next(ctx, method, req)
+	}
+}
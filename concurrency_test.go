@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type startedCall struct {
+	name    string
+	release func()
+}
+
+// queue starts a call of the session which waits for a slot, it's sent to
+// started once it got one
+func queue(t *testing.T, l *callLimiter, session, name string, started chan<- startedCall) {
+	t.Helper()
+	l.mu.Lock()
+	waiting := 0
+	if s, ok := l.sessions[session]; ok {
+		waiting = len(s.waiting)
+	}
+	l.mu.Unlock()
+	go func() {
+		if release, err := l.acquire(context.Background(), session); err == nil {
+			started <- startedCall{name, release}
+		}
+	}()
+	// wait until the call is queued, so that the order is fixed
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		s, ok := l.sessions[session]
+		return ok && len(s.waiting) > waiting
+	}, time.Second, time.Millisecond)
+}
+
+func TestCallLimiterFairness(t *testing.T) {
+	assert.Nil(t, newCallLimiter(0, 0))
+	l := newCallLimiter(1, 0)
+	release, err := l.acquire(context.Background(), "a")
+	require.NoError(t, err)
+
+	started := make(chan startedCall, 3)
+	queue(t, l, "a", "a2", started)
+	queue(t, l, "a", "a3", started)
+	queue(t, l, "b", "b1", started)
+
+	// the freed slots go to the sessions in turn
+	for _, want := range []string{"a2", "b1", "a3"} {
+		release()
+		call := <-started
+		assert.Equal(t, want, call.name)
+		release = call.release
+	}
+	release()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	assert.Zero(t, l.running)
+	assert.Empty(t, l.sessions)
+	assert.Empty(t, l.turns)
+}
+
+func TestCallLimiterPerSession(t *testing.T) {
+	l := newCallLimiter(0, 1)
+	releaseA, err := l.acquire(context.Background(), "a")
+	require.NoError(t, err)
+
+	// a waits for its own call, b isn't held up by it
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, "a")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	releaseB, err := l.acquire(context.Background(), "b")
+	require.NoError(t, err)
+	releaseB()
+	releaseA()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	assert.Empty(t, l.sessions, "the cancelled call left the queue")
+	assert.Empty(t, l.turns)
+}
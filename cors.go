@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsHeaders are the request headers of the MCP clients, which browsers
+// may always send
+var corsHeaders = []string{"Authorization", "Content-Type", "Mcp-Session-Id", "Mcp-Protocol-Version", "Last-Event-ID"}
+
+// corsPolicy is the origin policy of the HTTP endpoints
+type corsPolicy struct {
+	// Origins is the allowlist of browser origins, "*" allows all and
+	// "https://*.example.com" the subdomains of example.com
+	Origins []string
+	// Headers are further request headers browsers may send
+	Headers []string
+	// MaxAge is how long browsers may cache a preflight, 0 leaves it to
+	// the browser
+	MaxAge time.Duration
+	// Credentials allows browsers to send cookies and client certificates,
+	// only the exactly listed origins are allowed then
+	Credentials bool
+}
+
+// validate refuses credentials together with the wildcard origin, which
+// would let every website make authenticated calls
+func (p corsPolicy) validate() error {
+	if p.Credentials && slices.Contains(p.Origins, "*") {
+		return fmt.Errorf("--cors-allow-credentials requires an explicit list of --allowed-origins instead of '*'")
+	}
+	return nil
+}
+
+// allowed returns whether the origin is in the allowlist. With credentials
+// the wildcards are ignored.
+func (p corsPolicy) allowed(origin string) bool {
+	return slices.ContainsFunc(p.Origins, func(o string) bool {
+		o = strings.ToLower(strings.TrimSuffix(o, "/"))
+		if o == strings.ToLower(origin) {
+			return true
+		}
+		if !strings.Contains(o, "*") || p.Credentials {
+			return false
+		}
+		if o == "*" {
+			return true
+		}
+		// the scheme has to match, the wildcard only covers host labels
+		matched, _ := path.Match(strings.ReplaceAll(o, ".", "/"), strings.ReplaceAll(strings.ToLower(origin), ".", "/"))
+		return matched
+	})
+}
+
+// corsMiddleware applies the origin policy to all endpoints. Requests
+// without an Origin header don't come from a browser and are passed. A
+// browser request from an origin which isn't in the allowlist is rejected,
+// which also protects against DNS rebinding.
+func corsMiddleware(policy corsPolicy) func(http.Handler) http.Handler {
+	wildcard := slices.Contains(policy.Origins, "*")
+	allowHeaders := strings.Join(append(slices.Clone(corsHeaders), policy.Headers...), ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !policy.allowed(origin) {
+				slog.Debug("rejected request from origin", "origin", origin, "remote_addr", r.RemoteAddr)
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			if wildcard && !policy.Credentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			}
+			if policy.Credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Expose-Headers", "Mcp-Session-Id, WWW-Authenticate")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				if policy.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
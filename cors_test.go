@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorsMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name       string
+		allowed    []string
+		origin     string
+		method     string
+		wantCode   int
+		wantOrigin string
+	}{
+		{name: "no origin", allowed: []string{"https://app.example.com"}, method: "POST", wantCode: http.StatusOK},
+		{name: "allowed origin", allowed: []string{"https://app.example.com"}, origin: "https://app.example.com", method: "POST", wantCode: http.StatusOK, wantOrigin: "https://app.example.com"},
+		{name: "rejected origin", allowed: []string{"https://app.example.com"}, origin: "https://evil.example.com", method: "POST", wantCode: http.StatusForbidden},
+		{name: "wildcard", allowed: []string{"*"}, origin: "http://localhost:6274", method: "POST", wantCode: http.StatusOK, wantOrigin: "*"},
+		{name: "subdomain wildcard", allowed: []string{"https://*.example.com"}, origin: "https://app.example.com", method: "POST", wantCode: http.StatusOK, wantOrigin: "https://app.example.com"},
+		{name: "subdomain wildcard other scheme", allowed: []string{"https://*.example.com"}, origin: "http://app.example.com", method: "POST", wantCode: http.StatusForbidden},
+		{name: "subdomain wildcard nested", allowed: []string{"https://*.example.com"}, origin: "https://a.b.example.com", method: "POST", wantCode: http.StatusForbidden},
+		{name: "preflight", allowed: []string{"https://app.example.com"}, origin: "https://app.example.com", method: "OPTIONS", wantCode: http.StatusNoContent, wantOrigin: "https://app.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/mcp", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == "OPTIONS" {
+				r.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			w := httptest.NewRecorder()
+			corsMiddleware(corsPolicy{Origins: tt.allowed})(next).ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestCorsPolicy(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	policy := corsPolicy{Origins: []string{"https://app.example.com"}, Headers: []string{"X-Request-Id"}, MaxAge: 10 * time.Minute, Credentials: true}
+	r := httptest.NewRequest(http.MethodOptions, "/.well-known/oauth-protected-resource/mcp", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	corsMiddleware(policy)(next).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Mcp-Session-Id")
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "X-Request-Id")
+}
+
+func TestCorsCredentials(t *testing.T) {
+	assert.Error(t, corsPolicy{Origins: []string{"*"}, Credentials: true}.validate())
+	assert.NoError(t, corsPolicy{Origins: []string{"*"}}.validate())
+	assert.NoError(t, corsPolicy{Origins: []string{"https://app.example.com"}, Credentials: true}.validate())
+
+	// with credentials only the exactly listed origins are reflected
+	policy := corsPolicy{Origins: []string{"https://app.example.com", "https://*.example.org"}, Credentials: true}
+	assert.True(t, policy.allowed("https://app.example.com"))
+	assert.False(t, policy.allowed("https://app.example.org"))
+	policy.Credentials = false
+	assert.True(t, policy.allowed("https://app.example.org"))
+}
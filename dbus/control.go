@@ -0,0 +1,45 @@
+package dbus
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// ExportControl offers the method Deauthorize(session) at the path with the
+// name as interface and requests the name, so that an operator can drop
+// the authorization of a running session, e.g. with busctl. An empty
+// session drops all sessions, deauthorize returns how many were dropped.
+// Reload() reloads the configuration of the server like SIGHUP. Who may
+// call is restricted by the dbus policy of the bus.
+func ExportControl(conn *dbus.Conn, name, path string, deauthorize func(session string) (int, error), reload func() error) error {
+	methods := map[string]any{
+		"Deauthorize": func(sender dbus.Sender, session string) (uint32, *dbus.Error) {
+			slog.Warn("deauthorize called via dbus", "audit", "session_deauthorized", "sender", sender, "session", session)
+			n, err := deauthorize(session)
+			if err != nil {
+				return 0, dbus.MakeFailedError(err)
+			}
+			return uint32(n), nil
+		},
+		"Reload": func(sender dbus.Sender) *dbus.Error {
+			slog.Warn("reload called via dbus", "audit", "config_reload", "sender", sender)
+			if err := reload(); err != nil {
+				return dbus.MakeFailedError(err)
+			}
+			return nil
+		},
+	}
+	if err := conn.ExportMethodTable(methods, dbus.ObjectPath(path), name); err != nil {
+		return err
+	}
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return fmt.Errorf("couldn't request the name %s: %w", name, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("name %s is already owned", name)
+	}
+	return nil
+}
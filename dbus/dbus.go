@@ -15,12 +15,25 @@ import (
 	"github.com/godbus/dbus/v5"
 )
 
+// polkit actions of the operation classes, admins can grant each class
+// separately, e.g. restarting units without enabling them or writing files
+const (
+	ActionReadLog         = "com.suse.gatekeeper.readlog"
+	ActionManageUnits     = "com.suse.gatekeeper.manage-units"
+	ActionManageUnitFiles = "com.suse.gatekeeper.manage-unit-files"
+	ActionManageFiles     = "com.suse.gatekeeper.manage-files"
+	ActionPower           = "com.suse.gatekeeper.power"
+	ActionReloadDaemon    = "com.suse.gatekeeper.reload-daemon"
+	ActionPlugin          = "com.suse.gatekeeper.plugin"
+)
+
 type DbusAuth struct {
 	*dbus.Conn
 	sender   dbus.Sender // store the sender which authorized the last call
 	Timeout  uint32
 	DbusName string
 	DbusPath string
+	grants   *writeGrants
 }
 
 // Just register the sender for further call backs
@@ -65,7 +78,7 @@ func (a *DbusAuth) IsReadAuthorized(ctx context.Context) (bool, error) {
 
 	readPermission, _ := ctx.Value(PermissionKey).(string)
 	if readPermission == "" {
-		readPermission = "com.suse.gatekeeper.readlog"
+		readPermission = ActionReadLog
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(a.Timeout)*time.Second)
@@ -99,12 +112,22 @@ type contextKey string
 
 const PermissionKey contextKey = "systemdPermission"
 
+// DetailsKey holds the details of a write operation, like the unit it
+// changes, which polkit shows in its prompt
+const DetailsKey contextKey = "polkitDetails"
+
+// WithDetails adds the polkit action and the details of the operation to
+// the context of a write authorization
+func WithDetails(ctx context.Context, action string, details map[string]string) context.Context {
+	return context.WithValue(context.WithValue(ctx, PermissionKey, action), DetailsKey, details)
+}
+
 func (a *DbusAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
 	slog.Debug("checking write auth", "sender", a.sender)
 
 	systemdPermission, _ := ctx.Value(PermissionKey).(string)
 	if systemdPermission == "" {
-		systemdPermission = "org.freedesktop.systemd1.manage-units"
+		systemdPermission = ActionManageUnits
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(a.Timeout)*time.Second)
@@ -117,7 +140,8 @@ func (a *DbusAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
 		if os.Geteuid() == 0 {
 			state = true
 		} else {
-			state, err = CheckPolkitByPID(int32(os.Getpid()), systemdPermission)
+			details, _ := ctx.Value(DetailsKey).(map[string]string)
+			state, err = a.authorizeWrite(systemdPermission, details)
 		}
 	}
 	if err != nil {
@@ -132,6 +156,13 @@ func (a *DbusAuth) IsWriteAuthorized(ctx context.Context) (bool, error) {
 	}
 }
 
+func (a *DbusAuth) authorizeWrite(action string, details map[string]string) (bool, error) {
+	if a.grants == nil {
+		return checkPolkit(int32(os.Getpid()), action, details)
+	}
+	return a.grants.authorize(action, details)
+}
+
 // getProcessStartTime returns the start time of a process in clock ticks since system boot.
 func getProcessStartTime(pid int32) (uint64, int32, error) {
 	statPath := fmt.Sprintf("/proc/%d/stat", pid)
@@ -169,6 +200,12 @@ func getProcessStartTime(pid int32) (uint64, int32, error) {
 
 // CheckPolkitByPID checks if the given PID is authorized for the given actionID.
 func CheckPolkitByPID(pid int32, actionID string) (bool, error) {
+	return checkPolkit(pid, actionID, nil)
+}
+
+// checkPolkit checks the authorization with the details, which the
+// authentication agent shows to the user
+func checkPolkit(pid int32, actionID string, details map[string]string) (bool, error) {
 	conn, err := dbus.ConnectSystemBus()
 	if err != nil {
 		return false, fmt.Errorf("could not connect to system dbus: %w", err)
@@ -192,7 +229,9 @@ func CheckPolkitByPID(pid int32, actionID string) (bool, error) {
 		},
 	}
 
-	details := make(map[string]string)
+	if details == nil {
+		details = make(map[string]string)
+	}
 	flags := uint32(1) // AllowUserInteraction
 	cancellationID := ""
 	var result struct {
@@ -0,0 +1,164 @@
+package dbus
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// writeGrant is a write authorization of polkit, which is used for further
+// calls until it expires or all of its operations are used up
+type writeGrant struct {
+	expires time.Time
+	ops     int // remaining operations, 0 if they aren't limited
+}
+
+// writeGrants keeps the write grants by polkit action. Without a duration
+// and a number of operations every write call is checked by polkit.
+type writeGrants struct {
+	duration time.Duration
+	ops      int
+	// perOperation prompts for every write call, see PromptEachWrite
+	perOperation bool
+	now          func() time.Time
+	check        func(pid int32, actionID string, details map[string]string) (bool, error)
+	revoke       func() error
+
+	mu     sync.Mutex
+	grants map[string]*writeGrant
+}
+
+func (g *writeGrants) enabled() bool {
+	return g.duration > 0 || g.ops > 0
+}
+
+// use takes an operation of the grant for the action and returns false if
+// there is none or it was used up
+func (g *writeGrants) use(action string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	grant, ok := g.grants[action]
+	if !ok {
+		return false
+	}
+	if g.duration > 0 && !g.now().Before(grant.expires) {
+		delete(g.grants, action)
+		slog.Warn("write grant expired", "audit", "write_grant_expired", "action", action)
+		return false
+	}
+	if g.ops > 0 {
+		grant.ops--
+		if grant.ops <= 0 {
+			delete(g.grants, action)
+			slog.Warn("write grant used up", "audit", "write_grant_expired", "action", action, "ops", g.ops)
+		}
+	}
+	return true
+}
+
+// authorize uses the grant of the action or asks polkit for a new one.
+// Before polkit is asked again its temporary authorizations are revoked, so
+// that the user has to authenticate again instead of polkit answering from
+// its own cache. The details of the operation are shown in the prompt.
+func (g *writeGrants) authorize(action string, details map[string]string) (bool, error) {
+	if g.perOperation {
+		if err := g.revoke(); err != nil {
+			slog.Debug("couldn't revoke the temporary polkit authorizations", "error", err)
+		}
+		authorized, err := g.check(int32(os.Getpid()), action, details)
+		if err == nil {
+			slog.Warn("write operation answered by polkit", "audit", "write_prompted", "action", action, "details", details, "authorized", authorized)
+		}
+		return authorized, err
+	}
+	if !g.enabled() {
+		return g.check(int32(os.Getpid()), action, details)
+	}
+	if g.use(action) {
+		return true, nil
+	}
+	if err := g.revoke(); err != nil {
+		slog.Debug("couldn't revoke the temporary polkit authorizations", "error", err)
+	}
+	authorized, err := g.check(int32(os.Getpid()), action, details)
+	if !authorized || err != nil {
+		return authorized, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.grants == nil {
+		g.grants = make(map[string]*writeGrant)
+	}
+	// the call which created the grant is its first operation
+	if g.ops != 1 {
+		g.grants[action] = &writeGrant{expires: g.now().Add(g.duration), ops: g.ops - 1}
+	}
+	slog.Info("write granted by polkit", "action", action, "duration", g.duration, "ops", g.ops)
+	return true, nil
+}
+
+// revokeTemporaryAuthorizations revokes the authorizations polkit keeps for
+// the session of the server, e.g. for auth_admin_keep
+func revokeTemporaryAuthorizations() error {
+	sessionID, err := getSessionIdFromPid(uint32(os.Getpid()))
+	if err != nil {
+		return err
+	}
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return fmt.Errorf("could not connect to system dbus: %w", err)
+	}
+	defer conn.Close()
+	subject := struct {
+		A string
+		B map[string]dbus.Variant
+	}{
+		"unix-session",
+		map[string]dbus.Variant{
+			"session-id": dbus.MakeVariant(sessionID),
+		},
+	}
+	pkObj := conn.Object("org.freedesktop.PolicyKit1", "/org/freedesktop/PolicyKit1/Authority")
+	return pkObj.Call("org.freedesktop.PolicyKit1.Authority.RevokeTemporaryAuthorizations", 0, subject).Err
+}
+
+// LimitWriteGrants makes a write authorization of polkit last for the
+// duration or the number of operations, whichever ends first. Afterwards
+// the user is asked again.
+func (a *DbusAuth) LimitWriteGrants(duration time.Duration, ops int) {
+	a.grants = &writeGrants{
+		duration: duration,
+		ops:      ops,
+		now:      time.Now,
+		check:    checkPolkit,
+		revoke:   revokeTemporaryAuthorizations,
+	}
+}
+
+// PromptEachWrite makes every write call ask polkit on its own, with the
+// unit, file or user it changes as details of the prompt. Polkit doesn't
+// answer from its cache of auth_admin_keep, so the user approves every
+// change.
+func (a *DbusAuth) PromptEachWrite() {
+	a.grants = &writeGrants{
+		perOperation: true,
+		now:          time.Now,
+		check:        checkPolkit,
+		revoke:       revokeTemporaryAuthorizations,
+	}
+}
+
+// RevokeGrants drops the write grants and the temporary authorizations of
+// polkit, so that the next call has to be authorized again
+func (a *DbusAuth) RevokeGrants() error {
+	if a.grants != nil {
+		a.grants.mu.Lock()
+		clear(a.grants.grants)
+		a.grants.mu.Unlock()
+	}
+	return revokeTemporaryAuthorizations()
+}
@@ -0,0 +1,94 @@
+package dbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGrants(duration time.Duration, ops int) (*writeGrants, *int, *int, *time.Time) {
+	checks, revokes := 0, 0
+	now := time.Now()
+	return &writeGrants{
+		duration: duration,
+		ops:      ops,
+		now:      func() time.Time { return now },
+		check: func(pid int32, actionID string, details map[string]string) (bool, error) {
+			checks++
+			return true, nil
+		},
+		revoke: func() error {
+			revokes++
+			return nil
+		},
+	}, &checks, &revokes, &now
+}
+
+func TestWriteGrantDuration(t *testing.T) {
+	g, checks, revokes, now := newTestGrants(time.Minute, 0)
+	for range 3 {
+		allowed, err := g.authorize(ActionManageUnits, nil)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	assert.Equal(t, 1, *checks)
+	assert.Equal(t, 1, *revokes)
+
+	// every action has its own grant
+	g.authorize(ActionManageUnitFiles, nil)
+	assert.Equal(t, 2, *checks)
+
+	*now = now.Add(time.Minute)
+	g.authorize(ActionManageUnits, nil)
+	assert.Equal(t, 3, *checks)
+	assert.Equal(t, 3, *revokes)
+}
+
+func TestWriteGrantOps(t *testing.T) {
+	g, checks, _, _ := newTestGrants(time.Hour, 2)
+	for range 5 {
+		g.authorize(ActionManageUnits, nil)
+	}
+	// 1 and 2 by the first grant, 3 and 4 by the second one
+	assert.Equal(t, 3, *checks)
+
+	g, checks, revokes, _ := newTestGrants(0, 1)
+	g.authorize(ActionManageUnits, nil)
+	g.authorize(ActionManageUnits, nil)
+	assert.Equal(t, 2, *checks)
+	assert.Equal(t, 2, *revokes)
+}
+
+func TestWriteGrantDenied(t *testing.T) {
+	g, checks, _, _ := newTestGrants(time.Minute, 0)
+	g.check = func(pid int32, actionID string, details map[string]string) (bool, error) {
+		*checks++
+		return false, nil
+	}
+	allowed, err := g.authorize(ActionManageUnits, nil)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+	g.authorize(ActionManageUnits, nil)
+	assert.Equal(t, 2, *checks)
+}
+
+func TestWritePerOperation(t *testing.T) {
+	g, checks, revokes, _ := newTestGrants(0, 0)
+	g.perOperation = true
+	var prompted map[string]string
+	g.check = func(pid int32, actionID string, details map[string]string) (bool, error) {
+		*checks++
+		prompted = details
+		return true, nil
+	}
+	for _, unit := range []string{"web.service", "db.service", "web.service"} {
+		allowed, err := g.authorize(ActionManageUnits, map[string]string{"unit": unit})
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+		assert.Equal(t, unit, prompted["unit"])
+	}
+	// polkit is asked every time without its cache
+	assert.Equal(t, 3, *checks)
+	assert.Equal(t, 3, *revokes)
+}
@@ -0,0 +1,167 @@
+package dbus
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// translation is a localized text of a polkit action
+type translation struct {
+	lang        string
+	description string
+	message     string
+}
+
+// PolkitAction is the definition of a polkit action of the .policy file
+type PolkitAction struct {
+	ID            string
+	Description   string
+	Message       string
+	AllowAny      string
+	AllowInactive string
+	AllowActive   string
+	Annotations   [][2]string
+	translations  []translation
+}
+
+// PolkitActions are the actions checked by the server and the gatekeeper,
+// configs/com.suse.gatekeeper.policy is generated from them
+var PolkitActions = []PolkitAction{{
+	ID:            ActionReadLog,
+	Description:   "Read the system log via Gatekeeper",
+	Message:       "Authentication is required to read the system log.",
+	AllowAny:      "auth_admin",
+	AllowInactive: "auth_admin",
+	AllowActive:   "auth_admin",
+	Annotations:   [][2]string{{"org.freedesktop.policykit.owner", "unix-user:gatekeeper"}},
+	translations: []translation{
+		{"de", "Das Systemprotokoll über Gatekeeper lesen", "Zum Lesen des Systemprotokolls ist eine Authentifizierung erforderlich."},
+		{"es", "Leer el registro del sistema mediante Gatekeeper", "Se requiere autenticación para leer el registro del sistema."},
+		{"fr", "Lire le journal système via Gatekeeper", "Une authentification est requise pour lire le journal système."},
+	},
+}, {
+	ID:            ActionManageUnits,
+	Description:   "Start, stop, restart and reload units via systemd-mcp",
+	Message:       "Authentication is required to start, stop, restart or reload units.",
+	AllowAny:      "auth_admin",
+	AllowInactive: "auth_admin",
+	AllowActive:   "auth_admin_keep",
+	translations: []translation{
+		{"de", "Units über systemd-mcp starten, stoppen, neu starten und neu laden", "Zum Starten, Stoppen, Neustarten oder Neuladen von Units ist eine Authentifizierung erforderlich."},
+		{"es", "Iniciar, detener, reiniciar y recargar unidades mediante systemd-mcp", "Se requiere autenticación para iniciar, detener, reiniciar o recargar unidades."},
+		{"fr", "Démarrer, arrêter, redémarrer et recharger des unités via systemd-mcp", "Une authentification est requise pour démarrer, arrêter, redémarrer ou recharger des unités."},
+	},
+}, {
+	ID:            ActionManageUnitFiles,
+	Description:   "Enable and disable units via systemd-mcp",
+	Message:       "Authentication is required to enable or disable units.",
+	AllowAny:      "auth_admin",
+	AllowInactive: "auth_admin",
+	AllowActive:   "auth_admin_keep",
+	translations: []translation{
+		{"de", "Units über systemd-mcp aktivieren und deaktivieren", "Zum Aktivieren oder Deaktivieren von Units ist eine Authentifizierung erforderlich."},
+		{"es", "Habilitar y deshabilitar unidades mediante systemd-mcp", "Se requiere autenticación para habilitar o deshabilitar unidades."},
+		{"fr", "Activer et désactiver des unités via systemd-mcp", "Une authentification est requise pour activer ou désactiver des unités."},
+	},
+}, {
+	ID:            ActionManageFiles,
+	Description:   "Modify files via systemd-mcp",
+	Message:       "Authentication is required to modify files.",
+	AllowAny:      "auth_admin",
+	AllowInactive: "auth_admin",
+	AllowActive:   "auth_admin_keep",
+	translations: []translation{
+		{"de", "Dateien über systemd-mcp ändern", "Zum Ändern von Dateien ist eine Authentifizierung erforderlich."},
+		{"es", "Modificar archivos mediante systemd-mcp", "Se requiere autenticación para modificar archivos."},
+		{"fr", "Modifier des fichiers via systemd-mcp", "Une authentification est requise pour modifier des fichiers."},
+	},
+}, {
+	ID:            ActionPower,
+	Description:   "Reboot and power off the system via systemd-mcp",
+	Message:       "Authentication is required to reboot or power off the system.",
+	AllowAny:      "auth_admin",
+	AllowInactive: "auth_admin",
+	AllowActive:   "auth_admin_keep",
+	translations: []translation{
+		{"de", "Das System über systemd-mcp neu starten und ausschalten", "Zum Neustarten oder Ausschalten des Systems ist eine Authentifizierung erforderlich."},
+		{"es", "Reiniciar y apagar el sistema mediante systemd-mcp", "Se requiere autenticación para reiniciar o apagar el sistema."},
+		{"fr", "Redémarrer et éteindre le système via systemd-mcp", "Une authentification est requise pour redémarrer ou éteindre le système."},
+	},
+}, {
+	ID:            ActionReloadDaemon,
+	Description:   "Reload the systemd manager via systemd-mcp",
+	Message:       "Authentication is required to reload the systemd manager and change its configuration.",
+	AllowAny:      "auth_admin",
+	AllowInactive: "auth_admin",
+	AllowActive:   "auth_admin_keep",
+	translations: []translation{
+		{"de", "Den systemd-Manager über systemd-mcp neu laden", "Zum Neuladen des systemd-Managers und Ändern seiner Konfiguration ist eine Authentifizierung erforderlich."},
+		{"es", "Recargar el gestor de systemd mediante systemd-mcp", "Se requiere autenticación para recargar el gestor de systemd y cambiar su configuración."},
+		{"fr", "Recharger le gestionnaire systemd via systemd-mcp", "Une authentification est requise pour recharger le gestionnaire systemd et modifier sa configuration."},
+	},
+}, {
+	ID:            ActionPlugin,
+	Description:   "Run changing tools of plugins via systemd-mcp",
+	Message:       "Authentication is required to run a tool of a plugin which changes the system.",
+	AllowAny:      "auth_admin",
+	AllowInactive: "auth_admin",
+	AllowActive:   "auth_admin_keep",
+	translations: []translation{
+		{"de", "Ändernde Werkzeuge von Plugins über systemd-mcp ausführen", "Zum Ausführen eines Werkzeugs eines Plugins, das das System ändert, ist eine Authentifizierung erforderlich."},
+		{"es", "Ejecutar herramientas de plugins que modifican el sistema mediante systemd-mcp", "Se requiere autenticación para ejecutar una herramienta de un plugin que modifica el sistema."},
+		{"fr", "Exécuter des outils de plugins qui modifient le système via systemd-mcp", "Une authentification est requise pour exécuter un outil d'un plugin qui modifie le système."},
+	},
+}}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WritePolkitPolicy writes the .policy file of the actions. The messages
+// replace the prompt of their action in all languages, as the translations
+// wouldn't match them any more.
+func WritePolkitPolicy(w io.Writer, messages map[string]string) error {
+	for id := range messages {
+		if !slices.ContainsFunc(PolkitActions, func(a PolkitAction) bool { return a.ID == id }) {
+			return fmt.Errorf("unknown polkit action %s", id)
+		}
+	}
+	b := bufio.NewWriter(w)
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE policyconfig PUBLIC
+ "-//freedesktop//DTD PolicyKit Policy Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/PolicyKit/1/policyconfig.dtd">
+<policyconfig>
+  <vendor>Gatekeeper Service</vendor>
+  <vendor_url>http://suse.com/</vendor_url>
+`)
+	for _, a := range PolkitActions {
+		fmt.Fprintf(b, "\n  <action id=%q>\n", a.ID)
+		fmt.Fprintf(b, "    <description>%s</description>\n", escapeXML(a.Description))
+		for _, t := range a.translations {
+			fmt.Fprintf(b, "    <description xml:lang=%q>%s</description>\n", t.lang, escapeXML(t.description))
+		}
+		if message, ok := messages[a.ID]; ok {
+			fmt.Fprintf(b, "    <message>%s</message>\n", escapeXML(message))
+		} else {
+			fmt.Fprintf(b, "    <message>%s</message>\n", escapeXML(a.Message))
+			for _, t := range a.translations {
+				fmt.Fprintf(b, "    <message xml:lang=%q>%s</message>\n", t.lang, escapeXML(t.message))
+			}
+		}
+		fmt.Fprintf(b, "    <defaults>\n      <allow_any>%s</allow_any>\n      <allow_inactive>%s</allow_inactive>\n      <allow_active>%s</allow_active>\n    </defaults>\n",
+			a.AllowAny, a.AllowInactive, a.AllowActive)
+		for _, annotation := range a.Annotations {
+			fmt.Fprintf(b, "    <annotate key=%q>%s</annotate>\n", annotation[0], escapeXML(annotation[1]))
+		}
+		b.WriteString("  </action>\n")
+	}
+	b.WriteString("</policyconfig>\n")
+	return b.Flush()
+}
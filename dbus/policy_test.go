@@ -0,0 +1,63 @@
+package dbus
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+)
+
+// the shipped policy file has to be the generated one
+func TestPolkitPolicyShipped(t *testing.T) {
+	var generated bytes.Buffer
+	if err := WritePolkitPolicy(&generated, nil); err != nil {
+		t.Fatal(err)
+	}
+	shipped, err := os.ReadFile("../configs/com.suse.gatekeeper.policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated.String() != string(shipped) {
+		t.Error("configs/com.suse.gatekeeper.policy is outdated, regenerate it with --print-polkit-policy")
+	}
+}
+
+func TestWritePolkitPolicy(t *testing.T) {
+	var out bytes.Buffer
+	err := WritePolkitPolicy(&out, map[string]string{ActionManageFiles: "Allow the agent to <patch> files?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var policy struct {
+		Actions []struct {
+			ID       string `xml:"id,attr"`
+			Messages []struct {
+				Lang string `xml:"lang,attr"`
+				Text string `xml:",chardata"`
+			} `xml:"message"`
+		} `xml:"action"`
+	}
+	if err := xml.Unmarshal(out.Bytes(), &policy); err != nil {
+		t.Fatalf("invalid policy: %v", err)
+	}
+	if len(policy.Actions) != len(PolkitActions) {
+		t.Fatalf("expected %d actions, got %d", len(PolkitActions), len(policy.Actions))
+	}
+	for _, action := range policy.Actions {
+		switch action.ID {
+		case ActionManageFiles:
+			if len(action.Messages) != 1 || action.Messages[0].Text != "Allow the agent to <patch> files?" {
+				t.Errorf("expected only the custom message, got %+v", action.Messages)
+			}
+		case ActionManageUnits:
+			if len(action.Messages) < 2 || action.Messages[1].Lang != "de" || !strings.Contains(action.Messages[1].Text, "Authentifizierung") {
+				t.Errorf("expected the translated messages, got %+v", action.Messages)
+			}
+		}
+	}
+
+	if err := WritePolkitPolicy(&out, map[string]string{"com.example.unknown": "?"}); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/requestid"
+)
+
+// activeCall is a tool call which didn't return yet
+type activeCall struct {
+	RequestID string    `json:"request_id"`
+	Session   string    `json:"session,omitempty"`
+	Tool      string    `json:"tool"`
+	Started   time.Time `json:"started"`
+	Running   string    `json:"running"`
+}
+
+// activeCalls tracks the tool calls in flight for the debug listener
+type activeCalls struct {
+	mu    sync.Mutex
+	calls map[*activeCall]struct{}
+}
+
+func newActiveCalls() *activeCalls {
+	return &activeCalls{calls: make(map[*activeCall]struct{})}
+}
+
+// Middleware records the tool calls while they run, it has to run within
+// requestid.Middleware to know the id of a call
+func (a *activeCalls) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if method != "tools/call" || !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		c := &activeCall{RequestID: requestid.FromContext(ctx), Tool: call.Params.Name, Started: time.Now()}
+		if call.Session != nil {
+			c.Session = call.Session.ID()
+		}
+		a.mu.Lock()
+		a.calls[c] = struct{}{}
+		a.mu.Unlock()
+		defer func() {
+			a.mu.Lock()
+			delete(a.calls, c)
+			a.mu.Unlock()
+		}()
+		return next(ctx, method, req)
+	}
+}
+
+// list returns the calls in flight, the longest running first
+func (a *activeCalls) list() []activeCall {
+	a.mu.Lock()
+	calls := make([]activeCall, 0, len(a.calls))
+	for c := range a.calls {
+		calls = append(calls, *c)
+	}
+	a.mu.Unlock()
+	slices.SortFunc(calls, func(x, y activeCall) int { return x.Started.Compare(y.Started) })
+	for i := range calls {
+		calls[i].Running = time.Since(calls[i].Started).Round(time.Millisecond).String()
+	}
+	return calls
+}
+
+type debugSession struct {
+	ID     string       `json:"id"`
+	Client string       `json:"client,omitempty"`
+	Cost   cost.Summary `json:"cost"`
+	Calls  []activeCall `json:"calls"`
+}
+
+type debugStats struct {
+	Version      string `json:"version,omitempty"`
+	Uptime       string `json:"uptime"`
+	GoVersion    string `json:"go_version"`
+	Goroutines   int    `json:"goroutines"`
+	HeapAlloc    uint64 `json:"heap_alloc_bytes"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	Sys          uint64 `json:"sys_bytes"`
+	NumGC        uint32 `json:"gc_runs"`
+	PauseTotalNs uint64 `json:"gc_pause_total_ns"`
+	Sessions     int    `json:"sessions"`
+	ActiveCalls  int    `json:"active_calls"`
+}
+
+// debugHandler serves pprof below /debug/pprof/, the runtime stats at
+// /debug/stats, the sessions with their calls in flight at /debug/sessions
+// and all calls in flight at /debug/calls
+func debugHandler(server *mcp.Server, calls *activeCalls, costs *cost.Tracker, started time.Time) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		sessions := 0
+		for range server.Sessions() {
+			sessions++
+		}
+		writeDebugJSON(w, debugStats{
+			Version:      strings.TrimSpace(version),
+			Uptime:       time.Since(started).Round(time.Second).String(),
+			GoVersion:    runtime.Version(),
+			Goroutines:   runtime.NumGoroutine(),
+			HeapAlloc:    mem.HeapAlloc,
+			HeapObjects:  mem.HeapObjects,
+			Sys:          mem.Sys,
+			NumGC:        mem.NumGC,
+			PauseTotalNs: mem.PauseTotalNs,
+			Sessions:     sessions,
+			ActiveCalls:  len(calls.list()),
+		})
+	})
+	mux.HandleFunc("GET /debug/sessions", func(w http.ResponseWriter, r *http.Request) {
+		active := calls.list()
+		sessions := []debugSession{}
+		for ss := range server.Sessions() {
+			s := debugSession{ID: ss.ID(), Cost: costs.Session(ss.ID()), Calls: []activeCall{}}
+			if params := ss.InitializeParams(); params != nil && params.ClientInfo != nil {
+				s.Client = strings.TrimSpace(params.ClientInfo.Name + " " + params.ClientInfo.Version)
+			}
+			for _, c := range active {
+				if c.Session == s.ID {
+					s.Calls = append(s.Calls, c)
+				}
+			}
+			sessions = append(sessions, s)
+		}
+		writeDebugJSON(w, sessions)
+	})
+	mux.HandleFunc("GET /debug/calls", func(w http.ResponseWriter, r *http.Request) {
+		writeDebugJSON(w, calls.list())
+	})
+	return mux
+}
+
+func writeDebugJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Debug("couldn't write the debug response", "error", err)
+	}
+}
+
+// checkDebugAddress only accepts unix sockets and loopback addresses, as
+// the debug listener has no authentication
+func checkDebugAddress(addr string) (listenSpec, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if path == "" {
+			return listenSpec{}, fmt.Errorf("empty unix socket path in %q", addr)
+		}
+		return listenSpec{Network: "unix", Address: path}, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return listenSpec{}, fmt.Errorf("invalid debug address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return listenSpec{}, fmt.Errorf("debug address %q isn't a loopback address or unix socket, the debug listener has no authentication", addr)
+	}
+	return listenSpec{Network: "tcp", Address: addr}, nil
+}
+
+// serveDebug serves the debug handler on addr until the context is done
+func serveDebug(ctx context.Context, addr string, handler http.Handler) error {
+	spec, err := checkDebugAddress(addr)
+	if err != nil {
+		return err
+	}
+	ls, err := listen(spec)
+	if err != nil {
+		return fmt.Errorf("couldn't listen on %s: %w", spec, err)
+	}
+	if spec.Network == "unix" {
+		if err := os.Chmod(spec.Address, 0o600); err != nil {
+			ls[0].Close()
+			return err
+		}
+	}
+	s := &http.Server{Handler: handler, ReadHeaderTimeout: 3 * time.Second}
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+	slog.Warn("serving the debug listener, it exposes the sessions and profiles of the server", "address", spec.String())
+	go func() {
+		if err := s.Serve(ls[0]); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("debug listener failed", "error", err)
+		}
+	}()
+	return nil
+}
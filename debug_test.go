@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugHandler(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	calls := newActiveCalls()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := requestid.Middleware(calls.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		close(started)
+		<-release
+		return &mcp.CallToolResult{}, nil
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log"}})
+	}()
+	<-started
+
+	debug := debugHandler(server, calls, cost.NewTracker(), time.Now())
+	get := func(path string, v any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		debug.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		if v != nil {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+		}
+	}
+
+	var active []activeCall
+	get("/debug/calls", &active)
+	require.Len(t, active, 1)
+	assert.Equal(t, "list_log", active[0].Tool)
+	assert.NotEmpty(t, active[0].RequestID)
+
+	var stats debugStats
+	get("/debug/stats", &stats)
+	assert.Equal(t, 1, stats.ActiveCalls)
+	assert.Greater(t, stats.Goroutines, 0)
+
+	var sessions []debugSession
+	get("/debug/sessions", &sessions)
+	assert.Empty(t, sessions)
+	get("/debug/pprof/", nil)
+
+	close(release)
+	<-done
+	get("/debug/calls", &active)
+	assert.Empty(t, active)
+}
+
+func TestCheckDebugAddress(t *testing.T) {
+	for _, addr := range []string{"localhost:6060", "127.0.0.1:6060", "[::1]:6060", "unix:/run/debug.sock"} {
+		_, err := checkDebugAddress(addr)
+		assert.NoError(t, err, addr)
+	}
+	for _, addr := range []string{"0.0.0.0:6060", ":6060", "192.168.1.1:6060", "unix:", "localhost"} {
+		_, err := checkDebugAddress(addr)
+		assert.Error(t, err, addr)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/journal"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/remote"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+)
+
+const (
+	// name of the local machine in the host parameter
+	localHost = "local"
+	// host parameter which calls a read tool on every host of the fleet
+	allHosts = "all"
+)
+
+// fleetTools take the host parameter, fleetReadTools can be called on all
+// hosts at once
+var (
+	fleetTools     = []string{"list_loaded_units", "list_unit_files", "system_status", "change_unit_state", "check_restart_reload", "list_log"}
+	fleetReadTools = []string{"list_loaded_units", "list_unit_files", "system_status", "list_log"}
+)
+
+type listLogFunc func(ctx context.Context, req *mcp.CallToolRequest, params *journal.ListLogParams) (*mcp.CallToolResult, any, error)
+
+// fleetMember is a host of the fleet, the remote hosts are connected on
+// first use so that an unreachable host doesn't stop the server
+type fleetMember struct {
+	name    string
+	host    *remote.Host // nil for the local machine
+	auth    authkeeper.AuthKeeper
+	listLog listLogFunc
+
+	mu   sync.Mutex
+	conn *systemd.Connection
+}
+
+// systemd returns the connection to the service manager of the host
+func (m *fleetMember) systemd() (*systemd.Connection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn == nil {
+		if m.host == nil {
+			return nil, fmt.Errorf("the service manager of %s isn't connected", m.name)
+		}
+		conn, err := systemd.NewRemote(m.auth, m.host.DialBus)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't connect to %s: %w", m.name, err)
+		}
+		m.conn = conn
+	}
+	return m.conn, nil
+}
+
+func (m *fleetMember) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+}
+
+// fleet are the hosts the unit and log tools manage, the first one is used
+// if a call selects none
+type fleet struct {
+	members []*fleetMember
+}
+
+type fleetKey struct{}
+
+// parseFleet parses the hosts of --fleet, the default host is the one of
+// --host or the local machine
+func parseFleet(defaultHost *remote.Host, specs []string) ([]*remote.Host, error) {
+	seen := []string{localHost, allHosts}
+	if defaultHost != nil {
+		seen = append(seen, defaultHost.String())
+	}
+	var hosts []*remote.Host
+	for _, spec := range specs {
+		host, err := remote.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(seen, host.String()) {
+			return nil, fmt.Errorf("host %s of --fleet is given twice or reserved", host)
+		}
+		seen = append(seen, host.String())
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// newFleet returns the fleet of the default host and the other hosts. The
+// connection and the log of the default host are set once they are opened.
+func newFleet(defaultHost *remote.Host, others []*remote.Host, authorization authkeeper.AuthKeeper) *fleet {
+	first := &fleetMember{name: localHost, host: defaultHost, auth: authorization}
+	if defaultHost != nil {
+		first.name = defaultHost.String()
+	}
+	f := &fleet{members: []*fleetMember{first}}
+	for _, host := range others {
+		f.members = append(f.members, &fleetMember{
+			name:    host.String(),
+			host:    host,
+			auth:    authorization,
+			listLog: (&journal.RemoteLog{Auth: authorization, Host: host}).ListLog,
+		})
+	}
+	return f
+}
+
+func (f *fleet) names() []string {
+	names := make([]string, len(f.members))
+	for i, m := range f.members {
+		names[i] = m.name
+	}
+	return names
+}
+
+func (f *fleet) lookup(name string) *fleetMember {
+	for _, m := range f.members {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// member returns the host selected for the call
+func (f *fleet) member(ctx context.Context) *fleetMember {
+	if m, ok := ctx.Value(fleetKey{}).(*fleetMember); ok {
+		return m
+	}
+	return f.members[0]
+}
+
+func (f *fleet) close() {
+	for _, m := range f.members {
+		m.close()
+	}
+}
+
+// onHost calls a tool of the service manager of the host selected for the
+// call, with the connection of the session
+func onHost[P any](f *fleet, states *sessionStates, tool func(*systemd.Connection, context.Context, *mcp.CallToolRequest, P) (*mcp.CallToolResult, any, error)) mcp.ToolHandlerFor[P, any] {
+	return func(ctx context.Context, req *mcp.CallToolRequest, params P) (*mcp.CallToolResult, any, error) {
+		conn, err := f.member(ctx).systemd()
+		if err != nil {
+			return nil, nil, err
+		}
+		return tool(states.conn(callSession(req), conn), ctx, req, params)
+	}
+}
+
+// withHost returns a copy of the tool with the host parameter
+func (f *fleet) withHost(tool *mcp.Tool) *mcp.Tool {
+	schema, ok := tool.InputSchema.(*jsonschema.Schema)
+	if !ok || schema == nil || !slices.Contains(fleetTools, tool.Name) {
+		return tool
+	}
+	hosts := []any{}
+	for _, name := range f.names() {
+		hosts = append(hosts, name)
+	}
+	description := fmt.Sprintf("Host to call the tool on, default %s", f.members[0].name)
+	if slices.Contains(fleetReadTools, tool.Name) {
+		hosts = append(hosts, allHosts)
+		description += ". all calls it on every host and adds the host to every entry, e.g. to find the hosts with failed units"
+	}
+	s := *schema
+	s.Properties = maps.Clone(schema.Properties)
+	if s.Properties == nil {
+		s.Properties = make(map[string]*jsonschema.Schema)
+	}
+	s.Properties["host"] = &jsonschema.Schema{Type: "string", Enum: hosts, Description: description}
+	t := *tool
+	t.InputSchema = &s
+	return &t
+}
+
+// takeHost removes the host parameter from the arguments of the call
+func takeHost(params *mcp.CallToolParamsRaw) (string, error) {
+	var args map[string]json.RawMessage
+	if json.Unmarshal(params.Arguments, &args) != nil {
+		return "", nil
+	}
+	raw, ok := args["host"]
+	if !ok {
+		return "", nil
+	}
+	var host string
+	if err := json.Unmarshal(raw, &host); err != nil {
+		return "", fmt.Errorf("host must be a string")
+	}
+	delete(args, "host")
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	params.Arguments = data
+	return host, nil
+}
+
+// Middleware adds the host parameter to the fleet tools and runs their
+// calls on the selected host
+func (f *fleet) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		switch method {
+		case "tools/list":
+			res, err := next(ctx, method, req)
+			if list, ok := res.(*mcp.ListToolsResult); ok && err == nil {
+				tools := make([]*mcp.Tool, len(list.Tools))
+				for i, tool := range list.Tools {
+					tools[i] = f.withHost(tool)
+				}
+				list.Tools = tools
+			}
+			return res, err
+		case "tools/call":
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok || call.Params == nil || !slices.Contains(fleetTools, call.Params.Name) {
+				return next(ctx, method, req)
+			}
+			host, err := takeHost(call.Params)
+			if err != nil {
+				return nil, err
+			}
+			if host == "" {
+				return next(ctx, method, req)
+			}
+			if host == allHosts {
+				if !slices.Contains(fleetReadTools, call.Params.Name) {
+					return nil, fmt.Errorf("%s can only be called on a single host", call.Params.Name)
+				}
+				return f.callAll(ctx, method, req, next), nil
+			}
+			m := f.lookup(host)
+			if m == nil {
+				return nil, fmt.Errorf("unknown host %q, valid hosts are %s", host, strings.Join(f.names(), ", "))
+			}
+			return next(context.WithValue(ctx, fleetKey{}, m), method, req)
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// callAll calls a read tool on every host at once. Every object of the
+// results gets the name of its host, the hosts whose call failed are
+// listed with the error.
+func (f *fleet) callAll(ctx context.Context, method string, req mcp.Request, next mcp.MethodHandler) *mcp.CallToolResult {
+	results := make([]mcp.Result, len(f.members))
+	errs := make([]error, len(f.members))
+	var wg sync.WaitGroup
+	for i, m := range f.members {
+		wg.Go(func() {
+			results[i], errs[i] = next(context.WithValue(ctx, fleetKey{}, m), method, req)
+		})
+	}
+	wg.Wait()
+	merged := &mcp.CallToolResult{Content: []mcp.Content{}}
+	for i, m := range f.members {
+		res, _ := results[i].(*mcp.CallToolResult)
+		if errs[i] == nil && res != nil && res.IsError {
+			errs[i] = fmt.Errorf("%s", strings.Join(texts(res), "\n"))
+		}
+		if errs[i] != nil {
+			slog.DebugContext(ctx, "fleet call failed", "host", m.name, "error", errs[i])
+			data, _ := json.Marshal(map[string]string{"host": m.name, "error": errs[i].Error()})
+			merged.Content = append(merged.Content, &mcp.TextContent{Text: string(data)})
+			continue
+		}
+		if res == nil {
+			continue
+		}
+		for _, text := range texts(res) {
+			if tagged, ok := tagHost(m.name, text); ok {
+				merged.Content = append(merged.Content, &mcp.TextContent{Text: tagged})
+			}
+		}
+	}
+	if len(merged.Content) == 0 {
+		merged.Content = append(merged.Content, &mcp.TextContent{Text: "[]"})
+	}
+	return merged
+}
+
+func texts(res *mcp.CallToolResult) []string {
+	var texts []string
+	for _, content := range res.Content {
+		if text, ok := content.(*mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return texts
+}
+
+// tagHost adds the host to a JSON object of a result, other values are
+// wrapped in an object with the host. Empty lists are dropped.
+func tagHost(host, text string) (string, bool) {
+	name, _ := json.Marshal(host)
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &object); err == nil {
+		if _, ok := object["host"]; !ok {
+			// keeps the order of the fields of the tool
+			rest := strings.TrimPrefix(strings.TrimSpace(text), "{")
+			if strings.TrimSpace(rest) == "}" {
+				return `{"host":` + string(name) + `}`, true
+			}
+			return `{"host":` + string(name) + `,` + rest, true
+		}
+		object["host"] = name
+		data, _ := json.Marshal(object)
+		return string(data), true
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal([]byte(text), &list); err == nil && len(list) == 0 {
+		return "", false
+	}
+	result := json.RawMessage(text)
+	if !json.Valid(result) {
+		result, _ = json.Marshal(text)
+	}
+	data, _ := json.Marshal(map[string]json.RawMessage{"host": name, "result": result})
+	return string(data), true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFleet() *fleet {
+	return &fleet{members: []*fleetMember{{name: localHost}, {name: "node1"}, {name: "root@node2"}}}
+}
+
+// fleetEcho answers with the host of the call and its arguments
+func fleetEcho(f *fleet) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method == "tools/list" {
+			return &mcp.ListToolsResult{Tools: []*mcp.Tool{
+				{Name: "list_loaded_units", InputSchema: &jsonschema.Schema{Type: "object"}},
+				{Name: "change_unit_state", InputSchema: &jsonschema.Schema{Type: "object"}},
+				{Name: "get_man_page", InputSchema: &jsonschema.Schema{Type: "object"}},
+			}}, nil
+		}
+		name := f.member(ctx).name
+		if name == "root@node2" {
+			return nil, context.DeadlineExceeded
+		}
+		args := string(req.(*mcp.CallToolRequest).Params.Arguments)
+		if name == "node1" {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "[]"}}}, nil
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: `{"name":"a.service","args":` + args + `}`}}}, nil
+	}
+}
+
+func callFleet(t *testing.T, f *fleet, tool, args string) (*mcp.CallToolResult, error) {
+	t.Helper()
+	req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: tool, Arguments: json.RawMessage(args)}}
+	res, err := f.Middleware(fleetEcho(f))(context.Background(), "tools/call", req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*mcp.CallToolResult), nil
+}
+
+func TestFleetSchema(t *testing.T) {
+	f := testFleet()
+	res, err := f.Middleware(fleetEcho(f))(context.Background(), "tools/list", &mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	tools := res.(*mcp.ListToolsResult).Tools
+	assert.Equal(t, []any{"local", "node1", "root@node2", "all"}, tools[0].InputSchema.(*jsonschema.Schema).Properties["host"].Enum)
+	assert.Equal(t, []any{"local", "node1", "root@node2"}, tools[1].InputSchema.(*jsonschema.Schema).Properties["host"].Enum,
+		"writing tools can't be called on all hosts")
+	assert.Nil(t, tools[2].InputSchema.(*jsonschema.Schema).Properties)
+}
+
+func TestFleetHost(t *testing.T) {
+	f := testFleet()
+	res, err := callFleet(t, f, "list_loaded_units", `{"host":"local","state":"failed"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"a.service","args":{"state":"failed"}}`, res.Content[0].(*mcp.TextContent).Text,
+		"the host parameter is removed")
+
+	res, err = callFleet(t, f, "list_loaded_units", `{}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"a.service","args":{}}`, res.Content[0].(*mcp.TextContent).Text, "the first host is the default")
+
+	_, err = callFleet(t, f, "list_loaded_units", `{"host":"node3"}`)
+	assert.ErrorContains(t, err, "unknown host")
+	_, err = callFleet(t, f, "change_unit_state", `{"host":"all"}`)
+	assert.Error(t, err)
+}
+
+func TestFleetAll(t *testing.T) {
+	f := testFleet()
+	res, err := callFleet(t, f, "list_loaded_units", `{"host":"all","state":"failed"}`)
+	require.NoError(t, err)
+	var got []string
+	for _, content := range res.Content {
+		got = append(got, content.(*mcp.TextContent).Text)
+	}
+	assert.Equal(t, []string{
+		`{"host":"local","name":"a.service","args":{"state":"failed"}}`,
+		`{"error":"context deadline exceeded","host":"root@node2"}`,
+	}, got, "empty results are dropped and failed hosts are listed")
+}
+
+func TestTagHost(t *testing.T) {
+	tagged, ok := tagHost("node1", `{"host":"n1.example.com","state":"running"}`)
+	assert.True(t, ok)
+	assert.JSONEq(t, `{"host":"node1","state":"running"}`, tagged)
+	tagged, _ = tagHost("node1", `{}`)
+	assert.Equal(t, `{"host":"node1"}`, tagged)
+	tagged, _ = tagHost("node1", `not json`)
+	assert.Equal(t, `{"host":"node1","result":"not json"}`, tagged)
+	_, ok = tagHost("node1", `[]`)
+	assert.False(t, ok)
+}
+
+func TestParseFleet(t *testing.T) {
+	hosts, err := parseFleet(nil, []string{"node1", "root@node2:2222"})
+	require.NoError(t, err)
+	assert.Len(t, hosts, 2)
+	for _, specs := range [][]string{{"node1", "node1"}, {"local"}, {"all"}, {"-x"}} {
+		_, err := parseFleet(nil, specs)
+		assert.Error(t, err, specs)
+	}
+	_, err = parseFleet(&remote.Host{Name: "node1"}, []string{"node1"})
+	assert.Error(t, err, "the host of --host is already in the fleet")
+}
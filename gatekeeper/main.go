@@ -18,7 +18,7 @@ import (
 var (
 	sockAddr = "/run/gatekeeper/gatekeeper.socket"
 	target   = "/var/log/journal"
-	actionID = "com.suse.gatekeeper.readlog"
+	actionID = dbus.ActionReadLog
 )
 
 func main() {
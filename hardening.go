@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/spf13/pflag"
+)
+
+// unitName is the name of the generated service and socket
+const unitName = "systemd-mcp"
+
+// unitExcludedFlags aren't passed on to the generated service, as they
+// are replaced by the socket or make the server exit
+var unitExcludedFlags = []string{"http", "install-units", "hardening-report", "policy-report", "print-polkit-policy", "list-tools", "bench", "stdio"}
+
+// unitConfig are the settings of the generated units
+type unitConfig struct {
+	Exec string
+	// Args are the further arguments of the server
+	Args []string
+	// Secrets are the flags left out as the unit is world readable
+	Secrets []string
+	// Listen are the addresses of the socket and Options the options of
+	// its listeners, e.g. ";tls"
+	Listen   []string
+	Options  string
+	StateDir string
+}
+
+// listenOptions returns the options of a listener in the form of --http
+func listenOptions(spec listenSpec) string {
+	var opts string
+	if spec.Network != "unix" {
+		if spec.TLS {
+			opts += ";tls"
+		} else {
+			opts += ";notls"
+		}
+	}
+	if spec.NoAuth {
+		opts += ";noauth"
+	}
+	if spec.PeerCred {
+		opts += ";peercred"
+	}
+	return opts
+}
+
+// systemdQuote quotes a command line argument for ExecStart
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return strconv.Quote(arg)
+}
+
+// newUnitConfig takes the listeners of the socket from the specs and the
+// arguments of the service from the flags given on the command line
+func newUnitConfig(exec string, specs []listenSpec, flags *pflag.FlagSet, stateDir string) (*unitConfig, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("the units are for the http mode, give the addresses of the socket with --http")
+	}
+	cfg := &unitConfig{Exec: exec, StateDir: stateDir}
+	for i, spec := range specs {
+		if spec.Network == "systemd" {
+			return nil, fmt.Errorf("listener %s is already a socket of systemd", spec)
+		}
+		opts := listenOptions(spec)
+		if i > 0 && opts != cfg.Options {
+			return nil, fmt.Errorf("listeners %s and %s have different options and can't share a socket, generate the units of each of them", specs[0], spec)
+		}
+		cfg.Options = opts
+		cfg.Listen = append(cfg.Listen, spec.Address)
+	}
+	flags.Visit(func(f *pflag.Flag) {
+		if slices.Contains(unitExcludedFlags, f.Name) {
+			return
+		}
+		// the headers of the span export may authenticate at the collector
+		if strings.Contains(f.Name, "secret") || f.Name == "otlp-header" {
+			cfg.Secrets = append(cfg.Secrets, f.Name)
+			return
+		}
+		values := []string{f.Value.String()}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			values = slice.GetSlice()
+		}
+		for _, value := range values {
+			cfg.Args = append(cfg.Args, "--"+f.Name+"="+value)
+		}
+	})
+	return cfg, nil
+}
+
+// writeService writes the service with the sandboxing which the server
+// works with: a dynamic user without capabilities, which reads the journal
+// via its group and changes units via polkit
+func writeService(w io.Writer, cfg *unitConfig) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `[Unit]
+Description=systemd MCP server
+Documentation=https://github.com/openSUSE/systemd-mcp
+Requires=%[1]s.socket
+After=network.target %[1]s.socket
+
+[Service]
+Type=notify
+WatchdogSec=30s
+Restart=on-failure
+`, unitName)
+	args := []string{systemdQuote(cfg.Exec), systemdQuote("--http=systemd:" + unitName + cfg.Options)}
+	for _, arg := range cfg.Args {
+		args = append(args, systemdQuote(arg))
+	}
+	fmt.Fprintf(b, "ExecStart=%s\n", strings.Join(args, " "))
+	// reloads the config file without dropping the sessions
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	for _, name := range cfg.Secrets {
+		fmt.Fprintf(b, "# --%s was left out, set it in /etc/systemd-mcp/config.yaml\n", name)
+	}
+	b.WriteString(`# the write tools are authorized by polkit, grant the actions of
+# org.freedesktop.systemd1 to the user systemd-mcp with a polkit rule
+DynamicUser=yes
+User=` + unitName + `
+SupplementaryGroups=systemd-journal
+`)
+	if dir, ok := strings.CutPrefix(filepath.Clean(cfg.StateDir), "/var/lib/"); ok && cfg.StateDir != "" {
+		fmt.Fprintf(b, "StateDirectory=%s\nStateDirectoryMode=0700\n", dir)
+	} else if cfg.StateDir != "" {
+		fmt.Fprintf(b, "ReadWritePaths=%s\n", cfg.StateDir)
+	}
+	b.WriteString(`CapabilityBoundingSet=
+AmbientCapabilities=
+NoNewPrivileges=yes
+ProtectSystem=strict
+ProtectHome=read-only
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+ProtectHostname=yes
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+SystemCallFilter=@system-service
+SystemCallFilter=~@privileged @resources
+UMask=0077
+`)
+	return b.Flush()
+}
+
+// writeSocket writes the socket with the listeners of the server
+func writeSocket(w io.Writer, cfg *unitConfig) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("[Unit]\nDescription=systemd MCP server socket\n\n[Socket]\n")
+	unix := false
+	for _, address := range cfg.Listen {
+		fmt.Fprintf(b, "ListenStream=%s\n", address)
+		unix = unix || strings.HasPrefix(address, "/")
+	}
+	fmt.Fprintf(b, "FileDescriptorName=%s\n", unitName)
+	if unix {
+		b.WriteString("SocketMode=0660\n")
+	}
+	b.WriteString("\n[Install]\nWantedBy=sockets.target\n")
+	return b.Flush()
+}
+
+// installUnits writes the service and the socket to the directory, "-"
+// prints them
+func installUnits(dir string, cfg *unitConfig) error {
+	units := []struct {
+		name  string
+		write func(io.Writer, *unitConfig) error
+	}{{unitName + ".service", writeService}, {unitName + ".socket", writeSocket}}
+	for i, unit := range units {
+		if dir == "-" {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n", unit.name)
+			if err := unit.write(os.Stdout, cfg); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := os.OpenFile(filepath.Join(dir, unit.name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		err = unit.write(f, cfg)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println("installed", filepath.Join(dir, unit.name))
+	}
+	if dir != "-" {
+		fmt.Printf("run 'systemctl daemon-reload && systemctl enable --now %s.socket' to start it\n", unitName)
+	}
+	return nil
+}
+
+// procStatus is the sandboxing of a process as shown in /proc/PID/status
+type procStatus struct {
+	UID        int
+	CapEff     uint64
+	NoNewPrivs bool
+	Seccomp    bool
+}
+
+func parseProcStatus(r io.Reader) (procStatus, error) {
+	var st procStatus
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "Uid":
+			// real, effective, saved and filesystem uid
+			if len(fields) > 1 {
+				st.UID, _ = strconv.Atoi(fields[1])
+			}
+		case "CapEff":
+			st.CapEff, _ = strconv.ParseUint(fields[0], 16, 64)
+		case "NoNewPrivs":
+			st.NoNewPrivs = fields[0] == "1"
+		case "Seccomp":
+			st.Seccomp = fields[0] != "0"
+		}
+	}
+	return st, scanner.Err()
+}
+
+// hardeningConfig is the deployment evaluated by the hardening report
+type hardeningConfig struct {
+	Proc            procStatus
+	Systemd         bool // started by systemd
+	HTTP            bool
+	Specs           []listenSpec
+	NoAuth          bool
+	AllowWrite      bool
+	WriteFor        time.Duration
+	AllowPlainHTTP  bool
+	ExternalURL     string
+	AllowedNetworks []string
+	AllowedOrigins  []string
+	RateLimit       float64
+	SkipTLSVerify   bool
+	FileDefaultDeny bool
+	UnitDefaultDeny bool
+	RedactDefault   bool
+}
+
+// finding is a line of the hardening report, its status is ok, warn or
+// risk
+type finding struct {
+	Check  string
+	Status string
+	Detail string
+}
+
+func isLoopback(address string) bool {
+	host, _, _ := net.SplitHostPort(address)
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+// hardeningReport evaluates the privileges of the process and the exposure
+// of the configuration
+func hardeningReport(cfg *hardeningConfig) []finding {
+	var findings []finding
+	add := func(check string, failed bool, status, problem, detail string) {
+		if failed {
+			findings = append(findings, finding{check, status, problem})
+		} else {
+			findings = append(findings, finding{check, "ok", detail})
+		}
+	}
+	add("user", cfg.Proc.UID == 0, "warn", "runs as root, use the units of --install-units with a dynamic user", "uid "+strconv.Itoa(cfg.Proc.UID))
+	add("capabilities", cfg.Proc.CapEff != 0, "warn", fmt.Sprintf("effective capabilities %#x, the server needs none", cfg.Proc.CapEff), "none")
+	add("no new privileges", !cfg.Proc.NoNewPrivs, "warn", "the process may gain privileges via setuid binaries", "set")
+	add("seccomp", !cfg.Proc.Seccomp, "warn", "no system call filter", "filtered")
+	add("systemd", !cfg.Systemd, "warn", "not started by systemd, the sandboxing of the units isn't applied", "started by systemd, see 'systemd-analyze security "+unitName+".service'")
+	add("authorization", cfg.NoAuth, "risk", "disabled by --noauth, every client may call every tool", "enabled")
+	add("outbound tls", cfg.SkipTLSVerify, "risk", "certificates of the authorization servers aren't verified", "verified")
+	if cfg.AllowWrite {
+		add("write", cfg.WriteFor == 0, "warn", "--allow-write without time limit, set --allow-write-for", "allowed for "+cfg.WriteFor.String())
+	}
+	add("file deny list", !cfg.FileDefaultDeny, "warn", "shadow files and private keys can be read", "enabled")
+	add("unit deny list", !cfg.UnitDefaultDeny, "warn", "sshd, dbus and polkit can be changed", "enabled")
+	add("redaction", !cfg.RedactDefault, "warn", "secrets aren't redacted in the output", "enabled")
+	if !cfg.HTTP {
+		return findings
+	}
+	https := false
+	if u, err := url.Parse(cfg.ExternalURL); err == nil && u.Scheme == "https" {
+		https = true
+	}
+	exposed := false
+	for _, spec := range cfg.Specs {
+		check := "listener " + spec.String()
+		if spec.Network != "tcp" {
+			add(check, spec.NoAuth, "warn", "unauthenticated, restricted by the socket permissions", "restricted by the socket permissions")
+			continue
+		}
+		local := isLoopback(spec.Address)
+		exposed = exposed || !local
+		switch {
+		case spec.TLS:
+			findings = append(findings, finding{check, "ok", "tls"})
+		case local:
+			findings = append(findings, finding{check, "ok", "loopback only"})
+		case https:
+			findings = append(findings, finding{check, "ok", "plain http behind the tls proxy of --external-url"})
+		default:
+			status := "risk"
+			if cfg.AllowPlainHTTP {
+				status = "warn"
+			}
+			findings = append(findings, finding{check, status, "plain http reachable from other hosts"})
+		}
+	}
+	if exposed {
+		add("networks", len(cfg.AllowedNetworks) == 0, "warn", "every network may connect, restrict it with --allowed-networks", strings.Join(cfg.AllowedNetworks, ","))
+	}
+	add("origins", slices.Contains(cfg.AllowedOrigins, "*"), "warn", "every browser origin is allowed, set --allowed-origins", strings.Join(cfg.AllowedOrigins, ","))
+	add("rate limit", cfg.RateLimit <= 0, "warn", "disabled", strconv.FormatFloat(cfg.RateLimit, 'f', -1, 64)+" requests/s per source")
+	return findings
+}
+
+func printHardeningReport(cfg *hardeningConfig) {
+	tb := tabby.New()
+	tb.AddHeader("CHECK", "STATUS", "DETAIL")
+	for _, f := range hardeningReport(cfg) {
+		tb.AddLine(f.Check, f.Status, f.Detail)
+	}
+	tb.Print()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallUnits(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("http", "", "")
+	flags.String("controller", "", "")
+	flags.StringSlice("unit-allow", nil, "")
+	flags.String("introspection-client-secret", "", "")
+	flags.Bool("debug", false, "")
+	require.NoError(t, flags.Parse([]string{"--http=127.0.0.1:8666", "--controller=https://sso.example.com/realms/100%", "--unit-allow=web*,db.service", "--introspection-client-secret=s3cret"}))
+
+	specs, err := parseListenSpecs("127.0.0.1:8666,[::1]:8666", false)
+	require.NoError(t, err)
+	cfg, err := newUnitConfig("/usr/bin/systemd-mcp", specs, flags, "/var/lib/systemd-mcp")
+	require.NoError(t, err)
+	var service, socket bytes.Buffer
+	require.NoError(t, writeService(&service, cfg))
+	require.NoError(t, writeSocket(&socket, cfg))
+
+	assert.Contains(t, service.String(), "ExecStart=/usr/bin/systemd-mcp \"--http=systemd:systemd-mcp;notls\" --controller=https://sso.example.com/realms/100%% --unit-allow=web* --unit-allow=db.service\n")
+	assert.NotContains(t, service.String(), "s3cret")
+	assert.Contains(t, service.String(), "# --introspection-client-secret was left out")
+	assert.Contains(t, service.String(), "Type=notify\n")
+	assert.Contains(t, service.String(), "ExecReload=/bin/kill -HUP $MAINPID\n")
+	assert.Contains(t, service.String(), "DynamicUser=yes\n")
+	assert.Contains(t, service.String(), "StateDirectory=systemd-mcp\n")
+	assert.Contains(t, service.String(), "CapabilityBoundingSet=\n")
+	assert.Equal(t, "[Unit]\nDescription=systemd MCP server socket\n\n[Socket]\nListenStream=127.0.0.1:8666\nListenStream=[::1]:8666\nFileDescriptorName=systemd-mcp\n\n[Install]\nWantedBy=sockets.target\n", socket.String())
+
+	_, err = newUnitConfig("/usr/bin/systemd-mcp", nil, flags, "")
+	assert.Error(t, err)
+	specs, _ = parseListenSpecs("127.0.0.1:8666,unix:/run/systemd-mcp.sock;noauth", false)
+	_, err = newUnitConfig("/usr/bin/systemd-mcp", specs, flags, "")
+	assert.ErrorContains(t, err, "different options")
+}
+
+func TestParseProcStatus(t *testing.T) {
+	st, err := parseProcStatus(strings.NewReader("Name:\tsystemd-mcp\nUid:\t0\t61234\t61234\t61234\nCapEff:\t0000000000000004\nNoNewPrivs:\t1\nSeccomp:\t2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, procStatus{UID: 61234, CapEff: 4, NoNewPrivs: true, Seccomp: true}, st)
+}
+
+func TestHardeningReport(t *testing.T) {
+	status := func(findings []finding, check string) string {
+		for _, f := range findings {
+			if f.Check == check {
+				return f.Status
+			}
+		}
+		return ""
+	}
+	hardened := &hardeningConfig{
+		Proc:            procStatus{UID: 61234, NoNewPrivs: true, Seccomp: true},
+		Systemd:         true,
+		FileDefaultDeny: true,
+		UnitDefaultDeny: true,
+		RedactDefault:   true,
+	}
+	for _, f := range hardeningReport(hardened) {
+		assert.Equal(t, "ok", f.Status, f.Check)
+	}
+
+	specs, err := parseListenSpecs("[::]:8666,unix:/run/systemd-mcp-open.sock;noauth,unix:/run/systemd-mcp.sock;peercred", false)
+	require.NoError(t, err)
+	exposed := &hardeningConfig{
+		Proc:           procStatus{UID: 0, CapEff: 0x1ffffffffff},
+		HTTP:           true,
+		Specs:          specs,
+		AllowWrite:     true,
+		AllowedOrigins: []string{"*"},
+		RateLimit:      20,
+	}
+	findings := hardeningReport(exposed)
+	assert.Equal(t, "warn", status(findings, "user"))
+	assert.Equal(t, "warn", status(findings, "capabilities"))
+	assert.Equal(t, "warn", status(findings, "write"))
+	assert.Equal(t, "risk", status(findings, "listener [::]:8666"))
+	assert.Equal(t, "warn", status(findings, "listener unix:/run/systemd-mcp-open.sock"))
+	assert.Equal(t, "ok", status(findings, "listener unix:/run/systemd-mcp.sock"))
+	assert.Equal(t, "warn", status(findings, "networks"))
+	assert.Equal(t, "warn", status(findings, "origins"))
+	assert.Equal(t, "ok", status(findings, "rate limit"))
+
+	exposed.ExternalURL = "https://mcp.example.com"
+	exposed.AllowedNetworks = []string{"10.1.0.0/16"}
+	findings = hardeningReport(exposed)
+	assert.Equal(t, "ok", status(findings, "listener [::]:8666"))
+	assert.Equal(t, "ok", status(findings, "networks"))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/activation"
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/privsep"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func main() {
+	pflag.String("socket", privsep.DefaultSocket, "socket address to listen on")
+	pflag.StringSlice("allow-user", []string{"systemd-mcp"}, "users which may use the helper, root always may")
+	pflag.StringSlice("unit-allow", nil, "glob patterns of units which may be changed, defaults to all units which aren't denied")
+	pflag.StringSlice("unit-deny", nil, "glob patterns of units which may not be changed")
+	pflag.Bool("unit-default-deny", true, "deny changing sshd, dbus, polkit and the server itself")
+	pflag.Parse()
+	viper.SetEnvPrefix("SYSTEMD_MCP_HELPER")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+	viper.BindPFlags(pflag.CommandLine)
+
+	policy := &systemd.UnitPolicy{
+		Allow: viper.GetStringSlice("unit-allow"),
+		Deny:  viper.GetStringSlice("unit-deny"),
+	}
+	if viper.GetBool("unit-default-deny") {
+		policy.Deny = append(policy.Deny, systemd.DefaultDenyUnits()...)
+	}
+	allowUsers := viper.GetStringSlice("allow-user")
+
+	conn, err := dbus.NewSystemConnectionContext(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to connect to the service manager: %v", err)
+	}
+	defer conn.Close()
+
+	var l net.Listener
+	listeners, err := activation.Listeners()
+	if err == nil && len(listeners) > 0 {
+		if len(listeners) > 1 {
+			log.Fatalf("Too many listeners: %d", len(listeners))
+		}
+		l = listeners[0]
+		log.Println("Helper using systemd socket activation")
+	} else {
+		sockAddr := viper.GetString("socket")
+		if err := os.MkdirAll(filepath.Dir(sockAddr), 0755); err != nil {
+			log.Fatalf("Failed to create socket directory: %v", err)
+		}
+		if err := os.RemoveAll(sockAddr); err != nil {
+			log.Fatalf("Failed to remove old socket: %v", err)
+		}
+		l, err = net.Listen("unix", sockAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen: %v", err)
+		}
+		// who may connect is checked per connection
+		if err := os.Chmod(sockAddr, 0666); err != nil {
+			log.Fatalf("Failed to chmod socket: %v", err)
+		}
+		log.Println("Helper listening on", sockAddr)
+	}
+	defer l.Close()
+
+	server := &privsep.Server{
+		Manager: conn,
+		Check:   policy.Check,
+		// the users are looked up per connection, as the dynamic user of
+		// the server only exists while it runs
+		Allowed: func(uid, gid uint32) bool {
+			if uid == 0 {
+				return true
+			}
+			u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+			return err == nil && slices.Contains(allowUsers, u.Username)
+		},
+	}
+	if err := server.Serve(l); err != nil {
+		log.Fatalf("Failed to accept: %v", err)
+	}
+}
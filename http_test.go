@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListenSpecs(t *testing.T) {
+	specs, err := parseListenSpecs("127.0.0.1:8666, [::1]:8666;notls,unix:/run/systemd-mcp.sock;noauth", true)
+	require.NoError(t, err)
+	assert.Equal(t, []listenSpec{
+		{Network: "tcp", Address: "127.0.0.1:8666", TLS: true},
+		{Network: "tcp", Address: "[::1]:8666"},
+		{Network: "unix", Address: "/run/systemd-mcp.sock", NoAuth: true},
+	}, specs)
+
+	_, err = parseListenSpecs(":8666;tls", false)
+	assert.ErrorContains(t, err, "requires tls")
+	_, err = parseListenSpecs("::1:8666", false)
+	assert.ErrorContains(t, err, "invalid listen address")
+	_, err = parseListenSpecs(":8666;bogus", false)
+	assert.ErrorContains(t, err, "unknown listener option")
+	_, err = parseListenSpecs(" , ", false)
+	assert.Error(t, err)
+
+	specs, err = parseListenSpecs("unix:/run/systemd-mcp.sock;peercred", false)
+	require.NoError(t, err)
+	assert.Equal(t, []listenSpec{{Network: "unix", Address: "/run/systemd-mcp.sock", PeerCred: true}}, specs)
+	_, err = parseListenSpecs("127.0.0.1:8666;peercred", false)
+	assert.ErrorContains(t, err, "only unix sockets")
+	_, err = parseListenSpecs("unix:/run/systemd-mcp.sock;peercred;noauth", false)
+	assert.Error(t, err)
+	_, err = parseListenSpecs("[::]:8666;noauth", false)
+	assert.ErrorContains(t, err, "only unix sockets")
+
+	specs, err = parseListenSpecs("unix:/run/systemd-mcp.sock;noauth;mode=0660;group=wheel", false)
+	require.NoError(t, err)
+	assert.Equal(t, []listenSpec{{Network: "unix", Address: "/run/systemd-mcp.sock", NoAuth: true, Mode: 0660, Group: "wheel"}}, specs)
+	_, err = parseListenSpecs("unix:/run/systemd-mcp.sock;mode=999", false)
+	assert.ErrorContains(t, err, "invalid socket mode")
+	_, err = parseListenSpecs("systemd:systemd-mcp;mode=0660", false)
+	assert.ErrorContains(t, err, "only unix sockets created by the server")
+	_, err = parseListenSpecs("127.0.0.1:8666;group=wheel", false)
+	assert.Error(t, err)
+
+	specs, err = parseListenSpecs("systemd:systemd-mcp;peercred,systemd:", true)
+	require.NoError(t, err)
+	assert.Equal(t, []listenSpec{{Network: "systemd", Address: "systemd-mcp", TLS: true, PeerCred: true}, {Network: "systemd", TLS: true}}, specs)
+	assert.Equal(t, "systemd:systemd-mcp", specs[0].String())
+}
+
+func TestListenUnixMode(t *testing.T) {
+	dir := t.TempDir()
+	defer syscall.Umask(syscall.Umask(0022))
+
+	// the peer credentials decide, so every local user may connect
+	peercred := listenSpec{Network: "unix", Address: filepath.Join(dir, "peercred.sock"), PeerCred: true}
+	listeners, err := listen(peercred)
+	require.NoError(t, err)
+	defer listeners[0].Close()
+	info, err := os.Stat(peercred.Address)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0666), info.Mode().Perm())
+
+	gid := strconv.Itoa(os.Getgid())
+	restricted := listenSpec{Network: "unix", Address: filepath.Join(dir, "noauth.sock"), NoAuth: true, Mode: 0660, Group: gid}
+	listeners, err = listen(restricted)
+	require.NoError(t, err)
+	defer listeners[0].Close()
+	info, err = os.Stat(restricted.Address)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+	assert.Equal(t, uint32(os.Getgid()), info.Sys().(*syscall.Stat_t).Gid)
+
+	_, err = listen(listenSpec{Network: "unix", Address: filepath.Join(dir, "bad.sock"), Group: "no-such-group-here"})
+	assert.ErrorContains(t, err, "invalid group")
+}
+
+func TestExternalBaseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		headers    map[string]string
+		tls        bool
+		proxied    bool
+		want       string
+	}{
+		{name: "plain request", want: "http://example.com"},
+		{name: "tls request", tls: true, want: "https://example.com"},
+		{name: "configured wins", configured: "https://mcp.example.org/", headers: map[string]string{"Forwarded": "proto=http;host=other"}, proxied: true, want: "https://mcp.example.org"},
+		{name: "forwarded header", headers: map[string]string{"Forwarded": `for=192.0.2.60;proto=https;host="mcp.example.org"`}, proxied: true, want: "https://mcp.example.org"},
+		{name: "x-forwarded headers", headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "proxy.example.org:8443"}, proxied: true, want: "https://proxy.example.org:8443"},
+		{name: "spoofed forwarded entry", headers: map[string]string{"Forwarded": `for=192.0.2.60;proto=http;host=evil.example.net, for=192.0.2.60;proto=https;host=mcp.example.org`}, proxied: true, want: "https://mcp.example.org"},
+		{name: "spoofed x-forwarded entries", headers: map[string]string{"X-Forwarded-Proto": "http, https", "X-Forwarded-Host": "evil.example.net, [2001:db8::1]:8443"}, proxied: true, want: "https://[2001:db8::1]:8443"},
+		{name: "invalid forwarded values", headers: map[string]string{"X-Forwarded-Proto": "javascript", "X-Forwarded-Host": "evil.example.net/path@"}, proxied: true, want: "http://example.com"},
+		{name: "headers of an untrusted peer", headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example.net", "Forwarded": "host=evil.example.net"}, want: "http://example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/mcp", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proxied {
+				r = r.WithContext(context.WithValue(r.Context(), trustedProxyKey{}, true))
+			}
+			assert.Equal(t, tt.want, externalBaseURL(r, tt.configured))
+		})
+	}
+}
+
+func TestSocketActivation(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "2")
+	assert.Equal(t, "", httpAddresses(""))
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	assert.Equal(t, "systemd:", httpAddresses(""))
+	assert.Equal(t, "127.0.0.1:8666", httpAddresses("127.0.0.1:8666"))
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp.Close()
+	unix, err := net.Listen("unix", t.TempDir()+"/mcp.sock")
+	require.NoError(t, err)
+	defer unix.Close()
+	saved := activatedListeners
+	defer func() { activatedListeners = saved }()
+	activatedListeners = func() (map[string][]net.Listener, error) {
+		// sockets which don't listen are passed as nil
+		return map[string][]net.Listener{"systemd-mcp": {tcp, nil}, "local": {unix}}, nil
+	}
+
+	listeners, err := listen(listenSpec{Network: "systemd", Address: "systemd-mcp"})
+	require.NoError(t, err)
+	assert.Equal(t, []net.Listener{tcp}, listeners)
+	listeners, err = listen(listenSpec{Network: "systemd"})
+	require.NoError(t, err)
+	assert.Len(t, listeners, 2)
+	_, err = listen(listenSpec{Network: "systemd", Address: "other"})
+	assert.Error(t, err)
+	_, err = listen(listenSpec{Network: "systemd", Address: "systemd-mcp", PeerCred: true})
+	assert.ErrorContains(t, err, "isn't a unix socket")
+	listeners, err = listen(listenSpec{Network: "systemd", Address: "local", PeerCred: true})
+	require.NoError(t, err)
+	assert.Equal(t, []net.Listener{unix}, listeners)
+}
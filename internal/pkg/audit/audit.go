@@ -0,0 +1,291 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/requestid"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/state"
+)
+
+// MessageID identifies the audit entries in the journal, e.g.
+// journalctl MESSAGE_ID=e1fc8bd28d4945689ea6556dd76ee1fc
+const MessageID = "e1fc8bd28d4945689ea6556dd76ee1fc"
+
+// journal fields of an audit entry
+const (
+	FieldSeq     = "SYSTEMD_MCP_SEQ"
+	FieldTool    = "SYSTEMD_MCP_TOOL"
+	FieldUser    = "SYSTEMD_MCP_USER"
+	FieldSession = "SYSTEMD_MCP_SESSION"
+	FieldTarget  = "SYSTEMD_MCP_TARGET"
+	FieldAction  = "SYSTEMD_MCP_ACTION"
+	FieldResult  = "SYSTEMD_MCP_RESULT"
+	FieldError   = "SYSTEMD_MCP_ERROR"
+	FieldRequest = "SYSTEMD_MCP_REQUEST_ID"
+	FieldJob     = "SYSTEMD_MCP_JOB"
+)
+
+// Entry is the record of one call of a write tool
+type Entry struct {
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+	Tool    string    `json:"tool"`
+	User    string    `json:"user"`
+	Session string    `json:"session,omitempty"`
+	Target  string    `json:"target,omitempty"`
+	Action  string    `json:"action,omitempty"`
+	Result  string    `json:"result"`
+	Error   string    `json:"error,omitempty"`
+	Request string    `json:"request_id,omitempty"`
+	// Job is the background job which ran the call
+	Job string `json:"job,omitempty"`
+}
+
+// Fields returns the journal fields of the entry
+func (e *Entry) Fields() map[string]string {
+	fields := map[string]string{
+		"MESSAGE_ID": MessageID,
+		FieldSeq:     strconv.FormatUint(e.Seq, 10),
+		FieldTool:    e.Tool,
+		FieldUser:    e.User,
+		FieldResult:  e.Result,
+	}
+	for k, v := range map[string]string{FieldSession: e.Session, FieldTarget: e.Target, FieldAction: e.Action, FieldError: e.Error, FieldRequest: e.Request, FieldJob: e.Job} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// FromFields parses an entry read from the journal
+func FromFields(fields map[string]string) Entry {
+	seq, _ := strconv.ParseUint(fields[FieldSeq], 10, 64)
+	return Entry{
+		Seq:     seq,
+		Tool:    fields[FieldTool],
+		User:    fields[FieldUser],
+		Session: fields[FieldSession],
+		Target:  fields[FieldTarget],
+		Action:  fields[FieldAction],
+		Result:  fields[FieldResult],
+		Error:   fields[FieldError],
+		Request: fields[FieldRequest],
+		Job:     fields[FieldJob],
+	}
+}
+
+func (e *Entry) message() string {
+	msg := fmt.Sprintf("%s called %s", e.User, e.Tool)
+	if e.Action != "" {
+		msg += " " + e.Action
+	}
+	if e.Target != "" {
+		msg += " on " + e.Target
+	}
+	if e.Error != "" {
+		return msg + ": " + e.Result + ": " + e.Error
+	}
+	return msg + ": " + e.Result
+}
+
+// send writes to the journal, replaced in the tests
+var send = func(e *Entry) error {
+	if !journal.Enabled() {
+		return fmt.Errorf("journal isn't available")
+	}
+	return journal.Send(e.message(), journal.PriNotice, e.Fields())
+}
+
+// savedSeq is the state of the sequence numbers
+type savedSeq struct {
+	Next uint64 `json:"next"`
+}
+
+var seq struct {
+	sync.Mutex
+	loaded bool
+	next   uint64
+}
+
+// nextSeq returns the next sequence number, which is kept across restarts
+// so gaps in the audit trail can be detected
+func nextSeq() uint64 {
+	seq.Lock()
+	defer seq.Unlock()
+	if !seq.loaded {
+		var saved savedSeq
+		if err := state.Load("audit", &saved); err != nil {
+			slog.Warn("couldn't restore the audit sequence number", "error", err)
+		}
+		seq.next, seq.loaded = max(saved.Next, 1), true
+	}
+	n := seq.next
+	seq.next++
+	if err := state.Save("audit", savedSeq{Next: seq.next}); err != nil {
+		slog.Warn("couldn't save the audit sequence number", "error", err)
+	}
+	return n
+}
+
+// Record writes the entry to the journal, and to the log if the journal
+// can't be written
+func Record(e Entry) {
+	e.Seq = nextSeq()
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	attrs := []any{"audit", "privileged_call", "seq", e.Seq, "tool", e.Tool, "user", e.User, "session", e.Session,
+		"target", e.Target, "action", e.Action, "result", e.Result}
+	if e.Error != "" {
+		attrs = append(attrs, "error", e.Error)
+	}
+	if e.Request != "" {
+		attrs = append(attrs, "request_id", e.Request)
+	}
+	if err := send(&e); err != nil {
+		slog.Warn("couldn't write audit entry to the journal", append(attrs, "journal_error", err)...)
+		return
+	}
+	slog.Debug("privileged call", attrs...)
+}
+
+// user returns who called the tool: the user of the token, the noauth
+// listener or for stdio the user the server runs as
+func user(req mcp.Request) string {
+	if extra := req.GetExtra(); extra != nil && extra.TokenInfo != nil {
+		if extra.TokenInfo.Extra["listener"] == "noauth" {
+			return "noauth listener"
+		}
+		if extra.TokenInfo.UserID != "" {
+			return extra.TokenInfo.UserID
+		}
+		return "unknown token user"
+	}
+	return "uid " + strconv.Itoa(os.Getuid())
+}
+
+// targetKeys are the arguments naming what a tool changes, in the order
+// they are preferred
+var targetKeys = []string{"name", "names", "unit", "path", "user", "daemon"}
+
+// describe returns the target and action from the arguments of the call
+func describe(arguments json.RawMessage) (target, action string) {
+	var args map[string]any
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", ""
+	}
+	for _, key := range targetKeys {
+		if v, ok := args[key]; ok {
+			target = format(v)
+			break
+		}
+	}
+	for _, key := range []string{"action", "mode"} {
+		if v, ok := args[key]; ok {
+			action = format(v)
+			break
+		}
+	}
+	if dryRun, _ := args["dry_run"].(bool); dryRun {
+		action = strings.TrimSpace(action + " dry_run")
+	}
+	return target, action
+}
+
+func format(v any) string {
+	if list, ok := v.([]any); ok {
+		var items []string
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// setOutcome sets the result and the error of the entry from the answer
+// of the call
+func (e *Entry) setOutcome(res mcp.Result, err error) {
+	e.Result = "success"
+	if err != nil {
+		e.Result, e.Error = "failure", err.Error()
+	} else if r, ok := res.(*mcp.CallToolResult); ok && r.IsError {
+		e.Result = "failure"
+		for _, c := range r.Content {
+			if text, ok := c.(*mcp.TextContent); ok {
+				e.Error = text.Text
+				break
+			}
+		}
+	}
+}
+
+type pendingKey struct{}
+
+// pending is the audited call of a context, which may be handed to a
+// background job
+type pending struct {
+	entry Entry
+	job   string
+}
+
+// Defer hands the recording of the audited call of ctx to the background
+// job: the middleware records the call as submitted, and the returned
+// function records its outcome once the job finished. Calls which aren't
+// audited get a function which does nothing.
+func Defer(ctx context.Context, job string) func(res mcp.Result, err error) {
+	p, ok := ctx.Value(pendingKey{}).(*pending)
+	if !ok {
+		return func(mcp.Result, error) {}
+	}
+	p.job = job
+	entry := p.entry
+	entry.Job = job
+	return func(res mcp.Result, err error) {
+		entry.setOutcome(res, err)
+		Record(entry)
+	}
+}
+
+// Middleware records every call of the write tools with its caller,
+// target, action and result. Calls run in the background are recorded
+// when they are submitted and again with their result.
+func Middleware(writeTools []string) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			call, ok := req.(*mcp.CallToolRequest)
+			if method != "tools/call" || !ok || call.Params == nil || !slices.Contains(writeTools, call.Params.Name) {
+				return next(ctx, method, req)
+			}
+			entry := Entry{
+				Tool:    call.Params.Name,
+				User:    user(req),
+				Request: requestid.FromContext(ctx),
+			}
+			if call.Session != nil {
+				entry.Session = call.Session.ID()
+			}
+			entry.Target, entry.Action = describe(call.Params.Arguments)
+			p := &pending{entry: entry}
+			res, err := next(context.WithValue(ctx, pendingKey{}, p), method, req)
+			entry.setOutcome(res, err)
+			if p.job != "" && entry.Result == "success" {
+				entry.Result, entry.Job = "submitted", p.job
+			}
+			Record(entry)
+			return res, err
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribe(t *testing.T) {
+	target, action := describe([]byte(`{"names":["a.service","b.service"],"action":"restart"}`))
+	assert.Equal(t, "a.service,b.service", target)
+	assert.Equal(t, "restart", action)
+
+	target, action = describe([]byte(`{"path":"/etc/hosts","dry_run":true}`))
+	assert.Equal(t, "/etc/hosts", target)
+	assert.Equal(t, "dry_run", action)
+
+	target, action = describe([]byte(`invalid`))
+	assert.Empty(t, target)
+	assert.Empty(t, action)
+}
+
+func TestEntryFields(t *testing.T) {
+	e := Entry{Seq: 3, Tool: "change_unit_state", User: "alice", Target: "foo.service", Action: "stop", Result: "success", Request: "3f2a9c0d1e4b5a67"}
+	fields := e.Fields()
+	assert.Equal(t, MessageID, fields["MESSAGE_ID"])
+	assert.NotContains(t, fields, FieldError)
+	assert.Equal(t, e, FromFields(fields))
+	assert.Equal(t, "alice called change_unit_state stop on foo.service: success", e.message())
+}
+
+func TestMiddleware(t *testing.T) {
+	defer state.SetDir(state.Dir())
+	state.SetDir(t.TempDir())
+	seq.loaded = false
+	defer func() { seq.loaded = false }()
+
+	var recorded []Entry
+	defer func(s func(e *Entry) error) { send = s }(send)
+	send = func(e *Entry) error {
+		recorded = append(recorded, *e)
+		return nil
+	}
+
+	handler := Middleware([]string{"change_unit_state"})(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if req.(*mcp.CallToolRequest).Params.Arguments == nil {
+			return nil, errors.New("denied")
+		}
+		return &mcp.CallToolResult{}, nil
+	})
+	call := func(name string, args []byte, ti *auth.TokenInfo) {
+		_, _ = handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+			Params: &mcp.CallToolParamsRaw{Name: name, Arguments: args},
+			Extra:  &mcp.RequestExtra{TokenInfo: ti},
+		})
+	}
+
+	call("change_unit_state", []byte(`{"name":"foo.service","action":"restart"}`), &auth.TokenInfo{UserID: "alice"})
+	call("list_log", []byte(`{}`), nil)
+	call("change_unit_state", nil, &auth.TokenInfo{Extra: map[string]any{"listener": "noauth"}})
+	require.Len(t, recorded, 2)
+	assert.Equal(t, Entry{Seq: 1, Time: recorded[0].Time, Tool: "change_unit_state", User: "alice", Target: "foo.service", Action: "restart", Result: "success"}, recorded[0])
+	assert.Equal(t, uint64(2), recorded[1].Seq)
+	assert.Equal(t, "noauth listener", recorded[1].User)
+	assert.Equal(t, "failure", recorded[1].Result)
+	assert.Equal(t, "denied", recorded[1].Error)
+
+	// the sequence continues after a restart
+	seq.loaded = false
+	assert.Equal(t, uint64(3), nextSeq())
+}
+
+func TestMiddlewareBackground(t *testing.T) {
+	defer state.SetDir(state.Dir())
+	state.SetDir(t.TempDir())
+	seq.loaded = false
+	defer func() { seq.loaded = false }()
+
+	var recorded []Entry
+	defer func(s func(e *Entry) error) { send = s }(send)
+	send = func(e *Entry) error {
+		recorded = append(recorded, *e)
+		return nil
+	}
+
+	var finish func(mcp.Result, error)
+	handler := Middleware([]string{"change_unit_state"})(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		finish = Defer(ctx, "4a1f")
+		return &mcp.CallToolResult{}, nil
+	})
+	_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+		Params: &mcp.CallToolParamsRaw{Name: "change_unit_state", Arguments: []byte(`{"name":"foo.service","action":"stop"}`)},
+	})
+	require.NoError(t, err)
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "submitted", recorded[0].Result)
+	assert.Equal(t, "4a1f", recorded[0].Job)
+
+	finish(nil, errors.New("access denied"))
+	require.Len(t, recorded, 2)
+	assert.Equal(t, "failure", recorded[1].Result)
+	assert.Equal(t, "access denied", recorded[1].Error)
+	assert.Equal(t, "4a1f", recorded[1].Job)
+	assert.Equal(t, "foo.service", recorded[1].Target)
+
+	// calls which aren't audited can't be deferred
+	Defer(context.Background(), "5b2e")(&mcp.CallToolResult{}, nil)
+	assert.Len(t, recorded, 2)
+}
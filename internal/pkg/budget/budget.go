@@ -0,0 +1,252 @@
+package budget
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sessionid"
+)
+
+// MetaKey is the key under which the continuation of a truncated result is
+// added to the _meta field of the result.
+const MetaKey = "continuation"
+
+// ToolName is the tool which returns the rest of a truncated result
+const ToolName = "continue_result"
+
+// BytesPerToken is the rough number of bytes of a token, used for the
+// estimate of the tokens of the rest
+const BytesPerToken = 4
+
+const (
+	// smaller budgets are raised to this, so that every page makes progress
+	minBytes = 1024
+	// room left for the truncation marker
+	markerBytes = 200
+)
+
+// format of the marker which replaces the rest of a truncated result
+const marker = "[truncated: %d more bytes (about %d tokens), call %s with cursor %q for the rest]"
+
+var (
+	// rests which weren't continued are dropped after this time
+	ContinuationTTL = 10 * time.Minute
+	// at most this many rests are kept, the oldest is dropped first
+	maxPending = 64
+)
+
+type pendingResult struct {
+	session string
+	content []mcp.Content
+	isError bool
+	expires time.Time
+}
+
+// Budget caps the size of every tool result. The content which doesn't fit
+// is replaced by a marker and kept for the session, continue_result returns
+// it page by page.
+type Budget struct {
+	max int
+
+	mu      sync.Mutex
+	pending map[string]*pendingResult
+}
+
+// New returns a budget of maxBytes per result, nil if maxBytes isn't
+// positive
+func New(maxBytes int) *Budget {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &Budget{
+		max:     max(maxBytes, minBytes),
+		pending: make(map[string]*pendingResult),
+	}
+}
+
+type limitKey struct{}
+
+// Limit returns the budget of the result of the call, 0 if it isn't
+// limited. Tools which can stop early use it to not read more than fits.
+func Limit(ctx context.Context) int {
+	limit, _ := ctx.Value(limitKey{}).(int)
+	return limit
+}
+
+// ContinueParams are the parameters of continue_result
+type ContinueParams struct {
+	Cursor string `json:"cursor" jsonschema:"The cursor of the truncation marker or of _meta.continuation of the truncated result"`
+}
+
+// Middleware truncates the results of the tool calls which exceed the
+// budget. A nil budget passes all results unchanged.
+func (b *Budget) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	if b == nil {
+		return next
+	}
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		res, err := next(context.WithValue(ctx, limitKey{}, b.max), method, req)
+		if method != "tools/call" || err != nil {
+			return res, err
+		}
+		if result, ok := res.(*mcp.CallToolResult); ok && result != nil {
+			b.limit(sessionid.FromRequest(req), result)
+		}
+		return res, err
+	}
+}
+
+// size returns the number of bytes of a content, the text of text content
+// and the JSON encoding of the others
+func size(content mcp.Content) int {
+	if text, ok := content.(*mcp.TextContent); ok {
+		return len(text.Text)
+	}
+	data, _ := json.Marshal(content)
+	return len(data)
+}
+
+func totalSize(contents []mcp.Content) int {
+	n := 0
+	for _, content := range contents {
+		n += size(content)
+	}
+	return n
+}
+
+// cutText returns the longest prefix of text up to n bytes which ends at a
+// line break, or at a rune boundary if the line would be shorter than half
+// of it
+func cutText(text string, n int) string {
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	if i := strings.LastIndexByte(text[:n], '\n'); i >= n/2 {
+		return text[:i+1]
+	}
+	return text[:n]
+}
+
+// split returns the contents which fit into n bytes and the rest. A text
+// is cut, other contents are moved to the rest as a whole unless they are
+// the first.
+func split(contents []mcp.Content, n int) (kept, rest []mcp.Content) {
+	used := 0
+	for i, content := range contents {
+		s := size(content)
+		if used+s <= n {
+			kept = append(kept, content)
+			used += s
+			continue
+		}
+		text, ok := content.(*mcp.TextContent)
+		if !ok {
+			if i == 0 {
+				return contents[:1], contents[1:]
+			}
+			return kept, contents[i:]
+		}
+		head := cutText(text.Text, n-used)
+		if head != "" {
+			kept = append(kept, &mcp.TextContent{Text: head})
+		}
+		rest = append([]mcp.Content{&mcp.TextContent{Text: text.Text[len(head):]}}, contents[i+1:]...)
+		return kept, rest
+	}
+	return kept, nil
+}
+
+// limit truncates the result if it exceeds the budget
+func (b *Budget) limit(session string, res *mcp.CallToolResult) {
+	n := totalSize(res.Content)
+	var structured []byte
+	if res.StructuredContent != nil {
+		structured, _ = json.Marshal(res.StructuredContent)
+		n += len(structured)
+	}
+	if n <= b.max {
+		return
+	}
+	// the text content carries the same data as the structured content
+	if res.StructuredContent != nil {
+		if len(res.Content) == 0 {
+			res.Content = []mcp.Content{&mcp.TextContent{Text: string(structured)}}
+		}
+		res.StructuredContent = nil
+	}
+	kept, rest := split(res.Content, b.max-markerBytes)
+	if len(rest) == 0 {
+		return
+	}
+	remaining := totalSize(rest)
+	cursor := b.store(session, rest, res.IsError)
+	res.Content = append(kept, &mcp.TextContent{Text: fmt.Sprintf(marker, remaining, remaining/BytesPerToken, ToolName, cursor)})
+	meta := res.GetMeta()
+	if meta == nil {
+		meta = make(map[string]any)
+	}
+	meta[MetaKey] = map[string]any{
+		"cursor":           cursor,
+		"returned_bytes":   totalSize(kept),
+		"remaining_bytes":  remaining,
+		"remaining_tokens": remaining / BytesPerToken,
+	}
+	res.SetMeta(meta)
+	slog.Debug("tool result truncated", "session", session, "size", n, "remaining", remaining, "cursor", cursor)
+}
+
+// store keeps the rest of a result for the session and returns its cursor
+func (b *Budget) store(session string, content []mcp.Content, isError bool) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	cursor := hex.EncodeToString(buf)
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var oldest string
+	for c, p := range b.pending {
+		if now.After(p.expires) {
+			delete(b.pending, c)
+		} else if oldest == "" || p.expires.Before(b.pending[oldest].expires) {
+			oldest = c
+		}
+	}
+	if len(b.pending) >= maxPending {
+		delete(b.pending, oldest)
+	}
+	b.pending[cursor] = &pendingResult{
+		session: session,
+		content: content,
+		isError: isError,
+		expires: now.Add(ContinuationTTL),
+	}
+	return cursor
+}
+
+// Continue returns the rest of a truncated result of the same session, it
+// is truncated again if it still exceeds the budget
+func (b *Budget) Continue(ctx context.Context, req *mcp.CallToolRequest, params *ContinueParams) (*mcp.CallToolResult, any, error) {
+	var session string
+	if req != nil {
+		session = sessionid.FromRequest(req)
+	}
+	b.mu.Lock()
+	p, ok := b.pending[params.Cursor]
+	if ok && p.session == session {
+		delete(b.pending, params.Cursor)
+	}
+	b.mu.Unlock()
+	if !ok || p.session != session || time.Now().After(p.expires) {
+		return nil, nil, fmt.Errorf("unknown or expired cursor, call the tool again")
+	}
+	return &mcp.CallToolResult{Content: p.content, IsError: p.isError}, nil, nil
+}
@@ -0,0 +1,132 @@
+package budget
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// call runs a tool call returning res through the middleware of the budget
+func call(t *testing.T, b *Budget, res *mcp.CallToolResult) *mcp.CallToolResult {
+	t.Helper()
+	handler := b.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		return res, nil
+	})
+	got, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{})
+	require.NoError(t, err)
+	return got.(*mcp.CallToolResult)
+}
+
+func text(res *mcp.CallToolResult) string {
+	var b strings.Builder
+	for _, content := range res.Content {
+		b.WriteString(content.(*mcp.TextContent).Text)
+	}
+	return b.String()
+}
+
+func TestNew(t *testing.T) {
+	assert.Nil(t, New(0))
+	assert.Equal(t, minBytes, New(10).max)
+	var b *Budget
+	res := &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: strings.Repeat("x", 10000)}}}
+	assert.Same(t, res, call(t, b, res), "a nil budget must pass the result")
+}
+
+func TestMiddleware(t *testing.T) {
+	b := New(2048)
+
+	t.Run("small result", func(t *testing.T) {
+		res := call(t, b, &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "ok"}}})
+		assert.Equal(t, "ok", text(res))
+		assert.Nil(t, res.GetMeta())
+	})
+
+	t.Run("continued until complete", func(t *testing.T) {
+		var lines []string
+		for i := range 200 {
+			lines = append(lines, strings.Repeat("x", i%50))
+		}
+		full := strings.Join(lines, "\n") + "\n"
+		res := call(t, b, &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: full}}, IsError: true})
+		var got strings.Builder
+		pages := 0
+		for {
+			pages++
+			require.Less(t, pages, 20)
+			meta, ok := res.GetMeta()[MetaKey].(map[string]any)
+			if !ok {
+				got.WriteString(text(res))
+				break
+			}
+			assert.True(t, res.IsError)
+			last := res.Content[len(res.Content)-1].(*mcp.TextContent).Text
+			assert.Contains(t, last, "call continue_result with cursor")
+			assert.LessOrEqual(t, len(text(res)), 2048)
+			for _, content := range res.Content[:len(res.Content)-1] {
+				got.WriteString(content.(*mcp.TextContent).Text)
+			}
+			cont, _, err := b.Continue(context.Background(), nil, &ContinueParams{Cursor: meta["cursor"].(string)})
+			require.NoError(t, err)
+			res = call(t, b, cont)
+		}
+		assert.Greater(t, pages, 2)
+		assert.Equal(t, full, got.String())
+	})
+
+	t.Run("structured content is dropped", func(t *testing.T) {
+		res := call(t, b, &mcp.CallToolResult{
+			Content:           []mcp.Content{&mcp.TextContent{Text: "summary"}},
+			StructuredContent: map[string]string{"data": strings.Repeat("y", 3000)},
+		})
+		assert.Nil(t, res.StructuredContent)
+		assert.Equal(t, "summary", text(res))
+	})
+}
+
+func TestContinue(t *testing.T) {
+	b := New(1024)
+	cursor := b.store("a", []mcp.Content{&mcp.TextContent{Text: "rest"}}, false)
+
+	_, _, err := b.Continue(context.Background(), nil, &ContinueParams{Cursor: cursor})
+	assert.Error(t, err, "the rest of another session must not be returned")
+
+	b.pending[cursor].session = ""
+	res, _, err := b.Continue(context.Background(), nil, &ContinueParams{Cursor: cursor})
+	require.NoError(t, err)
+	assert.Equal(t, "rest", text(res))
+	_, _, err = b.Continue(context.Background(), nil, &ContinueParams{Cursor: cursor})
+	assert.Error(t, err, "a cursor can only be continued once")
+
+	cursor = b.store("", []mcp.Content{&mcp.TextContent{Text: "rest"}}, false)
+	b.pending[cursor].expires = time.Now().Add(-time.Second)
+	_, _, err = b.Continue(context.Background(), nil, &ContinueParams{Cursor: cursor})
+	assert.Error(t, err)
+}
+
+func TestStoreEvictsOldest(t *testing.T) {
+	b := New(1024)
+	first := b.store("", nil, false)
+	for range maxPending {
+		b.store("", nil, false)
+	}
+	assert.Len(t, b.pending, maxPending)
+	assert.NotContains(t, b.pending, first)
+}
+
+func TestLimit(t *testing.T) {
+	assert.Equal(t, 0, Limit(context.Background()))
+	var limit int
+	handler := New(4096).Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		limit = Limit(ctx)
+		return &mcp.CallToolResult{}, nil
+	})
+	_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, 4096, limit)
+}
@@ -0,0 +1,226 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ToolName evaluates calendar expressions, timespans and timestamps
+const ToolName = "evaluate_calendar"
+
+const (
+	Calendar  = "calendar"
+	Timespan  = "timespan"
+	Timestamp = "timestamp"
+)
+
+const (
+	analyzeTimeout    = 5 * time.Second
+	defaultIterations = 5
+	maxIterations     = 100
+	maxExpressions    = 16
+	maxExpressionLen  = 256
+)
+
+// run runs systemd-analyze with the arguments, replaced by the tests
+var run = func(ctx context.Context, args ...string) ([]byte, []byte, error) {
+	cmd := exec.CommandContext(ctx, "systemd-analyze", args...)
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return []byte(stdout.String()), []byte(stderr.String()), err
+}
+
+// analyzeAvailable looks up systemd-analyze once, on the first call
+var analyzeAvailable = sync.OnceValue(func() bool {
+	_, err := exec.LookPath("systemd-analyze")
+	return err == nil
+})
+
+type EvaluateParams struct {
+	Expressions []string `json:"expressions" jsonschema:"Expressions to evaluate, e.g. 'Mon..Fri *-*-* 02:00' or 'daily' for calendar, '1h 30min' for timespan and 'tomorrow' or '2025-01-01 00:00 UTC' for timestamp. At most 16."`
+	Type        string   `json:"type,omitempty" jsonschema:"calendar for the OnCalendar= expressions of timers, timespan for durations like OnBootSec= or RuntimeMaxSec=, timestamp for points in time (default calendar)"`
+	Iterations  int      `json:"iterations,omitempty" jsonschema:"Number of next elapse times of a calendar expression, at most 100 (default 5)"`
+}
+
+// Elapse is a time at which a calendar expression elapses
+type Elapse struct {
+	Time    string `json:"time"`
+	UTC     string `json:"utc,omitempty"`
+	FromNow string `json:"from_now,omitempty"`
+}
+
+// Evaluation is the outcome for a single expression. An invalid expression
+// has the error of systemd-analyze.
+type Evaluation struct {
+	Expression string   `json:"expression"`
+	Valid      bool     `json:"valid"`
+	Error      string   `json:"error,omitempty"`
+	Normalized string   `json:"normalized,omitempty"`
+	Elapses    []Elapse `json:"elapses,omitempty"`
+	Usec       *uint64  `json:"usec,omitempty"`
+	UTC        string   `json:"utc,omitempty"`
+	Unix       string   `json:"unix,omitempty"`
+	FromNow    string   `json:"from_now,omitempty"`
+}
+
+type EvaluateResult struct {
+	Type        string       `json:"type"`
+	Evaluations []Evaluation `json:"evaluations"`
+}
+
+func CreateEvaluateSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[EvaluateParams](nil)
+	inputSchema.Properties["type"].Enum = []any{Calendar, Timespan, Timestamp}
+	inputSchema.Properties["type"].Default = json.RawMessage(`"calendar"`)
+	inputSchema.Properties["iterations"].Default = json.RawMessage(strconv.Itoa(defaultIterations))
+	return inputSchema
+}
+
+// validExpression rejects expressions which systemd-analyze would take as
+// an option and control characters
+func validExpression(expr string) bool {
+	return strings.TrimSpace(expr) != "" && len(expr) <= maxExpressionLen &&
+		!strings.HasPrefix(expr, "-") && !strings.ContainsFunc(expr, unicode.IsControl)
+}
+
+// fields returns the "key: value" lines of the output of systemd-analyze in
+// their order, the keys are aligned with spaces
+func fields(output string) [][2]string {
+	var kv [][2]string
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		kv = append(kv, [2]string{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+	return kv
+}
+
+// parse fills the evaluation from the output of systemd-analyze
+func (e *Evaluation) parse(kind, output string) {
+	for _, f := range fields(output) {
+		key, value := f[0], f[1]
+		switch {
+		case key == "Normalized form" || (kind == Timespan && key == "Human"):
+			e.Normalized = value
+		case key == "Next elapse" || strings.HasPrefix(key, "Iter"):
+			// a calendar which never elapses again
+			if value != "never" {
+				e.Elapses = append(e.Elapses, Elapse{Time: value})
+			}
+		case key == "(in UTC)":
+			if n := len(e.Elapses); kind == Calendar && n > 0 {
+				e.Elapses[n-1].UTC = value
+			} else {
+				e.UTC = value
+			}
+		case key == "From now":
+			if n := len(e.Elapses); kind == Calendar && n > 0 {
+				e.Elapses[n-1].FromNow = value
+			} else {
+				e.FromNow = value
+			}
+		case key == "UNIX seconds":
+			e.Unix = value
+		case key == "μs":
+			if usec, err := strconv.ParseUint(value, 10, 64); err == nil {
+				e.Usec = &usec
+			}
+		}
+	}
+}
+
+// evaluate runs systemd-analyze for a single expression
+func evaluate(ctx context.Context, kind, expr string, iterations int) (Evaluation, error) {
+	e := Evaluation{Expression: expr}
+	args := []string{kind}
+	if kind == Calendar {
+		args = append(args, fmt.Sprintf("--iterations=%d", iterations))
+	}
+	ctx, cancel := context.WithTimeout(ctx, analyzeTimeout)
+	defer cancel()
+	stdout, stderr, err := run(ctx, append(args, "--", expr)...)
+	if ctx.Err() != nil {
+		return e, fmt.Errorf("systemd-analyze %s didn't finish within %s", kind, analyzeTimeout)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return e, fmt.Errorf("failed to run systemd-analyze: %w", err)
+	}
+	if err != nil {
+		// systemd-analyze explains an invalid expression on stderr
+		e.Error = strings.TrimSpace(string(stderr))
+		if e.Error == "" {
+			e.Error = err.Error()
+		}
+		return e, nil
+	}
+	e.Valid = true
+	e.parse(kind, string(stdout))
+	return e, nil
+}
+
+// Evaluate validates calendar expressions, timespans or timestamps like
+// systemd-analyze calendar, timespan and timestamp and returns their
+// normalized form, for calendar expressions with the next elapse times
+func Evaluate(ctx context.Context, req *mcp.CallToolRequest, params *EvaluateParams) (*mcp.CallToolResult, any, error) {
+	kind := params.Type
+	if kind == "" {
+		kind = Calendar
+	}
+	if kind != Calendar && kind != Timespan && kind != Timestamp {
+		return nil, nil, fmt.Errorf("invalid type: %s", kind)
+	}
+	if len(params.Expressions) == 0 || len(params.Expressions) > maxExpressions {
+		return nil, nil, fmt.Errorf("pass between 1 and %d expressions", maxExpressions)
+	}
+	for _, expr := range params.Expressions {
+		if !validExpression(expr) {
+			return nil, nil, fmt.Errorf("invalid expression: %q", expr)
+		}
+	}
+	iterations := params.Iterations
+	if iterations <= 0 {
+		iterations = defaultIterations
+	}
+	iterations = min(iterations, maxIterations)
+	if !analyzeAvailable() {
+		return nil, nil, errors.New("systemd-analyze isn't installed on this machine")
+	}
+
+	result := EvaluateResult{Type: kind}
+	for _, expr := range params.Expressions {
+		e, err := evaluate(ctx, kind, expr, iterations)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Evaluations = append(result.Evaluations, e)
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,97 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dailyOutput = `  Original form: daily
+Normalized form: *-*-* 00:00:00
+    Next elapse: Sat 2026-10-17 00:00:00 CEST
+       (in UTC): Fri 2026-10-16 22:00:00 UTC
+       From now: 16h left
+       Iter. #2: Sun 2026-10-18 00:00:00 CEST
+       (in UTC): Sat 2026-10-17 22:00:00 UTC
+       From now: 1 day 16h left
+`
+
+func TestParse(t *testing.T) {
+	var e Evaluation
+	e.parse(Calendar, dailyOutput)
+	assert.Equal(t, "*-*-* 00:00:00", e.Normalized)
+	assert.Equal(t, []Elapse{
+		{Time: "Sat 2026-10-17 00:00:00 CEST", UTC: "Fri 2026-10-16 22:00:00 UTC", FromNow: "16h left"},
+		{Time: "Sun 2026-10-18 00:00:00 CEST", UTC: "Sat 2026-10-17 22:00:00 UTC", FromNow: "1 day 16h left"},
+	}, e.Elapses)
+
+	e = Evaluation{}
+	e.parse(Calendar, "  Original form: 2000-01-01\nNormalized form: 2000-01-01 00:00:00\n    Next elapse: never\n")
+	assert.Empty(t, e.Elapses, "a calendar in the past never elapses")
+
+	e = Evaluation{}
+	e.parse(Timespan, "Original: 1h 30min\n      μs: 5400000000\n   Human: 1h 30min\n")
+	require.NotNil(t, e.Usec)
+	assert.Equal(t, uint64(5400000000), *e.Usec)
+	assert.Equal(t, "1h 30min", e.Normalized)
+
+	e = Evaluation{}
+	e.parse(Timestamp, "  Original form: tomorrow\nNormalized form: Sat 2026-10-17 00:00:00 UTC\n   UNIX seconds: @1792195200\n       From now: 18h left\n")
+	assert.Equal(t, "Sat 2026-10-17 00:00:00 UTC", e.Normalized)
+	assert.Equal(t, "@1792195200", e.Unix)
+	assert.Equal(t, "18h left", e.FromNow)
+}
+
+func TestEvaluate(t *testing.T) {
+	var gotArgs []string
+	defer func(r func(context.Context, ...string) ([]byte, []byte, error)) { run = r }(run)
+	run = func(ctx context.Context, args ...string) ([]byte, []byte, error) {
+		gotArgs = args
+		return []byte(dailyOutput), nil, nil
+	}
+	defer func(a func() bool) { analyzeAvailable = a }(analyzeAvailable)
+	analyzeAvailable = func() bool { return true }
+
+	res, _, err := Evaluate(context.Background(), nil, &EvaluateParams{Expressions: []string{"daily"}, Iterations: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"calendar", "--iterations=2", "--", "daily"}, gotArgs)
+	var result EvaluateResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	require.Len(t, result.Evaluations, 1)
+	assert.True(t, result.Evaluations[0].Valid)
+	assert.Len(t, result.Evaluations[0].Elapses, 2)
+
+	for _, params := range []*EvaluateParams{
+		{},
+		{Expressions: []string{"--help"}},
+		{Expressions: []string{"daily"}, Type: "weekly"},
+	} {
+		_, _, err := Evaluate(context.Background(), nil, params)
+		assert.Error(t, err, params)
+	}
+
+	analyzeAvailable = func() bool { return false }
+	_, _, err = Evaluate(context.Background(), nil, &EvaluateParams{Expressions: []string{"daily"}})
+	assert.Error(t, err)
+}
+
+func TestEvaluateSystemdAnalyze(t *testing.T) {
+	if _, err := exec.LookPath("systemd-analyze"); err != nil {
+		t.Skip("systemd-analyze isn't installed")
+	}
+	res, _, err := Evaluate(context.Background(), nil, &EvaluateParams{Expressions: []string{"Mon..Fri *-*-* 02:00", "bogus"}, Iterations: 3})
+	require.NoError(t, err)
+	var result EvaluateResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	require.Len(t, result.Evaluations, 2)
+	assert.True(t, result.Evaluations[0].Valid)
+	assert.Equal(t, "Mon..Fri *-*-* 02:00:00", result.Evaluations[0].Normalized)
+	assert.Len(t, result.Evaluations[0].Elapses, 3)
+	assert.False(t, result.Evaluations[1].Valid)
+	assert.Contains(t, result.Evaluations[1].Error, "bogus")
+}
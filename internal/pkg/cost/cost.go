@@ -0,0 +1,158 @@
+package cost
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sessionid"
+)
+
+// MetaKey is the key under which the cost summary is added to the
+// _meta field of a tool result.
+const MetaKey = "cost"
+
+// Usage collects the resources consumed by a single tool call.
+type Usage struct {
+	bytesRead atomic.Int64
+	dbusCalls atomic.Int64
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying a fresh usage counter
+func NewContext(ctx context.Context) (context.Context, *Usage) {
+	u := &Usage{}
+	return context.WithValue(ctx, contextKey{}, u), u
+}
+
+// FromContext returns the usage counter of the context or nil
+func FromContext(ctx context.Context) *Usage {
+	u, _ := ctx.Value(contextKey{}).(*Usage)
+	return u
+}
+
+// AddBytes accounts n bytes read from the journal or a file
+func AddBytes(ctx context.Context, n int) {
+	if u := FromContext(ctx); u != nil {
+		u.bytesRead.Add(int64(n))
+	}
+}
+
+// AddDbusCall accounts a single call over the dbus
+func AddDbusCall(ctx context.Context) {
+	if u := FromContext(ctx); u != nil {
+		u.dbusCalls.Add(1)
+	}
+}
+
+// Summary is the compact cost report of a call or a session.
+type Summary struct {
+	Calls     int64 `json:"calls,omitempty"`
+	BytesRead int64 `json:"bytes_read"`
+	DbusCalls int64 `json:"dbus_calls"`
+	WallMs    int64 `json:"wall_ms"`
+}
+
+func (s *Summary) add(o Summary) {
+	s.Calls += o.Calls
+	s.BytesRead += o.BytesRead
+	s.DbusCalls += o.DbusCalls
+	s.WallMs += o.WallMs
+}
+
+// IdleTTL is how long the totals of a session without calls are kept, the
+// tracker doesn't see the end of a session
+const IdleTTL = time.Hour
+
+type sessionCost struct {
+	total    Summary
+	lastCall time.Time
+}
+
+// Tracker aggregates the costs of the tool calls per session.
+type Tracker struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionCost
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		sessions: make(map[string]*sessionCost),
+	}
+}
+
+// Record adds the given call summary to the session and returns the
+// new session totals
+func (t *Tracker) Record(sessionID string, call Summary) Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	s, ok := t.sessions[sessionID]
+	if !ok {
+		t.prune(now)
+		s = &sessionCost{}
+		t.sessions[sessionID] = s
+	}
+	call.Calls = 1
+	s.total.add(call)
+	s.lastCall = now
+	return s.total
+}
+
+// prune forgets the sessions which were idle for IdleTTL, called with the
+// lock held
+func (t *Tracker) prune(now time.Time) {
+	for id, s := range t.sessions {
+		if now.Sub(s.lastCall) > IdleTTL {
+			delete(t.sessions, id)
+		}
+	}
+}
+
+// Session returns the totals of the given session
+func (t *Tracker) Session(sessionID string) Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok := t.sessions[sessionID]; ok {
+		return s.total
+	}
+	return Summary{}
+}
+
+// Middleware accounts every tool call and adds the cost of the call and
+// the totals of the session to the metadata of the result.
+func (t *Tracker) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method != "tools/call" {
+			return next(ctx, method, req)
+		}
+		ctx, usage := NewContext(ctx)
+		start := time.Now()
+		res, err := next(ctx, method, req)
+		call := Summary{
+			BytesRead: usage.bytesRead.Load(),
+			DbusCalls: usage.dbusCalls.Load(),
+			WallMs:    time.Since(start).Milliseconds(),
+		}
+		sessionID := sessionid.FromRequest(req)
+		total := t.Record(sessionID, call)
+		slog.Debug("tool call cost", "session", sessionID, "call", call, "session_total", total)
+		if err != nil || res == nil {
+			return res, err
+		}
+		meta := res.GetMeta()
+		if meta == nil {
+			meta = make(map[string]any)
+		}
+		meta[MetaKey] = map[string]any{
+			"call":    call,
+			"session": total,
+		}
+		res.SetMeta(meta)
+		return res, err
+	}
+}
@@ -0,0 +1,44 @@
+package cost
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageFromContext(t *testing.T) {
+	// no usage in context must not panic
+	AddBytes(context.Background(), 10)
+	AddDbusCall(context.Background())
+	assert.Nil(t, FromContext(context.Background()))
+
+	ctx, usage := NewContext(context.Background())
+	AddBytes(ctx, 10)
+	AddBytes(ctx, 5)
+	AddDbusCall(ctx)
+	assert.Equal(t, int64(15), usage.bytesRead.Load())
+	assert.Equal(t, int64(1), usage.dbusCalls.Load())
+}
+
+func TestTrackerRecord(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Record("a", Summary{BytesRead: 100, DbusCalls: 2, WallMs: 3})
+	total := tracker.Record("a", Summary{BytesRead: 50, DbusCalls: 1, WallMs: 4})
+	assert.Equal(t, Summary{Calls: 2, BytesRead: 150, DbusCalls: 3, WallMs: 7}, total)
+	assert.Equal(t, total, tracker.Session("a"))
+	assert.Equal(t, Summary{}, tracker.Session("b"))
+}
+
+func TestTrackerPrune(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Record("a", Summary{BytesRead: 100})
+	tracker.Record("b", Summary{BytesRead: 100})
+	tracker.sessions["a"].lastCall = time.Now().Add(-IdleTTL - time.Minute)
+	// a new session drops the idle ones
+	tracker.Record("c", Summary{})
+	assert.Equal(t, Summary{}, tracker.Session("a"))
+	assert.Equal(t, int64(100), tracker.Session("b").BytesRead)
+	assert.Len(t, tracker.sessions, 2)
+}
@@ -0,0 +1,234 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	maxArchiveMembers = 1000
+	// decompressed streams are cut after this size
+	maxDecompressedSize = 1024 * 1024 * 1024
+)
+
+type ArchiveMember struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Mode    string `json:"mode"`
+	ModTime string `json:"mod_time"`
+	IsDir   bool   `json:"is_dir,omitempty"`
+}
+
+// ArchiveInfo describes a compressed file or an archive. The content of a
+// compressed file or an archive member is put in the content of the result.
+type ArchiveInfo struct {
+	Format       string          `json:"format"`
+	Member       string          `json:"member,omitempty"`
+	Members      []ArchiveMember `json:"members,omitempty"`
+	TotalMembers int             `json:"total_members,omitempty"`
+	Truncated    bool            `json:"truncated,omitempty"`
+}
+
+var magics = []struct {
+	format string
+	magic  []byte
+}{
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"bzip2", []byte("BZh")},
+	{"zip", []byte("PK\x03\x04")},
+	{"zip", []byte("PK\x05\x06")},
+}
+
+// detectArchive returns the format of a compressed file or archive from its
+// magic bytes, an empty string if it is none
+func detectArchive(f *os.File) string {
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	f.Seek(0, io.SeekStart)
+	buf = buf[:n]
+	for _, m := range magics {
+		if bytes.HasPrefix(buf, m.magic) {
+			return m.format
+		}
+	}
+	if isTar(buf) {
+		return "tar"
+	}
+	return ""
+}
+
+func isTar(header []byte) bool {
+	return len(header) >= 262 && string(header[257:262]) == "ustar"
+}
+
+// decompress returns the decompressed stream, xz isn't supported by the
+// standard library so the xz binary is used
+func decompress(ctx context.Context, r io.Reader, format string) (io.Reader, func(), error) {
+	switch format {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gz, func() { gz.Close() }, nil
+	case "bzip2":
+		return bzip2.NewReader(r), func() {}, nil
+	case "xz":
+		cmd := exec.CommandContext(ctx, "xz", "-dc")
+		cmd.Stdin = r
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, nil, fmt.Errorf("couldn't run xz: %w", err)
+		}
+		return out, func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}, nil
+	}
+	return r, func() {}, nil
+}
+
+func memberInfo(name string, info os.FileInfo) ArchiveMember {
+	return ArchiveMember{
+		Name:    name,
+		Size:    info.Size(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime().Format(time.RFC3339),
+		IsDir:   info.IsDir(),
+	}
+}
+
+func (a *ArchiveInfo) addMember(member ArchiveMember) {
+	a.TotalMembers++
+	if len(a.Members) >= maxArchiveMembers {
+		a.Truncated = true
+		return
+	}
+	a.Members = append(a.Members, member)
+}
+
+// readMember puts the content of a member or a decompressed file in the
+// result, binary content is handled like binary files
+func readMember(ctx context.Context, r io.Reader, params *GetFileParams, result *GetFileResult) error {
+	br := bufio.NewReaderSize(r, 512)
+	peek, _ := br.Peek(512)
+	if bytes.IndexByte(peek, 0) == -1 {
+		return readText(ctx, br, params, result)
+	}
+	var data []byte
+	if params.BinaryMode != "" && params.BinaryMode != "none" {
+		maxBytes := params.MaxBytes
+		if maxBytes <= 0 {
+			maxBytes = defaultBinaryBytes
+		}
+		// read one byte more than shown to detect the truncation
+		var err error
+		data, err = io.ReadAll(io.LimitReader(br, int64(params.Offset)+int64(min(maxBytes, maxBinaryBytes))+1))
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	result.Binary, err = readBinary(ctx, bytes.NewReader(data), int64(len(data)), params.BinaryMode, int64(params.Offset), params.MaxBytes)
+	return err
+}
+
+// readArchive lists the members of tar and zip archives or reads a single
+// member. Compressed files which aren't a tar archive are decompressed.
+// Members which the path policy denies, like etc/shadow in a backup of /,
+// are neither listed nor read.
+func readArchive(ctx context.Context, f *os.File, size int64, format string, params *GetFileParams, result *GetFileResult) (*ArchiveInfo, error) {
+	info := &ArchiveInfo{
+		Format: format,
+		Member: params.Member,
+	}
+	policy := GetPathPolicy()
+	if params.Member != "" {
+		if err := policy.CheckMember(f.Name(), params.Member); err != nil {
+			return nil, err
+		}
+	}
+	if format == "zip" {
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip archive: %w", err)
+		}
+		for _, zf := range zr.File {
+			if params.Member == "" {
+				if policy.memberDenied(zf.Name) == "" {
+					info.addMember(memberInfo(zf.Name, zf.FileInfo()))
+				}
+				continue
+			}
+			if zf.Name != params.Member {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open member %s: %w", zf.Name, err)
+			}
+			defer rc.Close()
+			return info, readMember(ctx, io.LimitReader(rc, maxDecompressedSize), params, result)
+		}
+		if params.Member != "" {
+			return nil, fmt.Errorf("member %s not found in archive", params.Member)
+		}
+		return info, nil
+	}
+
+	stream, closeStream, err := decompress(ctx, f, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", format, err)
+	}
+	defer closeStream()
+	br := bufio.NewReaderSize(io.LimitReader(contextReader(ctx, stream), maxDecompressedSize), 512)
+	header, _ := br.Peek(512)
+	if !isTar(header) {
+		// a plain compressed file like a rotated log
+		if params.Member != "" {
+			return nil, fmt.Errorf("%s file has no members", format)
+		}
+		return info, readMember(ctx, br, params, result)
+	}
+
+	if format != "tar" {
+		info.Format = "tar+" + format
+	}
+	tr := tar.NewReader(br)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive: %w", err)
+		}
+		if params.Member == "" {
+			if policy.memberDenied(hdr.Name) == "" {
+				info.addMember(memberInfo(hdr.Name, hdr.FileInfo()))
+			}
+			continue
+		}
+		if hdr.Name == params.Member {
+			return info, readMember(ctx, tr, params, result)
+		}
+	}
+	if params.Member != "" {
+		return nil, fmt.Errorf("member %s not found in archive", params.Member)
+	}
+	return info, nil
+}
@@ -0,0 +1,136 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTarGz(t *testing.T, path string, files map[string]string, names []string) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestGetFile_Archive(t *testing.T) {
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+	tmpDir := t.TempDir()
+
+	getFile := func(t *testing.T, params *GetFileParams) GetFileResult {
+		res, _, err := GetFile(context.Background(), nil, params, testAuth)
+		require.NoError(t, err)
+		var result GetFileResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result
+	}
+
+	t.Run("Rotated gzip log", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "foo.log.2.gz")
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte("line1\nline2\nline3\n"))
+		require.NoError(t, gz.Close())
+		require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+
+		result := getFile(t, &GetFileParams{Path: path, ShowContent: true, Offset: 1, Limit: 1})
+		require.NotNil(t, result.Archive)
+		assert.Equal(t, "gzip", result.Archive.Format)
+		assert.Equal(t, "line2", result.Content)
+		assert.Equal(t, 3, result.TotalLines)
+	})
+
+	path := filepath.Join(tmpDir, "bundle.tar.gz")
+	writeTarGz(t, path, map[string]string{
+		"bundle/info.txt": "crashed\nat 12:00\n",
+		"bundle/core":     "\x7fELF\x00\x00core",
+	}, []string{"bundle/info.txt", "bundle/core"})
+
+	t.Run("List tar members", func(t *testing.T) {
+		result := getFile(t, &GetFileParams{Path: path, ShowContent: true})
+		require.NotNil(t, result.Archive)
+		assert.Equal(t, "tar+gzip", result.Archive.Format)
+		assert.Equal(t, 2, result.Archive.TotalMembers)
+		require.Len(t, result.Archive.Members, 2)
+		assert.Equal(t, "bundle/info.txt", result.Archive.Members[0].Name)
+		assert.Equal(t, int64(17), result.Archive.Members[0].Size)
+	})
+
+	t.Run("Read tar member", func(t *testing.T) {
+		result := getFile(t, &GetFileParams{Path: path, ShowContent: true, Member: "bundle/info.txt"})
+		assert.Equal(t, "crashed\nat 12:00", result.Content)
+	})
+
+	t.Run("Binary tar member", func(t *testing.T) {
+		result := getFile(t, &GetFileParams{Path: path, ShowContent: true, Member: "bundle/core", BinaryMode: "strings"})
+		assert.Empty(t, result.Content)
+		require.NotNil(t, result.Binary)
+		assert.Equal(t, []string{"core"}, result.Binary.Strings)
+	})
+
+	t.Run("Missing member", func(t *testing.T) {
+		_, _, err := GetFile(context.Background(), nil, &GetFileParams{Path: path, ShowContent: true, Member: "nope"}, testAuth)
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("Zip", func(t *testing.T) {
+		zipPath := filepath.Join(tmpDir, "logs.zip")
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create("app.log")
+		require.NoError(t, err)
+		w.Write([]byte("started\nstopped\n"))
+		require.NoError(t, zw.Close())
+		require.NoError(t, os.WriteFile(zipPath, buf.Bytes(), 0644))
+
+		result := getFile(t, &GetFileParams{Path: zipPath, ShowContent: true})
+		require.NotNil(t, result.Archive)
+		assert.Equal(t, "zip", result.Archive.Format)
+		require.Len(t, result.Archive.Members, 1)
+
+		result = getFile(t, &GetFileParams{Path: zipPath, ShowContent: true, Member: "app.log", Offset: 1})
+		assert.Equal(t, "stopped", result.Content)
+	})
+
+	t.Run("Denied members", func(t *testing.T) {
+		SetPathPolicy(&PathPolicy{Deny: DefaultDenyPatterns()})
+		backup := filepath.Join(tmpDir, "etc.tar.gz")
+		writeTarGz(t, backup, map[string]string{
+			"etc/hosts":               "127.0.0.1 localhost\n",
+			"etc/shadow":              "root:$6$secret:19000::::::\n",
+			"./etc/ssl/private/a.key": "secret\n",
+			"backup/etc/shadow":       "root:$6$secret:19000::::::\n",
+		}, []string{"etc/hosts", "etc/shadow", "./etc/ssl/private/a.key", "backup/etc/shadow"})
+
+		result := getFile(t, &GetFileParams{Path: backup, ShowContent: true})
+		require.NotNil(t, result.Archive)
+		require.Len(t, result.Archive.Members, 1)
+		assert.Equal(t, "etc/hosts", result.Archive.Members[0].Name)
+
+		for _, member := range []string{"etc/shadow", "./etc/ssl/private/a.key", "../etc/shadow", "backup/etc/shadow"} {
+			_, _, err := GetFile(context.Background(), nil, &GetFileParams{Path: backup, ShowContent: true, Member: member}, testAuth)
+			assert.ErrorContains(t, err, "denied", member)
+		}
+		result = getFile(t, &GetFileParams{Path: backup, ShowContent: true, Member: "etc/hosts"})
+		assert.Equal(t, "127.0.0.1 localhost", result.Content)
+	})
+}
@@ -0,0 +1,95 @@
+package file
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+)
+
+const (
+	defaultBinaryBytes = 4096
+	maxBinaryBytes     = 64 * 1024
+	minStringLength    = 4
+)
+
+func ValidBinaryModes() []string {
+	return []string{"none", "hexdump", "strings"}
+}
+
+// BinaryContent is returned instead of the content for binary files, as raw
+// bytes would corrupt the text channel
+type BinaryContent struct {
+	Mode      string   `json:"mode"`
+	Offset    int64    `json:"offset"`
+	BytesRead int      `json:"bytes_read"`
+	Truncated bool     `json:"truncated,omitempty"`
+	Hexdump   string   `json:"hexdump,omitempty"`
+	Strings   []string `json:"strings,omitempty"`
+}
+
+// extractStrings returns the runs of printable ASCII characters like
+// strings(1) does
+func extractStrings(data []byte, minLen int) []string {
+	result := []string{}
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		printable := i < len(data) && (data[i] >= 0x20 && data[i] < 0x7f || data[i] == '\t')
+		if printable && start < 0 {
+			start = i
+		} else if !printable && start >= 0 {
+			if i-start >= minLen {
+				result = append(result, string(data[start:i]))
+			}
+			start = -1
+		}
+	}
+	return result
+}
+
+// readBinary reads at most maxBytes from the offset of a binary file and
+// renders them as hexdump or strings
+func readBinary(ctx context.Context, f io.ReadSeeker, size int64, mode string, offset int64, maxBytes int) (*BinaryContent, error) {
+	if mode == "" {
+		mode = "none"
+	}
+	if !slices.Contains(ValidBinaryModes(), mode) {
+		return nil, fmt.Errorf("invalid binary mode %q", mode)
+	}
+	content := &BinaryContent{
+		Mode:   mode,
+		Offset: offset,
+	}
+	if mode == "none" {
+		return content, nil
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultBinaryBytes
+	}
+	if maxBytes > maxBinaryBytes {
+		maxBytes = maxBinaryBytes
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxBytes)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	cost.AddBytes(ctx, n)
+	buf = buf[:n]
+	content.BytesRead = n
+	content.Truncated = offset+int64(n) < size
+	switch mode {
+	case "hexdump":
+		content.Hexdump = strings.TrimSuffix(hex.Dump(buf), "\n")
+	case "strings":
+		content.Strings = extractStrings(buf, minStringLength)
+	}
+	return content, nil
+}
@@ -0,0 +1,63 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractStrings(t *testing.T) {
+	data := []byte("\x7fELF\x02\x01\x00/lib64/ld-linux.so\x00ab\x00GLIBC_2.34\xff")
+	assert.Equal(t, []string{"/lib64/ld-linux.so", "GLIBC_2.34"}, extractStrings(data, 4))
+}
+
+func TestGetFile_Binary(t *testing.T) {
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "binary")
+	require.NoError(t, os.WriteFile(path, []byte("\x7fELF\x00\x00\x00\x00hello world\x00"), 0755))
+
+	getFile := func(t *testing.T, params *GetFileParams) GetFileResult {
+		res, _, err := GetFile(context.Background(), nil, params, testAuth)
+		require.NoError(t, err)
+		var result GetFileResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result
+	}
+
+	t.Run("Metadata only", func(t *testing.T) {
+		result := getFile(t, &GetFileParams{Path: path, ShowContent: true})
+		assert.Empty(t, result.Content)
+		require.NotNil(t, result.Binary)
+		assert.Equal(t, "none", result.Binary.Mode)
+		assert.Zero(t, result.Binary.BytesRead)
+		assert.NotNil(t, result.Metadata)
+	})
+
+	t.Run("Hexdump", func(t *testing.T) {
+		result := getFile(t, &GetFileParams{Path: path, ShowContent: true, BinaryMode: "hexdump", MaxBytes: 8})
+		require.NotNil(t, result.Binary)
+		assert.Equal(t, 8, result.Binary.BytesRead)
+		assert.True(t, result.Binary.Truncated)
+		assert.Equal(t, "00000000  7f 45 4c 46 00 00 00 00                           |.ELF....|", result.Binary.Hexdump)
+	})
+
+	t.Run("Strings with offset", func(t *testing.T) {
+		result := getFile(t, &GetFileParams{Path: path, ShowContent: true, BinaryMode: "strings", Offset: 4})
+		require.NotNil(t, result.Binary)
+		assert.False(t, result.Binary.Truncated)
+		assert.Equal(t, []string{"hello world"}, result.Binary.Strings)
+	})
+
+	t.Run("Invalid mode", func(t *testing.T) {
+		_, _, err := GetFile(context.Background(), nil, &GetFileParams{Path: path, ShowContent: true, BinaryMode: "raw"}, testAuth)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,139 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+)
+
+// ConfigKey is a directive of a section. Directives can be given several
+// times, for list settings all values are kept and an empty assignment
+// resets the list like systemd does.
+type ConfigKey struct {
+	Value    string   `json:"value"`
+	Values   []string `json:"values,omitempty"`
+	Repeated bool     `json:"repeated,omitempty"`
+	Reset    bool     `json:"reset,omitempty"`
+	Lines    []int    `json:"lines"`
+}
+
+// ConfigSection is a [section] of an INI style file, keys before the first
+// section are put in a section with an empty name. Sections may be repeated,
+// e.g. [Address] in network files, so they aren't merged.
+type ConfigSection struct {
+	Name string                `json:"name"`
+	Line int                   `json:"line"`
+	Keys map[string]*ConfigKey `json:"keys"`
+}
+
+type ParsedConfig struct {
+	Sections []*ConfigSection `json:"sections"`
+}
+
+// parseConfig parses systemd style INI files: '#' and ';' start comments,
+// a trailing backslash continues the line and "Key=" resets the key
+func parseConfig(ctx context.Context, r io.Reader) (*ParsedConfig, error) {
+	cfg := &ParsedConfig{Sections: []*ConfigSection{}}
+	var section *ConfigSection
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	var continued string
+	startLine := 0
+	for scanner.Scan() {
+		lineNum++
+		cost.AddBytes(ctx, len(scanner.Bytes())+1)
+		line := strings.TrimSpace(scanner.Text())
+		if continued == "" {
+			startLine = lineNum
+			if line == "" || line[0] == '#' || line[0] == ';' {
+				continue
+			}
+		} else if line != "" && (line[0] == '#' || line[0] == ';') {
+			// comments within a continuation are ignored
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			continued += strings.TrimSpace(strings.TrimSuffix(line, "\\")) + " "
+			continue
+		}
+		line = continued + line
+		continued = ""
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = &ConfigSection{
+				Name: strings.TrimSpace(line[1 : len(line)-1]),
+				Line: startLine,
+				Keys: make(map[string]*ConfigKey),
+			}
+			cfg.Sections = append(cfg.Sections, section)
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing '=' in %q", startLine, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if section == nil {
+			section = &ConfigSection{Line: startLine, Keys: make(map[string]*ConfigKey)}
+			cfg.Sections = append(cfg.Sections, section)
+		}
+		entry, ok := section.Keys[key]
+		if !ok {
+			entry = &ConfigKey{}
+			section.Keys[key] = entry
+		} else {
+			entry.Repeated = true
+		}
+		entry.Value = value
+		entry.Lines = append(entry.Lines, startLine)
+		if value == "" {
+			entry.Values = nil
+			entry.Reset = true
+		} else {
+			entry.Values = append(entry.Values, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	if continued != "" {
+		return nil, fmt.Errorf("line %d: unterminated line continuation", startLine)
+	}
+	return cfg, nil
+}
+
+// ParseConfigFile parses a systemd style INI file
+func ParseConfigFile(ctx context.Context, path string) (*ParsedConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	return parseConfig(ctx, f)
+}
+
+// redact replaces the secrets in the values, the key is passed along so
+// that e.g. Password=foo is recognized
+func (c *ParsedConfig) redact() int {
+	count := 0
+	for _, section := range c.Sections {
+		for name, key := range section.Keys {
+			for i, value := range key.Values {
+				redacted, n := redact.Get().Redact(name + "=" + value)
+				key.Values[i] = strings.TrimPrefix(redacted, name+"=")
+				count += n
+			}
+			// the value is the last of the values and already counted
+			redacted, _ := redact.Get().Redact(name + "=" + key.Value)
+			key.Value = strings.TrimPrefix(redacted, name+"=")
+		}
+	}
+	return count
+}
@@ -0,0 +1,61 @@
+package file
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	unit := `# comment
+[Unit]
+Description=Test service
+After=network.target
+After=dbus.service
+
+[Service]
+; another comment
+ExecStart=/usr/bin/foo \
+  --bar
+ProtectHome=yes
+ExecStartPre=/bin/true
+ExecStartPre=
+ExecStartPre=/bin/false
+ProtectHome=read-only
+`
+	cfg, err := parseConfig(context.Background(), strings.NewReader(unit))
+	require.NoError(t, err)
+	require.Len(t, cfg.Sections, 2)
+
+	unitSection := cfg.Sections[0]
+	assert.Equal(t, "Unit", unitSection.Name)
+	assert.Equal(t, 2, unitSection.Line)
+	after := unitSection.Keys["After"]
+	assert.True(t, after.Repeated)
+	assert.Equal(t, []string{"network.target", "dbus.service"}, after.Values)
+	assert.Equal(t, []int{4, 5}, after.Lines)
+
+	service := cfg.Sections[1]
+	assert.Equal(t, "/usr/bin/foo --bar", service.Keys["ExecStart"].Value)
+	assert.Equal(t, []int{9}, service.Keys["ExecStart"].Lines)
+	assert.Equal(t, "read-only", service.Keys["ProtectHome"].Value)
+	pre := service.Keys["ExecStartPre"]
+	assert.True(t, pre.Reset)
+	assert.Equal(t, []string{"/bin/false"}, pre.Values)
+}
+
+func TestParseConfig_NoSection(t *testing.T) {
+	cfg, err := parseConfig(context.Background(), strings.NewReader("NAME=openSUSE\nID=opensuse-tumbleweed\n"))
+	require.NoError(t, err)
+	require.Len(t, cfg.Sections, 1)
+	assert.Equal(t, "", cfg.Sections[0].Name)
+	assert.Equal(t, "openSUSE", cfg.Sections[0].Keys["NAME"].Value)
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	_, err := parseConfig(context.Background(), strings.NewReader("[Unit]\nnot a directive\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
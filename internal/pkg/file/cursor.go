@@ -0,0 +1,131 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	// longer lines are cut, so that a file without newlines can't be read
+	// into memory at once
+	maxLineBytes = 64 * 1024
+	// total_lines is only counted within this many bytes after the returned
+	// lines, for bigger files it is left out
+	maxCountBytes = 16 * 1024 * 1024
+)
+
+// maximum number of content bytes returned by a single get_file call
+var maxContentBytes = 256 * 1024
+
+// SetMaxContentBytes sets the cap of the content of a single get_file
+// response, the rest is returned with the next cursor
+func SetMaxContentBytes(n int) {
+	if n > 0 {
+		maxContentBytes = n
+	}
+}
+
+// textCursor is the position after the last returned line. The inode ties
+// the cursor to the file, so that a rotated log isn't continued in the
+// middle of the new file. InKey keeps whether the position is inside of a
+// private key, whose lines are redacted up to its end.
+type textCursor struct {
+	Offset int64  `json:"o"`
+	Line   int    `json:"l"`
+	Inode  uint64 `json:"i"`
+	InKey  bool   `json:"k,omitempty"`
+}
+
+func (c textCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*textCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c textCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Offset < 0 || c.Line < 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+// ctxReader fails once the context of the call is done, so that a cancelled
+// call doesn't read a huge file to its end
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+func contextReader(ctx context.Context, r io.Reader) io.Reader {
+	return ctxReader{ctx: ctx, r: r}
+}
+
+// seekCursor moves the reader to the offset of the cursor, readers which
+// can't seek like decompressed files are read up to it
+func seekCursor(r io.Reader, c *textCursor) error {
+	if s, ok := r.(io.Seeker); ok {
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return fmt.Errorf("failed to seek: %w", err)
+		}
+		if end < c.Offset {
+			return fmt.Errorf("file was truncated since the cursor was created, start again without cursor")
+		}
+		_, err = s.Seek(c.Offset, io.SeekStart)
+		return err
+	}
+	n, err := io.CopyN(io.Discard, r, c.Offset)
+	if n < c.Offset {
+		return fmt.Errorf("file was truncated since the cursor was created, start again without cursor")
+	}
+	return err
+}
+
+// readLine returns the next line without the line break and the number of
+// bytes it took in the file. Lines longer than maxLineBytes are cut.
+func readLine(br *bufio.Reader) (line string, n int, cut bool, err error) {
+	data, err := br.ReadSlice('\n')
+	n = len(data)
+	if err == bufio.ErrBufferFull {
+		line = string(data[:min(len(data), maxLineBytes)])
+		cut = true
+		for err == bufio.ErrBufferFull {
+			data, err = br.ReadSlice('\n')
+			n += len(data)
+		}
+	} else {
+		line = string(data)
+	}
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	if !cut {
+		line = trimLineBreak(line)
+	}
+	return line, n, cut, err
+}
+
+func trimLineBreak(line string) string {
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+	}
+	return line
+}
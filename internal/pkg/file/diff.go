@@ -0,0 +1,143 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// bigger files aren't diffed
+const maxDiffSize = 1024 * 1024
+
+type DiffFileParams struct {
+	Path      string `json:"path" jsonschema:"Absolute path of the original file"`
+	OtherPath string `json:"other_path,omitempty" jsonschema:"Absolute path of the file to compare with, e.g. an override of a vendor unit"`
+	Content   string `json:"content,omitempty" jsonschema:"Content to compare the file with, e.g. a planned change. Used if other_path isn't set."`
+	Context   int    `json:"context,omitempty" jsonschema:"Number of context lines in the unified diff. Defaults to 3."`
+}
+
+type DiffFileResult struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Identical bool   `json:"identical"`
+	Diff      string `json:"diff,omitempty"`
+}
+
+func CreateDiffFileSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[DiffFileParams](nil)
+	inputSchema.Properties["context"].Default = json.RawMessage(`3`)
+	return inputSchema
+}
+
+// reads a text file which may be diffed
+func readDiffable(ctx context.Context, path string) (string, error) {
+	if err := GetPathPolicy().Check(path); err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	if info.Size() > maxDiffSize {
+		return "", fmt.Errorf("%s is bigger than %d bytes", path, maxDiffSize)
+	}
+	if isBinary(f) {
+		return "", fmt.Errorf("%s is a binary file", path)
+	}
+	content, err := io.ReadAll(io.LimitReader(contextReader(ctx, f), maxDiffSize))
+	cost.AddBytes(ctx, len(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return string(content), nil
+}
+
+// ReadText reads a text file with the path policy and the redaction of the
+// file tools, for callers which need the plain content
+func ReadText(ctx context.Context, path string) (string, error) {
+	content, err := readDiffable(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return redact.String(content), nil
+}
+
+// diffs two files, or a file against the given content, and returns a
+// unified diff
+func DiffFile(ctx context.Context, req *mcp.CallToolRequest, params *DiffFileParams, authKeeper auth.AuthKeeper) (*mcp.CallToolResult, any, error) {
+	if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if params.OtherPath != "" && params.Content != "" {
+		return nil, nil, fmt.Errorf("other_path and content can't be used together")
+	}
+	contextLines := params.Context
+	if contextLines <= 0 {
+		contextLines = 3
+	}
+
+	from, err := readDiffable(ctx, params.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := &DiffFileResult{
+		From: params.Path,
+		To:   "content",
+	}
+	to := params.Content
+	if params.OtherPath != "" {
+		result.To = params.OtherPath
+		if to, err = readDiffable(ctx, params.OtherPath); err != nil {
+			return nil, nil, err
+		}
+	} else if len(to) > maxDiffSize {
+		return nil, nil, fmt.Errorf("content is bigger than %d bytes", maxDiffSize)
+	}
+
+	result.Identical = from == to
+	if !result.Identical {
+		result.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(from),
+			B:        difflib.SplitLines(to),
+			FromFile: result.From,
+			ToFile:   result.To,
+			Context:  contextLines,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create diff: %w", err)
+		}
+		result.Diff = redact.String(result.Diff)
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
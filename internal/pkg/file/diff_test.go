@@ -0,0 +1,74 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+
+	vendor := filepath.Join(tmpDir, "foo.service")
+	require.NoError(t, os.WriteFile(vendor, []byte("[Service]\nExecStart=/usr/bin/foo\nRestart=no\n"), 0644))
+	override := filepath.Join(tmpDir, "override.service")
+	require.NoError(t, os.WriteFile(override, []byte("[Service]\nExecStart=/usr/bin/foo\nRestart=always\n"), 0644))
+
+	diff := func(t *testing.T, params *DiffFileParams) DiffFileResult {
+		res, _, err := DiffFile(context.Background(), nil, params, testAuth)
+		require.NoError(t, err)
+		var result DiffFileResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result
+	}
+
+	t.Run("Two files", func(t *testing.T) {
+		result := diff(t, &DiffFileParams{Path: vendor, OtherPath: override})
+		assert.False(t, result.Identical)
+		assert.Contains(t, result.Diff, "--- "+vendor)
+		assert.Contains(t, result.Diff, "+++ "+override)
+		assert.Contains(t, result.Diff, "-Restart=no\n+Restart=always\n")
+	})
+
+	t.Run("File against content", func(t *testing.T) {
+		result := diff(t, &DiffFileParams{Path: vendor, Content: "[Service]\nExecStart=/usr/bin/foo\nRestart=no\n"})
+		assert.True(t, result.Identical)
+		assert.Empty(t, result.Diff)
+	})
+
+	t.Run("Binary file", func(t *testing.T) {
+		binary := filepath.Join(tmpDir, "binary")
+		require.NoError(t, os.WriteFile(binary, []byte("ELF\x00\x01"), 0644))
+		_, _, err := DiffFile(context.Background(), nil, &DiffFileParams{Path: binary, Content: "x"}, testAuth)
+		assert.ErrorContains(t, err, "binary")
+	})
+
+	t.Run("Cancelled read", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := ReadText(ctx, vendor)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Read text", func(t *testing.T) {
+		content, err := ReadText(context.Background(), vendor)
+		require.NoError(t, err)
+		assert.Equal(t, "[Service]\nExecStart=/usr/bin/foo\nRestart=no\n", content)
+		_, err = ReadText(context.Background(), filepath.Join(tmpDir, "binary"))
+		assert.ErrorContains(t, err, "binary")
+	})
+
+	t.Run("Path and content", func(t *testing.T) {
+		_, _, err := DiffFile(context.Background(), nil, &DiffFileParams{Path: vendor, OtherPath: override, Content: "x"}, testAuth)
+		assert.Error(t, err)
+	})
+}
@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
@@ -19,31 +22,69 @@ import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
+const maxGlobFiles = 200
+
 type GetFileParams struct {
-	Path        string `json:"path" jsonschema:"Absolute path to the file"`
+	Path        string `json:"path" jsonschema:"Absolute path to the file. May be a glob (e.g. /etc/systemd/system/*.service.d/*.conf) to read multiple files at once."`
 	ShowContent bool   `json:"show_content,omitempty" jsonschema:"Whether to show file content. Defaults to false."`
-	Offset      int    `json:"offset,omitempty" jsonschema:"Line offset for pagination. Defaults to 0."`
-	Limit       int    `json:"limit,omitempty" jsonschema:"Line limit for pagination. Defaults to 1000."`
+	Offset      int    `json:"offset,omitempty" jsonschema:"Line offset for pagination, byte offset for binary files. Defaults to 0."`
+	Cursor      string `json:"cursor,omitempty" jsonschema:"Cursor from next_cursor of the previous call. Reading continues after the last returned line without reading the file from the start again, offset is ignored."`
+	Limit       int    `json:"limit,omitempty" jsonschema:"Line limit for pagination. Defaults to 1000. For a glob the limit applies to every single file."`
+	MaxFiles    int    `json:"max_files,omitempty" jsonschema:"Maximum number of files returned for a glob. Defaults to 50."`
+	BinaryMode  string `json:"binary_mode,omitempty" jsonschema:"How to show the content of binary files: 'none' returns only the metadata, 'hexdump' a canonical hex dump and 'strings' the printable strings. Defaults to 'none'."`
+	MaxBytes    int    `json:"max_bytes,omitempty" jsonschema:"Maximum number of bytes of a binary file to show, starting at offset bytes. Defaults to 4096, maximum is 65536."`
+	Member      string `json:"member,omitempty" jsonschema:"Member of a tar or zip archive to show. Without a member the members of the archive are listed."`
+	ParseConfig bool   `json:"parse_config,omitempty" jsonschema:"Parse an INI style file (unit files, journald.conf, logind.conf, ...) into sections and keys, including repeated and reset directives. Defaults to false."`
+	Checksum    bool   `json:"checksum,omitempty" jsonschema:"Return the SHA-256 of a regular file of up to 256MiB. Not computed for the pages read with a cursor. Defaults to false."`
+	// not following is the default, so that the target of a link is shown
+	// instead of silently reading another file
+	FollowSymlinks bool `json:"follow_symlinks,omitempty" jsonschema:"Read the target if the path is a symlink. Otherwise the metadata of the link with its target and resolved real path is returned. Defaults to false."`
 }
 
 type FileMetadata struct {
-	Name    string `json:"name"`
-	Size    int64  `json:"size"`
-	Mode    string `json:"mode"`
-	Owner   string `json:"owner"`
-	Group   string `json:"group"`
-	ModTime string `json:"mod_time"`
-	ACLs    string `json:"acls,omitempty"`
-	IsDir   bool   `json:"is_dir"`
+	Name          string            `json:"name"`
+	Size          int64             `json:"size"`
+	Mode          string            `json:"mode"`
+	Owner         string            `json:"owner"`
+	Group         string            `json:"group"`
+	Uid           uint32            `json:"uid"`
+	Gid           uint32            `json:"gid"`
+	ModTime       string            `json:"mod_time"`
+	ACLs          string            `json:"acls,omitempty"`
+	IsDir         bool              `json:"is_dir"`
+	SecurityLabel string            `json:"security_label,omitempty"`
+	Xattrs        map[string]string `json:"xattrs,omitempty"`
+	Immutable     bool              `json:"immutable,omitempty"`
+	AppendOnly    bool              `json:"append_only,omitempty"`
+	SHA256        string            `json:"sha256,omitempty"`
+	Inode         uint64            `json:"inode,omitempty"`
+	SymlinkTarget string            `json:"symlink_target,omitempty"`
+	RealPath      string            `json:"real_path,omitempty"`
 }
 
 type GetFileResult struct {
-	Metadata   *FileMetadata  `json:"metadata"`
+	Path       string         `json:"path,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Metadata   *FileMetadata  `json:"metadata,omitempty"`
 	Entries    []FileMetadata `json:"entries,omitempty"`
 	Content    string         `json:"content,omitempty"`
 	TotalLines int            `json:"total_lines,omitempty"`
 	Offset     int            `json:"offset,omitempty"`
 	Limit      int            `json:"limit,omitempty"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	CutLines   int            `json:"cut_lines,omitempty"`
+	Config     *ParsedConfig  `json:"config,omitempty"`
+	Binary     *BinaryContent `json:"binary,omitempty"`
+	Archive    *ArchiveInfo   `json:"archive,omitempty"`
+	Redacted   int            `json:"redacted,omitempty"`
+	Hint       string         `json:"hint,omitempty"`
+}
+
+type GetFilesResult struct {
+	Pattern      string          `json:"pattern"`
+	TotalMatches int             `json:"total_matches"`
+	Truncated    bool            `json:"truncated,omitempty"`
+	Files        []GetFileResult `json:"files"`
 }
 
 func CreateFileSchema() *jsonschema.Schema {
@@ -51,10 +92,23 @@ func CreateFileSchema() *jsonschema.Schema {
 	inputSchema.Properties["limit"].Default = json.RawMessage(`1000`)
 	inputSchema.Properties["offset"].Default = json.RawMessage(`0`)
 	inputSchema.Properties["show_content"].Default = json.RawMessage(`false`)
+	inputSchema.Properties["max_files"].Default = json.RawMessage(`50`)
+	inputSchema.Properties["parse_config"].Default = json.RawMessage(`false`)
+	inputSchema.Properties["follow_symlinks"].Default = json.RawMessage(`false`)
+	var binaryModes []any
+	for _, m := range ValidBinaryModes() {
+		binaryModes = append(binaryModes, m)
+	}
+	inputSchema.Properties["binary_mode"].Enum = binaryModes
+	inputSchema.Properties["binary_mode"].Default = json.RawMessage(`"none"`)
+	inputSchema.Properties["max_bytes"].Default = json.RawMessage(`4096`)
 	return inputSchema
 }
 
-func getFileMetadata(ctx context.Context, path string, info os.FileInfo, fetchACLs bool) *FileMetadata {
+// get the metadata of a file, the detailed metadata contains also the ACLs,
+// the security context and the path with all symlinks resolved. Reading
+// the whole file for the checksum is only done if it's asked for.
+func getFileMetadata(ctx context.Context, path string, info os.FileInfo, detailed, checksum bool) *FileMetadata {
 	metadata := &FileMetadata{
 		Name:    info.Name(),
 		Size:    info.Size(),
@@ -62,10 +116,16 @@ func getFileMetadata(ctx context.Context, path string, info os.FileInfo, fetchAC
 		ModTime: info.ModTime().Format(time.RFC3339),
 		IsDir:   info.IsDir(),
 	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		metadata.SymlinkTarget, _ = os.Readlink(path)
+	}
 
 	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
 		uid := strconv.FormatUint(uint64(stat.Uid), 10)
 		gid := strconv.FormatUint(uint64(stat.Gid), 10)
+		metadata.Uid = stat.Uid
+		metadata.Gid = stat.Gid
+		metadata.Inode = stat.Ino
 
 		u, err := user.LookupId(uid)
 		if err == nil {
@@ -82,40 +142,56 @@ func getFileMetadata(ctx context.Context, path string, info os.FileInfo, fetchAC
 		}
 	}
 
-	if fetchACLs {
+	if detailed {
 		// Try to get ACLs
 		cmd := exec.CommandContext(ctx, "getfacl", "-p", "--", path)
 		out, err := cmd.Output()
 		if err == nil {
 			metadata.ACLs = string(out)
 		}
+		addSecurityMetadata(ctx, path, info, metadata, checksum)
+		if resolved, err := filepath.EvalSymlinks(path); err == nil && resolved != filepath.Clean(path) {
+			metadata.RealPath = resolved
+		}
 	}
 
 	return metadata
 }
 
-// reads a file with the privileges of the systemd service
-func GetFile(ctx context.Context, req *mcp.CallToolRequest, params *GetFileParams, authKeeper auth.AuthKeeper) (*mcp.CallToolResult, any, error) {
-	if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
-		return nil, nil, err
-	} else if !allowed {
-		return nil, nil, fmt.Errorf("calling method was canceled by user")
+// reads a single file or directory for GetFile
+func readPath(ctx context.Context, path string, params *GetFileParams) (*GetFileResult, error) {
+	if err := GetPathPolicy().Check(path); err != nil {
+		return nil, err
 	}
-	info, err := os.Stat(params.Path)
+	info, err := os.Lstat(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	isLink := info.Mode()&os.ModeSymlink != 0
+	if isLink && params.FollowSymlinks {
+		if info, err = os.Stat(path); err != nil {
+			return nil, fmt.Errorf("failed to stat symlink target: %w", err)
+		}
 	}
 
-	metadata := getFileMetadata(ctx, params.Path, info, true)
+	// a continuation page would hash the whole file again for every page
+	metadata := getFileMetadata(ctx, path, info, true, params.Checksum && params.Cursor == "")
 
 	result := &GetFileResult{
 		Metadata: metadata,
 	}
+	if isLink && !params.FollowSymlinks {
+		result.Hint = fmt.Sprintf("%s is a symlink to %s, set follow_symlinks to read the target", path, metadata.SymlinkTarget)
+		if metadata.RealPath == "" {
+			result.Hint = fmt.Sprintf("%s is a dangling symlink to %s", path, metadata.SymlinkTarget)
+		}
+		return result, nil
+	}
 
 	if info.IsDir() {
-		entries, err := os.ReadDir(params.Path)
+		entries, err := os.ReadDir(path)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read directory: %w", err)
+			return nil, fmt.Errorf("failed to read directory: %w", err)
 		}
 
 		var fileEntries []FileMetadata
@@ -124,54 +200,223 @@ func GetFile(ctx context.Context, req *mcp.CallToolRequest, params *GetFileParam
 			if err != nil {
 				continue
 			}
-			meta := getFileMetadata(ctx, filepath.Join(params.Path, entry.Name()), entryInfo, false)
+			meta := getFileMetadata(ctx, filepath.Join(path, entry.Name()), entryInfo, false, false)
 			fileEntries = append(fileEntries, *meta)
 		}
 		result.Entries = fileEntries
 	} else if params.ShowContent {
-		f, err := os.Open(params.Path)
+		f, err := os.Open(path)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to open file: %w", err)
+			return nil, fmt.Errorf("failed to open file: %w", err)
 		}
 		defer f.Close()
 
-		limit := params.Limit
-		if limit <= 0 {
-			limit = 1000
+		if format := detectArchive(f); format != "" {
+			result.Archive, err = readArchive(ctx, f, info.Size(), format, params, result)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
 		}
+		if isBinary(f) {
+			result.Binary, err = readBinary(ctx, f, info.Size(), params.BinaryMode, int64(params.Offset), params.MaxBytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read binary file: %w", err)
+			}
+			result.Redacted = redact.Strings(result.Binary.Strings)
+			return result, nil
+		}
+		if err := readText(ctx, f, params, result); err != nil {
+			return nil, err
+		}
+	}
+	if !info.IsDir() && params.ParseConfig {
+		config, err := ParseConfigFile(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+		result.Redacted += config.redact()
+		result.Config = config
+	}
+	return result, nil
+}
 
-		// Count lines or read with limit
-		// Since we need to paginate, we might need to scan through lines.
-		// For huge files, this is inefficient, but simple for now.
-		// An optimization would be to seek if lines are fixed width, but they aren't.
-
-		var lines []string
-		scanner := bufio.NewScanner(f)
-		lineCount := 0
-		linesRead := 0
+// reads the lines of a text with pagination into the result. Only the
+// returned lines are kept in memory and a cursor continues at the byte
+// offset of the next line, so that huge logs can be walked without reading
+// them again for every page.
+func readText(ctx context.Context, r io.Reader, params *GetFileParams, result *GetFileResult) error {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	cur := &textCursor{}
+	if result.Metadata != nil {
+		cur.Inode = result.Metadata.Inode
+	}
+	if params.Cursor != "" {
+		var err error
+		if cur, err = decodeCursor(params.Cursor); err != nil {
+			return err
+		}
+		if result.Metadata != nil && cur.Inode != result.Metadata.Inode {
+			return fmt.Errorf("file was replaced since the cursor was created, e.g. by a log rotation, start again without cursor")
+		}
+		if err := seekCursor(r, cur); err != nil {
+			return err
+		}
+	}
+	br := bufio.NewReaderSize(contextReader(ctx, r), maxLineBytes)
+	// the lines are redacted one by one, a page may start within a key
+	redactor := redact.Lines()
+	redactor.InKey = cur.InKey
 
-		// If offset is huge, this is slow.
-		// But usually we just read config files.
-		for scanner.Scan() {
-			if lineCount >= params.Offset && linesRead < limit {
-				lines = append(lines, scanner.Text())
-				linesRead++
+	var lines []string
+	size := 0
+	var err error
+	for err == nil {
+		if params.Cursor == "" && cur.Line < params.Offset {
+			// lines before the offset are skipped without keeping them
+			line, n, _, lerr := readLine(br)
+			cost.AddBytes(ctx, n)
+			if err = lerr; err == nil {
+				redactor.Skip(line)
+				cur.Offset += int64(n)
+				cur.Line++
 			}
-			lineCount++
+			continue
+		}
+		if len(lines) >= limit || (len(lines) > 0 && size >= maxContentBytes) {
+			break
+		}
+		line, n, cut, lerr := readLine(br)
+		cost.AddBytes(ctx, n)
+		if err = lerr; err != nil {
+			break
 		}
+		if cut {
+			result.CutLines++
+		}
+		size += len(line) + 1
+		line, redacted := redactor.Redact(line)
+		result.Redacted += redacted
+		lines = append(lines, line)
+		cur.Offset += int64(n)
+		cur.Line++
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+	result.Offset = cur.Line - len(lines)
+	result.Limit = limit
+	cur.InKey = redactor.InKey
 
-		if err := scanner.Err(); err != nil {
-			// Handle token too long or other errors?
-			// For now just return what we have or error.
-			if err != bufio.ErrTooLong {
-				return nil, nil, fmt.Errorf("error reading file: %w", err)
+	if err == nil {
+		// count the remaining lines for total_lines within a bounded read,
+		// the cursor is only returned if there are lines left
+		remaining := 0
+		counted := 0
+		for counted < maxCountBytes {
+			_, n, _, lerr := readLine(br)
+			if lerr != nil {
+				err = lerr
+				break
 			}
+			cost.AddBytes(ctx, n)
+			counted += n
+			remaining++
+		}
+		if remaining > 0 {
+			result.NextCursor = cur.encode()
+		}
+		if err == io.EOF {
+			result.TotalLines = cur.Line + remaining
+		} else if err != nil {
+			return fmt.Errorf("error reading file: %w", err)
 		}
+	} else {
+		result.TotalLines = cur.Line
+	}
+	result.Content = strings.Join(lines, "\n")
+	return nil
+}
+
+// isGlob reports whether the path contains shell glob meta characters
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
 
-		result.Content = strings.Join(lines, "\n")
-		result.TotalLines = lineCount
-		result.Offset = params.Offset
-		result.Limit = limit
+// reads all files matching a glob, the offset and limit apply to every
+// single file
+func readGlob(ctx context.Context, params *GetFileParams) (*GetFilesResult, error) {
+	globbed, err := filepath.Glob(params.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern: %w", err)
+	}
+	// denied matches are dropped silently, so that the result doesn't tell
+	// which denied files exist
+	var matches []string
+	for _, match := range globbed {
+		if GetPathPolicy().Check(match) == nil {
+			matches = append(matches, match)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %s", params.Path)
+	}
+	maxFiles := params.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = 50
+	}
+	if maxFiles > maxGlobFiles {
+		maxFiles = maxGlobFiles
+	}
+	result := &GetFilesResult{
+		Pattern:      params.Path,
+		TotalMatches: len(matches),
+		Files:        []GetFileResult{},
+	}
+	for _, match := range matches {
+		if len(result.Files) >= maxFiles {
+			result.Truncated = true
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fileRes, err := readPath(ctx, match, params)
+		if err != nil {
+			result.Files = append(result.Files, GetFileResult{
+				Path:  match,
+				Error: err.Error(),
+			})
+			continue
+		}
+		fileRes.Path = match
+		result.Files = append(result.Files, *fileRes)
+	}
+	return result, nil
+}
+
+// reads a file with the privileges of the systemd service
+func GetFile(ctx context.Context, req *mcp.CallToolRequest, params *GetFileParams, authKeeper auth.AuthKeeper) (*mcp.CallToolResult, any, error) {
+	if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	var result any
+	var err error
+	if isGlob(params.Path) {
+		if params.Cursor != "" {
+			return nil, nil, fmt.Errorf("a cursor can't be used with a glob")
+		}
+		result, err = readGlob(ctx, params)
+	} else {
+		result, err = readPath(ctx, params.Path, params)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
 
 	jsonBytes, err := json.Marshal(result)
@@ -0,0 +1,285 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+)
+
+const (
+	maxFollowTimeout = 300
+	maxFollowLines   = 10000
+)
+
+type FollowFileParams struct {
+	Path     string `json:"path" jsonschema:"Absolute path to the plain text file to follow"`
+	Timeout  uint   `json:"timeout,omitempty" jsonschema:"Seconds to follow the file. Defaults to 30, maximum is 300."`
+	MaxLines int    `json:"max_lines,omitempty" jsonschema:"Stop following after this many lines. Defaults to 1000."`
+}
+
+type FollowFileResult struct {
+	Path      string   `json:"path"`
+	Lines     []string `json:"lines"`
+	Truncated bool     `json:"truncated,omitempty"`
+	CutLines  int      `json:"cut_lines,omitempty"`
+	Reason    string   `json:"reason"`
+}
+
+func CreateFollowFileSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[FollowFileParams](nil)
+	inputSchema.Properties["timeout"].Default = json.RawMessage(`30`)
+	inputSchema.Properties["max_lines"].Default = json.RawMessage(`1000`)
+	return inputSchema
+}
+
+type inotifyEvent struct {
+	Wd   int32
+	Mask uint32
+	Name string
+}
+
+// readInotify sends the events of the inotify instance to the returned
+// channel, the instance is closed when the context is done
+func readInotify(ctx context.Context, fd int) <-chan inotifyEvent {
+	// wrapping the non blocking fd makes the reads interruptible
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	events := make(chan inotifyEvent)
+	go func() {
+		<-ctx.Done()
+		inotify.Close()
+	}()
+	go func() {
+		defer close(events)
+		buf := make([]byte, 4096)
+		for {
+			n, err := inotify.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				event := inotifyEvent{Wd: raw.Wd, Mask: raw.Mask}
+				nameStart := offset + syscall.SizeofInotifyEvent
+				if raw.Len > 0 && nameStart+int(raw.Len) <= n {
+					event.Name = strings.TrimRight(string(buf[nameStart:nameStart+int(raw.Len)]), "\x00")
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+				offset = nameStart + int(raw.Len)
+			}
+		}
+	}()
+	return events
+}
+
+// watchFile returns a channel which gets a value for every inotify event
+// on the given path. The watch is removed when the context is done.
+func watchFile(ctx context.Context, path string) (<-chan uint32, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init inotify: %w", err)
+	}
+	_, err = syscall.InotifyAddWatch(fd, path, syscall.IN_MODIFY|syscall.IN_ATTRIB|syscall.IN_MOVE_SELF|syscall.IN_DELETE_SELF)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+	events := make(chan uint32)
+	go func() {
+		defer close(events)
+		for event := range readInotify(ctx, fd) {
+			select {
+			case events <- event.Mask:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// notifies the client about a new line, as progress notification if the
+// client asked for progress and as log message otherwise
+func notifyLine(ctx context.Context, req *mcp.CallToolRequest, path, line string, count int) {
+	if req == nil || req.Session == nil {
+		return
+	}
+	var err error
+	if token := req.Params.GetProgressToken(); token != nil {
+		err = req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: token,
+			Progress:      float64(count),
+			Message:       line,
+		})
+	} else {
+		err = req.Session.Log(ctx, &mcp.LoggingMessageParams{
+			Level:  "info",
+			Logger: "follow_file",
+			Data: map[string]string{
+				"path": path,
+				"line": line,
+			},
+		})
+	}
+	if err != nil {
+		slog.DebugContext(ctx, "couldn't send notification", "path", path, "error", err)
+	}
+}
+
+// follows a file like tail -f and sends the appended lines as notifications
+func FollowFile(ctx context.Context, req *mcp.CallToolRequest, params *FollowFileParams, authKeeper auth.AuthKeeper) (*mcp.CallToolResult, any, error) {
+	if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	timeout := params.Timeout
+	if timeout == 0 {
+		timeout = 30
+	}
+	if timeout > maxFollowTimeout {
+		return nil, nil, fmt.Errorf("not following longer than %d seconds", maxFollowTimeout)
+	}
+	maxLines := params.MaxLines
+	if maxLines <= 0 {
+		maxLines = 1000
+	}
+	if maxLines > maxFollowLines {
+		maxLines = maxFollowLines
+	}
+
+	if err := GetPathPolicy().Check(params.Path); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(params.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%s is not a regular file", params.Path)
+	}
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to seek to end: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	events, err := watchFile(ctx, params.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &FollowFileResult{
+		Path:  params.Path,
+		Lines: []string{},
+	}
+	// the appended data is read line by line, only the first maxLineBytes
+	// of a line are kept while it is still written
+	br := bufio.NewReaderSize(contextReader(ctx, f), maxLineBytes)
+	var partial []byte
+	cut := false
+	redactor := redact.Lines()
+	readAppended := func() bool {
+		if info, err := f.Stat(); err == nil && info.Size() < offset {
+			// file was truncated, start from the beginning
+			offset, _ = f.Seek(0, io.SeekStart)
+			br.Reset(contextReader(ctx, f))
+			partial, cut = partial[:0], false
+			redactor.InKey = false
+		}
+		for ctx.Err() == nil {
+			data, err := br.ReadSlice('\n')
+			offset += int64(len(data))
+			cost.AddBytes(ctx, len(data))
+			if room := maxLineBytes - len(partial); len(data) > room {
+				partial = append(partial, data[:room]...)
+				cut = true
+			} else {
+				partial = append(partial, data...)
+			}
+			if err == bufio.ErrBufferFull {
+				continue
+			} else if err != nil {
+				// an unterminated line is completed by the next write
+				return true
+			}
+			line := string(partial)
+			if cut {
+				result.CutLines++
+			} else {
+				line = trimLineBreak(line)
+			}
+			partial, cut = partial[:0], false
+			line, _ = redactor.Redact(line)
+			result.Lines = append(result.Lines, line)
+			notifyLine(ctx, req, params.Path, line, len(result.Lines))
+			if len(result.Lines) >= maxLines {
+				result.Truncated = true
+				return false
+			}
+		}
+		return true
+	}
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				result.Reason = "timeout"
+			} else {
+				result.Reason = "cancelled"
+			}
+			break loop
+		case mask, ok := <-events:
+			if !ok {
+				result.Reason = "watch closed"
+				break loop
+			}
+			if !readAppended() {
+				result.Reason = "max lines reached"
+				break loop
+			}
+			if mask&(syscall.IN_MOVE_SELF|syscall.IN_DELETE_SELF) != 0 {
+				result.Reason = "file was moved or deleted"
+				break loop
+			}
+		}
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
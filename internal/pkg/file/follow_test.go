@@ -0,0 +1,83 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowFile(t *testing.T) {
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("old line\n"), 0644))
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		f.WriteString("first\nsec")
+		f.Sync()
+		time.Sleep(50 * time.Millisecond)
+		f.WriteString("ond\nthird\n")
+	}()
+
+	res, _, err := FollowFile(context.Background(), nil, &FollowFileParams{Path: logPath, Timeout: 5, MaxLines: 2}, testAuth)
+	require.NoError(t, err)
+	var result FollowFileResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	assert.Equal(t, []string{"first", "second"}, result.Lines)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, "max lines reached", result.Reason)
+}
+
+func TestFollowFileLongLine(t *testing.T) {
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(logPath, nil, 0644))
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		// the long line is written in pieces, only its start is kept
+		for i := 0; i < 4; i++ {
+			f.WriteString(strings.Repeat("x", maxLineBytes/2))
+			f.Sync()
+			time.Sleep(20 * time.Millisecond)
+		}
+		f.WriteString("\nnext\n")
+	}()
+
+	res, _, err := FollowFile(context.Background(), nil, &FollowFileParams{Path: logPath, Timeout: 5, MaxLines: 2}, testAuth)
+	require.NoError(t, err)
+	var result FollowFileResult
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+	require.Len(t, result.Lines, 2)
+	assert.Len(t, result.Lines[0], maxLineBytes)
+	assert.Equal(t, "next", result.Lines[1])
+	assert.Equal(t, 1, result.CutLines)
+}
+
+func TestFollowFileTimeoutLimit(t *testing.T) {
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+	_, _, err = FollowFile(context.Background(), nil, &FollowFileParams{Path: "/etc/hostname", Timeout: maxFollowTimeout + 1}, testAuth)
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// from linux/fs.h
+	fsIocGetFlags = 0x80086601
+	fsImmutableFl = 0x00000010
+	fsAppendFl    = 0x00000020
+
+	// files bigger than this don't get a checksum
+	maxChecksumSize = 256 * 1024 * 1024
+)
+
+// xattrs which carry the label of a linux security module
+var securityLabelXattrs = []string{"security.selinux", "security.apparmor", "security.SMACK64"}
+
+// readXattrs returns all readable extended attributes of a path. Values
+// which aren't printable are hex encoded like getfattr -e hex does. Unless
+// follow is set the attributes of a symlink itself are read.
+func readXattrs(path string, follow bool) map[string]string {
+	list, get := unix.Llistxattr, unix.Lgetxattr
+	if follow {
+		list, get = unix.Listxattr, unix.Getxattr
+	}
+	size, err := list(path, nil)
+	if err != nil || size <= 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	size, err = list(path, buf)
+	if err != nil {
+		return nil
+	}
+	xattrs := make(map[string]string)
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		vsize, err := get(path, name, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, vsize)
+		if vsize > 0 {
+			vsize, err = get(path, name, value)
+			if err != nil {
+				continue
+			}
+			value = value[:vsize]
+		}
+		xattrs[name] = xattrString(value)
+	}
+	return xattrs
+}
+
+func xattrString(value []byte) string {
+	value = bytes.TrimSuffix(value, []byte{0})
+	if !utf8.Valid(value) {
+		return "0x" + hex.EncodeToString(value)
+	}
+	for _, r := range string(value) {
+		if r < 0x20 && r != '\t' {
+			return "0x" + hex.EncodeToString(value)
+		}
+	}
+	return string(value)
+}
+
+// readInodeFlags reads the immutable and append only flags like lsattr
+func readInodeFlags(path string) (immutable, appendOnly bool, ok bool) {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return false, false, false
+	}
+	defer f.Close()
+	var flags int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocGetFlags, uintptr(unsafe.Pointer(&flags)))
+	if errno != 0 {
+		return false, false, false
+	}
+	return flags&fsImmutableFl != 0, flags&fsAppendFl != 0, true
+}
+
+func sha256File(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, contextReader(ctx, f))
+	cost.AddBytes(ctx, int(n))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// adds the security context, the extended attributes, the inode flags and
+// if asked for the checksum to the metadata
+func addSecurityMetadata(ctx context.Context, path string, info os.FileInfo, metadata *FileMetadata, checksum bool) {
+	// the info of a symlink which isn't followed is the one of the link
+	metadata.Xattrs = readXattrs(path, info.Mode()&os.ModeSymlink == 0)
+	for _, name := range securityLabelXattrs {
+		if label, ok := metadata.Xattrs[name]; ok {
+			metadata.SecurityLabel = label
+			break
+		}
+	}
+	if info.Mode().IsRegular() || info.IsDir() {
+		if immutable, appendOnly, ok := readInodeFlags(path); ok {
+			metadata.Immutable = immutable
+			metadata.AppendOnly = appendOnly
+		}
+	}
+	if checksum && info.Mode().IsRegular() && info.Size() <= maxChecksumSize {
+		if sum, err := sha256File(ctx, path); err == nil {
+			metadata.SHA256 = sum
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+)
+
+// files bigger than this aren't patched
+const maxPatchFileSize = 4 * 1024 * 1024
+
+type ApplyPatchParams struct {
+	Path     string `json:"path" jsonschema:"Absolute path of the file to patch"`
+	Patch    string `json:"patch" jsonschema:"Unified diff for the file, e.g. as returned by diff_file. The file names in the ---/+++ lines are ignored."`
+	DryRun   bool   `json:"dry_run,omitempty" jsonschema:"Only check whether the patch applies and report conflicts, the file isn't changed. Defaults to false."`
+	NoBackup bool   `json:"no_backup,omitempty" jsonschema:"Don't keep a copy of the original file as <path>.<time>.bak. Defaults to false."`
+}
+
+type HunkResult struct {
+	Hunk      int      `json:"hunk"`
+	OldStart  int      `json:"old_start"`
+	AppliedAt int      `json:"applied_at,omitempty"`
+	Offset    int      `json:"offset,omitempty"`
+	Conflict  bool     `json:"conflict,omitempty"`
+	Expected  []string `json:"expected,omitempty"`
+	Found     []string `json:"found,omitempty"`
+}
+
+type ApplyPatchResult struct {
+	Path    string       `json:"path"`
+	DryRun  bool         `json:"dry_run,omitempty"`
+	Applied bool         `json:"applied"`
+	Backup  string       `json:"backup,omitempty"`
+	Hunks   []HunkResult `json:"hunks"`
+}
+
+func CreateApplyPatchSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ApplyPatchParams](nil)
+	inputSchema.Properties["dry_run"].Default = json.RawMessage(`false`)
+	inputSchema.Properties["no_backup"].Default = json.RawMessage(`false`)
+	return inputSchema
+}
+
+type hunk struct {
+	oldStart int
+	oldLines []string // context and removed lines
+	newLines []string // context and added lines
+	// the last line of the old or new side has no newline
+	oldNoEOL, newNoEOL bool
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parsePatch parses the hunks of a unified diff for a single file, the line
+// counts of the hunk headers tell where a hunk ends
+func parsePatch(patch string) ([]*hunk, error) {
+	var hunks []*hunk
+	var cur *hunk
+	var oldLeft, newLeft int
+	var lastSide byte
+	files := 0
+	for i, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		if cur != nil && strings.HasPrefix(line, `\`) {
+			// "\ No newline at end of file" refers to the previous line
+			if lastSide != '+' {
+				cur.oldNoEOL = true
+			}
+			if lastSide != '-' {
+				cur.newNoEOL = true
+			}
+			continue
+		}
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case line == "" || line[0] == ' ':
+				text := strings.TrimPrefix(line, " ")
+				cur.oldLines = append(cur.oldLines, text)
+				cur.newLines = append(cur.newLines, text)
+				oldLeft--
+				newLeft--
+			case line[0] == '-':
+				cur.oldLines = append(cur.oldLines, line[1:])
+				oldLeft--
+			case line[0] == '+':
+				cur.newLines = append(cur.newLines, line[1:])
+				newLeft--
+			default:
+				return nil, fmt.Errorf("line %d: unexpected line %q in hunk", i+1, line)
+			}
+			if oldLeft < 0 || newLeft < 0 {
+				return nil, fmt.Errorf("line %d: hunk is longer than its header says", i+1)
+			}
+			lastSide = ' '
+			if line != "" {
+				lastSide = line[0]
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			files++
+			if files > 1 {
+				return nil, fmt.Errorf("line %d: patch contains more than one file", i+1)
+			}
+		case strings.HasPrefix(line, "@@"):
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: invalid hunk header %q", i+1, line)
+			}
+			cur = &hunk{}
+			cur.oldStart, _ = strconv.Atoi(m[1])
+			oldLeft, newLeft = 1, 1
+			if m[2] != "" {
+				oldLeft, _ = strconv.Atoi(m[2])
+			}
+			if m[4] != "" {
+				newLeft, _ = strconv.Atoi(m[4])
+			}
+			hunks = append(hunks, cur)
+		}
+		// other lines like "diff -u", "Index:" or "+++" are ignored
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, fmt.Errorf("last hunk is incomplete")
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no hunks")
+	}
+	return hunks, nil
+}
+
+func linesMatch(lines []string, pos int, expected []string) bool {
+	if pos < 0 || pos+len(expected) > len(lines) {
+		return false
+	}
+	for i, l := range expected {
+		if lines[pos+i] != l {
+			return false
+		}
+	}
+	return true
+}
+
+// findHunk returns the position nearest to the expected one at which the
+// old lines of the hunk match, or -1
+func findHunk(lines []string, expected int, old []string) int {
+	for delta := 0; delta <= len(lines); delta++ {
+		if linesMatch(lines, expected+delta, old) {
+			return expected + delta
+		}
+		if delta > 0 && linesMatch(lines, expected-delta, old) {
+			return expected - delta
+		}
+	}
+	return -1
+}
+
+// applyHunks applies the hunks to the content, a hunk may be moved if the
+// lines before it changed. Conflicts are reported for every hunk which
+// doesn't match anywhere.
+func applyHunks(content string, hunks []*hunk) (string, []HunkResult, bool) {
+	noEOL := content != "" && !strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = []string{}
+	}
+	results := []HunkResult{}
+	ok := true
+	// lines which were added or removed by the previous hunks
+	shift := 0
+	minPos := 0
+	for i, h := range hunks {
+		res := HunkResult{Hunk: i + 1, OldStart: h.oldStart}
+		expected := h.oldStart - 1 + shift
+		if len(h.oldLines) == 0 {
+			// pure insertion, -0,0 means before the first line
+			expected = h.oldStart + shift
+		}
+		pos := findHunk(lines, expected, h.oldLines)
+		if pos < minPos || (h.oldNoEOL && !noEOL) || (h.oldNoEOL && pos+len(h.oldLines) != len(lines)) {
+			pos = -1
+		}
+		if pos < 0 {
+			ok = false
+			res.Conflict = true
+			res.Expected = h.oldLines
+			end := min(max(expected, 0)+len(h.oldLines), len(lines))
+			res.Found = append([]string{}, lines[min(max(expected, 0), len(lines)):end]...)
+			results = append(results, res)
+			continue
+		}
+		res.AppliedAt = pos + 1
+		res.Offset = pos - expected
+		lines = append(lines[:pos], append(append([]string{}, h.newLines...), lines[pos+len(h.oldLines):]...)...)
+		if pos+len(h.newLines) == len(lines) {
+			noEOL = h.newNoEOL
+		}
+		shift += len(h.newLines) - len(h.oldLines)
+		minPos = pos + len(h.newLines)
+		results = append(results, res)
+	}
+	result := strings.Join(lines, "\n")
+	if len(lines) > 0 && !noEOL {
+		result += "\n"
+	}
+	return result, results, ok
+}
+
+// writeTemp writes the content to a temporary file next to the path, with
+// the mode and the ownership of the original
+func writeTemp(path string, content []byte, info os.FileInfo) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := os.Lchown(tmp.Name(), int(stat.Uid), int(stat.Gid)); err != nil && os.Geteuid() == 0 {
+			os.Remove(tmp.Name())
+			return "", err
+		}
+	}
+	return tmp.Name(), nil
+}
+
+// writeFileAtomic replaces the file with the content, keeping the mode and
+// the ownership of the original
+func writeFileAtomic(path string, content []byte, info os.FileInfo) error {
+	tmp, err := writeTemp(path, content, info)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return os.Rename(tmp, path)
+}
+
+// writeBackup writes the content to a new backup of the file named after
+// the current time. Another backup of the same second is never replaced,
+// a sequence number is added instead.
+func writeBackup(path string, content []byte, info os.FileInfo) (string, error) {
+	tmp, err := writeTemp(path, content, info)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+	base := path + "." + time.Now().Format("20060102-150405")
+	for n := 0; n < 100; n++ {
+		name := base + ".bak"
+		if n > 0 {
+			name = fmt.Sprintf("%s.%d.bak", base, n)
+		}
+		// a link fails instead of replacing an existing file
+		err := os.Link(tmp, name)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("too many backups of %s in one second", path)
+}
+
+// applies a unified diff to a file, after a backup of the original
+func ApplyPatch(ctx context.Context, req *mcp.CallToolRequest, params *ApplyPatchParams, authKeeper auth.AuthKeeper) (*mcp.CallToolResult, any, error) {
+	if params.DryRun {
+		if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+			return nil, nil, err
+		} else if !allowed {
+			return nil, nil, fmt.Errorf("calling method was canceled by user")
+		}
+	} else {
+		allowed, err := authKeeper.IsWriteAuthorized(dbus.WithDetails(ctx, dbus.ActionManageFiles, map[string]string{"file": params.Path, "operation": "apply_patch"}))
+		if !allowed || err != nil {
+			return nil, nil, fmt.Errorf("calling method wasn't authorized: %v", err)
+		}
+		defer authKeeper.Deauthorize()
+	}
+	if err := GetPathPolicy().Check(params.Path); err != nil {
+		return nil, nil, err
+	}
+	// a symlink is patched at its target, replacing the link itself would
+	// turn it into a regular file
+	path, err := filepath.EvalSymlinks(params.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if err := GetPathPolicy().Check(path); err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%s is not a regular file", params.Path)
+	}
+	if info.Size() > maxPatchFileSize {
+		return nil, nil, fmt.Errorf("file is bigger than %d bytes", maxPatchFileSize)
+	}
+	hunks, err := parsePatch(params.Patch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	cost.AddBytes(ctx, len(original))
+	if bytes.IndexByte(original, 0) != -1 {
+		return nil, nil, fmt.Errorf("%s is a binary file", params.Path)
+	}
+
+	patched, hunkResults, ok := applyHunks(string(original), hunks)
+	result := &ApplyPatchResult{
+		Path:   params.Path,
+		DryRun: params.DryRun,
+		Hunks:  hunkResults,
+	}
+	if ok && !params.DryRun {
+		if !params.NoBackup {
+			if result.Backup, err = writeBackup(path, original, info); err != nil {
+				return nil, nil, fmt.Errorf("failed to write backup: %w", err)
+			}
+		}
+		if err := writeFileAtomic(path, []byte(patched), info); err != nil {
+			return nil, nil, fmt.Errorf("failed to write file: %w", err)
+		}
+		result.Applied = true
+		slog.WarnContext(ctx, "file patched", "audit", "file_patched", "path", params.Path, "target", path, "backup", result.Backup)
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,168 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeAuth, err := authkeeper.NewNoAuth(true, true)
+	require.NoError(t, err)
+
+	original := "[Service]\nExecStart=/usr/bin/foo\nRestart=no\nUser=foo\n"
+	patch := "--- a/foo.service\n+++ b/foo.service\n@@ -2,3 +2,3 @@\n ExecStart=/usr/bin/foo\n-Restart=no\n+Restart=always\n User=foo\n"
+	patched := "[Service]\nExecStart=/usr/bin/foo\nRestart=always\nUser=foo\n"
+
+	apply := func(t *testing.T, params *ApplyPatchParams) ApplyPatchResult {
+		res, _, err := ApplyPatch(context.Background(), nil, params, writeAuth)
+		require.NoError(t, err)
+		var result ApplyPatchResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result
+	}
+
+	t.Run("Apply with backup", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "apply.service")
+		require.NoError(t, os.WriteFile(path, []byte(original), 0640))
+		result := apply(t, &ApplyPatchParams{Path: path, Patch: patch})
+		assert.True(t, result.Applied)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, patched, string(content))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		backup, err := os.ReadFile(result.Backup)
+		require.NoError(t, err)
+		assert.Equal(t, original, string(backup))
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "dry.service")
+		require.NoError(t, os.WriteFile(path, []byte(original), 0644))
+		readAuth, err := authkeeper.NewNoAuth(true, false)
+		require.NoError(t, err)
+		res, _, err := ApplyPatch(context.Background(), nil, &ApplyPatchParams{Path: path, Patch: patch, DryRun: true}, readAuth)
+		require.NoError(t, err)
+		var result ApplyPatchResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		assert.False(t, result.Applied)
+		assert.False(t, result.Hunks[0].Conflict)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, original, string(content))
+	})
+
+	t.Run("Shifted hunk", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "shifted.service")
+		require.NoError(t, os.WriteFile(path, []byte("# comment\n# more\n"+original), 0644))
+		result := apply(t, &ApplyPatchParams{Path: path, Patch: patch, NoBackup: true})
+		assert.True(t, result.Applied)
+		assert.Empty(t, result.Backup)
+		assert.Equal(t, 2, result.Hunks[0].Offset)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "# comment\n# more\n"+patched, string(content))
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "conflict.service")
+		changed := "[Service]\nExecStart=/usr/bin/bar\nRestart=no\nUser=foo\n"
+		require.NoError(t, os.WriteFile(path, []byte(changed), 0644))
+		result := apply(t, &ApplyPatchParams{Path: path, Patch: patch})
+		assert.False(t, result.Applied)
+		require.Len(t, result.Hunks, 1)
+		assert.True(t, result.Hunks[0].Conflict)
+		assert.Equal(t, []string{"ExecStart=/usr/bin/foo", "Restart=no", "User=foo"}, result.Hunks[0].Expected)
+		assert.Equal(t, []string{"ExecStart=/usr/bin/bar", "Restart=no", "User=foo"}, result.Hunks[0].Found)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, changed, string(content))
+	})
+
+	t.Run("No newline at end of file", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "noeol.conf")
+		require.NoError(t, os.WriteFile(path, []byte("a\nb"), 0644))
+		result := apply(t, &ApplyPatchParams{Path: path, Patch: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n", NoBackup: true})
+		assert.True(t, result.Applied)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "a\nc\n", string(content))
+	})
+
+	t.Run("Write not authorized", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "readonly.service")
+		require.NoError(t, os.WriteFile(path, []byte(original), 0644))
+		readAuth, err := authkeeper.NewNoAuth(true, false)
+		require.NoError(t, err)
+		_, _, err = ApplyPatch(context.Background(), nil, &ApplyPatchParams{Path: path, Patch: patch}, readAuth)
+		assert.Error(t, err)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, original, string(content))
+	})
+
+	t.Run("Denied path", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "denied.service")
+		require.NoError(t, os.WriteFile(path, []byte(original), 0644))
+		SetPathPolicy(&PathPolicy{Deny: []string{path}})
+		defer SetPathPolicy(&PathPolicy{Deny: DefaultDenyPatterns()})
+		_, _, err := ApplyPatch(context.Background(), nil, &ApplyPatchParams{Path: path, Patch: patch}, writeAuth)
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid patch", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "invalid.service")
+		require.NoError(t, os.WriteFile(path, []byte(original), 0644))
+		_, _, err := ApplyPatch(context.Background(), nil, &ApplyPatchParams{Path: path, Patch: "@@ -1,3 +1,3 @@\n a\n"}, writeAuth)
+		assert.ErrorContains(t, err, "invalid patch")
+	})
+
+	t.Run("Symlink", func(t *testing.T) {
+		target := filepath.Join(tmpDir, "target.service")
+		link := filepath.Join(tmpDir, "link.service")
+		require.NoError(t, os.WriteFile(target, []byte(original), 0644))
+		require.NoError(t, os.Symlink(target, link))
+		result := apply(t, &ApplyPatchParams{Path: link, Patch: patch})
+		assert.True(t, result.Applied)
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSymlink, info.Mode()&os.ModeSymlink)
+		content, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, patched, string(content))
+		assert.Equal(t, tmpDir, filepath.Dir(result.Backup))
+		assert.Contains(t, result.Backup, "target.service.")
+
+		// a symlink to a denied file is refused
+		SetPathPolicy(&PathPolicy{Deny: []string{target}})
+		defer SetPathPolicy(&PathPolicy{Deny: DefaultDenyPatterns()})
+		_, _, err = ApplyPatch(context.Background(), nil, &ApplyPatchParams{Path: link, Patch: patch}, writeAuth)
+		assert.Error(t, err)
+	})
+
+	t.Run("Backups of the same second", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "twice.conf")
+		require.NoError(t, os.WriteFile(path, []byte("a\n"), 0644))
+		first := apply(t, &ApplyPatchParams{Path: path, Patch: "@@ -1 +1 @@\n-a\n+b\n"})
+		second := apply(t, &ApplyPatchParams{Path: path, Patch: "@@ -1 +1 @@\n-b\n+c\n"})
+		require.True(t, first.Applied)
+		require.True(t, second.Applied)
+		assert.NotEqual(t, first.Backup, second.Backup)
+		backup, err := os.ReadFile(first.Backup)
+		require.NoError(t, err)
+		assert.Equal(t, "a\n", string(backup))
+		backup, err = os.ReadFile(second.Backup)
+		require.NoError(t, err)
+		assert.Equal(t, "b\n", string(backup))
+	})
+}
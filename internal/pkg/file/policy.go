@@ -0,0 +1,147 @@
+package file
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultDenyPatterns are the paths which can't be read via the file tools
+// unless the default deny list is disabled
+func DefaultDenyPatterns() []string {
+	return []string{
+		"/etc/shadow", "/etc/shadow-", "/etc/gshadow", "/etc/gshadow-",
+		"/etc/security/opasswd",
+		"/etc/ssh/ssh_host_*_key",
+		"/etc/ssl/private", "/etc/pki/*/private",
+		"/root/.ssh", "/home/*/.ssh", "/root/.gnupg", "/home/*/.gnupg",
+		"/proc/kcore", "/dev/mem", "/dev/kmem", "/dev/port",
+		"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", "*.key",
+	}
+}
+
+// PathPolicy restricts the paths the file tools may read. Patterns are
+// shell globs, a pattern without a slash is matched against the base name
+// and a pattern matching a directory covers the whole subtree. Deny always
+// wins, an empty allow list allows everything which isn't denied.
+type PathPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// the policy is replaced when the configuration is reloaded while tools
+// run
+var globalPolicy atomic.Pointer[PathPolicy]
+
+func init() {
+	globalPolicy.Store(&PathPolicy{
+		Deny: DefaultDenyPatterns(),
+	})
+}
+
+func SetPathPolicy(p *PathPolicy) {
+	globalPolicy.Store(p)
+}
+
+func GetPathPolicy() *PathPolicy {
+	return globalPolicy.Load()
+}
+
+// matchPattern checks the path and all of its parent directories against
+// the pattern
+func matchPattern(pattern, path string) bool {
+	if !strings.Contains(pattern, "/") {
+		for _, elem := range strings.Split(path, "/") {
+			if ok, _ := filepath.Match(pattern, elem); ok {
+				return true
+			}
+		}
+		return false
+	}
+	pattern = filepath.Clean(pattern)
+	for p := path; ; p = filepath.Dir(p) {
+		if ok, _ := filepath.Match(pattern, p); ok {
+			return true
+		}
+		if p == "/" || p == "." {
+			return false
+		}
+	}
+}
+
+func firstMatch(patterns []string, path string) string {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, path) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+func (p *PathPolicy) check(path string) error {
+	if pattern := firstMatch(p.Deny, path); pattern != "" {
+		return fmt.Errorf("access to %s denied by pattern %q", path, pattern)
+	}
+	if len(p.Allow) > 0 && firstMatch(p.Allow, path) == "" {
+		return fmt.Errorf("access to %s denied, not in allowed paths", path)
+	}
+	return nil
+}
+
+// Check returns an error if the path may not be read. The path and the
+// path with all symlinks resolved have to pass the policy, so that a
+// symlink can't be used to escape it.
+func (p *PathPolicy) Check(path string) error {
+	if p == nil {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("path must be absolute: %s", path)
+	}
+	paths := []string{filepath.Clean(path)}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil && resolved != paths[0] {
+		paths = append(paths, resolved)
+	}
+	for _, checkPath := range paths {
+		if err := p.check(checkPath); err != nil {
+			slog.Warn("file access denied by path policy", "audit", "path_denied", "path", path, "resolved", checkPath, "reason", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// memberDenied returns the deny pattern matching a member of an archive.
+// The name is matched like the path of the member below /, so etc/shadow
+// of a backup is matched like /etc/shadow. As archives often have a prefix
+// like backup/ or the name of a host, every suffix of the name is matched
+// too. Only the deny patterns apply, the allow patterns were checked on the
+// archive itself.
+func (p *PathPolicy) memberDenied(name string) string {
+	if p == nil {
+		return ""
+	}
+	path := filepath.Join("/", name)
+	for {
+		if pattern := firstMatch(p.Deny, path); pattern != "" {
+			return pattern
+		}
+		i := strings.IndexByte(path[1:], '/')
+		if i < 0 {
+			return ""
+		}
+		path = path[i+1:]
+	}
+}
+
+// CheckMember returns an error if a member of the archive may not be read
+func (p *PathPolicy) CheckMember(archive, name string) error {
+	if pattern := p.memberDenied(name); pattern != "" {
+		err := fmt.Errorf("access to member %s of %s denied by pattern %q", name, archive, pattern)
+		slog.Warn("archive member denied by path policy", "audit", "path_denied", "path", archive, "member", name, "reason", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPolicyCheck(t *testing.T) {
+	policy := &PathPolicy{
+		Allow: []string{"/etc", "/var/log/*.log"},
+		Deny:  DefaultDenyPatterns(),
+	}
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{"/etc/systemd/journald.conf", true},
+		{"/etc/shadow", false},
+		{"/etc/ssh/ssh_host_ed25519_key", false},
+		{"/etc/ssh/ssh_host_ed25519_key.pub", true},
+		{"/etc/ssl/private/server.pem", false},
+		{"/etc/pki/tls/private/server.pem", false},
+		{"/etc/nginx/server.key", false},
+		{"/var/log/zypper.log", true},
+		{"/var/log/messages", false},
+		{"/home/user/.ssh/authorized_keys", false},
+		{"/proc/kcore", false},
+		{"relative/path", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := policy.Check(tt.path)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPathPolicySymlink(t *testing.T) {
+	tmpDir := t.TempDir()
+	secretDir := filepath.Join(tmpDir, "secret")
+	require.NoError(t, os.Mkdir(secretDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(secretDir, "data"), []byte("secret"), 0644))
+	link := filepath.Join(tmpDir, "link")
+	require.NoError(t, os.Symlink(filepath.Join(secretDir, "data"), link))
+
+	policy := &PathPolicy{Deny: []string{secretDir}}
+	assert.Error(t, policy.Check(link))
+
+	SetPathPolicy(policy)
+	defer SetPathPolicy(&PathPolicy{Deny: DefaultDenyPatterns()})
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+	_, _, err = GetFile(context.Background(), nil, &GetFileParams{Path: link, ShowContent: true}, testAuth)
+	assert.Error(t, err)
+}
@@ -0,0 +1,227 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/progress"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+)
+
+const (
+	maxSearchContext = 10
+	maxSearchFiles   = 1000
+)
+
+type SearchFileParams struct {
+	Path       string `json:"path" jsonschema:"Absolute path to the file or directory to search in. Directories are searched recursively."`
+	Pattern    string `json:"pattern" jsonschema:"Regular expression which is applied to every line"`
+	Context    int    `json:"context,omitempty" jsonschema:"Number of lines shown before and after every match. Defaults to 0, maximum is 10."`
+	MaxMatches int    `json:"max_matches,omitempty" jsonschema:"Maximum number of matches to return. Defaults to 100."`
+}
+
+type SearchMatch struct {
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+type SearchFileResult struct {
+	Matches       []SearchMatch `json:"matches"`
+	FilesSearched int           `json:"files_searched"`
+	Truncated     bool          `json:"truncated,omitempty"`
+	// lines longer than maxLineBytes are only searched in their start
+	CutLines int `json:"cut_lines,omitempty"`
+}
+
+func CreateSearchFileSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SearchFileParams](nil)
+	inputSchema.Properties["context"].Default = json.RawMessage(`0`)
+	inputSchema.Properties["max_matches"].Default = json.RawMessage(`100`)
+	return inputSchema
+}
+
+// isBinary uses the same heuristic as grep, a file containing a NUL byte
+// in its first block is treated as binary
+func isBinary(f *os.File) bool {
+	buf := make([]byte, 512)
+	n, _ := f.Read(buf)
+	f.Seek(0, 0)
+	return bytes.IndexByte(buf[:n], 0) != -1
+}
+
+// searches a single file and appends the matches to the result, returns
+// false if the maximum number of matches was reached
+func searchInFile(ctx context.Context, path string, re *regexp.Regexp, contextLines, maxMatches int, result *SearchFileResult) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return true, err
+	}
+	defer f.Close()
+	if isBinary(f) {
+		return true, nil
+	}
+	result.FilesSearched++
+
+	var before []string
+	// matches which still wait for their trailing context
+	var pending []int
+	br := bufio.NewReaderSize(contextReader(ctx, f), maxLineBytes)
+	// a match within a private key is redacted like the key
+	redactor := redact.Lines()
+	lineNr := 0
+	for {
+		line, n, cut, err := readLine(br)
+		cost.AddBytes(ctx, n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return true, err
+		}
+		lineNr++
+		if cut {
+			result.CutLines++
+		}
+		// the pattern is matched against the original line
+		shown, _ := redactor.Redact(line)
+		var open []int
+		for _, idx := range pending {
+			result.Matches[idx].After = append(result.Matches[idx].After, shown)
+			if len(result.Matches[idx].After) < contextLines {
+				open = append(open, idx)
+			}
+		}
+		pending = open
+		if re.MatchString(line) {
+			if len(result.Matches) >= maxMatches {
+				result.Truncated = true
+				return false, nil
+			}
+			result.Matches = append(result.Matches, SearchMatch{
+				File:   path,
+				Line:   lineNr,
+				Text:   shown,
+				Before: append([]string(nil), before...),
+			})
+			if contextLines > 0 {
+				pending = append(pending, len(result.Matches)-1)
+			}
+		}
+		if contextLines > 0 {
+			before = append(before, shown)
+			if len(before) > contextLines {
+				before = before[1:]
+			}
+		}
+	}
+	return true, nil
+}
+
+// search for a regular expression in a file or directory tree
+func SearchFile(ctx context.Context, req *mcp.CallToolRequest, params *SearchFileParams, authKeeper auth.AuthKeeper) (*mcp.CallToolResult, any, error) {
+	if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if params.Pattern == "" {
+		return nil, nil, fmt.Errorf("pattern is required")
+	}
+	re, err := regexp.Compile(params.Pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid regex pattern: %w", err)
+	}
+	contextLines := params.Context
+	if contextLines < 0 {
+		contextLines = 0
+	}
+	if contextLines > maxSearchContext {
+		contextLines = maxSearchContext
+	}
+	maxMatches := params.MaxMatches
+	if maxMatches <= 0 {
+		maxMatches = 100
+	}
+
+	if err := GetPathPolicy().Check(params.Path); err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(params.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	result := &SearchFileResult{
+		Matches: []SearchMatch{},
+	}
+	if info.IsDir() {
+		reporter := progress.New(req, 0)
+		visited := 0
+		err = filepath.WalkDir(params.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// unreadable directories are skipped
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if policy := GetPathPolicy(); policy != nil && policy.check(path) != nil {
+				// denied parts of the tree are silently skipped
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if result.FilesSearched >= maxSearchFiles {
+				result.Truncated = true
+				return fs.SkipAll
+			}
+			visited++
+			reporter.Report(ctx, float64(visited), path)
+			more, err := searchInFile(ctx, path, re, contextLines, maxMatches, result)
+			if err != nil {
+				return nil
+			}
+			if !more {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to search directory: %w", err)
+		}
+	} else {
+		if _, err := searchInFile(ctx, params.Path, re, contextLines, maxMatches, result); err != nil {
+			return nil, nil, fmt.Errorf("failed to search file: %w", err)
+		}
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,295 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+const (
+	maxWatchDuration = 3600
+	maxWatchPaths    = 16
+	maxWatches       = 64
+	maxWatchEvents   = 1000
+)
+
+type WatchPathParams struct {
+	Paths    []string `json:"paths,omitempty" jsonschema:"Absolute paths of files or directories to watch. For a directory the changes of its entries are reported."`
+	Duration uint     `json:"duration,omitempty" jsonschema:"Seconds until the watch expires. Defaults to 300, maximum is 3600."`
+	ID       string   `json:"id,omitempty" jsonschema:"ID of an existing watch of this session. Returns the events recorded so far instead of creating a new watch."`
+}
+
+type WatchEvent struct {
+	Time  string `json:"time"`
+	Path  string `json:"path"`
+	Event string `json:"event"`
+}
+
+type WatchPathResult struct {
+	ID      string       `json:"id"`
+	Paths   []string     `json:"paths"`
+	Expires string       `json:"expires"`
+	Expired bool         `json:"expired,omitempty"`
+	Events  []WatchEvent `json:"events"`
+	Dropped int          `json:"dropped,omitempty"`
+}
+
+func CreateWatchPathSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[WatchPathParams](nil)
+	inputSchema.Properties["duration"].Default = json.RawMessage(`300`)
+	return inputSchema
+}
+
+// pathWatch is a running watch, the events are sent to the session and
+// recorded so that they can be polled
+type pathWatch struct {
+	id      string
+	session string
+	paths   []string
+	expires time.Time
+	mu      sync.Mutex
+	events  []WatchEvent
+	dropped int
+	done    bool
+}
+
+var watches = struct {
+	sync.Mutex
+	last int
+	all  map[string]*pathWatch
+}{all: map[string]*pathWatch{}}
+
+// watchEventName maps an inotify mask to create, modify, attrib or delete.
+// Atomic replaces by rename are reported as create.
+func watchEventName(mask uint32) string {
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		return "create"
+	case mask&syscall.IN_CLOSE_WRITE != 0:
+		return "modify"
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM|syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+		return "delete"
+	case mask&syscall.IN_ATTRIB != 0:
+		return "attrib"
+	}
+	return ""
+}
+
+func (w *pathWatch) record(event WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.events) >= maxWatchEvents {
+		w.dropped++
+		return
+	}
+	w.events = append(w.events, event)
+}
+
+func (w *pathWatch) result() *WatchPathResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return &WatchPathResult{
+		ID:      w.id,
+		Paths:   w.paths,
+		Expires: w.expires.Format(time.RFC3339),
+		Expired: w.done,
+		Events:  append([]WatchEvent{}, w.events...),
+		Dropped: w.dropped,
+	}
+}
+
+// notifyEvent sends an event of a watch as log message to the session
+func notifyEvent(session *mcp.ServerSession, id string, event WatchEvent) {
+	if session == nil {
+		return
+	}
+	err := session.Log(context.Background(), &mcp.LoggingMessageParams{
+		Level:  "info",
+		Logger: "watch_path",
+		Data: map[string]string{
+			"id":    id,
+			"path":  event.Path,
+			"event": event.Event,
+			"time":  event.Time,
+		},
+	})
+	if err != nil {
+		slog.Debug("couldn't send notification", "path", event.Path, "error", err)
+	}
+}
+
+// startWatch adds the inotify watches, a file is watched via its directory
+// so that it is still seen after an atomic replace
+func startWatch(paths []string, duration time.Duration, session *mcp.ServerSession) (*pathWatch, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init inotify: %w", err)
+	}
+	// watched directory and the name of the file in it, empty for a directory
+	type target struct {
+		dir  string
+		name string
+	}
+	targets := map[int32][]target{}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		info, err := os.Stat(path)
+		t := target{dir: path}
+		if err != nil || !info.IsDir() {
+			// a missing file is watched for its creation
+			t = target{dir: filepath.Dir(path), name: filepath.Base(path)}
+		}
+		wd, err := syscall.InotifyAddWatch(fd, t.dir, syscall.IN_CREATE|syscall.IN_MOVED_TO|syscall.IN_CLOSE_WRITE|syscall.IN_ATTRIB|
+			syscall.IN_DELETE|syscall.IN_MOVED_FROM|syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		targets[int32(wd)] = append(targets[int32(wd)], t)
+	}
+
+	watches.Lock()
+	active := 0
+	for _, other := range watches.all {
+		other.mu.Lock()
+		if !other.done {
+			active++
+		}
+		other.mu.Unlock()
+	}
+	if active >= maxWatches {
+		watches.Unlock()
+		syscall.Close(fd)
+		return nil, fmt.Errorf("too many active watches, maximum is %d", maxWatches)
+	}
+	watches.last++
+	w := &pathWatch{
+		id:      strconv.Itoa(watches.last),
+		paths:   paths,
+		expires: time.Now().Add(duration),
+	}
+	if session != nil {
+		w.session = session.ID()
+	}
+	watches.all[w.id] = w
+	watches.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	events := readInotify(ctx, fd)
+	go func() {
+		defer func() {
+			cancel()
+			w.mu.Lock()
+			w.done = true
+			w.mu.Unlock()
+			// expired watches can still be polled until the expiry of a
+			// second period
+			time.AfterFunc(duration, func() {
+				watches.Lock()
+				delete(watches.all, w.id)
+				watches.Unlock()
+			})
+		}()
+		if session != nil {
+			go func() {
+				session.Wait()
+				cancel()
+			}()
+		}
+		for event := range events {
+			name := watchEventName(event.Mask)
+			if name == "" {
+				continue
+			}
+			for _, t := range targets[event.Wd] {
+				if t.name != "" && t.name != event.Name && event.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) == 0 {
+					continue
+				}
+				path := t.dir
+				if event.Name != "" {
+					path = filepath.Join(t.dir, event.Name)
+				}
+				if GetPathPolicy().Check(path) != nil {
+					continue
+				}
+				ev := WatchEvent{Time: time.Now().Format(time.RFC3339Nano), Path: path, Event: name}
+				w.record(ev)
+				notifyEvent(session, w.id, ev)
+			}
+		}
+	}()
+	return w, nil
+}
+
+// watches files and directories with inotify, the events are sent as log
+// notifications until the watch expires and can be polled with the id
+func WatchPath(ctx context.Context, req *mcp.CallToolRequest, params *WatchPathParams, authKeeper auth.AuthKeeper) (*mcp.CallToolResult, any, error) {
+	if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	var session *mcp.ServerSession
+	if req != nil {
+		session = req.Session
+	}
+
+	var result *WatchPathResult
+	if params.ID != "" {
+		watches.Lock()
+		w, ok := watches.all[params.ID]
+		watches.Unlock()
+		if !ok || (session != nil && w.session != session.ID()) {
+			return nil, nil, fmt.Errorf("no watch with id %s", params.ID)
+		}
+		result = w.result()
+	} else {
+		if len(params.Paths) == 0 {
+			return nil, nil, fmt.Errorf("no paths given")
+		}
+		if len(params.Paths) > maxWatchPaths {
+			return nil, nil, fmt.Errorf("not watching more than %d paths", maxWatchPaths)
+		}
+		duration := params.Duration
+		if duration == 0 {
+			duration = 300
+		}
+		if duration > maxWatchDuration {
+			return nil, nil, fmt.Errorf("not watching longer than %d seconds", maxWatchDuration)
+		}
+		for _, path := range params.Paths {
+			if err := GetPathPolicy().Check(path); err != nil {
+				return nil, nil, err
+			}
+		}
+		w, err := startWatch(params.Paths, time.Duration(duration)*time.Second, session)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = w.result()
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
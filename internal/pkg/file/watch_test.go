@@ -0,0 +1,72 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchPath(t *testing.T) {
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+	tmpDir := t.TempDir()
+	certPath := filepath.Join(tmpDir, "server.crt")
+	require.NoError(t, os.WriteFile(certPath, []byte("old"), 0644))
+
+	watch := func(t *testing.T, params *WatchPathParams) WatchPathResult {
+		res, _, err := WatchPath(context.Background(), nil, params, testAuth)
+		require.NoError(t, err)
+		var result WatchPathResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		return result
+	}
+
+	created := watch(t, &WatchPathParams{Paths: []string{certPath}, Duration: 5})
+	require.NotEmpty(t, created.ID)
+	assert.Empty(t, created.Events)
+
+	// atomic replace like a certificate renewal, the unrelated file isn't reported
+	tmpPath := filepath.Join(tmpDir, ".server.crt.tmp")
+	require.NoError(t, os.WriteFile(tmpPath, []byte("new"), 0644))
+	require.NoError(t, os.Rename(tmpPath, certPath))
+	require.NoError(t, os.WriteFile(certPath, []byte("newer"), 0644))
+	require.NoError(t, os.Remove(certPath))
+
+	var events []WatchEvent
+	require.Eventually(t, func() bool {
+		events = watch(t, &WatchPathParams{ID: created.ID}).Events
+		return len(events) >= 3
+	}, 2*time.Second, 20*time.Millisecond)
+	var names []string
+	for _, ev := range events {
+		assert.Equal(t, certPath, ev.Path)
+		names = append(names, ev.Event)
+	}
+	assert.Equal(t, []string{"create", "modify", "delete"}, names)
+
+	t.Run("Unknown id", func(t *testing.T) {
+		_, _, err := WatchPath(context.Background(), nil, &WatchPathParams{ID: "nope"}, testAuth)
+		assert.Error(t, err)
+	})
+
+	t.Run("Too long", func(t *testing.T) {
+		_, _, err := WatchPath(context.Background(), nil, &WatchPathParams{Paths: []string{tmpDir}, Duration: maxWatchDuration + 1}, testAuth)
+		assert.Error(t, err)
+	})
+
+	t.Run("Denied path", func(t *testing.T) {
+		old := GetPathPolicy()
+		defer SetPathPolicy(old)
+		SetPathPolicy(&PathPolicy{Deny: []string{tmpDir}})
+		_, _, err := WatchPath(context.Background(), nil, &WatchPathParams{Paths: []string{certPath}}, testAuth)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,303 @@
+package forensics
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+)
+
+// can be changed for tests
+var (
+	procRoot   = "/proc"
+	setuidDirs = []string{"/usr/bin", "/usr/sbin", "/usr/lib", "/usr/libexec", "/usr/local/bin", "/usr/local/sbin", "/bin", "/sbin", "/opt"}
+)
+
+// ports which are expected to listen on a typical system
+var wellKnownPorts = []uint16{22, 25, 53, 67, 68, 80, 111, 123, 323, 443, 546, 547, 631, 5353, 5355}
+
+type SnapshotParams struct {
+	UnitsSince uint `json:"units_since,omitempty" jsonschema:"Report units which were started in the last minutes. Defaults to 60."`
+	SetuidDays uint `json:"setuid_days,omitempty" jsonschema:"Report setuid/setgid binaries modified or changed in the last days. Defaults to 7."`
+}
+
+type KernelModule struct {
+	Name  string `json:"name"`
+	Size  uint64 `json:"size"`
+	Users int    `json:"users"`
+	State string `json:"state"`
+	Taint string `json:"taint,omitempty"`
+}
+
+type SetuidFile struct {
+	Path    string `json:"path"`
+	Mode    string `json:"mode"`
+	Uid     uint32 `json:"uid"`
+	ModTime string `json:"mod_time"`
+	Changed string `json:"changed"`
+}
+
+type Listener struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     uint16 `json:"port"`
+	Process  string `json:"process,omitempty"`
+	PID      int    `json:"pid,omitempty"`
+	Unusual  bool   `json:"unusual,omitempty"`
+}
+
+type Snapshot struct {
+	Time          string                `json:"time"`
+	KernelTainted uint64                `json:"kernel_tainted"`
+	Modules       []KernelModule        `json:"modules"`
+	SetuidScanned int                   `json:"setuid_scanned"`
+	RecentSetuid  []SetuidFile          `json:"recent_setuid"`
+	Listeners     []Listener            `json:"listeners"`
+	RecentUnits   []systemd.StartedUnit `json:"recent_units"`
+	Errors        []string              `json:"errors,omitempty"`
+}
+
+func CreateSnapshotSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[SnapshotParams](nil)
+	inputSchema.Properties["units_since"].Default = json.RawMessage(`60`)
+	inputSchema.Properties["setuid_days"].Default = json.RawMessage(`7`)
+	return inputSchema
+}
+
+// reads /proc/modules, out of tree and unsigned modules have a taint
+func readModules() ([]KernelModule, error) {
+	f, err := os.Open(filepath.Join(procRoot, "modules"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	modules := []KernelModule{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// name size users deps state address [(taint)]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mod := KernelModule{
+			Name:  fields[0],
+			State: fields[4],
+		}
+		mod.Size, _ = strconv.ParseUint(fields[1], 10, 64)
+		mod.Users, _ = strconv.Atoi(fields[2])
+		if len(fields) > 6 {
+			mod.Taint = strings.Trim(fields[6], "()")
+		}
+		modules = append(modules, mod)
+	}
+	return modules, scanner.Err()
+}
+
+func readTainted() (uint64, error) {
+	b, err := os.ReadFile(filepath.Join(procRoot, "sys/kernel/tainted"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// scans the binary directories for setuid and setgid files which were
+// modified or had their inode changed after since. The ctime is reported
+// as well, as the mtime can be set by anyone owning the file.
+func findRecentSetuid(dirs []string, since time.Time) (recent []SetuidFile, scanned int) {
+	recent = []SetuidFile{}
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || info.Mode()&(fs.ModeSetuid|fs.ModeSetgid) == 0 {
+				return nil
+			}
+			scanned++
+			changed := info.ModTime()
+			var uid uint32
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+				changed = time.Unix(stat.Ctim.Unix())
+				uid = stat.Uid
+			}
+			if info.ModTime().Before(since) && changed.Before(since) {
+				return nil
+			}
+			recent = append(recent, SetuidFile{
+				Path:    path,
+				Mode:    info.Mode().String(),
+				Uid:     uid,
+				ModTime: info.ModTime().Format(time.RFC3339),
+				Changed: changed.Format(time.RFC3339),
+			})
+			return nil
+		})
+	}
+	return recent, scanned
+}
+
+// parses an address of /proc/net/{tcp,udp}[6], the address is in network
+// byte order per 32 bit word in host byte order
+func parseProcAddr(s string) (net.IP, uint16, error) {
+	addr, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+	b, err := hex.DecodeString(addr)
+	if err != nil || (len(b) != 4 && len(b) != 16) {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+	for i := 0; i < len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port %q", s)
+	}
+	return net.IP(b), uint16(p), nil
+}
+
+// maps the socket inodes to the owning processes
+func socketOwners() map[string]Listener {
+	owners := make(map[string]Listener)
+	procs, _ := os.ReadDir(procRoot)
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join(procRoot, p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		comm, _ := os.ReadFile(filepath.Join(procRoot, p.Name(), "comm"))
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			owners[inode] = Listener{PID: pid, Process: strings.TrimSpace(string(comm))}
+		}
+	}
+	return owners
+}
+
+// reads the listening tcp and bound udp sockets. A listener is unusual if
+// it isn't bound to loopback and the port isn't well known.
+func readListeners() ([]Listener, error) {
+	owners := socketOwners()
+	listeners := []Listener{}
+	var lastErr error
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open(filepath.Join(procRoot, "net", proto))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			// sl local_address rem_address st tx:rx tr:when retrnsmt uid timeout inode
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			// 0A is TCP_LISTEN, unconnected udp sockets are in state 07
+			if (strings.HasPrefix(proto, "tcp") && fields[3] != "0A") || (strings.HasPrefix(proto, "udp") && fields[3] != "07") {
+				continue
+			}
+			ip, port, err := parseProcAddr(fields[1])
+			if err != nil {
+				continue
+			}
+			l := owners[fields[9]]
+			l.Protocol = proto
+			l.Address = ip.String()
+			l.Port = port
+			l.Unusual = !ip.IsLoopback() && !slices.Contains(wellKnownPorts, port)
+			listeners = append(listeners, l)
+		}
+		f.Close()
+	}
+	if len(listeners) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return listeners, nil
+}
+
+// gathers an integrity snapshot of the system for incident response
+func ForensicsSnapshot(ctx context.Context, req *mcp.CallToolRequest, params *SnapshotParams, authKeeper auth.AuthKeeper, conn *systemd.Connection) (*mcp.CallToolResult, any, error) {
+	if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	unitsSince := params.UnitsSince
+	if unitsSince == 0 {
+		unitsSince = 60
+	}
+	setuidDays := params.SetuidDays
+	if setuidDays == 0 {
+		setuidDays = 7
+	}
+	now := time.Now()
+	snapshot := &Snapshot{
+		Time: now.Format(time.RFC3339),
+	}
+	addErr := func(what string, err error) {
+		slog.Debug("forensics snapshot incomplete", "part", what, "error", err)
+		snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	var err error
+	if snapshot.KernelTainted, err = readTainted(); err != nil {
+		addErr("kernel taint", err)
+	}
+	if snapshot.Modules, err = readModules(); err != nil {
+		addErr("kernel modules", err)
+	}
+	snapshot.RecentSetuid, snapshot.SetuidScanned = findRecentSetuid(setuidDirs, now.AddDate(0, 0, -int(setuidDays)))
+	if snapshot.Listeners, err = readListeners(); err != nil {
+		addErr("listeners", err)
+	}
+	if conn != nil {
+		if snapshot.RecentUnits, err = conn.UnitsStartedSince(ctx, now.Add(-time.Duration(unitsSince)*time.Minute)); err != nil {
+			addErr("units", err)
+		}
+	} else {
+		addErr("units", fmt.Errorf("no connection to systemd"))
+	}
+
+	jsonBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,101 @@
+package forensics
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tcpHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+func fakeProc(t *testing.T) string {
+	root := t.TempDir()
+	files := map[string]string{
+		"modules": "ext4 1110016 1 - Live 0x0000000000000000\n" +
+			"vboxdrv 700416 2 vboxnetadp, Live 0x0000000000000000 (OE)\n",
+		"sys/kernel/tainted": "12288\n",
+		"net/tcp": tcpHeader +
+			"   0: 0100007F:0277 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0 100 0 0 10 0\n" +
+			"   1: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1002 1 0 100 0 0 10 0\n" +
+			"   2: 0100007F:9C40 0100007F:1F90 01 00000000:00000000 00:00000000 00000000  1000        0 1003 1 0 100 0 0 10 0\n",
+		"net/tcp6": tcpHeader +
+			"   0: 00000000000000000000000000000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1004 1 0 100 0 0 10 0\n",
+		"net/udp": tcpHeader +
+			"   0: 00000000:14E9 00000000:0000 07 00000000:00000000 00:00000000 00000000   0        0 1005 2 0 0\n",
+		"4242/comm": "backdoor\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "4242/fd"), 0755))
+	require.NoError(t, os.Symlink("socket:[1002]", filepath.Join(root, "4242/fd/3")))
+	return root
+}
+
+func TestReadModules(t *testing.T) {
+	procRoot = fakeProc(t)
+	defer func() { procRoot = "/proc" }()
+	modules, err := readModules()
+	require.NoError(t, err)
+	require.Len(t, modules, 2)
+	assert.Equal(t, KernelModule{Name: "ext4", Size: 1110016, Users: 1, State: "Live"}, modules[0])
+	assert.Equal(t, "OE", modules[1].Taint)
+	tainted, err := readTainted()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(12288), tainted)
+}
+
+func TestReadListeners(t *testing.T) {
+	procRoot = fakeProc(t)
+	defer func() { procRoot = "/proc" }()
+	listeners, err := readListeners()
+	require.NoError(t, err)
+	assert.Equal(t, []Listener{
+		{Protocol: "tcp", Address: "127.0.0.1", Port: 631},
+		{Protocol: "tcp", Address: "0.0.0.0", Port: 8080, Process: "backdoor", PID: 4242, Unusual: true},
+		{Protocol: "tcp6", Address: "::", Port: 22},
+		{Protocol: "udp", Address: "0.0.0.0", Port: 5353},
+	}, listeners)
+}
+
+func TestFindRecentSetuid(t *testing.T) {
+	dir := t.TempDir()
+	recentPath := filepath.Join(dir, "recent")
+	require.NoError(t, os.WriteFile(recentPath, []byte("x"), 0755))
+	require.NoError(t, os.Chmod(recentPath, 0755|os.ModeSetuid))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plain"), []byte("x"), 0755))
+
+	recent, scanned := findRecentSetuid([]string{dir}, time.Now().Add(-time.Hour))
+	assert.Equal(t, 1, scanned)
+	require.Len(t, recent, 1)
+	assert.Equal(t, recentPath, recent[0].Path)
+
+	recent, _ = findRecentSetuid([]string{dir}, time.Now().Add(time.Hour))
+	assert.Empty(t, recent)
+}
+
+func TestForensicsSnapshot(t *testing.T) {
+	procRoot = fakeProc(t)
+	setuidDirs = []string{t.TempDir()}
+	defer func() { procRoot = "/proc" }()
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+
+	res, _, err := ForensicsSnapshot(context.Background(), nil, &SnapshotParams{}, testAuth, nil)
+	require.NoError(t, err)
+	var snapshot Snapshot
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &snapshot))
+	assert.Len(t, snapshot.Modules, 2)
+	assert.Len(t, snapshot.Listeners, 4)
+	assert.Equal(t, []string{"units: no connection to systemd"}, snapshot.Errors)
+}
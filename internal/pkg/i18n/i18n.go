@@ -0,0 +1,301 @@
+// Package i18n translates the titles and descriptions of the tools and the
+// common error messages. The catalogs in locales are keyed by the tool
+// names and by the English error messages, whose printf verbs match the
+// arguments of the message. The language is set by the server or per
+// request by the Accept-Language header, English is the default and the
+// fallback for everything without a translation.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// English is the language of the server itself
+const English = "en"
+
+// text is the translation of a tool
+type text struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type catalog struct {
+	Tools  map[string]text   `json:"tools"`
+	Errors map[string]string `json:"errors"`
+
+	// the messages as patterns, the longest first
+	messages []message
+}
+
+type message struct {
+	pattern     *regexp.Regexp
+	translation string
+	// which arguments are errors, which are translated too
+	wrapped []bool
+}
+
+var (
+	loadOnce sync.Once
+	catalogs map[string]*catalog
+	loadErr  error
+)
+
+var defaultLang atomic.Value
+
+// verbs are the printf verbs of the messages, translations may also use
+// %[n]s to reorder the arguments
+var verbs = regexp.MustCompile(`%(\[(\d+)\])?[sqvwd]`)
+
+func load() {
+	catalogs = make(map[string]*catalog)
+	entries, err := locales.ReadDir("locales")
+	if err != nil {
+		loadErr = err
+		return
+	}
+	for _, entry := range entries {
+		lang := strings.TrimSuffix(entry.Name(), ".json")
+		data, err := locales.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			loadErr = err
+			return
+		}
+		c := &catalog{}
+		if err := json.Unmarshal(data, c); err != nil {
+			loadErr = fmt.Errorf("invalid catalog %s: %w", entry.Name(), err)
+			return
+		}
+		for msgid, translation := range c.Errors {
+			c.messages = append(c.messages, compile(msgid, translation))
+		}
+		// prefer the most specific message
+		sort.Slice(c.messages, func(i, j int) bool {
+			return len(c.messages[i].pattern.String()) > len(c.messages[j].pattern.String())
+		})
+		catalogs[lang] = c
+	}
+}
+
+func compile(msgid, translation string) message {
+	m := message{translation: translation}
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range verbs.FindAllStringIndex(msgid, -1) {
+		expr.WriteString(regexp.QuoteMeta(msgid[last:loc[0]]))
+		expr.WriteString("(.*?)")
+		verb := msgid[loc[1]-1]
+		m.wrapped = append(m.wrapped, verb == 'w' || verb == 'v')
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(msgid[last:]))
+	expr.WriteString("$")
+	m.pattern = regexp.MustCompile(expr.String())
+	return m
+}
+
+func get(lang string) *catalog {
+	loadOnce.Do(load)
+	return catalogs[lang]
+}
+
+// Languages returns the languages with a catalog and English
+func Languages() []string {
+	loadOnce.Do(load)
+	langs := []string{English}
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	slices.Sort(langs[1:])
+	return langs
+}
+
+// Check returns an error for an unknown language or broken catalogs
+func Check(lang string) error {
+	loadOnce.Do(load)
+	if loadErr != nil {
+		return loadErr
+	}
+	if lang != "" && !slices.Contains(Languages(), lang) {
+		return fmt.Errorf("unknown language %q, valid are %s", lang, strings.Join(Languages(), ", "))
+	}
+	return nil
+}
+
+// SetDefault sets the language used without an Accept-Language header
+func SetDefault(lang string) {
+	defaultLang.Store(lang)
+}
+
+// Default returns the language used without an Accept-Language header
+func Default() string {
+	lang, _ := defaultLang.Load().(string)
+	if lang == "" {
+		return English
+	}
+	return lang
+}
+
+// Match returns the supported language the Accept-Language header prefers,
+// or the default
+func Match(acceptLanguage string) string {
+	best, bestQ := Default(), 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if q > bestQ && slices.Contains(Languages(), base) {
+			best, bestQ = base, q
+		}
+	}
+	return best
+}
+
+// Tool returns the title and description of a tool in the language
+func Tool(lang string, tool *mcp.Tool) (title, description string) {
+	title, description = tool.Title, tool.Description
+	c := get(lang)
+	if c == nil {
+		return title, description
+	}
+	if t, ok := c.Tools[tool.Name]; ok {
+		if t.Title != "" {
+			title = t.Title
+		}
+		if t.Description != "" {
+			description = t.Description
+		}
+	}
+	return title, description
+}
+
+// Message translates an error message, the errors it wraps are translated
+// too
+func Message(lang, msg string) string {
+	c := get(lang)
+	if c == nil {
+		return msg
+	}
+	for _, m := range c.messages {
+		args := m.pattern.FindStringSubmatch(msg)
+		if args == nil {
+			continue
+		}
+		args = args[1:]
+		for i := range args {
+			if m.wrapped[i] {
+				args[i] = Message(lang, args[i])
+			}
+		}
+		next := 0
+		return verbs.ReplaceAllStringFunc(m.translation, func(verb string) string {
+			i := next
+			if sub := verbs.FindStringSubmatch(verb); sub[2] != "" {
+				i, _ = strconv.Atoi(sub[2])
+				i--
+			} else {
+				next++
+			}
+			if i < 0 || i >= len(args) {
+				return verb
+			}
+			return args[i]
+		})
+	}
+	return msg
+}
+
+// localized is a translated error, the code of a protocol error is kept
+type localized struct {
+	msg string
+	err error
+}
+
+func (e *localized) Error() string { return e.msg }
+func (e *localized) Unwrap() error { return e.err }
+
+// Error translates the message of an error
+func Error(lang string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var already *localized
+	if errors.As(err, &already) {
+		return err
+	}
+	if msg := Message(lang, err.Error()); msg != err.Error() {
+		return &localized{msg: msg, err: err}
+	}
+	return err
+}
+
+type langKey struct{}
+
+// FromContext returns the language of the request
+func FromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(langKey{}).(string); ok {
+		return lang
+	}
+	return Default()
+}
+
+// Middleware selects the language of a request and translates the tool
+// list and the errors of tool calls
+func Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		lang := Default()
+		if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+			if accept := extra.Header.Get("Accept-Language"); accept != "" {
+				lang = Match(accept)
+			}
+		}
+		ctx = context.WithValue(ctx, langKey{}, lang)
+		res, err := next(ctx, method, req)
+		if lang == English {
+			return res, err
+		}
+		switch r := res.(type) {
+		case *mcp.ListToolsResult:
+			// the registered tools are shared by all sessions
+			tools := make([]*mcp.Tool, len(r.Tools))
+			for i, tool := range r.Tools {
+				copied := *tool
+				copied.Title, copied.Description = Tool(lang, tool)
+				tools[i] = &copied
+			}
+			r.Tools = tools
+		case *mcp.CallToolResult:
+			if r.IsError {
+				for _, c := range r.Content {
+					if text, ok := c.(*mcp.TextContent); ok {
+						text.Text = Message(lang, text.Text)
+					}
+				}
+			}
+		}
+		return res, Error(lang, err)
+	}
+}
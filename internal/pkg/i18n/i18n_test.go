@@ -0,0 +1,104 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogs(t *testing.T) {
+	require.NoError(t, Check(""))
+	assert.Equal(t, []string{"en", "de", "es", "fr"}, Languages())
+	assert.Error(t, Check("xx"))
+	// all catalogs have the same entries as the German one
+	reference := get("de")
+	for _, lang := range Languages()[1:] {
+		c := get(lang)
+		for name := range reference.Tools {
+			assert.Contains(t, c.Tools, name, "tool missing in %s", lang)
+		}
+		for msgid := range reference.Errors {
+			assert.Contains(t, c.Errors, msgid, "message missing in %s", lang)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	assert.Equal(t, "de", Match("de-DE,de;q=0.9,en;q=0.8"))
+	assert.Equal(t, "fr", Match("it, fr-CH;q=0.7, de;q=0.5"))
+	assert.Equal(t, "en", Match("en-US,fr;q=0.5"))
+	assert.Equal(t, "en", Match("it"))
+	assert.Equal(t, "en", Match("de;q=bad"))
+	SetDefault("es")
+	defer SetDefault("")
+	assert.Equal(t, "es", Match("it"))
+}
+
+func TestMessage(t *testing.T) {
+	assert.Equal(t, "die Unit foo.service wurde nicht gefunden", Message("de", "unit foo.service not found"))
+	assert.Equal(t, "der Aufruf wurde nicht autorisiert: das Ändern von foo.service wurde verweigert, die Unit ist nicht erlaubt",
+		Message("de", "calling method wasn't authorized: changing foo.service denied, not in allowed units"))
+	// the arguments are reordered
+	assert.Equal(t, "los roles viewer no permiten llamar a list_log", Message("es", "calling list_log isn't granted by the roles viewer"))
+	assert.Equal(t, "something else", Message("fr", "something else"))
+	assert.Equal(t, "unit foo.service not found", Message("en", "unit foo.service not found"))
+}
+
+func TestError(t *testing.T) {
+	orig := errors.New("unit foo.service not found")
+	err := Error("fr", orig)
+	assert.Equal(t, "unité foo.service introuvable", err.Error())
+	assert.True(t, errors.Is(err, orig))
+	assert.Equal(t, err, Error("de", err), "translated only once")
+	untranslated := errors.New("something else")
+	assert.Equal(t, untranslated, Error("de", untranslated))
+	assert.NoError(t, Error("de", nil))
+}
+
+func TestTool(t *testing.T) {
+	tool := &mcp.Tool{Name: "list_log", Title: "List log", Description: "Get the last log entries"}
+	title, description := Tool("de", tool)
+	assert.Equal(t, "Systemprotokoll auflisten", title)
+	assert.NotEqual(t, tool.Description, description)
+	title, _ = Tool("de", &mcp.Tool{Name: "unknown", Title: "Unknown"})
+	assert.Equal(t, "Unknown", title)
+}
+
+func TestMiddleware(t *testing.T) {
+	tool := &mcp.Tool{Name: "list_log", Title: "List log"}
+	var seen string
+	handler := Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		seen = FromContext(ctx)
+		switch method {
+		case "tools/list":
+			return &mcp.ListToolsResult{Tools: []*mcp.Tool{tool}}, nil
+		case "tools/call":
+			if req.(*mcp.CallToolRequest).Params.Name == "broken" {
+				return nil, errors.New("unknown or expired cursor, call the tool again")
+			}
+			return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "unit foo.service not found"}}}, nil
+		}
+		return nil, nil
+	})
+	extra := &mcp.RequestExtra{Header: http.Header{"Accept-Language": {"de-DE"}}}
+
+	res, err := handler(context.Background(), "tools/list", &mcp.ListToolsRequest{Extra: extra})
+	require.NoError(t, err)
+	assert.Equal(t, "de", seen)
+	assert.Equal(t, "Systemprotokoll auflisten", res.(*mcp.ListToolsResult).Tools[0].Title)
+	assert.Equal(t, "List log", tool.Title, "the registered tool is shared")
+
+	res, err = handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log"}, Extra: extra})
+	require.NoError(t, err)
+	assert.Equal(t, "die Unit foo.service wurde nicht gefunden", res.(*mcp.CallToolResult).Content[0].(*mcp.TextContent).Text)
+
+	_, err = handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "broken"}})
+	require.Error(t, err)
+	assert.Equal(t, "en", seen)
+	assert.Equal(t, "unknown or expired cursor, call the tool again", err.Error())
+}
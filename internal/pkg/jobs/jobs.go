@@ -0,0 +1,359 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/audit"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sessionid"
+)
+
+// ToolName is the tool which reports the status and result of a job
+const ToolName = "get_job"
+
+// ParamName is the parameter which is added to the tools which can run in
+// the background
+const ParamName = "background"
+
+// MaxWait is the longest time get_job waits for a job to finish
+const MaxWait uint = 60
+
+const (
+	Running   = "running"
+	Succeeded = "succeeded"
+	Failed    = "failed"
+)
+
+var (
+	// at most this many jobs run at once, so that a client can't pile up
+	// calls which hold the backends
+	maxRunning = 16
+	// at most this many finished jobs are kept, the oldest is dropped first
+	maxFinished = 64
+)
+
+type job struct {
+	id       string
+	session  string
+	tool     string
+	started  time.Time
+	finished time.Time
+	done     chan struct{}
+	result   *mcp.CallToolResult
+	err      error
+}
+
+// Manager runs the calls of the write tools which pass background in the
+// background and returns a job id at once, get_job reports their outcome.
+// A nil Manager runs all calls as they are.
+type Manager struct {
+	retention time.Duration
+
+	mu    sync.Mutex
+	tools []string
+	jobs  map[string]*job
+}
+
+// New returns a manager which keeps the results of the finished jobs for
+// the retention, nil if retention isn't positive
+func New(retention time.Duration) *Manager {
+	if retention <= 0 {
+		return nil
+	}
+	return &Manager{retention: retention, jobs: make(map[string]*job)}
+}
+
+// SetTools sets the tools which can run in the background
+func (m *Manager) SetTools(tools []string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tools = slices.Clone(tools)
+}
+
+func (m *Manager) hasTool(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Contains(m.tools, name)
+}
+
+func paramSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		Type:        "boolean",
+		Description: fmt.Sprintf("Return a job id at once and run the call in the background instead of waiting for it, %s reports its status and result", ToolName),
+	}
+}
+
+// withParam returns a copy of the tool with the background parameter
+func withParam(tool *mcp.Tool) *mcp.Tool {
+	schema, ok := tool.InputSchema.(*jsonschema.Schema)
+	if !ok || schema == nil {
+		return tool
+	}
+	if _, ok := schema.Properties[ParamName]; ok {
+		return tool
+	}
+	s := *schema
+	s.Properties = maps.Clone(schema.Properties)
+	if s.Properties == nil {
+		s.Properties = make(map[string]*jsonschema.Schema)
+	}
+	s.Properties[ParamName] = paramSchema()
+	t := *tool
+	t.InputSchema = &s
+	return &t
+}
+
+// takeParam removes the background parameter from the arguments of the
+// call and returns whether it was set
+func takeParam(params *mcp.CallToolParamsRaw) (bool, error) {
+	var args map[string]json.RawMessage
+	if params == nil || json.Unmarshal(params.Arguments, &args) != nil {
+		return false, nil
+	}
+	raw, ok := args[ParamName]
+	if !ok {
+		return false, nil
+	}
+	var background bool
+	if err := json.Unmarshal(raw, &background); err != nil {
+		return false, fmt.Errorf("%s must be a boolean", ParamName)
+	}
+	delete(args, ParamName)
+	data, err := json.Marshal(args)
+	if err != nil {
+		return false, err
+	}
+	params.Arguments = data
+	return background, nil
+}
+
+// Middleware adds the background parameter to the tools of the manager and
+// starts the calls which set it as jobs
+func (m *Manager) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	if m == nil {
+		return next
+	}
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		switch method {
+		case "tools/list":
+			res, err := next(ctx, method, req)
+			if list, ok := res.(*mcp.ListToolsResult); ok && err == nil {
+				tools := make([]*mcp.Tool, len(list.Tools))
+				for i, tool := range list.Tools {
+					tools[i] = tool
+					if m.hasTool(tool.Name) {
+						tools[i] = withParam(tool)
+					}
+				}
+				list.Tools = tools
+			}
+			return res, err
+		case "tools/call":
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok || call.Params == nil || !m.hasTool(call.Params.Name) {
+				return next(ctx, method, req)
+			}
+			background, err := takeParam(call.Params)
+			if err != nil {
+				return nil, err
+			}
+			if !background {
+				return next(ctx, method, req)
+			}
+			j, err := m.start(ctx, call, next)
+			if err != nil {
+				return nil, err
+			}
+			return jobResult(j, m.retention)
+		}
+		return next(ctx, method, req)
+	}
+}
+
+func newID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// start runs the call in the background. The job keeps the values of the
+// context, like the authorization of the call, but isn't cancelled with it.
+func (m *Manager) start(ctx context.Context, call *mcp.CallToolRequest, next mcp.MethodHandler) (*job, error) {
+	j := &job{
+		id:      newID(),
+		session: sessionid.FromRequest(call),
+		tool:    call.Params.Name,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.prune()
+	running := 0
+	for _, other := range m.jobs {
+		if other.finished.IsZero() {
+			running++
+		}
+	}
+	if running >= maxRunning {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%d background jobs are running already, wait for them with %s", running, ToolName)
+	}
+	m.jobs[j.id] = j
+	m.mu.Unlock()
+
+	// the client doesn't wait for progress of the answered call
+	params := *call.Params
+	params.Meta = maps.Clone(call.Params.Meta)
+	delete(params.Meta, "progressToken")
+	bg := &mcp.CallToolRequest{Session: call.Session, Params: &params, Extra: call.Extra}
+	ctx = context.WithoutCancel(ctx)
+	// the audit log gets the outcome of the job, not of its submission
+	finish := audit.Defer(ctx, j.id)
+	slog.InfoContext(ctx, "background job started", "job", j.id, "tool", j.tool, "session", j.session)
+	go func() {
+		res, err := next(ctx, "tools/call", bg)
+		finish(res, err)
+		result, _ := res.(*mcp.CallToolResult)
+		m.mu.Lock()
+		j.result, j.err, j.finished = result, err, time.Now()
+		m.mu.Unlock()
+		close(j.done)
+		if err != nil || (result != nil && result.IsError) {
+			slog.WarnContext(ctx, "background job failed", "audit", "job_failed", "job", j.id, "tool", j.tool, "session", j.session, "error", err)
+		} else {
+			slog.InfoContext(ctx, "background job finished", "audit", "job_finished", "job", j.id, "tool", j.tool, "session", j.session)
+		}
+	}()
+	return j, nil
+}
+
+// prune drops the finished jobs after the retention and the oldest ones
+// above maxFinished, m.mu has to be held
+func (m *Manager) prune() {
+	now := time.Now()
+	var finished []*job
+	for id, j := range m.jobs {
+		if j.finished.IsZero() {
+			continue
+		}
+		if now.Sub(j.finished) > m.retention {
+			delete(m.jobs, id)
+			continue
+		}
+		finished = append(finished, j)
+	}
+	if len(finished) < maxFinished {
+		return
+	}
+	slices.SortFunc(finished, func(a, b *job) int { return a.finished.Compare(b.finished) })
+	for _, j := range finished[:len(finished)-maxFinished+1] {
+		delete(m.jobs, j.id)
+	}
+}
+
+// Status is the state of a job as returned by the tools
+type Status struct {
+	JobID    string `json:"job_id"`
+	Tool     string `json:"tool"`
+	Status   string `json:"status"`
+	Started  string `json:"started"`
+	Finished string `json:"finished,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// status returns the state of the job, m.mu has to be held
+func (j *job) status() Status {
+	s := Status{JobID: j.id, Tool: j.tool, Status: Running, Started: j.started.Format(time.RFC3339Nano)}
+	if j.finished.IsZero() {
+		return s
+	}
+	s.Finished = j.finished.Format(time.RFC3339Nano)
+	s.Status = Succeeded
+	if j.err != nil {
+		s.Status = Failed
+		s.Error = j.err.Error()
+	} else if j.result == nil || j.result.IsError {
+		s.Status = Failed
+	}
+	return s
+}
+
+func jsonContent(v any) (*mcp.TextContent, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.TextContent{Text: string(data)}, nil
+}
+
+// jobResult is the answer to the call which started the job, the job may
+// have finished already
+func jobResult(j *job, retention time.Duration) (*mcp.CallToolResult, error) {
+	s := Status{JobID: j.id, Tool: j.tool, Status: Running, Started: j.started.Format(time.RFC3339Nano)}
+	s.Message = fmt.Sprintf("%s runs in the background, call %s with the job_id for its status and result, which is kept for %s after it finished", j.tool, ToolName, retention)
+	text, err := jsonContent(s)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.CallToolResult{Content: []mcp.Content{text}}, nil
+}
+
+// GetParams are the parameters of get_job
+type GetParams struct {
+	JobID string `json:"job_id" jsonschema:"The job_id returned by the call which was run in the background"`
+	Wait  uint   `json:"wait,omitempty" jsonschema:"Seconds to wait for a running job to finish before its status is returned, at most 60 (default 0)"`
+}
+
+// Get returns the status of a job of the same session, followed by the
+// content of its result once it finished
+func (m *Manager) Get(ctx context.Context, req *mcp.CallToolRequest, params *GetParams) (*mcp.CallToolResult, any, error) {
+	var session string
+	if req != nil {
+		session = sessionid.FromRequest(req)
+	}
+	m.mu.Lock()
+	m.prune()
+	j, ok := m.jobs[params.JobID]
+	m.mu.Unlock()
+	if !ok || j.session != session {
+		return nil, nil, fmt.Errorf("unknown or expired job %q", params.JobID)
+	}
+	if params.Wait > 0 {
+		timer := time.NewTimer(time.Duration(min(params.Wait, MaxWait)) * time.Second)
+		defer timer.Stop()
+		select {
+		case <-j.done:
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	m.mu.Lock()
+	s := j.status()
+	result := j.result
+	m.mu.Unlock()
+	text, err := jsonContent(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := &mcp.CallToolResult{Content: []mcp.Content{text}}
+	if result != nil {
+		res.Content = append(res.Content, result.Content...)
+		res.IsError = result.IsError
+	}
+	return res, nil, nil
+}
@@ -0,0 +1,139 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// status decodes the status of a job from the first content of a result
+func status(t *testing.T, res *mcp.CallToolResult) Status {
+	t.Helper()
+	var s Status
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &s))
+	return s
+}
+
+func callTool(name string, args string) *mcp.CallToolRequest {
+	return &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: name, Arguments: json.RawMessage(args)}}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New(time.Hour)
+	m.SetTools([]string{"change_unit_state"})
+	release := make(chan struct{})
+	var gotArgs []string
+	handler := m.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call := req.(*mcp.CallToolRequest)
+		gotArgs = append(gotArgs, string(call.Params.Arguments))
+		if call.Params.Name == "change_unit_state" && ctx.Err() == nil {
+			<-release
+		}
+		if string(call.Params.Arguments) == `{"name":"bad.service"}` {
+			return nil, errors.New("unit bad.service not found")
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil
+	})
+
+	// calls without background and other tools are run as they are
+	res, err := handler(context.Background(), "tools/call", callTool("list_log", `{"background":true}`))
+	require.NoError(t, err)
+	assert.Equal(t, "done", res.(*mcp.CallToolResult).Content[0].(*mcp.TextContent).Text)
+	assert.Equal(t, `{"background":true}`, gotArgs[0])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err = handler(ctx, "tools/call", callTool("change_unit_state", `{"background":true,"name":"slow.service"}`))
+	require.NoError(t, err)
+	cancel()
+	started := status(t, res.(*mcp.CallToolResult))
+	assert.Equal(t, Running, started.Status)
+	assert.Equal(t, "change_unit_state", started.Tool)
+	assert.NotEmpty(t, started.JobID)
+
+	got, _, err := m.Get(context.Background(), nil, &GetParams{JobID: started.JobID})
+	require.NoError(t, err)
+	assert.Equal(t, Running, status(t, got).Status)
+	assert.Len(t, got.Content, 1)
+
+	// the job isn't cancelled with the call which started it
+	close(release)
+	got, _, err = m.Get(context.Background(), nil, &GetParams{JobID: started.JobID, Wait: 5})
+	require.NoError(t, err)
+	finished := status(t, got)
+	assert.Equal(t, Succeeded, finished.Status)
+	assert.NotEmpty(t, finished.Finished)
+	require.Len(t, got.Content, 2)
+	assert.Equal(t, "done", got.Content[1].(*mcp.TextContent).Text)
+	assert.Equal(t, `{"name":"slow.service"}`, gotArgs[1], "the background parameter is removed")
+
+	res, err = handler(context.Background(), "tools/call", callTool("change_unit_state", `{"background":true,"name":"bad.service"}`))
+	require.NoError(t, err)
+	got, _, err = m.Get(context.Background(), nil, &GetParams{JobID: status(t, res.(*mcp.CallToolResult)).JobID, Wait: 5})
+	require.NoError(t, err)
+	failed := status(t, got)
+	assert.Equal(t, Failed, failed.Status)
+	assert.Equal(t, "unit bad.service not found", failed.Error)
+
+	_, _, err = m.Get(context.Background(), nil, &GetParams{JobID: "unknown"})
+	assert.Error(t, err)
+	_, err = handler(context.Background(), "tools/call", callTool("change_unit_state", `{"background":"yes"}`))
+	assert.Error(t, err)
+}
+
+func TestToolsList(t *testing.T) {
+	m := New(time.Hour)
+	m.SetTools([]string{"change_unit_state"})
+	schema := &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{"name": {Type: "string"}}}
+	handler := m.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		return &mcp.ListToolsResult{Tools: []*mcp.Tool{
+			{Name: "change_unit_state", InputSchema: schema},
+			{Name: "list_log", InputSchema: schema},
+		}}, nil
+	})
+	res, err := handler(context.Background(), "tools/list", &mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	tools := res.(*mcp.ListToolsResult).Tools
+	assert.Contains(t, tools[0].InputSchema.(*jsonschema.Schema).Properties, ParamName)
+	assert.NotContains(t, tools[1].InputSchema.(*jsonschema.Schema).Properties, ParamName)
+	assert.NotContains(t, schema.Properties, ParamName, "the schema of the tool isn't changed")
+}
+
+func TestRunningLimit(t *testing.T) {
+	defer func(n int) { maxRunning = n }(maxRunning)
+	maxRunning = 1
+	m := New(time.Hour)
+	m.SetTools([]string{"change_unit_state"})
+	release := make(chan struct{})
+	defer close(release)
+	handler := m.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		<-release
+		return &mcp.CallToolResult{}, nil
+	})
+	_, err := handler(context.Background(), "tools/call", callTool("change_unit_state", `{"background":true}`))
+	require.NoError(t, err)
+	_, err = handler(context.Background(), "tools/call", callTool("change_unit_state", `{"background":true}`))
+	assert.Error(t, err)
+}
+
+func TestPrune(t *testing.T) {
+	defer func(n int) { maxFinished = n }(maxFinished)
+	maxFinished = 2
+	m := New(time.Hour)
+	now := time.Now()
+	m.jobs["old"] = &job{id: "old", finished: now.Add(-2 * time.Hour)}
+	m.jobs["a"] = &job{id: "a", finished: now.Add(-time.Minute)}
+	m.jobs["b"] = &job{id: "b", finished: now}
+	m.jobs["running"] = &job{id: "running"}
+	m.prune()
+	assert.NotContains(t, m.jobs, "old", "expired")
+	assert.NotContains(t, m.jobs, "a", "the oldest above the limit")
+	assert.Contains(t, m.jobs, "b")
+	assert.Contains(t, m.jobs, "running")
+}
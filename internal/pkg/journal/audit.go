@@ -0,0 +1,109 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/audit"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
+)
+
+type ListAuditLogParams struct {
+	Count        int       `json:"count,omitempty" jsonschema:"Number of audit entries to return, newest first"`
+	Since        time.Time `json:"since,omitempty" jsonschema:"Only return entries newer than this time"`
+	Tool         string    `json:"tool,omitempty" jsonschema:"Only return the calls of this tool, e.g. change_unit_state"`
+	User         string    `json:"user,omitempty" jsonschema:"Only return the calls of this user"`
+	FailuresOnly bool      `json:"failures_only,omitempty" jsonschema:"Only return the calls which failed or were denied"`
+}
+
+type ListAuditLogResult struct {
+	NrEntries int           `json:"nr_entries"`
+	Entries   []audit.Entry `json:"entries"`
+}
+
+func CreateListAuditLogSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListAuditLogParams](nil)
+	inputSchema.Properties["count"].Default = json.RawMessage(`50`)
+	return inputSchema
+}
+
+// ListAuditLog returns the audit trail of the write tools from the journal
+func (sj *HostLog) ListAuditLog(ctx context.Context, req *mcp.CallToolRequest, params *ListAuditLogParams) (*mcp.CallToolResult, any, error) {
+	allowed, err := sj.self_init(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	sj.journal.FlushMatches()
+	matches := []string{"MESSAGE_ID=" + audit.MessageID}
+	if params.Tool != "" {
+		matches = append(matches, audit.FieldTool+"="+params.Tool)
+	}
+	if params.User != "" {
+		matches = append(matches, audit.FieldUser+"="+params.User)
+	}
+	for _, match := range matches {
+		if err := sj.journal.AddMatch(match); err != nil {
+			return nil, nil, fmt.Errorf("failed to add filter: %w", err)
+		}
+	}
+	if err := sj.journal.SeekTail(); err != nil {
+		return nil, nil, fmt.Errorf("failed to seek to end: %w", err)
+	}
+
+	count := params.Count
+	if count <= 0 {
+		count = 50
+	}
+	entries := []audit.Entry{}
+	_, span := tracing.Start(ctx, "journal iteration", tracing.KindInternal)
+	defer span.End(nil)
+	for len(entries) < count {
+		ret, err := sj.journal.Previous()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read previous entry: %w", err)
+		}
+		if ret == 0 {
+			break
+		}
+		entry, err := sj.journal.GetEntry()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get audit entry: %w", err)
+		}
+		for k, v := range entry.Fields {
+			cost.AddBytes(ctx, len(k)+len(v))
+		}
+		timestamp := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+		if !params.Since.IsZero() && timestamp.Before(params.Since) {
+			break
+		}
+		e := audit.FromFields(entry.Fields)
+		if params.FailuresOnly && e.Result == "success" {
+			continue
+		}
+		e.Time = timestamp
+		entries = append(entries, e)
+	}
+	span.SetAttr("journal.returned", len(entries))
+	span.End(nil)
+
+	jsonBytes, err := json.Marshal(ListAuditLogResult{NrEntries: len(entries), Entries: entries})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,78 @@
+package journal
+
+import "encoding/json"
+
+const (
+	// maxEntries caps the count of list_log, so that a call can't hold an
+	// unbounded number of entries
+	maxEntries = 10000
+	// resultOverhead is the room kept in the response budget for the fields
+	// of the result next to the messages, like the documentation
+	resultOverhead = 512
+)
+
+type bufferedEntry struct {
+	msg      LogOutput
+	size     int
+	redacted int
+}
+
+// logBuffer holds the entries of list_log up to a size in bytes, so that
+// the scan stops or drops entries as soon as the result wouldn't fit into
+// the response budget. For the last entries of the log the oldest entries
+// are dropped for the newer ones, when following a cursor no further
+// entries are accepted, as the cursor would skip the dropped ones.
+type logBuffer struct {
+	entries    []bufferedEntry
+	start      int
+	size       int
+	maxBytes   int // 0 is unlimited
+	keepNewest bool
+	dropped    int
+}
+
+func newLogBuffer(maxBytes int, keepNewest bool) *logBuffer {
+	return &logBuffer{maxBytes: maxBytes, keepNewest: keepNewest}
+}
+
+// add adds an entry and returns false if it doesn't fit, which only
+// happens if the newest entries aren't kept. The first entry always fits.
+func (b *logBuffer) add(msg LogOutput, redacted int) bool {
+	encoded, _ := json.Marshal(msg)
+	size := len(encoded) + 1
+	if b.maxBytes > 0 && !b.keepNewest && b.len() > 0 && b.size+size > b.maxBytes {
+		return false
+	}
+	b.entries = append(b.entries, bufferedEntry{msg: msg, size: size, redacted: redacted})
+	b.size += size
+	for b.maxBytes > 0 && b.size > b.maxBytes && b.len() > 1 {
+		b.size -= b.entries[b.start].size
+		b.entries[b.start] = bufferedEntry{}
+		b.start++
+		b.dropped++
+	}
+	// reuse the array instead of growing it behind the dropped entries
+	if b.start > len(b.entries)/2 {
+		n := copy(b.entries, b.entries[b.start:])
+		clear(b.entries[n:])
+		b.entries = b.entries[:n]
+		b.start = 0
+	}
+	return true
+}
+
+func (b *logBuffer) len() int {
+	return len(b.entries) - b.start
+}
+
+// messages returns the entries in the buffer and the number of their
+// redactions
+func (b *logBuffer) messages() ([]LogOutput, int) {
+	messages := make([]LogOutput, 0, b.len())
+	redacted := 0
+	for _, entry := range b.entries[b.start:] {
+		messages = append(messages, entry.msg)
+		redacted += entry.redacted
+	}
+	return messages, redacted
+}
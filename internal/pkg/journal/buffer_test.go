@@ -0,0 +1,56 @@
+package journal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func entry(msg string) LogOutput {
+	return LogOutput{Identifier: "sshd", Msg: msg}
+}
+
+func TestLogBufferKeepsNewest(t *testing.T) {
+	buf := newLogBuffer(300, true)
+	for i := range 20 {
+		assert.True(t, buf.add(entry(strings.Repeat("x", 40)+string(rune('a'+i))), i%2))
+	}
+	messages, redacted := buf.messages()
+	assert.Less(t, len(messages), 20)
+	assert.Equal(t, 20-len(messages), buf.dropped)
+	assert.LessOrEqual(t, buf.size, 300)
+	assert.True(t, strings.HasSuffix(messages[len(messages)-1].Msg, "t"), "the newest entry is kept")
+	// the redactions of the dropped entries aren't counted
+	assert.LessOrEqual(t, redacted, len(messages))
+
+	// an entry bigger than the budget is still returned
+	buf.add(entry(strings.Repeat("y", 1000)), 0)
+	messages, _ = buf.messages()
+	assert.Len(t, messages, 1)
+}
+
+func TestLogBufferStops(t *testing.T) {
+	buf := newLogBuffer(300, false)
+	assert.True(t, buf.add(entry(strings.Repeat("y", 1000)), 0), "the first entry always fits")
+	assert.False(t, buf.add(entry("next"), 0))
+
+	buf = newLogBuffer(300, false)
+	added := 0
+	for buf.add(entry(strings.Repeat("x", 40)), 0) {
+		added++
+	}
+	messages, _ := buf.messages()
+	assert.Len(t, messages, added)
+	assert.Equal(t, 0, buf.dropped)
+	assert.LessOrEqual(t, buf.size, 300)
+}
+
+func TestLogBufferUnlimited(t *testing.T) {
+	buf := newLogBuffer(0, true)
+	for range 1000 {
+		buf.add(entry("message"), 0)
+	}
+	messages, _ := buf.messages()
+	assert.Len(t, messages, 1000)
+}
@@ -0,0 +1,92 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// the cursors are dropped if more keys are stored
+const maxStoredCursors = 10000
+
+// cursorStore remembers the cursor of the newest entry returned to a session
+// for a set of units, so that the next call only returns newer entries
+type cursorStore struct {
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+func cursorKey(sessionID string, units []string) string {
+	return sessionID + "\x00" + strings.Join(units, "\x00")
+}
+
+func (c *cursorStore) get(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cursors[key]
+}
+
+func (c *cursorStore) set(key, cursor string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cursors == nil || len(c.cursors) >= maxStoredCursors {
+		c.cursors = make(map[string]string)
+	}
+	c.cursors[key] = cursor
+}
+
+// validCursor matches the cursors of the journal, which are fields of hex
+// numbers like s=...;i=...;b=...
+var validCursor = regexp.MustCompile(`^[a-z]=[0-9a-f]+(;[a-z]=[0-9a-f]+)*$`)
+
+// startCursor returns the cursor after which list_log continues, the one
+// passed by the caller or the one stored for the session, or "" to return
+// the newest entries
+func startCursor(params *ListLogParams, cursors *cursorStore, key string) (string, error) {
+	if params.AfterCursor != "" {
+		if !validCursor.MatchString(params.AfterCursor) {
+			return "", fmt.Errorf("invalid cursor %q, pass the cursor of an earlier result", params.AfterCursor)
+		}
+		return params.AfterCursor, nil
+	}
+	if params.SinceLastCall {
+		return cursors.get(key), nil
+	}
+	return "", nil
+}
+
+// moreEntriesHint tells the caller how to continue after a cursor when the
+// result was full
+func moreEntriesHint(params *ListLogParams) string {
+	if params.AfterCursor != "" {
+		return "there may be more new entries, call again with the cursor of this result as after_cursor to get them"
+	}
+	return "there may be more new entries, call again to get them"
+}
+
+// LastCursor returns the cursor of the newest entry of a unit, which
+// changes whenever the unit logs. The journal is read by journalctl with the
+// privileges of the server, so it may only be used to detect changes.
+func (sj *HostLog) LastCursor(ctx context.Context, unit string) (string, error) {
+	args := []string{"--unit=" + unit, "--lines=1", "--output=cat", "--show-cursor", "--quiet", "--no-pager"}
+	if sj.Dir != "" {
+		args = append(args, "--directory="+sj.Dir)
+	}
+	out, err := exec.CommandContext(ctx, "journalctl", args...).Output()
+	if err != nil {
+		return "", err
+	}
+	return parseCursor(string(out)), nil
+}
+
+// parseCursor returns the cursor printed by journalctl --show-cursor
+func parseCursor(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if cursor, ok := strings.CutPrefix(lines[len(lines)-1], "-- cursor: "); ok {
+		return cursor
+	}
+	return ""
+}
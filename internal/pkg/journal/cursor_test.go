@@ -0,0 +1,48 @@
+package journal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorStore(t *testing.T) {
+	var store cursorStore
+	key := cursorKey("session1", []string{"sshd.service"})
+	assert.Empty(t, store.get(key))
+
+	store.set(key, "s=abc;i=1")
+	assert.Equal(t, "s=abc;i=1", store.get(key))
+	assert.Empty(t, store.get(cursorKey("session2", []string{"sshd.service"})))
+	assert.Empty(t, store.get(cursorKey("session1", nil)))
+
+	store.set(key, "s=abc;i=2")
+	assert.Equal(t, "s=abc;i=2", store.get(key))
+}
+
+func TestParseCursor(t *testing.T) {
+	assert.Equal(t, "s=abc;i=2", parseCursor("Started db.service.\n-- cursor: s=abc;i=2\n"))
+	assert.Empty(t, parseCursor(""))
+	assert.Empty(t, parseCursor("Started db.service.\n"))
+}
+
+func TestStartCursor(t *testing.T) {
+	var store cursorStore
+	key := cursorKey("session1", nil)
+	store.set(key, "s=abc;i=1")
+
+	cursor, err := startCursor(&ListLogParams{}, &store, key)
+	assert.NoError(t, err)
+	assert.Empty(t, cursor)
+	cursor, _ = startCursor(&ListLogParams{SinceLastCall: true}, &store, key)
+	assert.Equal(t, "s=abc;i=1", cursor)
+
+	params := &ListLogParams{SinceLastCall: true, AfterCursor: "s=abc;i=7;b=0f;m=1a;t=2b;x=3c"}
+	cursor, err = startCursor(params, &store, key)
+	assert.NoError(t, err)
+	assert.Equal(t, params.AfterCursor, cursor, "the cursor of the caller takes precedence")
+	assert.Contains(t, moreEntriesHint(params), "after_cursor")
+
+	_, err = startCursor(&ListLogParams{AfterCursor: "s=abc;i=1' --since=yesterday"}, &store, key)
+	assert.ErrorContains(t, err, "invalid cursor")
+}
@@ -20,29 +20,44 @@ import (
 	"github.com/coreos/go-systemd/v22/sdjournal"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/budget"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/man"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/progress"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/sdjournalw"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sessionid"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
 )
 
 type HostLog struct {
 	journal *sdjournal.Journal
 	Auth    auth.AuthKeeper
+	// Dir is read instead of the journal of the system if set, e.g. the
+	// journal of the host mounted into a container
+	Dir     string
+	cursors cursorStore
 }
 
-// Close the log and underlying journal
+// Close the log and underlying journal, if it was opened
 func (log *HostLog) Close() error {
+	if log.journal == nil {
+		return nil
+	}
 	return log.journal.Close()
 }
 
 type ListLogParams struct {
-	Count     int       `json:"count,omitempty" jsonschema:"Number of log lines to output"`
-	Offset    int       `json:"offset,omitempty" jsonschema:"Number of newest log entries to skip for pagination"`
-	From      time.Time `json:"from,omitempty" jsonschema:"Start time for filtering logs"`
-	To        time.Time `json:"to,omitempty" jsonschema:"End time for filtering logs "`
-	Pattern   string    `json:"pattern,omitempty" jsonschema:"Regular expression pattern to filter log messages or units."`
-	Unit      []string  `json:"unit,omitempty" jsonschema:"Names of the service/unit from which to get the logs. Without an unit name the entries of all units are returned. The first field treated a regular expression if not set otherwise"`
-	ExactUnit bool      `json:"exact_unit,omitempty" jsonschema:"Treat the first name unit as exact idendtifier and not as regular expression"`
-	AllBoots  bool      `json:"allboots,omitempty" jsonschema:"Get the log entries from all boots, not just the active one"`
+	Count         int       `json:"count,omitempty" jsonschema:"Number of log lines to output, at most 10000"`
+	Offset        int       `json:"offset,omitempty" jsonschema:"Number of newest log entries to skip for pagination"`
+	From          time.Time `json:"from,omitempty" jsonschema:"Start time for filtering logs"`
+	To            time.Time `json:"to,omitempty" jsonschema:"End time for filtering logs "`
+	Pattern       string    `json:"pattern,omitempty" jsonschema:"Regular expression pattern to filter log messages or units."`
+	Unit          []string  `json:"unit,omitempty" jsonschema:"Names of the service/unit from which to get the logs. Without an unit name the entries of all units are returned. The first field treated a regular expression if not set otherwise"`
+	ExactUnit     bool      `json:"exact_unit,omitempty" jsonschema:"Treat the first name unit as exact idendtifier and not as regular expression"`
+	AllBoots      bool      `json:"allboots,omitempty" jsonschema:"Get the log entries from all boots, not just the active one"`
+	SinceLastCall bool      `json:"since_cursor_of_last_call,omitempty" jsonschema:"Only return the entries which are newer than the newest entry returned by the last call of this session for the same units. The first call returns the last entries as usual."`
+	AfterCursor   string    `json:"after_cursor,omitempty" jsonschema:"Only return the entries after the entry of this cursor, as returned in the cursor of an earlier result, to read only the new entries since then. Takes precedence over since_cursor_of_last_call and offset."`
 }
 
 type LogOutput struct {
@@ -69,6 +84,8 @@ type ListLogResult struct {
 	Messages      []LogOutput `json:"messages"`
 	Identifier    string      `json:"identifier,omitempty"`
 	UnitName      string      `json:"unit_name,omitempty"`
+	Cursor        string      `json:"cursor,omitempty"`
+	Redacted      int         `json:"redacted,omitempty"`
 }
 
 var validManSection = regexp.MustCompile(man.ValidManSectionPattern)
@@ -142,7 +159,11 @@ func (sj *HostLog) seekByTimeRange(params *ListLogParams) error {
 }
 
 func (sj *HostLog) isJournalGroupMember() bool {
-	info, err := os.Stat("/var/log/journal")
+	dir := sj.Dir
+	if dir == "" {
+		dir = "/var/log/journal"
+	}
+	info, err := os.Stat(dir)
 	if err != nil {
 		return false
 	}
@@ -181,6 +202,13 @@ func (sj *HostLog) isJournalGroupMember() bool {
 func (sj *HostLog) self_init(ctx context.Context) (allowed bool, err error) {
 	if sj.journal != nil {
 		return sj.Auth.IsReadAuthorized(ctx)
+	} else if sj.Dir != "" {
+		// the files of the directory can't be passed by the gatekeeper
+		j, err := sdjournal.NewJournalFromDir(sj.Dir)
+		if err != nil {
+			return false, fmt.Errorf("failed to open journal in %s: %w", sj.Dir, err)
+		}
+		sj.journal = j
 	} else if os.Geteuid() == 0 || sj.isJournalGroupMember() {
 		// running as root or in journal group, ask via oauth2 is read is authorized, if yes
 		// and journal isn't opened, open it
@@ -246,6 +274,63 @@ func (sj *HostLog) self_init(ctx context.Context) (allowed bool, err error) {
 	return true, nil
 }
 
+// readEntry reads the fields of the current entry which list_log returns,
+// ok is false if the entry is filtered out. Only with a pattern all fields
+// of the entry are read.
+func (sj *HostLog) readEntry(ctx context.Context, params *ListLogParams, pattern *regexp.Regexp) (msg LogOutput, ok bool, err error) {
+	usec, err := sj.journal.GetRealtimeUsec()
+	if err != nil {
+		return msg, false, fmt.Errorf("failed to get log entry for %v", params.Unit)
+	}
+	timestamp := time.Unix(0, int64(usec)*int64(time.Microsecond))
+	if !params.To.IsZero() && timestamp.Before(params.To) {
+		return msg, false, nil
+	}
+	if !params.From.IsZero() && timestamp.After(params.From) {
+		return msg, false, nil
+	}
+
+	field := func(name string) string {
+		value, err := sj.journal.GetDataValue(name)
+		if err != nil {
+			// the entry doesn't have the field
+			return ""
+		}
+		cost.AddBytes(ctx, len(name)+len(value))
+		return value
+	}
+	if pattern != nil {
+		entry, err := sj.journal.GetEntry()
+		if err != nil {
+			return msg, false, fmt.Errorf("failed to get log entry for %v", params.Unit)
+		}
+		matched := false
+		for k, v := range entry.Fields {
+			cost.AddBytes(ctx, len(k)+len(v))
+			matched = matched || pattern.MatchString(v)
+		}
+		if !matched {
+			return msg, false, nil
+		}
+		field = func(name string) string { return entry.Fields[name] }
+	}
+
+	msg = LogOutput{
+		Identifier: field("SYSLOG_IDENTIFIER"),
+		UnitName:   field("_SYSTEMD_UNIT"),
+		ExeName:    field("_EXE"),
+		Msg:        field("MESSAGE"),
+		Time:       timestamp,
+	}
+	if params.AllBoots {
+		msg.Boot = field("_BOOT_ID")
+	}
+	if msg.Identifier == "" {
+		msg.Identifier = fmt.Sprintf("%s:%s", msg.UnitName, field("_SYSTEMD_USER_UNIT"))
+	}
+	return msg, true, nil
+}
+
 // get the lat log entries for a given unit, else just the last messages
 func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params *ListLogParams) (*mcp.CallToolResult, any, error) {
 	// always init the host log via self initialization, not via init or
@@ -256,6 +341,8 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 	if !allowed {
 		return nil, nil, fmt.Errorf("calling method was canceled by user")
 	}
+	ctx, cancel := withScanTimeout(ctx)
+	defer cancel()
 	sj.journal.FlushMatches()
 	if len(params.Unit) > 0 {
 		firstUnit := params.Unit[0]
@@ -272,6 +359,9 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 			fields := []string{"SYSLOG_IDENTIFIER", "_SYSTEMD_USER_UNIT", "_SYSTEMD_UNIT"}
 			added := false
 			for _, field := range fields {
+				if ctx.Err() != nil {
+					return nil, nil, scanCtxErr(ctx)
+				}
 				values, err := sj.journal.GetUniqueValues(field)
 				if err != nil {
 					continue
@@ -331,8 +421,33 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 		}
 	}
 
-	// Handle time-based filtering
-	if !params.From.IsZero() || !params.To.IsZero() {
+	key := cursorKey(sessionid.FromRequest(req), params.Unit)
+	lastCursor, err := startCursor(params, &sj.cursors, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	noNewEntries := false
+	if lastCursor != "" {
+		// continue after the entry returned last
+		if err := sj.journal.SeekCursor(lastCursor); err != nil {
+			return nil, nil, fmt.Errorf("failed to seek to cursor: %w", err)
+		}
+		ret, err := sj.journal.Next()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
+		}
+		// the entry of the cursor was already returned, but if it doesn't
+		// match the filters anymore we are already on a newer entry
+		if ret != 0 && sj.journal.TestCursor(lastCursor) == nil {
+			ret, err = sj.journal.Next()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
+			}
+		}
+		noNewEntries = ret == 0
+	} else if !params.From.IsZero() || !params.To.IsZero() {
+		// Handle time-based filtering
 		err = sj.seekByTimeRange(params)
 		if err != nil {
 			return nil, nil, err
@@ -345,12 +460,6 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 		}
 	}
 
-	var messages []LogOutput
-	uniqIdentifiers := make(map[string]bool)
-	uniqIdentifiersStr := ""
-	uniqUnitName := make(map[string]bool)
-	uniqUnitNameStr := ""
-	uniqExeName := make(map[string]bool)
 	host, _ := os.Hostname()
 
 	var regexPattern *regexp.Regexp
@@ -367,89 +476,47 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 	if maxCount <= 0 {
 		maxCount = 100
 	}
-
-	for {
-		entry, err := sj.journal.GetEntry()
+	maxCount = min(maxCount, maxEntries)
+	// the entries are dropped or the scan stops once they don't fit into
+	// the response budget, instead of reading them all and cutting the result
+	maxBytes := 0
+	if limit := budget.Limit(ctx); limit > 0 {
+		maxBytes = max(limit-resultOverhead, limit/2)
+	}
+	buf := newLogBuffer(maxBytes, lastCursor == "")
+	full := false
+
+	newestCursor := lastCursor
+	// filters may scan many more entries than are returned
+	reporter := progress.New(req, 0)
+	scanned := 0
+	_, span := tracing.Start(ctx, "journal iteration", tracing.KindInternal)
+	defer span.End(nil)
+	for !noNewEntries {
+		// a cancelled call stops the scan instead of running to its end
+		if ctx.Err() != nil {
+			return nil, nil, scanCtxErr(ctx)
+		}
+		scanned++
+		reporter.Report(ctx, float64(scanned), fmt.Sprintf("scanned %d entries, found %d of %d", scanned, collectedCount, maxCount))
+		msg, ok, err := sj.readEntry(ctx, params, regexPattern)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to get log entry for %v", params.Unit)
+			return nil, nil, err
 		}
-
-		timestamp := time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
-
-		if !params.To.IsZero() && timestamp.Before(params.To) {
-
-			ret, err := sj.journal.Next()
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
-			}
-			if ret == 0 {
+		if ok {
+			var n int
+			msg.Msg, n = redact.Get().Redact(msg.Msg)
+			if !buf.add(msg, n) {
+				full = true
 				break
 			}
-			continue
-		}
-
-		if !params.From.IsZero() && timestamp.After(params.From) {
-			ret, err := sj.journal.Next()
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
+			if newestCursor, err = sj.journal.GetCursor(); err != nil {
+				return nil, nil, fmt.Errorf("failed to get cursor: %w", err)
 			}
-			if ret == 0 {
+			collectedCount++
+			if collectedCount >= maxCount {
 				break
 			}
-			continue
-		}
-
-		if regexPattern != nil {
-			var messages strings.Builder
-			for _, v := range entry.Fields {
-				messages.WriteString(v)
-			}
-			if !regexPattern.MatchString(messages.String()) {
-				ret, err := sj.journal.Next()
-				if err != nil {
-					return nil, nil, fmt.Errorf("failed to read next entry: %w", err)
-				}
-				if ret == 0 {
-					break
-				}
-				continue
-			}
-		}
-
-		structEntr := LogOutput{
-			Identifier: entry.Fields["SYSLOG_IDENTIFIER"],
-			UnitName:   entry.Fields["_SYSTEMD_UNIT"],
-			ExeName:    entry.Fields["_EXE"],
-			Time:       timestamp,
-			Msg:        entry.Fields["MESSAGE"],
-		}
-		if _, ok := uniqIdentifiers[entry.Fields["SYSLOG_IDENTIFIER"]]; !ok {
-			uniqIdentifiers[entry.Fields["SYSLOG_IDENTIFIER"]] = true
-			uniqIdentifiersStr = entry.Fields["SYSLOG_IDENTIFIER"]
-		}
-		if _, ok := uniqUnitName[entry.Fields["_SYSTEMD_UNIT"]]; !ok {
-			uniqUnitName[entry.Fields["_SYSTEMD_UNIT"]] = true
-			uniqUnitNameStr = entry.Fields["_SYSTEMD_UNIT"]
-		}
-		if entry.Fields["_EXE"] != "" {
-			if _, ok := uniqExeName[entry.Fields["_EXE"]]; !ok {
-				uniqExeName[entry.Fields["_EXE"]] = true
-			}
-		}
-		if params.AllBoots {
-			structEntr.Boot = entry.Fields["_BOOT_ID"]
-		}
-		if host == entry.Fields["_HOSTNAME"] {
-			host = entry.Fields["_HOSTNAME"]
-		}
-		if structEntr.Identifier == "" {
-			structEntr.Identifier = fmt.Sprintf("%s:%s", entry.Fields["_SYSTEMD_UNIT"], entry.Fields["_SYSTEMD_USER_UNIT"])
-		}
-		messages = append(messages, structEntr)
-		collectedCount++
-
-		if collectedCount >= maxCount {
-			break
 		}
 
 		ret, err := sj.journal.Next()
@@ -460,24 +527,33 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 			break
 		}
 	}
+	messages, redacted := buf.messages()
+	span.SetAttr("journal.scanned", scanned)
+	span.SetAttr("journal.returned", len(messages))
+	span.SetAttr("journal.dropped", buf.dropped)
+	span.End(nil)
+
+	if newestCursor != "" {
+		sj.cursors.set(key, newestCursor)
+	}
 
+	uniqExeName := make(map[string]bool)
+	for _, msg := range messages {
+		uniqExeName[msg.ExeName] = true
+	}
 	res := ListLogResult{
 		Host:       host,
 		NrMessages: len(messages),
 		Messages:   messages,
+		Cursor:     newestCursor,
+		Redacted:   redacted,
 	}
-	if len(uniqIdentifiers) == 1 {
-		res.Identifier = uniqIdentifiersStr
-		for i := range messages {
-			messages[i].Identifier = ""
-		}
-	}
-	if len(uniqUnitName) == 1 {
-		res.UnitName = uniqUnitNameStr
-		for i := range messages {
-			messages[i].UnitName = ""
-		}
+	if lastCursor != "" && (collectedCount >= maxCount || full) {
+		res.Hint = moreEntriesHint(params)
+	} else if buf.dropped > 0 {
+		res.Hint = fmt.Sprintf("%d older entries were left out to fit the response size, call again with offset %d for them", buf.dropped, max(params.Offset, 0)+len(messages))
 	}
+	res.collapse()
 	if len(params.Unit) > 0 {
 		for exe := range uniqExeName {
 			if exe == "" {
@@ -488,7 +564,7 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 			cmd.Stdout = &out
 			err := cmd.Run()
 			if err != nil {
-				slog.Debug("rpm command failed", "exe", exe, "err", err)
+				slog.DebugContext(ctx, "rpm command failed", "exe", exe, "err", err)
 				continue
 			}
 
@@ -510,7 +586,7 @@ func (sj *HostLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params
 				var outMan bytes.Buffer
 				cmdMan.Stdout = &outMan
 				if err := cmdMan.Run(); err != nil {
-					slog.Debug("man command failed", "name", name, "err", err)
+					slog.DebugContext(ctx, "man command failed", "name", name, "err", err)
 					continue
 				}
 				for _, line := range strings.Split(strings.TrimSpace(outMan.String()), "\n") {
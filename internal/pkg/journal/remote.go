@@ -0,0 +1,245 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/remote"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sessionid"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
+)
+
+// longest line of journalctl which is read, longer entries fail the call
+const maxRemoteEntryBytes = 1024 * 1024
+
+// RemoteLog reads the journal of another machine with journalctl over ssh.
+// Unit names are passed to --unit, which takes globs and no regular
+// expressions, and the pattern only matches the message.
+type RemoteLog struct {
+	Auth auth.AuthKeeper
+	Host *remote.Host
+
+	cursors cursorStore
+}
+
+// journalctlArgs returns the command line of journalctl for the parameters,
+// without a cursor the newest count entries and the offset are read
+func journalctlArgs(params *ListLogParams, afterCursor string, count int) []string {
+	args := []string{"journalctl", "--output=json", "--no-pager", "--quiet"}
+	for _, unit := range params.Unit {
+		args = append(args, "--unit="+unit)
+	}
+	if params.Pattern != "" {
+		args = append(args, "--grep="+params.Pattern)
+	}
+	if !params.AllBoots {
+		args = append(args, "--boot")
+	}
+	if !params.From.IsZero() {
+		args = append(args, "--since=@"+strconv.FormatInt(params.From.Unix(), 10))
+	}
+	if !params.To.IsZero() {
+		args = append(args, "--until=@"+strconv.FormatInt(params.To.Unix(), 10))
+	}
+	if afterCursor != "" {
+		args = append(args, "--after-cursor="+afterCursor)
+	} else {
+		args = append(args, "--lines="+strconv.Itoa(count+max(params.Offset, 0)))
+	}
+	return args
+}
+
+// fieldValue returns a field of the JSON output of journalctl, which are
+// strings, arrays of bytes for binary data or arrays of those for fields
+// which are set more than once
+func fieldValue(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var data []int
+	if json.Unmarshal(raw, &data) == nil {
+		b := make([]byte, len(data))
+		for i, c := range data {
+			b[i] = byte(c)
+		}
+		return string(b)
+	}
+	var values []json.RawMessage
+	if json.Unmarshal(raw, &values) == nil && len(values) > 0 {
+		return fieldValue(values[0])
+	}
+	return ""
+}
+
+// parseEntry parses a line of journalctl --output=json
+func parseEntry(line []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, fmt.Errorf("invalid output of journalctl: %w", err)
+	}
+	fields := make(map[string]string, len(raw))
+	for k, v := range raw {
+		fields[k] = fieldValue(v)
+	}
+	return fields, nil
+}
+
+// collapse moves the identifier and the unit which all messages share to
+// the result
+func (res *ListLogResult) collapse() {
+	identifiers := make(map[string]bool)
+	units := make(map[string]bool)
+	for _, m := range res.Messages {
+		identifiers[m.Identifier] = true
+		units[m.UnitName] = true
+	}
+	if len(res.Messages) == 0 {
+		return
+	}
+	if len(identifiers) == 1 {
+		res.Identifier = res.Messages[0].Identifier
+		for i := range res.Messages {
+			res.Messages[i].Identifier = ""
+		}
+	}
+	if len(units) == 1 {
+		res.UnitName = res.Messages[0].UnitName
+		for i := range res.Messages {
+			res.Messages[i].UnitName = ""
+		}
+	}
+}
+
+// ListLog returns the log entries of the remote host like HostLog.ListLog
+func (rl *RemoteLog) ListLog(ctx context.Context, req *mcp.CallToolRequest, params *ListLogParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := rl.Auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	count := params.Count
+	if count <= 0 {
+		count = 100
+	}
+	key := cursorKey(sessionid.FromRequest(req), params.Unit)
+	lastCursor, err := startCursor(params, &rl.cursors, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancelScan := withScanTimeout(ctx)
+	defer cancelScan()
+	// the command is stopped once enough entries after the cursor are read
+	cmdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := rl.Host.Command(cmdCtx, journalctlArgs(params, lastCursor, count)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("couldn't start ssh: %w", err)
+	}
+	_, span := tracing.Start(ctx, "journal iteration", tracing.KindInternal)
+	span.SetAttr("journal.host", rl.Host.String())
+	defer span.End(nil)
+	var entries []map[string]string
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxRemoteEntryBytes)
+	for scanner.Scan() {
+		cost.AddBytes(ctx, len(scanner.Bytes()))
+		entry, err := parseEntry(scanner.Bytes())
+		if err != nil {
+			cancel()
+			cmd.Wait()
+			return nil, nil, err
+		}
+		entries = append(entries, entry)
+		if lastCursor != "" && len(entries) >= count {
+			break
+		}
+	}
+	stopped := lastCursor != "" && len(entries) >= count
+	if stopped {
+		cancel()
+	}
+	scanErr := scanner.Err()
+	if err := cmd.Wait(); err != nil && !stopped {
+		if ctx.Err() != nil {
+			return nil, nil, scanCtxErr(ctx)
+		}
+		// journalctl fails if the cursor of the last call doesn't exist
+		// anymore and exits with 1 if --grep matched nothing
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, nil, fmt.Errorf("journalctl on %s failed: %s", rl.Host, msg)
+		}
+	}
+	if scanErr != nil && !stopped {
+		return nil, nil, fmt.Errorf("failed to read the log of %s: %w", rl.Host, scanErr)
+	}
+	span.SetAttr("journal.returned", len(entries))
+	span.End(nil)
+	if lastCursor == "" {
+		// the newest entries of the offset are skipped
+		end := max(len(entries)-max(params.Offset, 0), 0)
+		entries = entries[max(end-count, 0):end]
+	}
+
+	res := ListLogResult{Host: rl.Host.Name, Cursor: lastCursor, Messages: []LogOutput{}}
+	for _, entry := range entries {
+		usec, _ := strconv.ParseInt(entry["__REALTIME_TIMESTAMP"], 10, 64)
+		msg := LogOutput{
+			Identifier: entry["SYSLOG_IDENTIFIER"],
+			UnitName:   entry["_SYSTEMD_UNIT"],
+			ExeName:    entry["_EXE"],
+			Time:       time.UnixMicro(usec),
+		}
+		var n int
+		msg.Msg, n = redact.Get().Redact(entry["MESSAGE"])
+		res.Redacted += n
+		if params.AllBoots {
+			msg.Boot = entry["_BOOT_ID"]
+		}
+		if msg.Identifier == "" {
+			msg.Identifier = fmt.Sprintf("%s:%s", entry["_SYSTEMD_UNIT"], entry["_SYSTEMD_USER_UNIT"])
+		}
+		if entry["_HOSTNAME"] != "" {
+			res.Host = entry["_HOSTNAME"]
+		}
+		res.Messages = append(res.Messages, msg)
+		res.Cursor = entry["__CURSOR"]
+	}
+	res.NrMessages = len(res.Messages)
+	res.collapse()
+	if res.Cursor != "" {
+		rl.cursors.set(key, res.Cursor)
+	}
+	if stopped {
+		res.Hint = moreEntriesHint(params)
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,42 @@
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalctlArgs(t *testing.T) {
+	params := &ListLogParams{Unit: []string{"nginx.service"}, Pattern: "fail", Offset: 10}
+	assert.Equal(t, []string{"journalctl", "--output=json", "--no-pager", "--quiet", "--unit=nginx.service", "--grep=fail", "--boot", "--lines=60"},
+		journalctlArgs(params, "", 50))
+
+	params = &ListLogParams{AllBoots: true, From: time.Unix(1700000000, 0), To: time.Unix(1700003600, 0)}
+	assert.Equal(t, []string{"journalctl", "--output=json", "--no-pager", "--quiet", "--since=@1700000000", "--until=@1700003600", "--after-cursor=s=abc"},
+		journalctlArgs(params, "s=abc", 100))
+}
+
+func TestParseEntry(t *testing.T) {
+	entry, err := parseEntry([]byte(`{"__CURSOR":"s=abc","__REALTIME_TIMESTAMP":"1700000000000000","MESSAGE":[104,105,0],"SYSLOG_IDENTIFIER":["nginx","nginx2"],"_PID":"42"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "s=abc", entry["__CURSOR"])
+	assert.Equal(t, "hi\x00", entry["MESSAGE"], "binary fields are arrays of bytes")
+	assert.Equal(t, "nginx", entry["SYSLOG_IDENTIFIER"], "the first value of a repeated field is used")
+
+	_, err = parseEntry([]byte("Permission denied"))
+	assert.Error(t, err)
+}
+
+func TestCollapse(t *testing.T) {
+	res := &ListLogResult{Messages: []LogOutput{
+		{Identifier: "nginx", UnitName: "nginx.service", Msg: "a"},
+		{Identifier: "nginx", UnitName: "other.service", Msg: "b"},
+	}}
+	res.collapse()
+	assert.Equal(t, "nginx", res.Identifier)
+	assert.Empty(t, res.UnitName)
+	assert.Empty(t, res.Messages[0].Identifier)
+	assert.Equal(t, "other.service", res.Messages[1].UnitName)
+}
@@ -0,0 +1,46 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultScanTimeout bounds the scan of the journal by a list_log call
+const DefaultScanTimeout = time.Minute
+
+// scanTimeout is the --journal-timeout, 0 for none
+var scanTimeout atomic.Int64
+
+var errScanTimeout = errors.New("journal scan timed out")
+
+func init() {
+	scanTimeout.Store(int64(DefaultScanTimeout))
+}
+
+// SetScanTimeout ends the scan of list_log after d with an error, e.g. if
+// the filters match hardly any entry of a large journal. 0 doesn't limit
+// the scan.
+func SetScanTimeout(d time.Duration) {
+	scanTimeout.Store(int64(max(d, 0)))
+}
+
+// withScanTimeout returns the context of a scan, started after the
+// authorization so that waiting for the user doesn't count
+func withScanTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	d := time.Duration(scanTimeout.Load())
+	if d == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, d, errScanTimeout)
+}
+
+// scanCtxErr returns the error of the ended scan context
+func scanCtxErr(ctx context.Context) error {
+	if context.Cause(ctx) == errScanTimeout {
+		return fmt.Errorf("the journal scan didn't finish within %s, narrow it down by unit, from or pattern", time.Duration(scanTimeout.Load()))
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,31 @@
+package journal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanCtxErr(t *testing.T) {
+	defer SetScanTimeout(DefaultScanTimeout)
+	SetScanTimeout(time.Millisecond)
+	ctx, cancel := withScanTimeout(context.Background())
+	defer cancel()
+	<-ctx.Done()
+	assert.Equal(t, "the journal scan didn't finish within 1ms, narrow it down by unit, from or pattern", scanCtxErr(ctx).Error())
+
+	// a call cancelled by the client isn't reported as timeout
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel = withScanTimeout(parent)
+	defer cancel()
+	cancelParent()
+	assert.Equal(t, context.Canceled, scanCtxErr(ctx))
+
+	SetScanTimeout(0)
+	ctx, cancel = withScanTimeout(context.Background())
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok, "0 doesn't limit the scan")
+}
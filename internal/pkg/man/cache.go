@@ -0,0 +1,86 @@
+package man
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxCachedPages rendered pages are kept, the least recently used one is
+// dropped first
+const maxCachedPages = 32
+
+type cachedPage struct {
+	key  string
+	page *manPage
+}
+
+var pageCache struct {
+	sync.Mutex
+	// least recently used first
+	pages []cachedPage
+}
+
+// locateManPage returns the source file man renders for the page, with the
+// same fallback to all sections as the rendering, or "" if there is none
+func locateManPage(ctx context.Context, lang, section, name string) string {
+	for _, args := range [][]string{{section, name}, {name}} {
+		out, err := manCommand(ctx, lang, append([]string{"-w"}, args...)...).Output()
+		if err == nil {
+			path, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+			return path
+		}
+	}
+	return ""
+}
+
+// pageCacheKey identifies the page by its source file and modification
+// time, so an updated page is rendered again
+func pageCacheKey(path string) string {
+	if path == "" {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", path, info.ModTime().UnixNano())
+}
+
+func cachedManPage(path string) *manPage {
+	key := pageCacheKey(path)
+	if key == "" {
+		return nil
+	}
+	pageCache.Lock()
+	defer pageCache.Unlock()
+	for i, cached := range pageCache.pages {
+		if cached.key == key {
+			pageCache.pages = append(append(pageCache.pages[:i:i], pageCache.pages[i+1:]...), cached)
+			return cached.page
+		}
+	}
+	return nil
+}
+
+func storeManPage(path string, page *manPage) {
+	key := pageCacheKey(path)
+	if key == "" {
+		return
+	}
+	pageCache.Lock()
+	defer pageCache.Unlock()
+	// drop older versions of the page
+	pages := pageCache.pages[:0]
+	for _, cached := range pageCache.pages {
+		if !strings.HasPrefix(cached.key, path+":") {
+			pages = append(pages, cached)
+		}
+	}
+	if len(pages) >= maxCachedPages {
+		pages = pages[len(pages)-maxCachedPages+1:]
+	}
+	pageCache.pages = append(pages, cachedPage{key: key, page: page})
+}
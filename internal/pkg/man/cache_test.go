@@ -0,0 +1,54 @@
+package man
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPageCache(t *testing.T) {
+	defer func() { pageCache.pages = nil }()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "systemd.exec.5.gz")
+	if err := os.WriteFile(path, []byte("page"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if cachedManPage(path) != nil {
+		t.Fatal("page cached before it was stored")
+	}
+	page := parseManPage("NAME\n       systemd.exec - Execution environment configuration\n")
+	storeManPage(path, page)
+	if got := cachedManPage(path); got != page {
+		t.Errorf("cachedManPage() = %v, want the stored page", got)
+	}
+	if cachedManPage("") != nil || cachedManPage(filepath.Join(dir, "missing")) != nil {
+		t.Error("page without source file was cached")
+	}
+
+	// an updated page is rendered again
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if cachedManPage(path) != nil {
+		t.Error("cached page wasn't invalidated by the modification time")
+	}
+	storeManPage(path, page)
+	if len(pageCache.pages) != 1 {
+		t.Errorf("%d pages cached, want the older version dropped", len(pageCache.pages))
+	}
+
+	for i := range maxCachedPages {
+		other := filepath.Join(dir, fmt.Sprintf("page%d", i))
+		if err := os.WriteFile(other, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		storeManPage(other, page)
+	}
+	if len(pageCache.pages) != maxCachedPages || cachedManPage(path) != nil {
+		t.Errorf("%d pages cached, want the least recently used one dropped", len(pageCache.pages))
+	}
+}
@@ -0,0 +1,227 @@
+package man
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// at most this many pages are searched for a directive, e.g. the exec
+// settings are also listed for the pages which include systemd.exec(5)
+const maxDirectivePages = 5
+
+type LookupDirectiveParams struct {
+	Name string `json:"name" jsonschema:"Directive, option or variable to look up, e.g. RuntimeMaxSec or RuntimeMaxSec="`
+	Page string `json:"page,omitempty" jsonschema:"Only look in this page, e.g. systemd.service"`
+}
+
+type DirectiveRef struct {
+	Page     string `json:"page"`
+	Section  string `json:"section"`
+	Category string `json:"category"`
+}
+
+type DirectiveMatch struct {
+	DirectiveRef
+	Chapter string `json:"chapter,omitempty"`
+	Content string `json:"content,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type LookupDirectiveResult struct {
+	Directive string           `json:"directive"`
+	Matches   []DirectiveMatch `json:"matches"`
+}
+
+func CreateLookupDirectiveSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[LookupDirectiveParams](nil)
+	return inputSchema
+}
+
+var (
+	validDirective = regexp.MustCompile(`^[A-Za-z0-9_$.-]+=?$`)
+	validPageName  = regexp.MustCompile(`^[A-Za-z0-9_.:@+-]+$`)
+	pageRef        = regexp.MustCompile(`([A-Za-z0-9_.:@+-]+)\(([0-9a-z]+)\)`)
+)
+
+// renderManPage returns the formatted page without overstrike
+func renderManPage(ctx context.Context, section, name string) (string, error) {
+	if !validPageName.MatchString(name) || strings.HasPrefix(name, "-") || !validManSection.MatchString(section) {
+		return "", fmt.Errorf("invalid man page %s(%s)", name, section)
+	}
+	stdout, stderr, err := run(ctx, "man", section, name)
+	if err != nil {
+		errMsg := strings.TrimSpace(string(stderr))
+		if errMsg == "" {
+			errMsg = err.Error()
+		}
+		return "", fmt.Errorf("failed to get man page for %s(%s): %s", name, section, errMsg)
+	}
+	return stripOverstrike(string(stdout)), nil
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// parseDirectives parses systemd.directives(7) into the pages which document
+// every directive. Directives are indented by 7 spaces and followed by the
+// list of pages indented deeper, the headers name the category.
+func parseDirectives(page string) map[string][]DirectiveRef {
+	index := map[string][]DirectiveRef{}
+	var category string
+	var names []string
+	for _, line := range strings.Split(page, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch indent := indentOf(line); {
+		case trimmed == "":
+		case indent == 0:
+			category = trimmed
+			names = nil
+		case indent <= 7:
+			names = strings.Split(trimmed, ", ")
+		case names != nil:
+			for _, m := range pageRef.FindAllStringSubmatch(trimmed, -1) {
+				for _, name := range names {
+					key := strings.TrimSuffix(name, "=")
+					index[key] = append(index[key], DirectiveRef{Page: m[1], Section: m[2], Category: category})
+				}
+			}
+		}
+	}
+	return index
+}
+
+// findDirective returns the entry documenting the directive and the
+// chapter it is in. The entry starts with the line naming the directive and
+// ends before the next line which isn't indented deeper. Entries of the
+// option lists are indented by 7 spaces and preferred over other lines
+// which only consist of the directive.
+func findDirective(page, directive string) (chapter, content string) {
+	lines := strings.Split(page, "\n")
+	for _, listOnly := range []bool{true, false} {
+		chapter = ""
+		for i, line := range lines {
+			indent := indentOf(line)
+			if indent == 0 && strings.TrimSpace(line) != "" {
+				chapter = strings.TrimSpace(line)
+				continue
+			}
+			if indent == 0 || (listOnly && indent != 7) || !namesDirective(line, directive) {
+				continue
+			}
+			end := i + 1
+			// directives documented together are listed on consecutive lines
+			for end < len(lines) && indentOf(lines[end]) == indent && strings.TrimSpace(lines[end]) != "" {
+				end++
+			}
+			for end < len(lines) && (strings.TrimSpace(lines[end]) == "" || indentOf(lines[end]) > indent) {
+				end++
+			}
+			entry := lines[i:end]
+			for j := range entry {
+				entry[j] = strings.TrimPrefix(entry[j], strings.Repeat(" ", indent))
+			}
+			return chapter, strings.TrimRight(strings.Join(entry, "\n"), "\n")
+		}
+	}
+	return "", ""
+}
+
+// namesDirective reports whether the line is the heading of the directive,
+// e.g. "User=, Group=" for Group
+func namesDirective(line, directive string) bool {
+	for _, name := range strings.Split(strings.TrimSpace(line), ", ") {
+		if strings.TrimSuffix(name, "=") == directive {
+			return true
+		}
+	}
+	return false
+}
+
+var directives struct {
+	sync.Mutex
+	index map[string][]DirectiveRef
+}
+
+// directiveIndex parses systemd.directives(7) on first use
+func directiveIndex(ctx context.Context) (map[string][]DirectiveRef, error) {
+	directives.Lock()
+	defer directives.Unlock()
+	if directives.index == nil {
+		page, err := renderManPage(ctx, "7", "systemd.directives")
+		if err != nil {
+			return nil, err
+		}
+		directives.index = parseDirectives(page)
+	}
+	return directives.index, nil
+}
+
+// LookupDirective returns the documentation of a directive from the pages
+// systemd.directives(7) lists for it, instead of whole man pages
+func LookupDirective(ctx context.Context, req *mcp.CallToolRequest, params *LookupDirectiveParams) (*mcp.CallToolResult, any, error) {
+	if !validDirective.MatchString(params.Name) {
+		return nil, nil, fmt.Errorf("invalid directive: %q", params.Name)
+	}
+	name := strings.TrimSuffix(params.Name, "=")
+	index, err := directiveIndex(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	refs, ok := index[name]
+	if !ok {
+		// directives are case sensitive, but a wrong case shouldn't fail
+		for key, r := range index {
+			if strings.EqualFold(key, name) {
+				name, refs, ok = key, r, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("%s isn't listed in systemd.directives(7)", params.Name)
+	}
+
+	// the page may be given as systemd.service(5)
+	page, _, _ := strings.Cut(params.Page, "(")
+	result := LookupDirectiveResult{Directive: name, Matches: []DirectiveMatch{}}
+	for _, ref := range refs {
+		if page != "" && ref.Page != page {
+			continue
+		}
+		if len(result.Matches) >= maxDirectivePages {
+			break
+		}
+		match := DirectiveMatch{DirectiveRef: ref}
+		text, err := renderManPage(ctx, ref.Section, ref.Page)
+		if err != nil {
+			match.Error = err.Error()
+		} else if match.Chapter, match.Content = findDirective(text, name); match.Content == "" {
+			match.Error = fmt.Sprintf("%s not found in %s(%s)", name, ref.Page, ref.Section)
+		}
+		result.Matches = append(result.Matches, match)
+	}
+	if len(result.Matches) == 0 {
+		return nil, nil, fmt.Errorf("%s isn't documented in %s", name, page)
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
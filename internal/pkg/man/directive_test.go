@@ -0,0 +1,157 @@
+package man
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const directivesPage = `SYSTEMD.DIRECTIVES(7)        systemd.directives        SYSTEMD.DIRECTIVES(7)
+
+NAME
+       systemd.directives - Index of configuration directives
+
+UNIT DIRECTIVES
+       Directives for configuring units, used in unit files.
+
+       Group=
+           systemd.exec(5)
+
+       RuntimeMaxSec=
+           systemd.scope(5), systemd.service(5)
+
+       User=
+           systemd.exec(5)
+`
+
+const servicePage = `SYSTEMD.SERVICE(5)            systemd.service            SYSTEMD.SERVICE(5)
+
+NAME
+       systemd.service - Service unit configuration
+
+OPTIONS
+       Service unit files may include [Unit] and [Install] sections.
+
+       RuntimeSec=
+           Not the one.
+
+       RuntimeMaxSec=
+           Configures a maximum time for the service to run. If this is
+           used and the service has been active for longer than the
+           specified time it is terminated.
+
+           Added in version 229.
+
+       RuntimeRandomizedExtraSec=
+           Adds a random delay to RuntimeMaxSec=.
+`
+
+const execPage = `SYSTEMD.EXEC(5)                systemd.exec                SYSTEMD.EXEC(5)
+
+CREDENTIALS
+   User/Group Identity
+       User=, Group=
+           Set the UNIX user or group that the processes are executed as.
+
+       DynamicUser=
+           Allocate a user dynamically.
+`
+
+type manExecutor struct {
+	pages map[string]string
+	calls int
+}
+
+func (e *manExecutor) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	e.calls++
+	page, ok := e.pages[args[1]+"("+args[0]+")"]
+	if !ok {
+		return nil, []byte("No manual entry for " + args[1]), fmt.Errorf("exit status 16")
+	}
+	return []byte(page), nil, nil
+}
+
+func TestParseDirectives(t *testing.T) {
+	index := parseDirectives(directivesPage)
+	refs := index["RuntimeMaxSec"]
+	if len(refs) != 2 || refs[1] != (DirectiveRef{Page: "systemd.service", Section: "5", Category: "UNIT DIRECTIVES"}) {
+		t.Errorf("RuntimeMaxSec = %+v", refs)
+	}
+	if len(index["User"]) != 1 {
+		t.Errorf("User = %+v", index["User"])
+	}
+}
+
+func TestFindDirective(t *testing.T) {
+	chapter, content := findDirective(servicePage, "RuntimeMaxSec")
+	if chapter != "OPTIONS" {
+		t.Errorf("chapter = %q", chapter)
+	}
+	want := "RuntimeMaxSec=\n    Configures a maximum time for the service to run. If this is\n    used and the service has been active for longer than the\n    specified time it is terminated.\n\n    Added in version 229."
+	if content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+
+	chapter, content = findDirective(execPage, "Group")
+	if chapter != "CREDENTIALS" || content != "User=, Group=\n    Set the UNIX user or group that the processes are executed as." {
+		t.Errorf("chapter = %q, content = %q", chapter, content)
+	}
+
+	if _, content := findDirective(servicePage, "Type"); content != "" {
+		t.Errorf("content = %q, want none", content)
+	}
+}
+
+func TestLookupDirective(t *testing.T) {
+	executor := &manExecutor{pages: map[string]string{
+		"systemd.directives(7)": directivesPage,
+		"systemd.service(5)":    servicePage,
+		"systemd.exec(5)":       execPage,
+	}}
+	defer SetExecutor(globalExecutor)
+	SetExecutor(executor)
+	directives.index = nil
+	defer func() { directives.index = nil }()
+
+	lookup := func(params *LookupDirectiveParams) LookupDirectiveResult {
+		t.Helper()
+		res, _, err := LookupDirective(context.Background(), nil, params)
+		if err != nil {
+			t.Fatalf("LookupDirective(%+v) = %v", params, err)
+		}
+		var result LookupDirectiveResult
+		if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := lookup(&LookupDirectiveParams{Name: "RuntimeMaxSec="})
+	if len(result.Matches) != 2 {
+		t.Fatalf("matches = %+v", result.Matches)
+	}
+	if result.Matches[0].Page != "systemd.scope" || result.Matches[0].Error == "" {
+		t.Errorf("missing page not reported: %+v", result.Matches[0])
+	}
+	if result.Matches[1].Chapter != "OPTIONS" || result.Matches[1].Content == "" {
+		t.Errorf("service match = %+v", result.Matches[1])
+	}
+
+	result = lookup(&LookupDirectiveParams{Name: "runtimemaxsec", Page: "systemd.service(5)"})
+	if result.Directive != "RuntimeMaxSec" || len(result.Matches) != 1 || result.Matches[0].Page != "systemd.service" {
+		t.Errorf("result = %+v", result)
+	}
+	// the index is only parsed once
+	if executor.calls != 4 {
+		t.Errorf("man was called %d times, want 4", executor.calls)
+	}
+
+	for _, name := range []string{"NoSuchDirective", "User; rm -rf /", ""} {
+		if _, _, err := LookupDirective(context.Background(), nil, &LookupDirectiveParams{Name: name}); err == nil {
+			t.Errorf("LookupDirective(%q) didn't fail", name)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package man
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	helpTimeout  = 5 * time.Second
+	maxHelpBytes = 64 * 1024
+)
+
+// DefaultHelpBinaries are the commands get_help may run if no other list is
+// configured
+func DefaultHelpBinaries() []string {
+	return []string{
+		"systemctl", "journalctl", "loginctl", "busctl", "networkctl", "resolvectl",
+		"timedatectl", "hostnamectl", "localectl", "systemd-analyze", "systemd-run",
+		"systemd-cgls", "systemd-cgtop", "coredumpctl", "bootctl", "udevadm",
+		"portablectl", "machinectl", "homectl", "userdbctl", "oomctl", "systemd-tmpfiles",
+		"systemd-sysusers", "systemd-creds", "systemd-cryptenroll",
+	}
+}
+
+var helpBinaries = DefaultHelpBinaries()
+
+// SetHelpBinaries sets the commands get_help may run, either base names
+// looked up in PATH or absolute paths
+func SetHelpBinaries(binaries []string) {
+	helpBinaries = binaries
+}
+
+type GetHelpParams struct {
+	Command string `json:"command" jsonschema:"Command whose help is shown, e.g. systemd-analyze. Only the configured commands are allowed."`
+	Version bool   `json:"version,omitempty" jsonschema:"Run the command with --version instead of --help. Defaults to false."`
+}
+
+type GetHelpResult struct {
+	Command   string `json:"command"`
+	Path      string `json:"path"`
+	Argument  string `json:"argument"`
+	Output    string `json:"output"`
+	ExitError string `json:"exit_error,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+func CreateGetHelpSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetHelpParams](nil)
+	inputSchema.Properties["version"].Default = json.RawMessage(`false`)
+	var commands []any
+	for _, c := range helpBinaries {
+		commands = append(commands, filepath.Base(c))
+	}
+	inputSchema.Properties["command"].Enum = commands
+	return inputSchema
+}
+
+// helpBinary returns the path of an allowed command, a command given by its
+// base name may only be an allowed base name or the base of an allowed path
+func helpBinary(command string) (string, error) {
+	if command == "" || strings.ContainsRune(command, '/') {
+		return "", fmt.Errorf("invalid command: %q", command)
+	}
+	if idx := slices.IndexFunc(helpBinaries, func(b string) bool { return filepath.IsAbs(b) && filepath.Base(b) == command }); idx != -1 {
+		return helpBinaries[idx], nil
+	}
+	if !slices.Contains(helpBinaries, command) {
+		return "", fmt.Errorf("%s isn't in the list of commands allowed for get_help", command)
+	}
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return "", fmt.Errorf("%s not found: %w", command, err)
+	}
+	return path, nil
+}
+
+// GetHelp runs an allowed command with --help or --version and nothing else,
+// for commands without a man page
+func GetHelp(ctx context.Context, req *mcp.CallToolRequest, params *GetHelpParams) (*mcp.CallToolResult, any, error) {
+	path, err := helpBinary(params.Command)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := GetHelpResult{
+		Command:  params.Command,
+		Path:     path,
+		Argument: "--help",
+	}
+	if params.Version {
+		result.Argument = "--version"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, helpTimeout)
+	defer cancel()
+	stdout, stderr, err := run(ctx, path, result.Argument)
+	output := stdout
+	if len(strings.TrimSpace(string(output))) == 0 {
+		// some commands print their usage to stderr
+		output = stderr
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("%s %s didn't finish within %s", params.Command, result.Argument, helpTimeout)
+		}
+		if len(output) == 0 {
+			return nil, nil, fmt.Errorf("%s %s failed: %w", params.Command, result.Argument, err)
+		}
+		result.ExitError = err.Error()
+	}
+	if len(output) > maxHelpBytes {
+		output = output[:maxHelpBytes]
+		result.Truncated = true
+	}
+	result.Output = stripOverstrike(string(output))
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,98 @@
+package man
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type helpExecutor struct {
+	args   []string
+	stdout string
+	stderr string
+	err    error
+	block  bool
+}
+
+func (e *helpExecutor) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	e.args = append([]string{name}, args...)
+	if e.block {
+		<-ctx.Done()
+		return nil, nil, ctx.Err()
+	}
+	return []byte(e.stdout), []byte(e.stderr), e.err
+}
+
+func TestGetHelp(t *testing.T) {
+	executor := &helpExecutor{stdout: "fake-tool [OPTIONS...] COMMAND\n"}
+	defer SetExecutor(globalExecutor)
+	SetExecutor(executor)
+	defer SetHelpBinaries(helpBinaries)
+	SetHelpBinaries([]string{"/usr/lib/fake/fake-tool", "not-installed-tool"})
+
+	getHelp := func(params *GetHelpParams) GetHelpResult {
+		t.Helper()
+		res, _, err := GetHelp(context.Background(), nil, params)
+		if err != nil {
+			t.Fatalf("GetHelp(%+v) = %v", params, err)
+		}
+		var result GetHelpResult
+		if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := getHelp(&GetHelpParams{Command: "fake-tool"})
+	if want := []string{"/usr/lib/fake/fake-tool", "--help"}; !reflect.DeepEqual(executor.args, want) {
+		t.Errorf("args = %v, want %v", executor.args, want)
+	}
+	if result.Output != "fake-tool [OPTIONS...] COMMAND\n" || result.Path != "/usr/lib/fake/fake-tool" {
+		t.Errorf("result = %+v", result)
+	}
+
+	getHelp(&GetHelpParams{Command: "fake-tool", Version: true})
+	if want := []string{"/usr/lib/fake/fake-tool", "--version"}; !reflect.DeepEqual(executor.args, want) {
+		t.Errorf("args = %v, want %v", executor.args, want)
+	}
+
+	t.Run("Usage on stderr", func(t *testing.T) {
+		executor.stdout, executor.stderr, executor.err = "", "Usage: fake-tool\n", fmt.Errorf("exit status 1")
+		result := getHelp(&GetHelpParams{Command: "fake-tool"})
+		if result.Output != "Usage: fake-tool\n" || result.ExitError == "" {
+			t.Errorf("result = %+v", result)
+		}
+	})
+
+	t.Run("Output is capped", func(t *testing.T) {
+		executor.stdout, executor.stderr, executor.err = strings.Repeat("x", maxHelpBytes+10), "", nil
+		result := getHelp(&GetHelpParams{Command: "fake-tool"})
+		if len(result.Output) != maxHelpBytes || !result.Truncated {
+			t.Errorf("len = %d, truncated = %v", len(result.Output), result.Truncated)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		executor.block = true
+		defer func() { executor.block = false }()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, _, err := GetHelp(ctx, nil, &GetHelpParams{Command: "fake-tool"}); err == nil {
+			t.Error("blocking command didn't fail")
+		}
+	})
+
+	t.Run("Commands not allowed", func(t *testing.T) {
+		for _, command := range []string{"sh", "/usr/lib/fake/fake-tool", "../fake-tool", "", "not-installed-tool"} {
+			if _, _, err := GetHelp(context.Background(), nil, &GetHelpParams{Command: command}); err == nil {
+				t.Errorf("command %q wasn't rejected", command)
+			}
+		}
+	})
+}
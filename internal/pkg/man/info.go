@@ -0,0 +1,180 @@
+package man
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type GetInfoPageParams struct {
+	Document string `json:"document" jsonschema:"Name of the info document, e.g. coreutils or bash"`
+	Node     string `json:"node,omitempty" jsonschema:"Node to read, e.g. ls invocation. Defaults to Top, the next, previous, up and menu nodes of the result can be read with it."`
+	Offset   int    `json:"offset,omitempty" jsonschema:"Line offset for pagination"`
+	Limit    int    `json:"limit,omitempty" jsonschema:"Maximum number of lines to return (default 2000)"`
+}
+
+type InfoMenuEntry struct {
+	Name        string `json:"name"`
+	Node        string `json:"node"`
+	Description string `json:"description,omitempty"`
+}
+
+type InfoPageResult struct {
+	Document   string          `json:"document"`
+	Node       string          `json:"node"`
+	Next       string          `json:"next,omitempty"`
+	Prev       string          `json:"prev,omitempty"`
+	Up         string          `json:"up,omitempty"`
+	Menu       []InfoMenuEntry `json:"menu,omitempty"`
+	Content    string          `json:"content"`
+	TotalLines int             `json:"total_lines"`
+}
+
+func CreateInfoPageSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetInfoPageParams](nil)
+	inputSchema.Properties["node"].Default = json.RawMessage(`"Top"`)
+	inputSchema.Properties["limit"].Default = json.RawMessage(`2000`)
+	return inputSchema
+}
+
+var (
+	// "* Name::  description" or "* Name: Node.  description"
+	infoMenuEntry = regexp.MustCompile(`^\* ([^:]+)::\s*(.*)$`)
+	infoMenuLabel = regexp.MustCompile(`^\* ([^:]+):\s+([^.,\t]+)[.,\t]\s*(.*)$`)
+)
+
+// infoAvailable looks up info in PATH once, on the first call of
+// get_info_page
+var infoAvailable = sync.OnceValue(func() bool {
+	_, err := exec.LookPath("info")
+	return err == nil
+})
+
+// IsInfoAvailable checks if the info binary is available in PATH.
+func IsInfoAvailable() bool {
+	return infoAvailable()
+}
+
+// CheckInfo fails get_info_page if info isn't installed
+func CheckInfo() error {
+	if !IsInfoAvailable() {
+		return errors.New("info isn't installed on this machine")
+	}
+	return nil
+}
+
+// validNode rejects empty nodes and control characters, the node is passed
+// as a single argument so nothing else needs to be quoted
+func validNode(node string) bool {
+	return node != "" && len(node) <= 256 && !strings.ContainsFunc(node, unicode.IsControl)
+}
+
+// parseInfoNode splits a node printed by info into the navigation of its
+// header line, e.g.
+// "File: coreutils.info,  Node: ls invocation,  Next: dir invocation,  Up: Directory listing",
+// the menu and the text
+func parseInfoNode(output string) (result InfoPageResult, lines []string) {
+	lines = strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "File: ") {
+		for _, field := range strings.Split(lines[0], ",  ") {
+			key, value, _ := strings.Cut(strings.TrimSpace(field), ": ")
+			switch key {
+			case "Node":
+				result.Node = value
+			case "Next":
+				result.Next = value
+			case "Prev":
+				result.Prev = value
+			case "Up":
+				result.Up = value
+			}
+		}
+		lines = lines[1:]
+		for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+			lines = lines[1:]
+		}
+	}
+
+	inMenu := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "* Menu:") {
+			inMenu = true
+			continue
+		}
+		if !inMenu {
+			continue
+		}
+		if m := infoMenuEntry.FindStringSubmatch(line); m != nil {
+			result.Menu = append(result.Menu, InfoMenuEntry{Name: m[1], Node: m[1], Description: strings.TrimSpace(m[2])})
+		} else if m := infoMenuLabel.FindStringSubmatch(line); m != nil {
+			result.Menu = append(result.Menu, InfoMenuEntry{Name: m[1], Node: strings.TrimSpace(m[2]), Description: strings.TrimSpace(m[3])})
+		} else if len(result.Menu) > 0 && strings.HasPrefix(line, " ") && strings.TrimSpace(line) != "" {
+			// wrapped description
+			last := &result.Menu[len(result.Menu)-1]
+			last.Description = strings.TrimSpace(last.Description + " " + strings.TrimSpace(line))
+		}
+	}
+	return result, lines
+}
+
+// GetInfoPage returns one node of an info document with the nodes it links
+// to, several tools like coreutils or bash document details only in info
+func GetInfoPage(ctx context.Context, req *mcp.CallToolRequest, params *GetInfoPageParams) (*mcp.CallToolResult, any, error) {
+	if !validPageName.MatchString(params.Document) || strings.HasPrefix(params.Document, "-") {
+		return nil, nil, fmt.Errorf("invalid info document: %q", params.Document)
+	}
+	node := params.Node
+	if node == "" {
+		node = "Top"
+	}
+	if !validNode(node) {
+		return nil, nil, fmt.Errorf("invalid info node: %q", node)
+	}
+
+	stdout, stderr, err := run(ctx, "info", "--file="+params.Document, "--node="+node, "--output=-")
+	if err != nil || len(stdout) == 0 {
+		errMsg := strings.TrimSpace(string(stderr))
+		if errMsg == "" && err != nil {
+			errMsg = err.Error()
+		}
+		return nil, nil, fmt.Errorf("failed to get info node %s of %s: %s", node, params.Document, errMsg)
+	}
+
+	result, lines := parseInfoNode(string(stdout))
+	result.Document = params.Document
+	if result.Node == "" {
+		result.Node = node
+	}
+	result.TotalLines = len(lines)
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 2000
+	}
+	end := min(params.Offset+limit, len(lines))
+	if params.Offset >= 0 && params.Offset < len(lines) {
+		result.Content = strings.Join(lines[params.Offset:end], "\n")
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
@@ -0,0 +1,96 @@
+package man
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const lsInvocation = `File: coreutils.info,  Node: ls invocation,  Next: dir invocation,  Up: Directory listing
+
+10.1 'ls': List directory contents
+==================================
+
+The 'ls' program lists information about files (of any type, including
+directories).
+
+* Menu:
+
+* Which files are listed::
+* What information is listed::  Long format, sizes and
+                                  timestamps.
+* Sorting the output: Sorting.  By name, size or time.
+`
+
+func TestGetInfoPage(t *testing.T) {
+	executor := &whatisExecutor{stdout: lsInvocation}
+	defer SetExecutor(globalExecutor)
+	SetExecutor(executor)
+
+	getInfo := func(params *GetInfoPageParams) InfoPageResult {
+		t.Helper()
+		res, _, err := GetInfoPage(context.Background(), nil, params)
+		if err != nil {
+			t.Fatalf("GetInfoPage(%+v) = %v", params, err)
+		}
+		var result InfoPageResult
+		if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := getInfo(&GetInfoPageParams{Document: "coreutils", Node: "ls invocation"})
+	if want := []string{"info", "--file=coreutils", "--node=ls invocation", "--output=-"}; !reflect.DeepEqual(executor.args, want) {
+		t.Errorf("args = %v, want %v", executor.args, want)
+	}
+	if result.Node != "ls invocation" || result.Next != "dir invocation" || result.Up != "Directory listing" || result.Prev != "" {
+		t.Errorf("navigation = %+v", result)
+	}
+	wantMenu := []InfoMenuEntry{
+		{Name: "Which files are listed", Node: "Which files are listed"},
+		{Name: "What information is listed", Node: "What information is listed", Description: "Long format, sizes and timestamps."},
+		{Name: "Sorting the output", Node: "Sorting", Description: "By name, size or time."},
+	}
+	if !reflect.DeepEqual(result.Menu, wantMenu) {
+		t.Errorf("menu = %+v, want %+v", result.Menu, wantMenu)
+	}
+	if result.TotalLines != 12 || result.Content[:15] != "10.1 'ls': List" {
+		t.Errorf("total_lines = %d, content = %q", result.TotalLines, result.Content)
+	}
+
+	result = getInfo(&GetInfoPageParams{Document: "coreutils", Offset: 3, Limit: 2})
+	if executor.args[2] != "--node=Top" {
+		t.Errorf("args = %v, want the Top node", executor.args)
+	}
+	if result.Content != "The 'ls' program lists information about files (of any type, including\ndirectories)." {
+		t.Errorf("content = %q", result.Content)
+	}
+
+	executor.stdout, executor.stderr, executor.err = "", "info: Cannot find node 'nope'\n", fmt.Errorf("exit status 1")
+	if _, _, err := GetInfoPage(context.Background(), nil, &GetInfoPageParams{Document: "coreutils", Node: "nope"}); err == nil {
+		t.Error("missing node wasn't reported")
+	}
+
+	for _, params := range []GetInfoPageParams{{Document: ""}, {Document: "-o"}, {Document: "../bash"}, {Document: "bash", Node: "a\nb"}} {
+		if _, _, err := GetInfoPage(context.Background(), nil, &params); err == nil {
+			t.Errorf("%+v wasn't rejected", params)
+		}
+	}
+}
+
+func TestCheckInfo(t *testing.T) {
+	defer func(available func() bool) { infoAvailable = available }(infoAvailable)
+	infoAvailable = func() bool { return false }
+	if err := CheckInfo(); err == nil || err.Error() != "info isn't installed on this machine" {
+		t.Errorf("CheckInfo() = %v", err)
+	}
+	infoAvailable = func() bool { return true }
+	if err := CheckInfo(); err != nil {
+		t.Errorf("CheckInfo() = %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package man
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type ListManPagesParams struct {
+	Pattern string `json:"pattern" jsonschema:"Glob matched against the page names, e.g. systemd* or *.conf"`
+	Section string `json:"section,omitempty" jsonschema:"Only list pages of this section, e.g. 5 or 8. Defaults to all sections."`
+	Limit   int    `json:"limit,omitempty" jsonschema:"Maximum number of pages to return (default 200)"`
+}
+
+type ManPageEntry struct {
+	Name        string `json:"name"`
+	Section     string `json:"section"`
+	Description string `json:"description"`
+}
+
+type ListManPagesResult struct {
+	Total     int            `json:"total"`
+	Truncated bool           `json:"truncated,omitempty"`
+	Pages     []ManPageEntry `json:"pages"`
+}
+
+func CreateListManPagesSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListManPagesParams](nil)
+	inputSchema.Properties["limit"].Default = json.RawMessage(`200`)
+	return inputSchema
+}
+
+var (
+	validManPattern = regexp.MustCompile(`^[A-Za-z0-9_.:@+*?\[\]-]+$`)
+	// whatis prints "systemd.service (5)          - Service unit configuration"
+	whatisLine = regexp.MustCompile(`^(\S+) \(([^)]+)\)\s+- (.*)$`)
+)
+
+// parseWhatis parses the output of whatis, pages installed in several
+// directories are listed once
+func parseWhatis(output string) []ManPageEntry {
+	seen := map[string]bool{}
+	pages := []ManPageEntry{}
+	for _, line := range strings.Split(output, "\n") {
+		m := whatisLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil || seen[m[1]+"("+m[2]+")"] {
+			continue
+		}
+		seen[m[1]+"("+m[2]+")"] = true
+		pages = append(pages, ManPageEntry{Name: m[1], Section: m[2], Description: strings.TrimSpace(m[3])})
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		if pages[i].Name != pages[j].Name {
+			return pages[i].Name < pages[j].Name
+		}
+		return pages[i].Section < pages[j].Section
+	})
+	return pages
+}
+
+// ListManPages lists the installed man pages matching a glob with their
+// one line descriptions, like man -k but without a regular expression
+func ListManPages(ctx context.Context, req *mcp.CallToolRequest, params *ListManPagesParams) (*mcp.CallToolResult, any, error) {
+	if !validManPattern.MatchString(params.Pattern) || strings.HasPrefix(params.Pattern, "-") {
+		return nil, nil, fmt.Errorf("invalid pattern: %q", params.Pattern)
+	}
+	args := []string{"--wildcard"}
+	if params.Section != "" {
+		if !validManSection.MatchString(params.Section) {
+			return nil, nil, fmt.Errorf("invalid man page section: %s (only a-z, A-Z, and 0-9 are allowed)", params.Section)
+		}
+		args = append(args, "--sections", params.Section)
+	}
+	args = append(args, "--", params.Pattern)
+	stdout, stderr, err := run(ctx, "whatis", args...)
+	// whatis fails if nothing matches, which is an empty list
+	if err != nil && len(stdout) == 0 && !strings.Contains(string(stderr), "nothing appropriate") {
+		errMsg := strings.TrimSpace(string(stderr))
+		if errMsg == "" {
+			errMsg = err.Error()
+		}
+		return nil, nil, fmt.Errorf("failed to list man pages: %s", errMsg)
+	}
+
+	pages := parseWhatis(string(stdout))
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 200
+	}
+	result := ListManPagesResult{Total: len(pages), Pages: pages}
+	if len(pages) > limit {
+		result.Pages = pages[:limit]
+		result.Truncated = true
+	}
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
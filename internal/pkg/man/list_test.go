@@ -0,0 +1,96 @@
+package man
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type whatisExecutor struct {
+	args   []string
+	stdout string
+	stderr string
+	err    error
+}
+
+func (e *whatisExecutor) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	e.args = append([]string{name}, args...)
+	return []byte(e.stdout), []byte(e.stderr), e.err
+}
+
+func TestListManPages(t *testing.T) {
+	executor := &whatisExecutor{stdout: `systemd.timer (5)    - Timer unit configuration
+systemd.service (5)  - Service unit configuration
+systemd.service (5)  - Service unit configuration
+systemd.exec (5)     - Execution environment configuration
+`}
+	defer SetExecutor(globalExecutor)
+	SetExecutor(executor)
+
+	list := func(params *ListManPagesParams) ListManPagesResult {
+		t.Helper()
+		res, _, err := ListManPages(context.Background(), nil, params)
+		if err != nil {
+			t.Fatalf("ListManPages(%+v) = %v", params, err)
+		}
+		var result ListManPagesResult
+		if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := list(&ListManPagesParams{Pattern: "systemd*", Section: "5"})
+	if want := []string{"whatis", "--wildcard", "--sections", "5", "--", "systemd*"}; !reflect.DeepEqual(executor.args, want) {
+		t.Errorf("args = %v, want %v", executor.args, want)
+	}
+	want := []ManPageEntry{
+		{Name: "systemd.exec", Section: "5", Description: "Execution environment configuration"},
+		{Name: "systemd.service", Section: "5", Description: "Service unit configuration"},
+		{Name: "systemd.timer", Section: "5", Description: "Timer unit configuration"},
+	}
+	if result.Total != 3 || !reflect.DeepEqual(result.Pages, want) {
+		t.Errorf("result = %+v", result)
+	}
+
+	result = list(&ListManPagesParams{Pattern: "systemd*", Limit: 1})
+	if result.Total != 3 || !result.Truncated || len(result.Pages) != 1 {
+		t.Errorf("result = %+v", result)
+	}
+
+	executor.stdout, executor.stderr, executor.err = "", "nomatch*: nothing appropriate.\n", fmt.Errorf("exit status 16")
+	if result = list(&ListManPagesParams{Pattern: "nomatch*"}); result.Total != 0 || len(result.Pages) != 0 {
+		t.Errorf("result = %+v", result)
+	}
+
+	for _, pattern := range []string{"", "-w", "foo bar", "a;b"} {
+		if _, _, err := ListManPages(context.Background(), nil, &ListManPagesParams{Pattern: pattern}); err == nil {
+			t.Errorf("pattern %q wasn't rejected", pattern)
+		}
+	}
+}
+
+// hungExecutor doesn't finish until the command is ended
+type hungExecutor struct{}
+
+func (hungExecutor) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	<-ctx.Done()
+	return nil, []byte("partial output"), ctx.Err()
+}
+
+func TestListManPagesTimeout(t *testing.T) {
+	defer SetExecutor(globalExecutor)
+	SetExecutor(hungExecutor{})
+	defer SetTimeout(DefaultTimeout)
+	SetTimeout(10 * time.Millisecond)
+
+	_, _, err := ListManPages(context.Background(), nil, &ListManPagesParams{Pattern: "systemd*"})
+	if err == nil || err.Error() != "failed to list man pages: whatis didn't finish within 10ms" {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -19,6 +24,9 @@ type GetManPageParams struct {
 	Offset   int      `json:"offset,omitempty" jsonschema:"Line offset for pagination"`
 	Limit    int      `json:"limit,omitempty" jsonschema:"Maximum number of lines to return (default 500)"`
 	Chapters []string `json:"chapters,omitempty" jsonschema:"List of chapters to retrieve (e.g. ['NAME', 'SYNOPSIS'])"`
+	Format   string   `json:"format,omitempty" jsonschema:"markdown converts the page to Markdown with headings, option lists and code blocks, text returns the formatted page as printed by man (default markdown)"`
+	Lang     string   `json:"lang,omitempty" jsonschema:"Language of the page, e.g. de, fr, ja or pt_BR. Falls back to English if there is no translation (default English)"`
+	Search   string   `json:"search,omitempty" jsonschema:"Only return the paragraphs containing this term (case insensitive) with their chapter names, e.g. a directive or option"`
 }
 
 // Executor interface for running external commands.
@@ -45,16 +53,73 @@ func SetExecutor(e Executor) {
 	globalExecutor = e
 }
 
+// DefaultTimeout bounds a command run to render a page
+const DefaultTimeout = 30 * time.Second
+
+// runTimeout is the --man-timeout, 0 for none
+var runTimeout atomic.Int64
+
+var errRunTimeout = errors.New("command timed out")
+
+func init() {
+	runTimeout.Store(int64(DefaultTimeout))
+}
+
+// SetTimeout ends the commands which render the pages after d, 0 doesn't
+// limit them
+func SetTimeout(d time.Duration) {
+	runTimeout.Store(int64(max(d, 0)))
+}
+
+// withTimeout returns the context of a command run for a tool
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	d := time.Duration(runTimeout.Load())
+	if d == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, d, errRunTimeout)
+}
+
+// run runs the command with the executor, bounded by the timeout
+func run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	stdout, stderr, err := globalExecutor.Run(ctx, name, args...)
+	if err != nil && context.Cause(ctx) == errRunTimeout {
+		// the output of the killed command doesn't explain the error
+		return stdout, nil, timedOut(ctx, name, err)
+	}
+	return stdout, stderr, err
+}
+
+// timedOut returns the error of the command name, replaced by a timeout
+// error if it was ended by the timeout and not by the caller
+func timedOut(ctx context.Context, name string, err error) error {
+	if err != nil && context.Cause(ctx) == errRunTimeout {
+		return fmt.Errorf("%s didn't finish within %s", name, time.Duration(runTimeout.Load()))
+	}
+	return err
+}
+
 type ManPageResult struct {
-	Content    string   `json:"content"`
-	Chapters   []string `json:"chapters"`
-	TotalLines int      `json:"total_lines"`
+	Content    string          `json:"content"`
+	Chapters   []string        `json:"chapters"`
+	TotalLines int             `json:"total_lines"`
+	Lang       string          `json:"lang,omitempty"`
+	Matches    int             `json:"matches,omitempty"`
+	References []PageReference `json:"references"`
 }
 
 func CreateManPageSchema() *jsonschema.Schema {
 	inputSchema, _ := jsonschema.For[GetManPageParams](nil)
 	inputSchema.Properties["limit"].Default = json.RawMessage(`2000`)
 	inputSchema.Properties["section"].Default = json.RawMessage(`"1"`)
+	var formats []any
+	for _, f := range ValidManFormats() {
+		formats = append(formats, f)
+	}
+	inputSchema.Properties["format"].Enum = formats
+	inputSchema.Properties["format"].Default = json.RawMessage(`"markdown"`)
 	return inputSchema
 }
 
@@ -69,15 +134,26 @@ func stripOverstrike(input string) string {
 	return input
 }
 
+type chapter struct {
+	name  string
+	lines []string
+}
+
+// manPage is a rendered page split into its chapters
+type manPage struct {
+	lines      []string
+	chapters   []chapter
+	references []PageReference
+}
+
 func parseAndFilterManPage(cleanOutput string, params *GetManPageParams) ManPageResult {
+	return filterManPage(parseManPage(cleanOutput), params)
+}
+
+func parseManPage(cleanOutput string) *manPage {
 	lines := strings.Split(cleanOutput, "\n")
 
 	// Parse Chapters
-	var chapterNames []string
-	type chapter struct {
-		name  string
-		lines []string
-	}
 	var chapters []chapter
 	var currentChapter *chapter
 
@@ -87,7 +163,6 @@ func parseAndFilterManPage(cleanOutput string, params *GetManPageParams) ManPage
 		if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
 			header := strings.TrimSpace(line)
 			// Man page headers are typically uppercase, but we take them as is for the list
-			chapterNames = append(chapterNames, header)
 			newChap := chapter{name: header, lines: []string{line}}
 			chapters = append(chapters, newChap)
 			currentChapter = &chapters[len(chapters)-1]
@@ -101,8 +176,19 @@ func parseAndFilterManPage(cleanOutput string, params *GetManPageParams) ManPage
 		}
 	}
 
+	return &manPage{lines: lines, chapters: chapters, references: pageReferences(lines)}
+}
+
+func filterManPage(page *manPage, params *GetManPageParams) ManPageResult {
+	chapters := page.chapters
+	var chapterNames []string
+	for _, chap := range chapters {
+		chapterNames = append(chapterNames, chap.name)
+	}
+
 	// Filter Chapters
 	var filteredLines []string
+	matches := 0
 	if len(params.Chapters) > 0 {
 		reqChapters := make(map[string]bool)
 		for _, c := range params.Chapters {
@@ -112,21 +198,29 @@ func parseAndFilterManPage(cleanOutput string, params *GetManPageParams) ManPage
 		for _, chap := range chapters {
 			// Case-insensitive comparison for user convenience
 			if reqChapters[strings.ToUpper(chap.name)] {
-				filteredLines = append(filteredLines, chap.lines...)
+				matched, n := searchChapter(chap.lines, params.Search)
+				filteredLines = append(filteredLines, matched...)
+				matches += n
 			}
 		}
 	} else {
 		// Return all content if no chapters specified
 		if len(chapters) > 0 {
 			for _, chap := range chapters {
-				filteredLines = append(filteredLines, chap.lines...)
+				matched, n := searchChapter(chap.lines, params.Search)
+				filteredLines = append(filteredLines, matched...)
+				matches += n
 			}
 		} else {
 			// If no chapters detected, return raw lines (fallback)
-			filteredLines = lines
+			filteredLines = page.lines
 		}
 	}
 
+	if params.Format == "markdown" && len(filteredLines) > 0 {
+		filteredLines = strings.Split(strings.TrimSuffix(toMarkdown(filteredLines), "\n"), "\n")
+	}
+
 	totalLines := len(filteredLines)
 
 	limit := params.Limit
@@ -151,21 +245,111 @@ func parseAndFilterManPage(cleanOutput string, params *GetManPageParams) ManPage
 		Content:    content,
 		Chapters:   chapterNames,
 		TotalLines: totalLines,
+		Matches:    matches,
+		References: page.references,
 	}
 }
 
+// searchChapter returns the header of the chapter and its paragraphs which
+// contain the term, paragraphs are separated by blank lines. The term of an
+// option list is kept with its description.
+func searchChapter(lines []string, search string) ([]string, int) {
+	if search == "" {
+		return lines, 0
+	}
+	var paragraphs [][]string
+	var paragraph []string
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			if paragraph != nil {
+				paragraphs = append(paragraphs, paragraph)
+				paragraph = nil
+			}
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	if paragraph != nil {
+		paragraphs = append(paragraphs, paragraph)
+	}
+
+	search = strings.ToLower(search)
+	var out []string
+	matches := 0
+	for i, p := range paragraphs {
+		if !strings.Contains(strings.ToLower(strings.Join(p, "\n")), search) {
+			continue
+		}
+		matches++
+		// the term whose description matched
+		if i > 0 && len(paragraphs[i-1]) == 1 && indentOf(paragraphs[i-1][0]) < indentOf(p[0]) && !strings.Contains(strings.ToLower(paragraphs[i-1][0]), search) {
+			out = append(out, paragraphs[i-1][0])
+		}
+		out = append(out, p...)
+		out = append(out, "")
+	}
+	if matches == 0 {
+		return nil, 0
+	}
+	return append([]string{lines[0]}, out...), matches
+}
+
 const (
 	ValidManSectionPattern = `^[a-zA-Z0-9]+$`
 )
 
 var validManName = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
 var validManSection = regexp.MustCompile(ValidManSectionPattern)
+var validManLang = regexp.MustCompile(`^[a-z]{2,3}(_[A-Z]{2})?$`)
+
+// manCommand runs man with the page in the given language, man falls back
+// to English itself
+func manCommand(ctx context.Context, lang string, args ...string) *exec.Cmd {
+	if lang != "" {
+		args = append([]string{"-L", lang}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "man", args...)
+	cmd.Env = append(cmd.Environ(), "COLUMNS=80", "MAN_POSIXLY_CORRECT=1")
+	if lang != "" {
+		// translations aren't limited to ASCII
+		cmd.Env = append(cmd.Env, "LC_CTYPE=C.UTF-8")
+	}
+	return cmd
+}
+
+// pathLang reports whether the page man found is translated to lang,
+// translations are installed below e.g. /usr/share/man/de/ or pt_BR.UTF-8/
+func pathLang(path, lang string) bool {
+	language, _, _ := strings.Cut(lang, "_")
+	dirs := strings.Split(path, "/")
+	for _, dir := range dirs[:len(dirs)-1] {
+		dir, _, _ = strings.Cut(dir, ".")
+		if dir == lang || dir == language || strings.HasPrefix(dir, language+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// manAvailable looks up man in PATH once, on the first call of a man tool
+// instead of the start of the server
+var manAvailable = sync.OnceValue(func() bool {
+	_, err := exec.LookPath("man")
+	return err == nil
+})
 
 // IsManAvailable checks if the man binary is available in PATH.
 // Returns true if man is found, false otherwise.
 func IsManAvailable() bool {
-	_, err := exec.LookPath("man")
-	return err == nil
+	return manAvailable()
+}
+
+// CheckMan fails the man page tools if man isn't installed
+func CheckMan() error {
+	if !IsManAvailable() {
+		return errors.New("man isn't installed on this machine")
+	}
+	return nil
 }
 
 func GetManPage(ctx context.Context, req *mcp.CallToolRequest, params *GetManPageParams) (*mcp.CallToolResult, any, error) {
@@ -187,9 +371,55 @@ func GetManPage(ctx context.Context, req *mcp.CallToolRequest, params *GetManPag
 		return nil, nil, fmt.Errorf("invalid man page section: %s (only a-z, A-Z, and 0-9 are allowed)", section)
 	}
 
+	if params.Format == "" {
+		params.Format = "markdown"
+	}
+	if !slices.Contains(ValidManFormats(), params.Format) {
+		return nil, nil, fmt.Errorf("invalid format: %s", params.Format)
+	}
+
+	if params.Lang != "" && !validManLang.MatchString(params.Lang) {
+		return nil, nil, fmt.Errorf("invalid language: %s (e.g. de or pt_BR)", params.Lang)
+	}
+
+	// rendering large pages like systemd.exec(5) takes a while
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	path := locateManPage(ctx, params.Lang, section, params.Name)
+	page := cachedManPage(path)
+	if page == nil {
+		var err error
+		if page, err = renderAndParseManPage(ctx, params.Lang, section, params.Name); err != nil {
+			return nil, nil, timedOut(ctx, "man", err)
+		}
+		storeManPage(path, page)
+	}
+
+	res := filterManPage(page, params)
+	if params.Lang != "" {
+		res.Lang = "en"
+		if pathLang(path, params.Lang) {
+			res.Lang = params.Lang
+		}
+	}
+
+	jsonBytes, err := json.Marshal(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
+
+func renderAndParseManPage(ctx context.Context, lang, section, name string) (*manPage, error) {
 	// Try with specific section first: man 1 ls
-	cmd := exec.Command("man", section, params.Name)
-	cmd.Env = append(cmd.Environ(), "COLUMNS=80", "MAN_POSIXLY_CORRECT=1")
+	cmd := manCommand(ctx, lang, section, name)
 
 	var out bytes.Buffer
 	cmd.Stdout = &out
@@ -198,8 +428,7 @@ func GetManPage(ctx context.Context, req *mcp.CallToolRequest, params *GetManPag
 
 	if err := cmd.Run(); err != nil {
 		// Fallback: Try without section: man ls
-		cmdFallback := exec.Command("man", params.Name)
-		cmdFallback.Env = append(cmdFallback.Environ(), "COLUMNS=80", "MAN_POSIXLY_CORRECT=1")
+		cmdFallback := manCommand(ctx, lang, name)
 		var outFallback bytes.Buffer
 		cmdFallback.Stdout = &outFallback
 		var stderrFallback bytes.Buffer
@@ -211,7 +440,7 @@ func GetManPage(ctx context.Context, req *mcp.CallToolRequest, params *GetManPag
 			if errMsg == "" {
 				errMsg = err.Error()
 			}
-			return nil, nil, fmt.Errorf("failed to get man page for %s(%s): %s", params.Name, section, errMsg)
+			return nil, fmt.Errorf("failed to get man page for %s(%s): %s", name, section, errMsg)
 		}
 		// Fallback succeeded
 		out = outFallback
@@ -220,18 +449,5 @@ func GetManPage(ctx context.Context, req *mcp.CallToolRequest, params *GetManPag
 	rawOutput := out.String()
 	cleanOutput := stripOverstrike(rawOutput)
 
-	res := parseAndFilterManPage(cleanOutput, params)
-
-	jsonBytes, err := json.Marshal(res)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
-	}
-
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{
-				Text: string(jsonBytes),
-			},
-		},
-	}, nil, nil
+	return parseManPage(cleanOutput), nil
 }
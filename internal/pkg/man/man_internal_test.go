@@ -1,7 +1,9 @@
 package man
 
 import (
+	"context"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -136,10 +138,65 @@ func TestGetManPageValidation(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			params := &GetManPageParams{Name: tt.manName}
-			_, _, err := GetManPage(nil, nil, params)
+			_, _, err := GetManPage(context.Background(), nil, params)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetManPage() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestPathLang(t *testing.T) {
+	tests := []struct {
+		path string
+		lang string
+		want bool
+	}{
+		{"/usr/share/man/de/man1/ls.1.gz", "de", true},
+		{"/usr/share/man/man1/ls.1.gz", "de", false},
+		{"/usr/share/man/pt_BR/man1/ls.1.gz", "pt_BR", true},
+		{"/usr/share/man/ja_JP.UTF-8/man1/ls.1.gz", "ja", true},
+		{"/usr/share/man/fr/man1/ls.1.gz", "de", false},
+		{"/usr/share/man/man1/de.1.gz", "de", false},
+	}
+	for _, tt := range tests {
+		if got := pathLang(tt.path, tt.lang); got != tt.want {
+			t.Errorf("pathLang(%q, %q) = %v, want %v", tt.path, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestParseAndFilterManPageSearch(t *testing.T) {
+	page := `NAME
+       systemd.service - Service unit configuration
+
+OPTIONS
+       Type=
+           Configures the mechanism via which the service notifies the
+           manager that the service start-up has finished.
+
+       RuntimeMaxSec=
+           Configures a maximum time for the service to run. Takes a
+           unit-less value in seconds.
+
+       RestartSec=
+           Configures the time to sleep before restarting a service.
+
+SEE ALSO
+       systemd(1)
+`
+	got := parseAndFilterManPage(page, &GetManPageParams{Search: "maximum time"})
+	want := "OPTIONS\n       RuntimeMaxSec=\n           Configures a maximum time for the service to run. Takes a\n           unit-less value in seconds.\n"
+	if got.Content != want || got.Matches != 1 {
+		t.Errorf("Content = %q, Matches = %d, want %q", got.Content, got.Matches, want)
+	}
+
+	got = parseAndFilterManPage(page, &GetManPageParams{Search: "SERVICE", Chapters: []string{"OPTIONS"}})
+	if got.Matches != 3 || strings.Contains(got.Content, "NAME") {
+		t.Errorf("Content = %q, Matches = %d", got.Content, got.Matches)
+	}
+
+	if got = parseAndFilterManPage(page, &GetManPageParams{Search: "nothing"}); got.Content != "" || got.TotalLines != 0 {
+		t.Errorf("Content = %q, TotalLines = %d", got.Content, got.TotalLines)
+	}
+}
@@ -0,0 +1,169 @@
+package man
+
+import (
+	"regexp"
+	"strings"
+)
+
+func ValidManFormats() []string {
+	return []string{"markdown", "text"}
+}
+
+var (
+	// page header and footer, e.g. "LS(1)    User Commands    LS(1)"
+	pageTitle  = regexp.MustCompile(`^\S.*\s{3,}.*\S+\([0-9a-zA-Z]+\)$`)
+	bulletItem = regexp.MustCompile(`^(?:[•·*o+-]|\d+\.)\s+`)
+)
+
+// toMarkdown converts the formatted text of a man page into Markdown. The
+// structure is recovered from the indentation: headers start in the first
+// column, subsections are indented by 3, a line followed by deeper indented
+// lines is a term of an option list and blocks which are indented deeper
+// than the text around them are examples. Wrapped lines are joined.
+func toMarkdown(lines []string) string {
+	var blocks [][]string
+	var block []string
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if block != nil {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+		// a header needs no blank line before the text
+		if indentOf(line) == 0 && block != nil {
+			blocks = append(blocks, block)
+			block = nil
+		}
+		block = append(block, line)
+		if indentOf(line) <= 3 {
+			blocks = append(blocks, block)
+			block = nil
+		}
+	}
+	if block != nil {
+		blocks = append(blocks, block)
+	}
+
+	var out []string
+	// indentation of the running text
+	base := 7
+	// the description of a term follows after a blank line
+	pendingTerm := false
+	for _, block := range blocks {
+		indent := indentOf(block[0])
+		first := strings.TrimSpace(block[0])
+		switch {
+		case indent == 0:
+			if !pageTitle.MatchString(block[0]) {
+				out = append(out, "## "+first, "")
+			}
+			base, pendingTerm = 7, false
+			continue
+		case indent <= 3:
+			out = append(out, "### "+first, "")
+			base, pendingTerm = 7, false
+			continue
+		}
+		if indent < base || pendingTerm {
+			base = indent
+		}
+		pendingTerm = false
+		switch {
+		case bulletItem.MatchString(first):
+			out = append(out, listItems(block)...)
+		case indent > base:
+			out = append(out, codeBlock(block, indent)...)
+		case len(block) > 1 && indentOf(block[1]) > indent || len(block) == 1 && isTerm(first):
+			// terms listed together, followed by the description
+			i := 0
+			for i < len(block) && indentOf(block[i]) == indent {
+				out = append(out, "**"+strings.TrimSpace(block[i])+"**")
+				i++
+			}
+			if i < len(block) {
+				base = indentOf(block[i])
+				out = append(out, "")
+				out = append(out, joinLines(block[i:]))
+			} else {
+				pendingTerm = true
+			}
+		default:
+			out = append(out, joinLines(block))
+		}
+		out = append(out, "")
+	}
+	return strings.TrimSpace(strings.Join(collapseBlank(out), "\n")) + "\n"
+}
+
+// isTerm reports whether a single line block is an option or directive
+// whose description follows after a blank line
+func isTerm(line string) bool {
+	return strings.HasPrefix(line, "-") || strings.HasSuffix(line, "=")
+}
+
+// joinLines joins wrapped lines, groff marks words hyphenated at the end
+// of a line with U+2010
+func joinLines(lines []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		if i > 0 {
+			prev := sb.String()
+			if strings.HasSuffix(prev, "‐") {
+				sb.Reset()
+				sb.WriteString(strings.TrimSuffix(prev, "‐"))
+			} else {
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// listItems converts bullets and numbered items, deeper indented lines
+// continue the previous item
+func listItems(block []string) []string {
+	var items []string
+	for _, line := range block {
+		text := strings.TrimSpace(line)
+		if loc := bulletItem.FindStringIndex(text); loc != nil {
+			marker := strings.TrimSpace(text[:loc[1]])
+			if !strings.HasSuffix(marker, ".") {
+				marker = "-"
+			}
+			items = append(items, marker+" "+text[loc[1]:])
+		} else if len(items) > 0 {
+			items[len(items)-1] += " " + text
+		} else {
+			items = append(items, text)
+		}
+	}
+	return items
+}
+
+// codeBlock keeps the lines of an example with their relative indentation
+func codeBlock(block []string, indent int) []string {
+	for _, line := range block {
+		indent = min(indent, indentOf(line))
+	}
+	code := []string{"```"}
+	for _, line := range block {
+		code = append(code, line[indent:])
+	}
+	return append(code, "```")
+}
+
+func collapseBlank(lines []string) []string {
+	var out []string
+	for i, line := range lines {
+		if line == "" && i > 0 && lines[i-1] == "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package man
+
+import (
+	"strings"
+	"testing"
+)
+
+const lsPage = `LS(1)                            User Commands                           LS(1)
+
+NAME
+       ls - list directory contents
+
+SYNOPSIS
+       ls [OPTION]... [FILE]...
+
+DESCRIPTION
+       List  information  about  the FILEs (the current directory by default).
+       Sort entries alphabetically if none of -cftuvSUX nor --sort is speci‐
+       fied.
+
+       -a, --all
+              do not ignore entries starting with .
+
+       -A, --almost-all
+              do not list implied . and ..
+
+   Exit status:
+       0      if OK,
+
+EXAMPLES
+       Show the hidden files:
+
+           $ ls -a
+           .  ..  .config
+
+       The output depends on:
+
+       •   the locale and
+
+       •   the terminal width, which is
+           taken from COLUMNS.
+
+GNU coreutils 9.4                 August 2023                            LS(1)
+`
+
+func TestToMarkdown(t *testing.T) {
+	got := toMarkdown(strings.Split(lsPage, "\n"))
+	want := "## NAME\n\n" +
+		"ls - list directory contents\n\n" +
+		"## SYNOPSIS\n\n" +
+		"ls [OPTION]... [FILE]...\n\n" +
+		"## DESCRIPTION\n\n" +
+		"List  information  about  the FILEs (the current directory by default). Sort entries alphabetically if none of -cftuvSUX nor --sort is specified.\n\n" +
+		"**-a, --all**\n\n" +
+		"do not ignore entries starting with .\n\n" +
+		"**-A, --almost-all**\n\n" +
+		"do not list implied . and ..\n\n" +
+		"### Exit status:\n\n" +
+		"0      if OK,\n\n" +
+		"## EXAMPLES\n\n" +
+		"Show the hidden files:\n\n" +
+		"```\n$ ls -a\n.  ..  .config\n```\n\n" +
+		"The output depends on:\n\n" +
+		"- the locale and\n\n" +
+		"- the terminal width, which is taken from COLUMNS.\n"
+	if got != want {
+		t.Errorf("toMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestToMarkdownDirectives(t *testing.T) {
+	got := toMarkdown(strings.Split(execPage, "\n"))
+	want := "## CREDENTIALS\n\n" +
+		"### User/Group Identity\n\n" +
+		"**User=, Group=**\n\n" +
+		"Set the UNIX user or group that the processes are executed as.\n\n" +
+		"**DynamicUser=**\n\n" +
+		"Allocate a user dynamically.\n"
+	if got != want {
+		t.Errorf("toMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseAndFilterManPageMarkdown(t *testing.T) {
+	got := parseAndFilterManPage(lsPage, &GetManPageParams{Chapters: []string{"SYNOPSIS"}, Format: "markdown"})
+	if got.Content != "## SYNOPSIS\n\nls [OPTION]... [FILE]..." {
+		t.Errorf("Content = %q", got.Content)
+	}
+	if got.TotalLines != 3 {
+		t.Errorf("TotalLines = %d, want 3", got.TotalLines)
+	}
+}
@@ -0,0 +1,47 @@
+package man
+
+import (
+	"sort"
+	"strings"
+)
+
+type PageReference struct {
+	Name    string `json:"name"`
+	Section string `json:"section"`
+	SeeAlso bool   `json:"see_also,omitempty"`
+}
+
+// pageReferences returns the pages a man page refers to, e.g. foo(5), each
+// page once. The pages of the SEE ALSO section come first, then the ones
+// only referenced in the text. The page header and footer aren't references.
+func pageReferences(lines []string) []PageReference {
+	refs := []PageReference{}
+	index := map[string]int{}
+	inSeeAlso := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if pageTitle.MatchString(line) {
+			continue
+		}
+		if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
+			inSeeAlso = strings.TrimSpace(line) == "SEE ALSO"
+			continue
+		}
+		// references may be hyphenated at the end of a line
+		for strings.HasSuffix(line, "‐") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, "‐") + strings.TrimSpace(lines[i])
+		}
+		for _, m := range pageRef.FindAllStringSubmatch(line, -1) {
+			key := m[1] + "(" + m[2] + ")"
+			if idx, ok := index[key]; ok {
+				refs[idx].SeeAlso = refs[idx].SeeAlso || inSeeAlso
+				continue
+			}
+			index[key] = len(refs)
+			refs = append(refs, PageReference{Name: m[1], Section: m[2], SeeAlso: inSeeAlso})
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].SeeAlso && !refs[j].SeeAlso })
+	return refs
+}
@@ -0,0 +1,41 @@
+package man
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPageReferences(t *testing.T) {
+	page := `SYSTEMD.TIMER(5)              systemd.timer              SYSTEMD.TIMER(5)
+
+NAME
+       systemd.timer - Timer unit configuration
+
+DESCRIPTION
+       A unit configuration file whose name ends in ".timer", see
+       systemd.unit(5) for the common options and systemd.ser‐
+       vice(5) for the unit which is activated.
+
+SEE ALSO
+       systemd(1), systemctl(1), systemd.unit(5), systemd.service(5),
+       systemd.directives(7)
+
+systemd 257                                                SYSTEMD.TIMER(5)
+`
+	want := []PageReference{
+		{Name: "systemd.unit", Section: "5", SeeAlso: true},
+		{Name: "systemd.service", Section: "5", SeeAlso: true},
+		{Name: "systemd", Section: "1", SeeAlso: true},
+		{Name: "systemctl", Section: "1", SeeAlso: true},
+		{Name: "systemd.directives", Section: "7", SeeAlso: true},
+	}
+	if got := pageReferences(strings.Split(page, "\n")); !reflect.DeepEqual(got, want) {
+		t.Errorf("pageReferences() = %+v, want %+v", got, want)
+	}
+
+	got := parseAndFilterManPage("NAME\n       ls - list directory contents, see dir(1)\n", &GetManPageParams{})
+	if want := []PageReference{{Name: "dir", Section: "1"}}; !reflect.DeepEqual(got.References, want) {
+		t.Errorf("References = %+v, want %+v", got.References, want)
+	}
+}
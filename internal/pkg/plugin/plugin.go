@@ -0,0 +1,306 @@
+// Package plugin runs tools of external executables, so that downstreams
+// can add tools like zypper or snapper without changing the server.
+//
+// A plugin is an executable in the plugin directory. Called with the
+// argument "describe" it prints its tools as JSON:
+//
+//	{"tools": [{"name": "zypper_search", "title": "...", "description": "...",
+//	  "input_schema": {"type": "object", ...}, "auth": "read"}]}
+//
+// The names of the tools start with the name of the plugin and an
+// underscore. Called with the argument "call" it reads the call
+//
+//	{"tool": "zypper_search", "arguments": {...}}
+//
+// from stdin and prints the result
+//
+//	{"content": "text for the model", "structured": {...}, "error": "..."}
+//
+// where an error marks the call as failed. A plugin which exits with an
+// error fails the call with its stderr.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// DefaultDir is where the plugins are looked up
+const DefaultDir = "/usr/lib/systemd-mcp/plugins"
+
+// auth classes of the tools, write tools are authorized with the polkit
+// action com.suse.gatekeeper.plugin and need mcp:write
+const (
+	AuthNone  = "none"
+	AuthRead  = "read"
+	AuthWrite = "write"
+)
+
+const (
+	describeTimeout = 10 * time.Second
+	// maxOutput is the most a plugin may print for one call
+	maxOutput = 8 << 20
+	// maxStderr is the most of the stderr of a plugin kept for its error
+	maxStderr = 64 << 10
+)
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// ValidAuthClasses returns the auth classes a tool may declare
+func ValidAuthClasses() []string {
+	return []string{AuthNone, AuthRead, AuthWrite}
+}
+
+// Tool is a tool as described by a plugin
+type Tool struct {
+	Name        string             `json:"name"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description"`
+	InputSchema *jsonschema.Schema `json:"input_schema,omitempty"`
+	Auth        string             `json:"auth"`
+}
+
+type description struct {
+	Tools []Tool `json:"tools"`
+}
+
+type call struct {
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Result is the answer of a plugin to a call
+type Result struct {
+	Content    string `json:"content"`
+	Structured any    `json:"structured,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Plugin is an executable offering tools
+type Plugin struct {
+	Name  string
+	Path  string
+	Tools []Tool
+	// Timeout ends a call which takes longer, 0 for none
+	Timeout time.Duration
+}
+
+// Load describes the enabled plugins of the directory. The tools are the
+// names of the tools of the server, a plugin can't replace them and two
+// plugins can't offer the same tool.
+func Load(ctx context.Context, dir string, names []string, tools []string, timeout time.Duration) ([]*Plugin, error) {
+	var plugins []*Plugin
+	taken := slices.Clone(tools)
+	for _, name := range names {
+		if !validName.MatchString(name) {
+			return nil, fmt.Errorf("invalid plugin name %q", name)
+		}
+		p := &Plugin{Name: name, Path: filepath.Join(dir, name), Timeout: timeout}
+		if err := checkExecutable(p.Path); err != nil {
+			return nil, err
+		}
+		if err := p.describe(ctx); err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", name, err)
+		}
+		for _, tool := range p.Tools {
+			if slices.Contains(taken, tool.Name) {
+				return nil, fmt.Errorf("plugin %s: tool %s is already registered", name, tool.Name)
+			}
+			taken = append(taken, tool.Name)
+		}
+		slog.Info("loaded plugin", "plugin", name, "tools", len(p.Tools))
+		plugins = append(plugins, p)
+	}
+	return plugins, nil
+}
+
+// checkExecutable refuses executables which others than the owner may
+// change, as they run with the rights of the server
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("plugin not found: %w", err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("plugin %s is not an executable file", path)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("plugin %s is writable by group or others", path)
+	}
+	return nil
+}
+
+func (p *Plugin) describe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, describeTimeout)
+	defer cancel()
+	out, err := p.run(ctx, nil, "describe")
+	if err != nil {
+		return err
+	}
+	var desc description
+	if err := json.Unmarshal(out, &desc); err != nil {
+		return fmt.Errorf("invalid description: %w", err)
+	}
+	for i := range desc.Tools {
+		tool := &desc.Tools[i]
+		if !strings.HasPrefix(tool.Name, p.Name+"_") {
+			return fmt.Errorf("tool %q doesn't start with %s_", tool.Name, p.Name)
+		}
+		if !slices.Contains(ValidAuthClasses(), tool.Auth) {
+			return fmt.Errorf("tool %s has the invalid auth class %q, valid are: %s", tool.Name, tool.Auth, strings.Join(ValidAuthClasses(), ", "))
+		}
+		if tool.InputSchema == nil {
+			tool.InputSchema = &jsonschema.Schema{Type: "object"}
+		}
+	}
+	p.Tools = desc.Tools
+	return nil
+}
+
+// run runs the plugin with the input on stdin and returns its stdout
+func (p *Plugin) run(ctx context.Context, input []byte, arg string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, p.Path, arg)
+	cmd.Stdin = bytes.NewReader(input)
+	stdout := &limitedBuffer{max: maxOutput}
+	stderr := &limitedBuffer{max: maxStderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("plugin %s didn't answer in time", p.Name)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("plugin %s failed: %v: %s", p.Name, err, msg)
+		}
+		return nil, fmt.Errorf("plugin %s failed: %w", p.Name, err)
+	}
+	if stdout.exceeded {
+		return nil, fmt.Errorf("plugin %s printed more than %d bytes", p.Name, maxOutput)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Call calls a tool of the plugin
+func (p *Plugin) Call(ctx context.Context, tool string, args json.RawMessage) (*Result, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	input, err := json.Marshal(&call{Tool: tool, Arguments: args})
+	if err != nil {
+		return nil, err
+	}
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	out, err := p.run(ctx, input, "call")
+	if err != nil {
+		return nil, err
+	}
+	var res Result
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("invalid result of plugin %s: %w", p.Name, err)
+	}
+	return &res, nil
+}
+
+// MCPTool returns the tool as registered at the server
+func (t *Tool) MCPTool() *mcp.Tool {
+	return &mcp.Tool{
+		Title:       t.Title,
+		Name:        t.Name,
+		Description: t.Description,
+		InputSchema: t.InputSchema,
+	}
+}
+
+// Handler authorizes a call by the auth class of the tool and runs it
+func (p *Plugin) Handler(tool Tool, authKeeper auth.AuthKeeper) mcp.ToolHandler {
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		switch tool.Auth {
+		case AuthRead:
+			if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+				return nil, err
+			} else if !allowed {
+				return nil, fmt.Errorf("calling method was canceled by user")
+			}
+		case AuthWrite:
+			allowed, err := authKeeper.IsWriteAuthorized(dbus.WithDetails(ctx, dbus.ActionPlugin, map[string]string{"plugin": p.Name, "operation": tool.Name}))
+			if !allowed || err != nil {
+				return nil, fmt.Errorf("calling method wasn't authorized: %v", err)
+			}
+			defer authKeeper.Deauthorize()
+		}
+		var args json.RawMessage
+		if req != nil && req.Params != nil {
+			args = req.Params.Arguments
+		}
+		res, err := p.Call(ctx, tool.Name, args)
+		if err != nil {
+			return nil, err
+		}
+		result := &mcp.CallToolResult{
+			Content:           []mcp.Content{&mcp.TextContent{Text: res.Content}},
+			StructuredContent: res.Structured,
+		}
+		if res.Error != "" {
+			result.IsError = true
+			result.Content = []mcp.Content{&mcp.TextContent{Text: res.Error}}
+		}
+		return result, nil
+	}
+}
+
+// WriteTools returns the tools of the write class, which are audited
+func WriteTools(plugins []*Plugin) []string {
+	var tools []string
+	for _, p := range plugins {
+		for _, tool := range p.Tools {
+			if tool.Auth == AuthWrite {
+				tools = append(tools, tool.Name)
+			}
+		}
+	}
+	return tools
+}
+
+// limitedBuffer keeps up to max bytes and notes if there were more
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.exceeded = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// ReadFrom hides the one of bytes.Buffer, which os/exec would use to copy
+// the output past the limit
+func (b *limitedBuffer) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{b}, r)
+}
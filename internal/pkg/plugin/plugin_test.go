@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const zypperPlugin = `#!/bin/sh
+case "$1" in
+describe)
+	cat <<EOF
+{"tools": [
+ {"name": "zypper_search", "description": "Search packages", "auth": "read",
+  "input_schema": {"type": "object", "properties": {"query": {"type": "string"}}}},
+ {"name": "zypper_install", "description": "Install packages", "auth": "write"}
+]}
+EOF
+	;;
+call)
+	input=$(cat)
+	case "$input" in
+	*'"fail"'*) echo "repository unreachable" >&2; exit 1 ;;
+	*zypper_search*) echo '{"content": "found vim", "structured": {"packages": ["vim"]}}' ;;
+	*) echo '{"error": "nothing to install"}' ;;
+	esac
+	;;
+esac
+`
+
+func writePlugin(t *testing.T, dir, name, script string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "zypper", zypperPlugin)
+	plugins, err := Load(context.Background(), dir, []string{"zypper"}, nil, 0)
+	require.NoError(t, err)
+	require.Len(t, plugins, 1)
+	require.Len(t, plugins[0].Tools, 2)
+	assert.Equal(t, "zypper_search", plugins[0].Tools[0].Name)
+	assert.Equal(t, "object", plugins[0].Tools[1].InputSchema.Type, "tools without arguments get an empty schema")
+	assert.Equal(t, []string{"zypper_install"}, WriteTools(plugins))
+
+	_, err = Load(context.Background(), dir, []string{"snapper"}, nil, 0)
+	assert.Error(t, err, "only existing plugins are loaded")
+	_, err = Load(context.Background(), dir, []string{"../zypper"}, nil, 0)
+	assert.Error(t, err)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "snapper", "#!/bin/sh\necho '{\"tools\": [{\"name\": \"list_log\", \"auth\": \"read\"}]}'\n")
+	_, err := Load(context.Background(), dir, []string{"snapper"}, nil, 0)
+	assert.ErrorContains(t, err, "doesn't start with snapper_", "plugins can't replace the built-in tools")
+
+	writePlugin(t, dir, "zypper", "#!/bin/sh\necho '{\"tools\": [{\"name\": \"zypper_search\", \"auth\": \"root\"}]}'\n")
+	_, err = Load(context.Background(), dir, []string{"zypper"}, nil, 0)
+	assert.ErrorContains(t, err, "invalid auth class")
+
+	writePlugin(t, dir, "zypper", zypperPlugin)
+	_, err = Load(context.Background(), dir, []string{"zypper"}, []string{"list_log", "zypper_search"}, 0)
+	assert.ErrorContains(t, err, "zypper_search is already registered", "plugins can't replace registered tools")
+	_, err = Load(context.Background(), dir, []string{"zypper", "zypper"}, nil, 0)
+	assert.ErrorContains(t, err, "already registered", "a plugin is only loaded once")
+
+	writePlugin(t, dir, "open", zypperPlugin)
+	require.NoError(t, os.Chmod(filepath.Join(dir, "open"), 0757))
+	_, err = Load(context.Background(), dir, []string{"open"}, nil, 0)
+	assert.ErrorContains(t, err, "writable")
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "zypper", zypperPlugin)
+	plugins, err := Load(context.Background(), dir, []string{"zypper"}, nil, 0)
+	require.NoError(t, err)
+	p := plugins[0]
+	readOnly, err := auth.NewNoAuth(true, false)
+	require.NoError(t, err)
+	call := func(tool Tool, args string) (*mcp.CallToolResult, error) {
+		req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: tool.Name, Arguments: json.RawMessage(args)}}
+		return p.Handler(tool, readOnly)(context.Background(), req)
+	}
+
+	res, err := call(p.Tools[0], `{"query": "vim"}`)
+	require.NoError(t, err)
+	assert.False(t, res.IsError)
+	assert.Equal(t, "found vim", res.Content[0].(*mcp.TextContent).Text)
+	assert.Equal(t, map[string]any{"packages": []any{"vim"}}, res.StructuredContent)
+
+	_, err = call(p.Tools[0], `{"query": "fail"}`)
+	assert.ErrorContains(t, err, "repository unreachable")
+
+	writePlugin(t, dir, "noisy", "#!/bin/sh\nhead -c 1000000 /dev/zero | tr '\\0' x >&2\nexit 1\n")
+	_, err = (&Plugin{Name: "noisy", Path: filepath.Join(dir, "noisy")}).Call(context.Background(), "noisy_tool", nil)
+	require.Error(t, err)
+	assert.Less(t, len(err.Error()), maxStderr+100, "the stderr of a plugin is capped")
+
+	writePlugin(t, dir, "chatty", "#!/bin/sh\nhead -c 9000000 /dev/zero\n")
+	_, err = (&Plugin{Name: "chatty", Path: filepath.Join(dir, "chatty")}).Call(context.Background(), "chatty_tool", nil)
+	assert.ErrorContains(t, err, "printed more than")
+
+	_, err = call(p.Tools[1], `{}`)
+	assert.ErrorContains(t, err, "wasn't authorized", "write tools need the write authorization")
+
+	readWrite, err := auth.NewNoAuth(true, true)
+	require.NoError(t, err)
+	res, err = p.Handler(p.Tools[1], readWrite)(context.Background(), &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "zypper_install"}})
+	require.NoError(t, err)
+	assert.True(t, res.IsError)
+	assert.Equal(t, "nothing to install", res.Content[0].(*mcp.TextContent).Text)
+}
@@ -0,0 +1,118 @@
+package privsep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// Client sends the operations to the helper, its methods are the ones of
+// the dbus package of go-systemd
+type Client struct {
+	Socket string
+}
+
+// call sends the request and returns the first response. With a channel
+// the connection is kept until the result of the job is sent to it, like
+// go-systemd does.
+func (c *Client) call(ctx context.Context, req Request, ch chan<- string) (*Response, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.Socket)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to the helper: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	req.Wait = ch != nil
+	dec := json.NewDecoder(conn)
+	var res Response
+	err = json.NewEncoder(conn).Encode(req)
+	if err == nil {
+		err = dec.Decode(&res)
+	}
+	if !stop() {
+		err = errors.Join(ctx.Err(), err)
+	}
+	if err == nil && res.Error != "" {
+		err = fmt.Errorf("helper: %s", res.Error)
+	}
+	if err != nil || ch == nil || res.Job == 0 {
+		conn.Close()
+		return &res, err
+	}
+	go func() {
+		defer conn.Close()
+		var done Response
+		if err := dec.Decode(&done); err != nil {
+			slog.Debug("lost the result of the job", "job", res.Job, "error", err)
+			return
+		}
+		ch <- done.Result
+	}()
+	return &res, nil
+}
+
+func (c *Client) job(ctx context.Context, op, name, mode string, ch chan<- string) (int, error) {
+	res, err := c.call(ctx, Request{Op: op, Units: []string{name}, Mode: mode}, ch)
+	if err != nil {
+		return 0, err
+	}
+	return res.Job, nil
+}
+
+func (c *Client) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.job(ctx, OpStart, name, mode, ch)
+}
+
+func (c *Client) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.job(ctx, OpStop, name, mode, ch)
+}
+
+func (c *Client) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.job(ctx, OpRestart, name, mode, ch)
+}
+
+func (c *Client) ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.job(ctx, OpReloadOrRestart, name, mode, ch)
+}
+
+// KillUnitContext has no result like the one of go-systemd, a failure is
+// logged
+func (c *Client) KillUnitContext(ctx context.Context, name string, signal int32) {
+	if _, err := c.call(ctx, Request{Op: OpKill, Units: []string{name}, Signal: signal}, nil); err != nil {
+		slog.Warn("couldn't kill unit", "unit", name, "error", err)
+	}
+}
+
+func (c *Client) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+	res, err := c.call(ctx, Request{Op: OpEnable, Units: files, Runtime: runtime, Force: force}, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	var changes []dbus.EnableUnitFileChange
+	for _, change := range res.Changes {
+		changes = append(changes, dbus.EnableUnitFileChange{Type: change.Type, Filename: change.Filename, Destination: change.Destination})
+	}
+	return res.Carries, changes, nil
+}
+
+func (c *Client) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+	res, err := c.call(ctx, Request{Op: OpDisable, Units: files, Runtime: runtime}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var changes []dbus.DisableUnitFileChange
+	for _, change := range res.Changes {
+		changes = append(changes, dbus.DisableUnitFileChange{Type: change.Type, Filename: change.Filename, Destination: change.Destination})
+	}
+	return changes, nil
+}
+
+func (c *Client) ReloadContext(ctx context.Context) error {
+	_, err := c.call(ctx, Request{Op: OpDaemonReload}, nil)
+	return err
+}
@@ -0,0 +1,237 @@
+// Package privsep moves the operations on units which need root into a
+// small helper, so that the server can run as an unprivileged user. The
+// helper takes one request per connection on a unix socket, checks the
+// peer and the unit policy and answers with the job, followed by the
+// result of the job once it's done.
+package privsep
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// DefaultSocket is where the helper listens
+const DefaultSocket = "/run/systemd-mcp-helper/helper.socket"
+
+// operations of the helper
+const (
+	OpStart           = "start"
+	OpStop            = "stop"
+	OpRestart         = "restart"
+	OpReloadOrRestart = "reload-or-restart"
+	OpKill            = "kill"
+	OpEnable          = "enable"
+	OpDisable         = "disable"
+	OpDaemonReload    = "daemon-reload"
+)
+
+// jobOps create a job whose result is sent after the job
+var jobOps = []string{OpStart, OpStop, OpRestart, OpReloadOrRestart}
+
+const (
+	// longest request which is read
+	maxRequestBytes = 64 * 1024
+	// the result of a job is waited for at most this long
+	jobTimeout = 10 * time.Minute
+)
+
+// Request is an operation for the helper
+type Request struct {
+	Op      string   `json:"op"`
+	Units   []string `json:"units,omitempty"`
+	Mode    string   `json:"mode,omitempty"`
+	Runtime bool     `json:"runtime,omitempty"`
+	Force   bool     `json:"force,omitempty"`
+	Signal  int32    `json:"signal,omitempty"`
+	// Wait sends the result of the job after the job
+	Wait bool `json:"wait,omitempty"`
+}
+
+// Response is the answer of the helper, a job is answered with the id of
+// the job and then, if requested, with its result
+type Response struct {
+	Job     int      `json:"job,omitempty"`
+	Result  string   `json:"result,omitempty"`
+	Carries bool     `json:"carries_install_info,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Change is a change of enable or disable
+type Change struct {
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	Destination string `json:"destination"`
+}
+
+// Manager are the methods of the service manager the helper calls
+type Manager interface {
+	StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	KillUnitContext(ctx context.Context, name string, signal int32)
+	EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error)
+	DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
+	ReloadContext(ctx context.Context) error
+}
+
+// Server is the helper
+type Server struct {
+	Manager Manager
+	// Check returns an error if the unit may not be changed
+	Check func(unit string) error
+	// Allowed returns whether the peer may use the helper
+	Allowed func(uid, gid uint32) bool
+}
+
+// Serve answers the connections of the listener until it's closed
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// peer returns the credentials of the process on the other end
+func peer(conn net.Conn) (*syscall.Ucred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("not a unix socket")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var ucred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	return ucred, credErr
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	ucred, err := peer(conn)
+	if err != nil || s.Allowed == nil || !s.Allowed(ucred.Uid, ucred.Gid) {
+		slog.Warn("helper connection denied", "audit", "helper_denied", "peer", ucred, "error", err)
+		enc.Encode(Response{Error: "permission denied"})
+		return
+	}
+	var req Request
+	line, err := bufio.NewReader(io.LimitReader(conn, maxRequestBytes)).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	if err != nil {
+		enc.Encode(Response{Error: "invalid request"})
+		return
+	}
+	// the operation is stopped if the server hangs up before the job is
+	// created, the job itself keeps running
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	slog.Warn("helper operation", "audit", "helper_call", "uid", ucred.Uid, "pid", ucred.Pid, "op", req.Op, "units", req.Units, "mode", req.Mode)
+	ch := make(chan string, 1)
+	res, err := s.do(ctx, &req, ch)
+	if err != nil {
+		slog.Warn("helper operation failed", "audit", "helper_call", "uid", ucred.Uid, "op", req.Op, "units", req.Units, "error", err)
+		enc.Encode(Response{Error: err.Error()})
+		return
+	}
+	if err := enc.Encode(res); err != nil || !req.Wait || !slices.Contains(jobOps, req.Op) {
+		return
+	}
+	select {
+	case result := <-ch:
+		enc.Encode(Response{Job: res.Job, Result: result})
+	case <-ctx.Done():
+	}
+}
+
+// do checks and runs the operation
+func (s *Server) do(ctx context.Context, req *Request, ch chan<- string) (*Response, error) {
+	if req.Op == OpDaemonReload {
+		if len(req.Units) != 0 {
+			return nil, fmt.Errorf("%s takes no units", req.Op)
+		}
+		return &Response{}, s.Manager.ReloadContext(ctx)
+	}
+	if len(req.Units) == 0 {
+		return nil, fmt.Errorf("no unit given")
+	}
+	// a path would let the server enable a unit file it wrote itself and
+	// start it as root, the unit policy only checks the name of the file
+	for _, unit := range req.Units {
+		if strings.Contains(unit, "/") {
+			slog.Warn("helper operation with a unit path refused", "audit", "helper_denied", "op", req.Op, "unit", unit)
+			return nil, fmt.Errorf("the helper only takes unit names, not the path %q", unit)
+		}
+	}
+	if s.Check != nil {
+		for _, unit := range req.Units {
+			if err := s.Check(unit); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var res Response
+	var err error
+	switch req.Op {
+	case OpStart, OpStop, OpRestart, OpReloadOrRestart:
+		if len(req.Units) != 1 {
+			return nil, fmt.Errorf("%s takes a single unit", req.Op)
+		}
+		call := map[string]func(context.Context, string, string, chan<- string) (int, error){
+			OpStart:           s.Manager.StartUnitContext,
+			OpStop:            s.Manager.StopUnitContext,
+			OpRestart:         s.Manager.RestartUnitContext,
+			OpReloadOrRestart: s.Manager.ReloadOrRestartUnitContext,
+		}[req.Op]
+		res.Job, err = call(ctx, req.Units[0], req.Mode, ch)
+	case OpKill:
+		for _, unit := range req.Units {
+			s.Manager.KillUnitContext(ctx, unit, req.Signal)
+		}
+	case OpEnable:
+		var changes []dbus.EnableUnitFileChange
+		res.Carries, changes, err = s.Manager.EnableUnitFilesContext(ctx, req.Units, req.Runtime, req.Force)
+		for _, c := range changes {
+			res.Changes = append(res.Changes, Change{Type: c.Type, Filename: c.Filename, Destination: c.Destination})
+		}
+	case OpDisable:
+		var changes []dbus.DisableUnitFileChange
+		changes, err = s.Manager.DisableUnitFilesContext(ctx, req.Units, req.Runtime)
+		for _, c := range changes {
+			res.Changes = append(res.Changes, Change{Type: c.Type, Filename: c.Filename, Destination: c.Destination})
+		}
+	default:
+		return nil, fmt.Errorf("invalid operation %q", req.Op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,133 @@
+package privsep
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeManager records the calls and finishes every job at once
+type fakeManager struct {
+	calls []string
+}
+
+func (m *fakeManager) job(op, name string, ch chan<- string) (int, error) {
+	m.calls = append(m.calls, op+" "+name)
+	if ch != nil {
+		ch <- "done"
+	}
+	return 42, nil
+}
+
+func (m *fakeManager) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return m.job("start", name, ch)
+}
+
+func (m *fakeManager) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return m.job("stop", name, ch)
+}
+
+func (m *fakeManager) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return m.job("restart", name, ch)
+}
+
+func (m *fakeManager) ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return m.job("reload-or-restart", name, ch)
+}
+
+func (m *fakeManager) KillUnitContext(ctx context.Context, name string, signal int32) {
+	m.calls = append(m.calls, fmt.Sprintf("kill %s %d", name, signal))
+}
+
+func (m *fakeManager) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+	m.calls = append(m.calls, "enable "+files[0])
+	return true, []dbus.EnableUnitFileChange{{Type: "symlink", Filename: "/etc/systemd/system/multi-user.target.wants/" + files[0], Destination: "/usr/lib/systemd/system/" + files[0]}}, nil
+}
+
+func (m *fakeManager) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+	m.calls = append(m.calls, "disable "+files[0])
+	return nil, nil
+}
+
+func (m *fakeManager) ReloadContext(ctx context.Context) error {
+	m.calls = append(m.calls, "daemon-reload")
+	return nil
+}
+
+func startHelper(t *testing.T, allowed bool) (*fakeManager, *Client) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "helper.socket")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	m := &fakeManager{}
+	s := &Server{
+		Manager: m,
+		Check: func(unit string) error {
+			if unit == "sshd.service" {
+				return fmt.Errorf("changing %s denied", unit)
+			}
+			return nil
+		},
+		Allowed: func(uid, gid uint32) bool { return allowed && uid == uint32(os.Getuid()) },
+	}
+	go s.Serve(l)
+	return m, &Client{Socket: socket}
+}
+
+func TestHelperJob(t *testing.T) {
+	m, c := startHelper(t, true)
+	ch := make(chan string, 1)
+	job, err := c.StartUnitContext(context.Background(), "nginx.service", "replace", ch)
+	require.NoError(t, err)
+	assert.Equal(t, 42, job)
+	select {
+	case result := <-ch:
+		assert.Equal(t, "done", result)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result of the job")
+	}
+
+	_, err = c.RestartUnitContext(context.Background(), "sshd.service", "replace", nil)
+	assert.ErrorContains(t, err, "denied", "the helper checks the unit policy")
+
+	c.KillUnitContext(context.Background(), "nginx.service", 9)
+	require.NoError(t, c.ReloadContext(context.Background()))
+	assert.Equal(t, []string{"start nginx.service", "kill nginx.service 9", "daemon-reload"}, m.calls)
+}
+
+func TestHelperEnable(t *testing.T) {
+	_, c := startHelper(t, true)
+	carries, changes, err := c.EnableUnitFilesContext(context.Background(), []string{"nginx.service"}, false, false)
+	require.NoError(t, err)
+	assert.True(t, carries)
+	assert.Equal(t, []dbus.EnableUnitFileChange{{Type: "symlink", Filename: "/etc/systemd/system/multi-user.target.wants/nginx.service", Destination: "/usr/lib/systemd/system/nginx.service"}}, changes)
+
+	_, err = c.DisableUnitFilesContext(context.Background(), []string{"nginx.service", "sshd.service"}, false)
+	assert.Error(t, err, "every unit is checked")
+}
+
+func TestHelperEnablePath(t *testing.T) {
+	// a unit file the server wrote itself must not be enabled as root
+	m, c := startHelper(t, true)
+	_, _, err := c.EnableUnitFilesContext(context.Background(), []string{"/tmp/x.service"}, false, false)
+	assert.ErrorContains(t, err, "only takes unit names")
+	_, err = c.DisableUnitFilesContext(context.Background(), []string{"../../tmp/x.service"}, false)
+	assert.Error(t, err)
+	assert.Empty(t, m.calls)
+}
+
+func TestHelperPeer(t *testing.T) {
+	m, c := startHelper(t, false)
+	_, err := c.StopUnitContext(context.Background(), "nginx.service", "replace", nil)
+	assert.ErrorContains(t, err, "permission denied")
+	assert.Empty(t, m.calls)
+}
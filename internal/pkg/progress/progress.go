@@ -0,0 +1,57 @@
+package progress
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MinInterval is the minimal time between two notifications of a call
+var MinInterval = 500 * time.Millisecond
+
+// Reporter sends progress notifications for a tool call whose client asked
+// for them with a progress token. A nil Reporter does nothing, so that the
+// backends don't have to check.
+type Reporter struct {
+	session *mcp.ServerSession
+	token   any
+	total   float64
+	last    time.Time
+}
+
+// New returns a reporter for the call, nil if the call has no progress
+// token. A total of 0 means that the total isn't known.
+func New(req *mcp.CallToolRequest, total float64) *Reporter {
+	if req == nil || req.Session == nil || req.Params == nil {
+		return nil
+	}
+	token := req.Params.GetProgressToken()
+	if token == nil {
+		return nil
+	}
+	return &Reporter{session: req.Session, token: token, total: total}
+}
+
+// Report sends the progress, which has to increase with every call.
+// Notifications which follow the previous one within MinInterval are
+// dropped, except the one reaching the total.
+func (r *Reporter) Report(ctx context.Context, progress float64, message string) {
+	if r == nil {
+		return
+	}
+	if (r.total == 0 || progress < r.total) && time.Since(r.last) < MinInterval {
+		return
+	}
+	r.last = time.Now()
+	err := r.session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+		ProgressToken: r.token,
+		Progress:      progress,
+		Total:         r.total,
+		Message:       message,
+	})
+	if err != nil {
+		slog.Debug("couldn't send progress notification", "error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package progress
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countParams struct{}
+
+func TestReporter(t *testing.T) {
+	oldInterval := MinInterval
+	defer func() { MinInterval = oldInterval }()
+	MinInterval = time.Hour
+
+	assert.Nil(t, New(nil, 10))
+	var nilReporter *Reporter
+	nilReporter.Report(context.Background(), 1, "ignored")
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "count"}, func(ctx context.Context, req *mcp.CallToolRequest, _ *countParams) (*mcp.CallToolResult, any, error) {
+		reporter := New(req, 3)
+		for i := 1; i <= 3; i++ {
+			reporter.Report(ctx, float64(i), "counting")
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil, nil
+	})
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err := server.Connect(context.Background(), serverTransport, nil)
+	require.NoError(t, err)
+	var mu sync.Mutex
+	var progress []float64
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, &mcp.ClientOptions{
+		ProgressNotificationHandler: func(ctx context.Context, req *mcp.ProgressNotificationClientRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress = append(progress, req.Params.Progress)
+		},
+	}).Connect(context.Background(), clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	params := &mcp.CallToolParams{Name: "count"}
+	params.SetProgressToken("token")
+	_, err = session.CallTool(context.Background(), params)
+	require.NoError(t, err)
+	// the second one is throttled, the last one reaches the total
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(progress) == 2
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []float64{1, 3}, progress)
+	mu.Unlock()
+
+	// without a token nothing is sent
+	_, err = session.CallTool(context.Background(), &mcp.CallToolParams{Name: "count"})
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Len(t, progress, 2)
+	mu.Unlock()
+}
@@ -0,0 +1,167 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// Replacement is put in place of a redacted secret
+const Replacement = "[REDACTED]"
+
+// privateKeyPattern matches a PEM private key, up to the end of the text if
+// its END line is missing
+const privateKeyPattern = `(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----.*?(?:-----END [A-Z0-9 ]*PRIVATE KEY-----|\z)`
+
+var (
+	keyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----`)
+	keyEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY-----`)
+)
+
+// DefaultPatterns are the regular expressions for passwords, tokens and
+// private keys which are redacted unless the defaults are disabled. If a
+// pattern has a capture group only the group is replaced, so that the key
+// of a KEY=value pair stays readable.
+func DefaultPatterns() []string {
+	return []string{
+		`(?i)[a-z0-9_.-]*(?:password|passwd|passphrase|secret|token|api[_-]?key|access[_-]?key|credentials?)[a-z0-9_.-]*"?\s*[=:]\s*("[^"]*"|'[^']*'|[^\s,;&"']+)`,
+		`(?i)\b(?:bearer|basic)\s+([a-z0-9._~+/-]+=*)`,
+		`(?i)://[^/\s:@]+:([^/\s@]+)@`,
+		privateKeyPattern,
+	}
+}
+
+// Redactor replaces the matches of its patterns in the output of the tools,
+// so that credentials don't end up in the context of the model
+type Redactor struct {
+	patterns []*regexp.Regexp
+	// private keys are redacted across the lines of a LineRedactor
+	keys bool
+}
+
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{keys: slices.Contains(patterns, privateKeyPattern)}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+var global, _ = New(DefaultPatterns())
+
+// Set replaces the redactor used by the tools, nil disables the redaction
+func Set(r *Redactor) {
+	global = r
+}
+
+func Get() *Redactor {
+	return global
+}
+
+// Redact returns s with all secrets replaced and the number of replacements
+func (r *Redactor) Redact(s string) (string, int) {
+	if r == nil {
+		return s, 0
+	}
+	count := 0
+	for _, re := range r.patterns {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			count++
+			if re.NumSubexp() == 0 {
+				return Replacement
+			}
+			loc := re.FindStringSubmatchIndex(match)
+			if loc == nil || loc[2] < 0 {
+				return Replacement
+			}
+			return match[:loc[2]] + Replacement + match[loc[3]:]
+		})
+	}
+	return s, count
+}
+
+// String redacts s with the global redactor
+func String(s string) string {
+	s, _ = global.Redact(s)
+	return s
+}
+
+// Strings redacts all elements of a slice in place with the global redactor
+// and returns the number of replacements
+func Strings(lines []string) int {
+	total := 0
+	for i, line := range lines {
+		var n int
+		lines[i], n = global.Redact(line)
+		total += n
+	}
+	return total
+}
+
+// LineRedactor redacts a text line by line. The patterns only see a single
+// line, so it remembers whether a line is inside of a private key, whose
+// base64 lines don't match any pattern on their own, and redacts them up to
+// the END line.
+type LineRedactor struct {
+	r *Redactor
+	// InKey is set after the BEGIN line of a private key until its END
+	// line, readers which continue a text later keep it with their position
+	InKey bool
+}
+
+// Lines returns a line redactor of the global redactor
+func Lines() *LineRedactor {
+	return &LineRedactor{r: global}
+}
+
+// Redact returns the line with all secrets replaced and the number of
+// replacements
+func (l *LineRedactor) Redact(line string) (string, int) {
+	if l.r == nil {
+		return line, 0
+	}
+	if !l.r.keys {
+		return l.r.Redact(line)
+	}
+	prefix, count := "", 0
+	if l.InKey {
+		loc := keyEnd.FindStringIndex(line)
+		if loc == nil {
+			return Replacement, 1
+		}
+		prefix, count, line = Replacement, 1, line[loc[1]:]
+	}
+	l.InKey = opensKey(line)
+	line, n := l.r.Redact(line)
+	return prefix + line, count + n
+}
+
+// Skip follows a line which isn't shown, like the lines before the offset
+// of a page, so that the key state of the next lines is right
+func (l *LineRedactor) Skip(line string) {
+	if l.r == nil || !l.r.keys {
+		return
+	}
+	if l.InKey {
+		loc := keyEnd.FindStringIndex(line)
+		if loc == nil {
+			return
+		}
+		line = line[loc[1]:]
+	}
+	l.InKey = opensKey(line)
+}
+
+// opensKey returns whether a private key begins in the line and doesn't
+// end in it
+func opensKey(line string) bool {
+	begins := keyBegin.FindAllStringIndex(line, -1)
+	if len(begins) == 0 {
+		return false
+	}
+	return !keyEnd.MatchString(line[begins[len(begins)-1][1]:])
+}
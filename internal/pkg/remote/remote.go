@@ -0,0 +1,172 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	godbus "github.com/godbus/dbus/v5"
+)
+
+// the ssh binary, replaced in the tests
+var sshBinary = "ssh"
+
+var (
+	validUser = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+	validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+)
+
+// Host is a machine which is managed over ssh, like with systemctl -H
+type Host struct {
+	User string
+	Name string
+	Port int
+}
+
+// Parse parses [user@]host[:port], IPv6 addresses are given in brackets
+func Parse(spec string) (*Host, error) {
+	h := &Host{}
+	rest := spec
+	if user, name, ok := strings.Cut(spec, "@"); ok {
+		if !validUser.MatchString(user) {
+			return nil, fmt.Errorf("invalid user in host %q", spec)
+		}
+		h.User, rest = user, name
+	}
+	name, port, hasPort := rest, "", false
+	if addr, ok := strings.CutPrefix(rest, "["); ok {
+		var after string
+		if name, after, ok = strings.Cut(addr, "]"); !ok || net.ParseIP(name) == nil {
+			return nil, fmt.Errorf("invalid address in host %q", spec)
+		}
+		if after != "" {
+			if port, hasPort = strings.CutPrefix(after, ":"); !hasPort {
+				return nil, fmt.Errorf("invalid address in host %q", spec)
+			}
+		}
+	} else {
+		name, port, hasPort = strings.Cut(rest, ":")
+		if !validName.MatchString(name) {
+			return nil, fmt.Errorf("invalid host name in host %q", spec)
+		}
+	}
+	h.Name = name
+	if hasPort {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port in host %q", spec)
+		}
+		h.Port = n
+	}
+	return h, nil
+}
+
+func (h *Host) String() string {
+	s := h.Name
+	if strings.Contains(s, ":") {
+		s = "[" + s + "]"
+	}
+	if h.User != "" {
+		s = h.User + "@" + s
+	}
+	if h.Port != 0 {
+		s += ":" + strconv.Itoa(h.Port)
+	}
+	return s
+}
+
+// quote quotes an argument for the shell of the remote user, which gets the
+// command line of ssh
+func quote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// sshArgs returns the arguments of ssh to run the command on the host.
+// Batch mode fails instead of asking for a password, as there is no
+// terminal to ask on.
+func (h *Host) sshArgs(command ...string) []string {
+	args := []string{"-xT", "-o", "BatchMode=yes"}
+	if h.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(h.Port))
+	}
+	if h.User != "" {
+		args = append(args, "-l", h.User)
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = quote(arg)
+	}
+	return append(args, "--", h.Name, strings.Join(quoted, " "))
+}
+
+// Command returns the command to run on the host
+func (h *Host) Command(ctx context.Context, command ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, sshBinary, h.sshArgs(command...)...)
+}
+
+// stderrLog logs the messages of ssh, like a rejected host key
+type stderrLog struct {
+	host *Host
+}
+
+func (l stderrLog) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(string(p), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			slog.Warn("ssh", "host", l.host.String(), "message", line)
+		}
+	}
+	return len(p), nil
+}
+
+// pipe is the stdin and stdout of ssh as a connection of the bus
+type pipe struct {
+	io.Reader
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (p *pipe) Close() error {
+	p.WriteCloser.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+	return nil
+}
+
+// DialBus connects to the system bus of the host through
+// systemd-stdio-bridge on the host, like systemctl -H. The connection can
+// be passed to the dbus package of go-systemd.
+func (h *Host) DialBus() (*godbus.Conn, error) {
+	cmd := exec.Command(sshBinary, h.sshArgs("systemd-stdio-bridge")...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = stderrLog{host: h}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("couldn't start ssh: %w", err)
+	}
+	conn, err := godbus.NewConn(&pipe{Reader: stdout, WriteCloser: stdin, cmd: cmd})
+	if err != nil {
+		return nil, err
+	}
+	// the bridge knows the user of ssh, so no user is claimed
+	if err := conn.Auth([]godbus.Auth{godbus.AuthExternal(""), godbus.AuthAnonymous()}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("couldn't authenticate to the bus of %s: %w", h, err)
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("couldn't connect to the bus of %s: %w", h, err)
+	}
+	return conn, nil
+}
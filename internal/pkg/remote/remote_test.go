@@ -0,0 +1,56 @@
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want *Host
+	}{
+		{"node1", &Host{Name: "node1"}},
+		{"root@node1.example.com", &Host{User: "root", Name: "node1.example.com"}},
+		{"admin@10.0.0.5:2222", &Host{User: "admin", Name: "10.0.0.5", Port: 2222}},
+		{"[fe80::1]:22", &Host{Name: "fe80::1", Port: 22}},
+		{"root@[::1]", &Host{User: "root", Name: "::1"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.spec)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.want, got)
+		assert.Equal(t, tt.spec, got.String())
+	}
+
+	for _, spec := range []string{"", "-oProxyCommand=x", "root@", "@node1", "node1:", "node1:0", "node1:ssh", "[node1]", "[::1]x", "fe80::1", "a b", "-l@node1"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	h := &Host{User: "root", Name: "node1", Port: 2222}
+	assert.Equal(t, []string{"-xT", "-o", "BatchMode=yes", "-p", "2222", "-l", "root", "--", "node1", `'journalctl' '--grep=it'\''s down'`},
+		h.sshArgs("journalctl", "--grep=it's down"))
+}
+
+func TestCommand(t *testing.T) {
+	// the fake ssh runs the command line in a shell like sshd does
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "ssh")
+	require.NoError(t, os.WriteFile(fake, []byte("#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n"), 0o755))
+	old := sshBinary
+	sshBinary = fake
+	defer func() { sshBinary = old }()
+
+	h := &Host{Name: "node1"}
+	out, err := h.Command(context.Background(), "printf", "%s|", "it's", "$(id)", "a b").Output()
+	require.NoError(t, err)
+	assert.Equal(t, "it's|$(id)|a b|", string(out))
+}
@@ -0,0 +1,131 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ParamName is the parameter which is added to every tool
+const ParamName = "format"
+
+// formatSchema returns the schema of the format parameter with the
+// current default
+func formatSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		Type:        "string",
+		Enum:        []any{Full, Compact, Table, Minimal},
+		Default:     json.RawMessage(`"` + DefaultFormat() + `"`),
+		Description: "Output format: full returns the JSON of the tool, compact a terse key=value line per entry for agents, table-text aligned text tables and minimal the compact lines with abbreviated keys, without zero values and with long texts cut",
+	}
+}
+
+// withFormat returns a copy of the tool with the format parameter, tools
+// which have a format parameter of their own are returned unchanged
+func withFormat(tool *mcp.Tool) *mcp.Tool {
+	schema, ok := tool.InputSchema.(*jsonschema.Schema)
+	if !ok || schema == nil {
+		return tool
+	}
+	if _, ok := schema.Properties[ParamName]; ok {
+		return tool
+	}
+	s := *schema
+	s.Properties = maps.Clone(schema.Properties)
+	if s.Properties == nil {
+		s.Properties = make(map[string]*jsonschema.Schema)
+	}
+	s.Properties[ParamName] = formatSchema()
+	t := *tool
+	t.InputSchema = &s
+	return &t
+}
+
+// takeFormat removes the format parameter from the arguments of the call.
+// Values which aren't formats of this package are left for tools with a
+// format parameter of their own.
+func takeFormat(params *mcp.CallToolParamsRaw) (string, error) {
+	var args map[string]json.RawMessage
+	if params == nil || json.Unmarshal(params.Arguments, &args) != nil {
+		return DefaultFormat(), nil
+	}
+	raw, ok := args[ParamName]
+	if !ok {
+		return DefaultFormat(), nil
+	}
+	var format string
+	if err := json.Unmarshal(raw, &format); err != nil {
+		return "", fmt.Errorf("format must be one of %v", Formats())
+	}
+	if !slices.Contains(Formats(), format) {
+		return Full, nil
+	}
+	delete(args, ParamName)
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	params.Arguments = data
+	return format, nil
+}
+
+// Middleware adds the format parameter to the tools and renders the text
+// content of their results in the requested format
+func Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		switch method {
+		case "tools/list":
+			res, err := next(ctx, method, req)
+			if list, ok := res.(*mcp.ListToolsResult); ok && err == nil {
+				tools := make([]*mcp.Tool, len(list.Tools))
+				for i, tool := range list.Tools {
+					tools[i] = withFormat(tool)
+				}
+				list.Tools = tools
+			}
+			return res, err
+		case "tools/call":
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok {
+				return next(ctx, method, req)
+			}
+			format, err := takeFormat(call.Params)
+			if err != nil {
+				return nil, err
+			}
+			res, err := next(ctx, method, req)
+			if result, ok := res.(*mcp.CallToolResult); ok && err == nil && format != Full {
+				apply(result, format)
+			}
+			return res, err
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// apply renders the text content of a result, the structured content is
+// left out as it carries the same data
+func apply(res *mcp.CallToolResult, format string) {
+	var texts []string
+	for _, content := range res.Content {
+		text, ok := content.(*mcp.TextContent)
+		if !ok {
+			return
+		}
+		texts = append(texts, text.Text)
+	}
+	if len(texts) == 0 {
+		return
+	}
+	rendered := Render(texts, format)
+	res.Content = make([]mcp.Content, len(rendered))
+	for i, text := range rendered {
+		res.Content[i] = &mcp.TextContent{Text: text}
+	}
+	res.StructuredContent = nil
+}
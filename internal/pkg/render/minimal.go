@@ -0,0 +1,126 @@
+package render
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// DefaultMaxValue is the number of characters of a string in the minimal
+// format, longer ones are cut
+const DefaultMaxValue = 200
+
+// maxValue is the --output-budget, 0 if it isn't set
+var maxValue atomic.Int64
+
+// SetOutputBudget cuts the strings of the minimal format after n characters
+// and makes it the format of calls which don't pass one, 0 keeps the full
+// format as default
+func SetOutputBudget(n int) {
+	maxValue.Store(int64(max(n, 0)))
+}
+
+// DefaultFormat returns the format of calls without a format parameter
+func DefaultFormat() string {
+	if maxValue.Load() > 0 {
+		return Minimal
+	}
+	return Full
+}
+
+func maxValueLength() int {
+	if n := maxValue.Load(); n > 0 {
+		return int(n)
+	}
+	return DefaultMaxValue
+}
+
+// abbreviations are the short names of the keys the tools return most,
+// other keys are kept
+var abbreviations = map[string]string{
+	"identifier":           "ident",
+	"unit_name":            "unit",
+	"exe_name":             "exe",
+	"message":              "msg",
+	"messages":             "msgs",
+	"nr_messages":          "n",
+	"documentation":        "docs",
+	"description":          "desc",
+	"Description":          "desc",
+	"LoadState":            "load",
+	"ActiveState":          "active",
+	"SubState":             "sub",
+	"UnitFileState":        "file_state",
+	"UnitFilePreset":       "preset",
+	"FragmentPath":         "path",
+	"MainPID":              "pid",
+	"ExecMainStatus":       "status",
+	"ActiveEnterTimestamp": "since",
+	"MemoryCurrent":        "mem",
+	"CPUUsageNSec":         "cpu_ns",
+	"TasksCurrent":         "tasks",
+	"NRestarts":            "restarts",
+	"JobId":                "job",
+	"JobType":              "job_type",
+	"JobPath":              "job_path",
+	"filename":             "file",
+	"destination":          "dest",
+	"permissions":          "perm",
+	"modification_time":    "mtime",
+}
+
+// isZero reports values which are left out of the minimal format next to
+// the empty ones
+func isZero(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return !v
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	}
+	return isEmpty(v)
+}
+
+// cut shortens a string to limit characters, marked with an ellipsis
+func cut(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit-1]) + "…"
+}
+
+// minimize abbreviates the keys, drops the zero values and cuts the strings
+// of a decoded value. A key keeps its name if the object has its
+// abbreviation as key already.
+func minimize(v any, limit int) any {
+	switch v := v.(type) {
+	case object:
+		keys := make(map[string]bool, len(v))
+		for _, f := range v {
+			keys[f.key] = true
+		}
+		obj := object{}
+		for _, f := range v {
+			value := minimize(f.value, limit)
+			if isZero(value) {
+				continue
+			}
+			key := f.key
+			if short, ok := abbreviations[key]; ok && !keys[short] {
+				key = short
+			}
+			obj = append(obj, field{key: key, value: value})
+		}
+		return obj
+	case []any:
+		arr := make([]any, len(v))
+		for i, elem := range v {
+			arr[i] = minimize(elem, limit)
+		}
+		return arr
+	case string:
+		return cut(v, limit)
+	}
+	return v
+}
@@ -0,0 +1,331 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// the formats of the format parameter of the tools
+const (
+	// Full returns the JSON of the tool unchanged
+	Full = "full"
+	// Compact returns a single line of key=value pairs per object
+	Compact = "compact"
+	// Table returns lists of objects as aligned text tables
+	Table = "table-text"
+	// Minimal is the compact format with abbreviated keys, without zero
+	// values and with long strings cut, for the fewest tokens
+	Minimal = "minimal"
+)
+
+// Formats returns the valid formats
+func Formats() []string {
+	return []string{Full, Compact, Table, Minimal}
+}
+
+// field is a member of an object, the members keep the order of the tool
+type field struct {
+	key   string
+	value any
+}
+
+// object is a decoded JSON object, arrays are []any and scalars are strings,
+// json.Number, bool or nil
+type object []field
+
+// decode parses JSON and keeps the order of the members of the objects
+func decode(text string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("trailing data after JSON value")
+	}
+	return v, nil
+}
+
+func decodeValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, field{key: key.(string), value: value})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// isEmpty reports values which are left out of the compact format
+func isEmpty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case object:
+		return len(v) == 0
+	}
+	return false
+}
+
+// isRows reports lists of objects, which are rendered one line or table row
+// per object
+func isRows(v any) bool {
+	arr, ok := v.([]any)
+	if !ok || len(arr) == 0 {
+		return false
+	}
+	for _, elem := range arr {
+		if _, ok := elem.(object); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// encode returns a value as compact JSON
+func encode(v any) string {
+	var b bytes.Buffer
+	writeJSON(&b, v)
+	return b.String()
+}
+
+func writeJSON(b *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case object:
+		b.WriteByte('{')
+		for i, f := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key, _ := json.Marshal(f.key)
+			b.Write(key)
+			b.WriteByte(':')
+			writeJSON(b, f.value)
+		}
+		b.WriteByte('}')
+	case []any:
+		b.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSON(b, elem)
+		}
+		b.WriteByte(']')
+	default:
+		data, _ := json.Marshal(v)
+		b.Write(data)
+	}
+}
+
+// scalar returns a value for a line or a cell, lists of scalars are joined
+// with commas and other structures are compact JSON
+func scalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, elem := range v {
+			switch elem.(type) {
+			case object, []any:
+				return encode(v)
+			}
+			parts = append(parts, scalar(elem))
+		}
+		return strings.Join(parts, ",")
+	}
+	return encode(v)
+}
+
+// quote quotes strings which couldn't be told apart from the next pair
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// line returns the non-empty members of an object as key=value pairs,
+// lists of objects are left to the caller
+func line(obj object) string {
+	var pairs []string
+	for _, f := range obj {
+		if isEmpty(f.value) || isRows(f.value) {
+			continue
+		}
+		value := scalar(f.value)
+		if _, ok := f.value.(string); ok {
+			value = quote(value)
+		}
+		pairs = append(pairs, f.key+"="+value)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// compact writes one line per object, the objects of a list member follow
+// the line of their parent indented under the key of the list
+func compact(b *strings.Builder, v any, indent string) {
+	switch v := v.(type) {
+	case object:
+		if l := line(v); l != "" {
+			b.WriteString(indent + l + "\n")
+		}
+		for _, f := range v {
+			if isRows(f.value) {
+				b.WriteString(indent + f.key + ":\n")
+				compact(b, f.value, indent+"  ")
+			}
+		}
+	case []any:
+		if !isRows(v) {
+			b.WriteString(indent + scalar(v) + "\n")
+			return
+		}
+		for _, elem := range v {
+			compact(b, elem, indent)
+		}
+	default:
+		b.WriteString(indent + scalar(v) + "\n")
+	}
+}
+
+// flatten keeps a value in its line and cell
+var flatten = strings.NewReplacer("\n", " ", "\t", " ")
+
+// table writes lists of objects as a table with a column per member and the
+// other members of an object as "key: value" lines
+func table(b *strings.Builder, v any) {
+	switch v := v.(type) {
+	case object:
+		w := tabwriter.NewWriter(b, 0, 0, 1, ' ', 0)
+		for _, f := range v {
+			if !isEmpty(f.value) && !isRows(f.value) {
+				fmt.Fprintf(w, "%s:\t%s\n", f.key, flatten.Replace(scalar(f.value)))
+			}
+		}
+		w.Flush()
+		for _, f := range v {
+			if isRows(f.value) {
+				b.WriteString("\n" + f.key + ":\n")
+				table(b, f.value)
+			}
+		}
+	case []any:
+		if !isRows(v) {
+			b.WriteString(scalar(v) + "\n")
+			return
+		}
+		var columns []string
+		seen := map[string]bool{}
+		for _, elem := range v {
+			for _, f := range elem.(object) {
+				if !seen[f.key] {
+					seen[f.key] = true
+					columns = append(columns, f.key)
+				}
+			}
+		}
+		w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, elem := range v {
+			cells := make([]string, len(columns))
+			for i, column := range columns {
+				cells[i] = "-"
+				for _, f := range elem.(object) {
+					if f.key == column && !isEmpty(f.value) {
+						cells[i] = flatten.Replace(scalar(f.value))
+					}
+				}
+			}
+			fmt.Fprintln(w, strings.Join(cells, "\t"))
+		}
+		w.Flush()
+	default:
+		b.WriteString(scalar(v) + "\n")
+	}
+}
+
+// Render returns the JSON texts of a tool in the format, the texts are
+// returned unchanged if one of them isn't JSON. Multiple objects, like the
+// units of list_loaded_units, are rendered as one list.
+func Render(texts []string, format string) []string {
+	if format == Full || format == "" {
+		return texts
+	}
+	var values []any
+	for _, text := range texts {
+		v, err := decode(text)
+		if err != nil {
+			return texts
+		}
+		values = append(values, v)
+	}
+	var v any = values
+	if len(values) == 1 {
+		v = values[0]
+	} else if !isRows(v) {
+		out := make([]string, len(values))
+		for i, value := range values {
+			out[i] = Render([]string{encode(value)}, format)[0]
+		}
+		return out
+	}
+	if format == Minimal {
+		v = minimize(v, maxValueLength())
+	}
+	var b strings.Builder
+	if format == Table {
+		table(&b, v)
+	} else {
+		compact(&b, v, "")
+	}
+	out := strings.TrimSuffix(b.String(), "\n")
+	if out == "" {
+		// an empty list stays JSON rather than an empty text
+		return texts
+	}
+	return []string{out}
+}
@@ -0,0 +1,139 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const logResult = `{"host":"node1","nr_messages":2,"messages":[{"time":"2026-01-02T10:00:00Z","unit_name":"nginx.service","message":"Started nginx"},{"time":"2026-01-02T10:00:01Z","message":"ready"}],"cursor":""}`
+
+func TestRender(t *testing.T) {
+	t.Run("full", func(t *testing.T) {
+		assert.Equal(t, []string{logResult}, Render([]string{logResult}, Full))
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		assert.Equal(t, []string{`host=node1 nr_messages=2
+messages:
+  time=2026-01-02T10:00:00Z unit_name=nginx.service message="Started nginx"
+  time=2026-01-02T10:00:01Z message=ready`}, Render([]string{logResult}, Compact))
+	})
+
+	t.Run("table", func(t *testing.T) {
+		assert.Equal(t, []string{`host:        node1
+nr_messages: 2
+
+messages:
+TIME                  UNIT_NAME      MESSAGE
+2026-01-02T10:00:00Z  nginx.service  Started nginx
+2026-01-02T10:00:01Z  -              ready`}, Render([]string{logResult}, Table))
+	})
+
+	t.Run("objects of multiple contents are one list", func(t *testing.T) {
+		units := []string{`{"Id":"a.service","ActiveState":"active","ExecStart":["/usr/bin/a","-v"]}`, `{"Id":"b.service","ActiveState":"failed","ExecStart":null}`}
+		assert.Equal(t, []string{"Id=a.service ActiveState=active ExecStart=/usr/bin/a,-v\nId=b.service ActiveState=failed"}, Render(units, Compact))
+		assert.Equal(t, []string{"ID         ACTIVESTATE  EXECSTART\na.service  active       /usr/bin/a,-v\nb.service  failed       -"}, Render(units, Table))
+	})
+
+	t.Run("text and empty lists are unchanged", func(t *testing.T) {
+		assert.Equal(t, []string{"nothing changed for a.service"}, Render([]string{"nothing changed for a.service"}, Compact))
+		assert.Equal(t, []string{"[]"}, Render([]string{"[]"}, Table))
+	})
+
+	t.Run("minimal", func(t *testing.T) {
+		assert.Equal(t, []string{`host=node1 n=2
+msgs:
+  time=2026-01-02T10:00:00Z unit=nginx.service msg="Started nginx"
+  time=2026-01-02T10:00:01Z msg=ready`}, Render([]string{logResult}, Minimal))
+		units := []string{`{"Id":"a.service","ActiveState":"active","NRestarts":0,"Transient":false,"MainPID":42}`}
+		assert.Equal(t, []string{"Id=a.service active=active pid=42"}, Render(units, Minimal))
+		long := `{"message":"` + strings.Repeat("ä", DefaultMaxValue+10) + `","msg":"kept"}`
+		out := Render([]string{long}, Minimal)[0]
+		assert.Equal(t, `message=`+strings.Repeat("ä", DefaultMaxValue-1)+`… msg=kept`, out, "a key whose abbreviation is taken keeps its name")
+	})
+
+	t.Run("nested values", func(t *testing.T) {
+		assert.Equal(t, []string{`a="x y" b={"c":1} d=[{"e":1},2]`}, Render([]string{`{"a":"x y","b":{"c":1},"d":[{"e":1},2]}`}, Compact))
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	schema, err := jsonschema.For[struct {
+		Unit string `json:"unit"`
+	}](nil)
+	require.NoError(t, err)
+	own := &jsonschema.Schema{Type: "object", Properties: map[string]*jsonschema.Schema{"format": {Type: "string"}}}
+	var args json.RawMessage
+	handler := Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method == "tools/list" {
+			return &mcp.ListToolsResult{Tools: []*mcp.Tool{{Name: "list_log", InputSchema: schema}, {Name: "get_man_page", InputSchema: own}}}, nil
+		}
+		args = req.(*mcp.CallToolRequest).Params.Arguments
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: logResult}}, StructuredContent: map[string]any{"host": "node1"}}, nil
+	})
+
+	t.Run("list", func(t *testing.T) {
+		res, err := handler(context.Background(), "tools/list", &mcp.ListToolsRequest{})
+		require.NoError(t, err)
+		tools := res.(*mcp.ListToolsResult).Tools
+		assert.Contains(t, tools[0].InputSchema.(*jsonschema.Schema).Properties, ParamName)
+		assert.NotContains(t, schema.Properties, ParamName, "the schema of the tool must not be changed")
+		assert.Same(t, own, tools[1].InputSchema, "a format of the tool must be kept")
+	})
+
+	callTool := func(arguments string) (*mcp.CallToolResult, error) {
+		res, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log", Arguments: json.RawMessage(arguments)}})
+		if err != nil {
+			return nil, err
+		}
+		return res.(*mcp.CallToolResult), nil
+	}
+
+	t.Run("compact", func(t *testing.T) {
+		res, err := callTool(`{"unit":"nginx.service","format":"compact"}`)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"unit":"nginx.service"}`, string(args))
+		assert.Contains(t, res.Content[0].(*mcp.TextContent).Text, "host=node1")
+		assert.Nil(t, res.StructuredContent)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		res, err := callTool(`{"unit":"nginx.service"}`)
+		require.NoError(t, err)
+		assert.Equal(t, logResult, res.Content[0].(*mcp.TextContent).Text)
+		assert.NotNil(t, res.StructuredContent)
+	})
+
+	t.Run("format of the tool", func(t *testing.T) {
+		_, err := callTool(`{"format":"markdown"}`)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"format":"markdown"}`, string(args))
+		_, err = callTool(`{"format":1}`)
+		assert.Error(t, err)
+	})
+}
+
+func TestOutputBudget(t *testing.T) {
+	defer SetOutputBudget(0)
+	assert.Equal(t, Full, DefaultFormat())
+	SetOutputBudget(10)
+	assert.Equal(t, Minimal, DefaultFormat())
+	assert.Equal(t, `msg="Started n…"`, Render([]string{`{"message":"Started nginx.service"}`}, Minimal)[0])
+
+	handler := Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: logResult}}}, nil
+	})
+	res, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log", Arguments: json.RawMessage(`{}`)}})
+	require.NoError(t, err)
+	assert.Contains(t, res.(*mcp.CallToolResult).Content[0].(*mcp.TextContent).Text, "n=2", "calls without a format are minimal")
+	res, err = handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log", Arguments: json.RawMessage(`{"format":"full"}`)}})
+	require.NoError(t, err)
+	assert.Equal(t, logResult, res.(*mcp.CallToolResult).Content[0].(*mcp.TextContent).Text)
+}
@@ -0,0 +1,100 @@
+// Package requestid gives every tool call an id, which is added to the log
+// lines of the call and returned with its result and errors, so that a bad
+// answer can be found in the log of the server.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// MetaKey is the key of the id in the _meta field of a tool result, and
+// LogKey the attribute of the log lines
+const (
+	MetaKey = "request_id"
+	LogKey  = "request_id"
+)
+
+type contextKey struct{}
+
+// New returns a random id
+func New() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns a context carrying the id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the id of the call or ""
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Handler adds the id of the context to the records logged with a context,
+// like slog.DebugContext
+type Handler struct {
+	slog.Handler
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if id := FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String(LogKey, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{h.Handler.WithGroup(name)}
+}
+
+// Middleware gives every tool call an id, adds it to the metadata of the
+// result and appends it to the errors
+func Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method != "tools/call" {
+			return next(ctx, method, req)
+		}
+		id := New()
+		ctx = NewContext(ctx, id)
+		if call, ok := req.(*mcp.CallToolRequest); ok && call.Params != nil {
+			slog.DebugContext(ctx, "tool call", "tool", call.Params.Name)
+		}
+		res, err := next(ctx, method, req)
+		if err != nil {
+			// the code of a protocol error is kept
+			return res, fmt.Errorf("%w (request id %s)", err, id)
+		}
+		if res == nil {
+			return res, err
+		}
+		if r, ok := res.(*mcp.CallToolResult); ok && r.IsError {
+			for _, c := range r.Content {
+				if text, ok := c.(*mcp.TextContent); ok {
+					text.Text += fmt.Sprintf(" (request id %s)", id)
+					break
+				}
+			}
+		}
+		meta := res.GetMeta()
+		if meta == nil {
+			meta = make(map[string]any)
+		}
+		meta[MetaKey] = id
+		res.SetMeta(meta)
+		return res, err
+	}
+}
@@ -0,0 +1,56 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(&Handler{slog.NewTextHandler(&out, nil)}).With("tool", "list_log")
+	logger.InfoContext(NewContext(context.Background(), "0123456789abcdef"), "called")
+	assert.Contains(t, out.String(), "tool=list_log request_id=0123456789abcdef")
+	out.Reset()
+	logger.Info("no call")
+	assert.NotContains(t, out.String(), "request_id")
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen []string
+	handler := Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		seen = append(seen, FromContext(ctx))
+		switch req.(*mcp.CallToolRequest).Params.Name {
+		case "fails":
+			return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "unit not found"}}}, nil
+		case "broken":
+			return nil, errors.New("invalid params")
+		}
+		return &mcp.CallToolResult{}, nil
+	})
+	call := func(name string) (*mcp.CallToolResult, error) {
+		res, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: name}})
+		r, _ := res.(*mcp.CallToolResult)
+		return r, err
+	}
+
+	res, err := call("works")
+	require.NoError(t, err)
+	assert.Equal(t, seen[0], res.Meta[MetaKey])
+	assert.Len(t, seen[0], 16)
+
+	res, err = call("fails")
+	require.NoError(t, err)
+	assert.Equal(t, "unit not found (request id "+seen[1]+")", res.Content[0].(*mcp.TextContent).Text)
+	assert.NotEqual(t, seen[0], seen[1], "every call has its own id")
+
+	_, err = call("broken")
+	require.Error(t, err)
+	assert.Equal(t, "invalid params (request id "+seen[2]+")", err.Error())
+}
@@ -0,0 +1,156 @@
+package resultcache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sessionid"
+)
+
+// at most this many results are kept, the oldest is dropped first
+var maxEntries = 256
+
+type entry struct {
+	result  *mcp.CallToolResult
+	expires time.Time
+}
+
+// Cache keeps the results of the read tools for a short time, so that a
+// client which repeats the same call answers at once. The results are kept
+// per session, so a call never gets a result another session was
+// authorized for. A nil Cache runs all calls.
+type Cache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tools   []string
+	flush   []string
+	entries map[string]*entry
+}
+
+// New returns a cache which keeps the results for ttl, nil if ttl isn't
+// positive
+func New(ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &Cache{ttl: ttl, entries: make(map[string]*entry)}
+}
+
+// SetTools sets the tools whose results are cached and the tools whose
+// calls drop all cached results, like the write tools
+func (c *Cache) SetTools(tools, flush []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tools = slices.Clone(tools)
+	c.flush = slices.Clone(flush)
+}
+
+// key returns the key of the call, the arguments are encoded again so that
+// the order of their fields doesn't matter
+func key(session string, params *mcp.CallToolParamsRaw) (string, bool) {
+	var args any
+	if len(params.Arguments) > 0 {
+		if err := json.Unmarshal(params.Arguments, &args); err != nil {
+			return "", false
+		}
+	}
+	data, err := json.Marshal([]any{session, params.Name, args})
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// copyResult returns a copy which the outer middlewares can change without
+// changing the cached result
+func copyResult(res *mcp.CallToolResult) *mcp.CallToolResult {
+	c := *res
+	c.Content = slices.Clone(res.Content)
+	c.Meta = maps.Clone(res.Meta)
+	return &c
+}
+
+// Middleware answers the calls of the cached tools from the cache and
+// drops it on the calls of the flushing tools
+func (c *Cache) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	if c == nil {
+		return next
+	}
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if method != "tools/call" || !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		c.mu.Lock()
+		cached, flush := slices.Contains(c.tools, call.Params.Name), slices.Contains(c.flush, call.Params.Name)
+		c.mu.Unlock()
+		if flush {
+			// the write changed what the cached results show
+			res, err := next(ctx, method, req)
+			c.Flush()
+			return res, err
+		}
+		if !cached {
+			return next(ctx, method, req)
+		}
+		k, ok := key(sessionid.FromRequest(req), call.Params)
+		if !ok {
+			return next(ctx, method, req)
+		}
+		now := time.Now()
+		c.mu.Lock()
+		e, ok := c.entries[k]
+		c.mu.Unlock()
+		if ok && now.Before(e.expires) {
+			slog.DebugContext(ctx, "tool result from cache", "tool", call.Params.Name)
+			return copyResult(e.result), nil
+		}
+		res, err := next(ctx, method, req)
+		result, ok := res.(*mcp.CallToolResult)
+		if err != nil || !ok || result == nil || result.IsError {
+			return res, err
+		}
+		c.store(k, copyResult(result), now.Add(c.ttl))
+		return res, err
+	}
+}
+
+// store keeps the result under the key and drops the expired results and
+// the oldest one above maxEntries
+func (c *Cache) store(k string, res *mcp.CallToolResult, expires time.Time) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var oldest string
+	for other, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, other)
+		} else if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+			oldest = other
+		}
+	}
+	if len(c.entries) >= maxEntries {
+		delete(c.entries, oldest)
+	}
+	c.entries[k] = &entry{result: res, expires: expires}
+}
+
+// Flush drops all cached results
+func (c *Cache) Flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
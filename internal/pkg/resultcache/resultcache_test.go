@@ -0,0 +1,79 @@
+package resultcache
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func callTool(name string, args string) *mcp.CallToolRequest {
+	return &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: name, Arguments: json.RawMessage(args)}}
+}
+
+func text(t *testing.T, res mcp.Result) string {
+	t.Helper()
+	return res.(*mcp.CallToolResult).Content[0].(*mcp.TextContent).Text
+}
+
+func TestMiddleware(t *testing.T) {
+	assert.Nil(t, New(0))
+	c := New(time.Hour)
+	c.SetTools([]string{"list_log"}, []string{"change_unit_state"})
+	calls := 0
+	handler := c.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		calls++
+		call := req.(*mcp.CallToolRequest)
+		if string(call.Params.Arguments) == `{"unit":"bad.service"}` {
+			return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "failed"}}}, nil
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: call.Params.Name}}}, nil
+	})
+	run := func(name, args string) mcp.Result {
+		t.Helper()
+		res, err := handler(context.Background(), "tools/call", callTool(name, args))
+		require.NoError(t, err)
+		return res
+	}
+
+	res := run("list_log", `{"unit":"sshd.service","count":10}`)
+	assert.Equal(t, "list_log", text(t, res))
+	// a change of the result by an outer middleware isn't cached
+	res.(*mcp.CallToolResult).Content[0] = &mcp.TextContent{Text: "rendered"}
+	assert.Equal(t, "list_log", text(t, run("list_log", `{"count":10,"unit":"sshd.service"}`)))
+	assert.Equal(t, 1, calls, "the same arguments in another order are answered from the cache")
+
+	run("list_log", `{"unit":"sshd.service","count":20}`)
+	assert.Equal(t, 2, calls)
+	run("get_job", `{}`)
+	run("get_job", `{}`)
+	assert.Equal(t, 4, calls, "other tools aren't cached")
+	run("list_log", `{"unit":"bad.service"}`)
+	run("list_log", `{"unit":"bad.service"}`)
+	assert.Equal(t, 6, calls, "errors aren't cached")
+
+	run("change_unit_state", `{}`)
+	assert.Equal(t, 7, calls)
+	run("list_log", `{"unit":"sshd.service","count":10}`)
+	assert.Equal(t, 8, calls, "a write drops the cache")
+}
+
+func TestExpiry(t *testing.T) {
+	c := New(time.Millisecond)
+	c.SetTools([]string{"list_log"}, nil)
+	calls := 0
+	handler := c.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		calls++
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "ok"}}}, nil
+	})
+	for range 2 {
+		_, err := handler(context.Background(), "tools/call", callTool("list_log", `{}`))
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Equal(t, 2, calls)
+}
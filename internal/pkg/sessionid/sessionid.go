@@ -0,0 +1,22 @@
+// Package sessionid returns the id of the MCP session of a request, which
+// keys the state the server keeps per session.
+package sessionid
+
+import (
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// FromRequest returns the id of the session of the request, an empty id
+// for stdio, requests without a session and tests
+func FromRequest(req mcp.Request) string {
+	if req == nil {
+		return ""
+	}
+	if call, ok := req.(*mcp.CallToolRequest); ok && call == nil {
+		return ""
+	}
+	if ss, ok := req.GetSession().(*mcp.ServerSession); ok && ss != nil {
+		return ss.ID()
+	}
+	return ""
+}
@@ -0,0 +1,26 @@
+package sessionid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromRequest(t *testing.T) {
+	assert.Empty(t, FromRequest(nil))
+	var call *mcp.CallToolRequest
+	assert.Empty(t, FromRequest(call))
+	assert.Empty(t, FromRequest(&mcp.CallToolRequest{}))
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(context.Background(), serverTransport, nil)
+	require.NoError(t, err)
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(context.Background(), clientTransport, nil)
+	require.NoError(t, err)
+	defer cs.Close()
+	assert.Equal(t, ss.ID(), FromRequest(&mcp.CallToolRequest{Session: ss}))
+}
@@ -0,0 +1,113 @@
+// Package state keeps the state which doesn't belong to a session across
+// restarts: the auth lockouts and the sequence number of the audit log.
+// The ACME account and certificates are kept in the acme subdirectory of
+// the same directory by the cache of autocert. Background jobs aren't
+// kept, they belong to the session which started them.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// DefaultDir is the state directory of the system instance
+const DefaultDir = "/var/lib/systemd-mcp"
+
+var (
+	mu  sync.Mutex
+	dir string
+)
+
+var validName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// SetDir sets the directory in which the state is kept, an empty directory
+// disables the persistence
+func SetDir(d string) {
+	mu.Lock()
+	defer mu.Unlock()
+	dir = d
+}
+
+func Dir() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return dir
+}
+
+func path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid state name %q", name)
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// Load reads the state saved under the name into v. v is left untouched if
+// nothing was saved yet or the persistence is disabled.
+func Load(name string, v any) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if dir == "" {
+		return nil
+	}
+	p, err := path(name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read state %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse state %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save replaces the state saved under the name with v. The file is written
+// atomically, so that a crash leaves either the old or the new state.
+func Save(name string, v any) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if dir == "" {
+		return nil
+	}
+	p, err := path(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state %s: %w", name, err)
+	}
+	// the state may contain client addresses, so it is only readable by
+	// the server
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save state %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save state %s: %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save state %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save state %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to save state %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState(t *testing.T) {
+	defer SetDir(Dir())
+	stateDir := filepath.Join(t.TempDir(), "state")
+	SetDir(stateDir)
+
+	type counter struct {
+		Seq  int      `json:"seq"`
+		Tags []string `json:"tags"`
+	}
+
+	t.Run("Nothing saved", func(t *testing.T) {
+		v := counter{Seq: 7}
+		require.NoError(t, Load("counter", &v))
+		assert.Equal(t, 7, v.Seq)
+	})
+
+	t.Run("Save and load", func(t *testing.T) {
+		require.NoError(t, Save("counter", counter{Seq: 42, Tags: []string{"a"}}))
+		var v counter
+		require.NoError(t, Load("counter", &v))
+		assert.Equal(t, counter{Seq: 42, Tags: []string{"a"}}, v)
+		info, err := os.Stat(stateDir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+		entries, err := os.ReadDir(stateDir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("Invalid name", func(t *testing.T) {
+		assert.Error(t, Save("../counter", counter{}))
+		assert.Error(t, Load("../counter", &counter{}))
+	})
+
+	t.Run("Corrupt state", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(stateDir, "broken.json"), []byte("{"), 0600))
+		assert.Error(t, Load("broken", &counter{}))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		SetDir("")
+		defer SetDir(stateDir)
+		require.NoError(t, Save("other", counter{Seq: 1}))
+		assert.NoFileExists(t, filepath.Join(stateDir, "other.json"))
+		v := counter{Seq: 3}
+		require.NoError(t, Load("counter", &v))
+		assert.Equal(t, 3, v.Seq)
+	})
+}
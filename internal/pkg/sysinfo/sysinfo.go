@@ -0,0 +1,371 @@
+package sysinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+)
+
+// can be changed for tests
+var procRoot = "/proc"
+
+func ValidSubsystems() []string {
+	return []string{"meminfo", "loadavg", "pressure", "stat", "net_dev", "interrupts"}
+}
+
+func defaultSubsystems() []string {
+	return []string{"meminfo", "loadavg", "pressure"}
+}
+
+type GetSystemInfoParams struct {
+	Subsystems []string `json:"subsystems,omitempty" jsonschema:"Parts to read: meminfo, loadavg, pressure, stat, net_dev, interrupts. Defaults to meminfo, loadavg and pressure."`
+}
+
+type LoadAvg struct {
+	Load1   float64 `json:"load1"`
+	Load5   float64 `json:"load5"`
+	Load15  float64 `json:"load15"`
+	Running int     `json:"running"`
+	Total   int     `json:"total"`
+	LastPID int     `json:"last_pid"`
+}
+
+type PressureLine struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total_usec"`
+}
+
+type Pressure struct {
+	Some *PressureLine `json:"some,omitempty"`
+	Full *PressureLine `json:"full,omitempty"`
+}
+
+type CPUTimes struct {
+	User      uint64 `json:"user"`
+	Nice      uint64 `json:"nice"`
+	System    uint64 `json:"system"`
+	Idle      uint64 `json:"idle"`
+	IOWait    uint64 `json:"iowait"`
+	IRQ       uint64 `json:"irq"`
+	SoftIRQ   uint64 `json:"softirq"`
+	Steal     uint64 `json:"steal"`
+	Guest     uint64 `json:"guest"`
+	GuestNice uint64 `json:"guest_nice"`
+}
+
+type Stat struct {
+	CPU             CPUTimes            `json:"cpu"`
+	CPUs            map[string]CPUTimes `json:"cpus"`
+	ContextSwitches uint64              `json:"context_switches"`
+	BootTime        uint64              `json:"boot_time"`
+	Processes       uint64              `json:"processes"`
+	ProcsRunning    uint64              `json:"procs_running"`
+	ProcsBlocked    uint64              `json:"procs_blocked"`
+	Interrupts      uint64              `json:"interrupts"`
+}
+
+type NetDev struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+type Interrupt struct {
+	IRQ         string   `json:"irq"`
+	Total       uint64   `json:"total"`
+	PerCPU      []uint64 `json:"per_cpu"`
+	Description string   `json:"description,omitempty"`
+}
+
+type SystemInfo struct {
+	MemInfo    map[string]uint64   `json:"meminfo_kb,omitempty"`
+	LoadAvg    *LoadAvg            `json:"loadavg,omitempty"`
+	Pressure   map[string]Pressure `json:"pressure,omitempty"`
+	Stat       *Stat               `json:"stat,omitempty"`
+	NetDev     map[string]NetDev   `json:"net_dev,omitempty"`
+	Interrupts []Interrupt         `json:"interrupts,omitempty"`
+	Errors     []string            `json:"errors,omitempty"`
+}
+
+func CreateGetSystemInfoSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetSystemInfoParams](nil)
+	var subsystems []any
+	for _, s := range ValidSubsystems() {
+		subsystems = append(subsystems, s)
+	}
+	inputSchema.Properties["subsystems"].Items.Enum = subsystems
+	inputSchema.Properties["subsystems"].Default = json.RawMessage(`["meminfo","loadavg","pressure"]`)
+	return inputSchema
+}
+
+func readLines(ctx context.Context, name string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, name))
+	if err != nil {
+		return nil, err
+	}
+	cost.AddBytes(ctx, len(data))
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n"), nil
+}
+
+func parseUints(fields []string) []uint64 {
+	values := make([]uint64, len(fields))
+	for i, f := range fields {
+		values[i], _ = strconv.ParseUint(f, 10, 64)
+	}
+	return values
+}
+
+// values of /proc/meminfo in kB, HugePages_* are counts
+func readMemInfo(ctx context.Context) (map[string]uint64, error) {
+	lines, err := readLines(ctx, "meminfo")
+	if err != nil {
+		return nil, err
+	}
+	info := make(map[string]uint64)
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		info[key], _ = strconv.ParseUint(fields[0], 10, 64)
+	}
+	return info, nil
+}
+
+func readLoadAvg(ctx context.Context) (*LoadAvg, error) {
+	lines, err := readLines(ctx, "loadavg")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(lines[0])
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("unexpected format of loadavg: %q", lines[0])
+	}
+	load := &LoadAvg{}
+	load.Load1, _ = strconv.ParseFloat(fields[0], 64)
+	load.Load5, _ = strconv.ParseFloat(fields[1], 64)
+	load.Load15, _ = strconv.ParseFloat(fields[2], 64)
+	running, total, _ := strings.Cut(fields[3], "/")
+	load.Running, _ = strconv.Atoi(running)
+	load.Total, _ = strconv.Atoi(total)
+	load.LastPID, _ = strconv.Atoi(fields[4])
+	return load, nil
+}
+
+// reads the pressure stall information of cpu, memory and io
+func readPressure(ctx context.Context) (map[string]Pressure, error) {
+	pressure := make(map[string]Pressure)
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		lines, err := readLines(ctx, filepath.Join("pressure", resource))
+		if err != nil {
+			return nil, err
+		}
+		var p Pressure
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			pl := &PressureLine{}
+			for _, field := range fields[1:] {
+				key, value, _ := strings.Cut(field, "=")
+				switch key {
+				case "avg10":
+					pl.Avg10, _ = strconv.ParseFloat(value, 64)
+				case "avg60":
+					pl.Avg60, _ = strconv.ParseFloat(value, 64)
+				case "avg300":
+					pl.Avg300, _ = strconv.ParseFloat(value, 64)
+				case "total":
+					pl.Total, _ = strconv.ParseUint(value, 10, 64)
+				}
+			}
+			switch fields[0] {
+			case "some":
+				p.Some = pl
+			case "full":
+				p.Full = pl
+			}
+		}
+		pressure[resource] = p
+	}
+	return pressure, nil
+}
+
+func cpuTimes(fields []string) CPUTimes {
+	v := parseUints(fields)
+	for len(v) < 10 {
+		v = append(v, 0)
+	}
+	return CPUTimes{User: v[0], Nice: v[1], System: v[2], Idle: v[3], IOWait: v[4],
+		IRQ: v[5], SoftIRQ: v[6], Steal: v[7], Guest: v[8], GuestNice: v[9]}
+}
+
+// reads /proc/stat, the cpu times are in USER_HZ
+func readStat(ctx context.Context) (*Stat, error) {
+	lines, err := readLines(ctx, "stat")
+	if err != nil {
+		return nil, err
+	}
+	stat := &Stat{CPUs: make(map[string]CPUTimes)}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch {
+		case fields[0] == "cpu":
+			stat.CPU = cpuTimes(fields[1:])
+		case strings.HasPrefix(fields[0], "cpu"):
+			stat.CPUs[fields[0]] = cpuTimes(fields[1:])
+		case fields[0] == "intr":
+			stat.Interrupts = value
+		case fields[0] == "ctxt":
+			stat.ContextSwitches = value
+		case fields[0] == "btime":
+			stat.BootTime = value
+		case fields[0] == "processes":
+			stat.Processes = value
+		case fields[0] == "procs_running":
+			stat.ProcsRunning = value
+		case fields[0] == "procs_blocked":
+			stat.ProcsBlocked = value
+		}
+	}
+	return stat, nil
+}
+
+func readNetDev(ctx context.Context) (map[string]NetDev, error) {
+	lines, err := readLines(ctx, "net/dev")
+	if err != nil {
+		return nil, err
+	}
+	devs := make(map[string]NetDev)
+	for _, line := range lines {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		v := parseUints(strings.Fields(counters))
+		if len(v) < 12 {
+			continue
+		}
+		devs[strings.TrimSpace(name)] = NetDev{
+			RxBytes: v[0], RxPackets: v[1], RxErrors: v[2], RxDropped: v[3],
+			TxBytes: v[8], TxPackets: v[9], TxErrors: v[10], TxDropped: v[11],
+		}
+	}
+	return devs, nil
+}
+
+func readInterrupts(ctx context.Context) ([]Interrupt, error) {
+	lines, err := readLines(ctx, "interrupts")
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty interrupts")
+	}
+	ncpu := len(strings.Fields(lines[0]))
+	interrupts := []Interrupt{}
+	for _, line := range lines[1:] {
+		irq, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		n := min(ncpu, len(fields))
+		// ERR and MIS have a single counter
+		for i := 0; i < n; i++ {
+			if _, err := strconv.ParseUint(fields[i], 10, 64); err != nil {
+				n = i
+				break
+			}
+		}
+		intr := Interrupt{
+			IRQ:         strings.TrimSpace(irq),
+			PerCPU:      parseUints(fields[:n]),
+			Description: strings.Join(fields[n:], " "),
+		}
+		for _, count := range intr.PerCPU {
+			intr.Total += count
+		}
+		interrupts = append(interrupts, intr)
+	}
+	return interrupts, nil
+}
+
+// reads and parses the requested proc files
+func GetSystemInfo(ctx context.Context, req *mcp.CallToolRequest, params *GetSystemInfoParams, authKeeper auth.AuthKeeper) (*mcp.CallToolResult, any, error) {
+	if allowed, err := authKeeper.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	subsystems := params.Subsystems
+	if len(subsystems) == 0 {
+		subsystems = defaultSubsystems()
+	}
+	for _, s := range subsystems {
+		if !slices.Contains(ValidSubsystems(), s) {
+			return nil, nil, fmt.Errorf("invalid subsystem %q, valid are: %s", s, strings.Join(ValidSubsystems(), ", "))
+		}
+	}
+
+	info := &SystemInfo{}
+	var err error
+	for _, s := range subsystems {
+		switch s {
+		case "meminfo":
+			info.MemInfo, err = readMemInfo(ctx)
+		case "loadavg":
+			info.LoadAvg, err = readLoadAvg(ctx)
+		case "pressure":
+			info.Pressure, err = readPressure(ctx)
+		case "stat":
+			info.Stat, err = readStat(ctx)
+		case "net_dev":
+			info.NetDev, err = readNetDev(ctx)
+		case "interrupts":
+			info.Interrupts, err = readInterrupts(ctx)
+		}
+		if err != nil {
+			info.Errors = append(info.Errors, fmt.Sprintf("%s: %v", s, err))
+		}
+	}
+
+	jsonBytes, err := json.Marshal(info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
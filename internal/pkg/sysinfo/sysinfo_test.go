@@ -0,0 +1,90 @@
+package sysinfo
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeProc(t *testing.T) string {
+	root := t.TempDir()
+	files := map[string]string{
+		"meminfo":         "MemTotal:        8048096 kB\nMemFree:          123456 kB\nHugePages_Total:       0\n",
+		"loadavg":         "0.23 0.25 0.15 2/72 12738\n",
+		"pressure/cpu":    "some avg10=2.60 avg60=2.43 avg300=2.09 total=30768885\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"pressure/memory": "some avg10=0.00 avg60=0.00 avg300=0.00 total=12\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=5\n",
+		"pressure/io":     "some avg10=1.00 avg60=0.50 avg300=0.10 total=100\nfull avg10=0.50 avg60=0.20 avg300=0.05 total=50\n",
+		"stat": "cpu  20678 0 3546 184218 227 0 3 101 0 0\ncpu0 10000 0 2000 90000 100 0 1 50 0 0\ncpu1 10678 0 1546 94218 127 0 2 51 0 0\n" +
+			"intr 321402 0 0\nctxt 774134\nbtime 1792108550\nprocesses 12740\nprocs_running 2\nprocs_blocked 1\n",
+		"net/dev": "Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo: 44692661    5086    0    0    0     0          0         0 44692661    5086    0    0    0     0       0          0\n" +
+			"  eth0: 1000 10 1 2 0 0 0 0 2000 20 3 4 0 0 0 0\n",
+		"interrupts": "           CPU0       CPU1\n" +
+			" 24:          1          2  IO-APIC   5-edge      ACPI:Ged\n" +
+			"NMI:          0          0   Non-maskable interrupts\n" +
+			"ERR:          0\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestGetSystemInfo(t *testing.T) {
+	procRoot = fakeProc(t)
+	defer func() { procRoot = "/proc" }()
+	testAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+
+	getInfo := func(t *testing.T, subsystems ...string) SystemInfo {
+		res, _, err := GetSystemInfo(context.Background(), nil, &GetSystemInfoParams{Subsystems: subsystems}, testAuth)
+		require.NoError(t, err)
+		var info SystemInfo
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &info))
+		return info
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		info := getInfo(t)
+		assert.Equal(t, uint64(8048096), info.MemInfo["MemTotal"])
+		assert.Equal(t, &LoadAvg{Load1: 0.23, Load5: 0.25, Load15: 0.15, Running: 2, Total: 72, LastPID: 12738}, info.LoadAvg)
+		assert.Equal(t, 2.60, info.Pressure["cpu"].Some.Avg10)
+		assert.Equal(t, uint64(50), info.Pressure["io"].Full.Total)
+		assert.Nil(t, info.Stat)
+		assert.Empty(t, info.Errors)
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		info := getInfo(t, "stat")
+		require.NotNil(t, info.Stat)
+		assert.Equal(t, uint64(184218), info.Stat.CPU.Idle)
+		assert.Len(t, info.Stat.CPUs, 2)
+		assert.Equal(t, uint64(1792108550), info.Stat.BootTime)
+		assert.Equal(t, uint64(1), info.Stat.ProcsBlocked)
+		assert.Nil(t, info.MemInfo)
+	})
+
+	t.Run("Network and interrupts", func(t *testing.T) {
+		info := getInfo(t, "net_dev", "interrupts")
+		assert.Equal(t, NetDev{RxBytes: 1000, RxPackets: 10, RxErrors: 1, RxDropped: 2, TxBytes: 2000, TxPackets: 20, TxErrors: 3, TxDropped: 4}, info.NetDev["eth0"])
+		require.Len(t, info.Interrupts, 3)
+		assert.Equal(t, Interrupt{IRQ: "24", Total: 3, PerCPU: []uint64{1, 2}, Description: "IO-APIC 5-edge ACPI:Ged"}, info.Interrupts[0])
+		assert.Equal(t, "Non-maskable interrupts", info.Interrupts[1].Description)
+		assert.Equal(t, []uint64{0}, info.Interrupts[2].PerCPU)
+	})
+
+	t.Run("Invalid subsystem", func(t *testing.T) {
+		_, _, err := GetSystemInfo(context.Background(), nil, &GetSystemInfoParams{Subsystems: []string{"slabinfo"}}, testAuth)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,50 @@
+package systemd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// godbus reads the address of the system bus from this variable
+const systemBusEnv = "DBUS_SYSTEM_BUS_ADDRESS"
+
+// SetSystemBus connects all system bus connections of the process, also the
+// ones of polkit and logind, to the socket at path instead of the default
+// one, e.g. to the bus of the host mounted into a container. A directory is
+// taken as the directory of system_bus_socket.
+func SetSystemBus(path string) error {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		path = filepath.Join(path, "system_bus_socket")
+		info, err = os.Stat(path)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid system bus socket: %w", err)
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("system bus socket %s isn't a socket", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return os.Setenv(systemBusEnv, "unix:path="+escapeBusValue(abs))
+}
+
+// escapeBusValue escapes a value of a D-Bus address, all bytes but the
+// optionally escaped ones are written as %XX
+func escapeBusValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-_/.\\*", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02x", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,30 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSystemBus(t *testing.T) {
+	t.Setenv(systemBusEnv, "")
+	dir := filepath.Join(t.TempDir(), "host run")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	socket := filepath.Join(dir, "system_bus_socket")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer l.Close()
+
+	require.NoError(t, SetSystemBus(dir))
+	assert.Equal(t, "unix:path="+escapeBusValue(socket), os.Getenv(systemBusEnv), "a directory is the directory of the socket")
+	assert.Contains(t, os.Getenv(systemBusEnv), "host%20run")
+	require.NoError(t, SetSystemBus(socket))
+
+	assert.Error(t, SetSystemBus(filepath.Join(dir, "missing")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), nil, 0o644))
+	assert.Error(t, SetSystemBus(filepath.Join(dir, "file")))
+}
@@ -0,0 +1,133 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// confirmClasses are the destructive actions the user can be asked to
+// confirm, by class
+var confirmClasses = map[string][]string{
+	"stop":    {"stop", "stop_kill"},
+	"disable": {"disable"},
+}
+
+// the classes which need a confirmation, none by default
+var confirmActions atomic.Pointer[[]string]
+
+func ValidConfirmClasses() []string {
+	return []string{"stop", "disable"}
+}
+
+// SetConfirmActions sets the classes of actions which need a confirmation
+// of the user
+func SetConfirmActions(classes []string) error {
+	for _, class := range classes {
+		if _, ok := confirmClasses[class]; !ok {
+			return fmt.Errorf("unknown class of actions to confirm %q, valid are %s", class, strings.Join(ValidConfirmClasses(), ", "))
+		}
+	}
+	confirmActions.Store(&classes)
+	return nil
+}
+
+func needsConfirmation(action string) bool {
+	classes := confirmActions.Load()
+	if classes == nil {
+		return false
+	}
+	return slices.ContainsFunc(*classes, func(class string) bool {
+		return slices.Contains(confirmClasses[class], action)
+	})
+}
+
+// stringsProperty returns a list property of a unit
+func stringsProperty(props map[string]any, name string) []string {
+	list, _ := props[name].([]string)
+	return list
+}
+
+// impact summarizes what the action affects besides the unit: the units
+// which are stopped with it and the connections of its sockets
+func (conn *Connection) impact(ctx context.Context, action, name string) string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "Confirm to %s %s", strings.ReplaceAll(action, "_", " "), name)
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		slog.DebugContext(ctx, "couldn't get the properties for the confirmation", "unit", name, "error", err)
+		return summary.String() + "."
+	}
+	if desc, _ := props["Description"].(string); desc != "" {
+		fmt.Fprintf(&summary, " (%s)", desc)
+	}
+	if state, _ := props["ActiveState"].(string); state != "" {
+		fmt.Fprintf(&summary, ", which is %s", state)
+	}
+	summary.WriteString(".")
+	switch action {
+	case "disable":
+		if wanted := append(stringsProperty(props, "WantedBy"), stringsProperty(props, "RequiredBy")...); len(wanted) > 0 {
+			fmt.Fprintf(&summary, "\nIt won't be started by: %s.", strings.Join(wanted, ", "))
+		}
+	default:
+		if dependents := append(stringsProperty(props, "RequiredBy"), stringsProperty(props, "BoundBy")...); len(dependents) > 0 {
+			fmt.Fprintf(&summary, "\nUnits which are stopped too: %s.", strings.Join(dependents, ", "))
+		}
+		sockets := slices.DeleteFunc(slices.Clone(stringsProperty(props, "TriggeredBy")), func(unit string) bool {
+			return !strings.HasSuffix(unit, ".socket")
+		})
+		if strings.HasSuffix(name, ".socket") {
+			sockets = append(sockets, name)
+		}
+		for _, socket := range sockets {
+			socketProps, err := conn.dbus.GetUnitTypePropertiesContext(ctx, socket, "Socket")
+			if err != nil {
+				continue
+			}
+			if n, ok := socketProps["NConnections"].(uint32); ok && n > 0 {
+				fmt.Fprintf(&summary, "\n%s has %d active connections.", socket, n)
+			}
+		}
+	}
+	return summary.String()
+}
+
+// confirm asks the user over MCP elicitation to confirm a destructive
+// action, if its class needs a confirmation. Clients without elicitation
+// can't call these actions.
+func (conn *Connection) confirm(ctx context.Context, req *mcp.CallToolRequest, action, name string) error {
+	if !needsConfirmation(action) {
+		return nil
+	}
+	if req == nil || req.Session == nil {
+		return fmt.Errorf("%s needs the confirmation of the user, but there is no session to ask", action)
+	}
+	if params := req.Session.InitializeParams(); params == nil || params.Capabilities == nil || params.Capabilities.Elicitation == nil {
+		return fmt.Errorf("%s needs the confirmation of the user, but the client doesn't support elicitation", action)
+	}
+	res, err := req.Session.Elicit(ctx, &mcp.ElicitParams{
+		Message: conn.impact(ctx, action, name),
+		RequestedSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"confirm": {Type: "boolean", Description: "Perform the action"},
+			},
+			Required: []string{"confirm"},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't ask the user for confirmation: %w", err)
+	}
+	if confirmed, _ := res.Content["confirm"].(bool); res.Action != "accept" || !confirmed {
+		slog.WarnContext(ctx, "action wasn't confirmed by the user", "audit", "not_confirmed", "action", action, "unit", name, "response", res.Action)
+		return fmt.Errorf("%s of %s wasn't confirmed by the user", action, name)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package systemd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetConfirmActions(t *testing.T) {
+	defer SetConfirmActions(nil)
+	assert.Error(t, SetConfirmActions([]string{"stop", "explode"}))
+	assert.NoError(t, SetConfirmActions([]string{"stop"}))
+	assert.True(t, needsConfirmation("stop_kill"))
+	assert.False(t, needsConfirmation("disable"))
+	assert.False(t, needsConfirmation("start"))
+}
+
+func TestConfirmStop(t *testing.T) {
+	defer SetConfirmActions(nil)
+	require.NoError(t, SetConfirmActions([]string{"stop"}))
+
+	stopped := 0
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			stopUnit: func(name string, mode string) (int, error) {
+				stopped++
+				return 1, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				return map[string]interface{}{
+					"Description": "Web server",
+					"ActiveState": "active",
+					"RequiredBy":  []string{"app.service"},
+					"TriggeredBy": []string{"web.socket"},
+				}, nil
+			},
+			getTypeProperties: func(unitName string, unitType string) (map[string]interface{}, error) {
+				return map[string]interface{}{"NConnections": uint32(3)}, nil
+			},
+		},
+		auth:     auth,
+		rchannel: make(chan string, 10),
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "change_unit_state"}, conn.ChangeUnitState)
+	call := func(t *testing.T, opts *mcp.ClientOptions) (*mcp.CallToolResult, error) {
+		serverTransport, clientTransport := mcp.NewInMemoryTransports()
+		_, err := server.Connect(context.Background(), serverTransport, nil)
+		require.NoError(t, err)
+		client := mcp.NewClient(&mcp.Implementation{Name: "client"}, opts)
+		session, err := client.Connect(context.Background(), clientTransport, nil)
+		require.NoError(t, err)
+		defer session.Close()
+		conn.rchannel <- "done"
+		return session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "change_unit_state",
+			Arguments: map[string]any{"name": "web.service", "action": "stop"},
+		})
+	}
+
+	var message string
+	answer := &mcp.ElicitResult{Action: "decline"}
+	opts := &mcp.ClientOptions{
+		ElicitationHandler: func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+			message = req.Params.Message
+			return answer, nil
+		},
+	}
+	res, err := call(t, opts)
+	require.NoError(t, err)
+	assert.True(t, res.IsError)
+	assert.Zero(t, stopped)
+	assert.True(t, strings.HasPrefix(message, "Confirm to stop web.service (Web server), which is active."), message)
+	assert.Contains(t, message, "Units which are stopped too: app.service.")
+	assert.Contains(t, message, "web.socket has 3 active connections.")
+
+	answer = &mcp.ElicitResult{Action: "accept", Content: map[string]any{"confirm": true}}
+	res, err = call(t, opts)
+	require.NoError(t, err)
+	assert.False(t, res.IsError)
+	assert.Equal(t, 1, stopped)
+
+	// clients without elicitation can't stop units
+	res, err = call(t, nil)
+	require.NoError(t, err)
+	assert.True(t, res.IsError)
+	assert.Equal(t, 1, stopped)
+}
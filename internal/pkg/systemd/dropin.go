@@ -0,0 +1,359 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/file"
+)
+
+// directories with the configuration of the systemd daemons, the first one
+// has the highest priority and gets the drop-ins written by the server
+var configDirs = []string{"/etc/systemd", "/run/systemd", "/usr/local/lib/systemd", "/usr/lib/systemd"}
+
+// how long change_config_dropin waits for the restart of a daemon
+var dropinJobTimeout = 30 * time.Second
+
+// daemonConfig describes the configuration of a daemon and how it is
+// applied after a change
+type daemonConfig struct {
+	file    string
+	section string
+	unit    string
+	// reload_or_restart, restart or daemon_reload
+	apply string
+}
+
+var daemonConfigs = map[string]daemonConfig{
+	"journald": {file: "journald.conf", section: "Journal", unit: "systemd-journald.service", apply: "restart"},
+	"logind":   {file: "logind.conf", section: "Login", unit: "systemd-logind.service", apply: "reload_or_restart"},
+	"system":   {file: "system.conf", section: "Manager", apply: "daemon_reload"},
+	"oomd":     {file: "oomd.conf", section: "OOM", unit: "systemd-oomd.service", apply: "restart"},
+}
+
+func ValidConfigDaemons() []string {
+	daemons := make([]string, 0, len(daemonConfigs))
+	for name := range daemonConfigs {
+		daemons = append(daemons, name)
+	}
+	sort.Strings(daemons)
+	return daemons
+}
+
+func ValidDropinActions() []string {
+	return []string{"create", "remove"}
+}
+
+type ConfigSetting struct {
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Source  string `json:"source"`
+	Line    int    `json:"line"`
+	// earlier assignments which are overridden, as path:line
+	Overrides []string `json:"overrides,omitempty"`
+}
+
+type DaemonConfigResult struct {
+	Daemon   string          `json:"daemon"`
+	Unit     string          `json:"unit,omitempty"`
+	Files    []string        `json:"files"`
+	Settings []ConfigSetting `json:"settings"`
+}
+
+type ListConfigSettingsParams struct {
+	Daemon string `json:"daemon" jsonschema:"Daemon whose configuration is shown"`
+}
+
+func CreateListConfigSettingsSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ListConfigSettingsParams](nil)
+	var daemons []any
+	for _, d := range ValidConfigDaemons() {
+		daemons = append(daemons, d)
+	}
+	inputSchema.Properties["daemon"].Enum = daemons
+	return inputSchema
+}
+
+// configFiles returns the main configuration file and the drop-ins in the
+// order the daemon reads them. A drop-in shadows drop-ins with the same name
+// in directories of lower priority, a drop-in linked to /dev/null or empty
+// disables them.
+func configFiles(cfg daemonConfig) []string {
+	var files []string
+	for _, dir := range configDirs {
+		path := filepath.Join(dir, cfg.file)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+			break
+		}
+	}
+	dropins := map[string]string{}
+	for i := len(configDirs) - 1; i >= 0; i-- {
+		matches, _ := filepath.Glob(filepath.Join(configDirs[i], cfg.file+".d", "*.conf"))
+		for _, path := range matches {
+			dropins[filepath.Base(path)] = path
+		}
+	}
+	names := make([]string, 0, len(dropins))
+	for name := range dropins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if info, err := os.Stat(dropins[name]); err != nil || info.Size() == 0 {
+			continue
+		}
+		files = append(files, dropins[name])
+	}
+	return files
+}
+
+// ConfigFiles returns the configuration files of a daemon in the order the
+// daemon reads them
+func ConfigFiles(daemon string) ([]string, error) {
+	cfg, ok := daemonConfigs[daemon]
+	if !ok {
+		return nil, fmt.Errorf("invalid daemon: %s", daemon)
+	}
+	return configFiles(cfg), nil
+}
+
+// effectiveConfig parses the files of a daemon, a later assignment overrides
+// the earlier ones
+func effectiveConfig(ctx context.Context, daemon string, cfg daemonConfig) (*DaemonConfigResult, error) {
+	result := &DaemonConfigResult{
+		Daemon:   daemon,
+		Unit:     cfg.unit,
+		Files:    configFiles(cfg),
+		Settings: []ConfigSetting{},
+	}
+	settings := map[string]*ConfigSetting{}
+	var order []string
+	for _, path := range result.Files {
+		parsed, err := file.ParseConfigFile(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for _, section := range parsed.Sections {
+			keys := make([]string, 0, len(section.Keys))
+			for key := range section.Keys {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				entry := section.Keys[key]
+				id := section.Name + "/" + key
+				line := entry.Lines[len(entry.Lines)-1]
+				setting, ok := settings[id]
+				if !ok {
+					setting = &ConfigSetting{Section: section.Name, Key: key}
+					settings[id] = setting
+					order = append(order, id)
+				} else {
+					setting.Overrides = append(setting.Overrides, fmt.Sprintf("%s:%d", setting.Source, setting.Line))
+				}
+				setting.Value = entry.Value
+				setting.Source = path
+				setting.Line = line
+			}
+		}
+	}
+	for _, id := range order {
+		result.Settings = append(result.Settings, *settings[id])
+	}
+	return result, nil
+}
+
+// ListConfigSettings shows the effective settings of a daemon configuration
+// together with the file which sets them
+func (conn *Connection) ListConfigSettings(ctx context.Context, req *mcp.CallToolRequest, params *ListConfigSettingsParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	cfg, ok := daemonConfigs[params.Daemon]
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid daemon: %s", params.Daemon)
+	}
+	result, err := effectiveConfig(ctx, params.Daemon, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return jsonResult(result)
+}
+
+type ChangeConfigDropinParams struct {
+	Daemon   string            `json:"daemon" jsonschema:"Daemon whose configuration is changed"`
+	Action   string            `json:"action" jsonschema:"create writes the drop-in, replacing an existing one with the same name. remove deletes it."`
+	Name     string            `json:"name" jsonschema:"File name of the drop-in, e.g. 50-ratelimit.conf. Drop-ins are read in the order of their names."`
+	Settings map[string]string `json:"settings,omitempty" jsonschema:"Settings of the drop-in for create, e.g. {\"RateLimitBurst\": \"20000\"}. They are put in the section of the daemon, e.g. [Journal]."`
+	NoApply  bool              `json:"no_apply,omitempty" jsonschema:"Don't reload or restart the daemon after the change. Defaults to false."`
+}
+
+type ChangeConfigDropinResult struct {
+	Path    string              `json:"path"`
+	Action  string              `json:"action"`
+	Content string              `json:"content,omitempty"`
+	Apply   string              `json:"apply,omitempty"`
+	Result  string              `json:"result,omitempty"`
+	Config  *DaemonConfigResult `json:"config"`
+}
+
+func CreateChangeConfigDropinSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ChangeConfigDropinParams](nil)
+	var daemons []any
+	for _, d := range ValidConfigDaemons() {
+		daemons = append(daemons, d)
+	}
+	inputSchema.Properties["daemon"].Enum = daemons
+	var actions []any
+	for _, a := range ValidDropinActions() {
+		actions = append(actions, a)
+	}
+	inputSchema.Properties["action"].Enum = actions
+	inputSchema.Properties["no_apply"].Default = json.RawMessage(`false`)
+	return inputSchema
+}
+
+var (
+	dropinName = regexp.MustCompile(`^[A-Za-z0-9_@.-]+\.conf$`)
+	settingKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+)
+
+// dropinContent renders the settings as drop-in, the keys are sorted so
+// that the content doesn't change between calls
+func dropinContent(section string, settings map[string]string) (string, error) {
+	if len(settings) == 0 {
+		return "", fmt.Errorf("no settings given")
+	}
+	keys := make([]string, 0, len(settings))
+	for key, value := range settings {
+		if !settingKey.MatchString(key) {
+			return "", fmt.Errorf("invalid setting name: %q", key)
+		}
+		if strings.ContainsAny(value, "\n\r") || strings.HasSuffix(value, "\\") {
+			return "", fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString("# created by systemd-mcp\n")
+	fmt.Fprintf(&sb, "[%s]\n", section)
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "%s=%s\n", key, settings[key])
+	}
+	return sb.String(), nil
+}
+
+// applyConfig reloads or restarts the daemon so that it reads its
+// configuration again and returns the outcome
+func (conn *Connection) applyConfig(ctx context.Context, cfg daemonConfig) (string, error) {
+	if cfg.apply == "daemon_reload" {
+		if err := conn.dbus.ReloadContext(ctx); err != nil {
+			return "", fmt.Errorf("failed to reload the system manager: %w", err)
+		}
+		// the reload may change any unit
+		conn.props.clear()
+		return "done", nil
+	}
+	ch := make(chan string, 1)
+	var err error
+	if cfg.apply == "restart" {
+		_, err = conn.dbus.RestartUnitContext(ctx, cfg.unit, "replace", ch)
+	} else {
+		_, err = conn.dbus.ReloadOrRestartUnitContext(ctx, cfg.unit, "replace", ch)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to %s %s: %w", cfg.apply, cfg.unit, err)
+	}
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-time.After(dropinJobTimeout):
+		return "in_progress", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// ChangeConfigDropin creates or removes a drop-in of a daemon configuration
+// in /etc and applies it
+func (conn *Connection) ChangeConfigDropin(ctx context.Context, req *mcp.CallToolRequest, params *ChangeConfigDropinParams) (*mcp.CallToolResult, any, error) {
+	cfg, ok := daemonConfigs[params.Daemon]
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid daemon: %s", params.Daemon)
+	}
+	if !slices.Contains(ValidDropinActions(), params.Action) {
+		return nil, nil, fmt.Errorf("invalid action: %s", params.Action)
+	}
+	if !dropinName.MatchString(params.Name) {
+		return nil, nil, fmt.Errorf("invalid drop-in name %q, it must end with .conf and can't contain a path", params.Name)
+	}
+	if cfg.unit != "" {
+		if err := CheckUnit(ctx, cfg.unit); err != nil {
+			return nil, nil, err
+		}
+	}
+	result := &ChangeConfigDropinResult{
+		Path:   filepath.Join(configDirs[0], cfg.file+".d", params.Name),
+		Action: params.Action,
+	}
+	if params.Action == "create" {
+		content, err := dropinContent(cfg.section, params.Settings)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Content = content
+	}
+	permission := dbus.ActionManageUnits
+	if cfg.apply == "daemon_reload" {
+		permission = dbus.ActionReloadDaemon
+	}
+	allowed, err := conn.auth.IsWriteAuthorized(dbus.WithDetails(ctx, permission, map[string]string{"file": result.Path, "operation": params.Action}))
+	if !allowed || err != nil {
+		slog.DebugContext(ctx, "ChangeConfigDropin wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %s", err)
+	}
+	defer conn.auth.Deauthorize()
+
+	switch params.Action {
+	case "create":
+		if err := os.MkdirAll(filepath.Dir(result.Path), 0755); err != nil {
+			return nil, nil, fmt.Errorf("failed to create drop-in directory: %w", err)
+		}
+		if err := os.WriteFile(result.Path, []byte(result.Content), 0644); err != nil {
+			return nil, nil, fmt.Errorf("failed to write drop-in: %w", err)
+		}
+	case "remove":
+		if err := os.Remove(result.Path); err != nil {
+			return nil, nil, fmt.Errorf("failed to remove drop-in: %w", err)
+		}
+	}
+	slog.WarnContext(ctx, "config drop-in changed", "audit", "config_dropin", "action", params.Action, "path", result.Path)
+
+	if !params.NoApply {
+		result.Apply = cfg.apply
+		if result.Result, err = conn.applyConfig(ctx, cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	if result.Config, err = effectiveConfig(ctx, params.Daemon, cfg); err != nil {
+		return nil, nil, err
+	}
+	return jsonResult(result)
+}
@@ -0,0 +1,135 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigDropins(t *testing.T) {
+	oldDirs, oldTimeout := configDirs, dropinJobTimeout
+	defer func() { configDirs, dropinJobTimeout = oldDirs, oldTimeout }()
+	etc, usr := t.TempDir(), t.TempDir()
+	configDirs = []string{etc, usr}
+	dropinJobTimeout = 10 * time.Millisecond
+
+	write := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write(filepath.Join(usr, "journald.conf"), "[Journal]\n#Storage=auto\nRateLimitBurst=10000\nRateLimitIntervalSec=30s\n")
+	write(filepath.Join(usr, "journald.conf.d", "10-vendor.conf"), "[Journal]\nStorage=persistent\n")
+	write(filepath.Join(usr, "journald.conf.d", "20-shadowed.conf"), "[Journal]\nStorage=volatile\n")
+	write(filepath.Join(etc, "journald.conf.d", "20-shadowed.conf"), "")
+
+	var restarted []string
+	reloaded := 0
+	mock := &mockDbusConnection{
+		restartUnit: func(name string, mode string) (int, error) {
+			restarted = append(restarted, name)
+			return 1, nil
+		},
+		reload: func() error {
+			reloaded++
+			return nil
+		},
+	}
+	testAuth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{dbus: mock, auth: testAuth}
+
+	setting := func(t *testing.T, cfg *DaemonConfigResult, key string) ConfigSetting {
+		for _, s := range cfg.Settings {
+			if s.Key == key {
+				return s
+			}
+		}
+		t.Fatalf("setting %s not found", key)
+		return ConfigSetting{}
+	}
+
+	t.Run("List settings", func(t *testing.T) {
+		res, _, err := conn.ListConfigSettings(context.Background(), nil, &ListConfigSettingsParams{Daemon: "journald"})
+		require.NoError(t, err)
+		var cfg DaemonConfigResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &cfg))
+		assert.Equal(t, []string{filepath.Join(usr, "journald.conf"), filepath.Join(usr, "journald.conf.d", "10-vendor.conf")}, cfg.Files)
+		storage := setting(t, &cfg, "Storage")
+		assert.Equal(t, "persistent", storage.Value)
+		assert.Equal(t, filepath.Join(usr, "journald.conf.d", "10-vendor.conf"), storage.Source)
+		assert.Equal(t, 2, storage.Line)
+		assert.Equal(t, "10000", setting(t, &cfg, "RateLimitBurst").Value)
+	})
+
+	t.Run("Create drop-in", func(t *testing.T) {
+		res, _, err := conn.ChangeConfigDropin(context.Background(), nil, &ChangeConfigDropinParams{
+			Daemon:   "journald",
+			Action:   "create",
+			Name:     "50-ratelimit.conf",
+			Settings: map[string]string{"RateLimitBurst": "20000"},
+		})
+		require.NoError(t, err)
+		var result ChangeConfigDropinResult
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &result))
+		path := filepath.Join(etc, "journald.conf.d", "50-ratelimit.conf")
+		assert.Equal(t, path, result.Path)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "# created by systemd-mcp\n[Journal]\nRateLimitBurst=20000\n", string(content))
+		assert.Equal(t, []string{"systemd-journald.service"}, restarted)
+		assert.Equal(t, "restart", result.Apply)
+		assert.Equal(t, "in_progress", result.Result)
+		burst := setting(t, result.Config, "RateLimitBurst")
+		assert.Equal(t, "20000", burst.Value)
+		assert.Equal(t, path, burst.Source)
+		assert.Equal(t, []string{filepath.Join(usr, "journald.conf") + ":3"}, burst.Overrides)
+	})
+
+	t.Run("Remove drop-in", func(t *testing.T) {
+		_, _, err := conn.ChangeConfigDropin(context.Background(), nil, &ChangeConfigDropinParams{Daemon: "journald", Action: "remove", Name: "50-ratelimit.conf", NoApply: true})
+		require.NoError(t, err)
+		assert.NoFileExists(t, filepath.Join(etc, "journald.conf.d", "50-ratelimit.conf"))
+		assert.Len(t, restarted, 1)
+	})
+
+	t.Run("System manager is reloaded", func(t *testing.T) {
+		_, _, err := conn.ChangeConfigDropin(context.Background(), nil, &ChangeConfigDropinParams{
+			Daemon:   "system",
+			Action:   "create",
+			Name:     "50-limits.conf",
+			Settings: map[string]string{"DefaultLimitNOFILE": "4096:524288"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, reloaded)
+		assert.FileExists(t, filepath.Join(etc, "system.conf.d", "50-limits.conf"))
+	})
+
+	t.Run("Invalid input", func(t *testing.T) {
+		for _, params := range []*ChangeConfigDropinParams{
+			{Daemon: "journald", Action: "create", Name: "../../passwd", Settings: map[string]string{"Storage": "auto"}},
+			{Daemon: "journald", Action: "create", Name: "50-x.conf", Settings: map[string]string{"Storage": "auto\n[Unit]"}},
+			{Daemon: "journald", Action: "create", Name: "50-x.conf", Settings: map[string]string{"Bad Key": "1"}},
+			{Daemon: "journald", Action: "create", Name: "50-x.conf"},
+			{Daemon: "udevd", Action: "create", Name: "50-x.conf", Settings: map[string]string{"Storage": "auto"}},
+		} {
+			_, _, err := conn.ChangeConfigDropin(context.Background(), nil, params)
+			assert.Error(t, err, "%+v", params)
+		}
+		assert.NoFileExists(t, filepath.Join(etc, "journald.conf.d", "50-x.conf"))
+	})
+
+	t.Run("Write not authorized", func(t *testing.T) {
+		readAuth, _ := auth_pkg.NewNoAuth(true, false)
+		readConn := &Connection{dbus: mock, auth: readAuth}
+		_, _, err := readConn.ChangeConfigDropin(context.Background(), nil, &ChangeConfigDropinParams{Daemon: "journald", Action: "create", Name: "60-x.conf", Settings: map[string]string{"Storage": "auto"}})
+		assert.Error(t, err)
+		assert.NoFileExists(t, filepath.Join(etc, "journald.conf.d", "60-x.conf"))
+	})
+}
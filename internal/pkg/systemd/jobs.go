@@ -0,0 +1,176 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/progress"
+)
+
+// interval in which check_restart_reload looks for a running job
+var jobPollInterval = 500 * time.Millisecond
+
+// JobPending is returned if a job didn't finish within the timeout, it
+// contains the parameters for check_restart_reload
+type JobPending struct {
+	Status  string               `json:"status"`
+	Message string               `json:"message"`
+	Check   *RestartReloadParams `json:"check_restart_reload"`
+}
+
+// JobState is the outcome of a job as seen by systemd
+type JobState struct {
+	Name              string `json:"name"`
+	JobID             uint32 `json:"job_id,omitempty"`
+	JobRunning        bool   `json:"job_running"`
+	JobType           string `json:"job_type,omitempty"`
+	JobState          string `json:"job_state,omitempty"`
+	ActiveState       string `json:"active_state"`
+	SubState          string `json:"sub_state"`
+	Result            string `json:"result,omitempty"`
+	StateChange       string `json:"state_change,omitempty"`
+	ChangedSinceStart *bool  `json:"changed_since_start,omitempty"`
+}
+
+func jsonResult(v any) (*mcp.CallToolResult, any, error) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{
+				Text: string(jsonBytes),
+			},
+		},
+	}, nil, nil
+}
+
+// waitForJob waits for the result of a job started by change_unit_state. If
+// the job is still running after the timeout the parameters to check it
+// later are returned.
+func (conn *Connection) waitForJob(ctx context.Context, req *mcp.CallToolRequest, check *RestartReloadParams) (*mcp.CallToolResult, any, error) {
+	var timeout <-chan time.Time
+	if check.TimeOut > 0 {
+		timer := time.NewTimer(time.Duration(check.TimeOut) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	} else {
+		expired := make(chan time.Time)
+		close(expired)
+		timeout = expired
+	}
+	// the progress is the time waited of the timeout
+	reporter := progress.New(req, float64(check.TimeOut))
+	var tick <-chan time.Time
+	if reporter != nil {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	started := time.Now()
+wait:
+	for {
+		select {
+		case result := <-conn.rchannel:
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{
+						Text: result,
+					},
+				},
+			}, nil, nil
+		case <-tick:
+			reporter.Report(ctx, time.Since(started).Seconds(), fmt.Sprintf("waiting for job %d of %s", check.JobID, check.Name))
+		case <-timeout:
+			break wait
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	return jsonResult(JobPending{
+		Status:  "in_progress",
+		Message: fmt.Sprintf("job %d for %s is still running after %ds, call check_restart_reload with the parameters of check_restart_reload to get its outcome", check.JobID, check.Name, check.TimeOut),
+		Check:   check,
+	})
+}
+
+// findJob returns the queued job with the id, or the job of the unit if no
+// id is given
+func (conn *Connection) findJob(ctx context.Context, params *RestartReloadParams) (*dbus.JobStatus, error) {
+	jobs, err := conn.dbus.ListJobsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	for _, job := range jobs {
+		if (params.JobID != 0 && job.Id == params.JobID) || (params.JobID == 0 && job.Unit == params.Name) {
+			return &job, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkJob waits up to the timeout for the job to leave the queue and
+// returns the state of the job and its unit
+func (conn *Connection) checkJob(ctx context.Context, req *mcp.CallToolRequest, params *RestartReloadParams) (*mcp.CallToolResult, any, error) {
+	started := time.Now()
+	deadline := started.Add(time.Duration(params.TimeOut) * time.Second)
+	reporter := progress.New(req, float64(params.TimeOut))
+	var job *dbus.JobStatus
+	var err error
+	for {
+		if job, err = conn.findJob(ctx, params); err != nil {
+			return nil, nil, err
+		}
+		if job == nil || !time.Now().Before(deadline) {
+			break
+		}
+		reporter.Report(ctx, time.Since(started).Seconds(), fmt.Sprintf("job %d of %s is %s", job.Id, job.Unit, job.Status))
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(jobPollInterval):
+		}
+	}
+
+	state := JobState{
+		Name:  params.Name,
+		JobID: params.JobID,
+	}
+	if job != nil {
+		state.Name = job.Unit
+		state.JobRunning = true
+		state.JobType = job.JobType
+		state.JobState = job.Status
+	} else {
+		// the unit state tells the outcome, the queued result of the
+		// finished job isn't needed anymore
+		select {
+		case <-conn.rchannel:
+		default:
+		}
+	}
+	if state.Name == "" {
+		return nil, nil, fmt.Errorf("job %d isn't queued anymore, the unit name is needed to check its outcome", params.JobID)
+	}
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, state.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get properties of %s: %w", state.Name, err)
+	}
+	state.ActiveState, _ = props["ActiveState"].(string)
+	state.SubState, _ = props["SubState"].(string)
+	state.Result, _ = props["Result"].(string)
+	if usec, _ := props["StateChangeTimestamp"].(uint64); usec != 0 {
+		changed := time.UnixMicro(int64(usec))
+		state.StateChange = changed.Format(time.RFC3339Nano)
+		if startedAt, err := time.Parse(time.RFC3339Nano, params.StartedAt); err == nil {
+			since := !changed.Before(startedAt)
+			state.ChangedSinceStart = &since
+		}
+	}
+	return jsonResult(state)
+}
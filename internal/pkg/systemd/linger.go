@@ -0,0 +1,210 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
+)
+
+// logind keeps a flag file for every lingering user in this directory
+var lingerDir = "/var/lib/systemd/linger"
+
+// LogindConnection abstracts the calls to org.freedesktop.login1 for testing
+type LogindConnection interface {
+	SetUserLinger(ctx context.Context, uid uint32, enable bool) error
+}
+
+type logindConn struct {
+	conn *godbus.Conn
+}
+
+func (l *logindConn) SetUserLinger(ctx context.Context, uid uint32, enable bool) error {
+	cost.AddDbusCall(ctx)
+	ctx, span := tracing.Start(ctx, "dbus SetUserLinger", tracing.KindClient)
+	span.SetAttr("rpc.system", "dbus")
+	span.SetAttr("rpc.method", "SetUserLinger")
+	obj := l.conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	err := obj.CallWithContext(ctx, "org.freedesktop.login1.Manager.SetUserLinger", 0, uid, enable, false).Err
+	span.End(err)
+	return err
+}
+
+// getLogind connects to logind on first use, as only the linger tools need it
+func (conn *Connection) getLogind() (LogindConnection, error) {
+	if conn.logind == nil {
+		bus, err := godbus.SystemBus()
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to system dbus: %w", err)
+		}
+		conn.logind = &logindConn{conn: bus}
+	}
+	return conn.logind, nil
+}
+
+type UserLinger struct {
+	User            string `json:"user"`
+	UID             uint32 `json:"uid"`
+	Linger          bool   `json:"linger"`
+	Manager         string `json:"manager"`
+	ManagerState    string `json:"manager_state"`
+	ManagerSubState string `json:"manager_sub_state,omitempty"`
+}
+
+type GetUserLingerParams struct {
+	User string `json:"user,omitempty" jsonschema:"Name or UID of the user. Without a user all lingering users are listed."`
+}
+
+func CreateGetUserLingerSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[GetUserLingerParams](nil)
+	return inputSchema
+}
+
+// lookupUser resolves a user name or UID
+func lookupUser(name string) (*user.User, uint32, error) {
+	var u *user.User
+	var err error
+	if _, convErr := strconv.ParseUint(name, 10, 32); convErr == nil {
+		u, err = user.LookupId(name)
+	} else {
+		u, err = user.Lookup(name)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("unknown user %s: %w", name, err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid uid %s of user %s", u.Uid, u.Username)
+	}
+	return u, uint32(uid), nil
+}
+
+// userLinger returns the linger flag and the state of the user manager
+func (conn *Connection) userLinger(ctx context.Context, name string) (*UserLinger, error) {
+	u, uid, err := lookupUser(name)
+	if err != nil {
+		return nil, err
+	}
+	res := &UserLinger{
+		User:    u.Username,
+		UID:     uid,
+		Manager: fmt.Sprintf("user@%d.service", uid),
+	}
+	if _, err := os.Stat(filepath.Join(lingerDir, u.Username)); err == nil {
+		res.Linger = true
+	}
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, res.Manager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state of %s: %w", res.Manager, err)
+	}
+	res.ManagerState, _ = props["ActiveState"].(string)
+	res.ManagerSubState, _ = props["SubState"].(string)
+	return res, nil
+}
+
+// GetUserLinger shows whether a user lingers, i.e. whether its user manager
+// runs without a session, and the state of the user manager
+func (conn *Connection) GetUserLinger(ctx context.Context, req *mcp.CallToolRequest, params *GetUserLingerParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	if params.User != "" {
+		res, err := conn.userLinger(ctx, params.User)
+		if err != nil {
+			return nil, nil, err
+		}
+		return jsonResult(res)
+	}
+	entries, err := os.ReadDir(lingerDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", lingerDir, err)
+	}
+	users := []UserLinger{}
+	for _, entry := range entries {
+		res, err := conn.userLinger(ctx, entry.Name())
+		if err != nil {
+			slog.DebugContext(ctx, "skipping lingering user", "user", entry.Name(), "error", err)
+			continue
+		}
+		users = append(users, *res)
+	}
+	return jsonResult(users)
+}
+
+func ValidLingerActions() []string {
+	return []string{"enable_linger", "disable_linger", "start_manager"}
+}
+
+type ChangeUserLingerParams struct {
+	User   string `json:"user" jsonschema:"Name or UID of the user"`
+	Action string `json:"action" jsonschema:"enable_linger keeps the user manager running without a session and starts it, disable_linger stops it with the last session, start_manager starts user@UID.service once."`
+}
+
+func CreateChangeUserLingerSchema() *jsonschema.Schema {
+	inputSchema, _ := jsonschema.For[ChangeUserLingerParams](nil)
+	var actions []any
+	for _, a := range ValidLingerActions() {
+		actions = append(actions, a)
+	}
+	inputSchema.Properties["action"].Enum = actions
+	return inputSchema
+}
+
+// ChangeUserLinger enables or disables lingering like loginctl enable-linger
+// or starts the user manager, which is needed to manage user units on
+// headless hosts
+func (conn *Connection) ChangeUserLinger(ctx context.Context, req *mcp.CallToolRequest, params *ChangeUserLingerParams) (*mcp.CallToolResult, any, error) {
+	if !slices.Contains(ValidLingerActions(), params.Action) {
+		return nil, nil, fmt.Errorf("invalid action: %s", params.Action)
+	}
+	u, uid, err := lookupUser(params.User)
+	if err != nil {
+		return nil, nil, err
+	}
+	permission := "org.freedesktop.login1.set-user-linger"
+	if params.Action == "start_manager" {
+		if err := CheckUnit(ctx, fmt.Sprintf("user@%d.service", uid)); err != nil {
+			return nil, nil, err
+		}
+		permission = dbus.ActionManageUnits
+	}
+	allowed, err := conn.auth.IsWriteAuthorized(dbus.WithDetails(ctx, permission, map[string]string{"user": u.Username, "operation": params.Action}))
+	if !allowed || err != nil {
+		slog.DebugContext(ctx, "ChangeUserLinger wasn't authorized", "reason", err)
+		return nil, nil, fmt.Errorf("calling method wasn't authorized: %s", err)
+	}
+	defer conn.auth.Deauthorize()
+
+	switch params.Action {
+	case "enable_linger", "disable_linger":
+		logind, err := conn.getLogind()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := logind.SetUserLinger(ctx, uid, params.Action == "enable_linger"); err != nil {
+			return nil, nil, fmt.Errorf("failed to set linger for %s: %w", u.Username, err)
+		}
+	case "start_manager":
+		if _, err := conn.dbus.StartUnitContext(ctx, fmt.Sprintf("user@%d.service", uid), "replace", nil); err != nil {
+			return nil, nil, fmt.Errorf("failed to start user manager of %s: %w", u.Username, err)
+		}
+	}
+	res, err := conn.userLinger(ctx, u.Uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return jsonResult(res)
+}
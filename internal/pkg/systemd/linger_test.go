@@ -0,0 +1,105 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogind struct {
+	calls []bool
+}
+
+func (m *mockLogind) SetUserLinger(ctx context.Context, uid uint32, enable bool) error {
+	m.calls = append(m.calls, enable)
+	if enable {
+		return os.WriteFile(filepath.Join(lingerDir, "root"), nil, 0644)
+	}
+	return os.Remove(filepath.Join(lingerDir, "root"))
+}
+
+func TestUserLinger(t *testing.T) {
+	root, err := user.LookupId("0")
+	if err != nil || root.Username != "root" {
+		t.Skip("no root user")
+	}
+	oldDir := lingerDir
+	defer func() { lingerDir = oldDir }()
+	lingerDir = t.TempDir()
+
+	var started []string
+	mock := &mockDbusConnection{
+		getAllProperties: func(unitName string) (map[string]interface{}, error) {
+			state := "inactive"
+			if _, err := os.Stat(filepath.Join(lingerDir, "root")); err == nil {
+				state = "active"
+			}
+			return map[string]interface{}{"ActiveState": state, "SubState": "dead"}, nil
+		},
+		startUnit: func(name string, mode string) (int, error) {
+			started = append(started, name)
+			return 0, nil
+		},
+	}
+	logind := &mockLogind{}
+	testAuth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{dbus: mock, logind: logind, auth: testAuth}
+
+	decode := func(t *testing.T, res *mcp.CallToolResult, v any) {
+		require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), v))
+	}
+
+	t.Run("Get single user", func(t *testing.T) {
+		res, _, err := conn.GetUserLinger(context.Background(), nil, &GetUserLingerParams{User: "0"})
+		require.NoError(t, err)
+		var linger UserLinger
+		decode(t, res, &linger)
+		assert.Equal(t, UserLinger{User: "root", UID: 0, Manager: "user@0.service", ManagerState: "inactive", ManagerSubState: "dead"}, linger)
+	})
+
+	t.Run("Enable linger", func(t *testing.T) {
+		res, _, err := conn.ChangeUserLinger(context.Background(), nil, &ChangeUserLingerParams{User: "root", Action: "enable_linger"})
+		require.NoError(t, err)
+		var linger UserLinger
+		decode(t, res, &linger)
+		assert.True(t, linger.Linger)
+		assert.Equal(t, "active", linger.ManagerState)
+		assert.Equal(t, []bool{true}, logind.calls)
+	})
+
+	t.Run("List lingering users", func(t *testing.T) {
+		res, _, err := conn.GetUserLinger(context.Background(), nil, &GetUserLingerParams{})
+		require.NoError(t, err)
+		var users []UserLinger
+		decode(t, res, &users)
+		require.Len(t, users, 1)
+		assert.Equal(t, "root", users[0].User)
+	})
+
+	t.Run("Start manager", func(t *testing.T) {
+		_, _, err := conn.ChangeUserLinger(context.Background(), nil, &ChangeUserLingerParams{User: "root", Action: "start_manager"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user@0.service"}, started)
+	})
+
+	t.Run("Write not authorized", func(t *testing.T) {
+		readOnly, _ := auth_pkg.NewNoAuth(true, false)
+		roConn := &Connection{dbus: mock, logind: logind, auth: readOnly}
+		_, _, err := roConn.ChangeUserLinger(context.Background(), nil, &ChangeUserLingerParams{User: "root", Action: "disable_linger"})
+		assert.Error(t, err)
+		assert.Len(t, logind.calls, 1)
+	})
+
+	t.Run("Invalid action", func(t *testing.T) {
+		_, _, err := conn.ChangeUserLinger(context.Background(), nil, &ChangeUserLingerParams{User: "root", Action: "terminate"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,110 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultDenyUnits are the units which can't be changed via the write tools
+// unless the default deny list is disabled, as without them the host or the
+// server itself can't be reached any more
+func DefaultDenyUnits() []string {
+	return []string{
+		"sshd.service", "sshd.socket", "sshd@*.service",
+		"dbus.service", "dbus.socket", "dbus-broker.service",
+		"polkit.service",
+		"systemd-mcp*.service", "systemd-mcp*.socket",
+	}
+}
+
+// UnitPolicy restricts the units the write tools may change. Patterns are
+// shell globs matched against the unit name, a name without a suffix is a
+// service like for systemctl. Deny always wins, an empty allow list allows
+// everything which isn't denied.
+type UnitPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// the policy is replaced when the configuration is reloaded while tools
+// run
+var globalUnitPolicy atomic.Pointer[UnitPolicy]
+
+func init() {
+	globalUnitPolicy.Store(&UnitPolicy{
+		Deny: DefaultDenyUnits(),
+	})
+}
+
+func SetUnitPolicy(p *UnitPolicy) {
+	globalUnitPolicy.Store(p)
+}
+
+func GetUnitPolicy() *UnitPolicy {
+	return globalUnitPolicy.Load()
+}
+
+var unitSuffixes = []string{
+	".service", ".socket", ".target", ".device", ".mount", ".automount",
+	".swap", ".timer", ".path", ".slice", ".scope",
+}
+
+func firstUnitMatch(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// Check returns an error if the unit may not be changed. It only looks at
+// the name, so it's called before any dbus call is made.
+func (p *UnitPolicy) Check(name string) error {
+	if p == nil {
+		return nil
+	}
+	// unit files can be enabled by their path
+	unit := path.Base(name)
+	if name == "" || strings.HasSuffix(name, "/") {
+		return fmt.Errorf("invalid unit name: %q", name)
+	}
+	if !slices.Contains(unitSuffixes, path.Ext(unit)) {
+		unit += ".service"
+	}
+	var err error
+	if pattern := firstUnitMatch(p.Deny, unit); pattern != "" {
+		err = fmt.Errorf("changing %s denied by pattern %q", unit, pattern)
+	} else if len(p.Allow) > 0 && firstUnitMatch(p.Allow, unit) == "" {
+		err = fmt.Errorf("changing %s denied, not in allowed units", unit)
+	}
+	if err != nil {
+		slog.Warn("unit change denied by unit policy", "audit", "unit_denied", "unit", unit, "reason", err)
+	}
+	return err
+}
+
+type unitPatternsKey struct{}
+
+// WithUnitPatterns restricts the units the request may change to the
+// patterns, e.g. the ones of the roles of the caller
+func WithUnitPatterns(ctx context.Context, patterns []string) context.Context {
+	return context.WithValue(ctx, unitPatternsKey{}, patterns)
+}
+
+// CheckUnit checks the unit against the unit policy and the patterns of
+// the request
+func CheckUnit(ctx context.Context, name string) error {
+	if err := GetUnitPolicy().Check(name); err != nil {
+		return err
+	}
+	if patterns, ok := ctx.Value(unitPatternsKey{}).([]string); ok {
+		return (&UnitPolicy{Allow: patterns}).Check(name)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package systemd
+
+import (
+	"context"
+	"testing"
+
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitPolicyCheck(t *testing.T) {
+	policy := &UnitPolicy{
+		Allow: []string{"nginx*", "getty@*.service", "*.timer"},
+		Deny:  DefaultDenyUnits(),
+	}
+	tests := []struct {
+		name    string
+		allowed bool
+	}{
+		{"nginx.service", true},
+		{"nginx", true},
+		{"getty@tty1.service", true},
+		{"logrotate.timer", true},
+		{"/etc/systemd/system/nginx-cache.service", true},
+		{"sshd", false},
+		{"sshd.socket", false},
+		{"dbus.service", false},
+		{"systemd-mcp.service", false},
+		{"postgresql.service", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.name)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+	assert.NoError(t, (*UnitPolicy)(nil).Check("sshd.service"))
+}
+
+func TestUnitPolicyChangeUnitState(t *testing.T) {
+	defer SetUnitPolicy(&UnitPolicy{Deny: DefaultDenyUnits()})
+	SetUnitPolicy(&UnitPolicy{Deny: []string{"db*"}})
+
+	called := false
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			stopUnit: func(name string, mode string) (int, error) {
+				called = true
+				return 1, nil
+			},
+		},
+		auth:     auth,
+		rchannel: make(chan string, 1),
+	}
+	_, _, err := conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "db.service", Action: "stop"})
+	assert.ErrorContains(t, err, "denied by pattern")
+	assert.False(t, called)
+}
@@ -0,0 +1,161 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// propertyUpdates is the number of signals buffered until the cache reads
+// them, if more arrive at once the whole cache is dropped
+const propertyUpdates = 1024
+
+var errNoSignals = errors.New("the connection doesn't receive the signals of systemd")
+
+// propertyCache keeps the properties of the units read by
+// list_loaded_units. systemd signals PropertiesChanged for every unit whose
+// state changes, which drops the unit from the cache, so that repeated
+// calls only read the changed units over dbus. Properties without a signal,
+// like the unit file state, are dropped by the calls which change them, and
+// ttl bounds the age of an entry in case a change passed unnoticed. A nil
+// cache caches nothing.
+type propertyCache struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	units map[string]*cachedProperties
+}
+
+type cachedProperties struct {
+	props map[string]interface{}
+	read  time.Time
+	// version counts the invalidations, properties read before one aren't
+	// cached
+	version uint64
+}
+
+// get returns the cached properties of a unit, nil if there are none, and
+// the version for put. The properties must not be changed.
+func (c *propertyCache) get(name string) (map[string]interface{}, uint64) {
+	if c == nil {
+		return nil, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.units[name]
+	if !ok {
+		return nil, 0
+	}
+	if entry.props != nil && time.Since(entry.read) > c.ttl {
+		entry.props = nil
+	}
+	return entry.props, entry.version
+}
+
+// put caches the properties of a unit read since get returned version
+func (c *propertyCache) put(name string, version uint64, props map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.units[name]
+	if !ok {
+		entry = &cachedProperties{}
+		c.units[name] = entry
+	}
+	if entry.version != version {
+		// the unit changed while it was read
+		return
+	}
+	entry.props, entry.read = props, time.Now()
+}
+
+// invalidate drops the properties of a unit
+func (c *propertyCache) invalidate(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.units[name]; ok {
+		entry.props = nil
+		entry.version++
+	}
+}
+
+// clear drops the properties of all units
+func (c *propertyCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.units {
+		entry.props = nil
+		entry.version++
+	}
+}
+
+// subscriber is the part of the dbus connection of go-systemd which
+// signals the changed units
+type subscriber interface {
+	Subscribe() error
+	Unsubscribe() error
+	SetPropertiesSubscriber(updateCh chan<- *dbus.PropertiesUpdate, errCh chan<- error)
+}
+
+// signalConnection returns the connection below the wrappers which
+// receives the signals of systemd
+func signalConnection(c DbusConnection) (subscriber, bool) {
+	switch c := c.(type) {
+	case countingConnection:
+		return signalConnection(c.DbusConnection)
+	case helperConnection:
+		return signalConnection(c.DbusConnection)
+	case subscriber:
+		return c, true
+	}
+	return nil, false
+}
+
+// CacheProperties caches the unit properties of list_loaded_units for at
+// most ttl until ctx is done. The cache is shared by the sessions of conn.
+func (conn *Connection) CacheProperties(ctx context.Context, ttl time.Duration) error {
+	sub, ok := signalConnection(conn.dbus)
+	if !ok {
+		return errNoSignals
+	}
+	cache := &propertyCache{ttl: ttl, units: make(map[string]*cachedProperties)}
+	updates := make(chan *dbus.PropertiesUpdate, propertyUpdates)
+	errs := make(chan error, 1)
+	sub.SetPropertiesSubscriber(updates, errs)
+	if err := sub.Subscribe(); err != nil {
+		sub.SetPropertiesSubscriber(nil, nil)
+		return err
+	}
+	conn.props = cache
+	go func() {
+		defer func() {
+			sub.SetPropertiesSubscriber(nil, nil)
+			sub.Unsubscribe()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update := <-updates:
+				cache.invalidate(update.UnitName)
+			case err := <-errs:
+				// signals were lost, any unit may have changed
+				slog.Debug("dropping the unit property cache", "reason", err)
+				cache.clear()
+			}
+		}
+	}()
+	return nil
+}
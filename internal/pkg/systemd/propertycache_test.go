@@ -0,0 +1,107 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPropertyCache(t *testing.T) {
+	cache := &propertyCache{ttl: time.Hour, units: make(map[string]*cachedProperties)}
+	props, version := cache.get("sshd.service")
+	assert.Nil(t, props)
+	cache.put("sshd.service", version, map[string]interface{}{"Id": "sshd.service"})
+	props, _ = cache.get("sshd.service")
+	assert.Equal(t, "sshd.service", props["Id"])
+
+	// properties read before an invalidation aren't cached
+	_, version = cache.get("sshd.service")
+	cache.invalidate("sshd.service")
+	cache.put("sshd.service", version, map[string]interface{}{"Id": "stale"})
+	props, version = cache.get("sshd.service")
+	assert.Nil(t, props)
+	cache.put("sshd.service", version, map[string]interface{}{"Id": "sshd.service"})
+	cache.clear()
+	props, _ = cache.get("sshd.service")
+	assert.Nil(t, props)
+
+	cache.ttl = 0
+	_, version = cache.get("sshd.service")
+	cache.put("sshd.service", version, map[string]interface{}{"Id": "sshd.service"})
+	time.Sleep(time.Millisecond)
+	props, _ = cache.get("sshd.service")
+	assert.Nil(t, props, "expired properties are read again")
+
+	var none *propertyCache
+	none.put("sshd.service", 0, map[string]interface{}{})
+	props, _ = none.get("sshd.service")
+	assert.Nil(t, props)
+}
+
+type signalingConnection struct {
+	*mockDbusConnection
+	updates chan<- *dbus.PropertiesUpdate
+	errs    chan<- error
+}
+
+func (c *signalingConnection) Subscribe() error   { return nil }
+func (c *signalingConnection) Unsubscribe() error { return nil }
+func (c *signalingConnection) SetPropertiesSubscriber(updateCh chan<- *dbus.PropertiesUpdate, errCh chan<- error) {
+	c.updates, c.errs = updateCh, errCh
+}
+
+func TestListLoadedUnitsCached(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	var reads atomic.Int32
+	signals := &signalingConnection{mockDbusConnection: &mockDbusConnection{
+		listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+			return []dbus.UnitStatus{{Name: "sshd.service"}, {Name: "cron.service"}}, nil
+		},
+		getAllProperties: func(unitName string) (map[string]interface{}, error) {
+			reads.Add(1)
+			return map[string]interface{}{"Id": unitName, "Description": ""}, nil
+		},
+	}}
+	conn := &Connection{dbus: countingConnection{signals}, auth: auth}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, conn.CacheProperties(ctx, time.Hour))
+
+	list := func() {
+		res, _, err := conn.Session().ListLoadedUnits(ctx, nil, &ListLoadedUnitsParams{Properties: true, Verbose: true})
+		require.NoError(t, err)
+		require.Len(t, res.Content, 2)
+	}
+	list()
+	list()
+	assert.Equal(t, int32(2), reads.Load(), "the second call is answered from the cache")
+
+	signals.updates <- &dbus.PropertiesUpdate{UnitName: "sshd.service"}
+	assert.Eventually(t, func() bool {
+		props, _ := conn.props.get("sshd.service")
+		return props == nil
+	}, time.Second, time.Millisecond)
+	list()
+	assert.Equal(t, int32(3), reads.Load(), "only the changed unit is read again")
+
+	signals.errs <- errors.New("signal channel is full")
+	assert.Eventually(t, func() bool {
+		props, _ := conn.props.get("cron.service")
+		return props == nil
+	}, time.Second, time.Millisecond)
+	list()
+	assert.Equal(t, int32(5), reads.Load(), "lost signals drop the cache")
+}
+
+func TestCachePropertiesWithoutSignals(t *testing.T) {
+	conn := &Connection{dbus: &mockDbusConnection{}}
+	assert.ErrorIs(t, conn.CacheProperties(context.Background(), time.Hour), errNoSignals)
+	assert.Nil(t, conn.props)
+}
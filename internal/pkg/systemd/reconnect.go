@@ -0,0 +1,305 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+const (
+	// reconnectMin is the time after a failed connect until the next one,
+	// it doubles with every further failure up to reconnectMax
+	reconnectMin = time.Second
+	reconnectMax = 30 * time.Second
+)
+
+var (
+	errReconnecting = errors.New("the service manager isn't connected, reconnecting")
+	errClosed       = errors.New("the connection to the service manager is closed")
+	errLostSignals  = errors.New("the connection to the service manager was lost")
+)
+
+// bus is a connection to the service manager as opened by go-systemd
+type bus interface {
+	DbusConnection
+	subscriber
+	Connected() bool
+}
+
+// dialer returns a function which opens the connections of open as bus
+func dialer(open func() (*dbus.Conn, error)) func() (bus, error) {
+	return func() (bus, error) {
+		c, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+// reconnectingConnection connects to the service manager on its first call
+// and again after the connection dropped, e.g. because dbus was restarted,
+// so that the tools work again once the bus is back. While the bus can't be
+// reached the calls fail at once and the connect is retried with an
+// exponential backoff. The signals subscribed to are subscribed to on every
+// new connection.
+type reconnectingConnection struct {
+	dial               func() (bus, error)
+	retryMin, retryMax time.Duration
+
+	mu      sync.Mutex
+	conn    bus
+	closed  bool
+	backoff time.Duration
+	retry   time.Time // the time of the next connect after a failure
+	lastErr error
+
+	subscribed bool
+	updates    chan<- *dbus.PropertiesUpdate
+	errs       chan<- error
+}
+
+func newReconnectingConnection(dial func() (bus, error)) *reconnectingConnection {
+	return &reconnectingConnection{dial: dial, retryMin: reconnectMin, retryMax: reconnectMax}
+}
+
+// get returns the connection, which is opened if there is none
+func (r *reconnectingConnection) get() (bus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, errClosed
+	}
+	if r.conn != nil {
+		if r.conn.Connected() {
+			return r.conn, nil
+		}
+		slog.Warn("lost the connection to the service manager, reconnecting")
+		r.conn.Close()
+		r.conn = nil
+		if r.errs != nil {
+			// the signals until the reconnect are lost
+			select {
+			case r.errs <- errLostSignals:
+			default:
+			}
+		}
+	}
+	if time.Now().Before(r.retry) {
+		return nil, fmt.Errorf("%w: %w", errReconnecting, r.lastErr)
+	}
+	c, err := r.dial()
+	if err != nil {
+		r.backoff = min(max(r.backoff*2, r.retryMin), r.retryMax)
+		r.retry = time.Now().Add(r.backoff)
+		r.lastErr = err
+		slog.Warn("couldn't connect to the service manager", "retry", r.backoff, "error", err)
+		return nil, fmt.Errorf("%w: %w", errReconnecting, err)
+	}
+	if r.lastErr != nil {
+		slog.Info("connected to the service manager again")
+	}
+	r.backoff, r.retry, r.lastErr = 0, time.Time{}, nil
+	if r.updates != nil || r.errs != nil {
+		c.SetPropertiesSubscriber(r.updates, r.errs)
+	}
+	if r.subscribed {
+		if err := c.Subscribe(); err != nil {
+			slog.Warn("couldn't subscribe to the signals of the service manager", "error", err)
+		}
+	}
+	r.conn = c
+	return c, nil
+}
+
+// failed returns the error of a call over c, marked as a lost connection if
+// c dropped
+func (r *reconnectingConnection) failed(c bus, err error) error {
+	if err != nil && !c.Connected() {
+		return fmt.Errorf("%w: %w", errReconnecting, err)
+	}
+	return err
+}
+
+func (r *reconnectingConnection) ListUnitsByPatternsContext(ctx context.Context, states []string, patterns []string) ([]dbus.UnitStatus, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.ListUnitsByPatternsContext(ctx, states, patterns)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) ListUnitsByNamesContext(ctx context.Context, units []string) ([]dbus.UnitStatus, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.ListUnitsByNamesContext(ctx, units)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) GetAllPropertiesContext(ctx context.Context, unitName string) (map[string]interface{}, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.GetAllPropertiesContext(ctx, unitName)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) GetUnitTypePropertiesContext(ctx context.Context, unitName string, unitType string) (map[string]interface{}, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.GetUnitTypePropertiesContext(ctx, unitName, unitType)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	c, err := r.get()
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.ReloadOrRestartUnitContext(ctx, name, mode, ch)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	c, err := r.get()
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.RestartUnitContext(ctx, name, mode, ch)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	c, err := r.get()
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.StartUnitContext(ctx, name, mode, ch)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	c, err := r.get()
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.StopUnitContext(ctx, name, mode, ch)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) KillUnitContext(ctx context.Context, name string, signal int32) {
+	c, err := r.get()
+	if err != nil {
+		slog.WarnContext(ctx, "couldn't kill unit", "unit", name, "error", err)
+		return
+	}
+	c.KillUnitContext(ctx, name, signal)
+}
+
+func (r *reconnectingConnection) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+	c, err := r.get()
+	if err != nil {
+		return false, nil, err
+	}
+	carries, changes, err := c.EnableUnitFilesContext(ctx, files, runtime, force)
+	return carries, changes, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.DisableUnitFilesContext(ctx, files, runtime)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) ListUnitFilesContext(ctx context.Context) ([]dbus.UnitFile, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.ListUnitFilesContext(ctx)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) ListJobsContext(ctx context.Context) ([]dbus.JobStatus, error) {
+	c, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.ListJobsContext(ctx)
+	return res, r.failed(c, err)
+}
+
+func (r *reconnectingConnection) ReloadContext(ctx context.Context) error {
+	c, err := r.get()
+	if err != nil {
+		return err
+	}
+	return r.failed(c, c.ReloadContext(ctx))
+}
+
+func (r *reconnectingConnection) GetManagerProperty(prop string) (string, error) {
+	c, err := r.get()
+	if err != nil {
+		return "", err
+	}
+	res, err := c.GetManagerProperty(prop)
+	return res, r.failed(c, err)
+}
+
+// Subscribe subscribes the current and every later connection to the
+// signals of the service manager
+func (r *reconnectingConnection) Subscribe() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribed = true
+	if r.conn != nil {
+		return r.conn.Subscribe()
+	}
+	return nil
+}
+
+func (r *reconnectingConnection) Unsubscribe() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribed = false
+	if r.conn != nil {
+		return r.conn.Unsubscribe()
+	}
+	return nil
+}
+
+// SetPropertiesSubscriber passes the changed properties of every
+// connection to updateCh. A lost connection is reported to errCh, as the
+// changes until the reconnect are missed.
+func (r *reconnectingConnection) SetPropertiesSubscriber(updateCh chan<- *dbus.PropertiesUpdate, errCh chan<- error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates, r.errs = updateCh, errCh
+	if r.conn != nil {
+		r.conn.SetPropertiesSubscriber(updateCh, errCh)
+	}
+}
+
+func (r *reconnectingConnection) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
@@ -0,0 +1,120 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBus struct {
+	*mockDbusConnection
+	connected  atomic.Bool
+	closed     bool
+	subscribed bool
+	updates    chan<- *dbus.PropertiesUpdate
+}
+
+func (b *fakeBus) Connected() bool    { return b.connected.Load() }
+func (b *fakeBus) Close()             { b.closed = true }
+func (b *fakeBus) Subscribe() error   { b.subscribed = true; return nil }
+func (b *fakeBus) Unsubscribe() error { b.subscribed = false; return nil }
+func (b *fakeBus) SetPropertiesSubscriber(updateCh chan<- *dbus.PropertiesUpdate, errCh chan<- error) {
+	b.updates = updateCh
+}
+
+func newFakeBus() *fakeBus {
+	b := &fakeBus{mockDbusConnection: &mockDbusConnection{
+		listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+			return []dbus.UnitStatus{{Name: "sshd.service"}}, nil
+		},
+	}}
+	b.connected.Store(true)
+	return b
+}
+
+func TestReconnectingConnection(t *testing.T) {
+	var buses []*fakeBus
+	var dialErr error
+	r := newReconnectingConnection(func() (bus, error) {
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		b := newFakeBus()
+		buses = append(buses, b)
+		return b, nil
+	})
+	r.retryMin, r.retryMax = 20*time.Millisecond, 40*time.Millisecond
+	ctx := context.Background()
+	assert.Empty(t, buses, "the bus is connected on the first call")
+
+	units, err := r.ListUnitsByPatternsContext(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, units, 1)
+	_, err = r.ListUnitsByPatternsContext(ctx, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, buses, 1)
+
+	updates := make(chan *dbus.PropertiesUpdate, 1)
+	errs := make(chan error, 1)
+	r.SetPropertiesSubscriber(updates, errs)
+	require.NoError(t, r.Subscribe())
+	assert.True(t, buses[0].subscribed)
+
+	// dbus restarts and can't be reached for a while
+	buses[0].connected.Store(false)
+	dialErr = errors.New("no such file or directory")
+	_, err = r.ListUnitsByPatternsContext(ctx, nil, nil)
+	assert.ErrorIs(t, err, errReconnecting)
+	assert.ErrorContains(t, err, "no such file or directory")
+	assert.True(t, buses[0].closed)
+	assert.ErrorIs(t, <-errs, errLostSignals, "the signals until the reconnect are lost")
+
+	dialErr = nil
+	_, err = r.ListUnitsByPatternsContext(ctx, nil, nil)
+	assert.ErrorIs(t, err, errReconnecting, "the connect is retried after the backoff")
+	assert.Len(t, buses, 1)
+	time.Sleep(r.retryMin)
+	_, err = r.ListUnitsByPatternsContext(ctx, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, buses, 2)
+	assert.True(t, buses[1].subscribed, "the new bus is subscribed again")
+	assert.NotNil(t, buses[1].updates)
+
+	r.Close()
+	assert.True(t, buses[1].closed)
+	_, err = r.ListUnitsByPatternsContext(ctx, nil, nil)
+	assert.ErrorIs(t, err, errClosed)
+}
+
+func TestReconnectingConnectionBackoff(t *testing.T) {
+	dials := 0
+	r := newReconnectingConnection(func() (bus, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	})
+	r.retryMin, r.retryMax = time.Millisecond, 4*time.Millisecond
+	for _, backoff := range []time.Duration{1, 2, 4, 4} {
+		time.Sleep(r.backoff)
+		_, err := r.GetManagerProperty("Version")
+		assert.ErrorIs(t, err, errReconnecting)
+		assert.Equal(t, backoff*time.Millisecond, r.backoff)
+	}
+	assert.Equal(t, 4, dials)
+}
+
+func TestReconnectingConnectionDroppedCall(t *testing.T) {
+	b := newFakeBus()
+	b.listUnitsByPatterns = func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+		b.connected.Store(false)
+		return nil, errors.New("dbus: connection closed by user")
+	}
+	r := newReconnectingConnection(func() (bus, error) { return b, nil })
+	_, err := r.ListUnitsByPatternsContext(context.Background(), nil, nil)
+	assert.ErrorIs(t, err, errReconnecting)
+}
@@ -0,0 +1,59 @@
+package systemd
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+type StartedUnit struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	SubState    string `json:"sub_state"`
+	Started     string `json:"started"`
+	MainPID     uint32 `json:"main_pid,omitempty"`
+	Fragment    string `json:"fragment_path,omitempty"`
+}
+
+// UnitsStartedSince returns the active units which entered the active
+// state after since, the newest first. Authorization has to be checked by
+// the caller.
+func (conn *Connection) UnitsStartedSince(ctx context.Context, since time.Time) ([]StartedUnit, error) {
+	units, err := conn.dbus.ListUnitsByPatternsContext(ctx, []string{"active"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	started := []StartedUnit{}
+	var times []time.Time
+	for _, u := range units {
+		props, err := conn.dbus.GetAllPropertiesContext(ctx, u.Name)
+		if err != nil {
+			slog.DebugContext(ctx, "failed to get properties for unit", "unit", u.Name, "error", err)
+			continue
+		}
+		usec, _ := props["ActiveEnterTimestamp"].(uint64)
+		if usec == 0 {
+			continue
+		}
+		enter := time.UnixMicro(int64(usec))
+		if enter.Before(since) {
+			continue
+		}
+		unit := StartedUnit{
+			Name:        u.Name,
+			Description: u.Description,
+			SubState:    u.SubState,
+			Started:     enter.Format(time.RFC3339),
+		}
+		if strings.HasSuffix(u.Name, ".service") {
+			unit.MainPID, _ = props["MainPID"].(uint32)
+		}
+		unit.Fragment, _ = props["FragmentPath"].(string)
+		idx, _ := slices.BinarySearchFunc(times, enter, func(a, b time.Time) int { return b.Compare(a) })
+		times = slices.Insert(times, idx, enter)
+		started = slices.Insert(started, idx, unit)
+	}
+	return started, nil
+}
@@ -0,0 +1,120 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
+)
+
+type SystemStatusParams struct{}
+
+type SystemStatus struct {
+	Version                 string `json:"version"`
+	Architecture            string `json:"architecture,omitempty"`
+	Virtualization          string `json:"virtualization,omitempty"`
+	SystemState             string `json:"system_state"`
+	NFailedUnits            uint64 `json:"failed_units"`
+	NJobs                   uint64 `json:"jobs"`
+	DefaultTimeoutStartUSec uint64 `json:"default_timeout_start_usec"`
+	DefaultTimeoutStopUSec  uint64 `json:"default_timeout_stop_usec"`
+	DefaultTimeoutStart     string `json:"default_timeout_start"`
+	DefaultTimeoutStop      string `json:"default_timeout_stop"`
+}
+
+// managerValue strips the GVariant text format of a manager property, e.g.
+// `"running"` or `@t 90000000`
+func managerValue(s string) string {
+	if strings.HasPrefix(s, "@") {
+		_, s, _ = strings.Cut(s, " ")
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s
+}
+
+// managerProperty reads a property of the manager, the call has no context
+// so it isn't accounted by countingConnection
+func (conn *Connection) managerProperty(ctx context.Context, name string) (string, error) {
+	cost.AddDbusCall(ctx)
+	_, span := tracing.Start(ctx, "dbus GetManagerProperty", tracing.KindClient)
+	span.SetAttr("rpc.system", "dbus")
+	span.SetAttr("rpc.method", "GetManagerProperty")
+	s, err := conn.dbus.GetManagerProperty(name)
+	span.End(err)
+	if err != nil {
+		return "", fmt.Errorf("failed to get manager property %s: %w", name, err)
+	}
+	return managerValue(s), nil
+}
+
+// Version returns the version of the service manager, it connects the bus
+// if it isn't connected yet
+func (conn *Connection) Version(ctx context.Context) (string, error) {
+	return conn.managerProperty(ctx, "Version")
+}
+
+func (conn *Connection) managerUint(ctx context.Context, name string) (uint64, error) {
+	s, err := conn.managerProperty(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	val, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q of manager property %s", s, name)
+	}
+	return val, nil
+}
+
+// usecString formats a systemd time span, the maximal value is infinity
+func usecString(usec uint64) string {
+	if usec == ^uint64(0) {
+		return "infinity"
+	}
+	return (time.Duration(usec) * time.Microsecond).String()
+}
+
+// GetSystemStatus returns the state of the service manager together with the
+// default job timeouts of the units
+func (conn *Connection) GetSystemStatus(ctx context.Context, req *mcp.CallToolRequest, params *SystemStatusParams) (*mcp.CallToolResult, any, error) {
+	if allowed, err := conn.auth.IsReadAuthorized(ctx); err != nil {
+		return nil, nil, err
+	} else if !allowed {
+		return nil, nil, fmt.Errorf("calling method was canceled by user")
+	}
+	status := SystemStatus{}
+	for name, target := range map[string]*string{
+		"Version":        &status.Version,
+		"Architecture":   &status.Architecture,
+		"Virtualization": &status.Virtualization,
+		"SystemState":    &status.SystemState,
+	} {
+		val, err := conn.managerProperty(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		*target = val
+	}
+	for name, target := range map[string]*uint64{
+		"NFailedUnits":            &status.NFailedUnits,
+		"NJobs":                   &status.NJobs,
+		"DefaultTimeoutStartUSec": &status.DefaultTimeoutStartUSec,
+		"DefaultTimeoutStopUSec":  &status.DefaultTimeoutStopUSec,
+	} {
+		val, err := conn.managerUint(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		*target = val
+	}
+	status.DefaultTimeoutStart = usecString(status.DefaultTimeoutStartUSec)
+	status.DefaultTimeoutStop = usecString(status.DefaultTimeoutStopUSec)
+
+	return jsonResult(status)
+}
@@ -0,0 +1,52 @@
+package systemd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSystemStatus(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, false)
+	mock := &mockDbusConnection{
+		managerProperties: map[string]string{
+			"Version":                 `"257.7"`,
+			"Architecture":            `"x86-64"`,
+			"Virtualization":          `""`,
+			"SystemState":             `"degraded"`,
+			"NFailedUnits":            "@u 2",
+			"NJobs":                   "@u 0",
+			"DefaultTimeoutStartUSec": "@t 90000000",
+			"DefaultTimeoutStopUSec":  "@t 18446744073709551615",
+		},
+	}
+	conn := &Connection{dbus: mock, auth: auth}
+
+	res, _, err := conn.GetSystemStatus(context.Background(), nil, &SystemStatusParams{})
+	require.NoError(t, err)
+	var status SystemStatus
+	require.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &status))
+	assert.Equal(t, SystemStatus{
+		Version:                 "257.7",
+		Architecture:            "x86-64",
+		SystemState:             "degraded",
+		NFailedUnits:            2,
+		DefaultTimeoutStartUSec: 90000000,
+		DefaultTimeoutStopUSec:  18446744073709551615,
+		DefaultTimeoutStart:     "1m30s",
+		DefaultTimeoutStop:      "infinity",
+	}, status)
+
+	version, err := conn.Version(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "257.7", version)
+
+	delete(mock.managerProperties, "NJobs")
+	_, _, err = conn.GetSystemStatus(context.Background(), nil, &SystemStatusParams{})
+	assert.Error(t, err)
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 
 	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
 	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/privsep"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
 )
 
 // DbusConnection is an interface that abstracts the dbus connection.
 // This is primarily for testing purposes.
 type DbusConnection interface {
 	ListUnitsByPatternsContext(ctx context.Context, states []string, patterns []string) ([]dbus.UnitStatus, error)
+	ListUnitsByNamesContext(ctx context.Context, units []string) ([]dbus.UnitStatus, error)
 	GetAllPropertiesContext(ctx context.Context, unitName string) (map[string]interface{}, error)
+	GetUnitTypePropertiesContext(ctx context.Context, unitName string, unitType string) (map[string]interface{}, error)
 	ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
 	RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
 	StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
@@ -20,35 +26,222 @@ type DbusConnection interface {
 	EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error)
 	DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
 	ListUnitFilesContext(ctx context.Context) ([]dbus.UnitFile, error)
+	ListJobsContext(ctx context.Context) ([]dbus.JobStatus, error)
+	ReloadContext(ctx context.Context) error
+	GetManagerProperty(prop string) (string, error)
 
 	Close()
 }
 
+// countingConnection accounts every call made over the wrapped dbus
+// connection to the cost of the tool call and records a span for it
+type countingConnection struct {
+	DbusConnection
+}
+
+// call accounts a call, starts its span and bounds it by the call timeout.
+// The returned function ends the call and returns its error.
+func (c countingConnection) call(ctx context.Context, method string) (context.Context, func(error) error) {
+	cost.AddDbusCall(ctx)
+	ctx, span := tracing.Start(ctx, "dbus "+method, tracing.KindClient)
+	span.SetAttr("rpc.system", "dbus")
+	span.SetAttr("rpc.method", method)
+	ctx, cancel := withCallTimeout(ctx)
+	return ctx, func(err error) error {
+		err = timedOut(ctx, method, err)
+		span.End(err)
+		cancel()
+		return err
+	}
+}
+
+func (c countingConnection) ListUnitsByPatternsContext(ctx context.Context, states []string, patterns []string) ([]dbus.UnitStatus, error) {
+	ctx, end := c.call(ctx, "ListUnitsByPatterns")
+	res, err := c.DbusConnection.ListUnitsByPatternsContext(ctx, states, patterns)
+	return res, end(err)
+}
+
+func (c countingConnection) ListUnitsByNamesContext(ctx context.Context, units []string) ([]dbus.UnitStatus, error) {
+	ctx, end := c.call(ctx, "ListUnitsByNames")
+	res, err := c.DbusConnection.ListUnitsByNamesContext(ctx, units)
+	return res, end(err)
+}
+
+func (c countingConnection) GetAllPropertiesContext(ctx context.Context, unitName string) (map[string]interface{}, error) {
+	ctx, end := c.call(ctx, "GetAllProperties")
+	res, err := c.DbusConnection.GetAllPropertiesContext(ctx, unitName)
+	return res, end(err)
+}
+
+func (c countingConnection) GetUnitTypePropertiesContext(ctx context.Context, unitName string, unitType string) (map[string]interface{}, error) {
+	ctx, end := c.call(ctx, "GetUnitTypeProperties")
+	res, err := c.DbusConnection.GetUnitTypePropertiesContext(ctx, unitName, unitType)
+	return res, end(err)
+}
+
+func (c countingConnection) ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	ctx, end := c.call(ctx, "ReloadOrRestartUnit")
+	res, err := c.DbusConnection.ReloadOrRestartUnitContext(ctx, name, mode, ch)
+	return res, end(err)
+}
+
+func (c countingConnection) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	ctx, end := c.call(ctx, "RestartUnit")
+	res, err := c.DbusConnection.RestartUnitContext(ctx, name, mode, ch)
+	return res, end(err)
+}
+
+func (c countingConnection) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	ctx, end := c.call(ctx, "StartUnit")
+	res, err := c.DbusConnection.StartUnitContext(ctx, name, mode, ch)
+	return res, end(err)
+}
+
+func (c countingConnection) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	ctx, end := c.call(ctx, "StopUnit")
+	res, err := c.DbusConnection.StopUnitContext(ctx, name, mode, ch)
+	return res, end(err)
+}
+
+func (c countingConnection) KillUnitContext(ctx context.Context, name string, signal int32) {
+	ctx, end := c.call(ctx, "KillUnit")
+	c.DbusConnection.KillUnitContext(ctx, name, signal)
+	end(nil)
+}
+
+func (c countingConnection) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+	ctx, end := c.call(ctx, "EnableUnitFiles")
+	carries, changes, err := c.DbusConnection.EnableUnitFilesContext(ctx, files, runtime, force)
+	return carries, changes, end(err)
+}
+
+func (c countingConnection) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+	ctx, end := c.call(ctx, "DisableUnitFiles")
+	res, err := c.DbusConnection.DisableUnitFilesContext(ctx, files, runtime)
+	return res, end(err)
+}
+
+func (c countingConnection) ListUnitFilesContext(ctx context.Context) ([]dbus.UnitFile, error) {
+	ctx, end := c.call(ctx, "ListUnitFiles")
+	res, err := c.DbusConnection.ListUnitFilesContext(ctx)
+	return res, end(err)
+}
+
+func (c countingConnection) ListJobsContext(ctx context.Context) ([]dbus.JobStatus, error) {
+	ctx, end := c.call(ctx, "ListJobs")
+	res, err := c.DbusConnection.ListJobsContext(ctx)
+	return res, end(err)
+}
+
+func (c countingConnection) ReloadContext(ctx context.Context) error {
+	ctx, end := c.call(ctx, "Reload")
+	return end(c.DbusConnection.ReloadContext(ctx))
+}
+
+// helperConnection passes the calls which change units to the helper
+type helperConnection struct {
+	DbusConnection
+	helper *privsep.Client
+}
+
+func (c helperConnection) ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.helper.ReloadOrRestartUnitContext(ctx, name, mode, ch)
+}
+
+func (c helperConnection) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.helper.RestartUnitContext(ctx, name, mode, ch)
+}
+
+func (c helperConnection) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.helper.StartUnitContext(ctx, name, mode, ch)
+}
+
+func (c helperConnection) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.helper.StopUnitContext(ctx, name, mode, ch)
+}
+
+func (c helperConnection) KillUnitContext(ctx context.Context, name string, signal int32) {
+	c.helper.KillUnitContext(ctx, name, signal)
+}
+
+func (c helperConnection) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+	return c.helper.EnableUnitFilesContext(ctx, files, runtime, force)
+}
+
+func (c helperConnection) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+	return c.helper.DisableUnitFilesContext(ctx, files, runtime)
+}
+
+func (c helperConnection) ReloadContext(ctx context.Context) error {
+	return c.helper.ReloadContext(ctx)
+}
+
 type Connection struct {
 	rchannel chan string
 	dbus     DbusConnection
+	logind   LogindConnection
 	auth     auth.AuthKeeper
+	props    *propertyCache
 }
 
-// opens a new user connection to the dbus
+// opens a new user connection to the dbus, the bus is connected on the
+// first call
 func NewUser(ctx context.Context) (conn *Connection, err error) {
 	conn = new(Connection)
 	conn.rchannel = make(chan string, 1)
-	conn.dbus, err = dbus.NewUserConnectionContext(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return conn, err
+	conn.dbus = countingConnection{newReconnectingConnection(dialer(func() (*dbus.Conn, error) {
+		return dbus.NewUserConnectionContext(ctx)
+	}))}
+	return conn, nil
 }
+
+// NewSystem returns a connection to the system bus, which is connected on
+// the first call and again if it drops. ctx bounds the lifetime of the bus.
 func NewSystem(ctx context.Context, auth auth.AuthKeeper) (conn *Connection, err error) {
 	conn = new(Connection)
 	conn.auth = auth
 	conn.rchannel = make(chan string, 1)
-	conn.dbus, err = dbus.NewSystemConnectionContext(ctx)
+	conn.dbus = countingConnection{newReconnectingConnection(dialer(func() (*dbus.Conn, error) {
+		return dbus.NewSystemConnectionContext(ctx)
+	}))}
+	return conn, nil
+}
+
+// NewRemote returns a connection to the service manager of another machine
+// over the buses returned by dialBus, like systemctl -H. The buses are
+// dialed on the first call and again if they drop.
+func NewRemote(auth auth.AuthKeeper, dialBus func() (*godbus.Conn, error)) (conn *Connection, err error) {
+	conn = new(Connection)
+	conn.auth = auth
+	conn.rchannel = make(chan string, 1)
+	conn.dbus = countingConnection{newReconnectingConnection(dialer(func() (*dbus.Conn, error) {
+		return dbus.NewConnection(dialBus)
+	}))}
+	return conn, nil
+}
+
+// NewHelper opens a connection to the system bus for the reading calls
+// and passes the calls which change units to the privileged helper at
+// socket, so that the server itself needs no rights to change units
+func NewHelper(ctx context.Context, auth auth.AuthKeeper, socket string) (conn *Connection, err error) {
+	conn, err = NewSystem(ctx, auth)
 	if err != nil {
 		return nil, err
 	}
-	return conn, err
+	conn.dbus = countingConnection{helperConnection{
+		DbusConnection: conn.dbus.(countingConnection).DbusConnection,
+		helper:         &privsep.Client{Socket: socket},
+	}}
+	return conn, nil
+}
+
+// Session returns a connection which shares the bus of conn but has its
+// own channel for the results of jobs, so that a session only waits for
+// the jobs it started. It isn't closed, the bus is closed with conn.
+func (conn *Connection) Session() *Connection {
+	s := *conn
+	s.rchannel = make(chan string, 1)
+	return &s
 }
 
 // close the connection
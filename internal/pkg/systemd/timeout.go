@@ -0,0 +1,46 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCallTimeout bounds a single call to the service manager
+const DefaultCallTimeout = 30 * time.Second
+
+// callTimeout is the --dbus-timeout, 0 for none
+var callTimeout atomic.Int64
+
+var errCallTimeout = errors.New("dbus call timed out")
+
+func init() {
+	callTimeout.Store(int64(DefaultCallTimeout))
+}
+
+// SetCallTimeout ends every call to the service manager which didn't return
+// after d, so that a hung bus doesn't stall the tool call. 0 doesn't limit
+// the calls.
+func SetCallTimeout(d time.Duration) {
+	callTimeout.Store(int64(max(d, 0)))
+}
+
+// withCallTimeout returns the context of a single dbus call
+func withCallTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	d := time.Duration(callTimeout.Load())
+	if d == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, d, errCallTimeout)
+}
+
+// timedOut returns the error of method, replaced by a timeout error if
+// the call was ended by the call timeout and not by the caller
+func timedOut(ctx context.Context, method string, err error) error {
+	if err != nil && context.Cause(ctx) == errCallTimeout {
+		return fmt.Errorf("the dbus call %s didn't finish within %s", method, time.Duration(callTimeout.Load()))
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package systemd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hungBus doesn't answer until the call is ended
+type hungBus struct {
+	DbusConnection
+}
+
+func (hungBus) ListJobsContext(ctx context.Context) ([]dbus.JobStatus, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCallTimeout(t *testing.T) {
+	defer SetCallTimeout(DefaultCallTimeout)
+	SetCallTimeout(10 * time.Millisecond)
+	conn := countingConnection{hungBus{}}
+
+	_, err := conn.ListJobsContext(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, "the dbus call ListJobs didn't finish within 10ms", err.Error())
+
+	// a call ended by the caller keeps its error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = conn.ListJobsContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,92 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// exactUnitNames returns the patterns as unit names if none of them is a
+// glob, names without a type are services like for systemctl
+func exactUnitNames(patterns []string) ([]string, bool) {
+	if len(patterns) == 0 {
+		return nil, false
+	}
+	names := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if pattern == "" || strings.ContainsAny(pattern, `*?[\`) {
+			return nil, false
+		}
+		if !slices.Contains(unitSuffixes, path.Ext(pattern)) {
+			pattern += ".service"
+		}
+		names[i] = pattern
+	}
+	return names, true
+}
+
+// unitInState reports whether the load, active or sub state of the unit is
+// state, like the state filter of ListUnitsByPatterns
+func unitInState(u dbus.UnitStatus, state string) bool {
+	return u.LoadState == state || u.ActiveState == state || u.SubState == state
+}
+
+// listUnits returns the units of list_loaded_units. Exact names are looked
+// up with ListUnitsByNames, which returns the units which aren't loaded
+// too, so that a stopped unit shows its state instead of missing in the
+// list. They are only filtered by an explicit state.
+func (conn *Connection) listUnits(ctx context.Context, states []string, params *ListLoadedUnitsParams) ([]dbus.UnitStatus, error) {
+	names, ok := exactUnitNames(params.Patterns)
+	if !ok {
+		return conn.dbus.ListUnitsByPatternsContext(ctx, states, params.Patterns)
+	}
+	byName, err := conn.dbus.ListUnitsByNamesContext(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	if params.State == "" || params.State == "all" {
+		return byName, nil
+	}
+	var units []dbus.UnitStatus
+	for _, u := range byName {
+		if unitInState(u, params.State) {
+			units = append(units, u)
+		}
+	}
+	return units, nil
+}
+
+// UnitPage follows the units of a list which doesn't fit into one call
+type UnitPage struct {
+	Total      int `json:"total"`
+	Offset     int `json:"offset"`
+	Returned   int `json:"returned"`
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// pageUnits sorts the units by name and returns the units of the page, the
+// page is nil if all units are returned
+func pageUnits(units []dbus.UnitStatus, offset, limit int) ([]dbus.UnitStatus, *UnitPage, error) {
+	if offset < 0 || limit < 0 {
+		return nil, nil, fmt.Errorf("offset and limit must not be negative")
+	}
+	if limit == 0 {
+		limit = DefaultUnitLimit
+	}
+	slices.SortFunc(units, func(a, b dbus.UnitStatus) int { return strings.Compare(a.Name, b.Name) })
+	if offset == 0 && len(units) <= limit {
+		return units, nil, nil
+	}
+	page := &UnitPage{Total: len(units), Offset: offset}
+	units = units[min(offset, len(units)):]
+	if len(units) > limit {
+		units = units[:limit]
+		page.NextOffset = offset + limit
+	}
+	page.Returned = len(units)
+	return units, page, nil
+}
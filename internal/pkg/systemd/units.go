@@ -8,11 +8,13 @@ import (
 	"path"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/progress"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/util"
 )
 
@@ -64,12 +66,18 @@ type UnitProperties struct {
 
 type ListLoadedUnitsParams struct {
 	State              string   `json:"state,omitempty" jsonschema:"List units in this active/load state (e.g. 'active', 'failed'). Defaults to 'active'. Use 'all' to list all states. Note: SubStates like 'running', 'dead', 'mounted', 'plugged' are not supported - use the corresponding parent ActiveState instead (e.g., 'active' for running units, 'inactive' for dead units)."`
-	Patterns           []string `json:"patterns,omitempty" jsonschema:"List units by their names or patterns (e.g. '*.service')."`
+	Patterns           []string `json:"patterns,omitempty" jsonschema:"List units by their names or patterns (e.g. '*.service'). If no pattern has glob characters, the units are looked up by name and returned in all states unless state is set, also if they aren't loaded."`
 	Properties         bool     `json:"properties,omitempty" jsonschema:"If true, return detailed properties for each unit."`
 	IncludeDescription bool     `json:"include_description,omitempty" jsonschema:"If true, include the description for each unit."`
 	Verbose            bool     `json:"verbose,omitempty" jsonschema:"Return more details in the response."`
+	Limit              int      `json:"limit,omitempty" jsonschema:"Maximum number of units to return, sorted by name (default 1000)."`
+	Offset             int      `json:"offset,omitempty" jsonschema:"Number of units to skip for pagination, pass next_offset of the previous call."`
 }
 
+// DefaultUnitLimit is the number of units list_loaded_units returns if no
+// limit is given
+const DefaultUnitLimit = 1000
+
 func CreateListLoadedUnitsSchema() *jsonschema.Schema {
 	inputSchema, _ := jsonschema.For[ListLoadedUnitsParams](nil)
 	var states []any
@@ -81,12 +89,76 @@ func CreateListLoadedUnitsSchema() *jsonschema.Schema {
 		inputSchema.Properties["state"].Enum = states
 		inputSchema.Properties["state"].Default = json.RawMessage("\"active\"")
 	}
+	inputSchema.Properties["limit"].Default = json.RawMessage(fmt.Sprint(DefaultUnitLimit))
 
 	return inputSchema
 }
 
+// propertyWorkers is the number of units whose properties are read at once
+const propertyWorkers = 8
+
+// unitProperties reads the properties of the units with at most
+// propertyWorkers dbus calls at once instead of one round trip after the
+// other. The properties of a unit are nil if they couldn't be read. report
+// is called for every finished unit from the calling goroutine. Empty
+// properties are dropped, the maps are shared with the cache and must not
+// be changed.
+func (conn *Connection) unitProperties(ctx context.Context, names []string, report func(done int, name string)) ([]map[string]interface{}, error) {
+	results := make([]map[string]interface{}, len(names))
+	indexes := make(chan int)
+	finished := make(chan int)
+	var wg sync.WaitGroup
+	for range min(propertyWorkers, len(names)) {
+		wg.Go(func() {
+			for i := range indexes {
+				props, version := conn.props.get(names[i])
+				if props == nil {
+					var err error
+					props, err = conn.dbus.GetAllPropertiesContext(ctx, names[i])
+					if err != nil {
+						slog.WarnContext(ctx, "failed to get properties for unit", "unit", names[i], "error", err)
+						finished <- i
+						continue
+					}
+					props = util.ClearMap(props)
+					conn.props.put(names[i], version, props)
+				}
+				results[i] = props
+				finished <- i
+			}
+		})
+	}
+	go func() {
+		defer close(indexes)
+		for i := range names {
+			// a cancelled call doesn't start further reads
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	done := 0
+	for i := range finished {
+		done++
+		report(done, names[i])
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRequest, params *ListLoadedUnitsParams) (*mcp.CallToolResult, any, error) {
-	slog.Debug("ListLoadedUnits called", "params", params)
+	slog.DebugContext(ctx, "ListLoadedUnits called", "params", params)
 	if allowed, err := conn.auth.IsReadAuthorized(ctx); err != nil {
 		return nil, nil, err
 	} else if !allowed {
@@ -105,7 +177,12 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 		reqStates = []string{"active"}
 	}
 
-	units, err := conn.dbus.ListUnitsByPatternsContext(ctx, reqStates, params.Patterns)
+	units, err := conn.listUnits(ctx, reqStates, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	// only the properties of the page are read
+	units, page, err := pageUnits(units, params.Offset, params.Limit)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -113,13 +190,22 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 	txtContentList := []mcp.Content{}
 
 	if params.Properties {
-		for _, u := range units {
-			props, err := conn.dbus.GetAllPropertiesContext(ctx, u.Name)
-			if err != nil {
-				slog.Warn("failed to get properties for unit", "unit", u.Name, "error", err)
+		reporter := progress.New(req, float64(len(units)))
+		names := make([]string, len(units))
+		for i, u := range units {
+			names[i] = u.Name
+		}
+		allProps, err := conn.unitProperties(ctx, names, func(done int, name string) {
+			reporter.Report(ctx, float64(done), name)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, u := range units {
+			props := allProps[i]
+			if props == nil {
 				continue
 			}
-			props = util.ClearMap(props)
 
 			var jsonByte []byte
 			if params.Verbose {
@@ -128,7 +214,7 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 				prop := UnitProperties{}
 				tmp, _ := json.Marshal(props)
 				if err := json.Unmarshal(tmp, &prop); err != nil {
-					slog.Warn("failed to unmarshal properties", "unit", u.Name, "error", err)
+					slog.WarnContext(ctx, "failed to unmarshal properties", "unit", u.Name, "error", err)
 					continue
 				}
 				jsonByte, err = json.Marshal(&prop)
@@ -182,9 +268,13 @@ func (conn *Connection) ListLoadedUnits(ctx context.Context, req *mcp.CallToolRe
 	}
 
 	if len(txtContentList) == 0 {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "[]"}},
-		}, nil, nil
+		txtContentList = append(txtContentList, &mcp.TextContent{Text: "[]"})
+	}
+	if page != nil {
+		jsonByte, _ := json.Marshal(page)
+		txtContentList = append(txtContentList, &mcp.TextContent{
+			Text: string(jsonByte),
+		})
 	}
 
 	return &mcp.CallToolResult{
@@ -214,7 +304,7 @@ func CreateListUnitFilesSchema() *jsonschema.Schema {
 }
 
 func (conn *Connection) ListUnitFiles(ctx context.Context, req *mcp.CallToolRequest, params *ListUnitFilesParams) (*mcp.CallToolResult, any, error) {
-	slog.Debug("ListUnitFiles called", "params", params)
+	slog.DebugContext(ctx, "ListUnitFiles called", "params", params)
 	if allowed, err := conn.auth.IsReadAuthorized(ctx); err != nil {
 		return nil, nil, err
 	} else if !allowed {
@@ -335,11 +425,36 @@ func (conn *Connection) ListStatesHandler(ctx context.Context) (lst []string, er
 	return
 }
 
+// UnitFiles are the files a unit was loaded from
+type UnitFiles struct {
+	Fragment string
+	DropIns  []string
+}
+
+// UnitFiles returns the unit file and the drop-ins of a loaded unit. The
+// authorization isn't checked, the callers check it before they read the
+// files.
+func (conn *Connection) UnitFiles(ctx context.Context, name string) (*UnitFiles, error) {
+	props, err := conn.dbus.GetAllPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if state, _ := props["LoadState"].(string); state == "not-found" {
+		return nil, fmt.Errorf("unit %s not found", name)
+	}
+	files := &UnitFiles{}
+	files.Fragment, _ = props["FragmentPath"].(string)
+	files.DropIns, _ = props["DropInPaths"].([]string)
+	return files, nil
+}
+
 type RestartReloadParams struct {
 	Name         string `json:"name" jsonschema:"Exact name of unit to restart"`
 	TimeOut      uint   `json:"timeout,omitempty" jsonschema:"Time to wait for the restart or reload to finish. After the timeout the function will return and restart and reload will run in the background and the result can be retreived with a separate function."`
 	Mode         string `json:"mode,omitempty" jsonschema:"Mode used for the restart or reload. 'replace' should be used."`
 	Forcerestart bool   `json:"forcerestart,omitempty" jsonschema:"mode of the operation. 'replace' should be used per default and replace allready queued jobs. With 'fail' the operation will fail if other operations are in progress."`
+	JobID        uint32 `json:"job_id,omitempty" jsonschema:"ID of the job returned by change_unit_state when it timed out. The job and the unit state are checked instead of waiting for a result."`
+	StartedAt    string `json:"started_at,omitempty" jsonschema:"Time the job was started, as returned by change_unit_state. Used to tell whether the unit changed its state since then."`
 }
 
 // return which are define in the upstream documentation as:
@@ -347,7 +462,9 @@ func ValidRestartModes() []string {
 	return []string{"replace", "fail", "isolate", "ignore-dependencies", "ignore-requirements"}
 }
 
-const MaxTimeOut uint = 60
+// MaxTimeOut is the longest time a call waits for a job, slow units like
+// databases may need more than the default of 30s
+const MaxTimeOut uint = 600
 
 func GetRestsartReloadParamsSchema() (*jsonschema.Schema, error) {
 	schema, err := jsonschema.For[RestartReloadParams](nil)
@@ -368,15 +485,40 @@ type CheckReloadRestartParams struct {
 
 // check status of reload or restart
 func (conn *Connection) CheckForRestartReloadRunning(ctx context.Context, req *mcp.CallToolRequest, params *RestartReloadParams) (res *mcp.CallToolResult, _ any, err error) {
-	slog.Debug("CheckForRestartReloadRunning called", "params", params)
+	slog.DebugContext(ctx, "CheckForRestartReloadRunning called", "params", params)
 
-	allowed, err := conn.auth.IsWriteAuthorized(ctx)
+	allowed, err := conn.auth.IsWriteAuthorized(dbus.WithDetails(ctx, dbus.ActionManageUnits, map[string]string{"unit": params.Name, "operation": "check_restart_reload"}))
 	if err != nil {
 		return nil, nil, err
 	}
 	if !allowed {
 		return nil, nil, fmt.Errorf("calling method was canceled by user")
 	}
+	if params.JobID != 0 || params.Name != "" {
+		return conn.checkJob(ctx, req, params)
+	}
+	if params.TimeOut == 0 {
+		select {
+		case result := <-conn.rchannel:
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{
+						Text: result,
+					},
+				},
+			}, nil, nil
+		default:
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{
+						Text: "Finished",
+					},
+				},
+			}, nil, nil
+		}
+	}
+	timer := time.NewTimer(time.Duration(params.TimeOut) * time.Second)
+	defer timer.Stop()
 	select {
 	case result := <-conn.rchannel:
 		return &mcp.CallToolResult{
@@ -386,22 +528,16 @@ func (conn *Connection) CheckForRestartReloadRunning(ctx context.Context, req *m
 				},
 			},
 		}, nil, nil
-	case <-time.After(3 * time.Second):
+	case <-timer.C:
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{
-					Text: "Reload or restart still in progress.",
-				},
-			},
-		}, nil, nil
-	default:
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{
-					Text: "Finished",
+					Text: fmt.Sprintf("Job still in progress after %ds. Call again with a longer timeout, the default job timeouts of the manager are shown by system_status.", params.TimeOut),
 				},
 			},
 		}, nil, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
 	}
 }
 
@@ -409,7 +545,7 @@ type ChangeUnitStateParams struct {
 	Name    string `json:"name" jsonschema:"Exact name of unit to change state"`
 	Action  string `json:"action" jsonschema:"Action to perform."`
 	Mode    string `json:"mode,omitempty" jsonschema:"Mode when restarting a unit. Defaults to 'replace'."`
-	TimeOut uint   `json:"timeout,omitempty" jsonschema:"Time to wait for the operation to finish. Max 60s."`
+	TimeOut uint   `json:"timeout,omitempty" jsonschema:"Time in seconds to wait for the job to finish. Defaults to 30s, slow units like databases can set up to their start or stop timeout (see system_status for the defaults of the manager). Max 600s."`
 	Runtime bool   `json:"runtime,omitempty" jsonschema:"Enable/Disable only temporarily (runtime)."`
 }
 
@@ -440,18 +576,21 @@ func CreateChangeInputSchema() *jsonschema.Schema {
 }
 
 func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRequest, params *ChangeUnitStateParams) (res *mcp.CallToolResult, _ any, err error) {
-	slog.Debug("ChangeUnitState called", "params", params)
+	slog.DebugContext(ctx, "ChangeUnitState called", "params", params)
+	if err := CheckUnit(ctx, params.Name); err != nil {
+		return nil, nil, err
+	}
 
 	var permission string
 	if params.Action == "enable" || params.Action == "enable_force" || params.Action == "disable" {
-		permission = "org.freedesktop.systemd1.manage-unit-files"
+		permission = dbus.ActionManageUnitFiles
 	} else {
-		permission = "org.freedesktop.systemd1.manage-units"
+		permission = dbus.ActionManageUnits
 	}
 
-	allowed, err := conn.auth.IsWriteAuthorized(context.WithValue(ctx, dbus.PermissionKey, permission))
+	allowed, err := conn.auth.IsWriteAuthorized(dbus.WithDetails(ctx, permission, map[string]string{"unit": params.Name, "operation": params.Action}))
 	if !allowed || err != nil {
-		slog.Debug("ChangeUnit wasn't authorized", "reason", err)
+		slog.DebugContext(ctx, "ChangeUnit wasn't authorized", "reason", err)
 		return nil, nil, fmt.Errorf("calling method wasn't authorized: %s", err)
 	}
 	defer conn.auth.Deauthorize()
@@ -459,7 +598,12 @@ func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRe
 	if params.TimeOut > MaxTimeOut {
 		return nil, nil, fmt.Errorf("not waiting longer than MaxTimeOut(%d), longer operation will run in the background and result can be gathered with separate function.", MaxTimeOut)
 	}
+	if err := conn.confirm(ctx, req, params.Action, params.Name); err != nil {
+		return nil, nil, err
+	}
 
+	var jobID int
+	startedAt := time.Now()
 	switch params.Action {
 	case "start":
 		if params.Mode == "" {
@@ -468,21 +612,23 @@ func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRe
 		if !slices.Contains(ValidRestartModes(), params.Mode) {
 			return nil, nil, fmt.Errorf("invalid mode for start: %s", params.Mode)
 		}
-		_, err = conn.dbus.StartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.StartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "stop":
-		_, err = conn.dbus.StopUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.StopUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "stop_kill":
 		conn.dbus.KillUnitContext(ctx, params.Name, int32(9))
 	case "restart_force":
-		_, err = conn.dbus.RestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.RestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "restart":
-		_, err = conn.dbus.ReloadOrRestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.ReloadOrRestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "reload":
-		_, err = conn.dbus.ReloadOrRestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
+		jobID, err = conn.dbus.ReloadOrRestartUnitContext(ctx, params.Name, params.Mode, conn.rchannel)
 	case "enable", "enable_force":
 		_, enabledRes, err := conn.dbus.EnableUnitFilesContext(ctx, []string{params.Name}, params.Runtime, strings.HasSuffix(params.Action, "_force"))
+		// systemd doesn't signal the changed unit file state
+		conn.props.invalidate(params.Name)
 		if err != nil {
-			slog.Error("error when enabling", "dbus.error", err)
+			slog.ErrorContext(ctx, "error when enabling", "dbus.error", err)
 			return nil, nil, fmt.Errorf("error when enabling: %w", err)
 		}
 		if len(enabledRes) == 0 {
@@ -505,6 +651,7 @@ func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRe
 		return &mcp.CallToolResult{Content: txtContentList}, nil, nil
 	case "disable":
 		disabledRes, err := conn.dbus.DisableUnitFilesContext(ctx, []string{params.Name}, params.Runtime)
+		conn.props.invalidate(params.Name)
 		if err != nil {
 			return nil, nil, fmt.Errorf("error when disabling: %w", err)
 		}
@@ -534,7 +681,15 @@ func (conn *Connection) ChangeUnitState(ctx context.Context, req *mcp.CallToolRe
 		return nil, nil, err
 	}
 
-	return conn.CheckForRestartReloadRunning(ctx, req, &RestartReloadParams{
-		TimeOut: params.TimeOut,
+	if params.Action == "stop_kill" {
+		return conn.CheckForRestartReloadRunning(ctx, req, &RestartReloadParams{
+			TimeOut: params.TimeOut,
+		})
+	}
+	return conn.waitForJob(ctx, req, &RestartReloadParams{
+		Name:      params.Name,
+		TimeOut:   params.TimeOut,
+		JobID:     uint32(jobID),
+		StartedAt: startedAt.Format(time.RFC3339Nano),
 	})
 }
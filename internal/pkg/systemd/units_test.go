@@ -2,13 +2,17 @@ package systemd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-systemd/v22/dbus"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	auth_pkg "github.com/openSUSE/systemd-mcp/authkeeper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockDbusConnection struct {
@@ -16,8 +20,10 @@ type mockDbusConnection struct {
 	listUnits           func() ([]dbus.UnitStatus, error)
 	listUnitsFiltered   func(states []string) ([]dbus.UnitStatus, error)
 	listUnitsByPatterns func(patterns []string, states []string) ([]dbus.UnitStatus, error)
+	listUnitsByNames    func(names []string) ([]dbus.UnitStatus, error)
 	listUnitFiles       func() ([]dbus.UnitFile, error)
 	getAllProperties    func(unitName string) (map[string]interface{}, error)
+	getTypeProperties   func(unitName string, unitType string) (map[string]interface{}, error)
 	startUnit           func(name string, mode string) (int, error)
 	stopUnit            func(name string, mode string) (int, error)
 	restartUnit         func(name string, mode string) (int, error)
@@ -25,6 +31,30 @@ type mockDbusConnection struct {
 	killUnit            func(name string, signal int32)
 	enableUnitFiles     func(files []string, runtime bool, force bool) (bool, []dbus.EnableUnitFileChange, error)
 	disableUnitFiles    func(files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
+	managerProperties   map[string]string
+	listJobs            func() ([]dbus.JobStatus, error)
+	reload              func() error
+}
+
+func (m *mockDbusConnection) ReloadContext(ctx context.Context) error {
+	if m.reload != nil {
+		return m.reload()
+	}
+	return nil
+}
+
+func (m *mockDbusConnection) ListJobsContext(ctx context.Context) ([]dbus.JobStatus, error) {
+	if m.listJobs != nil {
+		return m.listJobs()
+	}
+	return nil, nil
+}
+
+func (m *mockDbusConnection) GetManagerProperty(prop string) (string, error) {
+	if val, ok := m.managerProperties[prop]; ok {
+		return val, nil
+	}
+	return "", fmt.Errorf("unknown property %s", prop)
 }
 
 func (m *mockDbusConnection) ListUnitsContext(ctx context.Context) ([]dbus.UnitStatus, error) {
@@ -39,6 +69,13 @@ func (m *mockDbusConnection) ListUnitsByPatternsContext(ctx context.Context, sta
 	return m.listUnitsByPatterns(patterns, states)
 }
 
+func (m *mockDbusConnection) ListUnitsByNamesContext(ctx context.Context, names []string) ([]dbus.UnitStatus, error) {
+	if m.listUnitsByNames != nil {
+		return m.listUnitsByNames(names)
+	}
+	return m.listUnitsByPatterns(names, nil)
+}
+
 func (m *mockDbusConnection) ListUnitFilesContext(ctx context.Context) ([]dbus.UnitFile, error) {
 	if m.listUnitFiles != nil {
 		return m.listUnitFiles()
@@ -50,6 +87,10 @@ func (m *mockDbusConnection) GetAllPropertiesContext(ctx context.Context, unitNa
 	return m.getAllProperties(unitName)
 }
 
+func (m *mockDbusConnection) GetUnitTypePropertiesContext(ctx context.Context, unitName string, unitType string) (map[string]interface{}, error) {
+	return m.getTypeProperties(unitName, unitType)
+}
+
 func (m *mockDbusConnection) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
 	if m.startUnit != nil {
 		return m.startUnit(name, mode)
@@ -214,6 +255,42 @@ func TestListLoadedUnits(t *testing.T) {
 	}
 }
 
+func TestListLoadedUnitsByName(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	var byName []string
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByNames: func(names []string) ([]dbus.UnitStatus, error) {
+				byName = names
+				return []dbus.UnitStatus{
+					{Name: "cups.service", LoadState: "not-found", ActiveState: "inactive", SubState: "dead"},
+					{Name: "sshd.service", LoadState: "loaded", ActiveState: "active", SubState: "running"},
+				}, nil
+			},
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return nil, fmt.Errorf("patterns must not be used for names")
+			},
+		},
+		auth: auth,
+	}
+	res, _, err := conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Patterns: []string{"cups", "sshd.service"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cups.service", "sshd.service"}, byName)
+	require.Len(t, res.Content, 2)
+	assert.JSONEq(t, `{"state":"inactive","units":["cups.service"]}`, res.Content[1].(*mcp.TextContent).Text, "a unit which isn't loaded is returned in all states")
+
+	res, _, err = conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Patterns: []string{"cups", "sshd.service"}, State: "inactive"})
+	require.NoError(t, err)
+	require.Len(t, res.Content, 1)
+	assert.JSONEq(t, `{"state":"inactive","units":["cups.service"]}`, res.Content[0].(*mcp.TextContent).Text)
+
+	names, ok := exactUnitNames([]string{"sshd.service", "*.socket"})
+	assert.False(t, ok)
+	assert.Nil(t, names)
+	_, ok = exactUnitNames(nil)
+	assert.False(t, ok)
+}
+
 func TestListUnitFiles(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -403,3 +480,241 @@ func TestChangeUnitState(t *testing.T) {
 		})
 	}
 }
+
+func TestUnitsStartedSince(t *testing.T) {
+	now := time.Now()
+	enter := map[string]time.Time{
+		"old.service":    now.Add(-2 * time.Hour),
+		"new.service":    now.Add(-10 * time.Minute),
+		"newest.socket":  now.Add(-time.Minute),
+		"missing.target": {},
+	}
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				assert.Equal(t, []string{"active"}, states)
+				return []dbus.UnitStatus{{Name: "old.service"}, {Name: "new.service"}, {Name: "newest.socket"}, {Name: "missing.target"}}, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				props := map[string]interface{}{"MainPID": uint32(42)}
+				if !enter[unitName].IsZero() {
+					props["ActiveEnterTimestamp"] = uint64(enter[unitName].UnixMicro())
+				}
+				return props, nil
+			},
+		},
+	}
+	units, err := conn.UnitsStartedSince(context.Background(), now.Add(-time.Hour))
+	assert.NoError(t, err)
+	if assert.Len(t, units, 2) {
+		assert.Equal(t, "newest.socket", units[0].Name)
+		assert.Zero(t, units[0].MainPID)
+		assert.Equal(t, "new.service", units[1].Name)
+		assert.Equal(t, uint32(42), units[1].MainPID)
+	}
+}
+
+func TestChangeUnitStateTimeout(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{
+		dbus:     &mockDbusConnection{},
+		auth:     auth,
+		rchannel: make(chan string, 1),
+	}
+
+	res, _, err := conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "db.service", Action: "start", TimeOut: 1})
+	assert.NoError(t, err)
+	var pending JobPending
+	assert.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &pending))
+	assert.Equal(t, "in_progress", pending.Status)
+	assert.Equal(t, "db.service", pending.Check.Name)
+	assert.NotEmpty(t, pending.Check.StartedAt)
+
+	conn.rchannel <- "done"
+	res, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "db.service", Action: "start", TimeOut: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "done", res.Content[0].(*mcp.TextContent).Text)
+
+	_, _, err = conn.ChangeUnitState(context.Background(), nil, &ChangeUnitStateParams{Name: "db.service", Action: "start", TimeOut: MaxTimeOut + 1})
+	assert.Error(t, err)
+}
+
+func TestCheckJob(t *testing.T) {
+	oldInterval := jobPollInterval
+	defer func() { jobPollInterval = oldInterval }()
+	jobPollInterval = 10 * time.Millisecond
+
+	startedAt := time.Now()
+	polls := 0
+	mock := &mockDbusConnection{
+		listJobs: func() ([]dbus.JobStatus, error) {
+			polls++
+			if polls < 3 {
+				return []dbus.JobStatus{{Id: 42, Unit: "db.service", JobType: "start", Status: "running"}}, nil
+			}
+			return nil, nil
+		},
+		getAllProperties: func(unitName string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"ActiveState":          "active",
+				"SubState":             "running",
+				"Result":               "success",
+				"StateChangeTimestamp": uint64(startedAt.Add(time.Second).UnixMicro()),
+			}, nil
+		},
+	}
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	conn := &Connection{dbus: mock, auth: auth, rchannel: make(chan string, 1)}
+	check := &RestartReloadParams{Name: "db.service", JobID: 42, StartedAt: startedAt.Format(time.RFC3339Nano)}
+
+	getState := func(t *testing.T) JobState {
+		res, _, err := conn.CheckForRestartReloadRunning(context.Background(), nil, check)
+		assert.NoError(t, err)
+		var state JobState
+		assert.NoError(t, json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &state))
+		return state
+	}
+
+	state := getState(t)
+	assert.True(t, state.JobRunning)
+	assert.Equal(t, "start", state.JobType)
+
+	check.TimeOut = 1
+	conn.rchannel <- "done"
+	state = getState(t)
+	assert.False(t, state.JobRunning)
+	assert.Equal(t, "active", state.ActiveState)
+	assert.Equal(t, "success", state.Result)
+	if assert.NotNil(t, state.ChangedSinceStart) {
+		assert.True(t, *state.ChangedSinceStart)
+	}
+	assert.Len(t, conn.rchannel, 0)
+
+	_, _, err := conn.CheckForRestartReloadRunning(context.Background(), nil, &RestartReloadParams{JobID: 7})
+	assert.Error(t, err)
+}
+
+func TestUnitFiles(t *testing.T) {
+	mock := &mockDbusConnection{
+		getAllProperties: func(unitName string) (map[string]interface{}, error) {
+			if unitName == "missing.service" {
+				return map[string]interface{}{"LoadState": "not-found"}, nil
+			}
+			return map[string]interface{}{
+				"LoadState":    "loaded",
+				"FragmentPath": "/usr/lib/systemd/system/db.service",
+				"DropInPaths":  []string{"/etc/systemd/system/db.service.d/override.conf"},
+			}, nil
+		},
+	}
+	conn := &Connection{dbus: mock}
+	files, err := conn.UnitFiles(context.Background(), "db.service")
+	assert.NoError(t, err)
+	assert.Equal(t, &UnitFiles{Fragment: "/usr/lib/systemd/system/db.service", DropIns: []string{"/etc/systemd/system/db.service.d/override.conf"}}, files)
+
+	_, err = conn.UnitFiles(context.Background(), "missing.service")
+	assert.Error(t, err)
+}
+
+func TestListLoadedUnitsCancelled(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	var units []dbus.UnitStatus
+	for i := range 100 {
+		units = append(units, dbus.UnitStatus{Name: fmt.Sprintf("unit%d.service", i)})
+	}
+	var read atomic.Int32
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return units, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				read.Add(1)
+				cancel()
+				return map[string]interface{}{"Id": unitName}, nil
+			},
+		},
+		auth: auth,
+	}
+	_, _, err := conn.ListLoadedUnits(ctx, nil, &ListLoadedUnitsParams{Properties: true})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.LessOrEqual(t, int(read.Load()), propertyWorkers, "only the reads which already started finish after the cancellation")
+}
+
+func TestListLoadedUnitsConcurrent(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	var units []dbus.UnitStatus
+	for i := range 50 {
+		units = append(units, dbus.UnitStatus{Name: fmt.Sprintf("unit%02d.service", i)})
+	}
+	var running, peak atomic.Int32
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return units, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				if unitName == "unit07.service" {
+					return nil, fmt.Errorf("unit vanished")
+				}
+				return map[string]interface{}{"Id": unitName, "Description": "test"}, nil
+			},
+		},
+		auth: auth,
+	}
+	res, _, err := conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Properties: true})
+	assert.NoError(t, err)
+	assert.Len(t, res.Content, 49, "the unit whose properties failed is left out")
+	assert.Contains(t, res.Content[0].(*mcp.TextContent).Text, "unit00.service")
+	assert.Contains(t, res.Content[48].(*mcp.TextContent).Text, "unit49.service", "the order of the units is kept")
+	assert.Greater(t, int(peak.Load()), 1)
+	assert.LessOrEqual(t, int(peak.Load()), propertyWorkers)
+}
+
+func TestListLoadedUnitsPage(t *testing.T) {
+	auth, _ := auth_pkg.NewNoAuth(true, true)
+	var read []string
+	conn := &Connection{
+		dbus: &mockDbusConnection{
+			listUnitsByPatterns: func(patterns []string, states []string) ([]dbus.UnitStatus, error) {
+				return []dbus.UnitStatus{
+					{Name: "c.service", ActiveState: "active"},
+					{Name: "a.service", ActiveState: "active"},
+					{Name: "b.service", ActiveState: "active"},
+				}, nil
+			},
+			getAllProperties: func(unitName string) (map[string]interface{}, error) {
+				read = append(read, unitName)
+				return map[string]interface{}{"Id": unitName}, nil
+			},
+		},
+		auth: auth,
+	}
+	res, _, err := conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, res.Content, 2)
+	assert.JSONEq(t, `{"state":"active","units":["a.service","b.service"]}`, res.Content[0].(*mcp.TextContent).Text)
+	assert.JSONEq(t, `{"total":3,"offset":0,"returned":2,"next_offset":2}`, res.Content[1].(*mcp.TextContent).Text)
+
+	res, _, err = conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Limit: 2, Offset: 2, Properties: true})
+	require.NoError(t, err)
+	require.Len(t, res.Content, 2)
+	assert.Equal(t, []string{"c.service"}, read, "only the properties of the page are read")
+	assert.JSONEq(t, `{"total":3,"offset":2,"returned":1}`, res.Content[1].(*mcp.TextContent).Text)
+
+	res, _, err = conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{})
+	require.NoError(t, err)
+	assert.Len(t, res.Content, 1, "a list which fits has no page")
+	_, _, err = conn.ListLoadedUnits(context.Background(), nil, &ListLoadedUnitsParams{Offset: -1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,393 @@
+// Package tracing records spans of the tool calls, the dbus calls and the
+// journal reads and exports them with OTLP over HTTP in the JSON encoding,
+// so that the latency of a call can be broken down in an existing
+// observability stack. Without an exporter spans are nil and cost nothing.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/requestid"
+)
+
+const (
+	// maxQueue spans are kept until the next export, further ones are
+	// dropped
+	maxQueue      = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+)
+
+// span kinds of OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+var exporter atomic.Pointer[Exporter]
+
+// Span is a timed operation of a trace
+type Span struct {
+	traceID [16]byte
+	spanID  [8]byte
+	parent  [8]byte
+	name    string
+	kind    int
+	start   time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs map[string]any
+	err   string
+}
+
+type spanKey struct{}
+
+// Enabled reports whether spans are exported
+func Enabled() bool {
+	return exporter.Load() != nil
+}
+
+// Start starts a span as child of the span of the context, it returns nil
+// if tracing is disabled
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	e := exporter.Load()
+	if e == nil {
+		return ctx, nil
+	}
+	s := &Span{name: name, kind: kind, start: time.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		s.traceID, s.parent = parent.traceID, parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// StartRemote starts a span whose parent is given by a W3C traceparent
+// header, e.g. of the HTTP request of a tool call
+func StartRemote(ctx context.Context, traceparent, name string, kind int) (context.Context, *Span) {
+	ctx, s := Start(ctx, name, kind)
+	if s == nil {
+		return ctx, s
+	}
+	// version-traceid-parentid-flags
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx, s
+	}
+	traceID, err1 := hex.DecodeString(parts[1])
+	parentID, err2 := hex.DecodeString(parts[2])
+	if err1 != nil || err2 != nil {
+		return ctx, s
+	}
+	copy(s.traceID[:], traceID)
+	copy(s.parent[:], parentID)
+	return ctx, s
+}
+
+// SetAttr adds an attribute, values are strings, bools or integers
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+}
+
+// End ends the span and marks it as failed if err isn't nil. Only the
+// first call counts, so End can also be deferred for the early returns.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+	if e := exporter.Load(); e != nil {
+		e.add(s)
+	}
+}
+
+// TraceID returns the id of the trace in hex
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// Middleware records a span for every tool call, its parent is given by
+// the traceparent header of the HTTP request if there is one
+func Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if method != "tools/call" || !ok || call.Params == nil || !Enabled() {
+			return next(ctx, method, req)
+		}
+		var traceparent string
+		if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+			traceparent = extra.Header.Get("traceparent")
+		}
+		ctx, span := StartRemote(ctx, traceparent, "tools/call "+call.Params.Name, KindServer)
+		span.SetAttr("mcp.tool.name", call.Params.Name)
+		if call.Session != nil {
+			span.SetAttr("mcp.session.id", call.Session.ID())
+		}
+		if id := requestid.FromContext(ctx); id != "" {
+			span.SetAttr("request_id", id)
+		}
+		res, err := next(ctx, method, req)
+		failure := err
+		if r, ok := res.(*mcp.CallToolResult); ok && r.IsError && failure == nil {
+			failure = fmt.Errorf("tool call failed")
+			for _, c := range r.Content {
+				if text, ok := c.(*mcp.TextContent); ok {
+					failure = fmt.Errorf("%s", text.Text)
+					break
+				}
+			}
+		}
+		span.End(failure)
+		return res, err
+	}
+}
+
+// Exporter sends the ended spans in batches to an OTLP collector
+type Exporter struct {
+	url     string
+	headers map[string]string
+	service string
+	version string
+	client  *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Setup exports the spans to the OTLP HTTP endpoint, e.g.
+// http://localhost:4318, until Shutdown is called
+func Setup(endpoint string, headers []string, service, version string) (*Exporter, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("invalid otlp endpoint %q, expected an http or https url", endpoint)
+	}
+	e := &Exporter{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		headers: make(map[string]string),
+		service: service,
+		version: version,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		flush:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, header := range headers {
+		key, value, ok := strings.Cut(header, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid otlp header %q, expected key=value", header)
+		}
+		e.headers[key] = value
+	}
+	go e.run()
+	exporter.Store(e)
+	return e, nil
+}
+
+func (e *Exporter) add(s *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueue {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, s)
+	if len(e.queue) >= batchSize {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.stop:
+			return
+		}
+		if err := e.export(context.Background()); err != nil {
+			slog.Debug("couldn't export spans", "url", e.url, "error", err)
+		}
+	}
+}
+
+// Shutdown stops the tracing and exports the remaining spans
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	exporter.CompareAndSwap(e, nil)
+	close(e.stop)
+	<-e.done
+	return e.export(ctx)
+}
+
+func (e *Exporter) export(ctx context.Context) error {
+	e.mu.Lock()
+	spans, dropped := e.queue, e.dropped
+	e.queue, e.dropped = nil, 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		slog.Warn("dropped spans, the collector doesn't keep up", "spans", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// the JSON encoding of ExportTraceServiceRequest
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID      string      `json:"traceId"`
+		SpanID       string      `json:"spanId"`
+		ParentSpanID string      `json:"parentSpanId,omitempty"`
+		Name         string      `json:"name"`
+		Kind         int         `json:"kind"`
+		Start        string      `json:"startTimeUnixNano"`
+		End          string      `json:"endTimeUnixNano"`
+		Attributes   []otlpAttr  `json:"attributes,omitempty"`
+		Status       *otlpStatus `json:"status,omitempty"`
+	}
+	otlpAttr struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// status code error of OTLP
+const statusError = 2
+
+func attr(key string, value any) otlpAttr {
+	switch v := value.(type) {
+	case bool:
+		return otlpAttr{key, map[string]any{"boolValue": v}}
+	case int:
+		return otlpAttr{key, map[string]any{"intValue": strconv.Itoa(v)}}
+	case int64:
+		return otlpAttr{key, map[string]any{"intValue": strconv.FormatInt(v, 10)}}
+	default:
+		return otlpAttr{key, map[string]any{"stringValue": fmt.Sprint(v)}}
+	}
+}
+
+func (e *Exporter) request(spans []*Span) *otlpRequest {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: e.service, Version: e.version}}
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID: hex.EncodeToString(s.traceID[:]),
+			SpanID:  hex.EncodeToString(s.spanID[:]),
+			Name:    s.name,
+			Kind:    s.kind,
+			Start:   strconv.FormatInt(s.start.UnixNano(), 10),
+			End:     strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for key, value := range s.attrs {
+			span.Attributes = append(span.Attributes, attr(key, value))
+		}
+		if s.err != "" {
+			span.Status = &otlpStatus{Code: statusError, Message: s.err}
+		}
+		s.mu.Unlock()
+		scope.Spans = append(scope.Spans, span)
+	}
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttr{
+			attr("service.name", e.service),
+			attr("service.version", e.version),
+		}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector records the spans of the exports
+func collector(t *testing.T) (*httptest.Server, *[]otlpSpan) {
+	var spans []otlpSpan
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var req otlpRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		for _, rs := range req.ResourceSpans {
+			assert.Contains(t, rs.Resource.Attributes, attr("service.name", "systemd-mcp"))
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &spans
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "unit", KindInternal)
+	assert.Nil(t, span)
+	assert.Equal(t, context.Background(), ctx)
+	span.SetAttr("key", "value")
+	span.End(nil)
+}
+
+func TestExport(t *testing.T) {
+	srv, spans := collector(t)
+	e, err := Setup(srv.URL, []string{"Authorization=Bearer secret"}, "systemd-mcp", "1.0")
+	require.NoError(t, err)
+
+	ctx, parent := StartRemote(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "tools/call list_log", KindServer)
+	_, child := Start(ctx, "dbus ListUnitsByPatterns", KindClient)
+	child.SetAttr("rpc.method", "ListUnitsByPatterns")
+	child.End(errors.New("unit not found"))
+	child.End(nil)
+	parent.End(nil)
+	require.NoError(t, e.Shutdown(context.Background()))
+	assert.False(t, Enabled())
+
+	require.Len(t, *spans, 2, "a span is only exported once")
+	dbus, call := (*spans)[0], (*spans)[1]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", call.TraceID, "the trace of the client is continued")
+	assert.Equal(t, "00f067aa0ba902b7", call.ParentSpanID)
+	assert.Equal(t, call.TraceID, dbus.TraceID)
+	assert.Equal(t, call.SpanID, dbus.ParentSpanID)
+	assert.Equal(t, KindClient, dbus.Kind)
+	assert.Equal(t, []otlpAttr{attr("rpc.method", "ListUnitsByPatterns")}, dbus.Attributes)
+	assert.Equal(t, &otlpStatus{Code: statusError, Message: "unit not found"}, dbus.Status)
+	assert.Nil(t, call.Status)
+}
+
+func TestMiddleware(t *testing.T) {
+	srv, spans := collector(t)
+	e, err := Setup(srv.URL, []string{"Authorization=Bearer secret"}, "systemd-mcp", "1.0")
+	require.NoError(t, err)
+	handler := Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		_, span := Start(ctx, "journal iteration", KindInternal)
+		span.End(nil)
+		return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "invalid unit"}}}, nil
+	})
+	_, err = handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log"}})
+	require.NoError(t, err)
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	require.Len(t, *spans, 2)
+	call := (*spans)[1]
+	assert.Equal(t, "tools/call list_log", call.Name)
+	assert.Equal(t, call.SpanID, (*spans)[0].ParentSpanID)
+	assert.Equal(t, "invalid unit", call.Status.Message)
+}
+
+func TestSetupInvalid(t *testing.T) {
+	_, err := Setup("localhost:4318", nil, "systemd-mcp", "1.0")
+	assert.Error(t, err)
+	_, err = Setup("http://localhost:4318", []string{"Authorization"}, "systemd-mcp", "1.0")
+	assert.Error(t, err)
+	assert.False(t, Enabled())
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ipFilter restricts the HTTP endpoints to the clients of the allowed
+// networks. Behind a trusted reverse proxy the client is taken from the
+// header the proxy sets.
+type ipFilter struct {
+	allowed []netip.Prefix
+	proxies []netip.Prefix
+	// header is the header with the client address set by the proxies,
+	// X-Forwarded-For or Forwarded
+	header string
+}
+
+// parsePrefixes parses networks in CIDR notation, a single address is a
+// network of its own
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q, expected an address or CIDR like 10.0.0.0/8", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// newIPFilter returns nil if neither networks nor proxies are given, which
+// disables the filter. Without networks every client is allowed and only
+// the address of the proxied clients is resolved.
+func newIPFilter(allowed, proxies []string, header string) (*ipFilter, error) {
+	f := &ipFilter{header: header}
+	var err error
+	if f.allowed, err = parsePrefixes(allowed); err != nil {
+		return nil, err
+	}
+	if f.proxies, err = parsePrefixes(proxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	if len(f.allowed) == 0 && len(f.proxies) == 0 {
+		return nil, nil
+	}
+	if f.header == "" {
+		f.header = "X-Forwarded-For"
+	}
+	return f, nil
+}
+
+func inPrefixes(prefixes []netip.Prefix, addr netip.Addr) bool {
+	return slices.ContainsFunc(prefixes, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// forwardedFor returns the addresses of the header, the client first and
+// the last proxy last
+func (f *ipFilter) forwardedFor(r *http.Request) []string {
+	var hops []string
+	for _, value := range r.Header.Values(f.header) {
+		for _, hop := range strings.Split(value, ",") {
+			hop = strings.TrimSpace(hop)
+			if strings.EqualFold(f.header, "Forwarded") {
+				// for=192.0.2.1;proto=https or for="[2001:db8::1]:4711"
+				hop, _ = forwardedParam(hop, "for")
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// forwardedParam returns the parameter of an element of a Forwarded
+// header without quotes, brackets and port
+func forwardedParam(element, key string) (string, bool) {
+	for _, pair := range strings.Split(element, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.EqualFold(k, key) {
+			continue
+		}
+		v = strings.Trim(v, `"`)
+		if host, _, err := net.SplitHostPort(v); err == nil {
+			v = host
+		}
+		return strings.Trim(v, "[]"), true
+	}
+	return "", false
+}
+
+// clientAddr returns the address of the client. A request of a trusted
+// proxy is attributed to the last address in the header which isn't a
+// trusted proxy itself, so that a client can't spoof its address by
+// sending the header. Requests on unix sockets have no address.
+func (f *ipFilter) clientAddr(r *http.Request) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(sourceIP(r))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !inPrefixes(f.proxies, addr) {
+		return addr, true
+	}
+	hops := f.forwardedFor(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// an unparsable hop can't be trusted, stop at the last proxy
+			break
+		}
+		addr = hop.Unmap()
+		if !inPrefixes(f.proxies, addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+type trustedProxyKey struct{}
+
+// fromTrustedProxy returns whether the request was sent by a trusted proxy,
+// whose other forwarding headers can be believed too
+func fromTrustedProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(trustedProxyKey{}).(bool)
+	return trusted
+}
+
+// middleware rejects the clients outside of the allowed networks with 403.
+// The remote address of proxied requests is replaced by the one of the
+// client, so that the rate limit and the lockout apply to the client.
+func (f *ipFilter) middleware(next http.Handler) http.Handler {
+	if f == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := f.clientAddr(r)
+		if !ok {
+			// unix sockets are restricted by their file permissions
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(f.allowed) > 0 && !inPrefixes(f.allowed, addr) {
+			slog.Warn("rejected request from outside the allowed networks", "audit", "ip_denied", "source", addr.String(), "remote_addr", r.RemoteAddr)
+			http.Error(w, "client address not allowed", http.StatusForbidden)
+			return
+		}
+		if peer, err := netip.ParseAddr(sourceIP(r)); err == nil && inPrefixes(f.proxies, peer.Unmap()) {
+			r = r.WithContext(context.WithValue(r.Context(), trustedProxyKey{}, true))
+		}
+		if addr.String() != sourceIP(r) {
+			r.RemoteAddr = net.JoinHostPort(addr.String(), "0")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIPFilter(t *testing.T) {
+	f, err := newIPFilter(nil, nil, "")
+	require.NoError(t, err)
+	assert.Nil(t, f)
+
+	f, err = newIPFilter([]string{"10.1.0.0/16", "192.0.2.7", "2001:db8::/32"}, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "X-Forwarded-For", f.header)
+	assert.Len(t, f.allowed, 3)
+
+	for _, invalid := range []string{"10.1.0.0/33", "mgmt", "10.1.0.0/"} {
+		_, err := newIPFilter([]string{invalid}, nil, "")
+		assert.Error(t, err, invalid)
+	}
+	_, err = newIPFilter(nil, []string{"proxy"}, "")
+	assert.Error(t, err)
+}
+
+func TestIPFilterMiddleware(t *testing.T) {
+	var source string
+	var proxied bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source = sourceIP(r)
+		proxied = fromTrustedProxy(r)
+	})
+	call := func(f *ipFilter, remote string, header map[string]string) int {
+		source, proxied = "", false
+		r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		r.RemoteAddr = remote
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		f.middleware(next).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	f, err := newIPFilter([]string{"10.1.0.0/16", "2001:db8::/32"}, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, call(f, "10.1.2.3:4711", nil))
+	assert.Equal(t, http.StatusOK, call(f, "[2001:db8::1]:4711", nil))
+	assert.Equal(t, http.StatusOK, call(f, "[::ffff:10.1.2.3]:4711", nil))
+	assert.Equal(t, http.StatusForbidden, call(f, "192.0.2.1:4711", nil))
+	// the header of an untrusted client is ignored
+	assert.Equal(t, http.StatusForbidden, call(f, "192.0.2.1:4711", map[string]string{"X-Forwarded-For": "10.1.2.3"}))
+	assert.Equal(t, http.StatusOK, call(f, "10.1.2.3:4711", map[string]string{"X-Forwarded-Host": "evil.example.net"}))
+	assert.False(t, proxied)
+	// unix sockets have no address
+	assert.Equal(t, http.StatusOK, call(f, "@", nil))
+
+	f, err = newIPFilter([]string{"10.1.0.0/16"}, []string{"192.0.2.0/24"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, call(f, "192.0.2.1:4711", map[string]string{"X-Forwarded-For": "10.1.2.3"}))
+	assert.Equal(t, "10.1.2.3", source)
+	assert.True(t, proxied)
+	// a chain of trusted proxies, the client can't prepend a spoofed address
+	assert.Equal(t, http.StatusForbidden, call(f, "192.0.2.1:4711", map[string]string{"X-Forwarded-For": "10.1.2.3, 203.0.113.9, 192.0.2.2"}))
+	assert.Equal(t, http.StatusOK, call(f, "192.0.2.1:4711", map[string]string{"X-Forwarded-For": "203.0.113.9, 10.1.2.3, 192.0.2.2"}))
+	assert.Equal(t, "10.1.2.3", source)
+	// without the header the proxy itself is the client
+	assert.Equal(t, http.StatusForbidden, call(f, "192.0.2.1:4711", nil))
+
+	f, err = newIPFilter(nil, []string{"192.0.2.1"}, "Forwarded")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, call(f, "192.0.2.1:4711", map[string]string{"Forwarded": `for="[2001:db8::7]:4711";proto=https`}))
+	assert.Equal(t, "2001:db8::7", source)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	defaultMaxBodySize   = 4 << 20
+	defaultMaxHeaderSize = 64 << 10
+)
+
+// writeTooLarge sends a 413 with a JSON-RPC error body, so that MCP clients
+// can show a meaningful message
+func writeTooLarge(w http.ResponseWriter, limit int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error": map[string]any{
+			"code":    -32600,
+			"message": "request body too large",
+			"data": map[string]any{
+				"limit": limit,
+			},
+		},
+	})
+}
+
+// bodyLimitMiddleware rejects request bodies bigger than maxBody bytes. The
+// body is read completely before it is passed on, as the mcp handler would
+// only see a read error and couldn't answer with a 413.
+func bodyLimitMiddleware(maxBody int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if maxBody <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > maxBody {
+				slog.Warn("rejected oversized request", "remote_addr", r.RemoteAddr, "content_length", r.ContentLength, "limit", maxBody)
+				writeTooLarge(w, maxBody)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					slog.Warn("rejected oversized request", "remote_addr", r.RemoteAddr, "limit", maxBody)
+					writeTooLarge(w, maxBody)
+					return
+				}
+				http.Error(w, "couldn't read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
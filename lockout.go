@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/state"
+	"github.com/openSUSE/systemd-mcp/remoteauth"
+)
+
+// stale entries are only pruned if more sources are tracked
+const maxTrackedSources = 10000
+
+type authFailures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// authLockout locks out source addresses which repeatedly failed the token
+// validation. A locked out source gets a 429 before its token is looked at,
+// so it can't keep the JWKS and validation path busy.
+type authLockout struct {
+	maxFailures int
+	window      time.Duration
+	duration    time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*authFailures
+}
+
+// newAuthLockout returns nil if maxFailures is zero, which disables the
+// lockout. Lockouts which didn't expire yet are restored from the state, so
+// that a restart doesn't lift them.
+func newAuthLockout(maxFailures int, window, duration time.Duration) *authLockout {
+	if maxFailures <= 0 {
+		return nil
+	}
+	l := &authLockout{
+		maxFailures: maxFailures,
+		window:      window,
+		duration:    duration,
+		now:         time.Now,
+		sources:     make(map[string]*authFailures),
+	}
+	locked := map[string]time.Time{}
+	if err := state.Load("lockout", &locked); err != nil {
+		slog.Warn("couldn't restore the auth lockouts", "error", err)
+	}
+	now := l.now()
+	for source, until := range locked {
+		if until.After(now) {
+			l.sources[source] = &authFailures{first: until, lockedUntil: until}
+		}
+	}
+	return l
+}
+
+// save persists the current lockouts, mu must be held
+func (l *authLockout) save(now time.Time) {
+	locked := map[string]time.Time{}
+	for source, entry := range l.sources {
+		if entry.lockedUntil.After(now) {
+			locked[source] = entry.lockedUntil
+		}
+	}
+	if err := state.Save("lockout", locked); err != nil {
+		slog.Warn("couldn't persist the auth lockouts", "error", err)
+	}
+}
+
+// sourceIP returns the ip of the client. Requests on unix sockets have no
+// remote address, their source is the uid of the peer, so that one local
+// user can't lock out the others. Without the credentials of the peer they
+// share the same source.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		if r.RemoteAddr == "" || r.RemoteAddr == "@" {
+			if cred, ok := r.Context().Value(peerCredKey{}).(*peerCred); ok {
+				return "unix:uid=" + strconv.FormatUint(uint64(cred.uid), 10)
+			}
+			return "unix"
+		}
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// lockedFor returns how long the source is still locked out
+func (l *authLockout) lockedFor(source string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.sources[source]
+	if !ok {
+		return 0
+	}
+	// sources with failures but without a lockout have no lockedUntil
+	return max(entry.lockedUntil.Sub(l.now()), 0)
+}
+
+func (l *authLockout) failure(source string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.sources) > maxTrackedSources {
+		l.prune(now)
+	}
+	entry, ok := l.sources[source]
+	if !ok || now.Sub(entry.first) > l.window {
+		entry = &authFailures{first: now}
+		l.sources[source] = entry
+	}
+	entry.count++
+	slog.Warn("token validation failed", "audit", "auth_failure", "source", source, "failures", entry.count)
+	if entry.count >= l.maxFailures {
+		entry.lockedUntil = now.Add(l.duration)
+		slog.Warn("source locked out after repeated auth failures", "audit", "auth_lockout",
+			"source", source, "failures", entry.count, "until", entry.lockedUntil.Format(time.RFC3339))
+		// the next failure after the lockout starts a new window
+		entry.count = 0
+		entry.first = entry.lockedUntil
+		l.save(now)
+	}
+}
+
+func (l *authLockout) success(source string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.sources, source)
+}
+
+// prune removes the sources which are neither locked nor have failures in
+// the current window, mu must be held
+func (l *authLockout) prune(now time.Time) {
+	for source, entry := range l.sources {
+		if now.After(entry.lockedUntil) && now.Sub(entry.first) > l.window {
+			delete(l.sources, source)
+		}
+	}
+}
+
+// verifier records the result of every token validation
+func (l *authLockout) verifier(next auth.TokenVerifier) auth.TokenVerifier {
+	if l == nil {
+		return next
+	}
+	return func(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+		info, err := next(ctx, token, r)
+		if errors.Is(err, remoteauth.ErrIntrospectionFailed) {
+			// the authorization server failed, not the client
+			return info, err
+		}
+		if err != nil {
+			l.failure(sourceIP(r))
+		} else {
+			l.success(sourceIP(r))
+		}
+		return info, err
+	}
+}
+
+// middleware rejects the requests of locked out sources
+func (l *authLockout) middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if remaining := l.lockedFor(sourceIP(r)); remaining > 0 {
+			slog.Debug("rejected request of locked out source", "source", sourceIP(r))
+			w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Round(time.Second).Seconds())))
+			http.Error(w, "too many authentication failures", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
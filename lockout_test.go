@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/state"
+	"github.com/openSUSE/systemd-mcp/remoteauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthLockout(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newAuthLockout(3, time.Minute, 10*time.Minute)
+	l.now = func() time.Time { return now }
+
+	verify := l.verifier(func(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+		if token == "good" {
+			return &auth.TokenInfo{}, nil
+		}
+		return nil, errors.New("invalid token")
+	})
+	call := func(remote, token string) int {
+		handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := verify(r.Context(), token, r); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call("10.0.0.1:1234", "bad"))
+	assert.Equal(t, http.StatusUnauthorized, call("10.0.0.1:1235", "bad"))
+	// a success resets the counter
+	assert.Equal(t, http.StatusOK, call("10.0.0.1:1236", "good"))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, call("10.0.0.1:1234", "bad"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, call("10.0.0.1:1234", "good"))
+	// other sources aren't affected
+	assert.Equal(t, http.StatusOK, call("[::1]:1234", "good"))
+
+	now = now.Add(11 * time.Minute)
+	assert.Equal(t, http.StatusOK, call("10.0.0.1:1234", "good"))
+}
+
+func TestAuthLockoutFailuresExpire(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newAuthLockout(2, time.Minute, time.Hour)
+	l.now = func() time.Time { return now }
+	l.failure("10.0.0.1")
+	now = now.Add(2 * time.Minute)
+	l.failure("10.0.0.1")
+	assert.Zero(t, l.lockedFor("10.0.0.1"))
+	l.failure("10.0.0.1")
+	assert.Equal(t, time.Hour, l.lockedFor("10.0.0.1"))
+}
+
+func TestAuthLockoutIgnoresIntrospectionFailures(t *testing.T) {
+	l := newAuthLockout(1, time.Minute, time.Hour)
+	verify := l.verifier(func(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+		return nil, fmt.Errorf("%w: 503 Service Unavailable", remoteauth.ErrIntrospectionFailed)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	_, err := verify(context.Background(), "opaque", req)
+	assert.ErrorIs(t, err, remoteauth.ErrIntrospectionFailed)
+	assert.Zero(t, l.lockedFor("10.0.0.1"))
+}
+
+func TestNewAuthLockoutDisabled(t *testing.T) {
+	assert.Nil(t, newAuthLockout(0, time.Minute, time.Minute))
+}
+
+func TestAuthLockoutPersisted(t *testing.T) {
+	defer state.SetDir(state.Dir())
+	state.SetDir(t.TempDir())
+
+	l := newAuthLockout(2, time.Minute, time.Hour)
+	l.failure("10.0.0.1")
+	l.failure("10.0.0.1")
+	l.failure("10.0.0.2")
+	assert.Greater(t, l.lockedFor("10.0.0.1"), time.Duration(0))
+
+	// a restart keeps the lockout but not the failures
+	restarted := newAuthLockout(2, time.Minute, time.Hour)
+	assert.Greater(t, restarted.lockedFor("10.0.0.1"), 59*time.Minute)
+	assert.Equal(t, time.Duration(0), restarted.lockedFor("10.0.0.2"))
+
+	// expired lockouts aren't restored
+	restarted.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	restarted.failure("10.0.0.3")
+	restarted.failure("10.0.0.3")
+	restarted = newAuthLockout(2, time.Minute, time.Hour)
+	assert.Equal(t, time.Duration(0), restarted.lockedFor("10.0.0.1"))
+	assert.Greater(t, restarted.lockedFor("10.0.0.3"), time.Duration(0))
+}
+
+func TestSourceIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	r.RemoteAddr = "192.0.2.1:4711"
+	assert.Equal(t, "192.0.2.1", sourceIP(r))
+	r.RemoteAddr = "@"
+	assert.Equal(t, "unix", sourceIP(r))
+	// the peers of unix sockets are told apart by their uid
+	alice := r.WithContext(context.WithValue(r.Context(), peerCredKey{}, &peerCred{uid: 1000}))
+	bob := r.WithContext(context.WithValue(r.Context(), peerCredKey{}, &peerCred{uid: 1001}))
+	assert.Equal(t, "unix:uid=1000", sourceIP(alice))
+	assert.NotEqual(t, sourceIP(alice), sourceIP(bob))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// statusInterval is how often the status is updated without watchdog
+const statusInterval = 10 * time.Second
+
+// supervisor reports the readiness and the state of the server to systemd
+// for Type=notify services and pets the watchdog of WatchdogSec=
+type supervisor struct {
+	server   *mcp.Server
+	watchdog time.Duration
+	notify   func(state string) error
+
+	mu      sync.Mutex
+	lastErr string
+	status  string // last sent status
+}
+
+// newSupervisor returns nil if the server wasn't started by systemd with a
+// notification socket, which disables the notifications
+func newSupervisor(server *mcp.Server) *supervisor {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return nil
+	}
+	watchdog, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		slog.Warn("invalid watchdog settings of systemd", "error", err)
+	}
+	return &supervisor{
+		server:   server,
+		watchdog: watchdog,
+		notify: func(state string) error {
+			_, err := daemon.SdNotify(false, state)
+			return err
+		},
+	}
+}
+
+func (s *supervisor) send(state string) {
+	if err := s.notify(state); err != nil {
+		slog.Debug("couldn't notify systemd", "state", state, "error", err)
+	}
+}
+
+// ready tells systemd that the server accepts clients and starts the
+// status updates and the watchdog, until the context is done
+func (s *supervisor) ready(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	s.send(daemon.SdNotifyReady + "\n" + "STATUS=" + s.update())
+	interval := statusInterval
+	if s.watchdog > 0 {
+		// systemd recommends to pet the watchdog at half of its interval
+		interval = min(interval, s.watchdog/2)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if s.watchdog > 0 {
+				s.send(daemon.SdNotifyWatchdog)
+			}
+			s.mu.Lock()
+			previous := s.status
+			s.mu.Unlock()
+			if status := s.update(); status != previous {
+				s.send("STATUS=" + status)
+			}
+		}
+	}()
+}
+
+// stopping tells systemd that the server shuts down
+func (s *supervisor) stopping() {
+	if s == nil {
+		return
+	}
+	s.send(daemon.SdNotifyStopping)
+}
+
+// update returns the current status and keeps it as the last sent one
+func (s *supervisor) update() string {
+	sessions := 0
+	for range s.server.Sessions() {
+		sessions++
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = fmt.Sprintf("%d active sessions", sessions)
+	if s.lastErr != "" {
+		s.status += ", last error: " + s.lastErr
+	}
+	return s.status
+}
+
+// failed records the error of a tool call for the status, as a single
+// line of limited length
+func (s *supervisor) failed(tool string, msg string) {
+	msg = strings.Join(strings.Fields(msg), " ")
+	if len(msg) > 200 {
+		msg = msg[:200] + "..."
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = tool + ": " + msg
+}
+
+// Middleware records the failed tool calls
+func (s *supervisor) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	if s == nil {
+		return next
+	}
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		res, err := next(ctx, method, req)
+		call, ok := req.(*mcp.CallToolRequest)
+		if method != "tools/call" || !ok {
+			return res, err
+		}
+		if err != nil {
+			s.failed(call.Params.Name, err.Error())
+		} else if result, ok := res.(*mcp.CallToolResult); ok && result.IsError {
+			msg := "failed"
+			if len(result.Content) > 0 {
+				if text, ok := result.Content[0].(*mcp.TextContent); ok {
+					msg = text.Text
+				}
+			}
+			s.failed(call.Params.Name, msg)
+		}
+		return res, err
+	}
+}
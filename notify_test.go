@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor(t *testing.T) {
+	assert.Nil(t, newSupervisor(nil))
+
+	socket := t.TempDir() + "/notify"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "40000")
+	t.Setenv("WATCHDOG_PID", "")
+	receive := func() string {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	s := newSupervisor(server)
+	require.NotNil(t, s)
+	assert.Equal(t, 40*time.Millisecond, s.watchdog)
+
+	handler := s.Middleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if req.(*mcp.CallToolRequest).Params.Name == "list_log" {
+			return nil, errors.New("journal\nunavailable")
+		}
+		return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "unit not found"}}}, nil
+	})
+	call := func(name string) {
+		handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: name}})
+	}
+	call("list_log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.ready(ctx)
+	assert.Equal(t, "READY=1\nSTATUS=0 active sessions, last error: list_log: journal unavailable", receive())
+	assert.Equal(t, "WATCHDOG=1", receive())
+
+	call("change_unit_state")
+	for {
+		msg := receive()
+		if strings.HasPrefix(msg, "STATUS=") {
+			assert.Equal(t, "STATUS=0 active sessions, last error: change_unit_state: unit not found", msg)
+			break
+		}
+		assert.Equal(t, "WATCHDOG=1", msg)
+	}
+	s.stopping()
+	for msg := receive(); msg != "STOPPING=1"; msg = receive() {
+		assert.Equal(t, "WATCHDOG=1", msg)
+	}
+}
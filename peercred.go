@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/openSUSE/systemd-mcp/dbus"
+)
+
+// peerCred are the credentials of the process on the other end of a unix
+// socket, read with SO_PEERCRED when the connection is accepted
+type peerCred struct {
+	pid int32
+	uid uint32
+	gid uint32
+
+	// polkit is asked once per connection and not in the accept loop
+	polkitOnce  sync.Once
+	polkitWrite bool
+}
+
+type peerCredKey struct{}
+
+// peerCredContext is the ConnContext of the peercred listeners, it keeps
+// the credentials of the peer for the requests of the connection
+func peerCredContext(ctx context.Context, c net.Conn) context.Context {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return ctx
+	}
+	var ucred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		slog.Warn("couldn't get the peer credentials", "error", errors.Join(err, credErr))
+		return ctx
+	}
+	return context.WithValue(ctx, peerCredKey{}, &peerCred{pid: ucred.Pid, uid: ucred.Uid, gid: ucred.Gid})
+}
+
+// peerCredMatch is a user or group given as uid=, user=, gid= or group=,
+// names are resolved when the flags are parsed
+type peerCredMatch struct {
+	group bool
+	id    uint32
+}
+
+func parsePeerCredMatches(entries []string) ([]peerCredMatch, error) {
+	var matches []peerCredMatch
+	for _, entry := range entries {
+		kind, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid peer credential %q, expected uid=, user=, gid= or group=", entry)
+		}
+		var id string
+		switch kind {
+		case "uid", "gid":
+			id = value
+		case "user":
+			u, err := user.Lookup(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer credential %q: %w", entry, err)
+			}
+			id = u.Uid
+		case "group":
+			g, err := user.LookupGroup(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer credential %q: %w", entry, err)
+			}
+			id = g.Gid
+		default:
+			return nil, fmt.Errorf("invalid peer credential %q, expected uid=, user=, gid= or group=", entry)
+		}
+		n, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id in peer credential %q: %w", entry, err)
+		}
+		matches = append(matches, peerCredMatch{group: kind == "gid" || kind == "group", id: uint32(n)})
+	}
+	return matches, nil
+}
+
+// peerCredAuth authorizes the peers of the peercred unix listeners by their
+// uid and groups, so that local agents don't need a token. Every peer
+// matching the readers, or every peer if there are none, gets mcp:read,
+// the writers get mcp:write and the mcp-admin role too. With polkit the
+// other peers get write if polkit authorizes their process.
+type peerCredAuth struct {
+	readers []peerCredMatch
+	writers []peerCredMatch
+	polkit  bool
+	// checks a polkit action for the process, replaced in the tests
+	checkPolkit func(pid int32, action string) (bool, error)
+	groups      func(uid uint32) []uint32
+}
+
+func newPeerCredAuth(readers, writers []string, polkit bool) (*peerCredAuth, error) {
+	a := &peerCredAuth{polkit: polkit, checkPolkit: dbus.CheckPolkitByPID, groups: userGroups}
+	var err error
+	if a.readers, err = parsePeerCredMatches(readers); err != nil {
+		return nil, err
+	}
+	if a.writers, err = parsePeerCredMatches(writers); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// userGroups returns the supplementary groups of the user
+func userGroups(uid uint32) []uint32 {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return nil
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil
+	}
+	var gids []uint32
+	for _, id := range ids {
+		if n, err := strconv.ParseUint(id, 10, 32); err == nil {
+			gids = append(gids, uint32(n))
+		}
+	}
+	return gids
+}
+
+func (a *peerCredAuth) matches(matches []peerCredMatch, cred *peerCred) bool {
+	var groups []uint32
+	return slices.ContainsFunc(matches, func(m peerCredMatch) bool {
+		if !m.group {
+			return m.id == cred.uid
+		}
+		if m.id == cred.gid {
+			return true
+		}
+		if groups == nil {
+			groups = a.groups(cred.uid)
+		}
+		return slices.Contains(groups, m.id)
+	})
+}
+
+// tokenInfo returns the grant of the peer, nil if it may not connect
+func (a *peerCredAuth) tokenInfo(cred *peerCred) *auth.TokenInfo {
+	if len(a.readers) > 0 && !a.matches(a.readers, cred) && !a.matches(a.writers, cred) {
+		return nil
+	}
+	scopes := systemdScopes()
+	var roles []string
+	write := a.matches(a.writers, cred)
+	if !write && a.polkit {
+		cred.polkitOnce.Do(func() {
+			authorized, err := a.checkPolkit(cred.pid, dbus.ActionManageUnits)
+			if err != nil {
+				slog.Debug("polkit check of the peer failed", "pid", cred.pid, "error", err)
+			}
+			cred.polkitWrite = authorized && err == nil
+		})
+		write = cred.polkitWrite
+	}
+	if write {
+		scopes = append(scopes, "mcp:write")
+		roles = append(roles, "mcp-admin")
+	}
+	userID := strconv.FormatUint(uint64(cred.uid), 10)
+	if u, err := user.LookupId(userID); err == nil {
+		userID = u.Username
+	}
+	return &auth.TokenInfo{
+		Scopes:     scopes,
+		Expiration: time.Now().Add(time.Hour),
+		UserID:     userID,
+		Extra: map[string]any{
+			"roles":    roles,
+			"peer_uid": cred.uid,
+			"peer_pid": cred.pid,
+		},
+	}
+}
+
+// middleware grants the requests by the credentials of the peer, like for
+// the noauth listeners the grant is passed through the bearer token
+// middleware
+func (a *peerCredAuth) middleware(next http.Handler) http.Handler {
+	granted := auth.RequireBearerToken(func(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+		cred, ok := r.Context().Value(peerCredKey{}).(*peerCred)
+		if !ok {
+			return nil, fmt.Errorf("no peer credentials: %w", auth.ErrInvalidToken)
+		}
+		info := a.tokenInfo(cred)
+		if info == nil {
+			slog.Warn("peer isn't allowed to connect", "audit", "auth_failure", "uid", cred.uid, "pid", cred.pid)
+			return nil, fmt.Errorf("uid %d isn't allowed to connect: %w", cred.uid, auth.ErrInvalidToken)
+		}
+		return info, nil
+	}, nil)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Authorization", "Bearer peer-credentials")
+		granted.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeerCredMatches(t *testing.T) {
+	matches, err := parsePeerCredMatches([]string{"uid=0", "gid=100", "user=root"})
+	require.NoError(t, err)
+	assert.Equal(t, []peerCredMatch{{id: 0}, {group: true, id: 100}, {id: 0}}, matches)
+
+	for _, entry := range []string{"0", "uid=", "uid=root", "pid=1", "user=does-not-exist"} {
+		_, err := parsePeerCredMatches([]string{entry})
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestPeerCredAuth(t *testing.T) {
+	polkitChecks := 0
+	a := &peerCredAuth{
+		readers: []peerCredMatch{{group: true, id: 100}},
+		writers: []peerCredMatch{{id: 0}, {group: true, id: 10}},
+		polkit:  true,
+		checkPolkit: func(pid int32, action string) (bool, error) {
+			polkitChecks++
+			return pid == 42, nil
+		},
+		groups: func(uid uint32) []uint32 {
+			if uid == 1001 {
+				return []uint32{10}
+			}
+			return nil
+		},
+	}
+	ti := a.tokenInfo(&peerCred{uid: 0, gid: 0})
+	require.NotNil(t, ti)
+	assert.Equal(t, []string{"mcp:read", "mcp:write"}, ti.Scopes)
+	assert.Equal(t, "root", ti.UserID)
+
+	// a member of the writers group by its supplementary groups
+	ti = a.tokenInfo(&peerCred{uid: 1001, gid: 1001})
+	require.NotNil(t, ti)
+	assert.Equal(t, []string{"mcp-admin"}, ti.Extra["roles"])
+
+	// a reader is asked once per connection
+	reader := &peerCred{pid: 7, uid: 1000, gid: 100}
+	assert.Equal(t, []string{"mcp:read"}, a.tokenInfo(reader).Scopes)
+	a.tokenInfo(reader)
+	assert.Equal(t, 1, polkitChecks)
+	assert.Equal(t, []string{"mcp:read", "mcp:write"}, a.tokenInfo(&peerCred{pid: 42, uid: 1000, gid: 100}).Scopes)
+
+	assert.Nil(t, a.tokenInfo(&peerCred{uid: 1002, gid: 1002}))
+}
+
+func TestPeerCredListener(t *testing.T) {
+	a, err := newPeerCredAuth(nil, []string{"uid=" + strconv.Itoa(os.Getuid())}, false)
+	require.NoError(t, err)
+	var granted *auth.TokenInfo
+	mux, err := buildMux(&httpConfig{PeerCreds: a}, listenSpec{Network: "unix", PeerCred: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		granted = auth.TokenInfoFromContext(r.Context())
+	}), nil, nil)
+	require.NoError(t, err)
+
+	socket := filepath.Join(t.TempDir(), "mcp.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	s := &http.Server{Handler: mux, ConnContext: peerCredContext}
+	go s.Serve(l)
+	defer s.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := client.Post("http://localhost"+mcpPath, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, granted)
+	assert.Equal(t, []string{"mcp:read", "mcp:write"}, granted.Scopes)
+	assert.Equal(t, uint32(os.Getuid()), granted.Extra["peer_uid"])
+	assert.Equal(t, int32(os.Getpid()), granted.Extra["peer_pid"])
+}
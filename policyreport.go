@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cheynewallace/tabby"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/budget"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/calendar"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/file"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/jobs"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+)
+
+const (
+	polkitReadAction      = dbus.ActionReadLog
+	polkitManageUnits     = dbus.ActionManageUnits
+	polkitManageUnitFiles = dbus.ActionManageUnitFiles
+	polkitManageFiles     = dbus.ActionManageFiles
+	polkitSetUserLinger   = "org.freedesktop.login1.set-user-linger"
+	polkitReloadDaemon    = dbus.ActionReloadDaemon
+)
+
+// capability is a group of tools which need the same permission
+type capability struct {
+	Name   string
+	Tools  []string
+	Write  bool
+	Polkit string // polkit action checked for non root users
+	NoAuth bool   // tool doesn't check any authorization
+	// access is further restricted by the file path policy
+	PathPolicy bool
+	// access is further restricted by the unit policy
+	UnitPolicy bool
+}
+
+var capabilities = []capability{
+	{Name: "read units", Tools: []string{"list_loaded_units", "list_unit_files", "system_status", "get_user_linger", "list_config_settings"}, Polkit: polkitReadAction},
+	{Name: "read journal", Tools: []string{"list_log", "list_audit_log"}, Polkit: polkitReadAction},
+	{Name: "read files", Tools: []string{"get_file", "search_file", "follow_file", "watch_path", "diff_file"}, Polkit: polkitReadAction, PathPolicy: true},
+	{Name: "integrity snapshot", Tools: []string{"forensics_snapshot"}, Polkit: polkitReadAction},
+	{Name: "read system info", Tools: []string{"get_system_info"}, Polkit: polkitReadAction},
+	{Name: "start/stop/restart units", Tools: []string{"change_unit_state"}, Write: true, Polkit: polkitManageUnits, UnitPolicy: true},
+	{Name: "enable/disable units", Tools: []string{"change_unit_state"}, Write: true, Polkit: polkitManageUnitFiles, UnitPolicy: true},
+	{Name: "enable/disable user linger", Tools: []string{"change_user_linger"}, Write: true, Polkit: polkitSetUserLinger},
+	{Name: "start user manager", Tools: []string{"change_user_linger"}, Write: true, Polkit: polkitManageUnits, UnitPolicy: true},
+	{Name: "change daemon config", Tools: []string{"change_config_dropin"}, Write: true, Polkit: polkitManageUnits, UnitPolicy: true},
+	{Name: "change system manager config", Tools: []string{"change_config_dropin"}, Write: true, Polkit: polkitReloadDaemon},
+	{Name: "patch files", Tools: []string{"apply_patch"}, Write: true, Polkit: polkitManageFiles, PathPolicy: true},
+	{Name: "wait for restart/reload", Tools: []string{"check_restart_reload"}, Write: true, Polkit: polkitManageUnits},
+	{Name: "read man pages", Tools: []string{"get_man_page", "lookup_directive", "list_man_pages", "get_help", "get_info_page"}, NoAuth: true},
+	{Name: "evaluate calendar expressions", Tools: []string{calendar.ToolName}, NoAuth: true},
+	{Name: "drop session authorization", Tools: []string{"deauthorize_session"}, NoAuth: true},
+	{Name: "continue truncated results", Tools: []string{budget.ToolName}, NoAuth: true},
+	{Name: "read background jobs", Tools: []string{jobs.ToolName}, NoAuth: true},
+}
+
+// writeTools returns the tools of the write capabilities
+func writeTools() []string {
+	var tools []string
+	for _, c := range capabilities {
+		if !c.Write {
+			continue
+		}
+		for _, tool := range c.Tools {
+			if !slices.Contains(tools, tool) {
+				tools = append(tools, tool)
+			}
+		}
+	}
+	return tools
+}
+
+type policyReportConfig struct {
+	NoAuth       bool
+	HTTP         bool
+	Stdio        bool // stdio is served next to http
+	Controller   string
+	Issuers      []string // trusted issuers next to the controller
+	Specs        []listenSpec
+	AllowWrite   bool
+	WriteFor     time.Duration // write is denied after this time, 0 is unlimited
+	EnabledTools []string      // empty enables all tools
+	PathPolicy   *file.PathPolicy
+	UnitPolicy   *systemd.UnitPolicy
+	ToolScopes   toolScopes // replaces mcp:read and mcp:write if set
+	ClientCA     bool       // clients of tls listeners may use certificates
+	CertWriters  []string   // certificate matches which grant write
+	APIKeys      bool       // clients may use static api keys
+	PeerWriters  []string   // users and groups which write over peercred listeners
+	PeerPolkit   bool       // other peers write if polkit authorizes them
+	RBAC         *rbacPolicy
+}
+
+// identityClass is a kind of caller, access returns how a capability is
+// granted to it
+type identityClass struct {
+	Name   string
+	access func(c capability) string
+}
+
+// identityClasses returns the callers which are possible with the
+// configuration
+func identityClasses(cfg *policyReportConfig) []identityClass {
+	if cfg.NoAuth {
+		return []identityClass{{
+			Name:   "anyone (--noauth)",
+			access: func(c capability) string { return "yes" },
+		}}
+	}
+	if cfg.HTTP && cfg.Stdio {
+		httpOnly := *cfg
+		httpOnly.Stdio = false
+		return append(identityClasses(&httpOnly), localClasses(" over stdio")...)
+	}
+	if cfg.RBAC != nil {
+		return append(rbacClasses(cfg), noauthListenerClass(cfg)...)
+	}
+	if cfg.HTTP && cfg.Controller == "" && (cfg.ClientCA || cfg.APIKeys || hasPeerCredListener(cfg)) {
+		return append(append(append(apiKeyClasses(cfg), clientCertClasses(cfg)...), noauthListenerClass(cfg)...), peerCredClasses(cfg)...)
+	}
+	if cfg.HTTP && len(cfg.ToolScopes) > 0 {
+		var classes []identityClass
+		for _, scope := range cfg.ToolScopes.scopes() {
+			classes = append(classes, identityClass{
+				Name: "token with " + scope,
+				access: func(c capability) string {
+					var granted []string
+					for _, tool := range c.Tools {
+						if cfg.ToolScopes.allowed(tool, []string{scope}) {
+							granted = append(granted, tool)
+						}
+					}
+					access := "yes"
+					if len(granted) == 0 {
+						return "no"
+					} else if len(granted) < len(c.Tools) {
+						access = strings.Join(granted, ",")
+					}
+					if c.Write {
+						access += " with mcp-admin role"
+					}
+					return access
+				},
+			})
+		}
+		return append(append(append(append(classes, apiKeyClasses(cfg)...), clientCertClasses(cfg)...), noauthListenerClass(cfg)...), peerCredClasses(cfg)...)
+	}
+	if cfg.HTTP {
+		classes := []identityClass{{
+			Name: "token without mcp scopes",
+			access: func(c capability) string {
+				if c.NoAuth {
+					return "yes"
+				}
+				return "no"
+			},
+		}, {
+			Name: "token with mcp:read",
+			access: func(c capability) string {
+				if c.Write {
+					return "no"
+				}
+				return "yes"
+			},
+		}, {
+			Name:   "token with mcp:write and mcp-admin role",
+			access: func(c capability) string { return "yes" },
+		}}
+		return append(append(append(append(classes, apiKeyClasses(cfg)...), clientCertClasses(cfg)...), noauthListenerClass(cfg)...), peerCredClasses(cfg)...)
+	}
+	return localClasses("")
+}
+
+// localClasses returns the callers authorized by polkit
+func localClasses(suffix string) []identityClass {
+	return []identityClass{{
+		Name:   "root" + suffix,
+		access: func(c capability) string { return "yes" },
+	}, {
+		Name: "local user" + suffix,
+		access: func(c capability) string {
+			if c.NoAuth {
+				return "yes"
+			}
+			if c.Name == "read journal" {
+				return "systemd-journal group or polkit " + c.Polkit
+			}
+			return "polkit " + c.Polkit
+		},
+	}}
+}
+
+// rbacClasses returns a caller per role of the rbac policy
+func rbacClasses(cfg *policyReportConfig) []identityClass {
+	names := slices.Sorted(maps.Keys(cfg.RBAC.Roles))
+	var classes []identityClass
+	for _, name := range names {
+		classes = append(classes, identityClass{
+			Name: "role " + name,
+			access: func(c capability) string {
+				var granted []string
+				for _, tool := range c.Tools {
+					if ok, _ := cfg.RBAC.grant(tool, []string{name}); ok {
+						granted = append(granted, tool)
+					}
+				}
+				access := "yes"
+				if len(granted) == 0 {
+					return "no"
+				} else if len(granted) < len(c.Tools) {
+					access = strings.Join(granted, ",")
+				}
+				if !cfg.HTTP && !c.NoAuth {
+					access += " and polkit " + c.Polkit
+				}
+				if units := cfg.RBAC.Roles[name].Units; c.UnitPolicy && len(units) > 0 {
+					access += " on " + strings.Join(units, " ")
+				}
+				return access
+			},
+		})
+	}
+	return classes
+}
+
+// clientCertClasses returns the clients with a certificate of the client
+// CA, if it's configured
+func clientCertClasses(cfg *policyReportConfig) []identityClass {
+	if !cfg.ClientCA {
+		return nil
+	}
+	classes := []identityClass{{
+		Name: "client certificate",
+		access: func(c capability) string {
+			if c.Write {
+				return "no"
+			}
+			return "yes"
+		},
+	}}
+	if len(cfg.CertWriters) > 0 {
+		classes = append(classes, identityClass{
+			Name:   "client certificate matching " + strings.Join(cfg.CertWriters, ","),
+			access: func(c capability) string { return "yes" },
+		})
+	}
+	return classes
+}
+
+// apiKeyClasses returns the clients with an api key, if they are configured
+func apiKeyClasses(cfg *policyReportConfig) []identityClass {
+	if !cfg.APIKeys {
+		return nil
+	}
+	return []identityClass{{
+		Name: "api key with read role",
+		access: func(c capability) string {
+			if c.Write {
+				return "no"
+			}
+			return "yes"
+		},
+	}, {
+		Name:   "api key with write role",
+		access: func(c capability) string { return "yes" },
+	}}
+}
+
+// noauthListenerClass returns the clients of noauth listeners, if any
+func noauthListenerClass(cfg *policyReportConfig) []identityClass {
+	if !slices.ContainsFunc(cfg.Specs, func(s listenSpec) bool { return s.NoAuth }) {
+		return nil
+	}
+	return []identityClass{{
+		Name: "client of a noauth listener",
+		access: func(c capability) string {
+			if c.Write && !cfg.AllowWrite {
+				return "no"
+			}
+			return "yes"
+		},
+	}}
+}
+
+func hasPeerCredListener(cfg *policyReportConfig) bool {
+	return slices.ContainsFunc(cfg.Specs, func(s listenSpec) bool { return s.PeerCred })
+}
+
+// peerCredClasses returns the peers of peercred listeners, if any
+func peerCredClasses(cfg *policyReportConfig) []identityClass {
+	if !hasPeerCredListener(cfg) {
+		return nil
+	}
+	classes := []identityClass{{
+		Name: "peer of a peercred listener",
+		access: func(c capability) string {
+			if !c.Write {
+				return "yes"
+			}
+			if cfg.PeerPolkit {
+				return "polkit " + polkitManageUnits
+			}
+			return "no"
+		},
+	}}
+	if len(cfg.PeerWriters) > 0 {
+		classes = append(classes, identityClass{
+			Name:   "peer with " + strings.Join(cfg.PeerWriters, ","),
+			access: func(c capability) string { return "yes" },
+		})
+	}
+	return classes
+}
+
+// policyReport returns the matrix of capability × identity class, the
+// first row is the header
+func policyReport(cfg *policyReportConfig) [][]string {
+	classes := identityClasses(cfg)
+	header := []string{"CAPABILITY", "TOOLS"}
+	for _, class := range classes {
+		header = append(header, strings.ToUpper(class.Name))
+	}
+	rows := [][]string{header}
+	for _, c := range capabilities {
+		var enabled []string
+		for _, tool := range c.Tools {
+			if cfg.HTTP && len(cfg.ToolScopes) > 0 && len(cfg.ToolScopes[tool]) == 0 {
+				// tools without a scope aren't registered
+				continue
+			}
+			if len(cfg.EnabledTools) == 0 || slices.Contains(cfg.EnabledTools, tool) {
+				enabled = append(enabled, tool)
+			}
+		}
+		row := []string{c.Name, strings.Join(enabled, ",")}
+		for _, class := range classes {
+			access := class.access(c)
+			if len(enabled) == 0 {
+				access = "disabled"
+			} else if c.PathPolicy && access != "no" {
+				access += ", path policy"
+			} else if c.UnitPolicy && access != "no" && cfg.UnitPolicy != nil {
+				access += ", unit policy"
+			}
+			row = append(row, access)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func printPolicyReport(cfg *policyReportConfig) {
+	tb := tabby.New()
+	for i, row := range policyReport(cfg) {
+		cells := make([]interface{}, len(row))
+		for j, cell := range row {
+			cells[j] = cell
+		}
+		if i == 0 {
+			tb.AddHeader(cells...)
+		} else {
+			tb.AddLine(cells...)
+		}
+	}
+	tb.Print()
+
+	fmt.Println()
+	switch {
+	case cfg.NoAuth:
+		fmt.Println("authorization: disabled")
+	case cfg.HTTP && cfg.Controller == "":
+		if cfg.APIKeys {
+			fmt.Println("authorization: api keys")
+		}
+		if cfg.ClientCA {
+			fmt.Println("authorization: client certificates")
+		}
+	case cfg.HTTP:
+		fmt.Println("authorization: oauth2 via", cfg.Controller)
+		for _, issuer := range cfg.Issuers {
+			fmt.Println("authorization: oauth2 via", issuer)
+		}
+		if cfg.APIKeys {
+			fmt.Println("authorization: api keys")
+		}
+		if cfg.ClientCA {
+			fmt.Println("authorization: client certificates on tls listeners")
+		}
+	default:
+		fmt.Println("authorization: polkit")
+	}
+	if cfg.WriteFor > 0 {
+		fmt.Println("write authorization: expires", cfg.WriteFor, "after the start")
+	}
+	if cfg.PathPolicy != nil {
+		allow := "all paths"
+		if len(cfg.PathPolicy.Allow) > 0 {
+			allow = strings.Join(cfg.PathPolicy.Allow, " ")
+		}
+		fmt.Println("file path policy allow:", allow)
+		fmt.Println("file path policy deny:", strings.Join(cfg.PathPolicy.Deny, " "))
+	}
+	if cfg.UnitPolicy != nil {
+		allow := "all units"
+		if len(cfg.UnitPolicy.Allow) > 0 {
+			allow = strings.Join(cfg.UnitPolicy.Allow, " ")
+		}
+		fmt.Println("unit policy allow:", allow)
+		fmt.Println("unit policy deny:", strings.Join(cfg.UnitPolicy.Deny, " "))
+	}
+	if cfg.RBAC != nil {
+		for _, name := range slices.Sorted(maps.Keys(cfg.RBAC.Roles)) {
+			units := "all units"
+			if role := cfg.RBAC.Roles[name]; len(role.Units) > 0 {
+				units = strings.Join(role.Units, " ")
+			}
+			fmt.Println("rbac role", name+":", strings.Join(cfg.RBAC.Roles[name].Tools, ","), "on", units)
+		}
+	}
+}
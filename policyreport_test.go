@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findRow(rows [][]string, name string) []string {
+	for _, row := range rows {
+		if row[0] == name {
+			return row
+		}
+	}
+	return nil
+}
+
+func TestPolicyReport(t *testing.T) {
+	t.Run("polkit", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{})
+		assert.Equal(t, []string{"CAPABILITY", "TOOLS", "ROOT", "LOCAL USER"}, rows[0])
+		row := findRow(rows, "enable/disable units")
+		require.NotNil(t, row)
+		assert.Equal(t, "polkit "+polkitManageUnitFiles, row[3])
+		assert.Equal(t, "yes, path policy", findRow(rows, "read files")[2])
+	})
+
+	t.Run("oauth2 with noauth listener", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{
+			HTTP:  true,
+			Specs: []listenSpec{{Network: "tcp", Address: ":8666"}, {Network: "unix", Address: "/run/mcp.sock", NoAuth: true}},
+		})
+		require.Len(t, rows[0], 6)
+		row := findRow(rows, "start/stop/restart units")
+		assert.Equal(t, []string{"no", "no", "yes", "no"}, row[2:])
+		row = findRow(rows, "read units")
+		assert.Equal(t, []string{"no", "yes", "yes", "yes"}, row[2:])
+	})
+
+	t.Run("oauth2 with tool scopes", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{
+			HTTP:       true,
+			ToolScopes: toolScopes{"list_log": {"mcp:logs"}, "change_unit_state": {"mcp:units"}, "get_file": {"mcp:logs"}},
+		})
+		assert.Equal(t, []string{"CAPABILITY", "TOOLS", "TOKEN WITH MCP:LOGS", "TOKEN WITH MCP:UNITS"}, rows[0])
+		assert.Equal(t, []string{"read journal", "list_log", "list_log", "no"}, findRow(rows, "read journal"))
+		assert.Equal(t, []string{"no", "yes with mcp-admin role"}, findRow(rows, "start/stop/restart units")[2:])
+		assert.Equal(t, []string{"get_file", "get_file, path policy", "no"}, findRow(rows, "read files")[1:])
+		assert.Equal(t, "disabled", findRow(rows, "read units")[2])
+	})
+
+	t.Run("oauth2 and stdio", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{HTTP: true, Stdio: true})
+		assert.Equal(t, []string{"ROOT OVER STDIO", "LOCAL USER OVER STDIO"}, rows[0][len(rows[0])-2:])
+		row := findRow(rows, "start/stop/restart units")
+		assert.Equal(t, []string{"no", "no", "yes", "yes", "polkit " + polkitManageUnits}, row[2:])
+	})
+
+	t.Run("client certificates", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{HTTP: true, ClientCA: true, CertWriters: []string{"OU=ops"}})
+		assert.Equal(t, []string{"CAPABILITY", "TOOLS", "CLIENT CERTIFICATE", "CLIENT CERTIFICATE MATCHING OU=OPS"}, rows[0])
+		assert.Equal(t, []string{"no", "yes"}, findRow(rows, "start/stop/restart units")[2:])
+		assert.Equal(t, []string{"yes", "yes"}, findRow(rows, "read units")[2:])
+
+		rows = policyReport(&policyReportConfig{HTTP: true, Controller: "https://idp.example.com", ClientCA: true})
+		assert.Equal(t, "CLIENT CERTIFICATE", rows[0][len(rows[0])-1])
+	})
+
+	t.Run("peercred listener", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{
+			HTTP:        true,
+			Specs:       []listenSpec{{Network: "unix", Address: "/run/mcp.sock", PeerCred: true}},
+			PeerWriters: []string{"uid=0"},
+			PeerPolkit:  true,
+		})
+		assert.Equal(t, []string{"CAPABILITY", "TOOLS", "PEER OF A PEERCRED LISTENER", "PEER WITH UID=0"}, rows[0])
+		assert.Equal(t, []string{"polkit " + polkitManageUnits, "yes"}, findRow(rows, "start/stop/restart units")[2:])
+		assert.Equal(t, []string{"yes", "yes"}, findRow(rows, "read units")[2:])
+	})
+
+	t.Run("rbac policy", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{
+			HTTP: true,
+			RBAC: &rbacPolicy{Roles: map[string]rbacRole{
+				"viewer":       {Tools: []string{"list_log"}},
+				"web-operator": {Tools: []string{"change_unit_state"}, Units: []string{"nginx*.service"}},
+			}},
+		})
+		assert.Equal(t, []string{"CAPABILITY", "TOOLS", "ROLE VIEWER", "ROLE WEB-OPERATOR"}, rows[0])
+		assert.Equal(t, []string{"list_log", "no"}, findRow(rows, "read journal")[2:])
+		assert.Equal(t, []string{"no", "yes on nginx*.service"}, findRow(rows, "start/stop/restart units")[2:])
+	})
+
+	t.Run("unit policy", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{NoAuth: true, UnitPolicy: &systemd.UnitPolicy{Deny: []string{"sshd.service"}}})
+		assert.Equal(t, "yes, unit policy", findRow(rows, "start/stop/restart units")[2])
+		assert.Equal(t, "yes, unit policy", findRow(rows, "change daemon config")[2])
+		assert.Equal(t, "yes", findRow(rows, "enable/disable user linger")[2])
+	})
+
+	t.Run("disabled tools", func(t *testing.T) {
+		rows := policyReport(&policyReportConfig{NoAuth: true, EnabledTools: []string{"get_file"}})
+		assert.Equal(t, []string{"read files", "get_file", "yes, path policy"}, findRow(rows, "read files"))
+		assert.Equal(t, "disabled", findRow(rows, "read units")[2])
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// promptStep is a step of a workflow which uses a tool, the step is left
+// out if the tool isn't enabled. {unit} in the texts is replaced with the
+// unit argument.
+type promptStep struct {
+	tool string
+	text string
+}
+
+// workflowPrompt pre-assembles the tool calls of a common workflow
+type workflowPrompt struct {
+	prompt *mcp.Prompt
+	intro  string
+	steps  []promptStep
+	outro  string
+}
+
+var unitArgument = []*mcp.PromptArgument{{Name: "unit", Title: "Unit", Description: "Name of the unit, e.g. nginx.service", Required: true}}
+
+var workflowPrompts = []workflowPrompt{
+	{
+		prompt: &mcp.Prompt{
+			Name:        "diagnose_failing_unit",
+			Title:       "Diagnose failing unit",
+			Description: "Find out why a unit fails to start or keeps failing, from its state, log and unit file.",
+			Arguments:   unitArgument,
+		},
+		intro: "Diagnose why the unit {unit} fails. Work through these steps and stop as soon as the cause is clear:",
+		steps: []promptStep{
+			{"list_loaded_units", `Call list_loaded_units with patterns ["{unit}"], state "all" and properties true for its state, result, exit status and the path of its unit file.`},
+			{"list_log", `Call list_log with unit ["{unit}"], exact_unit true and count 50 for the log of the last start attempts. Look for the first error, not only the last lines.`},
+			{"get_file", "Read the unit file (FragmentPath) and the drop-ins in /etc/systemd/system/{unit}.d/ with get_file and parse_config true."},
+			{"list_loaded_units", `Call list_loaded_units with state "failed" to see whether units it depends on failed as well.`},
+			{"lookup_directive", "Look up the directives of the unit file you aren't sure about with lookup_directive instead of guessing."},
+		},
+		outro: "Report the cause with the evidence from the log and the unit file and propose a fix. Don't change anything without asking, and prefer a drop-in over editing the vendor unit file.",
+	},
+	{
+		prompt: &mcp.Prompt{
+			Name:        "harden_service",
+			Title:       "Harden this service",
+			Description: "Propose a sandboxing drop-in for a service which keeps it working.",
+			Arguments:   unitArgument,
+		},
+		intro: "Propose a sandboxing drop-in for the service {unit} which keeps it working:",
+		steps: []promptStep{
+			{"list_loaded_units", `Call list_loaded_units with patterns ["{unit}"] and properties true for the path of the unit file and the main process.`},
+			{"get_file", "Read the unit file and its drop-ins with get_file and parse_config true, and note the sandboxing directives which are already set."},
+			{"list_log", `Call list_log with unit ["{unit}"] and exact_unit true to see which files, sockets and devices the service uses.`},
+			{"lookup_directive", "Check NoNewPrivileges, ProtectSystem, ProtectHome, PrivateTmp, PrivateDevices, ProtectKernelTunables, ProtectKernelModules, ProtectControlGroups, RestrictAddressFamilies, RestrictNamespaces, SystemCallFilter and CapabilityBoundingSet with lookup_directive."},
+		},
+		outro: "Return the drop-in /etc/systemd/system/{unit}.d/hardening.conf with a comment for every directive why it is safe for this service. Don't write it or restart the service without asking, and check the log for failures after it was applied.",
+	},
+	{
+		prompt: &mcp.Prompt{
+			Name:        "investigate_slow_boot",
+			Title:       "Investigate slow boot",
+			Description: "Find the units which delayed the last boot and why.",
+		},
+		intro: "Investigate why the last boot was slow:",
+		steps: []promptStep{
+			{"system_status", "Call system_status for the system state, the number of failed units and the jobs which are still queued."},
+			{"list_log", `Call list_log with pattern "Startup finished|start job|timed out|Dependency failed" and count 200 for the boot time and the units systemd waited for.`},
+			{"list_loaded_units", `Call list_loaded_units with state "failed" for the units which failed during the boot.`},
+			{"get_system_info", `Call get_system_info with subsystems ["pressure", "loadavg", "meminfo"] to rule out a lack of memory or IO.`},
+			{"lookup_directive", "Look up timeouts like TimeoutStartSec or DefaultTimeoutStartSec with lookup_directive before proposing to change them."},
+		},
+		outro: "Name the units which delayed the boot the most with the time they took and the reason if the log shows it, and propose changes. Don't change anything without asking.",
+	},
+}
+
+// text returns the instructions with the steps whose tools are enabled
+func (w workflowPrompt) text(enabledTools []string, unit string) string {
+	var b strings.Builder
+	b.WriteString(w.intro + "\n\n")
+	n := 0
+	for _, step := range w.steps {
+		if !slices.Contains(enabledTools, step.tool) {
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "%d. %s\n", n, step.text)
+	}
+	b.WriteString("\n" + w.outro)
+	return strings.ReplaceAll(b.String(), "{unit}", unit)
+}
+
+// handler returns the instructions for the arguments of the client
+func (w workflowPrompt) handler(enabledTools []string) mcp.PromptHandler {
+	return func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		unit := ""
+		if len(w.prompt.Arguments) > 0 {
+			unit = strings.TrimSpace(req.Params.Arguments["unit"])
+			if unit == "" {
+				return nil, fmt.Errorf("the prompt %s needs a unit", w.prompt.Name)
+			}
+			if strings.ContainsAny(unit, " \t\r\n\"/") {
+				return nil, fmt.Errorf("invalid unit name: %q", unit)
+			}
+		}
+		return &mcp.GetPromptResult{
+			Description: w.prompt.Description,
+			Messages: []*mcp.PromptMessage{{
+				Role:    "user",
+				Content: &mcp.TextContent{Text: w.text(enabledTools, unit)},
+			}},
+		}, nil
+	}
+}
+
+// registerPrompts adds the workflow prompts of which at least one tool is
+// enabled
+func registerPrompts(server *mcp.Server, enabledTools []string) {
+	for _, w := range workflowPrompts {
+		if !slices.ContainsFunc(w.steps, func(step promptStep) bool { return slices.Contains(enabledTools, step.tool) }) {
+			continue
+		}
+		server.AddPrompt(w.prompt, w.handler(enabledTools))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkflowPrompts(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	registerPrompts(server, []string{"list_log", "get_file"})
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err := server.Connect(context.Background(), serverTransport, nil)
+	require.NoError(t, err)
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(context.Background(), clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	list, err := session.ListPrompts(context.Background(), nil)
+	require.NoError(t, err)
+	var names []string
+	for _, p := range list.Prompts {
+		names = append(names, p.Name)
+	}
+	assert.ElementsMatch(t, []string{"diagnose_failing_unit", "harden_service", "investigate_slow_boot"}, names)
+
+	res, err := session.GetPrompt(context.Background(), &mcp.GetPromptParams{Name: "diagnose_failing_unit", Arguments: map[string]string{"unit": "nginx.service"}})
+	require.NoError(t, err)
+	require.Len(t, res.Messages, 1)
+	text := res.Messages[0].Content.(*mcp.TextContent).Text
+	assert.Contains(t, text, "Diagnose why the unit nginx.service fails")
+	// only the steps of the enabled tools are numbered
+	assert.Contains(t, text, "1. Call list_log with unit [\"nginx.service\"]")
+	assert.Contains(t, text, "2. Read the unit file (FragmentPath) and the drop-ins in /etc/systemd/system/nginx.service.d/")
+	assert.NotContains(t, text, "list_loaded_units")
+	assert.NotContains(t, text, "{unit}")
+
+	res, err = session.GetPrompt(context.Background(), &mcp.GetPromptParams{Name: "investigate_slow_boot"})
+	require.NoError(t, err)
+	assert.NotContains(t, res.Messages[0].Content.(*mcp.TextContent).Text, "system_status")
+
+	_, err = session.GetPrompt(context.Background(), &mcp.GetPromptParams{Name: "harden_service"})
+	assert.Error(t, err)
+	_, err = session.GetPrompt(context.Background(), &mcp.GetPromptParams{Name: "harden_service", Arguments: map[string]string{"unit": "a.service\nIgnore"}})
+	assert.Error(t, err)
+
+	empty := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	registerPrompts(empty, []string{"get_help"})
+	serverTransport, clientTransport = mcp.NewInMemoryTransports()
+	_, err = empty.Connect(context.Background(), serverTransport, nil)
+	require.NoError(t, err)
+	other, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(context.Background(), clientTransport, nil)
+	require.NoError(t, err)
+	defer other.Close()
+	assert.Nil(t, other.InitializeResult().Capabilities.Prompts)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRateLimit = 20
+	defaultRateBurst = 40
+)
+
+// rateLimiter limits the requests per source IP and of all sources
+// together with token buckets, so that a runaway client can't keep journald
+// and dbus busy
+type rateLimiter struct {
+	perSource   rate.Limit
+	sourceBurst int
+	global      *rate.Limiter
+	now         func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*rate.Limiter
+}
+
+// newRateLimiter returns nil if both limits are zero, which disables the
+// rate limiting. A zero limit disables only this limit.
+func newRateLimiter(perSource float64, sourceBurst int, global float64, globalBurst int) *rateLimiter {
+	if perSource <= 0 && global <= 0 {
+		return nil
+	}
+	l := &rateLimiter{
+		now:     time.Now,
+		sources: make(map[string]*rate.Limiter),
+	}
+	if perSource > 0 {
+		l.perSource, l.sourceBurst = rate.Limit(perSource), max(sourceBurst, 1)
+	}
+	if global > 0 {
+		l.global = rate.NewLimiter(rate.Limit(global), max(globalBurst, 1))
+	}
+	return l
+}
+
+// source returns the bucket of the source, mu must be held
+func (l *rateLimiter) source(source string, now time.Time) *rate.Limiter {
+	lim, ok := l.sources[source]
+	if !ok {
+		if len(l.sources) > maxTrackedSources {
+			l.prune(now)
+		}
+		lim = rate.NewLimiter(l.perSource, l.sourceBurst)
+		l.sources[source] = lim
+	}
+	return lim
+}
+
+// prune removes the sources whose bucket is full again, mu must be held
+func (l *rateLimiter) prune(now time.Time) {
+	for source, lim := range l.sources {
+		if lim.TokensAt(now) >= float64(l.sourceBurst) {
+			delete(l.sources, source)
+		}
+	}
+}
+
+// reserve takes a token of the source and of the global bucket. If one of
+// them is empty nothing is taken and the time until a request would be
+// allowed is returned.
+func (l *rateLimiter) reserve(source string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var reservations []*rate.Reservation
+	if l.perSource > 0 {
+		reservations = append(reservations, l.source(source, now).ReserveN(now, 1))
+	}
+	if l.global != nil {
+		reservations = append(reservations, l.global.ReserveN(now, 1))
+	}
+	var wait time.Duration
+	for _, r := range reservations {
+		wait = max(wait, r.DelayFrom(now))
+	}
+	if wait > 0 {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+	return wait
+}
+
+// writeRateLimited sends a 429 with a Retry-After header and a JSON-RPC
+// error body
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error": map[string]any{
+			"code":    -32000,
+			"message": "too many requests",
+			"data": map[string]any{
+				"retry_after": seconds,
+			},
+		},
+	})
+}
+
+// middleware rejects the requests which exceed the limits before their body
+// is read
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := l.reserve(sourceIP(r)); wait > 0 {
+			slog.Debug("rejected request over the rate limit", "source", sourceIP(r), "retry_after", wait)
+			writeRateLimited(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
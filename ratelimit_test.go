@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(1, 2, 0, 0)
+	l.now = func() time.Time { return now }
+
+	handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	call := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, call("10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusOK, call("10.0.0.1:1235").Code)
+	rec := call("10.0.0.1:1236")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32000,"message":"too many requests","data":{"retry_after":1}}}`, rec.Body.String())
+	// other sources aren't affected
+	assert.Equal(t, http.StatusOK, call("[::1]:1234").Code)
+
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, call("10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusTooManyRequests, call("10.0.0.1:1234").Code)
+}
+
+func TestRateLimiterGlobal(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(1, 1, 1, 2)
+	l.now = func() time.Time { return now }
+
+	assert.Zero(t, l.reserve("10.0.0.1"))
+	assert.Zero(t, l.reserve("10.0.0.2"))
+	assert.Equal(t, time.Second, l.reserve("10.0.0.3"))
+	// a rejected request doesn't use up the bucket of its source
+	now = now.Add(time.Second)
+	assert.Zero(t, l.reserve("10.0.0.3"))
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newRateLimiter(1, 1, 0, 0)
+	l.now = func() time.Time { return now }
+	l.reserve("10.0.0.1")
+	now = now.Add(time.Second)
+	l.reserve("10.0.0.2")
+	l.prune(now)
+	assert.NotContains(t, l.sources, "10.0.0.1")
+	assert.Contains(t, l.sources, "10.0.0.2")
+}
+
+func TestNewRateLimiterDisabled(t *testing.T) {
+	assert.Nil(t, newRateLimiter(0, 10, 0, 10))
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/openSUSE/systemd-mcp/remoteauth"
+	"github.com/spf13/viper"
+)
+
+// rbacRole are the tools of a role and the units its write tools may
+// change, no units means all units the unit policy allows
+type rbacRole struct {
+	Tools []string `mapstructure:"tools"`
+	Units []string `mapstructure:"units"`
+}
+
+// rbacBinding gives the role to the identities matching any of its fields.
+// Claims are matched against the JWT claims, a claim with a list matches if
+// it contains the value. Users carry the source of the identity as prefix,
+// so that e.g. an api key can't be named like an OIDC user: apikey:NAME,
+// cert:NAME, oidc:ISSUER:USER or unix:NAME for the peers of peercred
+// listeners and the user running the server over stdio. Roles are the token
+// roles and uids the peers of peercred listeners or, over stdio, the user
+// running the server.
+type rbacBinding struct {
+	Role   string            `mapstructure:"role"`
+	Claims map[string]string `mapstructure:"claims"`
+	Users  []string          `mapstructure:"users"`
+	Roles  []string          `mapstructure:"roles"`
+	UIDs   []uint32          `mapstructure:"uids"`
+}
+
+// rbacPolicy maps identities to named roles and roles to tools and units.
+// It replaces mcp:read, mcp:write and the mcp-admin role of tokens, polkit
+// is still asked over stdio.
+type rbacPolicy struct {
+	Roles    map[string]rbacRole `mapstructure:"roles"`
+	Bindings []rbacBinding       `mapstructure:"bindings"`
+}
+
+// loadRBACPolicy reads the policy file in any format of the config file
+func loadRBACPolicy(file string) (*rbacPolicy, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("couldn't read the rbac policy: %w", err)
+	}
+	policy := &rbacPolicy{}
+	if err := v.UnmarshalExact(policy); err != nil {
+		return nil, fmt.Errorf("invalid rbac policy %s: %w", file, err)
+	}
+	if len(policy.Roles) == 0 {
+		return nil, fmt.Errorf("rbac policy %s has no roles", file)
+	}
+	for name, role := range policy.Roles {
+		for _, pattern := range role.Units {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("role %s has the invalid unit pattern %q", name, pattern)
+			}
+		}
+	}
+	for i, binding := range policy.Bindings {
+		if _, ok := policy.Roles[binding.Role]; !ok {
+			return nil, fmt.Errorf("binding %d names the unknown role %q", i+1, binding.Role)
+		}
+		if len(binding.Claims) == 0 && len(binding.Users) == 0 && len(binding.Roles) == 0 && len(binding.UIDs) == 0 {
+			return nil, fmt.Errorf("binding %d of role %s matches nobody", i+1, binding.Role)
+		}
+		for _, user := range binding.Users {
+			if !slices.ContainsFunc(identitySources, func(source string) bool { return strings.HasPrefix(user, source) }) {
+				return nil, fmt.Errorf("binding %d names the user %q without one of the sources %s", i+1, user, strings.Join(identitySources, ", "))
+			}
+		}
+	}
+	return policy, nil
+}
+
+// checkTools checks the tools of the roles against the known tools
+func (p *rbacPolicy) checkTools(tools []string) error {
+	for name, role := range p.Roles {
+		for _, tool := range role.Tools {
+			if tool != "*" && !slices.Contains(tools, tool) {
+				return fmt.Errorf("role %s names the unknown tool %s", name, tool)
+			}
+		}
+	}
+	return nil
+}
+
+// identitySources are the prefixes of the users of the bindings
+var identitySources = []string{"apikey:", "cert:", "oidc:", "unix:"}
+
+// rbacIdentity is the caller of a request, user is prefixed by its source
+type rbacIdentity struct {
+	user   string
+	roles  []string
+	claims map[string]any
+	uid    *uint32
+}
+
+// identity returns the caller of the token, without a token it's the user
+// running the server whose calls polkit authorizes
+func identity(ti *auth.TokenInfo) rbacIdentity {
+	if ti == nil {
+		uid := uint32(os.Getuid())
+		id := rbacIdentity{uid: &uid, user: "unix:" + strconv.Itoa(os.Getuid())}
+		if u, err := user.Current(); err == nil {
+			id.user = "unix:" + u.Username
+		}
+		return id
+	}
+	id := rbacIdentity{}
+	id.roles, _ = ti.Extra["roles"].([]string)
+	id.claims, _ = ti.Extra["claims"].(map[string]any)
+	uid, peer := ti.Extra["peer_uid"].(uint32)
+	if peer {
+		id.uid = &uid
+	}
+	// a user without a known source matches no binding
+	switch {
+	case ti.UserID == "":
+	case ti.Extra["api_key"] != nil:
+		id.user = "apikey:" + ti.UserID
+	case ti.Extra["client_cert"] != nil:
+		id.user = "cert:" + ti.UserID
+	case peer:
+		id.user = "unix:" + ti.UserID
+	case id.claims != nil:
+		issuer, _ := id.claims["iss"].(string)
+		id.user = "oidc:" + issuer + ":" + ti.UserID
+	}
+	return id
+}
+
+func claimMatches(claim any, value string) bool {
+	switch v := claim.(type) {
+	case []any:
+		return slices.ContainsFunc(v, func(item any) bool { return fmt.Sprint(item) == value })
+	case nil:
+		return false
+	}
+	return fmt.Sprint(claim) == value
+}
+
+func (b *rbacBinding) matches(id rbacIdentity) bool {
+	if id.user != "" && slices.Contains(b.Users, id.user) {
+		return true
+	}
+	if slices.ContainsFunc(b.Roles, func(role string) bool { return slices.Contains(id.roles, role) }) {
+		return true
+	}
+	if id.uid != nil && slices.Contains(b.UIDs, *id.uid) {
+		return true
+	}
+	for claim, value := range b.Claims {
+		if claimMatches(id.claims[claim], value) {
+			return true
+		}
+	}
+	return false
+}
+
+// roles returns the names of the roles of the caller
+func (p *rbacPolicy) roles(id rbacIdentity) []string {
+	var names []string
+	for _, binding := range p.Bindings {
+		if binding.matches(id) && !slices.Contains(names, binding.Role) {
+			names = append(names, binding.Role)
+		}
+	}
+	return names
+}
+
+// grant returns whether one of the roles grants the tool and the unit
+// patterns the tool is restricted to, nil if any granting role has none
+func (p *rbacPolicy) grant(tool string, roles []string) (bool, []string) {
+	if slices.Contains(unrestrictedTools, tool) {
+		return true, nil
+	}
+	granted := false
+	var units []string
+	for _, name := range roles {
+		role := p.Roles[name]
+		if !slices.Contains(role.Tools, tool) && !slices.Contains(role.Tools, "*") {
+			continue
+		}
+		if len(role.Units) == 0 {
+			return true, nil
+		}
+		granted = true
+		units = append(units, role.Units...)
+	}
+	return granted, units
+}
+
+// Middleware hides the tools none of the roles of the caller grants from
+// the tool list and rejects calls of them. The write tools may only change
+// the units of the granting roles. Requests of noauth listeners aren't
+// affected.
+func (p *rbacPolicy) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		var ti *auth.TokenInfo
+		if extra := req.GetExtra(); extra != nil {
+			ti = extra.TokenInfo
+		}
+		if ti != nil && ti.Extra["listener"] == "noauth" {
+			return next(ctx, method, req)
+		}
+		id := identity(ti)
+		roles := p.roles(id)
+		switch method {
+		case "tools/call":
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok {
+				return next(ctx, method, req)
+			}
+			granted, units := p.grant(call.Params.Name, roles)
+			if !granted {
+				slog.WarnContext(ctx, "tool denied by rbac policy", "audit", "role_denied", "tool", call.Params.Name, "user", id.user, "roles", roles)
+				return nil, fmt.Errorf("calling %s isn't granted by the roles %s", call.Params.Name, strings.Join(roles, ", "))
+			}
+			if units != nil {
+				ctx = systemd.WithUnitPatterns(ctx, units)
+			}
+			if ti != nil {
+				ctx = remoteauth.WithRoleGrant(ctx)
+			}
+			return next(ctx, method, req)
+		case "resources/read", "resources/subscribe":
+			// a resource needs the grant of the tool which reads the same data
+			tool := resourceTool(req)
+			if granted, _ := p.grant(tool, roles); !granted {
+				slog.Warn("resource denied by rbac policy", "audit", "role_denied", "tool", tool, "user", id.user, "roles", roles)
+				return nil, fmt.Errorf("reading the resource isn't granted by the roles %s", strings.Join(roles, ", "))
+			}
+			if ti != nil {
+				ctx = remoteauth.WithRoleGrant(ctx)
+			}
+			return next(ctx, method, req)
+		case "tools/list":
+			res, err := next(ctx, method, req)
+			if list, ok := res.(*mcp.ListToolsResult); ok && err == nil {
+				list.Tools = slices.DeleteFunc(list.Tools, func(tool *mcp.Tool) bool {
+					granted, _ := p.grant(tool.Name, roles)
+					return !granted
+				})
+			}
+			return res, err
+		}
+		return next(ctx, method, req)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/openSUSE/systemd-mcp/remoteauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRBACPolicy = `
+roles:
+  viewer:
+    tools: [list_log, list_loaded_units]
+  web-operator:
+    tools: [list_loaded_units, change_unit_state]
+    units: ["nginx*.service"]
+  admin:
+    tools: ["*"]
+bindings:
+  - role: viewer
+    claims:
+      groups: ops
+  - role: web-operator
+    users: ["oidc:https://idp.example.com:alice"]
+  - role: admin
+    roles: [mcp-admin]
+    uids: [0]
+`
+
+func writeRBACPolicy(t *testing.T, policy string) string {
+	file := filepath.Join(t.TempDir(), "rbac.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(policy), 0o600))
+	return file
+}
+
+func TestLoadRBACPolicy(t *testing.T) {
+	policy, err := loadRBACPolicy(writeRBACPolicy(t, testRBACPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nginx*.service"}, policy.Roles["web-operator"].Units)
+	assert.Equal(t, []uint32{0}, policy.Bindings[2].UIDs)
+	assert.NoError(t, policy.checkTools([]string{"list_log", "list_loaded_units", "change_unit_state"}))
+	assert.Error(t, policy.checkTools([]string{"list_log"}))
+
+	for _, invalid := range []string{
+		"bindings: []",
+		"roles:\n  viewer:\n    tools: [list_log]\nbindings:\n  - role: unknown\n    users: [unix:alice]",
+		"roles:\n  viewer:\n    tools: [list_log]\nbindings:\n  - role: viewer",
+		"roles:\n  viewer:\n    tools: [list_log]\n    units: ['[']",
+		"roles:\n  viewer:\n    tools: [list_log]\n    unknown: true",
+		"roles:\n  viewer:\n    tools: [list_log]\nbindings:\n  - role: viewer\n    users: [alice]",
+	} {
+		_, err := loadRBACPolicy(writeRBACPolicy(t, invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRBACRoles(t *testing.T) {
+	policy, err := loadRBACPolicy(writeRBACPolicy(t, testRBACPolicy))
+	require.NoError(t, err)
+	uid := uint32(0)
+	assert.Equal(t, []string{"viewer"}, policy.roles(rbacIdentity{user: "oidc:https://idp.example.com:bob", claims: map[string]any{"groups": []any{"dev", "ops"}}}))
+	assert.Equal(t, []string{"web-operator"}, policy.roles(rbacIdentity{user: "oidc:https://idp.example.com:alice"}))
+	assert.Equal(t, []string{"admin"}, policy.roles(rbacIdentity{uid: &uid}))
+	assert.Empty(t, policy.roles(rbacIdentity{user: "oidc:https://idp.example.com:mallory", claims: map[string]any{"groups": "dev"}}))
+
+	granted, units := policy.grant("change_unit_state", []string{"viewer", "web-operator"})
+	assert.True(t, granted)
+	assert.Equal(t, []string{"nginx*.service"}, units)
+	// a role without units lifts the restriction of the others
+	granted, units = policy.grant("change_unit_state", []string{"web-operator", "admin"})
+	assert.True(t, granted)
+	assert.Nil(t, units)
+	granted, _ = policy.grant("change_unit_state", []string{"viewer"})
+	assert.False(t, granted)
+}
+
+func TestRBACMiddleware(t *testing.T) {
+	policy, err := loadRBACPolicy(writeRBACPolicy(t, testRBACPolicy))
+	require.NoError(t, err)
+	var writeAllowed bool
+	var unitErr error
+	next := func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method == "tools/list" {
+			return &mcp.ListToolsResult{Tools: []*mcp.Tool{{Name: "list_log"}, {Name: "list_loaded_units"}, {Name: "change_unit_state"}}}, nil
+		}
+		// the role replaces mcp:write and the mcp-admin role
+		writeAllowed, _ = (&remoteauth.Oauth2Auth{}).IsWriteAuthorized(ctx)
+		unitErr = systemd.CheckUnit(ctx, "sshd-keygen.service")
+		return &mcp.CallToolResult{}, nil
+	}
+	handler := policy.Middleware(next)
+	alice := &auth.TokenInfo{UserID: "alice", Extra: map[string]any{"claims": map[string]any{"iss": "https://idp.example.com"}}}
+	call := func(name string, ti *auth.TokenInfo) error {
+		_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+			Params: &mcp.CallToolParamsRaw{Name: name},
+			Extra:  &mcp.RequestExtra{TokenInfo: ti},
+		})
+		return err
+	}
+
+	assert.NoError(t, call("change_unit_state", alice))
+	assert.True(t, writeAllowed)
+	assert.Error(t, unitErr, "units outside of the role are denied")
+	assert.Error(t, call("list_log", alice))
+	// an api key or a user of another issuer named like the user of the binding
+	assert.Error(t, call("change_unit_state", &auth.TokenInfo{UserID: "alice", Extra: map[string]any{"api_key": "alice"}}))
+	assert.Error(t, call("change_unit_state", &auth.TokenInfo{UserID: "alice", Extra: map[string]any{"claims": map[string]any{"iss": "https://evil.example.net"}}}))
+	bob := &auth.TokenInfo{UserID: "bob", Extra: map[string]any{"claims": map[string]any{"groups": "ops"}}}
+	assert.Error(t, call("change_unit_state", bob))
+	assert.NoError(t, call("list_log", bob))
+	// noauth listeners aren't affected
+	assert.NoError(t, call("change_unit_state", &auth.TokenInfo{Extra: map[string]any{"listener": "noauth"}}))
+
+	res, err := handler(context.Background(), "tools/list", &mcp.ListToolsRequest{Extra: &mcp.RequestExtra{TokenInfo: bob}})
+	require.NoError(t, err)
+	tools := res.(*mcp.ListToolsResult).Tools
+	require.Len(t, tools, 2)
+	assert.Equal(t, "list_log", tools[0].Name)
+}
+
+func TestRBACIdentity(t *testing.T) {
+	uid := uint32(1000)
+	for _, tt := range []struct {
+		ti   *auth.TokenInfo
+		want string
+	}{
+		{&auth.TokenInfo{UserID: "deploy", Extra: map[string]any{"api_key": "deploy"}}, "apikey:deploy"},
+		{&auth.TokenInfo{UserID: "host1", Extra: map[string]any{"client_cert": "CN=host1"}}, "cert:host1"},
+		{&auth.TokenInfo{UserID: "alice", Extra: map[string]any{"peer_uid": uid}}, "unix:alice"},
+		{&auth.TokenInfo{UserID: "alice", Extra: map[string]any{"claims": map[string]any{"iss": "https://idp.example.com"}}}, "oidc:https://idp.example.com:alice"},
+		{&auth.TokenInfo{UserID: "alice", Extra: map[string]any{}}, ""},
+	} {
+		assert.Equal(t, tt.want, identity(tt.ti).user)
+	}
+	assert.Contains(t, identity(nil).user, "unix:")
+}
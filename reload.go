@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/file"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/resultcache"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/spf13/viper"
+)
+
+// logFile is the file of --logfile, it's opened again on a reload so that
+// a rotated file is left alone
+type logFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	l := &logFile{path: path}
+	if err := l.reopen(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// reopen opens the path again, the previous file is kept if that fails
+func (l *logFile) reopen() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f = f
+	return nil
+}
+
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// applyPolicies sets the path and unit policies and the actions which need
+// a confirmation from the configuration
+func applyPolicies() error {
+	if err := systemd.SetConfirmActions(viper.GetStringSlice("confirm-actions")); err != nil {
+		return err
+	}
+	pathPolicy := &file.PathPolicy{
+		Allow: viper.GetStringSlice("file-allow"),
+		Deny:  viper.GetStringSlice("file-deny"),
+	}
+	if viper.GetBool("file-default-deny") {
+		pathPolicy.Deny = append(pathPolicy.Deny, file.DefaultDenyPatterns()...)
+	}
+	file.SetPathPolicy(pathPolicy)
+	unitPolicy := &systemd.UnitPolicy{
+		Allow: viper.GetStringSlice("unit-allow"),
+		Deny:  viper.GetStringSlice("unit-deny"),
+	}
+	if viper.GetBool("unit-default-deny") {
+		unitPolicy.Deny = append(unitPolicy.Deny, systemd.DefaultDenyUnits()...)
+	}
+	systemd.SetUnitPolicy(unitPolicy)
+	return nil
+}
+
+// configuredTools returns the tools of --enabled-tools, all tools if it
+// isn't set
+func configuredTools(allTools []string) []string {
+	if !viper.IsSet("enabled-tools") {
+		return allTools
+	}
+	return viper.GetStringSlice("enabled-tools")
+}
+
+// reloader applies the config file again on SIGHUP or the dbus method
+// Reload without dropping the sessions: the tools are enabled and disabled,
+// which the clients are notified of, the policies are replaced and the log
+// file is opened again. Flags given on the command line keep their value.
+type reloader struct {
+	server *mcp.Server
+	tools  []struct {
+		Tool     *mcp.Tool
+		Register func(server *mcp.Server, tool *mcp.Tool)
+	}
+	// filter drops the tools which can't be called, like the ones without
+	// a scope
+	filter func(enabled []string) []string
+	log    *logFile
+	// the cached results are dropped, as the new policies may deny them
+	cache *resultcache.Cache
+
+	mu      sync.Mutex
+	enabled []string
+}
+
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+	if r.log != nil {
+		if err := r.log.reopen(); err != nil {
+			slog.Warn("keeping the previous log file", "error", err)
+		}
+	}
+	if err := applyPolicies(); err != nil {
+		return err
+	}
+	r.cache.Flush()
+
+	var allTools []string
+	for _, tool := range r.tools {
+		allTools = append(allTools, tool.Tool.Name)
+	}
+	enabled := configuredTools(allTools)
+	if r.filter != nil {
+		enabled = r.filter(enabled)
+	}
+	var removed, added []string
+	for _, name := range r.enabled {
+		if !slices.Contains(enabled, name) {
+			removed = append(removed, name)
+		}
+	}
+	if len(removed) > 0 {
+		r.server.RemoveTools(removed...)
+	}
+	for _, tool := range r.tools {
+		if slices.Contains(enabled, tool.Tool.Name) && !slices.Contains(r.enabled, tool.Tool.Name) {
+			tool.Register(r.server, tool.Tool)
+			added = append(added, tool.Tool.Name)
+		}
+	}
+	r.enabled = enabled
+	slog.Warn("configuration reloaded", "audit", "config_reloaded", "config", viper.ConfigFileUsed(), "tools_added", added, "tools_removed", removed)
+	return nil
+}
+
+// watch reloads on SIGHUP until the context ends
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-hup:
+			if err := r.reload(); err != nil {
+				slog.Error("couldn't reload the configuration", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
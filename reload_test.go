@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/file"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "systemd-mcp.log")
+	l, err := openLogFile(path)
+	require.NoError(t, err)
+	defer l.Close()
+	_, err = l.Write([]byte("before\n"))
+	require.NoError(t, err)
+
+	// logrotate moves the file away
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, l.reopen())
+	_, err = l.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "before\n", string(rotated))
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", string(current))
+}
+
+func TestReload(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("enabled-tools: [first, second]\n"), 0644))
+	viper.SetConfigFile(config)
+	require.NoError(t, viper.ReadInConfig())
+	pathPolicy, unitPolicy := file.GetPathPolicy(), systemd.GetUnitPolicy()
+	t.Cleanup(func() {
+		viper.Reset()
+		file.SetPathPolicy(pathPolicy)
+		systemd.SetUnitPolicy(unitPolicy)
+		systemd.SetConfirmActions(nil)
+	})
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	r := &reloader{server: server}
+	for _, name := range []string{"first", "second", "third"} {
+		r.tools = append(r.tools, struct {
+			Tool     *mcp.Tool
+			Register func(server *mcp.Server, tool *mcp.Tool)
+		}{
+			Tool: &mcp.Tool{Name: name, InputSchema: &jsonschema.Schema{Type: "object"}},
+			Register: func(server *mcp.Server, tool *mcp.Tool) {
+				server.AddTool(tool, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+					return &mcp.CallToolResult{}, nil
+				})
+			},
+		})
+	}
+	r.enabled = configuredTools([]string{"first", "second", "third"})
+	for _, tool := range r.tools[:2] {
+		tool.Register(server, tool.Tool)
+	}
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err := server.Connect(context.Background(), serverTransport, nil)
+	require.NoError(t, err)
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(context.Background(), clientTransport, nil)
+	require.NoError(t, err)
+	defer cs.Close()
+	listTools := func() []string {
+		res, err := cs.ListTools(context.Background(), nil)
+		require.NoError(t, err)
+		var names []string
+		for _, tool := range res.Tools {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []string{"first", "second"}, listTools())
+
+	require.NoError(t, os.WriteFile(config, []byte("enabled-tools: [second, third]\nunit-deny: [nginx.service]\n"), 0644))
+	require.NoError(t, r.reload())
+	assert.ElementsMatch(t, []string{"second", "third"}, listTools(), "the session sees the changed tools")
+	assert.Error(t, systemd.GetUnitPolicy().Check("nginx.service"))
+
+	// a broken configuration keeps the running one
+	require.NoError(t, os.WriteFile(config, []byte("enabled-tools: [first]\nconfirm-actions: [explode]\n"), 0644))
+	assert.Error(t, r.reload())
+	assert.ElementsMatch(t, []string{"second", "third"}, listTools())
+	assert.Error(t, systemd.GetUnitPolicy().Check("nginx.service"))
+}
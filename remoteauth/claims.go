@@ -0,0 +1,92 @@
+package remoteauth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// RequiredClaim is a claim every token needs. A claim with a list has to
+// contain the value, without a value the claim only has to be present and
+// not false or empty.
+type RequiredClaim struct {
+	Name  string
+	Value string
+}
+
+// TokenRequirements are the audiences and claims of the accepted tokens
+type TokenRequirements struct {
+	// Audiences of which the aud claim needs one, defaults to Audience
+	Audiences []string
+	Claims    []RequiredClaim
+}
+
+// ParseRequiredClaims parses claim or claim=value entries, e.g. azp=mcp-agent
+// or email_verified=true
+func ParseRequiredClaims(entries []string) ([]RequiredClaim, error) {
+	var claims []RequiredClaim
+	for _, entry := range entries {
+		name, value, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid required claim %q, expected claim or claim=value", entry)
+		}
+		claims = append(claims, RequiredClaim{Name: name, Value: value})
+	}
+	return claims, nil
+}
+
+func (c RequiredClaim) String() string {
+	if c.Value == "" {
+		return c.Name
+	}
+	return c.Name + "=" + c.Value
+}
+
+func (c RequiredClaim) matches(claim any) bool {
+	switch v := claim.(type) {
+	case nil:
+		return false
+	case []any:
+		if c.Value == "" {
+			return len(v) > 0
+		}
+		return slices.ContainsFunc(v, func(item any) bool { return fmt.Sprint(item) == c.Value })
+	case bool:
+		if c.Value == "" {
+			return v
+		}
+	case string:
+		if c.Value == "" {
+			return v != ""
+		}
+	}
+	return c.Value == "" || fmt.Sprint(claim) == c.Value
+}
+
+// checkClaims returns an error for the first required claim the token
+// doesn't have
+func checkClaims(claims map[string]any, required []RequiredClaim) error {
+	for _, c := range required {
+		if !c.matches(claims[c.Name]) {
+			return fmt.Errorf("token lacks the required claim %s: %w", c, auth.ErrInvalidToken)
+		}
+	}
+	return nil
+}
+
+// audiences returns the accepted audiences
+func (r *TokenRequirements) audiences() []string {
+	if r == nil || len(r.Audiences) == 0 {
+		return []string{Audience}
+	}
+	return r.Audiences
+}
+
+func (r *TokenRequirements) claims() []RequiredClaim {
+	if r == nil {
+		return nil
+	}
+	return r.Claims
+}
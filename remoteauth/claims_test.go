@@ -0,0 +1,108 @@
+package remoteauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseRequiredClaims(t *testing.T) {
+	claims, err := ParseRequiredClaims([]string{"azp=mcp-agent", "email_verified", " groups=ops "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RequiredClaim{{"azp", "mcp-agent"}, {"email_verified", ""}, {"groups", "ops"}}
+	if len(claims) != len(want) {
+		t.Fatalf("expected %v, got %v", want, claims)
+	}
+	for i := range want {
+		if claims[i] != want[i] {
+			t.Errorf("expected %v, got %v", want[i], claims[i])
+		}
+	}
+	for _, invalid := range []string{"", "=ops", "email verified"} {
+		if _, err := ParseRequiredClaims([]string{invalid}); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestCheckClaims(t *testing.T) {
+	claims := map[string]any{
+		"azp":            "mcp-agent",
+		"email_verified": true,
+		"groups":         []any{"dev", "ops"},
+		"verified":       false,
+	}
+	for _, c := range []struct {
+		required string
+		ok       bool
+	}{
+		{"azp=mcp-agent", true},
+		{"azp=other", false},
+		{"email_verified", true},
+		{"email_verified=true", true},
+		{"verified", false},
+		{"groups=ops", true},
+		{"groups=admins", false},
+		{"missing", false},
+	} {
+		required, _ := ParseRequiredClaims([]string{c.required})
+		if err := checkClaims(claims, required); (err == nil) != c.ok {
+			t.Errorf("%s: expected ok=%v, got %v", c.required, c.ok, err)
+		}
+	}
+}
+
+func TestVerifyJWTRequirements(t *testing.T) {
+	issuer := newTestIssuer(t, "controller")
+	sign := func(claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		claims["scope"] = "mcp:read"
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = issuer.kid
+		signed, err := token.SignedString(issuer.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	a := &Oauth2Auth{
+		KeyFunc: issuer.keyfunc(t),
+		Requirements: &TokenRequirements{
+			Audiences: []string{"https://mcp.example.com", "systemd-mcp-prod"},
+			Claims:    []RequiredClaim{{Name: "azp", Value: "mcp-agent"}},
+		},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	if _, err := a.VerifyJWT(context.Background(), sign(jwt.MapClaims{"aud": []string{"other", "systemd-mcp-prod"}, "azp": "mcp-agent"}), r); err != nil {
+		t.Errorf("token for a configured audience rejected: %v", err)
+	}
+	if _, err := a.VerifyJWT(context.Background(), sign(jwt.MapClaims{"aud": Audience, "azp": "mcp-agent"}), r); err == nil {
+		t.Error("token for the default audience accepted")
+	}
+	if _, err := a.VerifyJWT(context.Background(), sign(jwt.MapClaims{"aud": "systemd-mcp-prod", "azp": "other"}), r); err == nil {
+		t.Error("token without the required claim accepted")
+	}
+}
+
+func TestIntrospectRequirements(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": true, "scope": "mcp:read", "sub": "bob", "exp": 4102444800, "aud": "systemd-mcp-prod", "azp": "other"}`))
+	}))
+	defer server.Close()
+
+	i := NewIntrospector(server.URL, "systemd-mcp", "s3cret", 0, server.Client())
+	i.Requirements = &TokenRequirements{Audiences: []string{"systemd-mcp-prod"}}
+	if _, err := i.Introspect(context.Background(), "opaque"); err != nil {
+		t.Errorf("token for a configured audience rejected: %v", err)
+	}
+	i.Requirements.Claims = []RequiredClaim{{Name: "azp", Value: "mcp-agent"}}
+	if _, err := i.Introspect(context.Background(), "opaque"); err == nil {
+		t.Error("token without the required claim accepted")
+	}
+}
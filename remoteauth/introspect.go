@@ -0,0 +1,224 @@
+package remoteauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// how tokens are validated
+const (
+	ValidationAuto          = "auto" // opaque tokens are introspected, JWTs are validated locally
+	ValidationJWT           = "jwt"
+	ValidationIntrospection = "introspection"
+)
+
+// ErrIntrospectionFailed is returned if the introspection endpoint couldn't
+// be asked, which says nothing about the token
+var ErrIntrospectionFailed = errors.New("token introspection failed")
+
+// cached results are only pruned if more tokens are cached
+const maxCachedTokens = 1000
+
+// IntrospectionConfig configures the validation of opaque tokens
+type IntrospectionConfig struct {
+	Validation string // auto, jwt or introspection
+	// Endpoint defaults to the introspection_endpoint of the controller
+	Endpoint     string
+	ClientID     string
+	ClientSecret string
+	CacheTTL     time.Duration
+	// IntrospectJWT introspects JWTs after their local validation too
+	IntrospectJWT bool
+	// RevocationList is the url of the revoked token ids of the IdP
+	RevocationList    string
+	RevocationRefresh time.Duration
+}
+
+type introspectionResponse struct {
+	Active      bool   `json:"active"`
+	Scope       string `json:"scope"`
+	Username    string `json:"username"`
+	Sub         string `json:"sub"`
+	Exp         int64  `json:"exp"`
+	Aud         any    `json:"aud"` // a string or a list of strings
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+}
+
+type cachedToken struct {
+	info    *auth.TokenInfo
+	expires time.Time
+}
+
+// Introspector validates opaque tokens at the token introspection endpoint
+// of the authorization server (RFC 7662). Active tokens are cached for
+// CacheTTL, so that not every request reaches the endpoint.
+type Introspector struct {
+	Endpoint     string
+	ClientID     string
+	ClientSecret string
+	CacheTTL     time.Duration
+	Client       *http.Client
+	// Requirements are checked like for JWTs
+	Requirements *TokenRequirements
+	now          func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedToken
+}
+
+func NewIntrospector(endpoint, clientID, clientSecret string, cacheTTL time.Duration, client *http.Client) *Introspector {
+	return &Introspector{
+		Endpoint:     endpoint,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		CacheTTL:     cacheTTL,
+		Client:       client,
+		now:          time.Now,
+		cache:        make(map[string]cachedToken),
+	}
+}
+
+// looksLikeJWT checks for the three dot separated parts of a JWT, opaque
+// tokens are random strings
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func audiences(aud any) []string {
+	switch v := aud.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var auds []string
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	}
+	return nil
+}
+
+// cached returns the cached result of the token, the key is a hash so that
+// the tokens aren't kept in memory
+func (i *Introspector) cached(key string) *auth.TokenInfo {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entry, ok := i.cache[key]
+	if !ok {
+		return nil
+	}
+	if !i.now().Before(entry.expires) {
+		delete(i.cache, key)
+		return nil
+	}
+	return entry.info
+}
+
+func (i *Introspector) store(key string, info *auth.TokenInfo) {
+	if i.CacheTTL <= 0 {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	now := i.now()
+	if len(i.cache) >= maxCachedTokens {
+		for k, entry := range i.cache {
+			if !now.Before(entry.expires) {
+				delete(i.cache, k)
+			}
+		}
+		if len(i.cache) >= maxCachedTokens {
+			clear(i.cache)
+		}
+	}
+	expires := now.Add(i.CacheTTL)
+	if info.Expiration.Before(expires) {
+		expires = info.Expiration
+	}
+	i.cache[key] = cachedToken{info: info, expires: expires}
+}
+
+// Introspect asks the endpoint whether the token is active and returns its
+// scopes, roles and user like for a JWT
+func (i *Introspector) Introspect(ctx context.Context, token string) (*auth.TokenInfo, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	if info := i.cached(key); info != nil {
+		return info, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.Endpoint,
+		strings.NewReader(url.Values{"token": {token}, "token_type_hint": {"access_token"}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(i.ClientID), url.QueryEscape(i.ClientSecret))
+	resp, err := i.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIntrospectionFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		slog.Warn("token introspection failed", "status", resp.Status, "url", i.Endpoint)
+		return nil, fmt.Errorf("%w: %s", ErrIntrospectionFailed, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIntrospectionFailed, err)
+	}
+	var result introspectionResponse
+	var claims map[string]any
+	if err := errors.Join(json.Unmarshal(body, &result), json.Unmarshal(body, &claims)); err != nil {
+		return nil, fmt.Errorf("%w: couldn't decode the response: %w", ErrIntrospectionFailed, err)
+	}
+
+	if !result.Active {
+		return nil, fmt.Errorf("token isn't active: %w", auth.ErrInvalidToken)
+	}
+	accepted := i.Requirements.audiences()
+	if auds := audiences(result.Aud); len(auds) > 0 && !slices.ContainsFunc(auds, func(aud string) bool { return slices.Contains(accepted, aud) }) {
+		return nil, fmt.Errorf("token audience %v doesn't contain %s: %w", auds, strings.Join(accepted, " or "), auth.ErrInvalidToken)
+	}
+	if err := checkClaims(claims, i.Requirements.claims()); err != nil {
+		return nil, err
+	}
+	if result.Exp == 0 {
+		return nil, fmt.Errorf("token has no expiration: %w", auth.ErrInvalidToken)
+	}
+	userID := result.Username
+	if userID == "" {
+		userID = result.Sub
+	}
+	info := &auth.TokenInfo{
+		Scopes:     strings.Fields(result.Scope),
+		Expiration: time.Unix(result.Exp, 0),
+		UserID:     userID,
+		Extra: map[string]any{
+			"roles":  result.RealmAccess.Roles,
+			"claims": claims,
+		},
+	}
+	slog.Debug("token successfully introspected", "scopes", info.Scopes, "roles", result.RealmAccess.Roles, "user", userID)
+	i.store(key, info)
+	return info, nil
+}
@@ -0,0 +1,93 @@
+package remoteauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+func TestIntrospect(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if id, secret, ok := r.BasicAuth(); !ok || id != "systemd-mcp" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.PostFormValue("token") {
+		case "active":
+			w.Write([]byte(`{"active": true, "scope": "mcp:read mcp:write", "username": "alice", "exp": 4102444800,
+				"aud": ["account", "systemd-mcp-server"], "realm_access": {"roles": ["mcp-admin"]}}`))
+		case "other-audience":
+			w.Write([]byte(`{"active": true, "scope": "mcp:read", "sub": "bob", "exp": 4102444800, "aud": "account"}`))
+		default:
+			w.Write([]byte(`{"active": false}`))
+		}
+	}))
+	defer server.Close()
+
+	i := NewIntrospector(server.URL, "systemd-mcp", "s3cret", time.Minute, server.Client())
+	info, err := i.Introspect(context.Background(), "active")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.UserID != "alice" || !slices.Equal(info.Scopes, []string{"mcp:read", "mcp:write"}) || !slices.Equal(info.Extra["roles"].([]string), []string{"mcp-admin"}) {
+		t.Errorf("unexpected token info %+v", info)
+	}
+	if _, err := i.Introspect(context.Background(), "active"); err != nil || requests != 1 {
+		t.Errorf("expected the cached result, got %v after %d requests", err, requests)
+	}
+
+	for _, token := range []string{"revoked", "other-audience"} {
+		if _, err := i.Introspect(context.Background(), token); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("expected an invalid token for %s, got %v", token, err)
+		}
+	}
+
+	i = NewIntrospector(server.URL, "systemd-mcp", "wrong", time.Minute, server.Client())
+	if _, err := i.Introspect(context.Background(), "active"); !errors.Is(err, ErrIntrospectionFailed) || errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("expected a failed introspection, got %v", err)
+	}
+}
+
+func TestIntrospectCacheExpires(t *testing.T) {
+	now := time.Unix(4102444700, 0)
+	i := NewIntrospector("", "", "", time.Minute, nil)
+	i.now = func() time.Time { return now }
+	// the cache never outlives the token
+	i.store("key", &auth.TokenInfo{Expiration: now.Add(30 * time.Second)})
+	if i.cached("key") == nil {
+		t.Fatal("expected a cached token")
+	}
+	now = now.Add(30 * time.Second)
+	if i.cached("key") != nil {
+		t.Error("expected the cached token to expire with the token")
+	}
+}
+
+func TestVerifyTokenIntrospection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active": true, "scope": "mcp:read", "sub": "bob", "exp": 4102444800}`))
+	}))
+	defer server.Close()
+
+	a := &Oauth2Auth{
+		Introspector: NewIntrospector(server.URL, "systemd-mcp", "s3cret", 0, server.Client()),
+		Validation:   ValidationIntrospection,
+	}
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	// with the fixed validation even tokens looking like a JWT are introspected
+	info, err := a.VerifyToken(context.Background(), "a.b.c", r)
+	if err != nil || info.UserID != "bob" {
+		t.Errorf("expected the introspected token, got %+v, %v", info, err)
+	}
+	if looksLikeJWT("opaque-token") || !looksLikeJWT("a.b.c") {
+		t.Error("looksLikeJWT mismatch")
+	}
+}
@@ -0,0 +1,128 @@
+package remoteauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+const (
+	DefaultJWKSRefresh    = time.Hour
+	DefaultJWKSUnknownKID = time.Minute
+	jwksRetryMin          = 5 * time.Second
+)
+
+// SigningMethods are the algorithms accepted for JWTs, the key of the kid
+// in the key set has to be one for the algorithm
+var SigningMethods = []string{
+	jwt.SigningMethodRS256.Alg(), jwt.SigningMethodRS384.Alg(), jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(), jwt.SigningMethodPS384.Alg(), jwt.SigningMethodPS512.Alg(),
+	jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// JWKSConfig configures how the key sets of the issuers are kept up to date
+type JWKSConfig struct {
+	// Refresh is the interval in which the key set is fetched in the
+	// background, failed fetches are retried earlier with a backoff
+	Refresh time.Duration
+	// UnknownKID is the minimal interval between the fetches for tokens
+	// with an unknown kid, so that rotated keys are used before the next
+	// refresh. 0 disables these fetches.
+	UnknownKID time.Duration
+}
+
+// jwksRefresher fetches the key set in the background
+type jwksRefresher struct {
+	uri      string
+	refresh  time.Duration
+	retryMin time.Duration
+	fetch    func() error
+}
+
+// run fetches the key set every refresh interval until the context is done.
+// After a failed fetch it's retried with an exponential backoff starting at
+// retryMin, which is never longer than the interval.
+func (j *jwksRefresher) run(ctx context.Context, failed bool) {
+	backoff := j.retryMin
+	for {
+		wait := j.refresh
+		if failed {
+			wait = min(backoff, j.refresh)
+			backoff *= 2
+		} else {
+			backoff = j.retryMin
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		err := j.fetch()
+		if err != nil {
+			slog.Warn("couldn't refresh the key set", "url", j.uri, "retry", min(backoff, j.refresh), "error", err)
+		} else if failed {
+			slog.Info("key set refreshed", "url", j.uri)
+		}
+		failed = err != nil
+	}
+}
+
+// NewJWKS returns the keys of the key set at uri. The key set is refreshed
+// in the background until the context is done. The server starts even if
+// the key set can't be fetched, the fetch is retried then.
+func NewJWKS(ctx context.Context, uri string, client *http.Client, cfg JWKSConfig) (keyfunc.Keyfunc, error) {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = DefaultJWKSRefresh
+	}
+	options := jwkset.HTTPClientStorageOptions{
+		Client:      client,
+		Ctx:         ctx,
+		HTTPTimeout: 10 * time.Second,
+		// the fetches for unknown kids report their errors here
+		RefreshErrorHandler: func(ctx context.Context, err error) {
+			slog.Warn("couldn't fetch the key set", "url", uri, "error", err)
+		},
+		Storage: jwkset.NewMemoryStorage(),
+	}
+	first := options
+	first.NoErrorReturnFirstHTTPReq = true
+	remote, err := jwkset.NewStorageFromHTTP(uri, first)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key set url: %w", err)
+	}
+	clientOptions := jwkset.HTTPClientOptions{
+		HTTPURLs: map[string]jwkset.Storage{uri: remote},
+		// tokens with unknown kids fail instead of waiting for the rate limit
+		RateLimitWaitMax: time.Second,
+	}
+	if cfg.UnknownKID > 0 {
+		clientOptions.RefreshUnknownKID = rate.NewLimiter(rate.Every(cfg.UnknownKID), 1)
+	}
+	storage, err := jwkset.NewHTTPClient(clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := remote.KeyReadAll(ctx)
+	refresher := &jwksRefresher{
+		uri:      uri,
+		refresh:  cfg.Refresh,
+		retryMin: jwksRetryMin,
+		fetch: func() error {
+			// the fetch replaces all keys of the shared storage
+			_, err := jwkset.NewStorageFromHTTP(uri, options)
+			return err
+		},
+	}
+	go refresher.run(ctx, err != nil || len(keys) == 0)
+	return keyfunc.New(keyfunc.Options{Ctx: ctx, Storage: storage})
+}
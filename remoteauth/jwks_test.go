@@ -0,0 +1,138 @@
+package remoteauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksServer serves a key set whose keys can be rotated
+type jwksServer struct {
+	mu    sync.Mutex
+	keys  []jwkset.JWKMarshal
+	fail  bool
+	calls int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(jwkset.JWKSMarshal{Keys: s.keys})
+}
+
+func (s *jwksServer) set(t *testing.T, kid string, key crypto.Signer, alg jwkset.ALG) {
+	jwk, err := jwkset.NewJWKFromKey(key.Public(), jwkset.JWKOptions{Metadata: jwkset.JWKMetadataOptions{KID: kid, ALG: alg, USE: jwkset.UseSig}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = []jwkset.JWKMarshal{jwk.Marshal()}
+}
+
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, key crypto.Signer) string {
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"aud":   Audience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "mcp:read",
+		"sub":   "alice",
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestNewJWKSRotation(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	keys := &jwksServer{}
+	keys.set(t, "ec", ecKey, jwkset.AlgES256)
+	server := httptest.NewServer(keys)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kf, err := NewJWKS(ctx, server.URL, server.Client(), JWKSConfig{UnknownKID: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Oauth2Auth{KeyFunc: kf}
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	if _, err := a.VerifyJWT(ctx, signWith(t, jwt.SigningMethodES256, "ec", ecKey), r); err != nil {
+		t.Fatalf("ES256 token rejected: %v", err)
+	}
+
+	// the issuer rotates to an EdDSA key
+	keys.set(t, "ed", edKey, jwkset.AlgEdDSA)
+	time.Sleep(5 * time.Millisecond)
+	if _, err := a.VerifyJWT(ctx, signWith(t, jwt.SigningMethodEdDSA, "ed", edKey), r); err != nil {
+		t.Fatalf("token of the rotated key rejected: %v", err)
+	}
+	if _, err := a.VerifyJWT(ctx, signWith(t, jwt.SigningMethodES256, "ec", ecKey), r); err == nil {
+		t.Error("token of the removed key accepted")
+	}
+}
+
+func TestNewJWKSUnreachable(t *testing.T) {
+	keys := &jwksServer{fail: true}
+	server := httptest.NewServer(keys)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := NewJWKS(ctx, server.URL, server.Client(), JWKSConfig{}); err != nil {
+		t.Fatalf("server has to start without the key set: %v", err)
+	}
+}
+
+func TestJWKSRefresherBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	var fetched []time.Time
+	j := &jwksRefresher{
+		uri:      "test",
+		refresh:  time.Hour,
+		retryMin: 10 * time.Millisecond,
+		fetch: func() error {
+			fetched = append(fetched, time.Now())
+			if len(fetched) < 3 {
+				return errors.New("unavailable")
+			}
+			close(done)
+			return nil
+		},
+	}
+	start := time.Now()
+	go j.run(ctx, true)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed fetches weren't retried before the refresh interval")
+	}
+	// 10ms, 20ms and 40ms
+	if elapsed := fetched[2].Sub(start); elapsed < 70*time.Millisecond {
+		t.Errorf("retries without backoff, third fetch after %v", elapsed)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"github.com/MicahParks/keyfunc/v3"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 const (
@@ -28,19 +30,36 @@ var (
 type Oauth2Auth struct {
 	KeyFunc keyfunc.Keyfunc // Check oauth2 token func
 	JwksUri string
-	claims  jwt.MapClaims
+	// Introspector validates opaque tokens, nil if only JWTs are accepted
+	Introspector *Introspector
+	Validation   string
+	// Issuers are the keys of further trusted issuers by their iss claim.
+	// With them the iss claim has to be Issuer, the issuer of the
+	// controller, or one of them.
+	Issuer  string
+	Issuers map[string]keyfunc.Keyfunc
+	// Revocations rejects JWTs by their jti before they expire, nil if the
+	// IdP has no revocation list
+	Revocations *RevocationList
+	// IntrospectJWT introspects valid JWTs of the controller too, so that
+	// revoked ones are rejected once their cached result expired
+	IntrospectJWT bool
+	// Requirements are the audiences and claims of the accepted tokens,
+	// nil accepts the default audience
+	Requirements *TokenRequirements
 }
 
-func NewOutah2Auth() Oauth2Auth {
-	a := Oauth2Auth{
-		claims: make(jwt.MapClaims),
-	}
-	return a
+// OpenIDConfig is the part of the OpenID Provider configuration which is
+// used by the server
+type OpenIDConfig struct {
+	Issuer                string `json:"issuer"`
+	JwksURI               string `json:"jwks_uri"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
 }
 
-// getJwksUri gets the jwks_uri from the OpenID Provider configuration information.
+// GetOpenIDConfig gets the OpenID Provider configuration information.
 // See https://openid.net/specs/openid-connect-discovery-1_0.html
-func GetJwksURI(issuer string, skipVerify bool) (string, error) {
+func GetOpenIDConfig(issuer string, skipVerify bool) (*OpenIDConfig, error) {
 	client := &http.Client{Timeout: 10 * time.Second}
 	if skipVerify {
 		client.Transport = &http.Transport{
@@ -49,32 +68,77 @@ func GetJwksURI(issuer string, skipVerify bool) (string, error) {
 	}
 	resp, err := client.Get(issuer + "/.well-known/openid-configuration")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		slog.Warn("failed to get openid-configuration", "status", resp.Status, "url", issuer+"/.well-known/openid-configuration")
-		return "", fmt.Errorf("failed to get openid-configuration: %s", resp.Status)
+		return nil, fmt.Errorf("failed to get openid-configuration: %s", resp.Status)
 	}
 
-	openIDConfig := struct {
-		JwksURI string `json:"jwks_uri"`
-	}{}
+	openIDConfig := &OpenIDConfig{}
+	err = json.NewDecoder(resp.Body).Decode(openIDConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return openIDConfig, nil
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&openIDConfig)
+// getJwksUri gets the jwks_uri from the OpenID Provider configuration information.
+func GetJwksURI(issuer string, skipVerify bool) (string, error) {
+	openIDConfig, err := GetOpenIDConfig(issuer, skipVerify)
 	if err != nil {
 		return "", err
 	}
-
 	return openIDConfig.JwksURI, nil
 }
 
+// VerifyToken validates JWTs locally and introspects opaque tokens, or
+// uses only one of both if the validation is fixed
+func (a *Oauth2Auth) VerifyToken(ctx context.Context, tokenString string, r *http.Request) (*auth.TokenInfo, error) {
+	if a.Introspector != nil && (a.Validation == ValidationIntrospection || !looksLikeJWT(tokenString)) {
+		info, err := a.Introspector.Introspect(ctx, tokenString)
+		if err != nil {
+			slog.Debug("couldn't introspect token", "error", err, "remote_addr", r.RemoteAddr)
+			return nil, err
+		}
+		return info, nil
+	}
+	return a.VerifyJWT(ctx, tokenString, r)
+}
+
+// keyfunc returns the keys of the issuer of the token, the issuer is only
+// checked if further issuers are trusted
+func (a *Oauth2Auth) keyfunc(tokenString string) (jwt.Keyfunc, []jwt.ParserOption, error) {
+	if len(a.Issuers) == 0 {
+		return a.KeyFunc.Keyfunc, nil, nil
+	}
+	unverified := make(jwt.MapClaims)
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, unverified); err != nil {
+		return nil, nil, err
+	}
+	iss, _ := unverified.GetIssuer()
+	if iss == a.Issuer {
+		return a.KeyFunc.Keyfunc, []jwt.ParserOption{jwt.WithIssuer(iss)}, nil
+	}
+	if kf, ok := a.Issuers[iss]; ok {
+		return kf.Keyfunc, []jwt.ParserOption{jwt.WithIssuer(iss)}, nil
+	}
+	return nil, nil, fmt.Errorf("issuer %q isn't trusted", iss)
+}
+
 func (a *Oauth2Auth) VerifyJWT(ctx context.Context, tokenString string, r *http.Request) (*auth.TokenInfo, error) {
 	slog.Debug("verifier received token", "value", tokenString, "remote_addr", r.RemoteAddr)
+	keyFunc, options, err := a.keyfunc(tokenString)
+	if err != nil {
+		slog.Debug("couldn't find the keys of the token issuer", "error", err, "remote_addr", r.RemoteAddr)
+		return nil, fmt.Errorf("%v: %w", auth.ErrInvalidToken, err)
+	}
 	claims := make(jwt.MapClaims)
-	token, err := jwt.ParseWithClaims(tokenString, claims, a.KeyFunc.Keyfunc, jwt.WithAudience(Audience),
-		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name}))
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc, append(options, jwt.WithAudience(a.Requirements.audiences()...),
+		jwt.WithValidMethods(SigningMethods))...)
 	if err != nil {
 		slog.Debug("couldn't parse or validate token", "error", err, "remote_addr", r.RemoteAddr)
 		return nil, fmt.Errorf("%v: %w", auth.ErrInvalidToken, err)
@@ -102,27 +166,127 @@ func (a *Oauth2Auth) VerifyJWT(ctx context.Context, tokenString string, r *http.
 			}
 		}
 
-		slog.Debug("token successfully validated", "scopes", strings.Split(scopes, " "), "roles", roles, "remote_addr", r.RemoteAddr)
+		// the user is recorded in the audit log
+		userID, _ := claims["preferred_username"].(string)
+		if userID == "" {
+			userID, _ = claims.GetSubject()
+		}
+
+		if err := checkClaims(claims, a.Requirements.claims()); err != nil {
+			slog.Debug("token rejected", "error", err, "user", userID, "remote_addr", r.RemoteAddr)
+			return nil, err
+		}
+		if err := a.checkRevoked(ctx, tokenString, claims, userID); err != nil {
+			return nil, err
+		}
+
+		slog.Debug("token successfully validated", "scopes", strings.Split(scopes, " "), "roles", roles, "user", userID, "remote_addr", r.RemoteAddr)
 		return &auth.TokenInfo{
 			Scopes:     strings.Split(scopes, " "),
 			Expiration: expireTime.Time,
+			UserID:     userID,
 			Extra: map[string]any{
-				"roles": roles,
+				"roles":  roles,
+				"claims": map[string]any(claims),
 			},
 		}, nil
 	}
 	return nil, auth.ErrInvalidToken
 }
 
+// checkRevoked rejects the JWTs on the revocation list and the ones which
+// the introspection endpoint reports as inactive. Tokens of further trusted
+// issuers are only checked against the list.
+func (a *Oauth2Auth) checkRevoked(ctx context.Context, tokenString string, claims jwt.MapClaims, userID string) error {
+	jti, _ := claims["jti"].(string)
+	if a.Revocations != nil && a.Revocations.Revoked(jti) {
+		slog.Warn("revoked token rejected", "audit", "token_revoked", "user", userID, "jti", jti)
+		return fmt.Errorf("token %s was revoked: %w", jti, auth.ErrInvalidToken)
+	}
+	iss, _ := claims.GetIssuer()
+	if !a.IntrospectJWT || a.Introspector == nil || (len(a.Issuers) > 0 && iss != a.Issuer) {
+		return nil
+	}
+	if _, err := a.Introspector.Introspect(ctx, tokenString); err != nil {
+		if !errors.Is(err, ErrIntrospectionFailed) {
+			slog.Warn("inactive token rejected", "audit", "token_revoked", "user", userID, "jti", jti)
+		}
+		return err
+	}
+	return nil
+}
+
+type requestTokenKey struct{}
+
+// WithRequestToken puts the token info of the current MCP request in the
+// context. The context of a tool handler is derived from the HTTP request
+// which created the session, so its token info is the one of the first
+// request and not the token the client sent with the call.
+func WithRequestToken(ctx context.Context, ti *auth.TokenInfo) context.Context {
+	return context.WithValue(ctx, requestTokenKey{}, ti)
+}
+
+// tokenInfo returns the token info of the current request
+func tokenInfo(ctx context.Context) *auth.TokenInfo {
+	if ti, ok := ctx.Value(requestTokenKey{}).(*auth.TokenInfo); ok {
+		return ti
+	}
+	return auth.TokenInfoFromContext(ctx)
+}
+
+// RequestTokenMiddleware passes the token info of every request to its
+// handler, requests over stdio have none
+func RequestTokenMiddleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if extra := req.GetExtra(); extra != nil {
+			ctx = WithRequestToken(ctx, extra.TokenInfo)
+		}
+		return next(ctx, method, req)
+	}
+}
+
+type scopeGrantKey struct{}
+
+// WithScopeGrant marks that a scope of the tool scope mapping grants the
+// called tool to the token, which replaces mcp:read and mcp:write
+func WithScopeGrant(ctx context.Context, ti *auth.TokenInfo) context.Context {
+	return context.WithValue(ctx, scopeGrantKey{}, ti)
+}
+
+func scopeGrant(ctx context.Context) *auth.TokenInfo {
+	ti, _ := ctx.Value(scopeGrantKey{}).(*auth.TokenInfo)
+	return ti
+}
+
+type roleGrantKey struct{}
+
+// WithRoleGrant marks that a role of the rbac policy grants the called tool
+// to the token, which replaces the scopes and the mcp-admin role
+func WithRoleGrant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, roleGrantKey{}, true)
+}
+
+func roleGrant(ctx context.Context) bool {
+	granted, _ := ctx.Value(roleGrantKey{}).(bool)
+	return granted
+}
+
 // check if write is authorized via mcp:write and mcp-admin role
 func (a *Oauth2Auth) IsWriteAuthorized(ctx context.Context) (bool, error) {
-	ti := auth.TokenInfoFromContext(ctx)
+	if roleGrant(ctx) {
+		return true, nil
+	}
+	ti := tokenInfo(ctx)
+	granted := scopeGrant(ctx)
+	if granted != nil {
+		ti = granted
+	}
 	if ti == nil {
 		slog.Debug("IsWriteAuthorized: NO TOKEN INFO")
 		return false, fmt.Errorf("no token info in context")
 	}
 	
-	hasWriteScope := slices.Contains(ti.Scopes, "mcp:write")
+	hasWriteScope := granted != nil || slices.Contains(ti.Scopes, "mcp:write")
 	hasAdminRole := false
 	if rolesRaw, ok := ti.Extra["roles"]; ok {
 		if roles, ok := rolesRaw.([]string); ok {
@@ -139,7 +303,10 @@ func (a *Oauth2Auth) IsWriteAuthorized(ctx context.Context) (bool, error) {
 
 // check if read is authorized via mcp:read
 func (a *Oauth2Auth) IsReadAuthorized(ctx context.Context) (bool, error) {
-	ti := auth.TokenInfoFromContext(ctx)
+	if scopeGrant(ctx) != nil || roleGrant(ctx) {
+		return true, nil
+	}
+	ti := tokenInfo(ctx)
 	if ti == nil {
 		return false, fmt.Errorf("no token info in context")
 	}
@@ -1,9 +1,21 @@
 package remoteauth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 func TestGetJwksURI(t *testing.T) {
@@ -71,3 +83,112 @@ func TestGetJwksURI(t *testing.T) {
 		}
 	})
 }
+
+// testIssuer signs tokens with its own key
+type testIssuer struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T, kid string) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIssuer{kid: kid, key: key}
+}
+
+func (i *testIssuer) keyfunc(t *testing.T) keyfunc.Keyfunc {
+	n := base64.RawURLEncoding.EncodeToString(i.key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes())
+	kf, err := keyfunc.NewJWKSetJSON([]byte(fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":%q,"alg":"RS256","use":"sig","n":%q,"e":%q}]}`, i.kid, n, e)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kf
+}
+
+func (i *testIssuer) sign(t *testing.T, iss string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   iss,
+		"aud":   Audience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "mcp:read",
+		"sub":   "alice",
+	})
+	token.Header["kid"] = i.kid
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyJWTTrustedIssuers(t *testing.T) {
+	corporate := newTestIssuer(t, "corporate")
+	local := newTestIssuer(t, "local")
+	a := &Oauth2Auth{
+		KeyFunc: corporate.keyfunc(t),
+		Issuer:  "https://idp.example.com",
+		Issuers: map[string]keyfunc.Keyfunc{"https://controller.local": local.keyfunc(t)},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+
+	for _, token := range []string{corporate.sign(t, "https://idp.example.com"), local.sign(t, "https://controller.local")} {
+		if info, err := a.VerifyJWT(context.Background(), token, r); err != nil || info.UserID != "alice" {
+			t.Errorf("expected a valid token, got %+v, %v", info, err)
+		}
+	}
+	// the key has to belong to the issuer of the token
+	if _, err := a.VerifyJWT(context.Background(), local.sign(t, "https://idp.example.com"), r); err == nil {
+		t.Error("expected a token signed by another issuer to be rejected")
+	}
+	if _, err := a.VerifyJWT(context.Background(), local.sign(t, "https://evil.example.com"), r); err == nil {
+		t.Error("expected a token of an untrusted issuer to be rejected")
+	}
+
+	// without further issuers the iss claim isn't checked
+	a.Issuers = nil
+	if _, err := a.VerifyJWT(context.Background(), corporate.sign(t, "http://idp.internal"), r); err != nil {
+		t.Errorf("expected a valid token, got %v", err)
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	// the context of the session keeps the token of the first request
+	var sessionCtx context.Context
+	handler := auth.RequireBearerToken(func(ctx context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+		return &auth.TokenInfo{Scopes: []string{"mcp:read", "mcp:write"}, Expiration: time.Now().Add(time.Hour),
+			Extra: map[string]any{"roles": []string{"mcp-admin"}}}, nil
+	}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionCtx = r.Context()
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	r.Header.Set("Authorization", "Bearer first")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	a := &Oauth2Auth{}
+	if ok, err := a.IsWriteAuthorized(sessionCtx); !ok {
+		t.Fatalf("expected the session token to allow write, got %v", err)
+	}
+
+	var handlerCtx context.Context
+	call := RequestTokenMiddleware(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		handlerCtx = ctx
+		return nil, nil
+	})
+	readOnly := &auth.TokenInfo{Scopes: []string{"mcp:read"}, Expiration: time.Now().Add(time.Hour)}
+	call(sessionCtx, "tools/call", &mcp.CallToolRequest{Extra: &mcp.RequestExtra{TokenInfo: readOnly}})
+	if ok, _ := a.IsWriteAuthorized(handlerCtx); ok {
+		t.Error("expected the token of the call to deny write")
+	}
+	if ok, err := a.IsReadAuthorized(handlerCtx); !ok {
+		t.Errorf("expected the token of the call to allow read, got %v", err)
+	}
+
+	// a call without a token doesn't fall back to the session token
+	call(sessionCtx, "tools/call", &mcp.CallToolRequest{Extra: &mcp.RequestExtra{}})
+	if ok, _ := a.IsReadAuthorized(handlerCtx); ok {
+		t.Error("expected a call without a token to be denied")
+	}
+}
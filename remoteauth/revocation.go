@@ -0,0 +1,91 @@
+package remoteauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultRevocationRefresh = time.Minute
+
+// RevocationList are the ids (jti) of revoked tokens, fetched periodically
+// from an endpoint of the IdP which returns them as JSON array of strings.
+// JWTs with a revoked id are rejected before they expire.
+type RevocationList struct {
+	URL     string
+	Client  *http.Client
+	Refresh time.Duration
+
+	mu      sync.RWMutex
+	revoked map[string]bool
+}
+
+// NewRevocationList fetches the list once and then every refresh interval
+// until the context is done. If a later fetch fails the last list is kept.
+func NewRevocationList(ctx context.Context, url string, client *http.Client, refresh time.Duration) (*RevocationList, error) {
+	if refresh <= 0 {
+		refresh = DefaultRevocationRefresh
+	}
+	l := &RevocationList{URL: url, Client: client, Refresh: refresh}
+	if err := l.fetch(ctx); err != nil {
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(l.Refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.fetch(ctx); err != nil {
+					slog.Warn("couldn't refresh the token revocation list, keeping the last one", "url", l.URL, "error", err)
+				}
+			}
+		}
+	}()
+	return l, nil
+}
+
+func (l *RevocationList) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := l.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch the revocation list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("couldn't fetch the revocation list: %s", resp.Status)
+	}
+	var ids []string
+	if err := json.NewDecoder(resp.Body).Decode(&ids); err != nil {
+		return fmt.Errorf("couldn't decode the revocation list: %w", err)
+	}
+	revoked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		revoked[id] = true
+	}
+	l.mu.Lock()
+	l.revoked = revoked
+	l.mu.Unlock()
+	slog.Debug("token revocation list fetched", "url", l.URL, "revoked", len(revoked))
+	return nil
+}
+
+// Revoked checks whether the token id is on the list
+func (l *RevocationList) Revoked(jti string) bool {
+	if jti == "" {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.revoked[jti]
+}
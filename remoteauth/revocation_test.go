@@ -0,0 +1,111 @@
+package remoteauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func (i *testIssuer) signID(t *testing.T, jti string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"aud":   Audience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "mcp:read",
+		"sub":   "alice",
+		"jti":   jti,
+	})
+	token.Header["kid"] = i.kid
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestRevocationList(t *testing.T) {
+	var list atomic.Value
+	list.Store(`["revoked"]`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(list.Load().(string)))
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	revocations, err := NewRevocationList(ctx, server.URL, server.Client(), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := newTestIssuer(t, "controller")
+	a := &Oauth2Auth{KeyFunc: issuer.keyfunc(t), Revocations: revocations}
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	if _, err := a.VerifyJWT(ctx, issuer.signID(t, "revoked"), r); err == nil {
+		t.Error("revoked token accepted")
+	}
+	if _, err := a.VerifyJWT(ctx, issuer.signID(t, "later"), r); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	list.Store(`["revoked", "later"]`)
+	deadline := time.Now().Add(5 * time.Second)
+	for !revocations.Revoked("later") {
+		if time.Now().After(deadline) {
+			t.Fatal("revocation list wasn't refreshed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := a.VerifyJWT(ctx, issuer.signID(t, "later"), r); err == nil {
+		t.Error("token revoked after the refresh accepted")
+	}
+
+	// a failed refresh keeps the last list
+	list.Store(`invalid`)
+	time.Sleep(30 * time.Millisecond)
+	if !revocations.Revoked("revoked") {
+		t.Error("failed refresh dropped the revocations")
+	}
+}
+
+func TestRevocationListUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	if _, err := NewRevocationList(context.Background(), server.URL, server.Client(), time.Minute); err == nil {
+		t.Error("expected an error without the first revocation list")
+	}
+}
+
+func TestVerifyJWTIntrospected(t *testing.T) {
+	var active atomic.Bool
+	active.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if active.Load() {
+			w.Write([]byte(`{"active": true, "scope": "mcp:read", "sub": "alice", "exp": 4102444800}`))
+			return
+		}
+		w.Write([]byte(`{"active": false}`))
+	}))
+	defer server.Close()
+
+	issuer := newTestIssuer(t, "controller")
+	a := &Oauth2Auth{
+		KeyFunc:       issuer.keyfunc(t),
+		Introspector:  NewIntrospector(server.URL, "systemd-mcp", "s3cret", 0, server.Client()),
+		IntrospectJWT: true,
+	}
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	token := issuer.signID(t, "id")
+	if _, err := a.VerifyToken(context.Background(), token, r); err != nil {
+		t.Fatalf("active token rejected: %v", err)
+	}
+	active.Store(false)
+	if _, err := a.VerifyToken(context.Background(), token, r); err == nil {
+		t.Error("token revoked at the IdP accepted")
+	}
+}
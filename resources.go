@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	auth "github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/file"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/journal"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+)
+
+const resourceScheme = "systemd://"
+
+// number of log entries of the journal resource
+const resourceLogEntries = 100
+
+// how often the subscribed resources are checked for changes
+var resourcePollInterval = 5 * time.Second
+
+// resourceTools are the tools which read the same data as the kinds of
+// resources. A kind is only offered if its tool is enabled and reading it
+// needs the grant of the tool in the scope mapping and the rbac policy.
+var resourceTools = map[string]string{
+	"file":    "get_file",
+	"dropins": "get_file",
+	"journal": "list_log",
+	"config":  "list_config_settings",
+}
+
+// parseResourceURI splits the URI of a resource into its kind and the name
+// of the unit or daemon
+func parseResourceURI(uri string) (kind, name string, err error) {
+	rest, ok := strings.CutPrefix(uri, resourceScheme)
+	if !ok {
+		return "", "", fmt.Errorf("unknown resource: %s", uri)
+	}
+	parts := strings.Split(rest, "/")
+	switch {
+	case len(parts) == 3 && parts[0] == "unit" && slices.Contains([]string{"file", "dropins", "journal"}, parts[2]):
+		kind, name = parts[2], parts[1]
+	case len(parts) == 2 && parts[0] == "config":
+		kind, name = "config", parts[1]
+	default:
+		return "", "", fmt.Errorf("unknown resource: %s", uri)
+	}
+	if name, err = url.PathUnescape(name); err != nil || name == "" {
+		return "", "", fmt.Errorf("invalid name in resource: %s", uri)
+	}
+	return kind, name, nil
+}
+
+// resourceTool returns the tool whose grant is needed to read or subscribe
+// a resource, empty for unknown resources
+func resourceTool(req mcp.Request) string {
+	var uri string
+	switch r := req.(type) {
+	case *mcp.ReadResourceRequest:
+		if r.Params != nil {
+			uri = r.Params.URI
+		}
+	case *mcp.SubscribeRequest:
+		if r.Params != nil {
+			uri = r.Params.URI
+		}
+	}
+	kind, _, err := parseResourceURI(uri)
+	if err != nil {
+		return ""
+	}
+	return resourceTools[kind]
+}
+
+type watchedResource struct {
+	subscribers int
+	state       string
+}
+
+// unitResources offers the unit files, drop-ins and logs of the units and
+// the configuration of the daemons as resources. The subscribed resources
+// are polled and their subscribers notified when they change.
+type unitResources struct {
+	server *mcp.Server
+	conn   *systemd.Connection
+	log    *journal.HostLog
+	// the journal of the session is read if set
+	states *sessionStates
+	auth   auth.AuthKeeper
+	// state returns a value which changes with the resource
+	state func(ctx context.Context, kind, name string) string
+
+	mu      sync.Mutex
+	kinds   []string
+	watched map[string]*watchedResource
+}
+
+func newUnitResources(authorization auth.AuthKeeper) *unitResources {
+	r := &unitResources{
+		auth:    authorization,
+		watched: make(map[string]*watchedResource),
+	}
+	r.state = r.currentState
+	return r
+}
+
+// register adds the resources whose tools are enabled and returns whether
+// any was added
+func (r *unitResources) register(server *mcp.Server, enabledTools []string) bool {
+	r.server = server
+	enabled := func(kind string) bool {
+		if (kind != "journal" && r.conn == nil) || (kind == "journal" && r.log == nil) {
+			return false
+		}
+		return slices.Contains(enabledTools, resourceTools[kind])
+	}
+	if enabled("file") {
+		server.AddResourceTemplate(&mcp.ResourceTemplate{
+			Name:        "unit_file",
+			Title:       "Unit file",
+			URITemplate: resourceScheme + "unit/{name}/file",
+			Description: "The file the unit was loaded from, like 'systemctl cat' without the drop-ins.",
+			MIMEType:    "text/plain",
+		}, r.read)
+		r.kinds = append(r.kinds, "file")
+	}
+	if enabled("dropins") {
+		server.AddResourceTemplate(&mcp.ResourceTemplate{
+			Name:        "unit_dropins",
+			Title:       "Unit drop-ins",
+			URITemplate: resourceScheme + "unit/{name}/dropins",
+			Description: "The drop-ins of the unit in the order systemd applies them, each one after a comment with its path.",
+			MIMEType:    "text/plain",
+		}, r.read)
+		r.kinds = append(r.kinds, "dropins")
+	}
+	if enabled("journal") {
+		server.AddResourceTemplate(&mcp.ResourceTemplate{
+			Name:        "unit_journal",
+			Title:       "Unit log",
+			URITemplate: resourceScheme + "unit/{name}/journal",
+			Description: fmt.Sprintf("The last %d log entries of the unit, like list_log.", resourceLogEntries),
+			MIMEType:    "application/json",
+		}, r.read)
+		r.kinds = append(r.kinds, "journal")
+	}
+	if enabled("config") {
+		server.AddResourceTemplate(&mcp.ResourceTemplate{
+			Name:        "daemon_config",
+			Title:       "Daemon configuration",
+			URITemplate: resourceScheme + "config/{daemon}",
+			Description: fmt.Sprintf("The effective settings of a daemon (%s) with the file which sets them, like list_config_settings.", strings.Join(systemd.ValidConfigDaemons(), ", ")),
+			MIMEType:    "application/json",
+		}, r.read)
+		for _, daemon := range systemd.ValidConfigDaemons() {
+			server.AddResource(&mcp.Resource{
+				Name:     daemon + "_config",
+				Title:    "Configuration of " + daemon,
+				URI:      resourceScheme + "config/" + daemon,
+				MIMEType: "application/json",
+			}, r.read)
+		}
+		r.kinds = append(r.kinds, "config")
+	}
+	return len(r.kinds) > 0
+}
+
+// parse returns the kind and name of a resource which was registered
+func (r *unitResources) parse(uri string) (kind, name string, err error) {
+	kind, name, err = parseResourceURI(uri)
+	if err == nil && !slices.Contains(r.kinds, kind) {
+		err = fmt.Errorf("unknown resource: %s", uri)
+	}
+	return kind, name, err
+}
+
+func (r *unitResources) read(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	kind, name, err := r.parse(uri)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	slog.Debug("resource read", "uri", uri)
+	contents := &mcp.ResourceContents{URI: uri, MIMEType: "text/plain"}
+	switch kind {
+	case "file", "dropins":
+		if allowed, err := r.auth.IsReadAuthorized(ctx); err != nil {
+			return nil, err
+		} else if !allowed {
+			return nil, fmt.Errorf("calling method was canceled by user")
+		}
+		files, err := r.conn.UnitFiles(ctx, name)
+		if err != nil {
+			return nil, mcp.ResourceNotFoundError(uri)
+		}
+		if kind == "file" {
+			if files.Fragment == "" {
+				return nil, mcp.ResourceNotFoundError(uri)
+			}
+			if contents.Text, err = file.ReadText(ctx, files.Fragment); err != nil {
+				return nil, err
+			}
+			break
+		}
+		var text strings.Builder
+		for _, path := range files.DropIns {
+			content, err := file.ReadText(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&text, "# %s\n%s", path, content)
+			if !strings.HasSuffix(content, "\n") {
+				text.WriteString("\n")
+			}
+		}
+		contents.Text = text.String()
+	case "journal":
+		contents.MIMEType = "application/json"
+		call := &mcp.CallToolRequest{Session: req.Session, Extra: req.Extra}
+		log := r.log
+		if r.states != nil {
+			var done func()
+			log, done = r.states.log(req.Session)
+			defer done()
+		}
+		contents.Text, err = toolText(log.ListLog(ctx, call, &journal.ListLogParams{Unit: []string{name}, ExactUnit: true, Count: resourceLogEntries}))
+	case "config":
+		contents.MIMEType = "application/json"
+		contents.Text, err = toolText(r.conn.ListConfigSettings(ctx, nil, &systemd.ListConfigSettingsParams{Daemon: name}))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{contents}}, nil
+}
+
+// toolText returns the text of the result of a tool
+func toolText(res *mcp.CallToolResult, _ any, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, content := range res.Content {
+		if text, ok := content.(*mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	if res.IsError {
+		return "", errors.New(strings.Join(texts, "\n"))
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// currentState returns the paths, sizes and modification times of the files
+// of a resource, or the cursor of the newest log entry
+func (r *unitResources) currentState(ctx context.Context, kind, name string) string {
+	var paths []string
+	switch kind {
+	case "file", "dropins":
+		files, err := r.conn.UnitFiles(ctx, name)
+		if err != nil {
+			return ""
+		}
+		paths = files.DropIns
+		if kind == "file" {
+			paths = []string{files.Fragment}
+		}
+	case "config":
+		paths, _ = systemd.ConfigFiles(name)
+	case "journal":
+		cursor, err := r.log.LastCursor(ctx, name)
+		if err != nil {
+			slog.Debug("couldn't get the newest log entry", "unit", name, "error", err)
+		}
+		return cursor
+	}
+	var state strings.Builder
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&state, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&state, "%s:missing\n", path)
+		}
+	}
+	return state.String()
+}
+
+// subscribe watches a resource for the session, which has to be authorized
+// to read it
+func (r *unitResources) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	uri := req.Params.URI
+	kind, name, err := r.parse(uri)
+	if err != nil {
+		return err
+	}
+	if allowed, err := r.auth.IsReadAuthorized(ctx); err != nil {
+		return err
+	} else if !allowed {
+		return fmt.Errorf("calling method was canceled by user")
+	}
+	state := r.state(ctx, kind, name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.watched[uri]
+	if !ok {
+		w = &watchedResource{state: state}
+		r.watched[uri] = w
+	}
+	w.subscribers++
+	return nil
+}
+
+func (r *unitResources) unsubscribe(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if w, ok := r.watched[req.Params.URI]; ok {
+		w.subscribers--
+		if w.subscribers <= 0 {
+			delete(r.watched, req.Params.URI)
+		}
+	}
+	return nil
+}
+
+// watch polls the subscribed resources until the context is done
+func (r *unitResources) watch(ctx context.Context) {
+	ticker := time.NewTicker(resourcePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.poll(ctx)
+	}
+}
+
+// poll notifies the subscribers of the resources which changed since the
+// last poll
+func (r *unitResources) poll(ctx context.Context) {
+	r.mu.Lock()
+	uris := slices.Sorted(maps.Keys(r.watched))
+	r.mu.Unlock()
+	for _, uri := range uris {
+		kind, name, _ := parseResourceURI(uri)
+		state := r.state(ctx, kind, name)
+		r.mu.Lock()
+		w, ok := r.watched[uri]
+		changed := ok && w.state != state
+		if changed {
+			w.state = state
+		}
+		r.mu.Unlock()
+		if changed {
+			slog.Debug("resource changed", "uri", uri)
+			r.server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: uri})
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseResourceURI(t *testing.T) {
+	kind, name, err := parseResourceURI("systemd://unit/getty@tty1.service/file")
+	require.NoError(t, err)
+	assert.Equal(t, "file", kind)
+	assert.Equal(t, "getty@tty1.service", name)
+	kind, name, err = parseResourceURI("systemd://unit/foo%2Fbar.service/journal")
+	require.NoError(t, err)
+	assert.Equal(t, "journal", kind)
+	assert.Equal(t, "foo/bar.service", name)
+	kind, name, err = parseResourceURI("systemd://config/journald")
+	require.NoError(t, err)
+	assert.Equal(t, "config", kind)
+	assert.Equal(t, "journald", name)
+
+	for _, uri := range []string{"file:///etc/passwd", "systemd://unit/sshd.service", "systemd://unit/sshd.service/config", "systemd://unit//file", "systemd://config/journald/x"} {
+		_, _, err := parseResourceURI(uri)
+		assert.Error(t, err, uri)
+	}
+	assert.Equal(t, "list_log", resourceTool(&mcp.ReadResourceRequest{Params: &mcp.ReadResourceParams{URI: "systemd://unit/sshd.service/journal"}}))
+	assert.Equal(t, "get_file", resourceTool(&mcp.SubscribeRequest{Params: &mcp.SubscribeParams{URI: "systemd://unit/sshd.service/dropins"}}))
+	assert.Empty(t, resourceTool(&mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log"}}))
+}
+
+func TestUnitResources(t *testing.T) {
+	noAuth, err := authkeeper.NewNoAuth(true, false)
+	require.NoError(t, err)
+	resources := newUnitResources(noAuth)
+	resources.log = &journal.HostLog{Auth: noAuth}
+	states := map[string]string{"sshd.service": "s=1"}
+	resources.state = func(ctx context.Context, kind, name string) string { return states[name] }
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, &mcp.ServerOptions{
+		SubscribeHandler:   resources.subscribe,
+		UnsubscribeHandler: resources.unsubscribe,
+	})
+	// the unit files and configs need systemd, get_file is disabled anyway
+	require.True(t, resources.register(server, []string{"list_log"}))
+	assert.Equal(t, []string{"journal"}, resources.kinds)
+
+	updated := make(chan string, 10)
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err = server.Connect(context.Background(), serverTransport, nil)
+	require.NoError(t, err)
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(ctx context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			updated <- req.Params.URI
+		},
+	}).Connect(context.Background(), clientTransport, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	templates, err := session.ListResourceTemplates(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, templates.ResourceTemplates, 1)
+	assert.Equal(t, "systemd://unit/{name}/journal", templates.ResourceTemplates[0].URITemplate)
+	_, err = session.ReadResource(context.Background(), &mcp.ReadResourceParams{URI: "systemd://unit/sshd.service/file"})
+	assert.Error(t, err)
+
+	uri := "systemd://unit/sshd.service/journal"
+	require.NoError(t, session.Subscribe(context.Background(), &mcp.SubscribeParams{URI: uri}))
+	assert.Error(t, session.Subscribe(context.Background(), &mcp.SubscribeParams{URI: "systemd://config/journald"}))
+	resources.poll(context.Background())
+	assert.Empty(t, updated)
+
+	states["sshd.service"] = "s=2"
+	resources.poll(context.Background())
+	select {
+	case got := <-updated:
+		assert.Equal(t, uri, got)
+	case <-time.After(time.Second):
+		t.Fatal("no update notification")
+	}
+
+	require.NoError(t, session.Unsubscribe(context.Background(), &mcp.UnsubscribeParams{URI: uri}))
+	assert.Empty(t, resources.watched)
+}
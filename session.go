@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/budget"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/jobs"
+)
+
+// unrestrictedTools are granted by every scope mapping and rbac policy, as
+// dropping the own authorization has to be possible for every caller and
+// the rest of a truncated result was already granted to the session
+var unrestrictedTools = []string{"deauthorize_session", budget.ToolName, jobs.ToolName}
+
+// sessionLocks are the sessions whose authorization was dropped, all their
+// tool calls are denied until the session ends
+type sessionLocks struct {
+	server *mcp.Server
+	// revoke drops the grants of the authorization, like the polkit write
+	// grants which outlive a session
+	revoke func() error
+
+	mu     sync.Mutex
+	locked map[*mcp.ServerSession]bool
+}
+
+func (l *sessionLocks) lock(ss *mcp.ServerSession) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locked == nil {
+		l.locked = make(map[*mcp.ServerSession]bool)
+	}
+	l.locked[ss] = true
+}
+
+func (l *sessionLocks) isLocked(ss *mcp.ServerSession) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.locked[ss]
+}
+
+// prune forgets the sessions which ended
+func (l *sessionLocks) prune() {
+	active := make(map[*mcp.ServerSession]bool)
+	for ss := range l.server.Sessions() {
+		active[ss] = true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ss := range l.locked {
+		if !active[ss] {
+			delete(l.locked, ss)
+		}
+	}
+}
+
+func (l *sessionLocks) revokeGrants() {
+	if l.revoke == nil {
+		return
+	}
+	if err := l.revoke(); err != nil {
+		slog.Debug("couldn't revoke the grants of the authorization", "error", err)
+	}
+}
+
+// deauthorize drops the authorization of the session with the id, or of
+// all sessions if the id is empty, and returns how many were dropped
+func (l *sessionLocks) deauthorize(id string) (int, error) {
+	l.prune()
+	n := 0
+	for ss := range l.server.Sessions() {
+		if id == "" || ss.ID() == id {
+			l.lock(ss)
+			n++
+		}
+	}
+	if id != "" && n == 0 {
+		return 0, fmt.Errorf("no session %q", id)
+	}
+	l.revokeGrants()
+	slog.Warn("session authorization dropped", "audit", "session_deauthorized", "session", id, "sessions", n)
+	return n, nil
+}
+
+type deauthorizeSessionParams struct{}
+
+// deauthorizeSession drops the authorization of the calling session, it
+// needs no authorization itself so that an agent can always stop itself
+func (l *sessionLocks) deauthorizeSession(ctx context.Context, req *mcp.CallToolRequest, params *deauthorizeSessionParams) (*mcp.CallToolResult, any, error) {
+	l.lock(req.Session)
+	l.revokeGrants()
+	user := ""
+	if req.Extra != nil && req.Extra.TokenInfo != nil {
+		user = req.Extra.TokenInfo.UserID
+	}
+	slog.WarnContext(ctx, "session authorization dropped by the client", "audit", "session_deauthorized", "session", req.Session.ID(), "user", user)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: "The authorization of this session was dropped, all further tool calls of the session are denied."}},
+	}, nil, nil
+}
+
+// Middleware denies the tool calls and resource reads of the locked
+// sessions
+func (l *sessionLocks) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method != "tools/call" && method != "resources/read" && method != "resources/subscribe" {
+			return next(ctx, method, req)
+		}
+		if ss, ok := req.GetSession().(*mcp.ServerSession); ok && l.isLocked(ss) {
+			name := resourceTool(req)
+			if call, ok := req.(*mcp.CallToolRequest); ok {
+				name = call.Params.Name
+			}
+			slog.WarnContext(ctx, "request of a deauthorized session denied", "audit", "session_denied", "session", ss.ID(), "method", method, "tool", name)
+			return nil, fmt.Errorf("the authorization of this session was dropped")
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// exportControl offers deauthorize and reload on the system bus when
+// running as root and on the session bus otherwise, the connection is kept
+// open for the lifetime of the server
+func exportControl(deauthorize func(session string) (int, error), reload func() error) {
+	connect := godbus.ConnectSessionBus
+	if os.Geteuid() == 0 {
+		connect = godbus.ConnectSystemBus
+	}
+	conn, err := connect()
+	if err != nil {
+		slog.Warn("couldn't connect to dbus, the control interface isn't offered", "error", err)
+		return
+	}
+	if err := dbus.ExportControl(conn, DBusName, DBusPath, deauthorize, reload); err != nil {
+		slog.Warn("couldn't offer the control interface", "error", err)
+		conn.Close()
+		return
+	}
+	slog.Info("control interface offered", "name", DBusName, "path", DBusPath)
+}
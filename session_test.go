@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type echoParams struct{}
+
+func echo(ctx context.Context, req *mcp.CallToolRequest, params *echoParams) (*mcp.CallToolResult, any, error) {
+	return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "echo"}}}, nil, nil
+}
+
+func TestDeauthorizeSession(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	revoked := 0
+	sessions := &sessionLocks{server: server, revoke: func() error { revoked++; return nil }}
+	mcp.AddTool(server, &mcp.Tool{Name: "echo"}, echo)
+	mcp.AddTool(server, &mcp.Tool{Name: "deauthorize_session"}, sessions.deauthorizeSession)
+	server.AddReceivingMiddleware(sessions.Middleware)
+	connect := func() *mcp.ClientSession {
+		serverTransport, clientTransport := mcp.NewInMemoryTransports()
+		_, err := server.Connect(context.Background(), serverTransport, nil)
+		require.NoError(t, err)
+		session, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(context.Background(), clientTransport, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { session.Close() })
+		return session
+	}
+	call := func(session *mcp.ClientSession, name string) error {
+		_, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name})
+		return err
+	}
+
+	first, second := connect(), connect()
+	require.NoError(t, call(first, "echo"))
+	require.NoError(t, call(first, "deauthorize_session"))
+	assert.Equal(t, 1, revoked)
+	assert.Error(t, call(first, "echo"))
+	assert.Error(t, call(first, "deauthorize_session"))
+	// other sessions keep their authorization
+	assert.NoError(t, call(second, "echo"))
+
+	// the operator drops all sessions, in-memory sessions have no id
+	_, err := sessions.deauthorize("unknown")
+	assert.Error(t, err)
+	n, err := sessions.deauthorize("")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Error(t, call(second, "echo"))
+	assert.Equal(t, 2, revoked)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/journal"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+)
+
+// toolState is the state of the tools which belongs to a session
+type toolState struct {
+	log   *journal.HostLog
+	conns map[*systemd.Connection]*systemd.Connection
+	// calls using the journal, it's closed after the last one
+	users int
+	ended bool
+	// the calls of the session take turns on the journal, as every call
+	// sets its own matches and position
+	logMu sync.Mutex
+}
+
+// sessionStates gives every session its own journal handle, whose matches
+// and position a call changes, and its own channels for the results of the
+// jobs it starts, so that concurrent sessions can't see each others state.
+// The journal of a session is closed once a new session finds it ended and
+// its last call returned.
+type sessionStates struct {
+	server *mcp.Server
+	newLog func() *journal.HostLog
+
+	mu     sync.Mutex
+	states map[*mcp.ServerSession]*toolState
+}
+
+// callSession returns the session of a call, nil for calls without one
+func callSession(req *mcp.CallToolRequest) *mcp.ServerSession {
+	if req == nil {
+		return nil
+	}
+	return req.Session
+}
+
+// get returns the state of the session, calls without a session share one
+func (s *sessionStates) get(ss *mcp.ServerSession) *toolState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states == nil {
+		s.states = make(map[*mcp.ServerSession]*toolState)
+	}
+	state, ok := s.states[ss]
+	if !ok {
+		s.prune()
+		state = &toolState{conns: make(map[*systemd.Connection]*systemd.Connection)}
+		s.states[ss] = state
+	}
+	return state
+}
+
+// log returns the journal of the session, which the call has for itself
+// until it calls done
+func (s *sessionStates) log(ss *mcp.ServerSession) (log *journal.HostLog, done func()) {
+	state := s.get(ss)
+	s.mu.Lock()
+	if state.log == nil {
+		state.log = s.newLog()
+	}
+	state.users++
+	log = state.log
+	s.mu.Unlock()
+	state.logMu.Lock()
+	return log, func() {
+		state.logMu.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		state.users--
+		if state.ended && state.users == 0 {
+			state.close()
+		}
+	}
+}
+
+// conn returns the connection of the session to the service manager of
+// conn
+func (s *sessionStates) conn(ss *mcp.ServerSession, conn *systemd.Connection) *systemd.Connection {
+	state := s.get(ss)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state.conns[conn] == nil {
+		state.conns[conn] = conn.Session()
+	}
+	return state.conns[conn]
+}
+
+// prune drops the state of the sessions which ended, called with the lock
+// held
+func (s *sessionStates) prune() {
+	if s.server == nil {
+		return
+	}
+	active := make(map[*mcp.ServerSession]bool)
+	for ss := range s.server.Sessions() {
+		active[ss] = true
+	}
+	for ss, state := range s.states {
+		if ss != nil && !active[ss] {
+			state.ended = true
+			if state.users == 0 {
+				state.close()
+			}
+			delete(s.states, ss)
+		}
+	}
+}
+
+func (state *toolState) close() {
+	if state.log != nil {
+		state.log.Close()
+		state.log = nil
+	}
+}
+
+// close closes the journals of all sessions when the server stops
+func (s *sessionStates) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ss, state := range s.states {
+		state.ended = true
+		if state.users == 0 {
+			state.close()
+		}
+		delete(s.states, ss)
+	}
+}
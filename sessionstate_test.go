@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/journal"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStates(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	connect := func() (*mcp.ServerSession, *mcp.ClientSession) {
+		serverTransport, clientTransport := mcp.NewInMemoryTransports()
+		ss, err := server.Connect(context.Background(), serverTransport, nil)
+		require.NoError(t, err)
+		cs, err := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil).Connect(context.Background(), clientTransport, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { cs.Close() })
+		return ss, cs
+	}
+	opened := 0
+	states := &sessionStates{server: server, newLog: func() *journal.HostLog {
+		opened++
+		return &journal.HostLog{}
+	}}
+	conn := &systemd.Connection{}
+
+	ss1, cs1 := connect()
+	ss2, _ := connect()
+	log1, done := states.log(ss1)
+	done()
+	log1again, done := states.log(ss1)
+	done()
+	log2, done := states.log(ss2)
+	done()
+	assert.True(t, log1 == log1again, "a session keeps its journal")
+	assert.False(t, log1 == log2, "every session has its own journal")
+	assert.Equal(t, 2, opened)
+
+	assert.True(t, states.conn(ss1, conn) == states.conn(ss1, conn))
+	assert.False(t, states.conn(ss1, conn) == states.conn(ss2, conn), "every session has its own job results")
+
+	// the state of an ended session is dropped when the next one starts
+	_, done = states.log(ss1)
+	cs1.Close()
+	ss1.Wait()
+	ss3, _ := connect()
+	_, done3 := states.log(ss3)
+	done3()
+	states.mu.Lock()
+	_, ok := states.states[ss1]
+	kept := states.states[ss2] != nil
+	states.mu.Unlock()
+	assert.False(t, ok)
+	assert.True(t, kept, "running sessions are kept")
+	done()
+
+	// concurrent calls of a session take turns on its journal
+	_, done = states.log(ss2)
+	acquired := make(chan struct{})
+	go func() {
+		_, done := states.log(ss2)
+		close(acquired)
+		done()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a second call got the journal while the first one used it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	done()
+	<-acquired
+}
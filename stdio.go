@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+)
+
+// markStdio marks the requests which came over stdin/stdout, when they are
+// served next to http. Only the streamable http transport passes the
+// headers of a request, so requests without headers are the stdio ones.
+func markStdio(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if extra := req.GetExtra(); extra == nil || extra.Header == nil {
+			ctx = authkeeper.WithStdio(ctx)
+		}
+		return next(ctx, method, req)
+	}
+}
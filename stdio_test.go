@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkStdio(t *testing.T) {
+	var stdio bool
+	handler := markStdio(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		stdio = authkeeper.IsStdio(ctx)
+		return nil, nil
+	})
+	handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log"}})
+	assert.True(t, stdio)
+	handler(context.Background(), "tools/call", &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{Name: "list_log"}, Extra: &mcp.RequestExtra{Header: http.Header{}}})
+	assert.False(t, stdio)
+}
@@ -2,12 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"log/slog"
-	"net/http"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
@@ -15,17 +15,35 @@ import (
 	_ "embed"
 
 	"github.com/cheynewallace/tabby"
-	"github.com/modelcontextprotocol/go-sdk/auth"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
-	"github.com/modelcontextprotocol/go-sdk/oauthex"
 	"github.com/openSUSE/systemd-mcp/authkeeper"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/audit"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/budget"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/calendar"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/cost"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/file"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/forensics"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/i18n"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/jobs"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/journal"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/man"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/plugin"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/privsep"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/redact"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/remote"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/render"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/requestid"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/resultcache"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/state"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/sysinfo"
 	"github.com/openSUSE/systemd-mcp/internal/pkg/systemd"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/tracing"
 	"github.com/openSUSE/systemd-mcp/remoteauth"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/acme"
 )
 
 const (
@@ -42,6 +60,31 @@ func systemdScopes() []string {
 	return []string{"mcp:read"}
 }
 
+// remoteTools work on the machine of --host, the other tools read the files
+// and the state of the local machine and aren't offered then
+var remoteTools = []string{"list_loaded_units", "list_unit_files", "system_status", "change_unit_state", "check_restart_reload", "list_log", "get_man_page", "lookup_directive", "list_man_pages", "get_info_page", "get_help", calendar.ToolName, "deauthorize_session", budget.ToolName, jobs.ToolName}
+
+// cachedTools only read, so that their results can be kept for
+// --result-cache. follow_file, watch_path and list_log with
+// since_cursor_of_last_call return what changed since the last call and
+// aren't cached.
+var cachedTools = []string{"list_loaded_units", "list_unit_files", "system_status", "get_user_linger", "list_config_settings", "list_audit_log", "get_file", "search_file", "diff_file", "get_system_info", "get_man_page", "lookup_directive", "list_man_pages", "get_help", "get_info_page"}
+
+// tells the connected sessions that the server reverted to read-only
+func notifyWriteExpired(server *mcp.Server) {
+	slog.Warn("write authorization expired, server is read-only", "audit", "write_expired")
+	for session := range server.Sessions() {
+		err := session.Log(context.Background(), &mcp.LoggingMessageParams{
+			Level:  "warning",
+			Logger: "systemd-mcp",
+			Data:   "write authorization expired, the server is read-only now",
+		})
+		if err != nil {
+			slog.Debug("couldn't notify session", "ID", session.ID(), "error", err)
+		}
+	}
+}
+
 func NewRootCmd() *cobra.Command {
 	var rootCmd = &cobra.Command{
 		Use:     "systemd-mcp",
@@ -52,6 +95,18 @@ func NewRootCmd() *cobra.Command {
 			viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 			viper.AutomaticEnv()
 			viper.BindPFlags(cmd.Flags())
+			if cfgFile := viper.GetString("config"); cfgFile != "" {
+				viper.SetConfigFile(cfgFile)
+			} else {
+				viper.SetConfigName("config")
+				viper.AddConfigPath("/etc/systemd-mcp")
+			}
+			if err := viper.ReadInConfig(); err != nil {
+				var notFound viper.ConfigFileNotFoundError
+				if !errors.As(err, &notFound) {
+					return fmt.Errorf("failed to read config file: %w", err)
+				}
+			}
 
 			logLevel := slog.LevelInfo
 			if viper.GetBool("debug") {
@@ -61,51 +116,272 @@ func NewRootCmd() *cobra.Command {
 				Level: logLevel,
 			}
 			var logger *slog.Logger
-			logOutput := os.Stderr
+			var logOutput io.Writer = os.Stderr
+			// opened again on a reload
+			var logs *logFile
 			if viper.GetString("logfile") != "" {
-				f, err := os.OpenFile(viper.GetString("logfile"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-				if err != nil {
-					return fmt.Errorf("failed to open log file: %w", err)
+				var err error
+				if logs, err = openLogFile(viper.GetString("logfile")); err != nil {
+					return err
 				}
-				defer f.Close()
-				logOutput = f
+				defer logs.Close()
+				logOutput = logs
 			}
 
 			// Choose handler based on format preference
 			if viper.GetBool("log-json") {
-				logger = slog.New(slog.NewJSONHandler(logOutput, handlerOpts))
+				logger = slog.New(&requestid.Handler{Handler: slog.NewJSONHandler(logOutput, handlerOpts)})
 			} else {
-				logger = slog.New(slog.NewTextHandler(logOutput, handlerOpts))
+				logger = slog.New(&requestid.Handler{Handler: slog.NewTextHandler(logOutput, handlerOpts)})
 			}
 			slog.SetDefault(logger)
 			slog.Debug("Logger initialized", "level", logLevel)
 
+			// the bench connects like the server
+			if bus := viper.GetString("system-bus"); bus != "" {
+				if err := systemd.SetSystemBus(bus); err != nil {
+					return err
+				}
+			}
+			if viper.GetBool("bench") {
+				printBench(runBench(context.Background(), viper.GetString("controller"), viper.GetBool("skip-tls-verify"), viper.GetString("journal-dir")))
+				return nil
+			}
+
+			if err := applyPolicies(); err != nil {
+				return err
+			}
+			file.SetMaxContentBytes(viper.GetInt("file-max-bytes"))
+			if err := i18n.Check(viper.GetString("lang")); err != nil {
+				return err
+			}
+			i18n.SetDefault(viper.GetString("lang"))
+			if endpoint := viper.GetString("otlp-endpoint"); endpoint != "" {
+				exporter, err := tracing.Setup(endpoint, viper.GetStringSlice("otlp-header"), "systemd-mcp", strings.TrimSpace(version))
+				if err != nil {
+					return err
+				}
+				defer func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					if err := exporter.Shutdown(ctx); err != nil {
+						slog.Warn("couldn't export the last spans", "error", err)
+					}
+				}()
+			}
+			var rbac *rbacPolicy
+			if policyFile := viper.GetString("rbac-policy"); policyFile != "" {
+				if len(viper.GetStringSlice("tool-scopes")) > 0 {
+					return fmt.Errorf("--rbac-policy replaces --tool-scopes, use only one of them")
+				}
+				var err error
+				if rbac, err = loadRBACPolicy(policyFile); err != nil {
+					return err
+				}
+			}
+
+			redactPatterns := viper.GetStringSlice("redact")
+			if viper.GetBool("redact-default") {
+				redactPatterns = append(redactPatterns, redact.DefaultPatterns()...)
+			} else {
+				slog.Warn("redaction of the default secret patterns is disabled")
+			}
+			if redactor, err := redact.New(redactPatterns); err != nil {
+				return err
+			} else {
+				redact.Set(redactor)
+			}
+			state.SetDir(viper.GetString("state-dir"))
+			var remoteHost *remote.Host
+			if spec := viper.GetString("host"); spec != "" {
+				host, err := remote.Parse(spec)
+				if err != nil {
+					return err
+				}
+				remoteHost = host
+			}
+			fleetHosts, fleetErr := parseFleet(remoteHost, viper.GetStringSlice("fleet"))
+			if fleetErr != nil {
+				return fleetErr
+			}
+
+			if viper.GetBool("print-polkit-policy") {
+				messages := make(map[string]string)
+				for _, entry := range viper.GetStringSlice("polkit-message") {
+					action, message, ok := strings.Cut(entry, "=")
+					if !ok || message == "" {
+						return fmt.Errorf("invalid polkit message %q, expected action=message", entry)
+					}
+					messages[action] = message
+				}
+				return dbus.WritePolkitPolicy(os.Stdout, messages)
+			}
+			if viper.GetBool("policy-report") {
+				reportCfg := &policyReportConfig{
+					NoAuth:       viper.GetString("noauth") == magicNoauth,
+					HTTP:         httpAddresses(viper.GetString("http")) != "",
+					Stdio:        viper.GetBool("stdio"),
+					Controller:   viper.GetString("controller"),
+					Issuers:      viper.GetStringSlice("trusted-issuers"),
+					AllowWrite:   viper.GetBool("allow-write"),
+					WriteFor:     viper.GetDuration("allow-write-for"),
+					EnabledTools: viper.GetStringSlice("enabled-tools"),
+					PathPolicy:   file.GetPathPolicy(),
+					UnitPolicy:   systemd.GetUnitPolicy(),
+					ClientCA:     viper.GetString("client-ca") != "",
+					CertWriters:  viper.GetStringSlice("client-cert-write"),
+					APIKeys:      viper.GetString("api-keys") != "",
+					PeerWriters:  viper.GetStringSlice("peercred-write"),
+					PeerPolkit:   viper.GetBool("peercred-polkit"),
+					RBAC:         rbac,
+				}
+				if reportCfg.HTTP {
+					specs, err := parseListenSpecs(httpAddresses(viper.GetString("http")), hasTLS())
+					if err != nil {
+						return err
+					}
+					reportCfg.Specs = specs
+					// like the server, the mapping is only used with a controller
+					if reportCfg.Controller != "" {
+						if reportCfg.ToolScopes, err = parseToolScopes(viper.GetStringSlice("tool-scopes"), nil); err != nil {
+							return err
+						}
+					}
+				}
+				printPolicyReport(reportCfg)
+				return nil
+			}
+			if viper.GetBool("hardening-report") || viper.GetString("install-units") != "" {
+				var specs []listenSpec
+				if httpAddresses(viper.GetString("http")) != "" {
+					var err error
+					if specs, err = parseListenSpecs(httpAddresses(viper.GetString("http")), hasTLS()); err != nil {
+						return err
+					}
+				}
+				if dir := viper.GetString("install-units"); dir != "" {
+					exec, err := os.Executable()
+					if err != nil {
+						return err
+					}
+					unitCfg, err := newUnitConfig(exec, specs, cmd.Flags(), viper.GetString("state-dir"))
+					if err != nil {
+						return err
+					}
+					return installUnits(dir, unitCfg)
+				}
+				statusFile, err := os.Open("/proc/self/status")
+				if err != nil {
+					return err
+				}
+				proc, err := parseProcStatus(statusFile)
+				statusFile.Close()
+				if err != nil {
+					return err
+				}
+				printHardeningReport(&hardeningConfig{
+					Proc:            proc,
+					Systemd:         os.Getenv("INVOCATION_ID") != "",
+					HTTP:            len(specs) > 0,
+					Specs:           specs,
+					NoAuth:          viper.GetString("noauth") == magicNoauth,
+					AllowWrite:      viper.GetBool("allow-write"),
+					WriteFor:        viper.GetDuration("allow-write-for"),
+					AllowPlainHTTP:  viper.GetBool("allow-plain-http"),
+					ExternalURL:     viper.GetString("external-url"),
+					AllowedNetworks: viper.GetStringSlice("allowed-networks"),
+					AllowedOrigins:  viper.GetStringSlice("allowed-origins"),
+					RateLimit:       viper.GetFloat64("rate-limit"),
+					SkipTLSVerify:   viper.GetBool("skip-tls-verify"),
+					FileDefaultDeny: viper.GetBool("file-default-deny"),
+					UnitDefaultDeny: viper.GetBool("unit-default-deny"),
+					RedactDefault:   viper.GetBool("redact-default"),
+				})
+				return nil
+			}
+
 			var authorization authkeeper.AuthKeeper
 			var err error
 
-			isHttp := viper.GetString("http") != ""
+			isHttp := httpAddresses(viper.GetString("http")) != ""
+			serveStdio := !isHttp || viper.GetBool("stdio")
 			hasNoauth := viper.GetString("noauth") == magicNoauth
 			hasController := viper.GetString("controller") != ""
+			hasClientCA := viper.GetString("client-ca") != ""
+			hasAPIKeys := viper.GetString("api-keys") != ""
+			var specs []listenSpec
+			if isHttp {
+				if specs, err = parseListenSpecs(httpAddresses(viper.GetString("http")), hasTLS()); err != nil {
+					return err
+				}
+			}
+			hasPeerCred := slices.ContainsFunc(specs, func(spec listenSpec) bool { return spec.PeerCred })
 
-			if isHttp && !hasNoauth && !hasController {
-				return fmt.Errorf("http mode requires either --controller or --noauth=" + magicNoauth)
+			if isHttp && !hasNoauth && !hasController && !hasClientCA && !hasAPIKeys && !hasPeerCred {
+				return fmt.Errorf("http mode requires either --controller, --client-ca, --api-keys, a peercred listener or --noauth=" + magicNoauth)
+			}
+			if len(viper.GetStringSlice("trusted-issuers")) > 0 && !hasController {
+				return fmt.Errorf("--trusted-issuers requires --controller")
+			}
+			if hasClientCA && !hasTLS() {
+				return fmt.Errorf("--client-ca requires --tls-cert and --tls-key or --acme-domains")
 			}
 
 			if hasNoauth {
 				authorization, _ = authkeeper.NewNoAuth(true, true)
 			} else if hasController {
-				authorization, err = authkeeper.NewOauth(viper.GetString("controller"), viper.GetBool("skip-tls-verify"))
+				requiredClaims, err := remoteauth.ParseRequiredClaims(viper.GetStringSlice("require-claims"))
+				if err != nil {
+					return err
+				}
+				authorization, err = authkeeper.NewOauth(viper.GetString("controller"), viper.GetStringSlice("trusted-issuers"), viper.GetBool("skip-tls-verify"), remoteauth.IntrospectionConfig{
+					Validation:        viper.GetString("token-validation"),
+					Endpoint:          viper.GetString("introspection-endpoint"),
+					ClientID:          viper.GetString("introspection-client-id"),
+					ClientSecret:      viper.GetString("introspection-client-secret"),
+					CacheTTL:          viper.GetDuration("introspection-cache"),
+					IntrospectJWT:     viper.GetBool("introspect-jwt"),
+					RevocationList:    viper.GetString("revocation-list"),
+					RevocationRefresh: viper.GetDuration("revocation-list-refresh"),
+				}, remoteauth.JWKSConfig{
+					Refresh:    viper.GetDuration("jwks-refresh"),
+					UnknownKID: viper.GetDuration("jwks-unknown-kid-interval"),
+				}, &remoteauth.TokenRequirements{
+					Audiences: viper.GetStringSlice("audience"),
+					Claims:    requiredClaims,
+				})
 				if err != nil {
 					return fmt.Errorf("couldn't create connection to controller: %w", err)
 				}
+			} else if isHttp && (hasClientCA || hasAPIKeys || hasPeerCred) {
+				authorization, _ = authkeeper.NewTokenAuth()
 			} else {
-				authorization, err = authkeeper.NewPolkitAuth(DBusName, DBusPath, viper.GetUint32("timeout"))
+				authorization, err = authkeeper.NewPolkitAuth(DBusName, DBusPath, viper.GetUint32("timeout"), viper.GetDuration("write-grant-duration"), viper.GetInt("write-grant-ops"), viper.GetBool("polkit-per-operation"))
 				if err != nil {
 					return fmt.Errorf("failed to setup dbus: %w", err)
 				}
 			}
 			defer authorization.Close()
+			writeFor := viper.GetDuration("allow-write-for")
+			if writeFor > 0 {
+				authorization = authkeeper.NewWriteTimeBox(authorization, writeFor)
+			}
+			// the http handlers need the keeper of the http listeners
+			httpAuthorization := authorization
+			if isHttp && serveStdio && !hasNoauth {
+				// stdio is authorized by polkit like without --http
+				stdioAuthorization, err := authkeeper.NewPolkitAuth(DBusName, DBusPath, viper.GetUint32("timeout"), viper.GetDuration("write-grant-duration"), viper.GetInt("write-grant-ops"), viper.GetBool("polkit-per-operation"))
+				if err != nil {
+					return fmt.Errorf("failed to setup dbus for stdio: %w", err)
+				}
+				defer stdioAuthorization.Close()
+				if writeFor > 0 {
+					stdioAuthorization = authkeeper.NewWriteTimeBox(stdioAuthorization, writeFor)
+				}
+				authorization = authkeeper.NewPerTransport(stdioAuthorization, httpAuthorization)
+			}
 
+			resources := newUnitResources(authorization)
 			server := mcp.NewServer(&mcp.Implementation{
 				Name:    "Systemd connection",
 				Version: strings.TrimSpace(version),
@@ -114,19 +390,76 @@ func NewRootCmd() *cobra.Command {
 					InitializedHandler: func(ctx context.Context, req *mcp.InitializedRequest) {
 						slog.Debug("Session started", "ID", req.Session.ID())
 					},
+					SubscribeHandler:   resources.subscribe,
+					UnsubscribeHandler: resources.unsubscribe,
 				})
-			systemConn, err := systemd.NewSystem(context.Background(), authorization)
+			costs := cost.NewTracker()
+			server.AddReceivingMiddleware(costs.Middleware)
+			// outside the cost, so that the wall time of a call doesn't count
+			// its time in the queue, and inside the background jobs, which
+			// are limited too
+			server.AddReceivingMiddleware(newCallLimiter(viper.GetInt("max-concurrent-calls"), viper.GetInt("max-concurrent-calls-per-session")).Middleware)
+			// the host parameter of the unit and log tools
+			hosts := newFleet(remoteHost, fleetHosts, authorization)
+			if len(fleetHosts) > 0 {
+				server.AddReceivingMiddleware(hosts.Middleware)
+			}
+			// repeated read calls of a session are answered from the cache,
+			// the result before it's rendered and cut by the budget
+			resultCache := resultcache.New(viper.GetDuration("result-cache"))
+			server.AddReceivingMiddleware(resultCache.Middleware)
+			// the format parameter of all tools, with --output-budget the
+			// minimal format is their default
+			render.SetOutputBudget(viper.GetInt("output-budget"))
+			server.AddReceivingMiddleware(render.Middleware)
+			// caps the content of every tool result, continue_result returns the rest
+			responseBudget := budget.New(viper.GetInt("max-response-bytes"))
+			server.AddReceivingMiddleware(responseBudget.Middleware)
+			// write calls with background return a job id at once, get_job
+			// returns their result, which is cut by the budget as well
+			backgroundJobs := jobs.New(viper.GetDuration("job-retention"))
+			server.AddReceivingMiddleware(backgroundJobs.Middleware)
+			if writeFor > 0 {
+				expire := time.AfterFunc(writeFor, func() { notifyWriteExpired(server) })
+				defer expire.Stop()
+			}
+			// a hung backend fails the call instead of stalling the session
+			systemd.SetCallTimeout(viper.GetDuration("dbus-timeout"))
+			journal.SetScanTimeout(viper.GetDuration("journal-timeout"))
+			man.SetTimeout(viper.GetDuration("man-timeout"))
+			var systemConn *systemd.Connection
+			if remoteHost != nil {
+				slog.Info("managing remote host over ssh", "host", remoteHost.String())
+				systemConn, err = systemd.NewRemote(authorization, remoteHost.DialBus)
+			} else if helper := viper.GetString("helper"); helper != "" {
+				// the units are changed by the privileged helper
+				systemConn, err = systemd.NewHelper(context.Background(), authorization, helper)
+			} else {
+				systemConn, err = systemd.NewSystem(context.Background(), authorization)
+			}
 			if err != nil {
 				slog.Warn("couldn't add systemd tools", slog.Any("error", err))
 			}
+			if ttl := viper.GetDuration("unit-property-cache"); ttl > 0 && systemConn != nil {
+				cacheCtx, stopCache := context.WithCancel(context.Background())
+				defer stopCache()
+				if err := systemConn.CacheProperties(cacheCtx, ttl); err != nil {
+					slog.Warn("couldn't cache the unit properties", slog.Any("error", err))
+				}
+			}
 
 			tools := []struct {
 				Tool     *mcp.Tool
 				Register func(server *mcp.Server, tool *mcp.Tool)
 			}{}
 
+			hosts.members[0].conn = systemConn
+			defer hosts.close()
+			states := &sessionStates{server: server}
+			defer states.close()
+			resources.states = states
 			if systemConn != nil {
-				defer systemConn.Close()
+				resources.conn = systemConn
 				tools = append(tools,
 					struct {
 						Tool     *mcp.Tool
@@ -139,7 +472,7 @@ func NewRootCmd() *cobra.Command {
 							InputSchema: systemd.CreateListLoadedUnitsSchema(),
 						},
 						Register: func(server *mcp.Server, tool *mcp.Tool) {
-							mcp.AddTool(server, tool, systemConn.ListLoadedUnits)
+							mcp.AddTool(server, tool, onHost(hosts, states, (*systemd.Connection).ListLoadedUnits))
 						},
 					},
 					struct {
@@ -153,7 +486,20 @@ func NewRootCmd() *cobra.Command {
 							InputSchema: systemd.CreateListUnitFilesSchema(),
 						},
 						Register: func(server *mcp.Server, tool *mcp.Tool) {
-							mcp.AddTool(server, tool, systemConn.ListUnitFiles)
+							mcp.AddTool(server, tool, onHost(hosts, states, (*systemd.Connection).ListUnitFiles))
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:       "System status",
+							Name:        "system_status",
+							Description: "Show the state of the service manager (version, system state, number of failed units and jobs) and the default start and stop timeouts of the jobs.",
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, onHost(hosts, states, (*systemd.Connection).GetSystemStatus))
 						},
 					},
 					struct {
@@ -167,7 +513,7 @@ func NewRootCmd() *cobra.Command {
 							InputSchema: systemd.CreateChangeInputSchema(),
 						},
 						Register: func(server *mcp.Server, tool *mcp.Tool) {
-							mcp.AddTool(server, tool, systemConn.ChangeUnitState)
+							mcp.AddTool(server, tool, onHost(hosts, states, (*systemd.Connection).ChangeUnitState))
 						},
 					},
 					struct {
@@ -177,20 +523,91 @@ func NewRootCmd() *cobra.Command {
 						Tool: &mcp.Tool{
 							Title:       "Check restart/reload status",
 							Name:        "check_restart_reload",
-							Description: "Check the reload or restart status of a unit. Can only be called if the restart or reload job timed out.",
+							Description: "Check the outcome of a job which was still running when change_unit_state timed out. Pass the parameters of check_restart_reload from the change_unit_state result, the job queue and the unit state are checked.",
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, onHost(hosts, states, (*systemd.Connection).CheckForRestartReloadRunning))
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:       "Get user linger",
+							Name:        "get_user_linger",
+							Description: "Show whether a user lingers, i.e. whether its user manager user@UID.service runs without a login session, and the state of the user manager. Without a user all lingering users are listed.",
+							InputSchema: systemd.CreateGetUserLingerSchema(),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.GetUserLinger)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:       "Change user linger",
+							Name:        "change_user_linger",
+							Description: "Enable or disable lingering for a user like 'loginctl enable-linger', or start the user manager user@UID.service. A running user manager is needed to manage user units on headless hosts.",
+							InputSchema: systemd.CreateChangeUserLingerSchema(),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.ChangeUserLinger)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:       "List config settings",
+							Name:        "list_config_settings",
+							Description: "List the effective settings of the configuration of journald, logind, the system manager (system.conf) or oomd. Every setting has the file and line which sets it and the assignments it overrides.",
+							InputSchema: systemd.CreateListConfigSettingsSchema(),
+						},
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							mcp.AddTool(server, tool, systemConn.ListConfigSettings)
+						},
+					},
+					struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: &mcp.Tool{
+							Title:       "Change config drop-in",
+							Name:        "change_config_dropin",
+							Description: "Create or remove a drop-in in /etc/systemd/<daemon>.conf.d/ to change the configuration of journald, logind, the system manager or oomd, e.g. the journald rate limits. Afterwards the daemon is restarted or reloaded so that the change takes effect and the effective settings are returned.",
+							InputSchema: systemd.CreateChangeConfigDropinSchema(),
 						},
 						Register: func(server *mcp.Server, tool *mcp.Tool) {
-							mcp.AddTool(server, tool, systemConn.CheckForRestartReloadRunning)
+							mcp.AddTool(server, tool, systemConn.ChangeConfigDropin)
 						},
 					},
 				)
 			}
 			syslog := journal.HostLog{
 				Auth: authorization,
+				Dir:  viper.GetString("journal-dir"),
+			}
+			// every session reads the journal with its own handle
+			states.newLog = func() *journal.HostLog {
+				return &journal.HostLog{Auth: authorization, Dir: syslog.Dir}
+			}
+			listLog := func(ctx context.Context, req *mcp.CallToolRequest, args *journal.ListLogParams) (*mcp.CallToolResult, any, error) {
+				log, done := states.log(callSession(req))
+				defer done()
+				return log.ListLog(ctx, req, args)
 			}
+			if remoteHost != nil {
+				listLog = (&journal.RemoteLog{Auth: authorization, Host: remoteHost}).ListLog
+			}
+			hosts.members[0].listLog = listLog
 			if err != nil {
 				slog.Warn("couldn't open log, not adding journal tool", slog.Any("error", err))
 			} else {
+				resources.log = &syslog
 				tools = append(tools, struct {
 					Tool     *mcp.Tool
 					Register func(server *mcp.Server, tool *mcp.Tool)
@@ -198,13 +615,32 @@ func NewRootCmd() *cobra.Command {
 					Tool: &mcp.Tool{
 						Title:       "List system log",
 						Name:        "list_log",
-						Description: "Get the last log entries for the given service or unit.",
+						Description: "Get the last log entries for the given service or unit. With since_cursor_of_last_call only the entries newer than the ones returned by the last call are returned.",
 						InputSchema: journal.CreateListLogsSchema(),
 					},
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *journal.ListLogParams) (*mcp.CallToolResult, any, error) {
-							slog.Debug("list_log called", "args", args)
-							res, out, err := syslog.ListLog(ctx, req, args)
+							slog.DebugContext(ctx, "list_log called", "args", args)
+							res, out, err := hosts.member(ctx).listLog(ctx, req, args)
+							return res, out, err
+						})
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:       "List audit log",
+						Name:        "list_audit_log",
+						Description: "List the audit trail of the write tools from the journal, newest first: who called which tool in which session, on which unit or path, with which action and result.",
+						InputSchema: journal.CreateListAuditLogSchema(),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *journal.ListAuditLogParams) (*mcp.CallToolResult, any, error) {
+							slog.DebugContext(ctx, "list_audit_log called", "args", args)
+							log, done := states.log(callSession(req))
+							defer done()
+							res, out, err := log.ListAuditLog(ctx, req, args)
 							return res, out, err
 						})
 					},
@@ -215,40 +651,344 @@ func NewRootCmd() *cobra.Command {
 					Tool: &mcp.Tool{
 						Title:       "Get content of file",
 						Name:        "get_file",
-						Description: "Read a file from the system. Can show content and metadata. Supports pagination for large files.",
+						Description: "Read a file from the system. Can show content and metadata including owner, mode, ACLs, SELinux/AppArmor label, extended attributes, immutable flag and SHA-256 checksum. Supports pagination for large files. The path may be a glob (e.g. /etc/systemd/system/*.service.d/*.conf) to read several files in one call, the line limit then applies to every file. With parse_config INI style files like unit files are returned as sections and keys. Binary files are never returned raw, binary_mode selects a bounded hexdump or strings extraction. Compressed files (gz, xz, bz2) are decompressed, tar and zip archives list their members or show a single member.",
 						InputSchema: file.CreateFileSchema(),
 					},
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
 						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *file.GetFileParams) (*mcp.CallToolResult, any, error) {
-							slog.Debug("get_file called", "args", args)
+							slog.DebugContext(ctx, "get_file called", "args", args)
 							res, out, err := file.GetFile(ctx, req, args, authorization)
 							return res, out, err
 						})
 					},
-				})
-			}
-			if man.IsManAvailable() {
-				tools = append(tools, struct {
+				}, struct {
 					Tool     *mcp.Tool
 					Register func(server *mcp.Server, tool *mcp.Tool)
 				}{
 					Tool: &mcp.Tool{
-						Title:       "Display man page",
-						Name:        "get_man_page",
-						Description: "Retrieve a man page. Supports filtering by section and chapters, and pagination.",
-						InputSchema: man.CreateManPageSchema(),
+						Title:       "Search in files",
+						Name:        "search_file",
+						Description: "Search a file or directory tree with a regular expression. Returns only the matching lines with line numbers and optional context instead of the whole file.",
+						InputSchema: file.CreateSearchFileSchema(),
 					},
 					Register: func(server *mcp.Server, tool *mcp.Tool) {
-						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *man.GetManPageParams) (*mcp.CallToolResult, any, error) {
-							slog.Debug("get_man_page called", "args", args)
-							res, out, err := man.GetManPage(ctx, req, args)
+						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *file.SearchFileParams) (*mcp.CallToolResult, any, error) {
+							slog.DebugContext(ctx, "search_file called", "args", args)
+							res, out, err := file.SearchFile(ctx, req, args, authorization)
 							return res, out, err
 						})
 					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:       "Follow a file",
+						Name:        "follow_file",
+						Description: "Follow a plain text log file like 'tail -f'. Appended lines are sent as notifications until the call is cancelled, the timeout is hit or max_lines is reached.",
+						InputSchema: file.CreateFollowFileSchema(),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *file.FollowFileParams) (*mcp.CallToolResult, any, error) {
+							slog.DebugContext(ctx, "follow_file called", "args", args)
+							res, out, err := file.FollowFile(ctx, req, args, authorization)
+							return res, out, err
+						})
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:       "Watch path",
+						Name:        "watch_path",
+						Description: "Watch files or directories for create, modify, attrib and delete events, e.g. to confirm that a config was regenerated or a certificate renewed. Returns immediately with a watch id, the events are sent as log notifications until the watch expires and can be polled by calling again with the id.",
+						InputSchema: file.CreateWatchPathSchema(),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *file.WatchPathParams) (*mcp.CallToolResult, any, error) {
+							slog.DebugContext(ctx, "watch_path called", "args", args)
+							res, out, err := file.WatchPath(ctx, req, args, authorization)
+							return res, out, err
+						})
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:       "Diff files",
+						Name:        "diff_file",
+						Description: "Compare two files, or a file against given content, and return a unified diff. Useful to compare a vendor unit with an override or to preview a change.",
+						InputSchema: file.CreateDiffFileSchema(),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *file.DiffFileParams) (*mcp.CallToolResult, any, error) {
+							slog.DebugContext(ctx, "diff_file called", "args", args)
+							res, out, err := file.DiffFile(ctx, req, args, authorization)
+							return res, out, err
+						})
+					},
+				}, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:       "Apply patch",
+						Name:        "apply_patch",
+						Description: "Apply a unified diff to a file. Hunks are moved if the lines before them changed, hunks which don't match are reported as conflicts and nothing is written. With dry_run the file isn't changed. A backup of the original is kept as <path>.<time>.bak.",
+						InputSchema: file.CreateApplyPatchSchema(),
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *file.ApplyPatchParams) (*mcp.CallToolResult, any, error) {
+							slog.DebugContext(ctx, "apply_patch called", "args", args)
+							res, out, err := file.ApplyPatch(ctx, req, args, authorization)
+							return res, out, err
+						})
+					},
+				})
+			}
+			tools = append(tools, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "System integrity snapshot",
+					Name:        "forensics_snapshot",
+					Description: "Gather a snapshot for incident response: loaded kernel modules and taint, recently modified setuid/setgid binaries, listening ports with their processes (unusual ones are marked) and units started recently.",
+					InputSchema: forensics.CreateSnapshotSchema(),
 				},
-				)
-			} else {
-				slog.Debug("man binary not found in PATH, skipping get_man_page tool")
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *forensics.SnapshotParams) (*mcp.CallToolResult, any, error) {
+						slog.DebugContext(ctx, "forensics_snapshot called", "args", args)
+						res, out, err := forensics.ForensicsSnapshot(ctx, req, args, authorization, systemConn)
+						return res, out, err
+					})
+				},
+			})
+			tools = append(tools, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "System information",
+					Name:        "get_system_info",
+					Description: "Read and parse /proc/meminfo, /proc/loadavg, the pressure stall information (PSI), /proc/stat, /proc/net/dev and /proc/interrupts into structured JSON.",
+					InputSchema: sysinfo.CreateGetSystemInfoSchema(),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *sysinfo.GetSystemInfoParams) (*mcp.CallToolResult, any, error) {
+						slog.DebugContext(ctx, "get_system_info called", "args", args)
+						res, out, err := sysinfo.GetSystemInfo(ctx, req, args, authorization)
+						return res, out, err
+					})
+				},
+			})
+			// man and info are looked up on the first call, so that the start
+			// doesn't wait for the probes
+			tools = append(tools, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "Display man page",
+					Name:        "get_man_page",
+					Description: "Retrieve a man page as Markdown or plain text. Supports filtering by section and chapters, and pagination.",
+					InputSchema: man.CreateManPageSchema(),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *man.GetManPageParams) (*mcp.CallToolResult, any, error) {
+						slog.DebugContext(ctx, "get_man_page called", "args", args)
+						if err := man.CheckMan(); err != nil {
+							return nil, nil, err
+						}
+						res, out, err := man.GetManPage(ctx, req, args)
+						return res, out, err
+					})
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "Look up systemd directive",
+					Name:        "lookup_directive",
+					Description: "Look up a systemd directive like RuntimeMaxSec in systemd.directives(7) and return only the entries documenting it from the listed man pages, with the chapter they are in. Much cheaper than reading whole man pages.",
+					InputSchema: man.CreateLookupDirectiveSchema(),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *man.LookupDirectiveParams) (*mcp.CallToolResult, any, error) {
+						slog.DebugContext(ctx, "lookup_directive called", "args", args)
+						if err := man.CheckMan(); err != nil {
+							return nil, nil, err
+						}
+						res, out, err := man.LookupDirective(ctx, req, args)
+						return res, out, err
+					})
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "List man pages",
+					Name:        "list_man_pages",
+					Description: "List the installed man pages whose name matches a glob (e.g. systemd* in section 5) with their one line descriptions.",
+					InputSchema: man.CreateListManPagesSchema(),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *man.ListManPagesParams) (*mcp.CallToolResult, any, error) {
+						slog.DebugContext(ctx, "list_man_pages called", "args", args)
+						if err := man.CheckMan(); err != nil {
+							return nil, nil, err
+						}
+						res, out, err := man.ListManPages(ctx, req, args)
+						return res, out, err
+					})
+				},
+			})
+			tools = append(tools, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "Get info page",
+					Name:        "get_info_page",
+					Description: "Read a node of a GNU info document like coreutils or bash, which document some details only in info. Returns the next, previous, up and menu nodes to navigate the document, and supports pagination.",
+					InputSchema: man.CreateInfoPageSchema(),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *man.GetInfoPageParams) (*mcp.CallToolResult, any, error) {
+						slog.DebugContext(ctx, "get_info_page called", "args", args)
+						if err := man.CheckInfo(); err != nil {
+							return nil, nil, err
+						}
+						res, out, err := man.GetInfoPage(ctx, req, args)
+						return res, out, err
+					})
+				},
+			})
+			tools = append(tools, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "Evaluate calendar expression",
+					Name:        calendar.ToolName,
+					Description: "Validate OnCalendar= expressions of timers and return their normalized form and next elapse times, like systemd-analyze calendar. With type timespan or timestamp durations like RuntimeMaxSec= or points in time are validated and normalized instead. Use it to check a timer schedule before writing it.",
+					InputSchema: calendar.CreateEvaluateSchema(),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *calendar.EvaluateParams) (*mcp.CallToolResult, any, error) {
+						slog.DebugContext(ctx, "evaluate_calendar called", "args", args)
+						res, out, err := calendar.Evaluate(ctx, req, args)
+						return res, out, err
+					})
+				},
+			})
+			man.SetHelpBinaries(viper.GetStringSlice("help-binaries"))
+			sessions := &sessionLocks{server: server, revoke: authorization.RevokeGrants}
+			tools = append(tools, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "Deauthorize session",
+					Name:        "deauthorize_session",
+					Description: "Drop the read and write authorization of this session immediately, all further tool calls of the session are denied. Call it when the task is done or the user asks to stop.",
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, sessions.deauthorizeSession)
+				},
+			}, struct {
+				Tool     *mcp.Tool
+				Register func(server *mcp.Server, tool *mcp.Tool)
+			}{
+				Tool: &mcp.Tool{
+					Title:       "Show help of a command",
+					Name:        "get_help",
+					Description: "Show the --help or --version output of an allowed command, e.g. for commands without a man page. No other arguments are passed.",
+					InputSchema: man.CreateGetHelpSchema(),
+				},
+				Register: func(server *mcp.Server, tool *mcp.Tool) {
+					mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args *man.GetHelpParams) (*mcp.CallToolResult, any, error) {
+						slog.DebugContext(ctx, "get_help called", "args", args)
+						res, out, err := man.GetHelp(ctx, req, args)
+						return res, out, err
+					})
+				},
+			})
+
+			if responseBudget != nil {
+				tools = append(tools, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:       "Continue truncated result",
+						Name:        budget.ToolName,
+						Description: "Return the rest of a tool result which exceeded the response size and ended with a truncation marker. Pass the cursor of the marker, a cursor can be continued once and only by the session which got it.",
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, responseBudget.Continue)
+					},
+				})
+			}
+			if backgroundJobs != nil {
+				tools = append(tools, struct {
+					Tool     *mcp.Tool
+					Register func(server *mcp.Server, tool *mcp.Tool)
+				}{
+					Tool: &mcp.Tool{
+						Title:       "Get background job",
+						Name:        jobs.ToolName,
+						Description: "Return the status of a write call which was run with background, and its result once it finished. Pass the job_id of the call, wait waits up to 60s for a running job. A job can only be read by the session which started it.",
+					},
+					Register: func(server *mcp.Server, tool *mcp.Tool) {
+						mcp.AddTool(server, tool, backgroundJobs.Get)
+					},
+				})
+			}
+
+			if remoteHost != nil {
+				n := 0
+				for _, tool := range tools {
+					if slices.Contains(remoteTools, tool.Tool.Name) {
+						tools[n] = tool
+						n++
+					}
+				}
+				tools = tools[:n]
+				// the resources read the local files and journal
+				resources.conn, resources.log = nil, nil
+			}
+			var plugins []*plugin.Plugin
+			if names := viper.GetStringSlice("plugins"); len(names) > 0 {
+				if remoteHost != nil {
+					// the plugins would change this host and not the remote one
+					slog.Warn("not loading plugins for a remote host", "plugins", names)
+				} else {
+					var builtin []string
+					for _, tool := range tools {
+						builtin = append(builtin, tool.Tool.Name)
+					}
+					if plugins, err = plugin.Load(context.Background(), viper.GetString("plugin-dir"), names, builtin, viper.GetDuration("plugin-timeout")); err != nil {
+						return err
+					}
+				}
+			}
+			for _, p := range plugins {
+				for _, pluginTool := range p.Tools {
+					tools = append(tools, struct {
+						Tool     *mcp.Tool
+						Register func(server *mcp.Server, tool *mcp.Tool)
+					}{
+						Tool: pluginTool.MCPTool(),
+						Register: func(server *mcp.Server, tool *mcp.Tool) {
+							server.AddTool(tool, p.Handler(pluginTool, authorization))
+						},
+					})
+				}
 			}
 
 			var allTools []string
@@ -256,6 +996,13 @@ func NewRootCmd() *cobra.Command {
 				allTools = append(allTools, tool.Tool.Name)
 			}
 			if viper.GetBool("list-tools") {
+				if viper.GetBool("json") {
+					listing, err := listTools(context.Background(), tools, plugins)
+					if err != nil {
+						return err
+					}
+					return printToolListing(os.Stdout, listing)
+				}
 				if viper.GetBool("verbose") {
 					tb := tabby.New()
 					tb.AddHeader("TOOL", "DESCRIPTION")
@@ -269,96 +1016,173 @@ func NewRootCmd() *cobra.Command {
 				}
 				return nil
 			}
-			var enabledTools []string
-			if !cmd.Flags().Changed("enabled-tools") {
-				enabledTools = allTools
-			} else {
-				enabledTools = viper.GetStringSlice("enabled-tools")
+			enabledTools := configuredTools(allTools)
+			// the handlers check the token of the call and not the one which
+			// created the session
+			server.AddReceivingMiddleware(remoteauth.RequestTokenMiddleware)
+			if isHttp && serveStdio {
+				server.AddReceivingMiddleware(markStdio)
+			}
+			var scopeMapping toolScopes
+			var withScope func(enabled []string) []string
+			if entries := viper.GetStringSlice("tool-scopes"); len(entries) > 0 && hasController {
+				if scopeMapping, err = parseToolScopes(entries, allTools); err != nil {
+					return err
+				}
+				// tools without a scope can't be called by anyone
+				withScope = func(enabled []string) []string {
+					return slices.DeleteFunc(slices.Clone(enabled), func(name string) bool {
+						if _, ok := scopeMapping[name]; !ok {
+							slog.Debug("tool has no scope, not registering it", "tool", name)
+							return true
+						}
+						return false
+					})
+				}
+				enabledTools = withScope(enabledTools)
+				server.AddReceivingMiddleware(scopeMapping.Middleware)
+			}
+			if rbac != nil {
+				if err := rbac.checkTools(allTools); err != nil {
+					return err
+				}
+				server.AddReceivingMiddleware(rbac.Middleware)
 			}
+			server.AddReceivingMiddleware(sessions.Middleware)
+			reload := &reloader{server: server, tools: tools, filter: withScope, log: logs, cache: resultCache, enabled: enabledTools}
+			if viper.GetBool("dbus-control") {
+				exportControl(sessions.deauthorize, reload.reload)
+			}
+			supervisor := newSupervisor(server)
+			server.AddReceivingMiddleware(supervisor.Middleware)
+			supervisorCtx, stopSupervisor := context.WithCancel(context.Background())
+			defer stopSupervisor()
+			defer supervisor.stopping()
+			// outside the scope mapping, so calls denied by it are recorded too
+			server.AddReceivingMiddleware(audit.Middleware(append(writeTools(), plugin.WriteTools(plugins)...)))
+			backgroundJobs.SetTools(append(writeTools(), plugin.WriteTools(plugins)...))
+			resultCache.SetTools(cachedTools, append(writeTools(), plugin.WriteTools(plugins)...))
+			// the audit log keeps the English errors
+			server.AddReceivingMiddleware(i18n.Middleware)
+			server.AddReceivingMiddleware(tracing.Middleware)
+			if addr := viper.GetString("debug-listen"); addr != "" {
+				calls := newActiveCalls()
+				server.AddReceivingMiddleware(calls.Middleware)
+				debugCtx, stopDebug := context.WithCancel(context.Background())
+				defer stopDebug()
+				if err := serveDebug(debugCtx, addr, debugHandler(server, calls, costs, time.Now())); err != nil {
+					return err
+				}
+			}
+			// the id is given before everything else, so that all log lines
+			// and the span of a call carry it
+			server.AddReceivingMiddleware(requestid.Middleware)
 			// register the enabled tools
 			for _, tool := range tools {
 				if slices.Contains(enabledTools, tool.Tool.Name) {
 					tool.Register(server, tool.Tool)
 				}
 			}
+			registerPrompts(server, enabledTools)
+			reloadCtx, stopReload := context.WithCancel(context.Background())
+			defer stopReload()
+			go reload.watch(reloadCtx)
+			// the resources read the same data as their tools
+			if resources.register(server, enabledTools) {
+				resourcesCtx, stopResources := context.WithCancel(context.Background())
+				defer stopResources()
+				go resources.watch(resourcesCtx)
+			}
 
-			if httpAddr := viper.GetString("http"); httpAddr != "" {
-				handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
-					return server
-				}, nil)
-				if hasNoauth {
-					if viper.GetString("cert-file") == "" {
-						slog.Debug("MCP handler listening at", slog.String("address", httpAddr))
-						if err := http.ListenAndServe(httpAddr, handler); err != nil {
-							slog.Error("couldn't start http server", "error", err)
-						}
-					} else {
-						keyFile := viper.GetString("key-file")
-						certFile := viper.GetString("cert-file")
-						slog.Debug("MCP handler listening with TLS at", slog.String("address", httpAddr))
-						if err := http.ListenAndServeTLS(httpAddr, certFile, keyFile, handler); err != nil {
-							slog.Error("couldn't start tls http server", "error", err)
-						}
+			if isHttp {
+				var clientCerts *clientCertAuth
+				if hasClientCA && !hasNoauth {
+					if clientCerts, err = newClientCertAuth(viper.GetString("client-ca"), viper.GetStringSlice("client-cert-write")); err != nil {
+						return err
 					}
-				} else {
-					oauthProvider, ok := authorization.(authkeeper.OAuth2Provider)
-					if !ok {
-						return fmt.Errorf("authorization is not an OAuth2Provider")
+				}
+				var apiKeys *apiKeyAuth
+				if hasAPIKeys && !hasNoauth {
+					if apiKeys, err = parseAPIKeys(viper.GetString("api-keys")); err != nil {
+						return err
 					}
-					authMiddleware := auth.RequireBearerToken(oauthProvider.VerifyJWT, &auth.RequireBearerTokenOptions{
-						Scopes: systemdScopes(),
-					})
-
-					loggingMiddleware := func(next http.Handler) http.Handler {
-						return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-							authHeader := r.Header.Get("Authorization")
-							slog.Debug("Received request at MCP endpoint",
-								slog.String("path", r.URL.Path),
-								slog.String("method", r.Method),
-								slog.Bool("has_auth_header", authHeader != ""))
-							next.ServeHTTP(w, r)
-						})
+				}
+				var peerCreds *peerCredAuth
+				if hasPeerCred && !hasNoauth {
+					if peerCreds, err = newPeerCredAuth(viper.GetStringSlice("peercred-read"), viper.GetStringSlice("peercred-write"), viper.GetBool("peercred-polkit")); err != nil {
+						return err
 					}
-
-					http.HandleFunc(mcpPath, loggingMiddleware(authMiddleware(handler)).ServeHTTP)
-					// handler for resourceMetaURL
-					// TODO: replace with https://github.com/modelcontextprotocol/go-sdk/pull/643 after it's merged
-					http.HandleFunc(remoteauth.DefaultProtectedResourceMetadataURI+mcpPath, func(w http.ResponseWriter, r *http.Request) {
-						slog.Debug("Client requested OAuth metadata", slog.String("remote_addr", r.RemoteAddr))
-						w.Header().Set("Content-Type", "application/json")
-						w.Header().Set("Access-Control-Allow-Origin", "*")                     // for mcp-inspector
-						w.Header().Set("Access-Control-Allow-Headers", "mcp-protocol-version") // for mcp-inspector
-						prm := &oauthex.ProtectedResourceMetadata{
-							AuthorizationServers:   []string{viper.GetString("controller")},
-							ScopesSupported:        systemdScopes(),
-							BearerMethodsSupported: []string{"header"},
-							JWKSURI:                oauthProvider.JwksUri(),
-						}
-						slog.Debug("Sending OAuth protected resource metadata", slog.Any("metadata", prm))
-						if err := json.NewEncoder(w).Encode(prm); err != nil {
-							slog.Error("couldn't encode heaeder", "error", err)
-						}
-					})
-
-					log.Print("MCP server listening on ", httpAddr+mcpPath)
-					s := &http.Server{
-						Addr:              httpAddr,
-						ReadHeaderTimeout: 3 * time.Second,
+				}
+				ipFilter, err := newIPFilter(viper.GetStringSlice("allowed-networks"), viper.GetStringSlice("trusted-proxies"), viper.GetString("client-ip-header"))
+				if err != nil {
+					return err
+				}
+				cors := corsPolicy{
+					Origins:     viper.GetStringSlice("allowed-origins"),
+					Headers:     viper.GetStringSlice("cors-allow-headers"),
+					MaxAge:      viper.GetDuration("cors-max-age"),
+					Credentials: viper.GetBool("cors-allow-credentials"),
+				}
+				certFile, keyFile := tlsFiles()
+				var acmeSource *acmeCerts
+				if domains := viper.GetStringSlice("acme-domains"); len(domains) > 0 {
+					cacheDir := viper.GetString("state-dir")
+					if cacheDir != "" {
+						cacheDir = filepath.Join(cacheDir, "acme")
 					}
-					if viper.GetString("cert-file") == "" {
-						if err := s.ListenAndServe(); err != nil {
-							slog.Error("couldn't start http server", "error", err)
-						}
-					} else {
-						keyFile := viper.GetString("key-file")
-						certFile := viper.GetString("cert-file")
-						if err := s.ListenAndServeTLS(certFile, keyFile); err != nil {
-							slog.Error("couldn't start tls http server", "error", err)
-						}
+					if acmeSource, err = newACMECerts(domains, viper.GetString("acme-email"), viper.GetString("acme-directory"), cacheDir); err != nil {
+						return err
 					}
 				}
+				if err := cors.validate(); err != nil {
+					return err
+				}
+				serveCtx, stopServing := context.WithCancel(context.Background())
+				defer stopServing()
+				if serveStdio {
+					go func() {
+						slog.Debug("New client has connected via stdin/stdout")
+						if err := server.Run(serveCtx, &mcp.StdioTransport{}); err != nil {
+							slog.Error("Server failed", slog.Any("error", err))
+						}
+						// the server ends with the client which started it
+						stopServing()
+					}()
+				}
+				if err := serveHTTP(serveCtx, server, httpAuthorization, &httpConfig{
+					Specs:             specs,
+					NoAuth:            hasNoauth,
+					Controller:        viper.GetString("controller"),
+					TrustedIssuers:    viper.GetStringSlice("trusted-issuers"),
+					CertFile:          certFile,
+					KeyFile:           keyFile,
+					ACME:              acmeSource,
+					AllowWrite:        viper.GetBool("allow-write"),
+					ExternalURL:       viper.GetString("external-url"),
+					CORS:              cors,
+					Compress:          viper.GetBool("compress-responses"),
+					MaxBodySize:       viper.GetInt64("max-body-size"),
+					MaxHeaderSize:     viper.GetInt("max-header-size"),
+					AuthMaxFailures:   viper.GetInt("auth-max-failures"),
+					AuthFailureWindow: viper.GetDuration("auth-failure-window"),
+					AuthLockout:       viper.GetDuration("auth-lockout"),
+					RateLimit:         viper.GetFloat64("rate-limit"),
+					RateBurst:         viper.GetInt("rate-burst"),
+					GlobalRateLimit:   viper.GetFloat64("global-rate-limit"),
+					GlobalRateBurst:   viper.GetInt("global-rate-burst"),
+					AllowPlainHTTP:    viper.GetBool("allow-plain-http"),
+					ClientCerts:       clientCerts,
+					APIKeys:           apiKeys,
+					PeerCreds:         peerCreds,
+					ToolScopes:        scopeMapping,
+					IPFilter:          ipFilter,
+					Ready:             func() { supervisor.ready(supervisorCtx) },
+				}); err != nil {
+					slog.Error("couldn't start http server", "error", err)
+				}
 			} else {
 				slog.Debug("New client has connected via stdin/stdout")
+				supervisor.ready(supervisorCtx)
 				if err := server.Run(context.Background(), &mcp.StdioTransport{}); err != nil {
 					slog.Error("Server failed", slog.Any("error", err))
 				}
@@ -368,24 +1192,131 @@ func NewRootCmd() *cobra.Command {
 		},
 	}
 
-	rootCmd.Flags().String("http", "", "if set, use streamable HTTP at this address, instead of stdin/stdout")
+	rootCmd.Flags().String("config", "", "Path to the config file, defaults to /etc/systemd-mcp/config.{yaml,json,toml} if present. Keys are the long flag names")
+	rootCmd.Flags().String("http", "", "if set, use streamable HTTP at these comma separated addresses (host:port, [ipv6]:port, unix:/path or systemd:NAME for socket activation) instead of stdin/stdout. Per listener options are appended with ';' (tls, notls, noauth)")
 	rootCmd.Flags().Bool("skip-tls-verify", false, "Skip TLS certificate verification for outbound requests (e.g. to OAuth2 controller)")
+	rootCmd.Flags().Bool("stdio", false, "Serve stdin/stdout next to the --http listeners, stdio calls are authorized by polkit like without --http. The server exits when stdin is closed")
 	rootCmd.Flags().String("logfile", "", "if set, log to this file instead of stderr")
 	rootCmd.Flags().String("controller", "", "oauth2 controller address")
+	rootCmd.Flags().StringSlice("audience", []string{remoteauth.Audience}, "Audiences of which the aud claim of a token needs one")
+	rootCmd.Flags().StringSlice("require-claims", nil, "Claims every token needs as claim or claim=value, e.g. azp=mcp-agent or email_verified=true. A list claim like groups has to contain the value")
+	rootCmd.Flags().StringSlice("trusted-issuers", nil, "Further OAuth2 issuers whose JWTs are accepted next to the ones of --controller, e.g. a local controller next to the corporate IdP")
+	rootCmd.Flags().String("token-validation", remoteauth.ValidationAuto, "How bearer tokens are validated: jwt, introspection or auto, which introspects opaque tokens if --introspection-client-id is set")
+	rootCmd.Flags().String("introspection-endpoint", "", "Token introspection endpoint (RFC 7662), defaults to the introspection_endpoint of the controller")
+	rootCmd.Flags().String("introspection-client-id", "", "Client id of the server at the token introspection endpoint")
+	rootCmd.Flags().String("introspection-client-secret", "", "Client secret of the server at the token introspection endpoint, better set in the config file")
+	rootCmd.Flags().Duration("unit-property-cache", 0, "How long the unit properties of list_loaded_units are cached until systemd signals a change, 0 disables the cache")
+	rootCmd.Flags().Duration("result-cache", 5*time.Second, "How long the result of a read tool is returned again for the same call of a session, 0 disables the cache")
+	rootCmd.Flags().Duration("introspection-cache", time.Minute, "How long the result of an introspected token is cached, 0 disables the cache")
+	rootCmd.Flags().Bool("introspect-jwt", false, "Introspect JWTs of the controller after their local validation too, so revoked tokens are rejected after --introspection-cache")
+	rootCmd.Flags().String("revocation-list", "", "URL of a JSON array with the ids (jti) of revoked tokens, JWTs on it are rejected")
+	rootCmd.Flags().Duration("revocation-list-refresh", remoteauth.DefaultRevocationRefresh, "Interval in which the revocation list is fetched")
+	rootCmd.Flags().Duration("jwks-refresh", remoteauth.DefaultJWKSRefresh, "Interval in which the signing keys of the issuers are fetched, failed fetches are retried earlier")
+	rootCmd.Flags().Duration("jwks-unknown-kid-interval", remoteauth.DefaultJWKSUnknownKID, "Minimal interval between fetches of the signing keys for tokens with an unknown kid, 0 disables them")
+	rootCmd.Flags().String("external-url", "", "Base URL under which clients reach the server (e.g. https://mcp.example.com behind a reverse proxy). Defaults to the Forwarded headers or the request host")
+	rootCmd.Flags().StringSlice("allowed-networks", nil, "Networks in CIDR notation (e.g. 10.1.0.0/16) whose clients may access the HTTP endpoints, others get 403. Empty allows all")
+	rootCmd.Flags().StringSlice("trusted-proxies", nil, "Reverse proxies (addresses or CIDR) whose --client-ip-header is used for the client address")
+	rootCmd.Flags().String("client-ip-header", "X-Forwarded-For", "Header with the client address set by the trusted proxies, X-Forwarded-For or Forwarded")
+	rootCmd.Flags().StringSlice("allowed-origins", []string{"*"}, "Browser origins which may access the HTTP endpoints, '*' allows all origins and 'https://*.example.com' the subdomains")
+	rootCmd.Flags().StringSlice("cors-allow-headers", nil, "Further request headers browsers may send, next to the headers of MCP")
+	rootCmd.Flags().Duration("cors-max-age", 0, "How long browsers may cache a CORS preflight (e.g. 10m), 0 leaves it to the browser")
+	rootCmd.Flags().Bool("cors-allow-credentials", false, "Allow browsers to send credentials like cookies with cross-origin requests")
+	rootCmd.Flags().Bool("compress-responses", true, "Compress the HTTP responses with gzip or deflate for clients which accept it")
+	rootCmd.Flags().Int64("max-body-size", defaultMaxBodySize, "Maximum size of a HTTP request body in bytes, bigger requests are rejected with 413")
+	rootCmd.Flags().Int("max-header-size", defaultMaxHeaderSize, "Maximum size of the HTTP request headers in bytes")
+	rootCmd.Flags().Int("auth-max-failures", 10, "Lock out a source IP after this many failed token validations, 0 disables the lockout")
+	rootCmd.Flags().Duration("auth-failure-window", 5*time.Minute, "Time window in which the failed token validations are counted")
+	rootCmd.Flags().Duration("auth-lockout", 15*time.Minute, "Duration of the lockout after repeated failed token validations")
+	rootCmd.Flags().Float64("rate-limit", defaultRateLimit, "Requests per second allowed for every source IP, more are rejected with 429, 0 disables the limit")
+	rootCmd.Flags().Int("rate-burst", defaultRateBurst, "Number of requests a source IP may send at once above --rate-limit")
+	rootCmd.Flags().Float64("global-rate-limit", 0, "Requests per second allowed for all sources together, 0 disables the limit")
+	rootCmd.Flags().Int("global-rate-burst", 100, "Number of requests all sources may send at once above --global-rate-limit")
+	rootCmd.Flags().Int("max-concurrent-calls", defaultMaxCalls, "Number of tool calls of all sessions running at once, further calls wait for a free slot, 0 disables the limit")
+	rootCmd.Flags().Int("max-concurrent-calls-per-session", defaultMaxCallsPerSession, "Number of tool calls of a session running at once, further calls of the session wait, 0 disables the limit")
 	rootCmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
 	rootCmd.Flags().BoolP("debug", "d", false, "Enable debug logging")
 	rootCmd.Flags().Bool("log-json", false, "Output logs in JSON format (machine-readable)")
 	rootCmd.Flags().Bool("list-tools", false, "List all available tools and exit")
+	rootCmd.Flags().Bool("json", false, "Print --list-tools as JSON with the schemas and the permission class and polkit actions of every tool")
+	rootCmd.Flags().Bool("dbus-control", false, "Offer the Deauthorize(session) method as "+DBusName+" on the session bus, or the system bus for root, to drop the authorization of sessions")
+	rootCmd.Flags().Bool("print-polkit-policy", false, "Print the polkit .policy file of the actions with their localized prompts and exit")
+	rootCmd.Flags().StringArray("polkit-message", nil, "Replace the prompt of a polkit action in the printed policy as action=message")
+	rootCmd.Flags().Bool("hardening-report", false, "Print how exposed the server is with the given flags and privileges and exit")
+	rootCmd.Flags().String("install-units", "", "Write a hardened systemd-mcp.service and systemd-mcp.socket for the given --http addresses and flags to this directory (e.g. /etc/systemd/system) and exit, '-' prints them")
+	rootCmd.Flags().Bool("policy-report", false, "Print which identity may use which capability with the given flags and exit")
+	rootCmd.Flags().Bool("bench", false, "Measure the latency of the startup steps (dbus, journal, man, jwks), log a breakdown and exit")
 	rootCmd.Flags().BoolP("allow-write", "w", false, "Authorize write to systemd or allow pending write if started without write")
+	rootCmd.Flags().Duration("allow-write-for", 0, "Allow write only for this duration (e.g. 30m), afterwards the server reverts to read-only. 0 doesn't limit write")
+	rootCmd.Flags().Duration("write-grant-duration", 0, "Use a write authorization of polkit for this duration (e.g. 10m), afterwards polkit asks again. 0 asks for every write call")
+	rootCmd.Flags().Int("write-grant-ops", 0, "Use a write authorization of polkit for this number of write calls, afterwards polkit asks again. 0 doesn't limit the calls")
+	rootCmd.Flags().Bool("polkit-per-operation", false, "Ask polkit for every write call with the unit, file or user it changes in the prompt, without reusing a previous authorization")
+	rootCmd.Flags().StringSlice("confirm-actions", nil, fmt.Sprintf("Actions the user has to confirm over MCP elicitation, one of %s", strings.Join(systemd.ValidConfirmClasses(), ",")))
 	rootCmd.Flags().BoolP("allow-read", "r", false, "Authorize read to systemd or allow pending read if started without read")
 	rootCmd.Flags().StringSlice("enabled-tools", nil, "A list of tools to enable. Defaults to all tools.")
 	rootCmd.Flags().Uint32("timeout", 5, "Set the timeout for authentication in seconds")
 	rootCmd.Flags().String("noauth", "", fmt.Sprintf("Disable authorization via dbus/oauth2, this parameter has to be set to %s to work.", magicNoauth))
-	rootCmd.Flags().String("cert-file", "", "Path to server certificate file (PEM format) for TLS. Requires --key-file")
-	rootCmd.Flags().String("key-file", "", "Path to server private key file (PEM format) for TLS. Requires --cert-file")
+	rootCmd.Flags().StringSlice("file-allow", nil, "Glob patterns of paths the file tools may read. Defaults to all paths which aren't denied")
+	rootCmd.Flags().StringSlice("file-deny", nil, "Glob patterns of paths the file tools may not read, a pattern without '/' matches the base name")
+	rootCmd.Flags().Bool("file-default-deny", true, "Deny reading shadow files, private keys and kernel memory in the file tools")
+	rootCmd.Flags().StringSlice("unit-allow", nil, "Glob patterns of units the write tools may change. Defaults to all units which aren't denied")
+	rootCmd.Flags().StringSlice("unit-deny", nil, "Glob patterns of units the write tools may not change, a name without suffix is a service")
+	rootCmd.Flags().Bool("unit-default-deny", true, "Deny changing sshd, dbus, polkit and the server itself in the write tools")
+	rootCmd.Flags().Int("file-max-bytes", 256*1024, "Maximum number of content bytes get_file returns per call, the rest is read with the returned cursor")
+	rootCmd.Flags().Int("output-budget", 0, "Return the tool results in the minimal format by default, with abbreviated keys, without zero values and with texts cut after this many characters, 0 keeps the full JSON as default")
+	rootCmd.Flags().Duration("job-retention", time.Hour, "How long get_job returns the result of a finished background job, 0 disables the background parameter of the write tools")
+	rootCmd.Flags().Int("max-response-bytes", 512*1024, "Maximum size of the content of every tool result, about 4 bytes per token. The rest is returned by continue_result, 0 disables the limit")
+	rootCmd.Flags().StringSlice("redact", nil, "Additional regular expressions whose matches are redacted in the output of the file and log tools, with a capture group only the group is redacted")
+	rootCmd.Flags().Bool("redact-default", true, "Redact passwords, tokens and private keys in the output of the file and log tools")
+	rootCmd.Flags().StringSlice("help-binaries", man.DefaultHelpBinaries(), "Commands get_help may run with --help or --version, base names are looked up in PATH")
+	rootCmd.Flags().String("rbac-policy", "", "Policy file which maps users, token claims and uids to roles and roles to tools and units, replaces mcp:read, mcp:write and --tool-scopes")
+	rootCmd.Flags().StringSlice("tool-scopes", nil, "OAuth scope=tool pairs, e.g. mcp:logs=list_log. Tokens then need a scope of the called tool instead of mcp:read or mcp:write, tools without a scope aren't registered")
+	rootCmd.Flags().String("host", "", "Manage [user@]host[:port] over ssh instead of the local machine, like systemctl -H. Only the unit, log and documentation tools are offered")
+	rootCmd.Flags().String("helper", "", "Socket of systemd-mcp-helper, which changes the units so that the server can run unprivileged, e.g. "+privsep.DefaultSocket)
+	rootCmd.Flags().String("system-bus", "", "Socket of the system bus or its directory, e.g. /host/run/dbus when running in a container which manages the host")
+	rootCmd.Flags().String("journal-dir", "", "Journal directory to read instead of the journal of the system, e.g. /host/var/log/journal")
+	rootCmd.Flags().String("otlp-endpoint", "", "OTLP HTTP endpoint to export spans of the tool calls, dbus calls and journal reads to, e.g. http://localhost:4318")
+	rootCmd.Flags().StringSlice("otlp-header", nil, "key=value headers of the OTLP export, e.g. for the authentication at the collector")
+	rootCmd.Flags().String("debug-listen", "", "Serve pprof, runtime stats and the active sessions and tool calls at this loopback address (host:port) or unix:/path, the listener has no authentication")
+	rootCmd.Flags().String("lang", i18n.English, "Language of the tool descriptions and error messages for clients without an Accept-Language header, one of "+strings.Join(i18n.Languages(), ", "))
+	rootCmd.Flags().StringSlice("plugins", nil, "Plugins of --plugin-dir to enable, their tools are added to the tools of the server")
+	rootCmd.Flags().String("plugin-dir", plugin.DefaultDir, "Directory of the plugin executables")
+	rootCmd.Flags().Duration("plugin-timeout", time.Minute, "Time after which a call of a plugin tool is ended, 0 for none")
+	rootCmd.Flags().Duration("dbus-timeout", systemd.DefaultCallTimeout, "Time after which a single call to the service manager is ended, 0 for none")
+	rootCmd.Flags().Duration("journal-timeout", journal.DefaultScanTimeout, "Time after which the journal scan of list_log is ended, 0 for none")
+	rootCmd.Flags().Duration("man-timeout", man.DefaultTimeout, "Time after which the rendering of a man or info page is ended, 0 for none")
+	rootCmd.Flags().StringSlice("fleet", nil, "Further [user@]host[:port] to manage over ssh, selected with the host parameter of the unit and log tools")
+	rootCmd.Flags().String("state-dir", state.DefaultDir, "Directory in which state like the auth lockouts is kept across restarts, empty disables it")
+	rootCmd.Flags().String("tls-cert", "", "Path to server certificate file (PEM format) for TLS. Requires --tls-key")
+	rootCmd.Flags().String("tls-key", "", "Path to server private key file (PEM format) for TLS. Requires --tls-cert")
+	rootCmd.Flags().StringSlice("acme-domains", nil, "Get the TLS certificate of these domains from an ACME CA like Let's Encrypt, the TLS listener has to be reachable on port 443 of the domains")
+	rootCmd.Flags().String("acme-email", "", "Contact address of the ACME account, the CA sends notices about the certificates to it")
+	rootCmd.Flags().String("acme-directory", acme.LetsEncryptURL, "Directory URL of the ACME CA")
+	rootCmd.Flags().String("client-ca", "", "Path to the CA certificates (PEM format) of the client certificates, which then authenticate the clients of TLS listeners. Requires --tls-cert or --acme-domains")
+	rootCmd.Flags().StringSlice("client-cert-write", nil, "Client certificates granted write access, given as CN=, O=, OU=, DNS=, EMAIL= or URI= glob patterns")
+	rootCmd.Flags().String("api-keys", "", "Path to a file with static API keys for HTTP, one 'name role sha256:hash' per line, the role is read or write")
+	rootCmd.Flags().StringSlice("peercred-read", nil, "Users and groups (uid=, user=, gid=, group=) which may read over peercred unix listeners. Defaults to every peer which can open the socket")
+	rootCmd.Flags().StringSlice("peercred-write", []string{"uid=0"}, "Users and groups (uid=, user=, gid=, group=) which may write over peercred unix listeners")
+	rootCmd.Flags().Bool("peercred-polkit", false, "Grant write over peercred unix listeners to the other peers if polkit authorizes their process")
+	rootCmd.Flags().Bool("allow-plain-http", false, "Accept bearer tokens on listeners without TLS which aren't on a loopback address")
 
-	rootCmd.MarkFlagsRequiredTogether("cert-file", "key-file")
+	// the names of the certificate flags before
+	rootCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		switch name {
+		case "cert-file":
+			name = "tls-cert"
+		case "key-file":
+			name = "tls-key"
+		}
+		return pflag.NormalizedName(name)
+	})
+	rootCmd.MarkFlagsRequiredTogether("tls-cert", "tls-key")
+	rootCmd.MarkFlagsMutuallyExclusive("tls-cert", "acme-domains")
 	rootCmd.MarkFlagsMutuallyExclusive("noauth", "controller")
+	rootCmd.MarkFlagsMutuallyExclusive("noauth", "client-ca")
+	rootCmd.MarkFlagsMutuallyExclusive("noauth", "api-keys")
+	rootCmd.MarkFlagsMutuallyExclusive("host", "helper")
+	rootCmd.MarkFlagsMutuallyExclusive("polkit-per-operation", "write-grant-duration")
+	rootCmd.MarkFlagsMutuallyExclusive("polkit-per-operation", "write-grant-ops")
 
 	return rootCmd
 }
@@ -2,8 +2,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
+	"os"
 	"strings"
 	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCLIInvalidOptions(t *testing.T) {
@@ -13,14 +21,19 @@ func TestCLIInvalidOptions(t *testing.T) {
 		expected string // Expected substring in the error message
 	}{
 		{
-			name:     "cert-file missing key-file",
-			args:     []string{"--cert-file=cert.pem"},
-			expected: "if any flags in the group [cert-file key-file] are set they must all be set",
+			name:     "tls-cert missing tls-key",
+			args:     []string{"--tls-cert=cert.pem"},
+			expected: "if any flags in the group [tls-cert tls-key] are set they must all be set",
 		},
 		{
 			name:     "key-file missing cert-file",
 			args:     []string{"--key-file=key.pem"},
-			expected: "if any flags in the group [cert-file key-file] are set they must all be set",
+			expected: "if any flags in the group [tls-cert tls-key] are set they must all be set",
+		},
+		{
+			name:     "mutually exclusive tls-cert and acme-domains",
+			args:     []string{"--tls-cert=cert.pem", "--tls-key=key.pem", "--acme-domains=mcp.example.com"},
+			expected: "if any flags in the group [tls-cert acme-domains] are set none of the others can be",
 		},
 		{
 			name:     "mutually exclusive noauth and controller",
@@ -30,7 +43,7 @@ func TestCLIInvalidOptions(t *testing.T) {
 		{
 			name:     "http mode missing auth configuration",
 			args:     []string{"--http=:8080"},
-			expected: "http mode requires either --controller or --noauth",
+			expected: "http mode requires either --controller, --client-ca, --api-keys, a peercred listener or --noauth=ThisIsInsecure",
 		},
 	}
 
@@ -58,3 +71,30 @@ func TestCLIInvalidOptions(t *testing.T) {
 		})
 	}
 }
+
+// every registered tool has a title and a description in all catalogs
+func TestToolTranslations(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--list-tools", "--json", "--state-dir="})
+	err = cmd.Execute()
+	os.Stdout = stdout
+	w.Close()
+	require.NoError(t, err)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	var listing []toolListing
+	require.NoError(t, json.Unmarshal(out, &listing))
+	require.NotEmpty(t, listing)
+
+	for _, lang := range i18n.Languages()[1:] {
+		for _, tool := range listing {
+			title, description := i18n.Tool(lang, &mcp.Tool{Name: tool.Name})
+			assert.NotEmpty(t, title, "title of %s missing in %s", tool.Name, lang)
+			assert.NotEmpty(t, description, "description of %s missing in %s", tool.Name, lang)
+		}
+	}
+}
@@ -79,7 +79,7 @@ Description=Systemd MCP Server
 After=network.target
 
 [Service]
-ExecStart=$TEST_BINARY --http :8080 --controller ${INTERNAL_CONTROLLER_URL} --cert-file /etc/ssl/certs/server.crt --key-file /etc/ssl/private/server.key --log-json --debug --verbose --skip-tls-verify
+ExecStart=$TEST_BINARY --http :8080 --controller ${INTERNAL_CONTROLLER_URL} --tls-cert /etc/ssl/certs/server.crt --tls-key /etc/ssl/private/server.key --log-json --debug --verbose --skip-tls-verify
 Restart=always
 
 [Install]
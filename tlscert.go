@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certSource gives the tls configuration of the listeners, with either the
+// certificate of files or one issued by an ACME CA
+type certSource interface {
+	tlsConfig() *tls.Config
+}
+
+// tlsFiles returns the certificate and key of --tls-cert and --tls-key.
+// Config files may still name them cert-file and key-file, which were the
+// names of the flags before.
+func tlsFiles() (certFile, keyFile string) {
+	certFile, keyFile = viper.GetString("tls-cert"), viper.GetString("tls-key")
+	if certFile == "" && keyFile == "" {
+		certFile, keyFile = viper.GetString("cert-file"), viper.GetString("key-file")
+	}
+	return certFile, keyFile
+}
+
+// hasTLS returns whether a certificate for the tls listeners is configured
+func hasTLS() bool {
+	certFile, _ := tlsFiles()
+	return certFile != "" || len(viper.GetStringSlice("acme-domains")) > 0
+}
+
+// certReloader serves the certificate of --tls-cert and --tls-key and
+// loads it again once one of the files changed, so that a renewed
+// certificate is used without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// newCertReloader fails if the certificate can't be loaded, later failures
+// keep the previous certificate
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reload loads the certificate if the files changed, mu must be held
+func (c *certReloader) reload() error {
+	certTime, keyTime := modTime(c.certFile), modTime(c.keyFile)
+	if c.cert != nil && certTime.Equal(c.certTime) && keyTime.Equal(c.keyTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("couldn't load the certificate %s: %w", c.certFile, err)
+	}
+	if c.cert != nil {
+		slog.Info("reloaded the tls certificate", "cert_file", c.certFile)
+	}
+	c.cert, c.certTime, c.keyTime = &cert, certTime, keyTime
+	return nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.reload(); err != nil {
+		// e.g. the certificate was written but the key not yet
+		slog.Warn("keeping the previous tls certificate", "error", err)
+	}
+	return c.cert, nil
+}
+
+func (c *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.getCertificate,
+	}
+}
+
+// acmeCerts gets the certificates of the domains from an ACME CA like
+// Let's Encrypt and renews them before they expire. The CA validates the
+// domains with the tls-alpn-01 challenge, which is answered by the tls
+// listener itself, so it has to be reachable on port 443 of the domains.
+type acmeCerts struct {
+	manager *autocert.Manager
+}
+
+// newACMECerts keeps the account key and the certificates in cacheDir, so
+// that a restart doesn't ask the CA again
+func newACMECerts(domains []string, email, directory, cacheDir string) (*acmeCerts, error) {
+	if cacheDir == "" {
+		return nil, fmt.Errorf("--acme-domains requires --state-dir to keep the certificates")
+	}
+	if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+		return nil, fmt.Errorf("couldn't create the acme cache: %w", err)
+	}
+	for _, domain := range domains {
+		if domain == "" || net.ParseIP(domain) != nil {
+			return nil, fmt.Errorf("invalid acme domain %q, only host names get certificates", domain)
+		}
+	}
+	return &acmeCerts{manager: &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      email,
+		Client:     &acme.Client{DirectoryURL: directory},
+	}}, nil
+}
+
+func (a *acmeCerts) tlsConfig() *tls.Config {
+	config := a.manager.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	// the CA doesn't have a client certificate, its challenge has to pass
+	// even if they are required
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if !slices.Equal(hello.SupportedProtos, []string{acme.ALPNProto}) {
+			return nil, nil
+		}
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: a.manager.GetCertificate,
+			NextProtos:     []string{acme.ALPNProto},
+		}, nil
+	}
+	return config
+}
+
+// checkPlainHTTP refuses to accept bearer tokens over plain http on
+// addresses reachable from other hosts. Loopback addresses are fine behind
+// a local reverse proxy, as is an https --external-url of a proxy
+// terminating TLS. The sockets of systemd are checked once they are
+// received by checkPlainListener.
+func checkPlainHTTP(cfg *httpConfig) error {
+	for _, spec := range cfg.Specs {
+		if spec.Network != "tcp" {
+			continue
+		}
+		if err := checkPlainListener(cfg, spec, spec.Address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPlainListener checks a tcp listener of the spec on the address
+func checkPlainListener(cfg *httpConfig, spec listenSpec, address string) error {
+	if cfg.NoAuth || cfg.AllowPlainHTTP || spec.TLS || spec.NoAuth {
+		return nil
+	}
+	if u, err := url.Parse(cfg.ExternalURL); err == nil && u.Scheme == "https" {
+		return nil
+	}
+	host, _, _ := net.SplitHostPort(address)
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("listener %s would accept bearer tokens over plain http, give --tls-cert and --tls-key or --acme-domains, listen on a loopback address behind a TLS terminating proxy or set --allow-plain-http", spec)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+// writeCert writes a self-signed certificate for cn and returns its files
+func writeCert(t *testing.T, dir, cn string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile, keyFile = filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+	c, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	commonName := func() string {
+		cert, err := c.getCertificate(nil)
+		require.NoError(t, err)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return parsed.Subject.CommonName
+	}
+	assert.Equal(t, "first", commonName())
+
+	writeCert(t, dir, "renewed")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	assert.Equal(t, "renewed", commonName())
+
+	// a broken certificate keeps the previous one
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0o644))
+	assert.Equal(t, "renewed", commonName())
+
+	_, err = newCertReloader(filepath.Join(dir, "missing.crt"), keyFile)
+	assert.Error(t, err)
+}
+
+func TestCheckPlainHTTP(t *testing.T) {
+	specs := func(value string) []listenSpec {
+		specs, err := parseListenSpecs(value, true)
+		require.NoError(t, err)
+		return specs
+	}
+	assert.NoError(t, checkPlainHTTP(&httpConfig{Specs: specs("127.0.0.1:8666;notls,[::1]:8666;notls,localhost:8666;notls")}))
+	assert.NoError(t, checkPlainHTTP(&httpConfig{Specs: specs("[::]:8666,unix:/run/systemd-mcp.sock")}))
+	assert.NoError(t, checkPlainHTTP(&httpConfig{Specs: specs("systemd:systemd-mcp;notls;noauth")}))
+	assert.Error(t, checkPlainHTTP(&httpConfig{Specs: specs("127.0.0.1:8666;notls,[::]:8666;notls")}))
+	assert.NoError(t, checkPlainHTTP(&httpConfig{Specs: specs("[::]:8666;notls"), ExternalURL: "https://mcp.example.com"}))
+	assert.Error(t, checkPlainHTTP(&httpConfig{Specs: specs("[::]:8666;notls"), ExternalURL: "http://mcp.example.com"}))
+	assert.NoError(t, checkPlainHTTP(&httpConfig{Specs: specs("[::]:8666;notls"), AllowPlainHTTP: true}))
+	assert.NoError(t, checkPlainHTTP(&httpConfig{Specs: specs("[::]:8666;notls"), NoAuth: true}))
+}
+
+func TestACMECerts(t *testing.T) {
+	_, err := newACMECerts([]string{"mcp.example.com"}, "", acme.LetsEncryptURL, "")
+	assert.Error(t, err, "the certificates need a cache")
+	_, err = newACMECerts([]string{"192.0.2.1"}, "", acme.LetsEncryptURL, t.TempDir())
+	assert.Error(t, err)
+
+	cacheDir := filepath.Join(t.TempDir(), "acme")
+	a, err := newACMECerts([]string{"mcp.example.com"}, "ops@example.com", acme.LetsEncryptURL, cacheDir)
+	require.NoError(t, err)
+	assert.DirExists(t, cacheDir)
+	assert.NoError(t, a.manager.HostPolicy(context.Background(), "mcp.example.com"))
+	assert.Error(t, a.manager.HostPolicy(context.Background(), "other.example.com"))
+
+	config := a.tlsConfig()
+	assert.Contains(t, config.NextProtos, acme.ALPNProto)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	// the challenge of the CA passes even if client certificates are required
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	challenge, err := config.GetConfigForClient(&tls.ClientHelloInfo{SupportedProtos: []string{acme.ALPNProto}})
+	require.NoError(t, err)
+	require.NotNil(t, challenge)
+	assert.Equal(t, tls.NoClientCert, challenge.ClientAuth)
+	client, err := config.GetConfigForClient(&tls.ClientHelloInfo{SupportedProtos: []string{"h2", "http/1.1"}})
+	require.NoError(t, err)
+	assert.Nil(t, client)
+}
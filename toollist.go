@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/plugin"
+)
+
+// toolListing describes a tool for --list-tools --json, so that deployment
+// tooling can generate client configurations and scope mappings
+type toolListing struct {
+	Name         string `json:"name"`
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description"`
+	InputSchema  any    `json:"inputSchema,omitempty"`
+	OutputSchema any    `json:"outputSchema,omitempty"`
+	// Permission is none, read or write
+	Permission    string   `json:"permission"`
+	PolkitActions []string `json:"polkitActions,omitempty"`
+	Capabilities  []string `json:"capabilities,omitempty"`
+}
+
+// toolPermission returns the permission class of a tool and the polkit
+// actions checked for it
+func toolPermission(name string, plugins []*plugin.Plugin) (permission string, actions []string, names []string) {
+	for _, p := range plugins {
+		for _, tool := range p.Tools {
+			if tool.Name != name {
+				continue
+			}
+			switch tool.Auth {
+			case plugin.AuthRead:
+				return plugin.AuthRead, []string{polkitReadAction}, nil
+			case plugin.AuthWrite:
+				return plugin.AuthWrite, []string{dbus.ActionPlugin}, nil
+			}
+			return plugin.AuthNone, nil, nil
+		}
+	}
+	permission = plugin.AuthNone
+	for _, c := range capabilities {
+		if !slices.Contains(c.Tools, name) {
+			continue
+		}
+		names = append(names, c.Name)
+		if c.Polkit != "" && !slices.Contains(actions, c.Polkit) {
+			actions = append(actions, c.Polkit)
+		}
+		switch {
+		case c.Write:
+			permission = plugin.AuthWrite
+		case !c.NoAuth && permission == plugin.AuthNone:
+			permission = plugin.AuthRead
+		}
+	}
+	return permission, actions, names
+}
+
+// listTools registers the tools on a server of its own and lists them like
+// a client does, so the schemas are the ones the SDK infers and advertises
+func listTools(ctx context.Context, tools []struct {
+	Tool     *mcp.Tool
+	Register func(server *mcp.Server, tool *mcp.Tool)
+}, plugins []*plugin.Plugin) ([]toolListing, error) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "systemd-mcp"}, nil)
+	for _, tool := range tools {
+		tool.Register(server, tool.Tool)
+	}
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer serverSession.Close()
+	client := mcp.NewClient(&mcp.Implementation{Name: "list-tools"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	advertised := make(map[string]*mcp.Tool)
+	for tool, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			return nil, err
+		}
+		advertised[tool.Name] = tool
+	}
+	// in the order of the registration, which groups related tools
+	var listing []toolListing
+	for _, tool := range tools {
+		t, ok := advertised[tool.Tool.Name]
+		if !ok {
+			continue
+		}
+		permission, actions, names := toolPermission(t.Name, plugins)
+		listing = append(listing, toolListing{
+			Name:          t.Name,
+			Title:         t.Title,
+			Description:   t.Description,
+			InputSchema:   t.InputSchema,
+			OutputSchema:  t.OutputSchema,
+			Permission:    permission,
+			PolkitActions: actions,
+			Capabilities:  names,
+		})
+	}
+	return listing, nil
+}
+
+func printToolListing(w io.Writer, listing []toolListing) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(listing)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/dbus"
+	"github.com/openSUSE/systemd-mcp/internal/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolPermission(t *testing.T) {
+	permission, actions, names := toolPermission("change_unit_state", nil)
+	assert.Equal(t, "write", permission)
+	assert.Equal(t, []string{polkitManageUnits, polkitManageUnitFiles}, actions)
+	assert.Len(t, names, 2)
+
+	permission, actions, _ = toolPermission("list_log", nil)
+	assert.Equal(t, "read", permission)
+	assert.Equal(t, []string{polkitReadAction}, actions)
+
+	permission, actions, _ = toolPermission("get_man_page", nil)
+	assert.Equal(t, "none", permission)
+	assert.Empty(t, actions)
+
+	plugins := []*plugin.Plugin{{Name: "zypper", Tools: []plugin.Tool{{Name: "zypper_install", Auth: plugin.AuthWrite}}}}
+	permission, actions, _ = toolPermission("zypper_install", plugins)
+	assert.Equal(t, "write", permission)
+	assert.Equal(t, []string{dbus.ActionPlugin}, actions)
+}
+
+func TestListTools(t *testing.T) {
+	type statusArgs struct {
+		Unit string `json:"unit"`
+	}
+	type statusResult struct {
+		State string `json:"state"`
+	}
+	tools := []struct {
+		Tool     *mcp.Tool
+		Register func(server *mcp.Server, tool *mcp.Tool)
+	}{
+		{
+			Tool: &mcp.Tool{Name: "system_status", Description: "status"},
+			Register: func(server *mcp.Server, tool *mcp.Tool) {
+				mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args statusArgs) (*mcp.CallToolResult, statusResult, error) {
+					return nil, statusResult{}, nil
+				})
+			},
+		},
+		{
+			Tool: &mcp.Tool{Name: "change_unit_state", Description: "change"},
+			Register: func(server *mcp.Server, tool *mcp.Tool) {
+				mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args statusArgs) (*mcp.CallToolResult, any, error) {
+					return nil, nil, nil
+				})
+			},
+		},
+	}
+	listing, err := listTools(context.Background(), tools, nil)
+	require.NoError(t, err)
+	require.Len(t, listing, 2)
+	assert.Equal(t, "system_status", listing[0].Name, "kept in the order of the registration")
+	assert.Equal(t, "read", listing[0].Permission)
+	assert.NotNil(t, listing[0].InputSchema)
+	assert.NotNil(t, listing[0].OutputSchema, "inferred by the SDK")
+	assert.Equal(t, "write", listing[1].Permission)
+	assert.Nil(t, listing[1].OutputSchema)
+
+	var out bytes.Buffer
+	require.NoError(t, printToolListing(&out, listing))
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, "system_status", decoded[0]["name"])
+	assert.Contains(t, decoded[0]["inputSchema"], "properties")
+}
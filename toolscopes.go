@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/remoteauth"
+)
+
+// toolScopes maps every tool to the OAuth scopes which grant it. With a
+// mapping a token needs one of the scopes of a tool instead of mcp:read or
+// mcp:write, write tools still need the mcp-admin role.
+type toolScopes map[string][]string
+
+// parseToolScopes parses scope=tool pairs, a scope granting several tools
+// is given once per tool. The tools are checked against the known tools
+// unless they are nil.
+func parseToolScopes(entries []string, tools []string) (toolScopes, error) {
+	mapping := toolScopes{}
+	for _, entry := range entries {
+		scope, tool, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || scope == "" || tool == "" || strings.ContainsAny(scope, " \t") {
+			return nil, fmt.Errorf("invalid tool scope %q, expected scope=tool", entry)
+		}
+		if tools != nil && !slices.Contains(tools, tool) {
+			return nil, fmt.Errorf("tool scope %q names an unknown tool", entry)
+		}
+		if !slices.Contains(mapping[tool], scope) {
+			mapping[tool] = append(mapping[tool], scope)
+		}
+	}
+	return mapping, nil
+}
+
+// scopes returns all the mapped scopes, for the protected resource metadata
+func (ts toolScopes) scopes() []string {
+	var scopes []string
+	for _, s := range ts {
+		for _, scope := range s {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	slices.Sort(scopes)
+	return scopes
+}
+
+func (ts toolScopes) allowed(tool string, scopes []string) bool {
+	if slices.Contains(unrestrictedTools, tool) {
+		return true
+	}
+	return slices.ContainsFunc(ts[tool], func(scope string) bool { return slices.Contains(scopes, scope) })
+}
+
+// Middleware hides the tools the token has no scope for from the tool list
+// and rejects calls of them. Requests without a token, e.g. over stdio,
+// requests of noauth and peercred listeners, of client certificates and of
+// api keys aren't affected.
+func (ts toolScopes) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		extra := req.GetExtra()
+		if extra == nil || extra.TokenInfo == nil || extra.TokenInfo.Extra["listener"] == "noauth" || extra.TokenInfo.Extra["client_cert"] != nil || extra.TokenInfo.Extra["api_key"] != nil || extra.TokenInfo.Extra["peer_uid"] != nil {
+			return next(ctx, method, req)
+		}
+		ti := extra.TokenInfo
+		switch method {
+		case "tools/call":
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok {
+				return next(ctx, method, req)
+			}
+			if !ts.allowed(call.Params.Name, ti.Scopes) {
+				slog.WarnContext(ctx, "tool denied by scope mapping", "audit", "scope_denied", "tool", call.Params.Name, "scopes", ti.Scopes)
+				return nil, fmt.Errorf("calling %s needs one of the scopes %s", call.Params.Name, strings.Join(ts[call.Params.Name], ", "))
+			}
+			return next(remoteauth.WithScopeGrant(ctx, ti), method, req)
+		case "resources/read", "resources/subscribe":
+			// a resource needs the scope of the tool which reads the same data
+			tool := resourceTool(req)
+			if !ts.allowed(tool, ti.Scopes) {
+				slog.Warn("resource denied by scope mapping", "audit", "scope_denied", "tool", tool, "scopes", ti.Scopes)
+				return nil, fmt.Errorf("reading the resource needs one of the scopes %s", strings.Join(ts[tool], ", "))
+			}
+			return next(remoteauth.WithScopeGrant(ctx, ti), method, req)
+		case "tools/list":
+			res, err := next(ctx, method, req)
+			if list, ok := res.(*mcp.ListToolsResult); ok && err == nil {
+				list.Tools = slices.DeleteFunc(list.Tools, func(tool *mcp.Tool) bool { return !ts.allowed(tool.Name, ti.Scopes) })
+			}
+			return res, err
+		}
+		return next(ctx, method, req)
+	}
+}
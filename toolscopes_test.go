@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/openSUSE/systemd-mcp/remoteauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseToolScopes(t *testing.T) {
+	tools := []string{"list_log", "change_unit_state", "get_file"}
+	mapping, err := parseToolScopes([]string{"mcp:logs=list_log", "mcp:units:write=change_unit_state", "mcp:admin=change_unit_state", "mcp:logs=list_log"}, tools)
+	require.NoError(t, err)
+	assert.Equal(t, toolScopes{
+		"list_log":          {"mcp:logs"},
+		"change_unit_state": {"mcp:units:write", "mcp:admin"},
+	}, mapping)
+	assert.Equal(t, []string{"mcp:admin", "mcp:logs", "mcp:units:write"}, mapping.scopes())
+
+	for _, entry := range []string{"mcp:logs", "=list_log", "mcp:logs=", "mcp:logs=unknown_tool", "mcp logs=list_log"} {
+		_, err := parseToolScopes([]string{entry}, tools)
+		assert.Error(t, err, entry)
+	}
+	_, err = parseToolScopes([]string{"mcp:logs=unknown_tool"}, nil)
+	assert.NoError(t, err)
+}
+
+func TestToolScopesMiddleware(t *testing.T) {
+	mapping := toolScopes{"list_log": {"mcp:logs"}, "change_unit_state": {"mcp:units:write"}}
+	var readAllowed bool
+	next := func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if method == "tools/list" {
+			return &mcp.ListToolsResult{Tools: []*mcp.Tool{{Name: "list_log"}, {Name: "change_unit_state"}}}, nil
+		}
+		// the grant replaces mcp:read and mcp:write in the authorization
+		readAllowed, _ = (&remoteauth.Oauth2Auth{}).IsReadAuthorized(ctx)
+		return &mcp.CallToolResult{}, nil
+	}
+	handler := mapping.Middleware(next)
+	token := &auth.TokenInfo{Scopes: []string{"mcp:logs"}, Extra: map[string]any{}}
+	call := func(name string, ti *auth.TokenInfo) error {
+		_, err := handler(context.Background(), "tools/call", &mcp.CallToolRequest{
+			Params: &mcp.CallToolParamsRaw{Name: name},
+			Extra:  &mcp.RequestExtra{TokenInfo: ti},
+		})
+		return err
+	}
+
+	assert.NoError(t, call("list_log", token))
+	assert.True(t, readAllowed)
+	assert.Error(t, call("change_unit_state", token))
+	assert.Error(t, call("get_file", token))
+	// noauth listeners and stdio aren't affected
+	assert.NoError(t, call("get_file", &auth.TokenInfo{Extra: map[string]any{"listener": "noauth"}}))
+	assert.NoError(t, call("get_file", nil))
+	assert.False(t, readAllowed)
+
+	// resources need the scope of the tool reading the same data
+	read := func(uri string) error {
+		_, err := handler(context.Background(), "resources/read", &mcp.ReadResourceRequest{
+			Params: &mcp.ReadResourceParams{URI: uri},
+			Extra:  &mcp.RequestExtra{TokenInfo: token},
+		})
+		return err
+	}
+	assert.NoError(t, read("systemd://unit/sshd.service/journal"))
+	assert.Error(t, read("systemd://unit/sshd.service/file"))
+
+	res, err := handler(context.Background(), "tools/list", &mcp.ListToolsRequest{Extra: &mcp.RequestExtra{TokenInfo: token}})
+	require.NoError(t, err)
+	tools := res.(*mcp.ListToolsResult).Tools
+	require.Len(t, tools, 1)
+	assert.Equal(t, "list_log", tools[0].Name)
+}